@@ -0,0 +1,126 @@
+package git
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/bundle"
+	formatcfg "github.com/go-git/go-git/v5/plumbing/format/config"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/revlist"
+)
+
+// ErrEmptyBundle is returned creating a bundle without references, or without
+// objects once the excluded ones are left out.
+var ErrEmptyBundle = errors.New("refusing to create empty bundle")
+
+// CreateBundle writes a bundle with the given references, and the objects
+// reachable from them, to w, as git bundle create does. The bundle can be
+// cloned or fetched from with the bundle transport, or the file transport
+// given its path.
+func (r *Repository) CreateBundle(w io.Writer, refs []plumbing.ReferenceName, o *CreateBundleOptions) error {
+	if o == nil {
+		o = &CreateBundleOptions{}
+	}
+
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
+	if len(refs) == 0 {
+		return ErrEmptyBundle
+	}
+
+	b := &bundle.Bundle{Version: o.Version}
+	wants := make([]plumbing.Hash, 0, len(refs))
+	for _, name := range refs {
+		ref, err := r.Reference(name, true)
+		if err != nil {
+			return err
+		}
+
+		b.References = append(b.References, plumbing.NewHashReference(name, ref.Hash()))
+		wants = append(wants, ref.Hash())
+	}
+
+	hashes, err := revlist.Objects(r.Storer, wants, o.Exclude)
+	if err != nil {
+		return err
+	}
+
+	if len(hashes) == 0 {
+		return ErrEmptyBundle
+	}
+
+	b.Prerequisites, err = r.bundlePrerequisites(hashes)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+
+	if b.Version == bundle.V3 {
+		objectFormat := cfg.Extensions.ObjectFormat
+		if objectFormat == "" {
+			objectFormat = formatcfg.DefaultObjectFormat
+		}
+
+		b.Capabilities = map[string]string{bundle.ObjectFormatCapability: string(objectFormat)}
+	}
+
+	if err := bundle.NewEncoder(w).Encode(b); err != nil {
+		return err
+	}
+
+	_, err = packfile.NewEncoder(w, r.Storer, false).Encode(hashes, cfg.Pack.Window)
+	return err
+}
+
+// bundlePrerequisites returns the boundary commits of the objects of a
+// bundle: the parents of its commits that aren't in the bundle.
+func (r *Repository) bundlePrerequisites(hashes []plumbing.Hash) ([]bundle.Prerequisite, error) {
+	included := make(map[plumbing.Hash]bool, len(hashes))
+	for _, h := range hashes {
+		included[h] = true
+	}
+
+	var prerequisites []bundle.Prerequisite
+	seen := make(map[plumbing.Hash]bool)
+	for _, h := range hashes {
+		o, err := r.Storer.EncodedObject(plumbing.AnyObject, h)
+		if err != nil {
+			return nil, err
+		}
+
+		if o.Type() != plumbing.CommitObject {
+			continue
+		}
+
+		c, err := object.DecodeCommit(r.Storer, o)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range c.ParentHashes {
+			if included[p] || seen[p] {
+				continue
+			}
+
+			seen[p] = true
+			prerequisite := bundle.Prerequisite{Hash: p}
+			if parent, err := object.GetCommit(r.Storer, p); err == nil {
+				prerequisite.Comment, _, _ = strings.Cut(parent.Message, "\n")
+			}
+
+			prerequisites = append(prerequisites, prerequisite)
+		}
+	}
+
+	return prerequisites, nil
+}
@@ -0,0 +1,221 @@
+package git
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/format/bundle"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	bundletransport "github.com/go-git/go-git/v5/plumbing/transport/bundle"
+	"github.com/go-git/go-git/v5/storage"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/stretchr/testify/suite"
+
+	fixtures "github.com/go-git/go-git-fixtures/v4"
+)
+
+type BundleSuite struct {
+	suite.Suite
+	BaseSuite
+}
+
+func TestBundleSuite(t *testing.T) {
+	suite.Run(t, new(BundleSuite))
+}
+
+func (s *BundleSuite) createBundle(refs []plumbing.ReferenceName, o *CreateBundleOptions) string {
+	r := s.NewRepository(fixtures.Basic().One())
+
+	path := filepath.Join(s.T().TempDir(), "basic.bundle")
+	f, err := os.Create(path)
+	s.NoError(err)
+	s.NoError(r.CreateBundle(f, refs, o))
+	s.NoError(f.Close())
+
+	return path
+}
+
+func (s *BundleSuite) testClone(url string) {
+	r, err := Clone(memory.NewStorage(), nil, &CloneOptions{URL: url})
+	s.NoError(err)
+
+	head, err := r.Head()
+	s.NoError(err)
+	s.Equal(plumbing.Master, head.Name())
+	s.Equal(plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"), head.Hash())
+
+	ref, err := r.Reference("refs/remotes/origin/branch", false)
+	s.NoError(err)
+	s.Equal(plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881"), ref.Hash())
+
+	objects, err := r.Storer.IterEncodedObjects(plumbing.AnyObject)
+	s.NoError(err)
+
+	count := 0
+	s.NoError(objects.ForEach(func(plumbing.EncodedObject) error {
+		count++
+		return nil
+	}))
+	s.Equal(31, count)
+}
+
+func (s *BundleSuite) TestCreateBundleClone() {
+	path := s.createBundle([]plumbing.ReferenceName{plumbing.HEAD, plumbing.Master, "refs/heads/branch"}, nil)
+	s.testClone(path)
+}
+
+func (s *BundleSuite) TestCreateBundleCloneScheme() {
+	path := s.createBundle([]plumbing.ReferenceName{plumbing.HEAD, plumbing.Master, "refs/heads/branch"}, nil)
+	s.testClone("bundle://" + filepath.ToSlash(path))
+}
+
+func (s *BundleSuite) TestCloneBundleFilesystemPacked() {
+	path := s.createBundle([]plumbing.ReferenceName{plumbing.HEAD, plumbing.Master, "refs/heads/branch"}, nil)
+
+	st := filesystem.NewStorage(s.TemporalFilesystem(), cache.NewObjectLRUDefault())
+	_, err := Clone(st, nil, &CloneOptions{URL: path})
+	s.NoError(err)
+
+	packs, err := st.ObjectPacks()
+	s.NoError(err)
+	s.Len(packs, 1)
+}
+
+func (s *BundleSuite) TestCreateBundleExclude() {
+	parent := plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")
+	path := s.createBundle([]plumbing.ReferenceName{plumbing.Master}, &CreateBundleOptions{
+		Version: bundle.V3,
+		Exclude: []plumbing.Hash{parent},
+	})
+
+	f, err := os.Open(path)
+	s.NoError(err)
+	defer f.Close()
+
+	b := &bundle.Bundle{}
+	s.NoError(bundle.NewDecoder(f).Decode(b))
+	s.Equal(bundle.V3, b.Version)
+	s.Equal(map[string]string{bundle.ObjectFormatCapability: "sha1"}, b.Capabilities)
+	s.Equal([]bundle.Prerequisite{{Hash: parent, Comment: "some code"}}, b.Prerequisites)
+
+	st := memory.NewStorage()
+	s.NoError(packfile.UpdateObjectStorage(st, b.Packfile))
+	s.Contains(st.Objects, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	s.NotContains(st.Objects, parent)
+}
+
+func (s *BundleSuite) TestCreateBundleEmpty() {
+	r := s.NewRepository(fixtures.Basic().One())
+
+	var buf bytes.Buffer
+	s.ErrorIs(r.CreateBundle(&buf, nil, nil), ErrEmptyBundle)
+
+	head := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	err := r.CreateBundle(&buf, []plumbing.ReferenceName{plumbing.Master}, &CreateBundleOptions{
+		Exclude: []plumbing.Hash{head},
+	})
+	s.ErrorIs(err, ErrEmptyBundle)
+
+	err = r.CreateBundle(&buf, []plumbing.ReferenceName{plumbing.Master}, &CreateBundleOptions{Version: 4})
+	s.ErrorIs(err, bundle.ErrUnsupportedVersion)
+}
+
+func (s *BundleSuite) TestFetchBundleMissingPrerequisites() {
+	path := s.createBundle([]plumbing.ReferenceName{plumbing.Master}, &CreateBundleOptions{
+		Exclude: []plumbing.Hash{plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")},
+	})
+
+	r, err := Init(memory.NewStorage(), nil)
+	s.NoError(err)
+	_, err = r.CreateRemote(&config.RemoteConfig{Name: DefaultRemoteName, URLs: []string{path}})
+	s.NoError(err)
+
+	err = r.Fetch(&FetchOptions{})
+	s.ErrorIs(err, bundletransport.ErrMissingPrerequisites)
+	s.ErrorContains(err, "918c48b83bd081e863dbe1b80f8998f058cd8294 some code")
+
+	_, err = r.Reference("refs/remotes/origin/master", false)
+	s.ErrorIs(err, plumbing.ErrReferenceNotFound)
+	s.Len(r.Storer.(*memory.Storage).Objects, 0)
+}
+
+// gitBundles creates with git a repository with a file changed by its last
+// commit, a bundle of its first commit and an incremental one of the last
+// commit, whose thin packfile has the blob of the file as a delta against the
+// one of the first commit. It returns the paths of the bundles, and the file
+// of the last commit.
+func (s *BundleSuite) gitBundles() (base, incremental string, content []byte) {
+	if _, err := exec.LookPath("git"); err != nil {
+		s.T().Skip("git not found")
+	}
+
+	dir := s.T().TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=foo", "-c", "user.email=foo@foo.foo"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		s.NoError(err, string(out))
+	}
+
+	var lines []string
+	for i := 0; i < 200; i++ {
+		lines = append(lines, strings.Repeat("line of the file ", i%7+1))
+	}
+
+	file := filepath.Join(dir, "file.txt")
+	git("init", "-q", "-b", "master")
+	s.NoError(os.WriteFile(file, []byte(strings.Join(lines, "\n")), 0o644))
+	git("add", "file.txt")
+	git("commit", "-q", "-m", "base")
+	git("branch", "base")
+
+	lines[100] = "changed line"
+	content = []byte(strings.Join(lines, "\n"))
+	s.NoError(os.WriteFile(file, content, 0o644))
+	git("commit", "-q", "-a", "-m", "change")
+
+	base = filepath.Join(dir, "base.bundle")
+	incremental = filepath.Join(dir, "incremental.bundle")
+	git("bundle", "create", "-q", base, "base")
+	git("bundle", "create", "-q", incremental, "base..master")
+
+	return base, incremental, content
+}
+
+func (s *BundleSuite) TestFetchGitIncrementalBundle() {
+	base, incremental, content := s.gitBundles()
+
+	for _, st := range []storage.Storer{
+		memory.NewStorage(),
+		filesystem.NewStorage(s.TemporalFilesystem(), cache.NewObjectLRUDefault()),
+	} {
+		r, err := Init(st, nil)
+		s.NoError(err)
+		_, err = r.CreateRemote(&config.RemoteConfig{Name: DefaultRemoteName, URLs: []string{base}})
+		s.NoError(err)
+
+		s.NoError(r.Fetch(&FetchOptions{}))
+		s.NoError(r.Fetch(&FetchOptions{RemoteURL: incremental}))
+
+		ref, err := r.Reference("refs/remotes/origin/master", false)
+		s.NoError(err)
+
+		commit, err := r.CommitObject(ref.Hash())
+		s.NoError(err)
+		s.Equal("change\n", commit.Message)
+
+		f, err := commit.File("file.txt")
+		s.NoError(err)
+		contents, err := f.Contents()
+		s.NoError(err)
+		s.Equal(string(content), contents)
+	}
+}
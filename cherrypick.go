@@ -0,0 +1,282 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var (
+	// ErrMainlineRequired is returned when cherry-picking or reverting a
+	// merge commit without giving the mainline parent.
+	ErrMainlineRequired = errors.New("commit is a merge but no mainline was given")
+	// ErrInvalidMainline is returned when the given mainline is not a parent
+	// of the commit being cherry-picked or reverted.
+	ErrInvalidMainline = errors.New("invalid mainline parent")
+)
+
+// CherryPick applies the changes introduced by the given commit on top of
+// HEAD, using a three-way merge between HEAD and the commit, with the parent
+// of the commit as the common ancestor. Unless NoCommit is given, a new
+// commit with the message and the author of the picked commit is created,
+// and its hash returned.
+//
+// The worktree must not contain changes to tracked files. If the changes
+// conflict, the conflicting files are left with conflict markers, recorded as
+// unmerged in the index, and ErrMergeConflict is returned. The cherry-pick
+// can be concluded by committing, once the conflicts are resolved.
+func (w *Worktree) CherryPick(c *object.Commit, opts *CherryPickOptions) (plumbing.Hash, error) {
+	if opts == nil {
+		opts = &CherryPickOptions{}
+	}
+
+	if err := opts.Validate(w.r); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	parent, err := mainlineParent(c, opts.Mainline)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	base, err := treeOrNil(parent)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	theirs, err := c.Tree()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	label := commitLabel(c)
+	p := &commitPick{
+		commit:      c,
+		base:        base,
+		theirs:      theirs,
+		baseLabel:   "parent of " + label,
+		theirsLabel: label,
+		head:        plumbing.CherryPickHead,
+		action:      "cherry-pick",
+		message:     c.Message,
+	}
+
+	if !opts.NoCommit {
+		author := c.Author
+		p.author, p.committer = &author, opts.Committer
+	}
+
+	return w.applyCommitPick(p)
+}
+
+// Revert reverts the changes introduced by the given commit on top of HEAD,
+// using a three-way merge between HEAD and the parent of the commit, with
+// the commit as the common ancestor. Unless NoCommit is given, a new commit
+// with a message describing the revert is created, and its hash returned.
+//
+// The worktree must not contain changes to tracked files. If the changes
+// conflict, the conflicting files are left with conflict markers, recorded as
+// unmerged in the index, and ErrMergeConflict is returned. The revert can be
+// concluded by committing, once the conflicts are resolved.
+func (w *Worktree) Revert(c *object.Commit, opts *RevertOptions) (plumbing.Hash, error) {
+	if opts == nil {
+		opts = &RevertOptions{}
+	}
+
+	if err := opts.Validate(w.r); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	parent, err := mainlineParent(c, opts.Mainline)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	base, err := c.Tree()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	theirs, err := treeOrNil(parent)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if theirs == nil {
+		theirs = &object.Tree{}
+	}
+
+	label := commitLabel(c)
+	p := &commitPick{
+		commit:      c,
+		base:        base,
+		theirs:      theirs,
+		baseLabel:   label,
+		theirsLabel: "parent of " + label,
+		head:        plumbing.RevertHead,
+		action:      "revert",
+		message:     revertMessage(c, parent),
+	}
+
+	if !opts.NoCommit {
+		p.author, p.committer = opts.Committer, opts.Committer
+	}
+
+	return w.applyCommitPick(p)
+}
+
+// commitPick describes how the changes of a commit are applied to HEAD by
+// CherryPick and Revert.
+type commitPick struct {
+	commit                 *object.Commit
+	base, theirs           *object.Tree
+	baseLabel, theirsLabel string
+	// head is the reference recording the commit while there are conflicts.
+	head plumbing.ReferenceName
+	// action prefixes the reflog message of the new commit.
+	action  string
+	message string
+	// author and committer of the new commit, no commit is created if nil.
+	author, committer *object.Signature
+	// amend replaces the HEAD commit instead of creating a child of it.
+	amend bool
+}
+
+// applyCommitPick merges the changes between the base and theirs trees of p
+// into HEAD, committing the result if requested.
+func (w *Worktree) applyCommitPick(p *commitPick) (plumbing.Hash, error) {
+	head, err := w.r.Head()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	ours, err := w.r.getTreeFromCommitHash(head.Hash())
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if hasTrackedChanges(status) {
+		return plumbing.ZeroHash, ErrWorktreeNotClean
+	}
+
+	res, err := object.MergeTrees(w.r.Storer, p.base, ours, p.theirs, &object.MergeTreesOptions{
+		BaseLabel:   p.baseLabel,
+		OursLabel:   plumbing.HEAD.String(),
+		TheirsLabel: p.theirsLabel,
+	})
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	commit := p.committer != nil
+	if commit && !p.amend && res.IsClean() && res.Tree == ours.Hash {
+		return plumbing.ZeroHash, ErrEmptyCommit
+	}
+
+	tree, err := object.GetTree(w.r.Storer, res.Tree)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if err := w.checkoutTree(status, ours, tree); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if !res.IsClean() {
+		if err := w.addConflictsToIndex(res.Conflicts); err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		if commit {
+			ref := plumbing.NewHashReference(p.head, p.commit.Hash)
+			if err := w.r.Storer.SetReference(ref); err != nil {
+				return plumbing.ZeroHash, err
+			}
+		}
+
+		return plumbing.ZeroHash, ErrMergeConflict
+	}
+
+	if !commit {
+		return plumbing.ZeroHash, nil
+	}
+
+	parents := []plumbing.Hash{head.Hash()}
+	if p.amend {
+		c, err := w.r.CommitObject(head.Hash())
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		parents = c.ParentHashes
+	}
+
+	h, err := w.buildCommitObject(p.message, &CommitOptions{
+		Author:    p.author,
+		Committer: p.committer,
+		Parents:   parents,
+	}, res.Tree)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	subject, _, _ := strings.Cut(strings.TrimSpace(p.message), "\n")
+	return h, w.updateHEAD(h, p.committer, p.action+": "+subject)
+}
+
+// mainlineParent returns the parent of c the changes are computed against,
+// or nil if c is a root commit.
+func mainlineParent(c *object.Commit, mainline int) (*object.Commit, error) {
+	switch {
+	case c.NumParents() == 0:
+		if mainline != 0 {
+			return nil, ErrInvalidMainline
+		}
+
+		return nil, nil
+	case c.NumParents() > 1 && mainline == 0:
+		return nil, ErrMainlineRequired
+	case mainline > c.NumParents():
+		return nil, ErrInvalidMainline
+	case mainline == 0:
+		mainline = 1
+	}
+
+	return c.Parent(mainline - 1)
+}
+
+// treeOrNil returns the tree of c, or nil if c is nil.
+func treeOrNil(c *object.Commit) (*object.Tree, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	return c.Tree()
+}
+
+// commitLabel returns the name used to refer to c on conflict markers, as
+// git does.
+func commitLabel(c *object.Commit) string {
+	subject, _, _ := strings.Cut(strings.TrimSpace(c.Message), "\n")
+	return fmt.Sprintf("%s (%s)", c.Hash.String()[:7], subject)
+}
+
+// revertMessage returns the message of the commit reverting c, in the same
+// format used by git.
+func revertMessage(c, parent *object.Commit) string {
+	subject, _, _ := strings.Cut(strings.TrimSpace(c.Message), "\n")
+	msg := fmt.Sprintf("Revert \"%s\"\n\nThis reverts commit %s", subject, c.Hash)
+	if c.NumParents() > 1 {
+		msg += fmt.Sprintf(", reversing\nchanges made to %s", parent.Hash)
+	}
+
+	return msg + ".\n"
+}
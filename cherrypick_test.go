@@ -0,0 +1,196 @@
+package git
+
+import (
+	"os"
+	"time"
+
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var pickSignature = &object.Signature{
+	Name:  "picker",
+	Email: "picker@fake.local",
+	When:  mergeSignature.When.Add(time.Hour),
+}
+
+func (s *RepositorySuite) TestCherryPick() {
+	r, w := setupMerge(s, map[string][]byte{
+		"foo": []byte("a\nb\nc\nd\ne\n"),
+		"bar": []byte("bar\n"),
+	})
+
+	s.checkoutBranch(w, "feature")
+	picked := commitFiles(s, w, map[string][]byte{
+		"foo": []byte("a\nb\nc\nd\nE\n"),
+		"new": []byte("new\n"),
+	})
+
+	s.checkoutBranch(w, "master")
+	head := commitFiles(s, w, map[string][]byte{"foo": []byte("A\nb\nc\nd\ne\n")})
+
+	c, err := r.CommitObject(picked)
+	s.NoError(err)
+
+	h, err := w.CherryPick(c, &CherryPickOptions{Committer: pickSignature})
+	s.NoError(err)
+
+	commit, err := r.CommitObject(h)
+	s.NoError(err)
+	s.Equal(c.Message, commit.Message)
+	s.Equal(c.Author.Name, commit.Author.Name)
+	s.Equal(pickSignature.Name, commit.Committer.Name)
+	s.Equal([]plumbing.Hash{head}, commit.ParentHashes)
+
+	content, err := util.ReadFile(w.Filesystem, "foo")
+	s.NoError(err)
+	s.Equal("A\nb\nc\nd\nE\n", string(content))
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.True(status.IsClean())
+
+	entries, err := r.Reflog(plumbing.HEAD)
+	s.NoError(err)
+	s.Equal("cherry-pick: commit", entries[0].Message)
+
+	_, err = w.CherryPick(c, &CherryPickOptions{Committer: pickSignature})
+	s.ErrorIs(err, ErrEmptyCommit)
+}
+
+func (s *RepositorySuite) TestCherryPickNoCommit() {
+	r, w := setupMerge(s, map[string][]byte{"foo": []byte("foo\n")})
+
+	s.checkoutBranch(w, "feature")
+	picked := commitFiles(s, w, map[string][]byte{"bar": []byte("bar\n")})
+	s.checkoutBranch(w, "master")
+
+	c, err := r.CommitObject(picked)
+	s.NoError(err)
+
+	h, err := w.CherryPick(c, &CherryPickOptions{NoCommit: true})
+	s.NoError(err)
+	s.True(h.IsZero())
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.Equal(Status{"bar": &FileStatus{Staging: Added, Worktree: Unmodified}}, status)
+}
+
+func (s *RepositorySuite) TestCherryPickConflict() {
+	r, w := setupMerge(s, map[string][]byte{"foo": []byte("foo\n")})
+
+	s.checkoutBranch(w, "feature")
+	picked := commitFiles(s, w, map[string][]byte{"foo": []byte("bar\n")})
+	s.checkoutBranch(w, "master")
+	commitFiles(s, w, map[string][]byte{"foo": []byte("baz\n")})
+
+	c, err := r.CommitObject(picked)
+	s.NoError(err)
+
+	_, err = w.CherryPick(c, &CherryPickOptions{Committer: pickSignature})
+	s.ErrorIs(err, ErrMergeConflict)
+
+	content, err := util.ReadFile(w.Filesystem, "foo")
+	s.NoError(err)
+	s.Equal("<<<<<<< HEAD\nbaz\n=======\nbar\n>>>>>>> "+commitLabel(c)+"\n", string(content))
+
+	ref, err := r.Reference(plumbing.CherryPickHead, false)
+	s.NoError(err)
+	s.Equal(picked, ref.Hash())
+
+	s.NoError(util.WriteFile(w.Filesystem, "foo", []byte("bar\nbaz\n"), 0o644))
+	_, err = w.Add("foo")
+	s.NoError(err)
+	_, err = w.Commit("resolved", &CommitOptions{Author: mergeSignature})
+	s.NoError(err)
+
+	_, err = r.Reference(plumbing.CherryPickHead, false)
+	s.ErrorIs(err, plumbing.ErrReferenceNotFound)
+}
+
+func (s *RepositorySuite) TestCherryPickMainline() {
+	r, w := setupMerge(s, map[string][]byte{"foo": []byte("foo\n")})
+
+	s.checkoutBranch(w, "feature")
+	commitFiles(s, w, map[string][]byte{"bar": []byte("bar\n")})
+	s.checkoutBranch(w, "master")
+	commitFiles(s, w, map[string][]byte{"baz": []byte("baz\n")})
+	s.NoError(s.mergeBranch(r, "feature"))
+
+	merge, err := r.Head()
+	s.NoError(err)
+	c, err := r.CommitObject(merge.Hash())
+	s.NoError(err)
+
+	s.Require().NoError(r.Storer.SetReference(plumbing.NewHashReference(
+		plumbing.NewBranchReferenceName("other"), c.ParentHashes[1],
+	)))
+	s.checkoutBranch(w, "other")
+
+	_, err = w.CherryPick(c, &CherryPickOptions{Committer: pickSignature})
+	s.ErrorIs(err, ErrMainlineRequired)
+
+	_, err = w.CherryPick(c, &CherryPickOptions{Mainline: 3, Committer: pickSignature})
+	s.ErrorIs(err, ErrInvalidMainline)
+
+	_, err = w.CherryPick(c, &CherryPickOptions{Mainline: 2, Committer: pickSignature})
+	s.NoError(err)
+
+	_, err = w.Filesystem.Lstat("baz")
+	s.NoError(err)
+}
+
+func (s *RepositorySuite) TestRevert() {
+	r, w := setupMerge(s, map[string][]byte{"foo": []byte("a\nb\nc\nd\ne\n")})
+
+	reverted := commitFiles(s, w, map[string][]byte{
+		"foo": []byte("A\nb\nc\nd\ne\n"),
+		"new": []byte("new\n"),
+	})
+	commitFiles(s, w, map[string][]byte{"foo": []byte("A\nb\nc\nd\nE\n")})
+
+	c, err := r.CommitObject(reverted)
+	s.NoError(err)
+
+	h, err := w.Revert(c, &RevertOptions{Committer: pickSignature})
+	s.NoError(err)
+
+	commit, err := r.CommitObject(h)
+	s.NoError(err)
+	s.Equal("Revert \"commit\"\n\nThis reverts commit "+reverted.String()+".\n", commit.Message)
+	s.Equal(pickSignature.Name, commit.Author.Name)
+
+	content, err := util.ReadFile(w.Filesystem, "foo")
+	s.NoError(err)
+	s.Equal("a\nb\nc\nd\nE\n", string(content))
+
+	_, err = w.Filesystem.Lstat("new")
+	s.ErrorIs(err, os.ErrNotExist)
+
+	entries, err := r.Reflog(plumbing.HEAD)
+	s.NoError(err)
+	s.Equal("revert: Revert \"commit\"", entries[0].Message)
+}
+
+func (s *RepositorySuite) TestRevertConflict() {
+	r, w := setupMerge(s, map[string][]byte{"foo": []byte("foo\n")})
+
+	reverted := commitFiles(s, w, map[string][]byte{"foo": []byte("bar\n")})
+	commitFiles(s, w, map[string][]byte{"foo": []byte("baz\n")})
+
+	c, err := r.CommitObject(reverted)
+	s.NoError(err)
+
+	_, err = w.Revert(c, &RevertOptions{Committer: pickSignature})
+	s.ErrorIs(err, ErrMergeConflict)
+
+	ref, err := r.Reference(plumbing.RevertHead, false)
+	s.NoError(err)
+	s.Equal(reverted, ref.Hash())
+
+	s.NoError(w.Reset(&ResetOptions{Mode: HardReset}))
+	_, err = r.Reference(plumbing.RevertHead, false)
+	s.ErrorIs(err, plumbing.ErrReferenceNotFound)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/git"
+)
+
+// CmdDaemon command serves the repositories over the git protocol, see:
+// https://git-scm.com/docs/git-daemon
+type CmdDaemon struct {
+	cmd
+
+	Listen    string   `long:"listen" description:"Listen on the given host" default:""`
+	Port      int      `long:"port" description:"Listen on the given port" default:"9418"`
+	BasePath  string   `long:"base-path" description:"Remap the paths requested relative to the given path"`
+	ExportAll bool     `long:"export-all" description:"Export every repository, instead of the ones with the git-daemon-export-ok file"`
+	Enable    []string `long:"enable" description:"Enable the given service, only receive-pack can be enabled"`
+}
+
+// Usage returns the usage of the command.
+func (CmdDaemon) Usage() string {
+	return fmt.Sprintf("usage: %s daemon [--listen=<host>] [--port=<n>] [--base-path=<path>] [--export-all] [--enable=receive-pack]", os.Args[0])
+}
+
+// Execute runs the command.
+func (c *CmdDaemon) Execute(args []string) error {
+	s := &git.Server{
+		Addr:      net.JoinHostPort(c.Listen, strconv.Itoa(c.Port)),
+		ExportAll: c.ExportAll,
+	}
+
+	if c.BasePath != "" {
+		base, err := filepath.Abs(c.BasePath)
+		if err != nil {
+			return err
+		}
+
+		s.BasePath = filepath.ToSlash(base)
+	}
+
+	for _, service := range c.Enable {
+		if service != "receive-pack" {
+			return fmt.Errorf("unknown service: %s", service)
+		}
+
+		s.ReceivePack = true
+	}
+
+	if c.Verbose {
+		s.ErrorLog = log.New(os.Stderr, "", log.LstdFlags)
+	}
+
+	return s.ListenAndServe()
+}
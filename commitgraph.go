@@ -0,0 +1,339 @@
+package git
+
+import (
+	"errors"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	commitgraph "github.com/go-git/go-git/v5/plumbing/format/commitgraph/v2"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// ErrCommitGraphNotSupported is returned writing a commit-graph in a
+// repository whose storage doesn't support them.
+var ErrCommitGraphNotSupported = errors.New("commit-graph not supported by the storage")
+
+// maxGenerationV1 is the largest topological level stored in a
+// commit-graph, the generation numbers above it are capped.
+const maxGenerationV1 = 0x3fffffff
+
+// WriteCommitGraph writes the commit-graph of the commits reachable from the
+// references of the repository, as git commit-graph write --reachable does.
+// Once written, the commit-graph is used by the storage to walk the history
+// without decoding the commits. Nothing is written in shallow repositories,
+// as git does.
+func (r *Repository) WriteCommitGraph(o *WriteCommitGraphOptions) error {
+	if o == nil {
+		o = &WriteCommitGraphOptions{}
+	}
+
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
+	cgs, ok := r.Storer.(storer.CommitGraphStorer)
+	if !ok {
+		return ErrCommitGraphNotSupported
+	}
+
+	shallow, err := r.Storer.Shallow()
+	if err != nil || len(shallow) != 0 {
+		return err
+	}
+
+	current, err := cgs.CommitGraph()
+	if err != nil {
+		return err
+	}
+
+	idx := commitgraph.NewMemoryIndex()
+	if o.Split && current != nil {
+		idx = commitgraph.NewMemoryIndexWithParent(current)
+	}
+
+	tips, err := r.commitGraphTips()
+	if err != nil {
+		return err
+	}
+
+	w := &commitGraphWriter{
+		s:            r.Storer,
+		idx:          idx,
+		current:      current,
+		changedPaths: o.ChangedPaths || hasBloomFilters(current),
+	}
+	for _, h := range tips {
+		if err := w.add(h); err != nil {
+			return err
+		}
+	}
+
+	if !o.Split {
+		return cgs.SetCommitGraph(idx)
+	}
+
+	if current != nil && len(idx.Hashes()) == 0 {
+		return nil
+	}
+
+	return cgs.AddCommitGraphLayer(idx, o.SizeMultiple)
+}
+
+// commitGraph returns the commit-graph of the storage, if it has one.
+func (r *Repository) commitGraph() commitgraph.Index {
+	cgs, ok := r.Storer.(storer.CommitGraphStorer)
+	if !ok {
+		return nil
+	}
+
+	index, err := cgs.CommitGraph()
+	if err != nil {
+		return nil
+	}
+
+	return index
+}
+
+// commitGraphTips returns the commits the references of the repository
+// point to, peeling the tags.
+func (r *Repository) commitGraphTips() ([]plumbing.Hash, error) {
+	refs, err := r.Storer.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	var tips []plumbing.Hash
+	seen := make(map[plumbing.Hash]bool)
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+
+		h := ref.Hash()
+		for !seen[h] {
+			seen[h] = true
+			o, err := r.Storer.EncodedObject(plumbing.AnyObject, h)
+			if err != nil {
+				return err
+			}
+
+			switch o.Type() {
+			case plumbing.CommitObject:
+				tips = append(tips, h)
+			case plumbing.TagObject:
+				tag, err := object.DecodeTag(r.Storer, o)
+				if err != nil {
+					return err
+				}
+
+				h = tag.Target
+			}
+		}
+
+		return nil
+	})
+
+	return tips, err
+}
+
+// commitGraphWriter adds commits to the index of a commit-graph, computing
+// their generation numbers.
+type commitGraphWriter struct {
+	s   storer.EncodedObjectStorer
+	idx *commitgraph.MemoryIndex
+	// current is the commit-graph the data of the commits is read from,
+	// instead of decoding them, if any.
+	current commitgraph.Index
+	// changedPaths computes the changed-path Bloom filters of the commits
+	// missing from current.
+	changedPaths bool
+}
+
+// add adds the given commit and its ancestors missing from the index,
+// parents first.
+func (w *commitGraphWriter) add(h plumbing.Hash) error {
+	pending := make(map[plumbing.Hash]*commitgraph.CommitData)
+	stack := []plumbing.Hash{h}
+	for len(stack) > 0 {
+		h := stack[len(stack)-1]
+		if _, err := w.idx.GetIndexByHash(h); err == nil {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		data, ok := pending[h]
+		if !ok {
+			var err error
+			if data, err = w.commitData(h); err != nil {
+				return err
+			}
+
+			pending[h] = data
+		}
+
+		missing := false
+		for _, p := range data.ParentHashes {
+			if _, err := w.idx.GetIndexByHash(p); err != nil {
+				stack = append(stack, p)
+				missing = true
+			}
+		}
+
+		if missing {
+			continue
+		}
+
+		stack = stack[:len(stack)-1]
+		if err := w.setGeneration(data); err != nil {
+			return err
+		}
+
+		w.idx.Add(h, data)
+		delete(pending, h)
+		if err := w.setBloomFilter(h, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// commitData returns the data of a commit, without its generation numbers.
+func (w *commitGraphWriter) commitData(h plumbing.Hash) (*commitgraph.CommitData, error) {
+	if w.current != nil {
+		if i, err := w.current.GetIndexByHash(h); err == nil {
+			data, err := w.current.GetCommitDataByIndex(i)
+			if err != nil {
+				return nil, err
+			}
+
+			return &commitgraph.CommitData{
+				TreeHash:     data.TreeHash,
+				ParentHashes: data.ParentHashes,
+				When:         data.When,
+			}, nil
+		}
+	}
+
+	c, err := object.GetCommit(w.s, h)
+	if err != nil {
+		return nil, err
+	}
+
+	return &commitgraph.CommitData{
+		TreeHash:     c.TreeHash,
+		ParentHashes: c.ParentHashes,
+		When:         c.Committer.When,
+	}, nil
+}
+
+// setGeneration sets the topological level and the corrected commit date of
+// a commit whose parents are in the index.
+func (w *commitGraphWriter) setGeneration(data *commitgraph.CommitData) error {
+	data.Generation = 1
+	data.GenerationV2 = uint64(data.When.Unix())
+	for _, p := range data.ParentHashes {
+		i, err := w.idx.GetIndexByHash(p)
+		if err != nil {
+			return err
+		}
+
+		parent, err := w.idx.GetCommitDataByIndex(i)
+		if err != nil {
+			return err
+		}
+
+		if parent.Generation >= data.Generation {
+			data.Generation = parent.Generation + 1
+		}
+
+		if parent.GenerationV2 >= data.GenerationV2 {
+			data.GenerationV2 = parent.GenerationV2 + 1
+		}
+	}
+
+	if data.Generation > maxGenerationV1 {
+		data.Generation = maxGenerationV1
+	}
+
+	return nil
+}
+
+// setBloomFilter sets the changed-path Bloom filter of a commit added to the
+// index, taken from the current commit-graph or computed.
+func (w *commitGraphWriter) setBloomFilter(h plumbing.Hash, data *commitgraph.CommitData) error {
+	var filter *commitgraph.BloomFilter
+	if bfi, ok := w.current.(commitgraph.BloomFilterIndex); ok {
+		if i, err := bfi.GetIndexByHash(h); err == nil {
+			if filter, err = bfi.GetBloomFilterByIndex(i); err != nil {
+				return err
+			}
+		}
+	}
+
+	if filter == nil && w.changedPaths {
+		var err error
+		if filter, err = w.bloomFilter(data); err != nil {
+			return err
+		}
+	}
+
+	if filter == nil {
+		return nil
+	}
+
+	return w.idx.SetBloomFilter(h, filter)
+}
+
+// bloomFilter returns the changed-path Bloom filter of a commit whose
+// parents are in the index, with the paths changed from its first parent.
+func (w *commitGraphWriter) bloomFilter(data *commitgraph.CommitData) (*commitgraph.BloomFilter, error) {
+	tree, err := object.GetTree(w.s, data.TreeHash)
+	if err != nil {
+		return nil, err
+	}
+
+	var parentTree *object.Tree
+	if len(data.ParentHashes) > 0 {
+		i, err := w.idx.GetIndexByHash(data.ParentHashes[0])
+		if err != nil {
+			return nil, err
+		}
+
+		parent, err := w.idx.GetCommitDataByIndex(i)
+		if err != nil {
+			return nil, err
+		}
+
+		if parentTree, err = object.GetTree(w.s, parent.TreeHash); err != nil {
+			return nil, err
+		}
+	}
+
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, len(changes))
+	for i, change := range changes {
+		paths[i] = change.To.Name
+		if paths[i] == "" {
+			paths[i] = change.From.Name
+		}
+	}
+
+	return commitgraph.NewBloomFilter(paths), nil
+}
+
+// hasBloomFilters returns whether the given commit-graph has changed-path
+// Bloom filters, looking at the filter of its last commit.
+func hasBloomFilters(index commitgraph.Index) bool {
+	bfi, ok := index.(commitgraph.BloomFilterIndex)
+	if !ok || index.MaximumNumberOfHashes() == 0 {
+		return false
+	}
+
+	filter, err := bfi.GetBloomFilterByIndex(index.MaximumNumberOfHashes() - 1)
+	return err == nil && filter != nil
+}
@@ -0,0 +1,186 @@
+package git
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	commitgraph "github.com/go-git/go-git/v5/plumbing/format/commitgraph/v2"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/stretchr/testify/suite"
+
+	fixtures "github.com/go-git/go-git-fixtures/v4"
+)
+
+type CommitGraphSuite struct {
+	suite.Suite
+	BaseSuite
+}
+
+func TestCommitGraphSuite(t *testing.T) {
+	suite.Run(t, new(CommitGraphSuite))
+}
+
+func (s *CommitGraphSuite) TestWriteCommitGraph() {
+	r := s.NewRepository(fixtures.Basic().One())
+	s.NoError(r.WriteCommitGraph(nil))
+
+	index := r.commitGraph()
+	s.NotNil(index)
+
+	var commits []plumbing.Hash
+	iter, err := r.Log(&LogOptions{All: true})
+	s.NoError(err)
+	s.NoError(iter.ForEach(func(c *object.Commit) error {
+		commits = append(commits, c.Hash)
+		return nil
+	}))
+
+	s.Len(index.Hashes(), len(commits))
+	for _, h := range commits {
+		i, err := index.GetIndexByHash(h)
+		s.NoError(err)
+
+		data, err := index.GetCommitDataByIndex(i)
+		s.NoError(err)
+
+		c, err := r.CommitObject(h)
+		s.NoError(err)
+		s.Equal(c.TreeHash, data.TreeHash)
+		s.ElementsMatch(c.ParentHashes, data.ParentHashes)
+		s.Equal(c.Committer.When.Unix(), data.When.Unix())
+	}
+
+	// the merge has a higher generation than its parents
+	i, err := index.GetIndexByHash(plumbing.NewHash("1669dce138d9b841a518c64b10914d88f5e488ea"))
+	s.NoError(err)
+	merge, err := index.GetCommitDataByIndex(i)
+	s.NoError(err)
+	for _, p := range merge.ParentIndexes {
+		parent, err := index.GetCommitDataByIndex(p)
+		s.NoError(err)
+		s.Less(parent.Generation, merge.Generation)
+		s.Less(parent.GenerationV2, merge.GenerationV2)
+	}
+}
+
+func (s *CommitGraphSuite) TestWriteCommitGraphSplit() {
+	r := s.NewRepository(fixtures.Basic().One())
+	s.NoError(r.WriteCommitGraph(&WriteCommitGraphOptions{Split: true}))
+	index := r.commitGraph()
+	s.NotNil(index)
+	count := len(index.Hashes())
+
+	fs := r.Storer.(*filesystem.Storage).Filesystem()
+	chain, err := fs.Stat(fs.Join("objects", "info", "commit-graphs", "commit-graph-chain"))
+	s.NoError(err)
+
+	// nothing is written without new commits
+	s.NoError(r.WriteCommitGraph(&WriteCommitGraphOptions{Split: true}))
+	current, err := fs.Stat(fs.Join("objects", "info", "commit-graphs", "commit-graph-chain"))
+	s.NoError(err)
+	s.Equal(chain.ModTime(), current.ModTime())
+
+	// the single commit-graph replaces the split one
+	s.NoError(r.WriteCommitGraph(nil))
+	_, err = fs.Stat(fs.Join("objects", "info", "commit-graphs", "commit-graph-chain"))
+	s.Error(err)
+
+	index = r.commitGraph()
+	s.NotNil(index)
+	s.Len(index.Hashes(), count)
+}
+
+func (s *CommitGraphSuite) TestWriteCommitGraphChangedPaths() {
+	r := s.NewRepository(fixtures.Basic().One())
+	s.NoError(r.WriteCommitGraph(&WriteCommitGraphOptions{ChangedPaths: true}))
+
+	index, ok := r.commitGraph().(commitgraph.BloomFilterIndex)
+	s.True(ok)
+
+	for _, h := range index.Hashes() {
+		i, err := index.GetIndexByHash(h)
+		s.NoError(err)
+		filter, err := index.GetBloomFilterByIndex(i)
+		s.NoError(err)
+		s.NotNil(filter)
+
+		c, err := r.CommitObject(h)
+		s.NoError(err)
+		stats, err := c.Stats()
+		s.NoError(err)
+		for _, stat := range stats {
+			s.True(filter.Contains(stat.Name))
+		}
+	}
+
+	// the filters are kept writing the commit-graph again
+	s.NoError(r.WriteCommitGraph(nil))
+	s.True(hasBloomFilters(r.commitGraph()))
+}
+
+func (s *CommitGraphSuite) TestWriteCommitGraphInvalidOptions() {
+	r := s.NewRepository(fixtures.Basic().One())
+	err := r.WriteCommitGraph(&WriteCommitGraphOptions{Split: true, SizeMultiple: -1})
+	s.Error(err)
+}
+
+func (s *CommitGraphSuite) TestWriteCommitGraphNotSupported() {
+	r, err := Init(memory.NewStorage(), nil)
+	s.NoError(err)
+	s.ErrorIs(r.WriteCommitGraph(nil), ErrCommitGraphNotSupported)
+}
+
+func (s *CommitGraphSuite) TestLogWithCommitGraph() {
+	f := fixtures.ByTag("merge-base").One()
+	expected := s.NewRepository(f)
+	r := s.NewRepository(f)
+	s.NoError(r.WriteCommitGraph(nil))
+	s.NotNil(r.commitGraph())
+
+	since := time.Date(2019, time.March, 20, 19, 30, 0, 0, time.UTC)
+	fileName := "dev"
+	for _, order := range []LogOrder{
+		LogOrderDefault, LogOrderDFS, LogOrderDFSPost, LogOrderBSF, LogOrderCommitterTime,
+	} {
+		for _, o := range []LogOptions{
+			{Order: order},
+			{Order: order, Since: &since},
+			{Order: order, FileName: &fileName},
+			{Order: order, From: plumbing.NewHash("d1b0093698e398d596ef94d646c4db37e8d1e970")},
+		} {
+			commits := s.log(expected, o)
+			s.NotEmpty(commits)
+			s.Equal(commits, s.log(r, o))
+		}
+	}
+}
+
+func (s *CommitGraphSuite) TestLogFileWithBloomFilters() {
+	f := fixtures.Basic().One()
+	expected := s.NewRepository(f)
+	r := s.NewRepository(f)
+	s.NoError(r.WriteCommitGraph(&WriteCommitGraphOptions{ChangedPaths: true}))
+
+	for _, fileName := range []string{"CHANGELOG", "json/short.json", "go/example.go", "vendor/foo.go", "missing"} {
+		for _, all := range []bool{false, true} {
+			o := LogOptions{FileName: &fileName, All: all}
+			s.Equal(s.log(expected, o), s.log(r, o))
+		}
+	}
+}
+
+func (s *CommitGraphSuite) log(r *Repository, o LogOptions) []plumbing.Hash {
+	iter, err := r.Log(&o)
+	s.NoError(err)
+
+	var commits []plumbing.Hash
+	s.NoError(iter.ForEach(func(c *object.Commit) error {
+		commits = append(commits, c.Hash)
+		return nil
+	}))
+
+	return commits
+}
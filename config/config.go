@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/go-git/go-billy/v5/osfs"
 	"github.com/go-git/go-git/v5/internal/url"
@@ -28,7 +29,7 @@ const (
 	// should be marshalled or not.
 	// Note that this does not need to align with the default protocol
 	// version from plumbing/protocol.
-	DefaultProtocolVersion = protocol.V0 // go-git only supports V0 at the moment
+	DefaultProtocolVersion = protocol.V0 // V2 is only supported by fetch and ls-remote
 )
 
 // ConfigStorer generic storage of Config object
@@ -68,6 +69,21 @@ type Config struct {
 		CommentChar string
 		// RepositoryFormatVersion identifies the repository format and layout version.
 		RepositoryFormatVersion format.RepositoryFormatVersion
+		// LogAllRefUpdates controls which reference updates are recorded in
+		// the reflog: "true" records the updates of branches, remote-tracking
+		// branches, notes and HEAD, "always" records the updates of any
+		// reference and "false" disables the reflog. If empty, it behaves as
+		// "true" on non-bare repositories and as "false" on bare ones.
+		LogAllRefUpdates string
+		// AutoCRLF controls the conversion of line endings of text files
+		// without text or eol attributes: "true" converts them to CRLF on
+		// checkout and to LF on add, "input" only converts them to LF on add
+		// and "false", or empty, disables the conversion.
+		AutoCRLF string
+		// EOL is the line ending used on checkout for the files with the
+		// text attribute set, when AutoCRLF is not enabled: "lf", "crlf" or
+		// "native". If empty, it behaves as "native".
+		EOL string
 	}
 
 	User struct {
@@ -96,6 +112,22 @@ type Config struct {
 		// compression.  The default is 10.  A value of 0 turns off
 		// delta compression entirely.
 		Window uint
+		// Depth is the maximum length of the delta chains. The default
+		// is 50.
+		Depth uint
+		// WindowMemory limits the size in bytes of the objects of the
+		// sliding window for delta compression, which is shrunk to stay
+		// below it. A value of 0, the default, means no limit.
+		WindowMemory uint64
+		// Threads is the number of threads searching for deltas. A value
+		// of 0, the default, uses as many threads as CPUs.
+		Threads uint
+		// Islands are the regular expressions of the references defining
+		// the delta islands, the objects reachable from the references
+		// matching an expression are only delta compressed against
+		// objects reachable from them too. The references with the same
+		// values of the capture groups of the expressions form an island.
+		Islands []string
 	}
 
 	Init struct {
@@ -114,6 +146,11 @@ type Config struct {
 		// This setting must not be changed after repository initialization
 		// (e.g. clone or init).
 		ObjectFormat format.ObjectFormat
+		// PartialClone is the name of the promisor remote of a partial
+		// clone, the remote the objects missing in the repository are
+		// fetched from. It is an error to specify this key unless
+		// core.repositoryFormatVersion is 1.
+		PartialClone string
 	}
 
 	Protocol struct {
@@ -159,6 +196,7 @@ func NewConfig() *Config {
 	}
 
 	config.Pack.Window = DefaultPackWindow
+	config.Pack.Depth = DefaultPackDepth
 	config.Protocol.Version = DefaultProtocolVersion
 
 	return config
@@ -279,7 +317,14 @@ const (
 	bareKey                    = "bare"
 	worktreeKey                = "worktree"
 	commentCharKey             = "commentChar"
+	logAllRefUpdatesKey        = "logAllRefUpdates"
+	autoCRLFKey                = "autocrlf"
+	eolKey                     = "eol"
 	windowKey                  = "window"
+	depthKey                   = "depth"
+	windowMemoryKey            = "windowMemory"
+	threadsKey                 = "threads"
+	islandKey                  = "island"
 	mergeKey                   = "merge"
 	rebaseKey                  = "rebase"
 	nameKey                    = "name"
@@ -288,12 +333,18 @@ const (
 	defaultBranchKey           = "defaultBranch"
 	repositoryFormatVersionKey = "repositoryformatversion"
 	objectFormat               = "objectformat"
+	partialCloneKey            = "partialclone"
+	promisorKey                = "promisor"
+	partialCloneFilterKey      = "partialclonefilter"
 	mirrorKey                  = "mirror"
 	versionKey                 = "version"
 
 	// DefaultPackWindow holds the number of previous objects used to
 	// generate deltas. The value 10 is the same used by git command.
 	DefaultPackWindow = uint(10)
+	// DefaultPackDepth holds the maximum length of the delta chains. The
+	// value 50 is the same used by git command.
+	DefaultPackDepth = uint(50)
 )
 
 // Unmarshal parses a git-config file and stores it.
@@ -307,6 +358,7 @@ func (c *Config) Unmarshal(b []byte) error {
 	}
 
 	c.unmarshalCore()
+	c.unmarshalExtensions()
 	c.unmarshalUser()
 	c.unmarshalInit()
 	if err := c.unmarshalPack(); err != nil {
@@ -337,6 +389,16 @@ func (c *Config) unmarshalCore() {
 
 	c.Core.Worktree = s.Options.Get(worktreeKey)
 	c.Core.CommentChar = s.Options.Get(commentCharKey)
+	c.Core.LogAllRefUpdates = s.Options.Get(logAllRefUpdatesKey)
+	c.Core.AutoCRLF = s.Options.Get(autoCRLFKey)
+	c.Core.EOL = s.Options.Get(eolKey)
+	c.Core.RepositoryFormatVersion = format.RepositoryFormatVersion(s.Options.Get(repositoryFormatVersionKey))
+}
+
+func (c *Config) unmarshalExtensions() {
+	s := c.Raw.Section(extensionsSection)
+	c.Extensions.ObjectFormat = format.ObjectFormat(s.Options.Get(objectFormat))
+	c.Extensions.PartialClone = s.Options.Get(partialCloneKey)
 }
 
 func (c *Config) unmarshalUser() {
@@ -365,9 +427,65 @@ func (c *Config) unmarshalPack() error {
 		}
 		c.Pack.Window = uint(winUint)
 	}
+
+	depth := s.Options.Get(depthKey)
+	if depth == "" {
+		c.Pack.Depth = DefaultPackDepth
+	} else {
+		depthUint, err := strconv.ParseUint(depth, 10, 32)
+		if err != nil {
+			return err
+		}
+		c.Pack.Depth = uint(depthUint)
+	}
+
+	c.Pack.WindowMemory = 0
+	if windowMemory := s.Options.Get(windowMemoryKey); windowMemory != "" {
+		size, err := parseSize(windowMemory)
+		if err != nil {
+			return err
+		}
+		c.Pack.WindowMemory = size
+	}
+
+	c.Pack.Threads = 0
+	if threads := s.Options.Get(threadsKey); threads != "" {
+		threadsUint, err := strconv.ParseUint(threads, 10, 32)
+		if err != nil {
+			return err
+		}
+		c.Pack.Threads = uint(threadsUint)
+	}
+
+	c.Pack.Islands = s.Options.GetAll(islandKey)
 	return nil
 }
 
+// parseSize parses a size in bytes, with an optional k, m or g unit suffix
+// as git does.
+func parseSize(v string) (uint64, error) {
+	shift := 0
+	switch strings.ToLower(v[len(v)-1:]) {
+	case "k":
+		shift = 10
+	case "m":
+		shift = 20
+	case "g":
+		shift = 30
+	}
+
+	if shift != 0 {
+		v = v[:len(v)-1]
+	}
+
+	size, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return size << shift, nil
+}
+
 func (c *Config) unmarshalRemotes() error {
 	s := c.Raw.Section(remoteSection)
 	for _, sub := range s.Subsections {
@@ -483,6 +601,18 @@ func (c *Config) marshalCore() {
 	if c.Core.Worktree != "" {
 		s.SetOption(worktreeKey, c.Core.Worktree)
 	}
+
+	if c.Core.LogAllRefUpdates != "" {
+		s.SetOption(logAllRefUpdatesKey, c.Core.LogAllRefUpdates)
+	}
+
+	if c.Core.AutoCRLF != "" {
+		s.SetOption(autoCRLFKey, c.Core.AutoCRLF)
+	}
+
+	if c.Core.EOL != "" {
+		s.SetOption(eolKey, c.Core.EOL)
+	}
 }
 
 func (c *Config) marshalExtensions() {
@@ -490,7 +620,13 @@ func (c *Config) marshalExtensions() {
 	// ignore them otherwise.
 	if c.Core.RepositoryFormatVersion == format.Version_1 {
 		s := c.Raw.Section(extensionsSection)
-		s.SetOption(objectFormat, string(c.Extensions.ObjectFormat))
+		if c.Extensions.ObjectFormat != "" {
+			s.SetOption(objectFormat, string(c.Extensions.ObjectFormat))
+		}
+
+		if c.Extensions.PartialClone != "" {
+			s.SetOption(partialCloneKey, c.Extensions.PartialClone)
+		}
 	}
 }
 
@@ -528,6 +664,20 @@ func (c *Config) marshalPack() {
 	if c.Pack.Window != DefaultPackWindow {
 		s.SetOption(windowKey, fmt.Sprintf("%d", c.Pack.Window))
 	}
+	if c.Pack.Depth != DefaultPackDepth {
+		s.SetOption(depthKey, fmt.Sprintf("%d", c.Pack.Depth))
+	}
+	if c.Pack.WindowMemory != 0 {
+		s.SetOption(windowMemoryKey, fmt.Sprintf("%d", c.Pack.WindowMemory))
+	}
+	if c.Pack.Threads != 0 {
+		s.SetOption(threadsKey, fmt.Sprintf("%d", c.Pack.Threads))
+	}
+
+	s.RemoveOption(islandKey)
+	for _, island := range c.Pack.Islands {
+		s.AddOption(islandKey, island)
+	}
 }
 
 func (c *Config) marshalRemotes() {
@@ -637,6 +787,12 @@ type RemoteConfig struct {
 	URLs []string
 	// Mirror indicates that the repository is a mirror of remote.
 	Mirror bool
+	// Promisor indicates that the remote promises to send the objects
+	// missing in the repository, omitted by the filter of a partial clone.
+	Promisor bool
+	// PartialCloneFilter is the filter used to fetch from the promisor
+	// remote, e.g. blob:none.
+	PartialCloneFilter string
 
 	// insteadOfRulesApplied have urls been modified
 	insteadOfRulesApplied bool
@@ -692,6 +848,8 @@ func (c *RemoteConfig) unmarshal(s *format.Subsection) error {
 	c.URLs = append(c.URLs, c.raw.Options.GetAll(pushurlKey)...)
 	c.Fetch = fetch
 	c.Mirror = c.raw.Options.Get(mirrorKey) == "true"
+	c.Promisor = c.raw.Options.Get(promisorKey) == "true"
+	c.PartialCloneFilter = c.raw.Options.Get(partialCloneFilterKey)
 
 	return nil
 }
@@ -728,6 +886,14 @@ func (c *RemoteConfig) marshal() *format.Subsection {
 		c.raw.SetOption(mirrorKey, strconv.FormatBool(c.Mirror))
 	}
 
+	if c.Promisor {
+		c.raw.SetOption(promisorKey, strconv.FormatBool(c.Promisor))
+	}
+
+	if c.PartialCloneFilter != "" {
+		c.raw.SetOption(partialCloneFilterKey, c.PartialCloneFilter)
+	}
+
 	return c.raw
 }
 
@@ -26,6 +26,8 @@ func (s *ConfigSuite) TestUnmarshal() {
 		bare = true
 		worktree = foo
 		commentchar = bar
+		autocrlf = input
+		eol = crlf
 [user]
 		name = John Doe
 		email = john@example.com
@@ -70,6 +72,8 @@ func (s *ConfigSuite) TestUnmarshal() {
 	s.True(cfg.Core.IsBare)
 	s.Equal("foo", cfg.Core.Worktree)
 	s.Equal("bar", cfg.Core.CommentChar)
+	s.Equal("input", cfg.Core.AutoCRLF)
+	s.Equal("crlf", cfg.Core.EOL)
 	s.Equal("John Doe", cfg.User.Name)
 	s.Equal("john@example.com", cfg.User.Email)
 	s.Equal("Jane Roe", cfg.Author.Name)
@@ -398,6 +402,66 @@ func (s *ConfigSuite) TestProtocol() {
 	s.NoError(err)
 }
 
+func (s *ConfigSuite) TestPack() {
+	input := []byte(`[pack]
+	window = 250
+	depth = 100
+	windowMemory = 256m
+	threads = 4
+	island = refs/heads/
+	island = refs/virtual/([0-9]+)/
+`)
+
+	cfg := NewConfig()
+	s.NoError(cfg.Unmarshal(input))
+	s.Equal(uint(250), cfg.Pack.Window)
+	s.Equal(uint(100), cfg.Pack.Depth)
+	s.Equal(uint64(256<<20), cfg.Pack.WindowMemory)
+	s.Equal(uint(4), cfg.Pack.Threads)
+	s.Equal([]string{"refs/heads/", "refs/virtual/([0-9]+)/"}, cfg.Pack.Islands)
+
+	cfg = NewConfig()
+	s.Equal(DefaultPackDepth, cfg.Pack.Depth)
+	cfg.Pack.Depth = 100
+	cfg.Pack.WindowMemory = 1024
+	cfg.Pack.Islands = []string{"refs/heads/"}
+	output, err := cfg.Marshal()
+	s.NoError(err)
+	s.Equal(`[core]
+	bare = false
+[pack]
+	depth = 100
+	windowMemory = 1024
+	island = refs/heads/
+`, string(output))
+
+	s.Error(cfg.Unmarshal([]byte("[pack]\n\twindowMemory = 1x\n")))
+}
+
+func (s *ConfigSuite) TestPartialClone() {
+	input := []byte(`[core]
+	bare = false
+	repositoryformatversion = 1
+[extensions]
+	partialclone = origin
+[remote "origin"]
+	url = https://github.com/git-fixtures/basic.git
+	promisor = true
+	partialclonefilter = blob:none
+`)
+
+	cfg := NewConfig()
+	s.NoError(cfg.Unmarshal(input))
+	s.Equal("1", string(cfg.Core.RepositoryFormatVersion))
+	s.Equal("origin", cfg.Extensions.PartialClone)
+	s.True(cfg.Remotes["origin"].Promisor)
+	s.Equal("blob:none", cfg.Remotes["origin"].PartialCloneFilter)
+
+	output, err := cfg.Marshal()
+	s.NoError(err)
+	s.Equal(string(input), string(output))
+}
+
 func (s *ConfigSuite) TestUnmarshalRemotes() {
 	input := []byte(`[core]
 	bare = true
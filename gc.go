@@ -0,0 +1,355 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+const (
+	gcSection             = "gc"
+	gcAutoKey             = "auto"
+	gcAutoPackLimitKey    = "autoPackLimit"
+	gcPruneExpireKey      = "pruneExpire"
+	gcWriteCommitGraphKey = "writeCommitGraph"
+
+	gcPidFile     = "gc.pid"
+	gcPidLockFile = "gc.pid.lock"
+	// gcPidExpire is the age after which a gc.pid file is ignored, its
+	// process being assumed dead, as git does.
+	gcPidExpire = 12 * time.Hour
+)
+
+// ErrGCRunning is returned by Repository.GC when another process is
+// collecting the garbage of the repository.
+var ErrGCRunning = errors.New("gc is already running")
+
+// GC collects the garbage of the repository, as git gc does. The references
+// are packed and the objects reachable from the references, their reflogs,
+// including the stash, and the index are written to a single pack, replacing
+// the other packs and the loose objects. The unreachable objects are kept as
+// loose objects until they are older than the prune expiration, unless the
+// expiration isn't before the start of the collection, as with "now", where
+// the unreachable packed objects are dropped. Finally the commit-graph is
+// written, unless gc.writeCommitGraph is false. The reflogs aren't expired,
+// see Repository.ExpireReflog.
+//
+// While running, the process is recorded in the gc.pid file of the
+// repository, as git does, so a concurrent collection of the same repository
+// by another git or go-git process fails with ErrGCRunning.
+func (r *Repository) GC(o *GCOptions) (err error) {
+	start := time.Now()
+	if o == nil {
+		o = &GCOptions{}
+	}
+
+	if err := o.Validate(r); err != nil {
+		return err
+	}
+
+	pos, ok := r.Storer.(storer.PackedObjectStorer)
+	if !ok {
+		return ErrPackedObjectsNotSupported
+	}
+
+	if _, ok := r.Storer.(storer.PackfileWriter); !ok {
+		return ErrPackedObjectsNotSupported
+	}
+
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+
+	if o.Auto {
+		need, err := r.needGC(cfg, pos)
+		if err != nil || !need {
+			return err
+		}
+	}
+
+	unlock, err := r.lockGC(o.Force)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if uerr := unlock(); err == nil {
+			err = uerr
+		}
+	}()
+
+	if err := r.Storer.PackRefs(); err != nil {
+		return err
+	}
+
+	if err := r.gcObjects(pos, o, start); err != nil {
+		return err
+	}
+
+	write, err := gcBoolOption(cfg, gcWriteCommitGraphKey, true)
+	if err != nil || !write {
+		return err
+	}
+
+	err = r.WriteCommitGraph(nil)
+	if err == ErrCommitGraphNotSupported {
+		return nil
+	}
+
+	return err
+}
+
+// needGC returns whether there are more loose objects than gc.auto or at
+// least gc.autoPackLimit packs.
+func (r *Repository) needGC(cfg *config.Config, pos storer.PackedObjectStorer) (bool, error) {
+	auto, err := gcIntOption(cfg, gcAutoKey, DefaultGCAuto)
+	if err != nil || auto <= 0 {
+		return false, err
+	}
+
+	packLimit, err := gcIntOption(cfg, gcAutoPackLimitKey, DefaultGCAutoPackLimit)
+	if err != nil {
+		return false, err
+	}
+
+	if packLimit > 0 {
+		packs, err := pos.ObjectPacks()
+		if err != nil {
+			return false, err
+		}
+
+		if len(packs) >= packLimit {
+			return true, nil
+		}
+	}
+
+	los, ok := r.Storer.(storer.LooseObjectStorer)
+	if !ok {
+		return false, nil
+	}
+
+	count := 0
+	err = los.ForEachObjectHash(func(plumbing.Hash) error {
+		count++
+		if count > auto {
+			return storer.ErrStop
+		}
+
+		return nil
+	})
+	if err != nil && err != storer.ErrStop {
+		return false, err
+	}
+
+	return count > auto, nil
+}
+
+// gcObjects replaces the packs and the loose objects by a pack with the
+// reachable objects, and prunes the unreachable ones.
+func (r *Repository) gcObjects(pos storer.PackedObjectStorer, o *GCOptions, start time.Time) error {
+	ow := r.objectWalker()
+	if err := ow.walkAllRefs(); err != nil {
+		return err
+	}
+
+	if s, ok := r.Storer.(storer.ReflogStorer); ok {
+		names, err := r.reflogNames()
+		if err != nil {
+			return err
+		}
+
+		if err := ow.walkReflogs(s, names); err != nil {
+			return err
+		}
+	}
+
+	if err := ow.walkIndex(); err != nil {
+		return err
+	}
+
+	packs, err := pos.ObjectPacks()
+	if err != nil {
+		return err
+	}
+
+	h, err := r.createNewObjectPack(&RepackConfig{}, ow)
+	if err != nil {
+		return err
+	}
+
+	los, ok := r.Storer.(storer.LooseObjectStorer)
+	if ok && (o.NoPrune || o.PruneExpire.Before(start)) {
+		if err := r.loosenUnreachableObjects(ow, los); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range packs {
+		if p == h {
+			continue
+		}
+
+		if err := pos.DeleteOldObjectPackAndIndex(p, time.Time{}); err != nil {
+			return err
+		}
+	}
+
+	if !ok || o.NoPrune {
+		return nil
+	}
+
+	return los.ForEachObjectHash(func(h plumbing.Hash) error {
+		if ow.isSeen(h) {
+			return nil
+		}
+
+		// Errors here are non-fatal, the object may have been deleted
+		// concurrently.
+		t, err := los.LooseObjectTime(h)
+		if err != nil || !t.Before(o.PruneExpire) {
+			return nil
+		}
+
+		return los.DeleteLooseObject(h)
+	})
+}
+
+// loosenUnreachableObjects writes the unreachable packed objects as loose
+// objects, so they aren't lost when their packs are deleted.
+func (r *Repository) loosenUnreachableObjects(ow *objectWalker, los storer.LooseObjectStorer) error {
+	iter, err := r.Storer.IterEncodedObjects(plumbing.AnyObject)
+	if err != nil {
+		return err
+	}
+
+	return iter.ForEach(func(obj plumbing.EncodedObject) error {
+		h := obj.Hash()
+		if ow.isSeen(h) {
+			return nil
+		}
+
+		if _, err := los.LooseObjectTime(h); err == nil {
+			return nil
+		}
+
+		_, err := r.Storer.SetEncodedObject(obj)
+		return err
+	})
+}
+
+// lockGC records the current process in the gc.pid file of the repository,
+// as git does, failing with ErrGCRunning if it's held by another running
+// process, unless forced. The returned function removes the file.
+func (r *Repository) lockGC(force bool) (func() error, error) {
+	type fsBased interface {
+		Filesystem() billy.Filesystem
+	}
+
+	s, ok := r.Storer.(fsBased)
+	if !ok {
+		return func() error { return nil }, nil
+	}
+
+	fs := s.Filesystem()
+	f, err := fs.OpenFile(gcPidLockFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+	if os.IsExist(err) {
+		return nil, ErrGCRunning
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	if !force && gcRunning(fs, host) {
+		err = ErrGCRunning
+	} else {
+		_, err = fmt.Fprintf(f, "%d %s", os.Getpid(), host)
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = fs.Rename(gcPidLockFile, gcPidFile)
+	}
+
+	if err != nil {
+		_ = fs.Remove(gcPidLockFile)
+		return nil, err
+	}
+
+	return func() error {
+		err := fs.Remove(gcPidFile)
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}, nil
+}
+
+// gcRunning returns whether the gc.pid file was written in the last 12 hours
+// by a process of another host or by a running process of the given host.
+func gcRunning(fs billy.Filesystem, host string) bool {
+	fi, err := fs.Stat(gcPidFile)
+	if err != nil || fi.ModTime().Before(time.Now().Add(-gcPidExpire)) {
+		return false
+	}
+
+	f, err := fs.Open(gcPidFile)
+	if err != nil {
+		return false
+	}
+
+	defer f.Close()
+
+	var pid int
+	var owner string
+	if _, err := fmt.Fscanf(f, "%d %s", &pid, &owner); err != nil {
+		return false
+	}
+
+	return owner != host || processRunning(pid)
+}
+
+func gcIntOption(cfg *config.Config, key string, def int) (int, error) {
+	v := cfg.Raw.Section(gcSection).Option(key)
+	if v == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s.%s: %q", gcSection, key, v)
+	}
+
+	return n, nil
+}
+
+func gcBoolOption(cfg *config.Config, key string, def bool) (bool, error) {
+	v := cfg.Raw.Section(gcSection).Option(key)
+	if v == "" {
+		return def, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s.%s: %q", gcSection, key, v)
+	}
+
+	return b, nil
+}
@@ -0,0 +1,12 @@
+//go:build !unix && !windows
+
+package git
+
+import "os"
+
+// processRunning returns whether the process with the given pid is running.
+// The processes can't be probed, so they're assumed running if found.
+func processRunning(pid int) bool {
+	_, err := os.FindProcess(pid)
+	return err == nil
+}
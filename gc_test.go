@@ -0,0 +1,232 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/format/reflog"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/stretchr/testify/suite"
+
+	fixtures "github.com/go-git/go-git-fixtures/v4"
+)
+
+type GCSuite struct {
+	suite.Suite
+	BaseSuite
+}
+
+func TestGCSuite(t *testing.T) {
+	suite.Run(t, new(GCSuite))
+}
+
+func (s *GCSuite) TestGC() {
+	r := s.NewRepository(fixtures.ByTag("unpacked").One())
+	s.True(s.countLooseObjects(r) > 0)
+	s.True(len(s.packs(r)) > 1)
+	expected := s.commits(r)
+
+	s.NoError(r.GC(nil))
+
+	s.Equal(0, s.countLooseObjects(r))
+	s.Len(s.packs(r), 1)
+	s.NotNil(r.commitGraph())
+
+	fs := r.Storer.(*filesystem.Storage).Filesystem()
+	_, err := fs.Stat("packed-refs")
+	s.NoError(err)
+	_, err = fs.Stat(gcPidFile)
+	s.True(os.IsNotExist(err))
+
+	s.Equal(expected, s.commits(s.reopen(r)))
+}
+
+func (s *GCSuite) TestGCReflogAndStash() {
+	r := s.NewRepository(fixtures.Basic().One())
+	cfg, err := r.Config()
+	s.NoError(err)
+	cfg.Raw.Section(gcSection).SetOption(gcPruneExpireKey, "now")
+	s.NoError(r.SetConfig(cfg))
+
+	s.removeReflogs(r)
+
+	// the commit of the branch is only reachable from the stash reflog
+	branch := plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")
+	master := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	s.NoError(r.Storer.RemoveReference("refs/heads/branch"))
+	s.NoError(r.Storer.RemoveReference("refs/remotes/origin/branch"))
+	s.NoError(r.Storer.SetReference(plumbing.NewHashReference(plumbing.Stash, master)))
+	rs := r.Storer.(storer.ReflogStorer)
+	s.NoError(rs.SetReflog(plumbing.Stash, []*reflog.Entry{
+		{New: branch, Message: "WIP on branch"},
+		{Old: branch, New: master, Message: "WIP on master"},
+	}))
+
+	s.NoError(r.GC(nil))
+	r = s.reopen(r)
+	_, err = r.CommitObject(branch)
+	s.NoError(err)
+
+	s.NoError(rs.SetReflog(plumbing.Stash, []*reflog.Entry{
+		{New: master, Message: "WIP on master"},
+	}))
+
+	s.NoError(r.GC(nil))
+	r = s.reopen(r)
+	_, err = r.CommitObject(branch)
+	s.ErrorIs(err, plumbing.ErrObjectNotFound)
+	_, err = r.CommitObject(master)
+	s.NoError(err)
+	s.Equal(0, s.countLooseObjects(r))
+}
+
+func (s *GCSuite) TestGCKeepsRecentUnreachableObjects() {
+	r := s.NewRepository(fixtures.ByTag("unpacked").One())
+	s.removeReflogs(r)
+	s.NoError(r.Storer.RemoveReference("refs/heads/v4"))
+	s.NoError(r.Storer.RemoveReference("refs/remotes/origin/v4"))
+	s.NoError(r.GC(&GCOptions{NoPrune: true}))
+
+	// the unreachable objects are kept as loose objects
+	s.True(s.countLooseObjects(r) > 0)
+	s.Len(s.packs(r), 1)
+
+	s.NoError(r.GC(nil))
+	s.True(s.countLooseObjects(r) > 0)
+}
+
+func (s *GCSuite) TestGCAuto() {
+	r := s.NewRepository(fixtures.ByTag("unpacked").One())
+	packs := s.packs(r)
+	loose := s.countLooseObjects(r)
+
+	s.NoError(r.GC(&GCOptions{Auto: true}))
+	s.Equal(packs, s.packs(r))
+	s.Equal(loose, s.countLooseObjects(r))
+
+	cfg, err := r.Config()
+	s.NoError(err)
+	cfg.Raw.Section(gcSection).SetOption(gcAutoKey, "0")
+	cfg.Raw.Section(gcSection).SetOption(gcAutoPackLimitKey, "2")
+	s.NoError(r.SetConfig(cfg))
+	s.NoError(r.GC(&GCOptions{Auto: true}))
+	s.Equal(packs, s.packs(r))
+
+	cfg.Raw.Section(gcSection).SetOption(gcAutoKey, fmt.Sprint(loose+1))
+	s.NoError(r.SetConfig(cfg))
+	s.NoError(r.GC(&GCOptions{Auto: true}))
+	s.Len(s.packs(r), 1)
+}
+
+func (s *GCSuite) TestGCAutoLooseObjects() {
+	r := s.NewRepository(fixtures.ByTag("unpacked").One())
+	loose := s.countLooseObjects(r)
+
+	cfg, err := r.Config()
+	s.NoError(err)
+	cfg.Raw.Section(gcSection).SetOption(gcAutoKey, fmt.Sprint(loose))
+	cfg.Raw.Section(gcSection).SetOption(gcAutoPackLimitKey, "0")
+	s.NoError(r.SetConfig(cfg))
+
+	s.NoError(r.GC(&GCOptions{Auto: true}))
+	s.Equal(loose, s.countLooseObjects(r))
+
+	cfg.Raw.Section(gcSection).SetOption(gcAutoKey, fmt.Sprint(loose-1))
+	s.NoError(r.SetConfig(cfg))
+	s.NoError(r.GC(&GCOptions{Auto: true}))
+	s.Equal(0, s.countLooseObjects(r))
+}
+
+func (s *GCSuite) TestGCRunning() {
+	r := s.NewRepository(fixtures.Basic().One())
+	fs := r.Storer.(*filesystem.Storage).Filesystem()
+	host, err := os.Hostname()
+	s.NoError(err)
+
+	f, err := fs.Create(gcPidFile)
+	s.NoError(err)
+	_, err = fmt.Fprintf(f, "%d %s", os.Getpid(), host)
+	s.NoError(err)
+	s.NoError(f.Close())
+
+	s.ErrorIs(r.GC(nil), ErrGCRunning)
+	_, err = fs.Stat(gcPidLockFile)
+	s.True(os.IsNotExist(err))
+
+	s.NoError(r.GC(&GCOptions{Force: true}))
+	_, err = fs.Stat(gcPidFile)
+	s.True(os.IsNotExist(err))
+
+	f, err = fs.Create(gcPidLockFile)
+	s.NoError(err)
+	s.NoError(f.Close())
+	s.ErrorIs(r.GC(&GCOptions{Force: true}), ErrGCRunning)
+}
+
+func (s *GCSuite) TestGCInvalidPruneExpire() {
+	r := s.NewRepository(fixtures.Basic().One())
+	cfg, err := r.Config()
+	s.NoError(err)
+	cfg.Raw.Section(gcSection).SetOption(gcPruneExpireKey, "soon")
+	s.NoError(r.SetConfig(cfg))
+
+	s.Error(r.GC(nil))
+}
+
+func (s *GCSuite) TestGCNotSupported() {
+	r, err := Init(memory.NewStorage(), nil)
+	s.NoError(err)
+	s.ErrorIs(r.GC(nil), ErrPackedObjectsNotSupported)
+}
+
+// reopen returns the repository with a new storage, without the objects
+// cached by the previous one.
+func (s *GCSuite) reopen(r *Repository) *Repository {
+	fs := r.Storer.(*filesystem.Storage).Filesystem()
+	r, err := Open(filesystem.NewStorage(fs, cache.NewObjectLRUDefault()), nil)
+	s.NoError(err)
+	return r
+}
+
+func (s *GCSuite) removeReflogs(r *Repository) {
+	names, err := r.reflogNames()
+	s.NoError(err)
+	for _, name := range names {
+		s.NoError(r.Storer.(storer.ReflogStorer).RemoveReflog(name))
+	}
+}
+
+func (s *GCSuite) countLooseObjects(r *Repository) int {
+	count := 0
+	s.NoError(r.Storer.(storer.LooseObjectStorer).ForEachObjectHash(func(plumbing.Hash) error {
+		count++
+		return nil
+	}))
+
+	return count
+}
+
+func (s *GCSuite) packs(r *Repository) []plumbing.Hash {
+	packs, err := r.Storer.(storer.PackedObjectStorer).ObjectPacks()
+	s.NoError(err)
+	return packs
+}
+
+func (s *GCSuite) commits(r *Repository) []plumbing.Hash {
+	iter, err := r.Log(&LogOptions{All: true})
+	s.NoError(err)
+
+	var commits []plumbing.Hash
+	s.NoError(iter.ForEach(func(c *object.Commit) error {
+		commits = append(commits, c.Hash)
+		return nil
+	}))
+
+	return commits
+}
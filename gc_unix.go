@@ -0,0 +1,19 @@
+//go:build unix
+
+package git
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// processRunning returns whether the process with the given pid is running.
+func processRunning(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	return !errors.Is(p.Signal(syscall.Signal(0)), os.ErrProcessDone)
+}
@@ -0,0 +1,29 @@
+//go:build windows
+
+package git
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// stillActive is the exit code of a process that hasn't exited, STILL_ACTIVE.
+const stillActive = 259
+
+// processRunning returns whether the process with the given pid is running.
+func processRunning(pid int) bool {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		// The process exists but can't be queried, it's running.
+		return errors.Is(err, windows.ERROR_ACCESS_DENIED)
+	}
+
+	defer windows.CloseHandle(h)
+	var code uint32
+	if err := windows.GetExitCodeProcess(h, &code); err != nil {
+		return true
+	}
+
+	return code == stillActive
+}
@@ -72,7 +72,7 @@ type AtPush struct {
 	BranchName string
 }
 
-// AtDate represents @{"2006-01-02T15:04:05Z"}
+// AtDate represents @{"2006-01-02T15:04:05Z"}, @{yesterday}, @{2.weeks.ago}
 type AtDate struct {
 	Date time.Time
 }
@@ -191,14 +191,18 @@ func (p *Parser) validateFullRevision(chunks *[]Revisioner) error {
 				return &ErrInvalidRevision{`reference must be defined once at the beginning`}
 			}
 		case AtDate:
-			if len(*chunks) == 1 || hasReference && len(*chunks) == 2 {
-				return nil
+			// The reflog entry is the reference of the statements
+			// following it.
+			if i == 0 || hasReference && i == 1 {
+				hasReference = true
+				continue
 			}
 
 			return &ErrInvalidRevision{`"@" statement is not valid, could be : <refname>@{<ISO-8601 date>}, @{<ISO-8601 date>}`}
 		case AtReflog:
-			if len(*chunks) == 1 || hasReference && len(*chunks) == 2 {
-				return nil
+			if i == 0 || hasReference && i == 1 {
+				hasReference = true
+				continue
 			}
 
 			return &ErrInvalidRevision{`"@" statement is not valid, could be : <refname>@{<n>}, @{<n>}`}
@@ -315,9 +319,9 @@ func (p *Parser) parseAt() (Revisioner, error) {
 
 			switch {
 			case tok == cbrace:
-				t, err := time.Parse("2006-01-02T15:04:05Z", date)
+				t, ok := ParseDate(date)
 
-				if err != nil {
+				if !ok {
 					return nil, &ErrInvalidRevision{fmt.Sprintf(`wrong date "%s" must fit ISO-8601 format : 2006-01-02T15:04:05Z`, date)}
 				}
 
@@ -624,3 +628,66 @@ func (p *Parser) checkRefFormat(token token, literal string, previousToken token
 
 	return nil
 }
+
+// now returns the current time, relative dates are computed from it.
+var now = time.Now
+
+// dateLayouts are the layouts of the absolute dates supported by @{<date>},
+// with the location used when the layout has no time zone.
+var dateLayouts = []struct {
+	layout string
+	loc    *time.Location
+}{
+	{"2006-01-02T15:04:05Z", time.UTC},
+	{time.RFC3339, time.UTC},
+	{"2006-01-02 15:04:05", time.Local},
+	{"2006-01-02", time.Local},
+}
+
+// dateUnits are the units supported by the relative dates such as
+// "2 weeks ago", as a function moving back n units from the given time.
+var dateUnits = map[string]func(t time.Time, n int) time.Time{
+	"second": func(t time.Time, n int) time.Time { return t.Add(-time.Duration(n) * time.Second) },
+	"minute": func(t time.Time, n int) time.Time { return t.Add(-time.Duration(n) * time.Minute) },
+	"hour":   func(t time.Time, n int) time.Time { return t.Add(-time.Duration(n) * time.Hour) },
+	"day":    func(t time.Time, n int) time.Time { return t.AddDate(0, 0, -n) },
+	"week":   func(t time.Time, n int) time.Time { return t.AddDate(0, 0, -7*n) },
+	"month":  func(t time.Time, n int) time.Time { return t.AddDate(0, -n, 0) },
+	"year":   func(t time.Time, n int) time.Time { return t.AddDate(-n, 0, 0) },
+}
+
+// ParseDate parses the dates of the @{<date>} statement, also used by options
+// such as gc.pruneExpire, which are either an absolute date, "now",
+// "yesterday", or a relative date in the form "<n> <unit> ago", where the
+// words can also be separated by dots, as in "2.weeks.ago".
+func ParseDate(date string) (time.Time, bool) {
+	for _, l := range dateLayouts {
+		if t, err := time.ParseInLocation(l.layout, date, l.loc); err == nil {
+			return t, true
+		}
+	}
+
+	words := bytes.Fields(bytes.ReplaceAll([]byte(date), []byte("."), []byte(" ")))
+	switch {
+	case len(words) == 1 && string(words[0]) == "now":
+		return now(), true
+	case len(words) == 1 && string(words[0]) == "yesterday":
+		return now().AddDate(0, 0, -1), true
+	case len(words) == 3 && string(words[2]) == "ago", len(words) == 2:
+	default:
+		return time.Time{}, false
+	}
+
+	n, err := strconv.Atoi(string(words[0]))
+	if err != nil || n < 0 {
+		return time.Time{}, false
+	}
+
+	unit := string(bytes.TrimSuffix(words[1], []byte("s")))
+	back, ok := dateUnits[unit]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return back(now(), n), true
+}
@@ -121,6 +121,25 @@ func (s *ParserSuite) TestParseWithValidExpression() {
 			Ref("master"),
 			AtDate{tim},
 		},
+		"HEAD@{1}~1": []Revisioner{
+			Ref("HEAD"),
+			AtReflog{1},
+			TildePath{1},
+		},
+		"main@{2}^": []Revisioner{
+			Ref("main"),
+			AtReflog{2},
+			CaretPath{1},
+		},
+		"@{1}~2": []Revisioner{
+			AtReflog{1},
+			TildePath{2},
+		},
+		"master@{2016-12-16T21:42:47Z}~1": []Revisioner{
+			Ref("master"),
+			AtDate{tim},
+			TildePath{1},
+		},
 		"HEAD^": []Revisioner{
 			Ref("HEAD"),
 			CaretPath{1},
@@ -194,6 +213,7 @@ func (s *ParserSuite) TestParseWithInvalidExpression() {
 		"master^1master":                  &ErrInvalidRevision{`reference must be defined once at the beginning`},
 		"master^1@{2016-12-16T21:42:47Z}": &ErrInvalidRevision{`"@" statement is not valid, could be : <refname>@{<ISO-8601 date>}, @{<ISO-8601 date>}`},
 		"master^1@{1}":                    &ErrInvalidRevision{`"@" statement is not valid, could be : <refname>@{<n>}, @{<n>}`},
+		"master@{1}@{1}":                  &ErrInvalidRevision{`"@" statement is not valid, could be : <refname>@{<n>}, @{<n>}`},
 		"master@{-1}":                     &ErrInvalidRevision{`"@" statement is not valid, could be : @{-<n>}`},
 		"master^1@{upstream}":             &ErrInvalidRevision{`"@" statement is not valid, could be : <refname>@{upstream}, @{upstream}, <refname>@{u}, @{u}`},
 		"master^1@{u}":                    &ErrInvalidRevision{`"@" statement is not valid, could be : <refname>@{upstream}, @{upstream}, <refname>@{u}, @{u}`},
@@ -238,6 +258,38 @@ func (s *ParserSuite) TestParseAtWithValidExpression() {
 	}
 }
 
+func (s *ParserSuite) TestParseAtWithRelativeDate() {
+	current := time.Date(2020, 3, 15, 10, 0, 0, 0, time.UTC)
+	defer func(f func() time.Time) { now = f }(now)
+	now = func() time.Time { return current }
+
+	datas := map[string]Revisioner{
+		"{now}":                 AtDate{current},
+		"{yesterday}":           AtDate{current.AddDate(0, 0, -1)},
+		"{2.weeks.ago}":         AtDate{current.AddDate(0, 0, -14)},
+		"{1 hour ago}":          AtDate{current.Add(-time.Hour)},
+		"{3.months.ago}":        AtDate{current.AddDate(0, -3, 0)},
+		"{2020-01-02}":          AtDate{time.Date(2020, 1, 2, 0, 0, 0, 0, time.Local)},
+		"{2020-01-02 03:04:05}": AtDate{time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local)},
+	}
+
+	for d, expected := range datas {
+		parser := NewParser(bytes.NewBufferString(d))
+
+		result, err := parser.parseAt()
+
+		s.NoError(err, d)
+		s.Equal(expected, result, d)
+	}
+
+	for _, d := range []string{"{2.fortnights.ago}", "{foo.days.ago}", "{tomorrow}"} {
+		parser := NewParser(bytes.NewBufferString(d))
+
+		_, err := parser.parseAt()
+		s.Error(err, d)
+	}
+}
+
 func (s *ParserSuite) TestParseAtWithInvalidExpression() {
 	datas := map[string]error{
 		"{test}": &ErrInvalidRevision{`wrong date "test" must fit ISO-8601 format : 2006-01-02T15:04:05Z`},
@@ -0,0 +1,129 @@
+// Package tracker tracks the listeners and the connections of the servers,
+// to close them.
+package tracker
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// ErrClosed is returned by Serve after a call to Close.
+var ErrClosed = errors.New("tracker closed")
+
+// Tracker tracks the listeners served and the connections accepted on them.
+// The zero value is ready to use.
+type Tracker struct {
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// Serve serves the connections accepted on the listener with the given
+// function, each one in its own goroutine, closing them once served. It
+// always returns a non-nil error, ErrClosed after a call to Close.
+func (t *Tracker) Serve(l net.Listener, serve func(net.Conn)) error {
+	if !t.track(l, true) {
+		return ErrClosed
+	}
+
+	defer t.track(l, false)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if t.isClosed() {
+				return ErrClosed
+			}
+
+			return err
+		}
+
+		if !t.trackConn(conn, true) {
+			_ = conn.Close()
+			return ErrClosed
+		}
+
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			defer t.trackConn(conn, false)
+			defer conn.Close()
+
+			serve(conn)
+		}()
+	}
+}
+
+// Close closes the listeners and the connections, waiting for the
+// connections being served.
+func (t *Tracker) Close() error {
+	t.mu.Lock()
+	t.closed = true
+
+	var err error
+	for l := range t.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	for c := range t.conns {
+		_ = c.Close()
+	}
+	t.mu.Unlock()
+
+	t.wg.Wait()
+	return err
+}
+
+func (t *Tracker) track(l net.Listener, add bool) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !add {
+		delete(t.listeners, l)
+		return true
+	}
+
+	if t.closed {
+		return false
+	}
+
+	if t.listeners == nil {
+		t.listeners = make(map[net.Listener]struct{})
+	}
+
+	t.listeners[l] = struct{}{}
+	return true
+}
+
+func (t *Tracker) trackConn(c net.Conn, add bool) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !add {
+		delete(t.conns, c)
+		return true
+	}
+
+	if t.closed {
+		return false
+	}
+
+	if t.conns == nil {
+		t.conns = make(map[net.Conn]struct{})
+	}
+
+	t.conns[c] = struct{}{}
+	return true
+}
+
+func (t *Tracker) isClosed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.closed
+}
@@ -0,0 +1,316 @@
+package git
+
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+)
+
+// threeWayMerge merges the commit pointed by ref into the current branch,
+// using the merge base of both commits as the common ancestor. When possible
+// the current branch is fast-forwarded, otherwise a merge commit is created.
+func (r *Repository) threeWayMerge(ref plumbing.Reference, opts MergeOptions) error {
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	head, err := r.Head()
+	if err != nil {
+		return err
+	}
+
+	ours, err := r.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+
+	theirs, err := r.CommitObject(ref.Hash())
+	if err != nil {
+		return err
+	}
+
+	bases, err := ours.MergeBase(theirs)
+	if err != nil {
+		return err
+	}
+
+	if len(bases) == 0 && !opts.AllowUnrelatedHistories {
+		return ErrUnrelatedHistories
+	}
+
+	for _, b := range bases {
+		if b.Hash == theirs.Hash {
+			return NoErrAlreadyUpToDate
+		}
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return err
+	}
+
+	if hasTrackedChanges(status) {
+		return ErrWorktreeNotClean
+	}
+
+	oursTree, err := ours.Tree()
+	if err != nil {
+		return err
+	}
+
+	theirsTree, err := theirs.Tree()
+	if err != nil {
+		return err
+	}
+
+	if len(bases) == 1 && bases[0].Hash == ours.Hash {
+		if err := w.checkoutTree(status, oursTree, theirsTree); err != nil {
+			return err
+		}
+
+		return w.updateHEAD(theirs.Hash, nil, fmt.Sprintf("merge %s: Fast-forward", mergeLabel(ref)))
+	}
+
+	res, err := object.MergeCommits(r.Storer, ours, theirs, &object.MergeTreesOptions{
+		OursLabel:   plumbing.HEAD.String(),
+		TheirsLabel: mergeLabel(ref),
+	})
+	if err != nil {
+		return err
+	}
+
+	tree, err := object.GetTree(r.Storer, res.Tree)
+	if err != nil {
+		return err
+	}
+
+	if err := w.checkoutTree(status, oursTree, tree); err != nil {
+		return err
+	}
+
+	if !res.IsClean() {
+		if err := w.addConflictsToIndex(res.Conflicts); err != nil {
+			return err
+		}
+
+		mergeHead := plumbing.NewHashReference(plumbing.MergeHead, theirs.Hash)
+		if err := r.Storer.SetReference(mergeHead); err != nil {
+			return err
+		}
+
+		return ErrMergeConflict
+	}
+
+	msg := opts.Message
+	if msg == "" {
+		msg = mergeMessage(head, ref)
+	}
+
+	_, err = w.Commit(msg, &CommitOptions{
+		Author:            opts.Author,
+		Committer:         opts.Committer,
+		Parents:           []plumbing.Hash{ours.Hash, theirs.Hash},
+		AllowEmptyCommits: true,
+	})
+
+	return err
+}
+
+// removeMergeHeads removes the MERGE_HEAD, CHERRY_PICK_HEAD and REVERT_HEAD
+// references, if a merge, cherry-pick or revert is in progress.
+func (r *Repository) removeMergeHeads() error {
+	for _, name := range []plumbing.ReferenceName{
+		plumbing.MergeHead,
+		plumbing.CherryPickHead,
+		plumbing.RevertHead,
+	} {
+		_, err := r.Storer.Reference(name)
+		if err == plumbing.ErrReferenceNotFound {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := r.Storer.RemoveReference(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hasTrackedChanges returns true if any of the tracked files in the given
+// status is modified, either in the staging area or in the worktree.
+func hasTrackedChanges(s Status) bool {
+	for _, fs := range s {
+		if fs.Staging != Unmodified && fs.Staging != Untracked {
+			return true
+		}
+
+		if fs.Worktree != Unmodified && fs.Worktree != Untracked {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mergeLabel returns the name used to refer to ref on conflict markers.
+func mergeLabel(ref plumbing.Reference) string {
+	if ref.Name() == "" || ref.Name() == plumbing.HEAD {
+		return ref.Hash().String()
+	}
+
+	return ref.Name().Short()
+}
+
+// mergeMessage returns a message for the commit merging ref into head,
+// following the same format used by git.
+func mergeMessage(head *plumbing.Reference, ref plumbing.Reference) string {
+	name := ref.Name()
+
+	var msg string
+	switch {
+	case name.IsBranch():
+		msg = fmt.Sprintf("Merge branch '%s'", name.Short())
+	case name.IsRemote():
+		msg = fmt.Sprintf("Merge remote-tracking branch '%s'", name.Short())
+	case name.IsTag():
+		msg = fmt.Sprintf("Merge tag '%s'", name.Short())
+	default:
+		msg = fmt.Sprintf("Merge commit '%s'", ref.Hash())
+	}
+
+	if head.Name().IsBranch() && head.Name() != plumbing.Master && head.Name() != plumbing.Main {
+		msg += fmt.Sprintf(" into %s", head.Name().Short())
+	}
+
+	return msg
+}
+
+// checkoutTree updates the worktree and the index from the from tree to the
+// to tree. Untracked files are kept, unless they would be overwritten by the
+// files in the to tree, in which case ErrUntrackedFilesOverwritten is
+// returned before any change is done.
+func (w *Worktree) checkoutTree(s Status, from, to *object.Tree) error {
+	changes, err := merkletrie.DiffTree(
+		object.NewTreeRootNode(from),
+		object.NewTreeRootNode(to),
+		diffTreeIsEquals,
+	)
+	if err != nil {
+		return err
+	}
+
+	var deletes, updates merkletrie.Changes
+	for _, ch := range changes {
+		if err := w.validChange(ch); err != nil {
+			return err
+		}
+
+		a, err := ch.Action()
+		if err != nil {
+			return err
+		}
+
+		switch a {
+		case merkletrie.Delete:
+			deletes = append(deletes, ch)
+		case merkletrie.Insert:
+			if s.IsUntracked(ch.To.String()) {
+				return fmt.Errorf("%w: %s", ErrUntrackedFilesOverwritten, ch.To.String())
+			}
+
+			fallthrough
+		default:
+			updates = append(updates, ch)
+		}
+	}
+
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	b := newIndexBuilder(idx)
+
+	conv, err := w.newTreeConverter(to)
+	if err != nil {
+		return err
+	}
+	defer conv.close()
+
+	// Deletions are applied first, so files replaced by directories, and the
+	// other way around, don't collide.
+	for _, ch := range append(deletes, updates...) {
+		if len(ch.To) == 0 {
+			b.Remove(ch.From.String())
+		}
+
+		if err := w.checkoutChange(ch, to, b, conv); err != nil {
+			return err
+		}
+	}
+
+	b.Write(idx)
+	return w.r.Storer.SetIndex(idx)
+}
+
+// addConflictsToIndex replaces the index entries of the conflicting paths
+// by the entries of each one of the merge stages.
+func (w *Worktree) addConflictsToIndex(conflicts []object.MergeConflict) error {
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range conflicts {
+		removeIndexEntries(idx, c.Path)
+		if c.RenamedTo != "" {
+			removeIndexEntries(idx, c.RenamedTo)
+		}
+
+		for _, st := range []struct {
+			stage index.Stage
+			entry *object.TreeEntry
+		}{
+			{index.AncestorMode, c.Base},
+			{index.OurMode, c.Ours},
+			{index.TheirMode, c.Theirs},
+		} {
+			if st.entry == nil {
+				continue
+			}
+
+			idx.Entries = append(idx.Entries, &index.Entry{
+				Name:  c.Path,
+				Hash:  st.entry.Hash,
+				Mode:  st.entry.Mode,
+				Stage: st.stage,
+			})
+		}
+	}
+
+	return w.r.Storer.SetIndex(idx)
+}
+
+// removeIndexEntries removes all the entries of the given path, on any of
+// the merge stages, returning true if any entry was removed.
+func removeIndexEntries(idx *index.Index, name string) bool {
+	entries := idx.Entries[:0]
+	for _, e := range idx.Entries {
+		if e.Name != name {
+			entries = append(entries, e)
+		}
+	}
+
+	removed := len(entries) != len(idx.Entries)
+	idx.Entries = entries
+	return removed
+}
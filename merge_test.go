@@ -0,0 +1,359 @@
+package git
+
+import (
+	"os"
+	"time"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+var mergeSignature = &object.Signature{
+	Name:  "go-git",
+	Email: "go-git@fake.local",
+	When:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+}
+
+// commitFiles writes the given files into the worktree and commits them. A
+// nil content removes the file.
+func commitFiles(s *RepositorySuite, w *Worktree, files map[string][]byte) plumbing.Hash {
+	for name, content := range files {
+		if content == nil {
+			_, err := w.Remove(name)
+			s.Require().NoError(err)
+			continue
+		}
+
+		s.Require().NoError(util.WriteFile(w.Filesystem, name, content, 0o644))
+		_, err := w.Add(name)
+		s.Require().NoError(err)
+	}
+
+	h, err := w.Commit("commit", &CommitOptions{Author: mergeSignature})
+	s.Require().NoError(err)
+	return h
+}
+
+// setupMerge creates a repository with a base commit containing the given
+// files, and a "feature" branch. The master branch is checked out. The user of
+// the config, the committer of the commits rewritten, isn't mergeSignature.
+func setupMerge(s *RepositorySuite, files map[string][]byte) (*Repository, *Worktree) {
+	st := filesystem.NewStorage(memfs.New(), cache.NewObjectLRUDefault())
+	r, err := Init(st, memfs.New())
+	s.Require().NoError(err)
+
+	cfg, err := r.Config()
+	s.Require().NoError(err)
+	cfg.User.Name = "committer"
+	cfg.User.Email = "committer@fake.local"
+	s.Require().NoError(r.SetConfig(cfg))
+
+	w, err := r.Worktree()
+	s.Require().NoError(err)
+
+	base := commitFiles(s, w, files)
+	s.Require().NoError(r.Storer.SetReference(
+		plumbing.NewHashReference(plumbing.NewBranchReferenceName("feature"), base),
+	))
+
+	return r, w
+}
+
+func (s *RepositorySuite) checkoutBranch(w *Worktree, name string) {
+	s.Require().NoError(w.Checkout(&CheckoutOptions{
+		Branch: plumbing.NewBranchReferenceName(name),
+	}))
+}
+
+func (s *RepositorySuite) mergeBranch(r *Repository, name string) error {
+	ref, err := r.Reference(plumbing.NewBranchReferenceName(name), true)
+	s.Require().NoError(err)
+
+	return r.Merge(*ref, MergeOptions{
+		Strategy: ThreeWayMerge,
+		Author:   mergeSignature,
+	})
+}
+
+func (s *RepositorySuite) TestMergeThreeWay() {
+	r, w := setupMerge(s, map[string][]byte{
+		"foo": []byte("a\nb\nc\nd\ne\n"),
+		"bar": []byte("bar\n"),
+	})
+
+	ours := commitFiles(s, w, map[string][]byte{
+		"foo":  []byte("A\nb\nc\nd\ne\n"),
+		"ours": []byte("ours\n"),
+	})
+
+	s.checkoutBranch(w, "feature")
+	theirs := commitFiles(s, w, map[string][]byte{
+		"foo":        []byte("a\nb\nc\nd\nE\n"),
+		"bar":        nil,
+		"dir/theirs": []byte("theirs\n"),
+	})
+
+	s.checkoutBranch(w, "master")
+	s.NoError(s.mergeBranch(r, "feature"))
+
+	head, err := r.Head()
+	s.NoError(err)
+	s.Equal(plumbing.Master, head.Name())
+
+	c, err := r.CommitObject(head.Hash())
+	s.NoError(err)
+	s.Equal([]plumbing.Hash{ours, theirs}, c.ParentHashes)
+	s.Equal("Merge branch 'feature'", c.Message)
+
+	content, err := util.ReadFile(w.Filesystem, "foo")
+	s.NoError(err)
+	s.Equal("A\nb\nc\nd\nE\n", string(content))
+
+	f, err := c.File("foo")
+	s.NoError(err)
+	committed, err := f.Contents()
+	s.NoError(err)
+	s.Equal("A\nb\nc\nd\nE\n", committed)
+
+	_, err = w.Filesystem.Stat("bar")
+	s.ErrorIs(err, os.ErrNotExist)
+
+	for _, name := range []string{"ours", "dir/theirs"} {
+		_, err = c.File(name)
+		s.NoError(err, name)
+	}
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.True(status.IsClean(), status.String())
+}
+
+func (s *RepositorySuite) TestMergeThreeWayConflict() {
+	r, w := setupMerge(s, map[string][]byte{
+		"foo": []byte("a\nb\nc\n"),
+	})
+
+	ours := commitFiles(s, w, map[string][]byte{"foo": []byte("a\nours\nc\n")})
+
+	s.checkoutBranch(w, "feature")
+	theirs := commitFiles(s, w, map[string][]byte{"foo": []byte("a\ntheirs\nc\n")})
+
+	s.checkoutBranch(w, "master")
+	err := s.mergeBranch(r, "feature")
+	s.ErrorIs(err, ErrMergeConflict)
+
+	head, err := r.Head()
+	s.NoError(err)
+	s.Equal(ours, head.Hash())
+
+	mergeHead, err := r.Reference(plumbing.MergeHead, false)
+	s.NoError(err)
+	s.Equal(theirs, mergeHead.Hash())
+
+	content, err := util.ReadFile(w.Filesystem, "foo")
+	s.NoError(err)
+	s.Equal("a\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> feature\nc\n", string(content))
+
+	idx, err := r.Storer.Index()
+	s.NoError(err)
+
+	var stages []index.Stage
+	for _, e := range idx.Entries {
+		s.Equal("foo", e.Name)
+		stages = append(stages, e.Stage)
+	}
+	s.ElementsMatch([]index.Stage{index.AncestorMode, index.OurMode, index.TheirMode}, stages)
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.Equal(UpdatedButUnmerged, status.File("foo").Staging)
+
+	_, err = w.Commit("merge", &CommitOptions{Author: mergeSignature})
+	s.ErrorIs(err, ErrUnmergedPaths)
+
+	s.NoError(util.WriteFile(w.Filesystem, "foo", []byte("a\nresolved\nc\n"), 0o644))
+	_, err = w.Add("foo")
+	s.NoError(err)
+
+	h, err := w.Commit("merge", &CommitOptions{Author: mergeSignature})
+	s.NoError(err)
+
+	c, err := r.CommitObject(h)
+	s.NoError(err)
+	s.Equal([]plumbing.Hash{ours, theirs}, c.ParentHashes)
+
+	_, err = r.Reference(plumbing.MergeHead, false)
+	s.ErrorIs(err, plumbing.ErrReferenceNotFound)
+}
+
+func (s *RepositorySuite) TestMergeThreeWayConflictAbort() {
+	r, w := setupMerge(s, map[string][]byte{
+		"foo": []byte("a\nb\nc\n"),
+	})
+
+	ours := commitFiles(s, w, map[string][]byte{"foo": []byte("a\nours\nc\n")})
+
+	s.checkoutBranch(w, "feature")
+	commitFiles(s, w, map[string][]byte{"foo": []byte("a\ntheirs\nc\n")})
+
+	s.checkoutBranch(w, "master")
+	s.ErrorIs(s.mergeBranch(r, "feature"), ErrMergeConflict)
+
+	s.NoError(w.Reset(&ResetOptions{Mode: HardReset, Commit: ours}))
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.True(status.IsClean(), status.String())
+
+	content, err := util.ReadFile(w.Filesystem, "foo")
+	s.NoError(err)
+	s.Equal("a\nours\nc\n", string(content))
+
+	_, err = r.Reference(plumbing.MergeHead, false)
+	s.ErrorIs(err, plumbing.ErrReferenceNotFound)
+}
+
+func (s *RepositorySuite) TestMergeThreeWayModifyDelete() {
+	r, w := setupMerge(s, map[string][]byte{
+		"foo": []byte("foo\n"),
+	})
+
+	commitFiles(s, w, map[string][]byte{"foo": nil, "bar": []byte("bar\n")})
+
+	s.checkoutBranch(w, "feature")
+	commitFiles(s, w, map[string][]byte{"foo": []byte("modified\n")})
+
+	s.checkoutBranch(w, "master")
+	s.ErrorIs(s.mergeBranch(r, "feature"), ErrMergeConflict)
+
+	content, err := util.ReadFile(w.Filesystem, "foo")
+	s.NoError(err)
+	s.Equal("modified\n", string(content))
+
+	idx, err := r.Storer.Index()
+	s.NoError(err)
+
+	stages := map[index.Stage]bool{}
+	for _, e := range idx.Entries {
+		if e.Name == "foo" {
+			stages[e.Stage] = true
+		}
+	}
+	s.Equal(map[index.Stage]bool{index.AncestorMode: true, index.TheirMode: true}, stages)
+}
+
+func (s *RepositorySuite) TestMergeThreeWayRename() {
+	r, w := setupMerge(s, map[string][]byte{
+		"foo": []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"),
+	})
+
+	commitFiles(s, w, map[string][]byte{
+		"foo": nil,
+		"bar": []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"),
+	})
+
+	s.checkoutBranch(w, "feature")
+	commitFiles(s, w, map[string][]byte{"foo": []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\nten\n")})
+
+	s.checkoutBranch(w, "master")
+	s.NoError(s.mergeBranch(r, "feature"))
+
+	_, err := w.Filesystem.Stat("foo")
+	s.ErrorIs(err, os.ErrNotExist)
+
+	content, err := util.ReadFile(w.Filesystem, "bar")
+	s.NoError(err)
+	s.Equal("1\n2\n3\n4\n5\n6\n7\n8\n9\nten\n", string(content))
+}
+
+func (s *RepositorySuite) TestMergeThreeWayFastForward() {
+	r, w := setupMerge(s, map[string][]byte{"foo": []byte("foo\n")})
+
+	s.checkoutBranch(w, "feature")
+	theirs := commitFiles(s, w, map[string][]byte{"bar": []byte("bar\n")})
+
+	s.checkoutBranch(w, "master")
+	s.NoError(util.WriteFile(w.Filesystem, "untracked", []byte("untracked\n"), 0o644))
+	s.NoError(s.mergeBranch(r, "feature"))
+
+	head, err := r.Head()
+	s.NoError(err)
+	s.Equal(theirs, head.Hash())
+
+	_, err = w.Filesystem.Stat("bar")
+	s.NoError(err)
+	_, err = w.Filesystem.Stat("untracked")
+	s.NoError(err)
+
+	s.ErrorIs(s.mergeBranch(r, "feature"), NoErrAlreadyUpToDate)
+}
+
+func (s *RepositorySuite) TestMergeThreeWayUntrackedOverwritten() {
+	r, w := setupMerge(s, map[string][]byte{"foo": []byte("foo\n")})
+
+	ours := commitFiles(s, w, map[string][]byte{"foo": []byte("ours\n")})
+
+	s.checkoutBranch(w, "feature")
+	commitFiles(s, w, map[string][]byte{"bar": []byte("bar\n")})
+
+	s.checkoutBranch(w, "master")
+	s.NoError(util.WriteFile(w.Filesystem, "bar", []byte("untracked\n"), 0o644))
+	s.ErrorIs(s.mergeBranch(r, "feature"), ErrUntrackedFilesOverwritten)
+
+	head, err := r.Head()
+	s.NoError(err)
+	s.Equal(ours, head.Hash())
+}
+
+func (s *RepositorySuite) TestMergeThreeWayNotClean() {
+	r, w := setupMerge(s, map[string][]byte{"foo": []byte("foo\n")})
+
+	commitFiles(s, w, map[string][]byte{"foo": []byte("ours\n")})
+
+	s.checkoutBranch(w, "feature")
+	commitFiles(s, w, map[string][]byte{"bar": []byte("bar\n")})
+
+	s.checkoutBranch(w, "master")
+	s.NoError(util.WriteFile(w.Filesystem, "foo", []byte("dirty\n"), 0o644))
+	s.ErrorIs(s.mergeBranch(r, "feature"), ErrWorktreeNotClean)
+}
+
+func (s *RepositorySuite) TestMergeThreeWayUnrelatedHistories() {
+	r, w := setupMerge(s, map[string][]byte{"foo": []byte("foo\n")})
+
+	orphan := &object.Commit{
+		Author:    *mergeSignature,
+		Committer: *mergeSignature,
+		Message:   "orphan",
+		TreeHash:  plumbing.NewHash("4b825dc642cb6eb9a060e54bf8d69288fbee4904"),
+	}
+
+	obj := r.Storer.NewEncodedObject()
+	s.NoError((&object.Tree{}).Encode(obj))
+	_, err := r.Storer.SetEncodedObject(obj)
+	s.NoError(err)
+
+	obj = r.Storer.NewEncodedObject()
+	s.NoError(orphan.Encode(obj))
+	h, err := r.Storer.SetEncodedObject(obj)
+	s.NoError(err)
+
+	ref := plumbing.NewHashReference(plumbing.NewBranchReferenceName("orphan"), h)
+	s.NoError(r.Storer.SetReference(ref))
+
+	s.ErrorIs(s.mergeBranch(r, "orphan"), ErrUnrelatedHistories)
+
+	s.NoError(r.Merge(*ref, MergeOptions{
+		Strategy:                ThreeWayMerge,
+		Author:                  mergeSignature,
+		AllowUnrelatedHistories: true,
+	}))
+
+	_, err = w.Filesystem.Stat("foo")
+	s.NoError(err)
+}
@@ -0,0 +1,24 @@
+package git
+
+import (
+	"errors"
+
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// ErrMultiPackIndexNotSupported is returned writing a multi-pack-index in a
+// repository whose storage doesn't support them.
+var ErrMultiPackIndexNotSupported = errors.New("multi-pack-index not supported by the storage")
+
+// WriteMultiPackIndex writes the multi-pack-index of all the packs of the
+// repository, as git multi-pack-index write does. Once written, the objects
+// of these packs are looked up in it, instead of in the index of each pack,
+// until packs are deleted, which removes it.
+func (r *Repository) WriteMultiPackIndex() error {
+	s, ok := r.Storer.(storer.MultiPackIndexStorer)
+	if !ok {
+		return ErrMultiPackIndexNotSupported
+	}
+
+	return s.WriteMultiPackIndex()
+}
@@ -0,0 +1,76 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/stretchr/testify/suite"
+
+	fixtures "github.com/go-git/go-git-fixtures/v4"
+)
+
+type MultiPackIndexSuite struct {
+	suite.Suite
+	BaseSuite
+}
+
+func TestMultiPackIndexSuite(t *testing.T) {
+	suite.Run(t, new(MultiPackIndexSuite))
+}
+
+func (s *MultiPackIndexSuite) TestWriteMultiPackIndex() {
+	r := s.NewRepository(fixtures.ByTag("unpacked").One())
+	expected := s.commits(r)
+
+	s.NoError(r.WriteMultiPackIndex())
+
+	fs := r.Storer.(*filesystem.Storage).Filesystem()
+	r, err := Open(filesystem.NewStorage(fs, cache.NewObjectLRUDefault()), nil)
+	s.NoError(err)
+
+	m, err := r.Storer.(storer.MultiPackIndexStorer).MultiPackIndex()
+	s.NoError(err)
+	s.NotNil(m)
+
+	packs, err := r.Storer.(storer.PackedObjectStorer).ObjectPacks()
+	s.NoError(err)
+	s.Len(m.PackNames, len(packs))
+
+	s.Equal(expected, s.commits(r))
+}
+
+func (s *MultiPackIndexSuite) TestRepackRemovesMultiPackIndex() {
+	r := s.NewRepository(fixtures.ByTag("unpacked").One())
+	s.NoError(r.WriteMultiPackIndex())
+
+	s.NoError(r.RepackObjects(&RepackConfig{}))
+
+	m, err := r.Storer.(storer.MultiPackIndexStorer).MultiPackIndex()
+	s.NoError(err)
+	s.Nil(m)
+}
+
+func (s *MultiPackIndexSuite) TestWriteMultiPackIndexNotSupported() {
+	r, err := Init(memory.NewStorage(), nil)
+	s.NoError(err)
+
+	s.ErrorIs(r.WriteMultiPackIndex(), ErrMultiPackIndexNotSupported)
+}
+
+func (s *MultiPackIndexSuite) commits(r *Repository) []plumbing.Hash {
+	iter, err := r.Log(&LogOptions{All: true})
+	s.NoError(err)
+
+	var commits []plumbing.Hash
+	s.NoError(iter.ForEach(func(c *object.Commit) error {
+		commits = append(commits, c.Hash)
+		return nil
+	}))
+
+	return commits
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
 	"github.com/go-git/go-git/v5/storage"
 )
 
@@ -15,14 +16,41 @@ type objectWalker struct {
 	// seen map can become huge if walking over large
 	// repos. Thus using struct{} as the value type.
 	seen map[plumbing.Hash]struct{}
+	// commits holds the commits and tags seen, and objects the rest of
+	// them, in the order of the walk.
+	commits []plumbing.Hash
+	objects []plumbing.Hash
+	// skipMissing skips the objects missing in a partial clone, instead of
+	// fetching them from the promisor remote.
+	skipMissing bool
 }
 
 func newObjectWalker(s storage.Storer) *objectWalker {
-	return &objectWalker{s, map[plumbing.Hash]struct{}{}}
+	return &objectWalker{Storer: s, seen: map[plumbing.Hash]struct{}{}}
 }
 
-// walkAllRefs walks all (hash) references from the repo.
+// objectWalker returns a walker of the objects of the repository. In a
+// partial clone, the objects missing are skipped, as they are promised by the
+// promisor remote.
+func (r *Repository) objectWalker() *objectWalker {
+	ow := newObjectWalker(r.Storer)
+	ow.skipMissing = r.promisor != nil
+	return ow
+}
+
+// walkAllRefs walks all (hash) references from the repo, starting with HEAD.
 func (p *objectWalker) walkAllRefs() error {
+	head, err := storer.ResolveReference(p.Storer, plumbing.HEAD)
+	switch err {
+	case nil:
+		if err := p.walkObjectTree(head.Hash()); err != nil {
+			return err
+		}
+	case plumbing.ErrReferenceNotFound:
+	default:
+		return err
+	}
+
 	// Walk over all the references in the repo.
 	it, err := p.Storer.IterReferences()
 	if err != nil {
@@ -39,6 +67,61 @@ func (p *objectWalker) walkAllRefs() error {
 	return err
 }
 
+// walkReflogs walks the old and new values of the entries of the reflogs of
+// the given references. The objects missing from the repository, as the ones
+// of entries already expired by git, are skipped.
+func (p *objectWalker) walkReflogs(s storer.ReflogStorer, names []plumbing.ReferenceName) error {
+	for _, name := range names {
+		entries, err := s.Reflog(name)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range entries {
+			for _, h := range []plumbing.Hash{e.Old, e.New} {
+				if err := p.walkIfExists(h); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// walkIndex walks the objects of the entries of the index, so the files added
+// but not committed yet are kept. Submodules and missing objects are skipped.
+func (p *objectWalker) walkIndex() error {
+	idx, err := p.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range idx.Entries {
+		if e.Mode == filemode.Submodule {
+			continue
+		}
+
+		if err := p.walkIfExists(e.Hash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *objectWalker) walkIfExists(hash plumbing.Hash) error {
+	if hash.IsZero() || p.isSeen(hash) {
+		return nil
+	}
+
+	if p.Storer.HasEncodedObject(hash) != nil {
+		return nil
+	}
+
+	return p.walkObjectTree(hash)
+}
+
 func (p *objectWalker) isSeen(hash plumbing.Hash) bool {
 	_, seen := p.seen[hash]
 	return seen
@@ -48,6 +131,20 @@ func (p *objectWalker) add(hash plumbing.Hash) {
 	p.seen[hash] = struct{}{}
 }
 
+// isMissing returns whether the object is missing, and skipped.
+func (p *objectWalker) isMissing(hash plumbing.Hash) bool {
+	return p.skipMissing && p.Storer.HasEncodedObject(hash) == plumbing.ErrObjectNotFound
+}
+
+// order returns the objects seen in the order of the walk, the commits and
+// tags first, which is the order git writes them to the packs, as the most
+// recent objects are the most likely to be read.
+func (p *objectWalker) order() []plumbing.Hash {
+	hashes := make([]plumbing.Hash, 0, len(p.commits)+len(p.objects))
+	hashes = append(hashes, p.commits...)
+	return append(hashes, p.objects...)
+}
+
 // walkObjectTree walks over all objects and remembers references
 // to them in the objectWalker. This is used instead of the revlist
 // walks because memory usage is tight with huge repos.
@@ -57,6 +154,9 @@ func (p *objectWalker) walkObjectTree(hash plumbing.Hash) error {
 		return nil
 	}
 	p.add(hash)
+	if p.isMissing(hash) {
+		return nil
+	}
 	// Fetch the object.
 	obj, err := object.GetObject(p.Storer, hash)
 	if err != nil {
@@ -65,6 +165,7 @@ func (p *objectWalker) walkObjectTree(hash plumbing.Hash) error {
 	// Walk all children depending on object type.
 	switch obj := obj.(type) {
 	case *object.Commit:
+		p.commits = append(p.commits, hash)
 		err = p.walkObjectTree(obj.TreeHash)
 		if err != nil {
 			return err
@@ -76,6 +177,7 @@ func (p *objectWalker) walkObjectTree(hash plumbing.Hash) error {
 			}
 		}
 	case *object.Tree:
+		p.objects = append(p.objects, hash)
 		for i := range obj.Entries {
 			// Shortcut for blob objects:
 			// 'or' the lower bits of a mode and check that it
@@ -85,7 +187,16 @@ func (p *objectWalker) walkObjectTree(hash plumbing.Hash) error {
 			// Other non-tree objects are somewhat rare, so they
 			// are not special-cased.
 			if obj.Entries[i].Mode|0755 == filemode.Executable {
-				p.add(obj.Entries[i].Hash)
+				if !p.isSeen(obj.Entries[i].Hash) {
+					p.add(obj.Entries[i].Hash)
+					if !p.isMissing(obj.Entries[i].Hash) {
+						p.objects = append(p.objects, obj.Entries[i].Hash)
+					}
+				}
+				continue
+			}
+			// Submodules point to commits of other repositories.
+			if obj.Entries[i].Mode == filemode.Submodule {
 				continue
 			}
 			// Normal walk for sub-trees (and symlinks etc).
@@ -95,7 +206,11 @@ func (p *objectWalker) walkObjectTree(hash plumbing.Hash) error {
 			}
 		}
 	case *object.Tag:
+		p.commits = append(p.commits, hash)
 		return p.walkObjectTree(obj.Target)
+	case *object.Blob:
+		// Blobs have no children.
+		p.objects = append(p.objects, hash)
 	default:
 		// Error out on unhandled object types.
 		return fmt.Errorf("unknown object %X %s %T", obj.ID(), obj.Type(), obj)
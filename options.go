@@ -9,7 +9,9 @@ import (
 
 	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/internal/revision"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/bundle"
 	formatcfg "github.com/go-git/go-git/v5/plumbing/format/config"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
@@ -89,12 +91,32 @@ type CloneOptions struct {
 	// Filter requests that the server to send only a subset of the objects.
 	// See https://git-scm.com/docs/git-clone#Documentation/git-clone.txt-code--filterltfilter-specgtcode
 	Filter packp.Filter
+	// ServerOptions are sent to the server, their meaning is specific to
+	// the server. They require the version 2 of the protocol, set by the
+	// protocol.version option.
+	ServerOptions []string
+	// PackfileURIProtocols are the protocols, such as https, accepted to
+	// download the objects the server sends as URIs of packfiles, with the
+	// version 2 of the protocol.
+	PackfileURIProtocols []string
 }
 
 // MergeOptions describes how a merge should be performed.
 type MergeOptions struct {
 	// Strategy defines the merge strategy to be used.
 	Strategy MergeStrategy
+	// Message is the message of the merge commit created by ThreeWayMerge.
+	// If empty, a message in the same format used by git is generated.
+	Message string
+	// Author is the author's signature of the merge commit. If Author is
+	// nil the Name and Email is read from the config.
+	Author *object.Signature
+	// Committer is the committer's signature of the merge commit. If
+	// Committer is nil the Author signature is used.
+	Committer *object.Signature
+	// AllowUnrelatedHistories allows merging histories that do not share a
+	// common ancestor, otherwise ErrUnrelatedHistories is returned.
+	AllowUnrelatedHistories bool
 }
 
 // MergeStrategy represents the different types of merge strategies.
@@ -108,6 +130,12 @@ const (
 	//
 	// This is the default option.
 	FastForwardMerge MergeStrategy = iota
+	// ThreeWayMerge represents a Git merge strategy where the changes done
+	// on both branches since their merge base are combined, creating a merge
+	// commit with both branches as parents. Renames are detected and the
+	// content of files changed on both sides is merged line by line. If
+	// possible, the current branch is fast-forwarded instead.
+	ThreeWayMerge
 )
 
 // Validate validates the fields and sets the default values.
@@ -227,6 +255,14 @@ type FetchOptions struct {
 	// Filter requests that the server to send only a subset of the objects.
 	// See https://git-scm.com/docs/git-clone#Documentation/git-clone.txt-code--filterltfilter-specgtcode
 	Filter packp.Filter
+	// ServerOptions are sent to the server, their meaning is specific to
+	// the server. They require the version 2 of the protocol, set by the
+	// protocol.version option.
+	ServerOptions []string
+	// PackfileURIProtocols are the protocols, such as https, accepted to
+	// download the objects the server sends as URIs of packfiles, with the
+	// version 2 of the protocol.
+	PackfileURIProtocols []string
 }
 
 // Validate validates the fields and sets the default values.
@@ -545,7 +581,8 @@ type CommitOptions struct {
 	// nil the Author signature is used.
 	Committer *object.Signature
 	// Parents are the parents commits for the new commit, by default when
-	// len(Parents) is zero, the hash of HEAD reference is used.
+	// len(Parents) is zero, the hash of HEAD reference is used, followed by
+	// the hash of MERGE_HEAD when a merge is in progress.
 	Parents []plumbing.Hash
 	// SignKey denotes a key to sign the commit with. A nil value here means the
 	// commit will not be signed. The private key must be present and already
@@ -588,6 +625,16 @@ func (o *CommitOptions) Validate(r *Repository) error {
 
 		if head != nil {
 			o.Parents = []plumbing.Hash{head.Hash()}
+
+			// Concluding a merge which stopped due to conflicts.
+			mergeHead, err := r.Storer.Reference(plumbing.MergeHead)
+			if err != nil && err != plumbing.ErrReferenceNotFound {
+				return err
+			}
+
+			if mergeHead != nil {
+				o.Parents = append(o.Parents, mergeHead.Hash())
+			}
 		}
 	}
 
@@ -713,6 +760,10 @@ type ListOptions struct {
 	ProxyOptions transport.ProxyOptions
 	// Timeout specifies the timeout in seconds for list operations
 	Timeout int
+	// ServerOptions are sent to the server, their meaning is specific to
+	// the server. They require the version 2 of the protocol, set by the
+	// protocol.version option.
+	ServerOptions []string
 }
 
 // PeelingOption represents the different ways to handle peeled references.
@@ -791,6 +842,22 @@ type PlainOpenOptions struct {
 // Validate validates the fields and sets the default values.
 func (o *PlainOpenOptions) Validate() error { return nil }
 
+// LazyFetchOptions describes how the objects missing in a partial clone are
+// fetched from its promisor remote, when they are needed.
+type LazyFetchOptions struct {
+	// Disabled disables the fetching of the missing objects, e.g. for offline
+	// use, they are reported as not found instead.
+	Disabled bool
+	// Auth credentials, if required, to use with the promisor remote.
+	Auth transport.AuthMethod
+	// InsecureSkipTLS skips ssl verify if protocol is https
+	InsecureSkipTLS bool
+	// CABundle specify additional ca bundle with system cert pool
+	CABundle []byte
+	// ProxyOptions provides info required for connecting to a proxy.
+	ProxyOptions transport.ProxyOptions
+}
+
 type PlainInitOptions struct {
 	InitOptions
 	// Determines if the repository will have a worktree (non-bare) or not (bare).
@@ -821,3 +888,311 @@ func (o *RestoreOptions) Validate() error {
 
 	return nil
 }
+
+const (
+	// DefaultReflogExpire is the default age of the reflog entries removed
+	// by Repository.ExpireReflog, as the gc.reflogExpire default of git.
+	DefaultReflogExpire = 90 * 24 * time.Hour
+	// DefaultReflogExpireUnreachable is the default age of the reflog
+	// entries removed by Repository.ExpireReflog when they point to commits
+	// no longer reachable from the reference, as the
+	// gc.reflogExpireUnreachable default of git.
+	DefaultReflogExpireUnreachable = 30 * 24 * time.Hour
+)
+
+// ExpireReflogOptions describes how the reflogs are expired.
+type ExpireReflogOptions struct {
+	// ReferenceNames are the references whose reflogs are expired, if empty
+	// all the references and HEAD are used.
+	ReferenceNames []plumbing.ReferenceName
+	// Expire removes the entries older than the given time. If zero, the
+	// entries older than DefaultReflogExpire are removed.
+	Expire time.Time
+	// ExpireUnreachable removes the entries older than the given time that
+	// point to commits not reachable from the current value of the
+	// reference. If zero, DefaultReflogExpireUnreachable is used.
+	ExpireUnreachable time.Time
+}
+
+// Validate validates the fields and sets the default values.
+func (o *ExpireReflogOptions) Validate() error {
+	now := time.Now()
+	if o.Expire.IsZero() {
+		o.Expire = now.Add(-DefaultReflogExpire)
+	}
+
+	if o.ExpireUnreachable.IsZero() {
+		o.ExpireUnreachable = now.Add(-DefaultReflogExpireUnreachable)
+	}
+
+	return nil
+}
+
+// StashOptions describes how a stash is created.
+type StashOptions struct {
+	// Message describes the stash, if empty a message based on the current
+	// commit is used, as git does.
+	Message string
+	// IncludeUntracked stashes the untracked files too, removing them from
+	// the worktree. Ignored files are never stashed.
+	IncludeUntracked bool
+	// KeepIndex keeps the changes already added to the index, both in the
+	// index and in the worktree.
+	KeepIndex bool
+	// Author is the signature of the stash commits. If nil, the author is
+	// taken from the configuration as with CommitOptions.
+	Author *object.Signature
+	// Committer is the committer signature of the stash commits, if nil the
+	// Author is used.
+	Committer *object.Signature
+}
+
+// Validate validates the fields and sets the default values.
+func (o *StashOptions) Validate(r *Repository) error {
+	if o.Author == nil {
+		co := &CommitOptions{Committer: o.Committer}
+		if err := co.loadConfigAuthorAndCommitter(r); err != nil {
+			return err
+		}
+
+		o.Author, o.Committer = co.Author, co.Committer
+	}
+
+	if o.Committer == nil {
+		o.Committer = o.Author
+	}
+
+	return nil
+}
+
+// CreateBundleOptions describes how a bundle is created.
+type CreateBundleOptions struct {
+	// Version is the version of the bundle format, bundle.V2 if zero. The
+	// version 3 writes the object format of the repository too.
+	Version int
+	// Exclude are the commits whose history is left out of the bundle, as
+	// the ^<commit> arguments of git bundle create. The parents of the
+	// commits in the bundle that are left out are written as its
+	// prerequisites.
+	Exclude []plumbing.Hash
+}
+
+// Validate validates the fields and sets the default values.
+func (o *CreateBundleOptions) Validate() error {
+	switch o.Version {
+	case 0:
+		o.Version = bundle.V2
+	case bundle.V2, bundle.V3:
+	default:
+		return fmt.Errorf("%w: %d", bundle.ErrUnsupportedVersion, o.Version)
+	}
+
+	return nil
+}
+
+// DefaultCommitGraphSizeMultiple is the default ratio between the number of
+// commits of the layers of a split commit-graph, as in git.
+const DefaultCommitGraphSizeMultiple = 2
+
+// WriteCommitGraphOptions describes how a commit-graph is written.
+type WriteCommitGraphOptions struct {
+	// Split writes the commits missing from the commit-graph as a new layer
+	// of a split commit-graph, as git commit-graph write --split does,
+	// instead of rewriting a single commit-graph file with all of them.
+	Split bool
+	// SizeMultiple is the ratio between the number of commits of a layer of
+	// a split commit-graph and the one of the new layer above which they
+	// are kept apart, smaller layers are merged into the new one.
+	// DefaultCommitGraphSizeMultiple if zero.
+	SizeMultiple int
+	// ChangedPaths computes the changed-path Bloom filters of the commits,
+	// as git commit-graph write --changed-paths does, letting the path
+	// limited logs skip the commits not changing their paths. They are
+	// always computed if the commit-graph already has them.
+	ChangedPaths bool
+}
+
+// Validate validates the fields and sets the default values.
+func (o *WriteCommitGraphOptions) Validate() error {
+	if o.SizeMultiple < 0 {
+		return fmt.Errorf("invalid commit-graph size multiple: %d", o.SizeMultiple)
+	}
+
+	if o.SizeMultiple == 0 {
+		o.SizeMultiple = DefaultCommitGraphSizeMultiple
+	}
+
+	return nil
+}
+
+const (
+	// DefaultGCAuto is the default number of loose objects above which
+	// Repository.GC runs with the Auto option, as the gc.auto default of git.
+	DefaultGCAuto = 6700
+	// DefaultGCAutoPackLimit is the default number of packs from which
+	// Repository.GC runs with the Auto option, as the gc.autoPackLimit
+	// default of git.
+	DefaultGCAutoPackLimit = 50
+	// DefaultGCPruneExpire is the default age of the unreachable loose
+	// objects removed by Repository.GC, as the gc.pruneExpire default of git.
+	DefaultGCPruneExpire = 14 * 24 * time.Hour
+)
+
+// GCOptions describes how the garbage of a repository is collected.
+type GCOptions struct {
+	// Auto only collects the garbage when there are more loose objects than
+	// gc.auto or at least gc.autoPackLimit packs, as git gc --auto does. A
+	// gc.auto of 0 disables it.
+	Auto bool
+	// PruneExpire removes the unreachable loose objects older than the given
+	// time. If zero, it's taken from gc.pruneExpire, which can be a date as
+	// "2.weeks.ago", the default, "now" or "never".
+	PruneExpire time.Time
+	// NoPrune keeps all the unreachable objects, as git gc --no-prune does.
+	NoPrune bool
+	// Force runs even if another process seems to be collecting the garbage
+	// of the repository, as git gc --force does.
+	Force bool
+}
+
+// Validate validates the fields and sets the default values.
+func (o *GCOptions) Validate(r *Repository) error {
+	if o.NoPrune || !o.PruneExpire.IsZero() {
+		return nil
+	}
+
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+
+	switch expire := cfg.Raw.Section(gcSection).Option(gcPruneExpireKey); expire {
+	case "":
+		o.PruneExpire = time.Now().Add(-DefaultGCPruneExpire)
+	case "never":
+		o.NoPrune = true
+	default:
+		t, ok := revision.ParseDate(expire)
+		if !ok {
+			return fmt.Errorf("invalid %s.%s: %q", gcSection, gcPruneExpireKey, expire)
+		}
+
+		o.PruneExpire = t
+	}
+
+	return nil
+}
+
+// CherryPickOptions describes how a commit is cherry-picked.
+type CherryPickOptions struct {
+	// Mainline is the number, starting from 1, of the parent of a merge
+	// commit the changes are computed against, as the -m option of git
+	// cherry-pick. It is required when picking a merge commit.
+	Mainline int
+	// NoCommit applies the changes to the worktree and the index without
+	// creating a commit.
+	NoCommit bool
+	// Committer is the committer signature of the new commit, if nil it's
+	// taken from the configuration. The author of the picked commit is kept.
+	Committer *object.Signature
+}
+
+// Validate validates the fields and sets the default values.
+func (o *CherryPickOptions) Validate(r *Repository) error {
+	if o.Mainline < 0 {
+		return ErrInvalidMainline
+	}
+
+	if o.NoCommit || o.Committer != nil {
+		return nil
+	}
+
+	var err error
+	o.Committer, err = loadConfigCommitter(r)
+	return err
+}
+
+// RevertOptions describes how a commit is reverted.
+type RevertOptions struct {
+	// Mainline is the number, starting from 1, of the parent of a merge
+	// commit the changes are reverted to, as the -m option of git revert. It
+	// is required when reverting a merge commit.
+	Mainline int
+	// NoCommit applies the changes to the worktree and the index without
+	// creating a commit.
+	NoCommit bool
+	// Committer is the author and committer signature of the new commit, if
+	// nil it's taken from the configuration.
+	Committer *object.Signature
+}
+
+// Validate validates the fields and sets the default values.
+func (o *RevertOptions) Validate(r *Repository) error {
+	if o.Mainline < 0 {
+		return ErrInvalidMainline
+	}
+
+	if o.NoCommit || o.Committer != nil {
+		return nil
+	}
+
+	var err error
+	o.Committer, err = loadConfigCommitter(r)
+	return err
+}
+
+// loadConfigCommitter returns the committer signature from the configuration,
+// using the user identity if there is no specific committer one.
+func loadConfigCommitter(r *Repository) (*object.Signature, error) {
+	co := &CommitOptions{}
+	if err := co.loadConfigAuthorAndCommitter(r); err != nil {
+		return nil, err
+	}
+
+	if co.Committer != nil {
+		return co.Committer, nil
+	}
+
+	return co.Author, nil
+}
+
+// ErrMissingUpstream is returned when rebasing without an upstream commit.
+var ErrMissingUpstream = errors.New("upstream is required")
+
+// RebaseOptions describes how a branch is rebased.
+type RebaseOptions struct {
+	// Upstream is the commit the branch is compared with, only the commits of
+	// the branch not reachable from it are replayed.
+	Upstream plumbing.Hash
+	// Onto is the commit the commits are replayed on, as the --onto option of
+	// git rebase. If zero, Upstream is used.
+	Onto plumbing.Hash
+	// Branch is checked out before being rebased. If empty, the current HEAD
+	// is rebased.
+	Branch plumbing.ReferenceName
+	// Commands is the todo list of the rebase. If nil, all the commits of the
+	// branch are picked, as returned by Repository.RebaseTodo.
+	Commands []RebaseCommand
+	// Committer is the committer signature of the new commits, if nil it's
+	// taken from the configuration. The authors of the commits are kept.
+	Committer *object.Signature
+}
+
+// Validate validates the fields and sets the default values.
+func (o *RebaseOptions) Validate(r *Repository) error {
+	if o.Upstream.IsZero() {
+		return ErrMissingUpstream
+	}
+
+	if o.Onto.IsZero() {
+		o.Onto = o.Upstream
+	}
+
+	if o.Committer != nil {
+		return nil
+	}
+
+	var err error
+	o.Committer, err = loadConfigCommitter(r)
+	return err
+}
@@ -0,0 +1,60 @@
+package filter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type command struct {
+	clean, smudge string
+	dir           string
+}
+
+// NewCommand returns a Filter running the given clean and smudge commands,
+// as configured with the filter.<driver>.clean and filter.<driver>.smudge
+// options, once per file. The commands are run by the shell in the dir
+// directory, see the package documentation, reading the content from their standard input and writing the
+// converted one to their standard output. The %f placeholder is replaced by
+// the path of the file. An empty command copies the content unchanged.
+func NewCommand(clean, smudge, dir string) Filter {
+	return &command{clean: clean, smudge: smudge, dir: dir}
+}
+
+func (c *command) Clean(path string, r io.Reader, w io.Writer) error {
+	return c.run(c.clean, path, r, w)
+}
+
+func (c *command) Smudge(path string, r io.Reader, w io.Writer) error {
+	return c.run(c.smudge, path, r, w)
+}
+
+func (c *command) run(cmd, path string, r io.Reader, w io.Writer) error {
+	if cmd == "" {
+		_, err := io.Copy(w, r)
+		return err
+	}
+
+	sh, err := shellCommand(strings.ReplaceAll(cmd, "%f", shellQuote(path)))
+	if err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	sh.Dir = c.dir
+	sh.Stdin = r
+	sh.Stdout = w
+	sh.Stderr = &stderr
+
+	if err := sh.Run(); err != nil {
+		return fmt.Errorf("%w: %q: %s", err, cmd, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+// shellQuote quotes s to be used as a single argument of a shell command.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
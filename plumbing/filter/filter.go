@@ -0,0 +1,61 @@
+// Package filter implements the filter drivers git applies to the content of
+// the files with the filter attribute: the clean filter converts the content
+// of a file in the worktree into the content stored in the repository, and
+// the smudge filter does the opposite on checkout.
+//
+// Filter drivers can be implemented in Go and registered by name, or run as
+// external commands as configured with the filter.<driver>.clean,
+// filter.<driver>.smudge and filter.<driver>.process options.
+//
+// The commands are run with sh, as git does. On Windows, it's the sh.exe in
+// the PATH or else the one shipped with Git for Windows, found from the
+// git.exe in the PATH; without it, the commands fail with ErrShellNotFound,
+// and only the registered filters can be used.
+//
+// See https://git-scm.com/docs/gitattributes#_filter
+package filter
+
+import (
+	"io"
+	"sync"
+)
+
+// Filter is a filter driver.
+type Filter interface {
+	// Clean writes to w the content of the file at path read from r,
+	// converted into the content stored in the repository.
+	Clean(path string, r io.Reader, w io.Writer) error
+	// Smudge writes to w the content of the file at path read from r,
+	// converted into the content written to the worktree.
+	Smudge(path string, r io.Reader, w io.Writer) error
+}
+
+var (
+	registry = map[string]Filter{}
+	mtx      sync.RWMutex
+)
+
+// Register adds or replaces the filter used for the given driver name, it
+// takes precedence over the commands configured for the driver. Registered
+// filters don't need a shell, so they work on every platform.
+func Register(driver string, f Filter) {
+	mtx.Lock()
+	registry[driver] = f
+	mtx.Unlock()
+}
+
+// Unregister removes the filter registered for the given driver name.
+func Unregister(driver string) {
+	mtx.Lock()
+	delete(registry, driver)
+	mtx.Unlock()
+}
+
+// Get returns the filter registered for the given driver name.
+func Get(driver string) (Filter, bool) {
+	mtx.RLock()
+	defer mtx.RUnlock()
+
+	f, ok := registry[driver]
+	return f, ok && f != nil
+}
@@ -0,0 +1,196 @@
+package filter
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type FilterSuite struct {
+	suite.Suite
+}
+
+func TestFilterSuite(t *testing.T) {
+	suite.Run(t, new(FilterSuite))
+}
+
+func (s *FilterSuite) SetupTest() {
+	if runtime.GOOS == "windows" {
+		s.T().Skip("filter commands are run by sh")
+	}
+}
+
+func (s *FilterSuite) TestRegister() {
+	f := NewCommand("", "", "")
+	Register("foo", f)
+	defer Unregister("foo")
+
+	found, ok := Get("foo")
+	s.True(ok)
+	s.Equal(f, found)
+
+	Unregister("foo")
+	_, ok = Get("foo")
+	s.False(ok)
+}
+
+func (s *FilterSuite) TestCommand() {
+	f := NewCommand("tr a-z A-Z", "echo %f; cat", s.T().TempDir())
+
+	var b bytes.Buffer
+	s.NoError(f.Clean("foo", strings.NewReader("foo\n"), &b))
+	s.Equal("FOO\n", b.String())
+
+	b.Reset()
+	s.NoError(f.Smudge("it's", strings.NewReader("foo\n"), &b))
+	s.Equal("it's\nfoo\n", b.String())
+
+	err := NewCommand("exit 1", "", "").Clean("foo", strings.NewReader("foo"), &b)
+	s.Error(err)
+}
+
+func (s *FilterSuite) TestProcess() {
+	s.T().Setenv("GO_GIT_TEST_FILTER_PROCESS", "1")
+	p := NewProcess(os.Args[0]+" -test.run=TestFilterProcessHelper", "")
+	defer func() { s.NoError(p.Close()) }()
+
+	var b bytes.Buffer
+	s.NoError(p.Clean("foo", strings.NewReader("FOO\n"), &b))
+	s.Equal("foo\n", b.String())
+
+	b.Reset()
+	content := strings.Repeat("ERR foo\n", pktline.MaxPayloadSize)
+	s.NoError(p.Smudge("foo", strings.NewReader(content), &b))
+	s.Equal(strings.ToUpper(content), b.String())
+
+	err := p.Smudge("error", strings.NewReader("foo"), &b)
+	s.ErrorIs(err, ErrProcessFailed)
+
+	// The smudge command isn't used anymore after being aborted.
+	err = p.Smudge("abort", strings.NewReader("foo"), &b)
+	s.ErrorIs(err, ErrProcessFailed)
+
+	b.Reset()
+	s.NoError(p.Smudge("foo", strings.NewReader("foo"), &b))
+	s.Equal("foo", b.String())
+}
+
+func (s *FilterSuite) TestProcessInvalidHandshake() {
+	p := NewProcess(`printf '0014git-filter-fake\n0000'; cat >/dev/null`, "")
+	defer p.Close()
+
+	var b bytes.Buffer
+	err := p.Clean("foo", strings.NewReader("foo"), &b)
+	s.ErrorIs(err, ErrProcessProtocol)
+
+	err = p.Clean("foo", strings.NewReader("foo"), &b)
+	s.ErrorIs(err, ErrProcessProtocol)
+}
+
+func TestFindGitShell(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"cmd/git.exe", "mingw64/bin/git.exe", "usr/bin/sh.exe"} {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(name), 0o755))
+		require.NoError(t, os.WriteFile(name, nil, 0o755))
+	}
+
+	for _, git := range []string{"cmd/git.exe", "mingw64/bin/git.exe"} {
+		sh, ok := findGitShell(filepath.Join(root, filepath.FromSlash(git)))
+		assert.True(t, ok, git)
+		assert.Equal(t, filepath.Join(root, "usr", "bin", "sh.exe"), sh, git)
+	}
+
+	_, ok := findGitShell(filepath.Join(t.TempDir(), "bin", "git.exe"))
+	assert.False(t, ok)
+}
+
+// TestFilterProcessHelper isn't a real test, it's the filter process used by
+// TestProcess. It lowercases the content on clean and uppercases it on
+// smudge, failing for the files named error and abort.
+func TestFilterProcessHelper(t *testing.T) {
+	if os.Getenv("GO_GIT_TEST_FILTER_PROCESS") != "1" {
+		return
+	}
+
+	r := bufio.NewReader(os.Stdin)
+	w := os.Stdout
+
+	readList := func() []string {
+		var list []string
+		for {
+			l, data, err := pktline.ReadLine(r)
+			if err == io.EOF {
+				os.Exit(0)
+			}
+
+			if l == pktline.Flush {
+				return list
+			}
+
+			list = append(list, strings.TrimSpace(string(data)))
+		}
+	}
+
+	writeList := func(lines ...string) {
+		for _, l := range lines {
+			pktline.Writeln(w, l)
+		}
+
+		pktline.WriteFlush(w)
+	}
+
+	readList()
+	writeList("git-filter-server", "version=2")
+	readList()
+	writeList("capability=clean", "capability=smudge")
+
+	for {
+		req := readList()
+
+		var content []byte
+		for {
+			l, data, _ := pktline.ReadLine(r)
+			if l == pktline.Flush {
+				break
+			}
+
+			content = append(content, data...)
+		}
+
+		switch req[1] {
+		case "pathname=error":
+			writeList("status=error")
+			continue
+		case "pathname=abort":
+			writeList("status=abort")
+			continue
+		}
+
+		if req[0] == "command=clean" {
+			content = bytes.ToLower(content)
+		} else {
+			content = bytes.ToUpper(content)
+		}
+
+		writeList("status=success")
+		for len(content) > 0 {
+			n := min(len(content), pktline.MaxPayloadSize)
+			pktline.Write(w, content[:n])
+			content = content[n:]
+		}
+
+		pktline.WriteFlush(w)
+		writeList()
+	}
+}
@@ -0,0 +1,314 @@
+package filter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+)
+
+const (
+	processClient  = "git-filter-client"
+	processServer  = "git-filter-server"
+	processVersion = "version=2"
+
+	capabilityPrefix = "capability="
+	statusPrefix     = "status="
+
+	commandClean  = "clean"
+	commandSmudge = "smudge"
+
+	statusSuccess = "success"
+	statusAbort   = "abort"
+)
+
+var (
+	// ErrProcessProtocol is returned when a filter process doesn't follow
+	// the long-running process protocol.
+	ErrProcessProtocol = errors.New("invalid filter process protocol")
+	// ErrProcessFailed is returned when a filter process fails to filter the
+	// content of a file.
+	ErrProcessFailed = errors.New("filter process failed")
+)
+
+// Process is a Filter running a long-running filter process, as configured
+// with the filter.<driver>.process option. The process is started on first
+// use and reused for every file, it must be stopped with Close.
+//
+// See https://git-scm.com/docs/long-running-process-protocol
+type Process struct {
+	command string
+	dir     string
+
+	m            sync.Mutex
+	cmd          *exec.Cmd
+	stdin        io.WriteCloser
+	stdout       *bufio.Reader
+	capabilities map[string]bool
+	err          error
+}
+
+// NewProcess returns a Process running the given command, by the shell in
+// the dir directory.
+func NewProcess(command, dir string) *Process {
+	return &Process{command: command, dir: dir}
+}
+
+// Clean filters the content with the clean command of the process, the
+// content is copied unchanged if the process doesn't support it.
+func (p *Process) Clean(path string, r io.Reader, w io.Writer) error {
+	return p.filter(commandClean, path, r, w)
+}
+
+// Smudge filters the content with the smudge command of the process, the
+// content is copied unchanged if the process doesn't support it.
+func (p *Process) Smudge(path string, r io.Reader, w io.Writer) error {
+	return p.filter(commandSmudge, path, r, w)
+}
+
+// Close stops the process, if started.
+func (p *Process) Close() error {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if p.cmd == nil {
+		return nil
+	}
+
+	// The process is expected to exit once its standard input is closed.
+	_ = p.stdin.Close()
+	err := p.cmd.Wait()
+	p.cmd = nil
+	return err
+}
+
+func (p *Process) filter(command, path string, r io.Reader, w io.Writer) error {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if err := p.start(); err != nil {
+		return err
+	}
+
+	if !p.capabilities[command] {
+		_, err := io.Copy(w, r)
+		return err
+	}
+
+	if err := p.writeRequest(command, path, r); err != nil {
+		return p.fail(err)
+	}
+
+	status, err := p.readStatus(statusSuccess)
+	if err != nil {
+		return p.fail(err)
+	}
+
+	if status != statusSuccess {
+		return p.statusError(command, path, status)
+	}
+
+	if err := p.readContent(w); err != nil {
+		return p.fail(err)
+	}
+
+	// The status can be updated after the content, if the filter fails
+	// while sending it.
+	if status, err = p.readStatus(status); err != nil {
+		return p.fail(err)
+	}
+
+	if status != statusSuccess {
+		return p.statusError(command, path, status)
+	}
+
+	return nil
+}
+
+// start starts the process and does the handshake, if not done yet.
+func (p *Process) start() error {
+	if p.err != nil {
+		return p.err
+	}
+
+	if p.cmd != nil {
+		return nil
+	}
+
+	cmd, err := shellCommand(p.command)
+	if err != nil {
+		return err
+	}
+
+	cmd.Dir = p.dir
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("%w: %q", err, p.command)
+	}
+
+	p.cmd, p.stdin, p.stdout = cmd, stdin, bufio.NewReader(stdout)
+	if err := p.handshake(); err != nil {
+		return p.fail(err)
+	}
+
+	return nil
+}
+
+func (p *Process) handshake() error {
+	if err := p.writeList(processClient, processVersion); err != nil {
+		return err
+	}
+
+	welcome, err := p.readList()
+	if err != nil {
+		return err
+	}
+
+	if len(welcome) != 2 || welcome[0] != processServer || welcome[1] != processVersion {
+		return fmt.Errorf("%w: unexpected welcome %q", ErrProcessProtocol, welcome)
+	}
+
+	err = p.writeList(capabilityPrefix+commandClean, capabilityPrefix+commandSmudge)
+	if err != nil {
+		return err
+	}
+
+	capabilities, err := p.readList()
+	if err != nil {
+		return err
+	}
+
+	p.capabilities = make(map[string]bool)
+	for _, c := range capabilities {
+		if name, ok := strings.CutPrefix(c, capabilityPrefix); ok {
+			p.capabilities[name] = true
+		}
+	}
+
+	return nil
+}
+
+func (p *Process) writeRequest(command, path string, r io.Reader) error {
+	if err := p.writeList("command="+command, "pathname="+path); err != nil {
+		return err
+	}
+
+	buf := make([]byte, pktline.MaxPayloadSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if _, err := pktline.Write(p.stdin, buf[:n]); err != nil {
+				return err
+			}
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return pktline.WriteFlush(p.stdin)
+}
+
+// readStatus reads a list of keys, returning the last status found or def if
+// there is none.
+func (p *Process) readStatus(def string) (string, error) {
+	list, err := p.readList()
+	if err != nil {
+		return "", err
+	}
+
+	status := def
+	for _, l := range list {
+		if s, ok := strings.CutPrefix(l, statusPrefix); ok {
+			status = s
+		}
+	}
+
+	return status, nil
+}
+
+func (p *Process) readContent(w io.Writer) error {
+	for {
+		l, data, err := pktline.ReadLine(p.stdout)
+		// The content is binary, it can be mistaken for an error line.
+		var errLine *pktline.ErrorLine
+		if err != nil && !errors.As(err, &errLine) {
+			return err
+		}
+
+		if l == pktline.Flush {
+			return nil
+		}
+
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *Process) writeList(lines ...string) error {
+	for _, l := range lines {
+		if _, err := pktline.Writeln(p.stdin, l); err != nil {
+			return err
+		}
+	}
+
+	return pktline.WriteFlush(p.stdin)
+}
+
+func (p *Process) readList() ([]string, error) {
+	var list []string
+	for {
+		l, data, err := pktline.ReadLine(p.stdout)
+		if err != nil {
+			return nil, err
+		}
+
+		if l == pktline.Flush {
+			return list, nil
+		}
+
+		list = append(list, strings.TrimSuffix(string(data), "\n"))
+	}
+}
+
+// statusError returns the error for an unsuccessful status, the process
+// isn't used again for the command if the status is abort.
+func (p *Process) statusError(command, path, status string) error {
+	if status == statusAbort {
+		delete(p.capabilities, command)
+	}
+
+	return fmt.Errorf("%w: %s %s: %s", ErrProcessFailed, command, path, status)
+}
+
+// fail stops the process after an error that leaves the protocol in an
+// unknown state, the error is returned by any subsequent use.
+func (p *Process) fail(err error) error {
+	_ = p.stdin.Close()
+	_ = p.cmd.Wait()
+
+	p.cmd = nil
+	p.err = err
+	return err
+}
@@ -0,0 +1,44 @@
+package filter
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// ErrShellNotFound is returned by the filter commands and processes when
+// there is no shell to run them. On Windows, they need the sh.exe shipped
+// with Git for Windows.
+var ErrShellNotFound = errors.New("sh not found to run the filter command")
+
+// shellCommand returns the command running the given command line with the
+// shell, as git does.
+func shellCommand(cmdline string) (*exec.Cmd, error) {
+	sh, err := shellPath()
+	if err != nil {
+		return nil, err
+	}
+
+	return exec.Command(sh, "-c", cmdline), nil
+}
+
+// findGitShell returns the path of the sh.exe shipped with Git for Windows,
+// given the path of its git.exe, which is in the cmd, bin or mingw64/bin
+// directory of the installation.
+func findGitShell(git string) (string, bool) {
+	dir := filepath.Dir(git)
+	for i := 0; i < 2; i++ {
+		dir = filepath.Dir(dir)
+		for _, sh := range []string{
+			filepath.Join(dir, "bin", "sh.exe"),
+			filepath.Join(dir, "usr", "bin", "sh.exe"),
+		} {
+			if fi, err := os.Stat(sh); err == nil && fi.Mode().IsRegular() {
+				return sh, true
+			}
+		}
+	}
+
+	return "", false
+}
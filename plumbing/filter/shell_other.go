@@ -0,0 +1,7 @@
+//go:build !windows
+
+package filter
+
+func shellPath() (string, error) {
+	return "sh", nil
+}
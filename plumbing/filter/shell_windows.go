@@ -0,0 +1,27 @@
+//go:build windows
+
+package filter
+
+import (
+	"os/exec"
+	"sync"
+)
+
+// shellPath returns the path of the sh.exe in the PATH, or else the one
+// shipped with Git for Windows, next to the git.exe in the PATH.
+var shellPath = sync.OnceValues(func() (string, error) {
+	if sh, err := exec.LookPath("sh"); err == nil {
+		return sh, nil
+	}
+
+	git, err := exec.LookPath("git")
+	if err != nil {
+		return "", ErrShellNotFound
+	}
+
+	if sh, ok := findGitShell(git); ok {
+		return sh, nil
+	}
+
+	return "", ErrShellNotFound
+})
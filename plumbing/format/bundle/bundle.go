@@ -0,0 +1,79 @@
+// Package bundle implements encoding and decoding of git bundle files.
+//
+// A bundle holds a set of references and a packfile with the objects
+// reachable from them, to transfer them without a connection to the
+// repository. The objects reachable from the prerequisites of the bundle are
+// left out of the packfile, the receivers must have them.
+//
+// See https://git-scm.com/docs/gitformat-bundle for the format.
+package bundle
+
+import (
+	"errors"
+	"io"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+const (
+	// V2 is the version 2 of the bundle format.
+	V2 = 2
+	// V3 is the version 3 of the bundle format, adding capabilities to the
+	// version 2.
+	V3 = 3
+
+	// V2Signature is the first line of the bundles of the version 2.
+	V2Signature = "# v2 git bundle\n"
+	// V3Signature is the first line of the bundles of the version 3.
+	V3Signature = "# v3 git bundle\n"
+
+	// ObjectFormatCapability is the capability with the hash algorithm of
+	// the objects of the bundle.
+	ObjectFormatCapability = "object-format"
+	// FilterCapability is the capability with the filter the packfile of
+	// the bundle was created with.
+	FilterCapability = "filter"
+)
+
+var (
+	// ErrInvalidSignature is returned decoding a stream without the
+	// signature of a supported version of the format.
+	ErrInvalidSignature = errors.New("bundle: invalid signature")
+	// ErrMalformedBundle is returned decoding a bundle with a malformed
+	// header.
+	ErrMalformedBundle = errors.New("bundle: malformed header")
+	// ErrUnsupportedVersion is returned encoding a bundle of an unknown
+	// version.
+	ErrUnsupportedVersion = errors.New("bundle: unsupported version")
+	// ErrCapabilitiesNotSupported is returned encoding a bundle of the
+	// version 2 with capabilities.
+	ErrCapabilitiesNotSupported = errors.New("bundle: capabilities require the version 3")
+)
+
+// Bundle is a git bundle: a header with the capabilities, prerequisites and
+// references of the bundle, followed by a packfile.
+type Bundle struct {
+	// Version is the version of the format, V2 or V3.
+	Version int
+	// Capabilities are the capabilities of the bundle, only supported on
+	// the version 3 of the format.
+	Capabilities map[string]string
+	// Prerequisites are the commits the receivers must have, the objects
+	// reachable from them aren't in the packfile.
+	Prerequisites []Prerequisite
+	// References are the references of the bundle, all of them hash
+	// references.
+	References []*plumbing.Reference
+	// Packfile is the packfile of the bundle. It's written after the header
+	// by the Encoder, if not nil, and is the rest of the stream after the
+	// header once decoded.
+	Packfile io.Reader
+}
+
+// Prerequisite is a commit the receivers of a bundle must have.
+type Prerequisite struct {
+	// Hash is the hash of the commit.
+	Hash plumbing.Hash
+	// Comment is an optional comment, usually the subject of the commit.
+	Comment string
+}
@@ -0,0 +1,105 @@
+package bundle
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/suite"
+)
+
+type BundleSuite struct {
+	suite.Suite
+}
+
+func TestBundleSuite(t *testing.T) {
+	suite.Run(t, new(BundleSuite))
+}
+
+const bundleFixture = "# v3 git bundle\n" +
+	"@filter=blob:none\n" +
+	"@object-format=sha1\n" +
+	"-918c48b83bd081e863dbe1b80f8998f058cd8294 Some commit\n" +
+	"6ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/heads/master\n" +
+	"6ecf0ef2c2dffb796033e5a02219af86ec6584e5 HEAD\n" +
+	"\n" +
+	"PACK"
+
+func (s *BundleSuite) TestDecode() {
+	b := &Bundle{}
+	s.NoError(NewDecoder(strings.NewReader(bundleFixture)).Decode(b))
+
+	s.Equal(V3, b.Version)
+	s.Equal(map[string]string{"filter": "blob:none", "object-format": "sha1"}, b.Capabilities)
+	s.Equal([]Prerequisite{{
+		Hash:    plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"),
+		Comment: "Some commit",
+	}}, b.Prerequisites)
+
+	head := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	s.Equal([]*plumbing.Reference{
+		plumbing.NewHashReference(plumbing.Master, head),
+		plumbing.NewHashReference(plumbing.HEAD, head),
+	}, b.References)
+
+	pack, err := io.ReadAll(b.Packfile)
+	s.NoError(err)
+	s.Equal("PACK", string(pack))
+}
+
+func (s *BundleSuite) TestDecodeMalformed() {
+	for _, input := range []string{
+		"",
+		"# v4 git bundle\n\n",
+		"# v2 git bundle\n@object-format=sha1\n\n",
+		"# v3 git bundle\n-918c48b83bd081e863dbe1b80f8998f058cd8294\n@object-format=sha1\n\n",
+		"# v2 git bundle\n-foo\n\n",
+		"# v2 git bundle\n6ecf0ef2c2dffb796033e5a02219af86ec6584e5\n\n",
+		"# v2 git bundle\n6ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/heads/master\n",
+	} {
+		err := NewDecoder(strings.NewReader(input)).Decode(&Bundle{})
+		s.Error(err, input)
+	}
+}
+
+func (s *BundleSuite) TestEncode() {
+	head := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	b := &Bundle{
+		Version:      V3,
+		Capabilities: map[string]string{"object-format": "sha1", "filter": "blob:none"},
+		Prerequisites: []Prerequisite{{
+			Hash:    plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"),
+			Comment: "Some commit",
+		}},
+		References: []*plumbing.Reference{
+			plumbing.NewHashReference(plumbing.Master, head),
+			plumbing.NewHashReference(plumbing.HEAD, head),
+		},
+		Packfile: strings.NewReader("PACK"),
+	}
+
+	var buf bytes.Buffer
+	s.NoError(NewEncoder(&buf).Encode(b))
+	s.Equal(bundleFixture, buf.String())
+}
+
+func (s *BundleSuite) TestEncodeV2() {
+	b := &Bundle{
+		Version: V2,
+		References: []*plumbing.Reference{
+			plumbing.NewHashReference(plumbing.Master, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")),
+		},
+	}
+
+	var buf bytes.Buffer
+	s.NoError(NewEncoder(&buf).Encode(b))
+	s.Equal("# v2 git bundle\n6ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/heads/master\n\n", buf.String())
+
+	b.Capabilities = map[string]string{"object-format": "sha1"}
+	s.ErrorIs(NewEncoder(&buf).Encode(b), ErrCapabilitiesNotSupported)
+
+	b.Version = 4
+	s.ErrorIs(NewEncoder(&buf).Encode(b), ErrUnsupportedVersion)
+}
@@ -0,0 +1,98 @@
+package bundle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// A Decoder reads and decodes bundles from an input stream.
+type Decoder struct {
+	r *bufio.Reader
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Decode reads the header of the bundle from the stream, the packfile is left
+// to be read from the Packfile field of the bundle.
+func (d *Decoder) Decode(b *Bundle) error {
+	sig, err := d.r.ReadString('\n')
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	switch sig {
+	case V2Signature:
+		b.Version = V2
+	case V3Signature:
+		b.Version = V3
+	default:
+		return ErrInvalidSignature
+	}
+
+	b.Capabilities = nil
+	b.Prerequisites = nil
+	b.References = nil
+	for {
+		line, err := d.r.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrMalformedBundle, err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			break
+		}
+
+		if err := d.decodeLine(b, line); err != nil {
+			return err
+		}
+	}
+
+	b.Packfile = d.r
+	return nil
+}
+
+func (d *Decoder) decodeLine(b *Bundle, line string) error {
+	switch {
+	case strings.HasPrefix(line, "@"):
+		// The capabilities precede the prerequisites and the references.
+		if b.Version != V3 || len(b.Prerequisites) != 0 || len(b.References) != 0 {
+			return fmt.Errorf("%w: unexpected capability %q", ErrMalformedBundle, line)
+		}
+
+		key, value, _ := strings.Cut(line[1:], "=")
+		if b.Capabilities == nil {
+			b.Capabilities = make(map[string]string)
+		}
+
+		b.Capabilities[key] = value
+	case strings.HasPrefix(line, "-"):
+		hash, comment, _ := strings.Cut(line[1:], " ")
+		if !plumbing.IsHash(hash) {
+			return fmt.Errorf("%w: invalid prerequisite %q", ErrMalformedBundle, line)
+		}
+
+		b.Prerequisites = append(b.Prerequisites, Prerequisite{
+			Hash:    plumbing.NewHash(hash),
+			Comment: comment,
+		})
+	default:
+		hash, name, ok := strings.Cut(line, " ")
+		if !ok || !plumbing.IsHash(hash) || name == "" {
+			return fmt.Errorf("%w: invalid reference %q", ErrMalformedBundle, line)
+		}
+
+		b.References = append(b.References, plumbing.NewHashReference(
+			plumbing.ReferenceName(name), plumbing.NewHash(hash),
+		))
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package bundle
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// An Encoder writes bundles to an output stream.
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes the header of the bundle, followed by its packfile if not
+// nil.
+func (e *Encoder) Encode(b *Bundle) error {
+	var sb strings.Builder
+	switch b.Version {
+	case V2:
+		if len(b.Capabilities) != 0 {
+			return ErrCapabilitiesNotSupported
+		}
+
+		sb.WriteString(V2Signature)
+	case V3:
+		sb.WriteString(V3Signature)
+	default:
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, b.Version)
+	}
+
+	keys := make([]string, 0, len(b.Capabilities))
+	for k := range b.Capabilities {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		sb.WriteString("@" + k)
+		if v := b.Capabilities[k]; v != "" {
+			sb.WriteString("=" + v)
+		}
+
+		sb.WriteByte('\n')
+	}
+
+	for _, p := range b.Prerequisites {
+		sb.WriteString("-" + p.Hash.String())
+		if p.Comment != "" {
+			sb.WriteString(" " + p.Comment)
+		}
+
+		sb.WriteByte('\n')
+	}
+
+	for _, r := range b.References {
+		fmt.Fprintf(&sb, "%s %s\n", r.Hash(), r.Name())
+	}
+
+	sb.WriteByte('\n')
+	if _, err := io.WriteString(e.w, sb.String()); err != nil {
+		return err
+	}
+
+	if b.Packfile == nil {
+		return nil
+	}
+
+	_, err := io.Copy(e.w, b.Packfile)
+	return err
+}
@@ -0,0 +1,200 @@
+package v2
+
+import (
+	"math/bits"
+	"strings"
+)
+
+const (
+	// bloomFilterVersion1 hashes the paths with the murmur3 implementation of
+	// git before 2.46, sign-extending the bytes above 0x7f.
+	bloomFilterVersion1 = 1
+	// bloomFilterVersion2 hashes the paths with the standard murmur3.
+	bloomFilterVersion2 = 2
+
+	bloomFilterNumHashes    = 7
+	bloomFilterBitsPerEntry = 10
+	// bloomFilterMaxChangedPaths is the number of changed paths above which
+	// the filter is truncated, matching every path.
+	bloomFilterMaxChangedPaths = 512
+
+	bloomFilterSeed0 = 0x293ae76f
+	bloomFilterSeed1 = 0x7e646e2c
+
+	szBloomFilterHeader = 3 * szUint32
+)
+
+// BloomFilter is the changed-path Bloom filter of a commit, with the paths
+// changed between the commit and its first parent, as stored in the BIDX and
+// BDAT chunks of the commit-graph files.
+type BloomFilter struct {
+	version      uint32
+	numHashes    uint32
+	bitsPerEntry uint32
+	data         []byte
+}
+
+// NewBloomFilter returns the changed-path Bloom filter of a commit changing
+// the given file paths, with the settings used by git. The directories of the
+// paths are added to the filter too. Filters with more than 512 changed paths
+// match every path, as git does.
+func NewBloomFilter(paths []string) *BloomFilter {
+	f := &BloomFilter{
+		version:      bloomFilterVersion1,
+		numHashes:    bloomFilterNumHashes,
+		bitsPerEntry: bloomFilterBitsPerEntry,
+	}
+
+	if len(paths) > bloomFilterMaxChangedPaths {
+		f.data = []byte{0xff}
+		return f
+	}
+
+	set := make(map[string]struct{}, len(paths))
+	for _, p := range paths {
+		for p != "" {
+			set[p] = struct{}{}
+			p = parentPath(p)
+		}
+	}
+
+	size := (len(set)*bloomFilterBitsPerEntry + 7) / 8
+	if size == 0 {
+		size = 1
+	}
+
+	f.data = make([]byte, size)
+	for p := range set {
+		f.add(p)
+	}
+
+	return f
+}
+
+// Contains returns false if the given path, of a file or a directory, wasn't
+// changed for sure, or true if it may have been.
+func (f *BloomFilter) Contains(path string) bool {
+	if len(f.data) == 0 || (f.version != bloomFilterVersion1 && f.version != bloomFilterVersion2) {
+		return true
+	}
+
+	for path = strings.Trim(path, "/"); path != ""; path = parentPath(path) {
+		if !f.contains(path) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (f *BloomFilter) add(path string) {
+	mod := uint64(len(f.data)) * 8
+	for _, h := range f.hashes(path) {
+		pos := uint64(h) % mod
+		f.data[pos/8] |= 1 << (pos % 8)
+	}
+}
+
+func (f *BloomFilter) contains(path string) bool {
+	mod := uint64(len(f.data)) * 8
+	for _, h := range f.hashes(path) {
+		pos := uint64(h) % mod
+		if f.data[pos/8]&(1<<(pos%8)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hashes returns the positions of the given path in the filter, before
+// taking their modulo, using double hashing.
+func (f *BloomFilter) hashes(path string) []uint32 {
+	signed := f.version == bloomFilterVersion1
+	h0 := murmur3(bloomFilterSeed0, path, signed)
+	h1 := murmur3(bloomFilterSeed1, path, signed)
+
+	hashes := make([]uint32, f.numHashes)
+	for i := range hashes {
+		hashes[i] = h0 + uint32(i)*h1
+	}
+
+	return hashes
+}
+
+// sameSettings returns whether both filters can be stored in the same
+// commit-graph file.
+func (f *BloomFilter) sameSettings(other *BloomFilter) bool {
+	return f.version == other.version &&
+		f.numHashes == other.numHashes &&
+		f.bitsPerEntry == other.bitsPerEntry
+}
+
+func parentPath(path string) string {
+	i := strings.LastIndexByte(path, '/')
+	if i < 0 {
+		return ""
+	}
+
+	return path[:i]
+}
+
+// murmur3 returns the 32-bit murmur3 hash of the given data. If signed, the
+// bytes are sign-extended, as the murmur3 implementation of git before 2.46
+// did.
+func murmur3(seed uint32, data string, signed bool) uint32 {
+	const (
+		c1 = 0xcc9e2d51
+		c2 = 0x1b873593
+		r1 = 15
+		r2 = 13
+		m  = 5
+		n  = 0xe6546b64
+	)
+
+	b := func(i int) uint32 {
+		if signed {
+			return uint32(int32(int8(data[i])))
+		}
+
+		return uint32(data[i])
+	}
+
+	h := seed
+	i := 0
+	for ; i+4 <= len(data); i += 4 {
+		k := b(i) | b(i+1)<<8 | b(i+2)<<16 | b(i+3)<<24
+		k *= c1
+		k = bits.RotateLeft32(k, r1)
+		k *= c2
+
+		h ^= k
+		h = bits.RotateLeft32(h, r2)
+		h = h*m + n
+	}
+
+	var k uint32
+	switch len(data) & 3 {
+	case 3:
+		k ^= b(i+2) << 16
+		fallthrough
+	case 2:
+		k ^= b(i+1) << 8
+		fallthrough
+	case 1:
+		k ^= b(i)
+		k *= c1
+		k = bits.RotateLeft32(k, r1)
+		k *= c2
+		h ^= k
+	}
+
+	h ^= uint32(len(data))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+
+	return h
+}
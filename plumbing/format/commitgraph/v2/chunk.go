@@ -32,7 +32,7 @@ const lenChunks = int(ZeroChunk) // ZeroChunk is not a valid chunk type, but it
 
 // Signature returns the byte signature for the chunk type.
 func (ct ChunkType) Signature() []byte {
-	if ct >= BaseGraphsListChunk || ct < 0 { // not a valid chunk type just return ZeroChunk
+	if ct > ZeroChunk || ct < 0 { // not a valid chunk type just return ZeroChunk
 		return chunkSignatures[ZeroChunk*chunkSigOffset : ZeroChunk*chunkSigOffset+szChunkSig]
 	}
 
@@ -55,3 +55,13 @@ type Index interface {
 
 	io.Closer
 }
+
+// BloomFilterIndex is an Index with the changed-path Bloom filters of its
+// commits. It is an optional interface, implemented by the indexes having
+// them.
+type BloomFilterIndex interface {
+	Index
+	// GetBloomFilterByIndex gets the changed-path Bloom filter of the commit
+	// with the given index, or nil if it has none
+	GetBloomFilterByIndex(i uint32) (*BloomFilter, error)
+}
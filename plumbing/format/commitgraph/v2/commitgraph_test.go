@@ -1,6 +1,7 @@
 package v2_test
 
 import (
+	"fmt"
 	"os"
 	"testing"
 
@@ -203,3 +204,144 @@ func (s *CommitgraphSuite) TestReencodeInMemory() {
 		testDecodeHelper(s, tmpIndex)
 	}
 }
+
+func (s *CommitgraphSuite) TestEncodeWithBase() {
+	for _, f := range fixtures.ByTag("commit-graph") {
+		dotgit := f.DotGit()
+		index := testReadIndex(s, dotgit, dotgit.Join("objects", "info", "commit-graph"))
+		defer index.Close()
+
+		// the commits with the lowest generations go in the base layer, so
+		// it has the parents of all its commits
+		base := commitgraph.NewMemoryIndex()
+		var top []plumbing.Hash
+		for i, hash := range index.Hashes() {
+			commitData, err := index.GetCommitDataByIndex(uint32(i))
+			s.NoError(err)
+			if commitData.Generation <= 2 {
+				base.Add(hash, commitData)
+			} else {
+				top = append(top, hash)
+			}
+		}
+
+		s.NotEmpty(top)
+		baseName := testEncodeIndex(s, dotgit, func(e *commitgraph.Encoder) error {
+			return e.Encode(base)
+		})
+		defer os.Remove(baseName)
+
+		baseIndex := testReadIndex(s, dotgit, baseName)
+		layer := commitgraph.NewMemoryIndexWithParent(baseIndex)
+		for _, hash := range top {
+			i, err := index.GetIndexByHash(hash)
+			s.NoError(err)
+			commitData, err := index.GetCommitDataByIndex(i)
+			s.NoError(err)
+			layer.Add(hash, commitData)
+		}
+
+		s.Len(layer.Hashes(), len(top))
+		s.Equal(len(index.Hashes()), int(layer.MaximumNumberOfHashes()))
+
+		layerName := testEncodeIndex(s, dotgit, func(e *commitgraph.Encoder) error {
+			return e.EncodeWithBase(layer, []plumbing.Hash{plumbing.NewHash("347c91919944a68e9413581a1bc15519550a3afe")})
+		})
+		defer os.Remove(layerName)
+
+		reader, err := dotgit.Open(layerName)
+		s.NoError(err)
+		layerIndex, err := commitgraph.OpenFileIndexWithParent(reader, baseIndex)
+		s.NoError(err)
+		defer layerIndex.Close()
+
+		for _, hash := range index.Hashes() {
+			i, err := index.GetIndexByHash(hash)
+			s.NoError(err)
+			expected, err := index.GetCommitDataByIndex(i)
+			s.NoError(err)
+
+			i, err = layerIndex.GetIndexByHash(hash)
+			s.NoError(err)
+			commitData, err := layerIndex.GetCommitDataByIndex(i)
+			s.NoError(err)
+			s.Equal(expected.TreeHash, commitData.TreeHash)
+			s.Equal(expected.ParentHashes, commitData.ParentHashes)
+			s.Equal(expected.Generation, commitData.Generation)
+		}
+	}
+}
+
+func testEncodeIndex(s *CommitgraphSuite, fs billy.Filesystem, encode func(*commitgraph.Encoder) error) string {
+	writer, err := util.TempFile(fs, "", "commit-graph")
+	s.NoError(err)
+	defer writer.Close()
+
+	s.NoError(encode(commitgraph.NewEncoder(writer)))
+	return writer.Name()
+}
+
+func (s *CommitgraphSuite) TestBloomFilter() {
+	filter := commitgraph.NewBloomFilter([]string{"a/b/c.txt", "d.txt"})
+	s.True(filter.Contains("a/b/c.txt"))
+	s.True(filter.Contains("a/b"))
+	s.True(filter.Contains("a"))
+	s.True(filter.Contains("d.txt"))
+	s.False(filter.Contains("a/b/d.txt"))
+	s.False(filter.Contains("e"))
+
+	empty := commitgraph.NewBloomFilter(nil)
+	s.False(empty.Contains("a"))
+
+	var paths []string
+	for i := 0; i <= 512; i++ {
+		paths = append(paths, fmt.Sprintf("file-%d", i))
+	}
+
+	large := commitgraph.NewBloomFilter(paths)
+	s.True(large.Contains("file-0"))
+	s.True(large.Contains("unchanged"))
+}
+
+func (s *CommitgraphSuite) TestEncodeBloomFilters() {
+	for _, f := range fixtures.ByTag("commit-graph") {
+		dotgit := f.DotGit()
+		index := testReadIndex(s, dotgit, dotgit.Join("objects", "info", "commit-graph"))
+		defer index.Close()
+
+		memoryIndex := commitgraph.NewMemoryIndex()
+		for i, hash := range index.Hashes() {
+			commitData, err := index.GetCommitDataByIndex(uint32(i))
+			s.NoError(err)
+			memoryIndex.Add(hash, commitData)
+			if i%2 == 0 {
+				s.NoError(memoryIndex.SetBloomFilter(hash, commitgraph.NewBloomFilter([]string{hash.String()})))
+			}
+		}
+
+		name := testEncodeIndex(s, dotgit, func(e *commitgraph.Encoder) error {
+			return e.Encode(memoryIndex)
+		})
+		defer os.Remove(name)
+
+		tmpIndex := testReadIndex(s, dotgit, name)
+		defer tmpIndex.Close()
+		testDecodeHelper(s, tmpIndex)
+
+		bfi, ok := tmpIndex.(commitgraph.BloomFilterIndex)
+		s.True(ok)
+		for i, hash := range index.Hashes() {
+			idx, err := tmpIndex.GetIndexByHash(hash)
+			s.NoError(err)
+			filter, err := bfi.GetBloomFilterByIndex(idx)
+			s.NoError(err)
+			if i%2 != 0 {
+				s.Nil(filter)
+				continue
+			}
+
+			s.NotNil(filter)
+			s.True(filter.Contains(hash.String()))
+		}
+	}
+}
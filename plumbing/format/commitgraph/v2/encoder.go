@@ -3,7 +3,6 @@ package v2
 import (
 	"crypto"
 	"io"
-	"math"
 
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/hash"
@@ -25,11 +24,25 @@ func NewEncoder(w io.Writer) *Encoder {
 
 // Encode writes an index into the commit-graph file
 func (e *Encoder) Encode(idx Index) error {
+	return e.EncodeWithBase(idx, nil)
+}
+
+// EncodeWithBase writes an index into a commit-graph file of a split
+// commit-graph, on top of the commit-graph files with the given hashes, from
+// the oldest to the newest. The commits of the index not returned by its
+// Hashes method, as the ones of the parent of a MemoryIndex, are expected in
+// those files.
+func (e *Encoder) EncodeWithBase(idx Index, base []plumbing.Hash) error {
 	// Get all the hashes in the input index
 	hashes := idx.Hashes()
+	// The positions of the commits follow the ones of the base files
+	offset := idx.MaximumNumberOfHashes() - uint32(len(hashes))
 
 	// Sort the inout and prepare helper structures we'll need for encoding
-	hashToIndex, fanout, extraEdgesCount, generationV2OverflowCount := e.prepare(idx, hashes)
+	hashToIndex, fanout, extraEdgesCount, generationV2OverflowCount, err := e.prepare(idx, hashes)
+	if err != nil {
+		return err
+	}
 
 	chunkSignatures := [][]byte{OIDFanoutChunk.Signature(), OIDLookupChunk.Signature(), CommitDataChunk.Signature()}
 	chunkSizes := []uint64{szUint32 * lenFanout, uint64(len(hashes)) * hash.Size, uint64(len(hashes)) * (hash.Size + szCommitData)}
@@ -45,8 +58,27 @@ func (e *Encoder) Encode(idx Index) error {
 			chunkSizes = append(chunkSizes, uint64(generationV2OverflowCount)*szUint64)
 		}
 	}
+	filters, settings, err := e.bloomFilters(idx, hashes)
+	if err != nil {
+		return err
+	}
+	if settings != nil {
+		size := uint64(szBloomFilterHeader)
+		for _, filter := range filters {
+			if filter != nil {
+				size += uint64(len(filter.data))
+			}
+		}
+
+		chunkSignatures = append(chunkSignatures, BloomFilterIndexChunk.Signature(), BloomFilterDataChunk.Signature())
+		chunkSizes = append(chunkSizes, uint64(len(hashes))*szUint32, size)
+	}
+	if len(base) > 0 {
+		chunkSignatures = append(chunkSignatures, BaseGraphsListChunk.Signature())
+		chunkSizes = append(chunkSizes, uint64(len(base))*hash.Size)
+	}
 
-	if err := e.encodeFileHeader(len(chunkSignatures)); err != nil {
+	if err := e.encodeFileHeader(len(chunkSignatures), len(base)); err != nil {
 		return err
 	}
 	if err := e.encodeChunkHeaders(chunkSignatures, chunkSizes); err != nil {
@@ -59,7 +91,7 @@ func (e *Encoder) Encode(idx Index) error {
 		return err
 	}
 
-	extraEdges, generationV2Data, err := e.encodeCommitData(hashes, hashToIndex, idx)
+	extraEdges, generationV2Data, err := e.encodeCommitData(hashes, hashToIndex, offset, idx)
 	if err != nil {
 		return err
 	}
@@ -75,11 +107,19 @@ func (e *Encoder) Encode(idx Index) error {
 			return err
 		}
 	}
+	if settings != nil {
+		if err = e.encodeBloomFilters(filters, settings); err != nil {
+			return err
+		}
+	}
+	if err = e.encodeOidLookup(base); err != nil {
+		return err
+	}
 
 	return e.encodeChecksum()
 }
 
-func (e *Encoder) prepare(idx Index, hashes []plumbing.Hash) (hashToIndex map[plumbing.Hash]uint32, fanout []uint32, extraEdgesCount uint32, generationV2OverflowCount uint32) {
+func (e *Encoder) prepare(idx Index, hashes []plumbing.Hash) (hashToIndex map[plumbing.Hash]uint32, fanout []uint32, extraEdgesCount uint32, generationV2OverflowCount uint32, err error) {
 	// Sort the hashes and build our index
 	plumbing.HashesSort(hashes)
 	hashToIndex = make(map[plumbing.Hash]uint32)
@@ -97,12 +137,15 @@ func (e *Encoder) prepare(idx Index, hashes []plumbing.Hash) (hashToIndex map[pl
 	hasGenerationV2 := idx.HasGenerationV2()
 
 	// Find out if we will need extra edge table
-	for i := 0; i < len(hashes); i++ {
-		v, _ := idx.GetCommitDataByIndex(uint32(i))
+	for _, hash := range hashes {
+		v, err := getCommitDataByHash(idx, hash)
+		if err != nil {
+			return nil, nil, 0, 0, err
+		}
 		if len(v.ParentHashes) > 2 {
 			extraEdgesCount += uint32(len(v.ParentHashes) - 1)
 		}
-		if hasGenerationV2 && v.GenerationV2Data() > math.MaxUint32 {
+		if hasGenerationV2 && v.GenerationV2Data() >= generationV2Overflow {
 			generationV2OverflowCount++
 		}
 	}
@@ -110,13 +153,22 @@ func (e *Encoder) prepare(idx Index, hashes []plumbing.Hash) (hashToIndex map[pl
 	return
 }
 
-func (e *Encoder) encodeFileHeader(chunkCount int) (err error) {
+func getCommitDataByHash(idx Index, hash plumbing.Hash) (*CommitData, error) {
+	i, err := idx.GetIndexByHash(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return idx.GetCommitDataByIndex(i)
+}
+
+func (e *Encoder) encodeFileHeader(chunkCount int, baseCount int) (err error) {
 	if _, err = e.Write(commitFileSignature); err == nil {
 		version := byte(1)
 		if hash.CryptoType == crypto.SHA256 {
 			version = byte(2)
 		}
-		_, err = e.Write([]byte{1, version, byte(chunkCount), 0})
+		_, err = e.Write([]byte{1, version, byte(chunkCount), byte(baseCount)})
 	}
 	return
 }
@@ -157,33 +209,49 @@ func (e *Encoder) encodeOidLookup(hashes []plumbing.Hash) (err error) {
 	return
 }
 
-func (e *Encoder) encodeCommitData(hashes []plumbing.Hash, hashToIndex map[plumbing.Hash]uint32, idx Index) (extraEdges []uint32, generationV2Data []uint64, err error) {
+func (e *Encoder) encodeCommitData(hashes []plumbing.Hash, hashToIndex map[plumbing.Hash]uint32, offset uint32, idx Index) (extraEdges []uint32, generationV2Data []uint64, err error) {
 	if idx.HasGenerationV2() {
 		generationV2Data = make([]uint64, 0, len(hashes))
 	}
+
+	// Parents out of the file are looked up in the base files
+	parentIndex := func(h plumbing.Hash) (uint32, error) {
+		if i, ok := hashToIndex[h]; ok {
+			return offset + i, nil
+		}
+		return idx.GetIndexByHash(h)
+	}
+
 	for _, hash := range hashes {
-		origIndex, _ := idx.GetIndexByHash(hash)
-		commitData, _ := idx.GetCommitDataByIndex(origIndex)
+		var commitData *CommitData
+		if commitData, err = getCommitDataByHash(idx, hash); err != nil {
+			return
+		}
 		if _, err = e.Write(commitData.TreeHash[:]); err != nil {
 			return
 		}
 
+		parents := make([]uint32, len(commitData.ParentHashes))
+		for i, parentHash := range commitData.ParentHashes {
+			if parents[i], err = parentIndex(parentHash); err != nil {
+				return
+			}
+		}
+
 		var parent1, parent2 uint32
-		if len(commitData.ParentHashes) == 0 {
+		if len(parents) == 0 {
 			parent1 = parentNone
 			parent2 = parentNone
-		} else if len(commitData.ParentHashes) == 1 {
-			parent1 = hashToIndex[commitData.ParentHashes[0]]
+		} else if len(parents) == 1 {
+			parent1 = parents[0]
 			parent2 = parentNone
-		} else if len(commitData.ParentHashes) == 2 {
-			parent1 = hashToIndex[commitData.ParentHashes[0]]
-			parent2 = hashToIndex[commitData.ParentHashes[1]]
-		} else if len(commitData.ParentHashes) > 2 {
-			parent1 = hashToIndex[commitData.ParentHashes[0]]
+		} else if len(parents) == 2 {
+			parent1 = parents[0]
+			parent2 = parents[1]
+		} else if len(parents) > 2 {
+			parent1 = parents[0]
 			parent2 = uint32(len(extraEdges)) | parentOctopusUsed
-			for _, parentHash := range commitData.ParentHashes[1:] {
-				extraEdges = append(extraEdges, hashToIndex[parentHash])
-			}
+			extraEdges = append(extraEdges, parents[1:]...)
 			extraEdges[len(extraEdges)-1] |= parentLast
 		}
 
@@ -218,7 +286,7 @@ func (e *Encoder) encodeExtraEdges(extraEdges []uint32) (err error) {
 func (e *Encoder) encodeGenerationV2Data(generationV2Data []uint64) (overflows []uint64, err error) {
 	head := 0
 	for _, data := range generationV2Data {
-		if data >= 0x80000000 {
+		if data >= generationV2Overflow {
 			// overflow
 			if err = binary.WriteUint32(e, uint32(head)|0x80000000); err != nil {
 				return nil, err
@@ -244,6 +312,69 @@ func (e *Encoder) encodeGenerationV2Overflow(overflows []uint64) (err error) {
 	return
 }
 
+// bloomFilters returns the changed-path Bloom filters of the given commits
+// and their settings, if any of them has one. The filters with settings other
+// than the ones of the first filter are left out, as the commits without one.
+func (e *Encoder) bloomFilters(idx Index, hashes []plumbing.Hash) (filters []*BloomFilter, settings *BloomFilter, err error) {
+	bfi, ok := idx.(BloomFilterIndex)
+	if !ok {
+		return nil, nil, nil
+	}
+
+	filters = make([]*BloomFilter, len(hashes))
+	for i, hash := range hashes {
+		var index uint32
+		if index, err = idx.GetIndexByHash(hash); err != nil {
+			return nil, nil, err
+		}
+
+		var filter *BloomFilter
+		if filter, err = bfi.GetBloomFilterByIndex(index); err != nil {
+			return nil, nil, err
+		}
+		if filter == nil {
+			continue
+		}
+
+		if settings == nil {
+			settings = filter
+		}
+		if filter.sameSettings(settings) {
+			filters[i] = filter
+		}
+	}
+
+	return filters, settings, nil
+}
+
+func (e *Encoder) encodeBloomFilters(filters []*BloomFilter, settings *BloomFilter) (err error) {
+	var end uint32
+	for _, filter := range filters {
+		if filter != nil {
+			end += uint32(len(filter.data))
+		}
+		if err = binary.WriteUint32(e, end); err != nil {
+			return
+		}
+	}
+
+	for _, v := range []uint32{settings.version, settings.numHashes, settings.bitsPerEntry} {
+		if err = binary.WriteUint32(e, v); err != nil {
+			return
+		}
+	}
+
+	for _, filter := range filters {
+		if filter == nil {
+			continue
+		}
+		if _, err = e.Write(filter.data); err != nil {
+			return
+		}
+	}
+	return
+}
+
 func (e *Encoder) encodeChecksum() error {
 	_, err := e.Write(e.hash.Sum(nil)[:hash.Size])
 	return err
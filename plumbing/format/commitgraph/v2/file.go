@@ -42,6 +42,10 @@ const (
 	szCommitData = 2*szUint32 + szUint64
 
 	lenFanout = 256
+
+	// generationV2Overflow is the flag of the corrected commit date offsets
+	// stored in the generation data overflow chunk.
+	generationV2Overflow = 0x80000000
 )
 
 type fileIndex struct {
@@ -51,6 +55,9 @@ type fileIndex struct {
 	parent                Index
 	hasGenerationV2       bool
 	minimumNumberOfHashes uint32
+	// bloomFilter holds the settings of the changed-path Bloom filters of the
+	// file, if it has them.
+	bloomFilter *BloomFilter
 }
 
 // ReaderAtCloser is an interface that combines io.ReaderAt and io.Closer.
@@ -92,6 +99,10 @@ func OpenFileIndexWithParent(reader ReaderAtCloser, parent Index) (Index, error)
 		fi.minimumNumberOfHashes = fi.parent.MaximumNumberOfHashes()
 	}
 
+	if err := fi.readBloomFilterHeader(); err != nil {
+		return nil, err
+	}
+
 	return fi, nil
 }
 
@@ -184,6 +195,25 @@ func (fi *fileIndex) readFanout() error {
 	return nil
 }
 
+func (fi *fileIndex) readBloomFilterHeader() error {
+	if fi.offsets[BloomFilterIndexChunk] <= 0 || fi.offsets[BloomFilterDataChunk] <= 0 {
+		return nil
+	}
+
+	header := io.NewSectionReader(fi.reader, fi.offsets[BloomFilterDataChunk], szBloomFilterHeader)
+	var settings [3]uint32
+	for i := range settings {
+		v, err := binary.ReadUint32(header)
+		if err != nil {
+			return err
+		}
+		settings[i] = v
+	}
+
+	fi.bloomFilter = &BloomFilter{version: settings[0], numHashes: settings[1], bitsPerEntry: settings[2]}
+	return nil
+}
+
 // GetIndexByHash looks up the provided hash in the commit-graph fanout and returns the index of the commit data for the given hash.
 func (fi *fileIndex) GetIndexByHash(h plumbing.Hash) (uint32, error) {
 	var oid plumbing.Hash
@@ -410,3 +440,54 @@ func (fi *fileIndex) HasGenerationV2() bool {
 func (fi *fileIndex) MaximumNumberOfHashes() uint32 {
 	return fi.minimumNumberOfHashes + fi.fanout[0xff]
 }
+
+// GetBloomFilterByIndex returns the changed-path Bloom filter of the commit
+// with the given index in the commit-graph, or nil if it has none.
+func (fi *fileIndex) GetBloomFilterByIndex(idx uint32) (*BloomFilter, error) {
+	if idx < fi.minimumNumberOfHashes {
+		if parent, ok := fi.parent.(BloomFilterIndex); ok {
+			return parent.GetBloomFilterByIndex(idx)
+		}
+		return nil, nil
+	}
+	idx -= fi.minimumNumberOfHashes
+	if idx >= fi.fanout[0xff] {
+		return nil, plumbing.ErrObjectNotFound
+	}
+
+	if fi.bloomFilter == nil {
+		return nil, nil
+	}
+
+	// The index chunk has the offsets where the filters end in the data chunk
+	var start uint32
+	buf := make([]byte, 2*szUint32)
+	if idx == 0 {
+		if _, err := fi.reader.ReadAt(buf[szUint32:], fi.offsets[BloomFilterIndexChunk]); err != nil {
+			return nil, err
+		}
+	} else {
+		offset := fi.offsets[BloomFilterIndexChunk] + int64(idx-1)*szUint32
+		if _, err := fi.reader.ReadAt(buf, offset); err != nil {
+			return nil, err
+		}
+		start = encbin.BigEndian.Uint32(buf)
+	}
+
+	end := encbin.BigEndian.Uint32(buf[szUint32:])
+	if end < start {
+		return nil, ErrMalformedCommitGraphFile
+	}
+	if end == start {
+		return nil, nil
+	}
+
+	filter := *fi.bloomFilter
+	filter.data = make([]byte, end-start)
+	offset := fi.offsets[BloomFilterDataChunk] + szBloomFilterHeader + int64(start)
+	if _, err := fi.reader.ReadAt(filter.data, offset); err != nil {
+		return nil, err
+	}
+
+	return &filter, nil
+}
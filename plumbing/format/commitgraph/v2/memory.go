@@ -12,11 +12,13 @@ type MemoryIndex struct {
 	commitData      []commitData
 	indexMap        map[plumbing.Hash]uint32
 	hasGenerationV2 bool
+	parent          Index
 }
 
 type commitData struct {
 	Hash plumbing.Hash
 	*CommitData
+	bloomFilter *BloomFilter
 }
 
 // NewMemoryIndex creates in-memory commit graph representation
@@ -27,11 +29,26 @@ func NewMemoryIndex() *MemoryIndex {
 	}
 }
 
+// NewMemoryIndexWithParent creates in-memory commit graph representation
+// on top of the given parent index, as a layer of a split commit graph. The
+// commits of the parent index come first, the parents of the commits added
+// may be in it. The parent index isn't closed with the memory index.
+func NewMemoryIndexWithParent(parent Index) *MemoryIndex {
+	mi := NewMemoryIndex()
+	mi.parent = parent
+	mi.hasGenerationV2 = parent.HasGenerationV2()
+	return mi
+}
+
 // GetIndexByHash gets the index in the commit graph from commit hash, if available
 func (mi *MemoryIndex) GetIndexByHash(h plumbing.Hash) (uint32, error) {
 	i, ok := mi.indexMap[h]
 	if ok {
-		return i, nil
+		return i + mi.minimumNumberOfHashes(), nil
+	}
+
+	if mi.parent != nil {
+		return mi.parent.GetIndexByHash(h)
 	}
 
 	return 0, plumbing.ErrObjectNotFound
@@ -39,6 +56,11 @@ func (mi *MemoryIndex) GetIndexByHash(h plumbing.Hash) (uint32, error) {
 
 // GetHashByIndex gets the hash given an index in the commit graph
 func (mi *MemoryIndex) GetHashByIndex(i uint32) (plumbing.Hash, error) {
+	if i < mi.minimumNumberOfHashes() {
+		return mi.parent.GetHashByIndex(i)
+	}
+
+	i -= mi.minimumNumberOfHashes()
 	if i >= uint32(len(mi.commitData)) {
 		return plumbing.ZeroHash, plumbing.ErrObjectNotFound
 	}
@@ -49,6 +71,11 @@ func (mi *MemoryIndex) GetHashByIndex(i uint32) (plumbing.Hash, error) {
 // GetCommitDataByIndex gets the commit node from the commit graph using index
 // obtained from child node, if available
 func (mi *MemoryIndex) GetCommitDataByIndex(i uint32) (*CommitData, error) {
+	if i < mi.minimumNumberOfHashes() {
+		return mi.parent.GetCommitDataByIndex(i)
+	}
+
+	i -= mi.minimumNumberOfHashes()
 	if i >= uint32(len(mi.commitData)) {
 		return nil, plumbing.ErrObjectNotFound
 	}
@@ -70,7 +97,8 @@ func (mi *MemoryIndex) GetCommitDataByIndex(i uint32) (*CommitData, error) {
 	return commitData.CommitData, nil
 }
 
-// Hashes returns all the hashes that are available in the index
+// Hashes returns all the hashes that are available in the index, without the
+// ones of its parent index
 func (mi *MemoryIndex) Hashes() []plumbing.Hash {
 	hashes := make([]plumbing.Hash, 0, len(mi.indexMap))
 	for k := range mi.indexMap {
@@ -93,6 +121,36 @@ func (mi *MemoryIndex) Add(hash plumbing.Hash, data *CommitData) {
 	mi.hasGenerationV2 = mi.hasGenerationV2 && data.GenerationV2 != 0
 }
 
+// SetBloomFilter sets the changed-path Bloom filter of a commit of the memory
+// index, written with it by the encoder
+func (mi *MemoryIndex) SetBloomFilter(hash plumbing.Hash, filter *BloomFilter) error {
+	i, ok := mi.indexMap[hash]
+	if !ok {
+		return plumbing.ErrObjectNotFound
+	}
+
+	mi.commitData[i].bloomFilter = filter
+	return nil
+}
+
+// GetBloomFilterByIndex gets the changed-path Bloom filter of the commit with
+// the given index, or nil if it has none
+func (mi *MemoryIndex) GetBloomFilterByIndex(i uint32) (*BloomFilter, error) {
+	if i < mi.minimumNumberOfHashes() {
+		if parent, ok := mi.parent.(BloomFilterIndex); ok {
+			return parent.GetBloomFilterByIndex(i)
+		}
+		return nil, nil
+	}
+
+	i -= mi.minimumNumberOfHashes()
+	if i >= uint32(len(mi.commitData)) {
+		return nil, plumbing.ErrObjectNotFound
+	}
+
+	return mi.commitData[i].bloomFilter, nil
+}
+
 func (mi *MemoryIndex) HasGenerationV2() bool {
 	return mi.hasGenerationV2
 }
@@ -103,5 +161,14 @@ func (mi *MemoryIndex) Close() error {
 }
 
 func (mi *MemoryIndex) MaximumNumberOfHashes() uint32 {
-	return uint32(len(mi.indexMap))
+	return mi.minimumNumberOfHashes() + uint32(len(mi.indexMap))
+}
+
+// minimumNumberOfHashes returns the number of hashes of the parent index.
+func (mi *MemoryIndex) minimumNumberOfHashes() uint32 {
+	if mi.parent == nil {
+		return 0
+	}
+
+	return mi.parent.MaximumNumberOfHashes()
 }
@@ -1,5 +1,7 @@
 package gitattributes
 
+import "slices"
+
 // Matcher defines a global multi-pattern matcher for gitattributes patterns
 type Matcher interface {
 	// Match matches patterns in the order of priorities.
@@ -38,11 +40,15 @@ func (m *matcher) init() {
 // the attributes associated with the path.
 //
 // Specific attributes can be specified otherwise all attributes are returned.
+// As in git, the attributes of the patterns with higher priority override the
+// ones with lower priority, and the attributes later in a line override the
+// earlier ones, including the ones expanded from macros.
 //
 // Matched is true if any path was matched to a rule, even if the results map
 // is empty.
 func (m *matcher) Match(path []string, attributes []string) (results map[string]Attribute, matched bool) {
 	results = make(map[string]Attribute, len(attributes))
+	filled := make(map[string]bool)
 
 	n := len(m.stack)
 	for i := n - 1; i >= 0; i-- {
@@ -57,22 +63,28 @@ func (m *matcher) Match(path []string, attributes []string) (results map[string]
 
 		if match := pattern.Match(path); match {
 			matched = true
-			for _, attr := range m.stack[i].Attributes {
-				if attr.IsSet() {
-					m.expandMacro(attr.Name(), results)
-				}
-				results[attr.Name()] = attr
-			}
+			m.fill(m.stack[i].Attributes, attributes, results, filled)
 		}
 	}
 	return
 }
 
-func (m *matcher) expandMacro(name string, results map[string]Attribute) bool {
-	if macro, ok := m.macros[name]; ok {
-		for _, attr := range macro.Attributes {
+// fill adds to results the attributes not filled yet, in reverse order, and
+// the attributes of the macros being set.
+func (m *matcher) fill(attrs []Attribute, wanted []string, results map[string]Attribute, filled map[string]bool) {
+	for i := len(attrs) - 1; i >= 0; i-- {
+		attr := attrs[i]
+		if filled[attr.Name()] {
+			continue
+		}
+
+		filled[attr.Name()] = true
+		if len(wanted) == 0 || slices.Contains(wanted, attr.Name()) {
 			results[attr.Name()] = attr
 		}
+
+		if macro, ok := m.macros[attr.Name()]; ok && attr.IsSet() {
+			m.fill(macro.Attributes, wanted, results, filled)
+		}
 	}
-	return false
 }
@@ -25,3 +25,28 @@ func (s *MatcherSuite) TestMatcher_Match() {
 	s.True(results["text"].IsSet())
 	s.Equal("crlf", results["eol"].Value())
 }
+
+func (s *MatcherSuite) TestMatcher_MatchPriority() {
+	lines := []string{
+		"[attr]binary -diff -merge -text",
+		"* text=auto eol=lf",
+		"*.png binary",
+		"*.txt -text text",
+	}
+
+	ma, err := ReadAttributes(strings.NewReader(strings.Join(lines, "\n")), nil, true)
+	s.NoError(err)
+
+	m := NewMatcher(ma)
+	results, matched := m.Match([]string{"image.png"}, []string{"text", "eol"})
+	s.True(matched)
+	s.Len(results, 2)
+	s.True(results["text"].IsUnset())
+	s.Equal("lf", results["eol"].Value())
+
+	results, _ = m.Match([]string{"doc.txt"}, []string{"text"})
+	s.True(results["text"].IsSet())
+
+	results, _ = m.Match([]string{"main.go"}, []string{"text"})
+	s.Equal("auto", results["text"].Value())
+}
@@ -2,6 +2,7 @@ package index
 
 import (
 	"bytes"
+	"encoding/binary"
 	"strings"
 	"testing"
 	"time"
@@ -56,6 +57,30 @@ func TestEncode(t *testing.T) {
 
 }
 
+func TestEncodeMergedStage(t *testing.T) {
+	idx := &Index{
+		Version: 2,
+		Entries: []*Entry{{
+			Name:  "foo",
+			Stage: Merged,
+			Hash:  plumbing.NewHash("e25b29c8946e0e192fae2edc1dabf7be71e8ecf3"),
+		}},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, NewEncoder(buf).Encode(idx))
+
+	// The stage is stored in the bits 12 and 13 of the flags, after the
+	// header and the first 60 bytes of the entry, and it's 0 if merged.
+	flags := binary.BigEndian.Uint16(buf.Bytes()[12+60:])
+	assert.Zero(t, flags>>12&0x3)
+
+	output := &Index{}
+	require.NoError(t, NewDecoder(buf).Decode(output))
+	require.Len(t, output.Entries, 1)
+	assert.Equal(t, Merged, output.Entries[0].Stage)
+}
+
 func TestEncodeV4(t *testing.T) {
 	idx := &Index{
 		Version: 4,
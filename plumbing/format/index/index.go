@@ -29,8 +29,9 @@ var (
 type Stage int
 
 const (
-	// Merged is the default stage, fully merged
-	Merged Stage = 1
+	// Merged is the default stage, fully merged, stored as 0 in the index
+	// as git does
+	Merged Stage = 0
 	// AncestorMode is the base revision
 	AncestorMode Stage = 1
 	// OurMode is the first tree revision, ours
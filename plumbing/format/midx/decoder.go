@@ -0,0 +1,216 @@
+package midx
+
+import (
+	"bytes"
+	"crypto"
+	encbin "encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/hash"
+)
+
+var (
+	// ErrUnsupportedVersion is returned by Decode when the multi-pack-index
+	// version is not supported.
+	ErrUnsupportedVersion = errors.New("unsupported version")
+	// ErrUnsupportedHash is returned by Decode when the hash function of the
+	// multi-pack-index isn't the one of the repository.
+	ErrUnsupportedHash = errors.New("unsupported hash algorithm")
+	// ErrMalformedMultiPackIndex is returned by Decode when the
+	// multi-pack-index is corrupted.
+	ErrMalformedMultiPackIndex = errors.New("malformed multi-pack-index")
+)
+
+var (
+	signature = []byte{'M', 'I', 'D', 'X'}
+
+	packNamesChunk    = []byte{'P', 'N', 'A', 'M'}
+	oidFanoutChunk    = []byte{'O', 'I', 'D', 'F'}
+	oidLookupChunk    = []byte{'O', 'I', 'D', 'L'}
+	objectOffsetChunk = []byte{'O', 'O', 'F', 'F'}
+	largeOffsetChunk  = []byte{'L', 'O', 'F', 'F'}
+)
+
+const (
+	// VersionSupported is the only multi-pack-index version supported.
+	VersionSupported = 1
+
+	szHeader     = 12
+	szChunkEntry = 12
+	szOffset     = 8
+
+	largeOffsetFlag = uint32(0x80000000)
+)
+
+// Decoder reads and decodes multi-pack-index files from an input stream.
+type Decoder struct {
+	r io.Reader
+}
+
+// NewDecoder builds a new multi-pack-index stream decoder, that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r}
+}
+
+// Decode reads from the stream and decodes the content into the
+// MultiPackIndex struct.
+func (d *Decoder) Decode(idx *MultiPackIndex) error {
+	data, err := io.ReadAll(d.r)
+	if err != nil {
+		return err
+	}
+
+	if len(data) < szHeader+hash.Size || !bytes.Equal(data[:4], signature) {
+		return ErrMalformedMultiPackIndex
+	}
+
+	h := hash.New(hash.CryptoType)
+	h.Write(data[:len(data)-hash.Size])
+	if !bytes.Equal(h.Sum(nil), data[len(data)-hash.Size:]) {
+		return ErrMalformedMultiPackIndex
+	}
+
+	if data[4] != VersionSupported {
+		return ErrUnsupportedVersion
+	}
+
+	if !(hash.CryptoType == crypto.SHA1 && data[5] == 1) &&
+		!(hash.CryptoType == crypto.SHA256 && data[5] == 2) {
+		return ErrUnsupportedHash
+	}
+
+	if data[7] != 0 {
+		// Incremental multi-pack-indexes aren't supported.
+		return ErrUnsupportedVersion
+	}
+
+	chunks, err := readChunks(data, int(data[6]))
+	if err != nil {
+		return err
+	}
+
+	packs := int(encbin.BigEndian.Uint32(data[8:12]))
+	flow := []func(*MultiPackIndex, map[string][]byte) error{
+		readFanout,
+		readHashes,
+		readOffsets,
+	}
+
+	if err := readPackNames(idx, chunks, packs); err != nil {
+		return err
+	}
+
+	for _, f := range flow {
+		if err := f(idx, chunks); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readChunks returns the content of the chunks of the file, by id.
+func readChunks(data []byte, count int) (map[string][]byte, error) {
+	end := uint64(len(data) - hash.Size)
+	table := szHeader + (count+1)*szChunkEntry
+	if uint64(table) > end {
+		return nil, ErrMalformedMultiPackIndex
+	}
+
+	chunks := make(map[string][]byte, count)
+	for i := 0; i < count; i++ {
+		entry := data[szHeader+i*szChunkEntry:]
+		next := entry[szChunkEntry:]
+		start := encbin.BigEndian.Uint64(entry[4:12])
+		stop := encbin.BigEndian.Uint64(next[4:12])
+		if start < uint64(table) || start > stop || stop > end {
+			return nil, ErrMalformedMultiPackIndex
+		}
+
+		chunks[string(entry[:4])] = data[start:stop]
+	}
+
+	return chunks, nil
+}
+
+func readPackNames(idx *MultiPackIndex, chunks map[string][]byte, packs int) error {
+	names := bytes.Split(chunks[string(packNamesChunk)], []byte{0})
+	idx.PackNames = make([]string, 0, packs)
+	for _, name := range names {
+		// The chunk is padded with zeros.
+		if len(name) == 0 {
+			continue
+		}
+
+		idx.PackNames = append(idx.PackNames, string(name))
+	}
+
+	if len(idx.PackNames) != packs {
+		return ErrMalformedMultiPackIndex
+	}
+
+	return nil
+}
+
+func readFanout(idx *MultiPackIndex, chunks map[string][]byte) error {
+	data := chunks[string(oidFanoutChunk)]
+	if len(data) != fanout*4 {
+		return ErrMalformedMultiPackIndex
+	}
+
+	for i := range idx.Fanout {
+		idx.Fanout[i] = encbin.BigEndian.Uint32(data[i*4:])
+	}
+
+	return nil
+}
+
+func readHashes(idx *MultiPackIndex, chunks map[string][]byte) error {
+	count := int(idx.Fanout[fanout-1])
+	data := chunks[string(oidLookupChunk)]
+	if len(data) != count*hash.Size {
+		return ErrMalformedMultiPackIndex
+	}
+
+	idx.Hashes = make([]plumbing.Hash, count)
+	for i := range idx.Hashes {
+		copy(idx.Hashes[i][:], data[i*hash.Size:])
+	}
+
+	return nil
+}
+
+func readOffsets(idx *MultiPackIndex, chunks map[string][]byte) error {
+	count := len(idx.Hashes)
+	data := chunks[string(objectOffsetChunk)]
+	if len(data) != count*szOffset {
+		return ErrMalformedMultiPackIndex
+	}
+
+	large := chunks[string(largeOffsetChunk)]
+	idx.PackIDs = make([]uint32, count)
+	idx.Offsets = make([]uint64, count)
+	for i := 0; i < count; i++ {
+		idx.PackIDs[i] = encbin.BigEndian.Uint32(data[i*szOffset:])
+		if int(idx.PackIDs[i]) >= len(idx.PackNames) {
+			return ErrMalformedMultiPackIndex
+		}
+
+		offset := encbin.BigEndian.Uint32(data[i*szOffset+4:])
+		if offset&largeOffsetFlag == 0 {
+			idx.Offsets[i] = uint64(offset)
+			continue
+		}
+
+		pos := int(offset&^largeOffsetFlag) * 8
+		if pos+8 > len(large) {
+			return ErrMalformedMultiPackIndex
+		}
+
+		idx.Offsets[i] = encbin.BigEndian.Uint64(large[pos:])
+	}
+
+	return nil
+}
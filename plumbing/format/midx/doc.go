@@ -0,0 +1,52 @@
+// Package midx implements encoding and decoding of multi-pack-index files.
+//
+// A multi-pack-index indexes the objects of several packs of a repository,
+// so an object is looked up once instead of in the index of each pack.
+//
+// == multi-pack-index files have the following format:
+//
+//   - A 12-byte header consisting of
+//
+//     4-byte signature: The signature is: {'M', 'I', 'D', 'X'}
+//
+//     1-byte version number: Only version 1 is supported.
+//
+//     1-byte object id version: 1 for SHA-1, 2 for SHA-256.
+//
+//     1-byte number of chunks (C).
+//
+//     1-byte number of base multi-pack-index files: Always 0.
+//
+//     4-byte number of packs (P), in network byte order.
+//
+//   - The chunk lookup table, of (C + 1) 12-byte entries, each one a 4-byte
+//     chunk id and the 8-byte offset of the chunk in the file. The last entry
+//     has a zero id and the offset of the end of the last chunk.
+//
+//   - The chunks:
+//
+//     Pack names (ID: {'P', 'N', 'A', 'M'}): The null-terminated names of
+//     the indexes of the packs, "pack-<hash>.idx", sorted, padded with zeros
+//     to a multiple of 4 bytes. The packs are referenced by their position.
+//
+//     OID fanout (ID: {'O', 'I', 'D', 'F'}) (256 * 4 bytes): The n-th entry
+//     is the number of objects whose first byte of the hash is lower than or
+//     equal to n.
+//
+//     OID lookup (ID: {'O', 'I', 'D', 'L'}) (N * H bytes): The hashes of the
+//     objects, sorted.
+//
+//     Object offsets (ID: {'O', 'O', 'F', 'F'}) (N * 8 bytes): For each
+//     object, the 4-byte position of its pack and the 4-byte offset of the
+//     object in the pack. If the most significant bit of the offset is set,
+//     the other bits are the position of the offset in the large offsets
+//     chunk.
+//
+//     [Optional] Large offsets (ID: {'L', 'O', 'F', 'F'}): 8-byte offsets
+//     of the objects at offsets not fitting in 31 bits.
+//
+//   - The trailer, the checksum of all the above.
+//
+// Source:
+// https://github.com/git/git/blob/master/Documentation/gitformat-pack.txt
+package midx
@@ -0,0 +1,147 @@
+package midx
+
+import (
+	"crypto"
+	"io"
+
+	"github.com/go-git/go-git/v5/plumbing/hash"
+	"github.com/go-git/go-git/v5/utils/binary"
+)
+
+// chunkAlignment is the alignment of the pack names chunk.
+const chunkAlignment = 4
+
+// Encoder writes MultiPackIndex structs to an output stream.
+type Encoder struct {
+	io.Writer
+	hash hash.Hash
+}
+
+// NewEncoder returns a new stream encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	h := hash.New(hash.CryptoType)
+	mw := io.MultiWriter(w, h)
+	return &Encoder{mw, h}
+}
+
+// Encode encodes a MultiPackIndex to the encoder writer.
+func (e *Encoder) Encode(idx *MultiPackIndex) error {
+	var names []byte
+	for _, name := range idx.PackNames {
+		names = append(names, name...)
+		names = append(names, 0)
+	}
+
+	for len(names)%chunkAlignment != 0 {
+		names = append(names, 0)
+	}
+
+	var large []uint64
+	offsets := make([]byte, 0, len(idx.Offsets)*szOffset)
+	for i, offset := range idx.Offsets {
+		offsets = appendUint32(offsets, idx.PackIDs[i])
+		if offset < uint64(largeOffsetFlag) {
+			offsets = appendUint32(offsets, uint32(offset))
+			continue
+		}
+
+		offsets = appendUint32(offsets, largeOffsetFlag|uint32(len(large)))
+		large = append(large, offset)
+	}
+
+	chunkIDs := [][]byte{packNamesChunk, oidFanoutChunk, oidLookupChunk, objectOffsetChunk}
+	chunkSizes := []uint64{
+		uint64(len(names)),
+		fanout * 4,
+		uint64(len(idx.Hashes) * hash.Size),
+		uint64(len(offsets)),
+	}
+
+	if len(large) > 0 {
+		chunkIDs = append(chunkIDs, largeOffsetChunk)
+		chunkSizes = append(chunkSizes, uint64(len(large)*8))
+	}
+
+	if err := e.encodeHeader(len(chunkIDs), len(idx.PackNames)); err != nil {
+		return err
+	}
+
+	if err := e.encodeChunkHeaders(chunkIDs, chunkSizes); err != nil {
+		return err
+	}
+
+	if _, err := e.Write(names); err != nil {
+		return err
+	}
+
+	for _, c := range idx.Fanout {
+		if err := binary.WriteUint32(e, c); err != nil {
+			return err
+		}
+	}
+
+	for _, h := range idx.Hashes {
+		if _, err := e.Write(h[:]); err != nil {
+			return err
+		}
+	}
+
+	if _, err := e.Write(offsets); err != nil {
+		return err
+	}
+
+	for _, offset := range large {
+		if err := binary.WriteUint64(e, offset); err != nil {
+			return err
+		}
+	}
+
+	return e.encodeChecksum()
+}
+
+func (e *Encoder) encodeHeader(chunks, packs int) error {
+	version := byte(1)
+	if hash.CryptoType == crypto.SHA256 {
+		version = byte(2)
+	}
+
+	if _, err := e.Write(signature); err != nil {
+		return err
+	}
+
+	if _, err := e.Write([]byte{VersionSupported, version, byte(chunks), 0}); err != nil {
+		return err
+	}
+
+	return binary.WriteUint32(e, uint32(packs))
+}
+
+func (e *Encoder) encodeChunkHeaders(ids [][]byte, sizes []uint64) error {
+	offset := uint64(szHeader + (len(ids)+1)*szChunkEntry)
+	for i, id := range ids {
+		if _, err := e.Write(id); err != nil {
+			return err
+		}
+
+		if err := binary.WriteUint64(e, offset); err != nil {
+			return err
+		}
+
+		offset += sizes[i]
+	}
+
+	if _, err := e.Write([]byte{0, 0, 0, 0}); err != nil {
+		return err
+	}
+
+	return binary.WriteUint64(e, offset)
+}
+
+func (e *Encoder) encodeChecksum() error {
+	_, err := e.Writer.Write(e.hash.Sum(nil))
+	return err
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
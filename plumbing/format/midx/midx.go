@@ -0,0 +1,249 @@
+package midx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/idxfile"
+)
+
+const (
+	fanout = 256
+
+	packPrefix = "pack-"
+	idxExt     = ".idx"
+)
+
+// MultiPackIndex is a multi-pack-index, indexing the objects of several packs
+// of a repository.
+type MultiPackIndex struct {
+	// PackNames are the names of the indexes of the packs, "pack-<hash>.idx",
+	// sorted. The packs are referenced by their position in it.
+	PackNames []string
+	// Fanout holds, for each byte, the number of objects whose first byte of
+	// the hash is lower than or equal to it.
+	Fanout [fanout]uint32
+	// Hashes are the hashes of the objects, sorted.
+	Hashes []plumbing.Hash
+	// PackIDs and Offsets hold, for each object, the position of its pack in
+	// PackNames and its offset in the pack.
+	PackIDs []uint32
+	Offsets []uint64
+}
+
+// PackIndex is the index of a pack to add to a MultiPackIndex.
+type PackIndex struct {
+	// Hash is the hash of the pack.
+	Hash plumbing.Hash
+	// Index is the index of the pack.
+	Index idxfile.Index
+	// ModTime is the modification time of the pack.
+	ModTime time.Time
+}
+
+// New returns a MultiPackIndex of the objects of the given packs. The objects
+// in several packs are indexed in the most recently modified one, as git
+// does.
+func New(packs []PackIndex) (*MultiPackIndex, error) {
+	packs = append([]PackIndex(nil), packs...)
+	sort.Slice(packs, func(i, j int) bool {
+		return packs[i].Hash.String() < packs[j].Hash.String()
+	})
+
+	type entry struct {
+		hash   plumbing.Hash
+		pack   uint32
+		offset uint64
+	}
+
+	var entries []entry
+	idx := &MultiPackIndex{}
+	for i, p := range packs {
+		idx.PackNames = append(idx.PackNames, PackName(p.Hash))
+
+		iter, err := p.Index.Entries()
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			e, err := iter.Next()
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				iter.Close()
+				return nil, err
+			}
+
+			entries = append(entries, entry{e.Hash, uint32(i), e.Offset})
+		}
+
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if c := bytes.Compare(entries[i].hash[:], entries[j].hash[:]); c != 0 {
+			return c < 0
+		}
+
+		ti, tj := packs[entries[i].pack].ModTime, packs[entries[j].pack].ModTime
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+
+		return entries[i].pack < entries[j].pack
+	})
+
+	for i, e := range entries {
+		if i > 0 && e.hash == entries[i-1].hash {
+			continue
+		}
+
+		idx.Hashes = append(idx.Hashes, e.hash)
+		idx.PackIDs = append(idx.PackIDs, e.pack)
+		idx.Offsets = append(idx.Offsets, e.offset)
+		idx.Fanout[e.hash[0]]++
+	}
+
+	for i := 1; i < fanout; i++ {
+		idx.Fanout[i] += idx.Fanout[i-1]
+	}
+
+	return idx, nil
+}
+
+// PackName returns the name of the index of the pack with the given hash, as
+// stored in the multi-pack-index.
+func PackName(h plumbing.Hash) string {
+	return packPrefix + h.String() + idxExt
+}
+
+// Packs returns the hashes of the packs of the index.
+func (idx *MultiPackIndex) Packs() ([]plumbing.Hash, error) {
+	packs := make([]plumbing.Hash, 0, len(idx.PackNames))
+	for _, name := range idx.PackNames {
+		h, err := packHash(name)
+		if err != nil {
+			return nil, err
+		}
+
+		packs = append(packs, h)
+	}
+
+	return packs, nil
+}
+
+// HasPack returns whether the index covers the pack with the given hash.
+func (idx *MultiPackIndex) HasPack(h plumbing.Hash) bool {
+	name := PackName(h)
+	for _, n := range idx.PackNames {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Count returns the number of objects of the index.
+func (idx *MultiPackIndex) Count() int {
+	return len(idx.Hashes)
+}
+
+// Contains returns whether the index has the object with the given hash.
+func (idx *MultiPackIndex) Contains(h plumbing.Hash) bool {
+	_, ok := idx.find(h)
+	return ok
+}
+
+// FindOffset returns the hash of the pack of the object with the given hash,
+// and its offset in the pack. If the index doesn't have the object,
+// plumbing.ErrObjectNotFound is returned.
+func (idx *MultiPackIndex) FindOffset(h plumbing.Hash) (plumbing.Hash, int64, error) {
+	i, ok := idx.find(h)
+	if !ok {
+		return plumbing.ZeroHash, 0, plumbing.ErrObjectNotFound
+	}
+
+	pack := idx.PackIDs[i]
+	if int(pack) >= len(idx.PackNames) {
+		return plumbing.ZeroHash, 0, ErrMalformedMultiPackIndex
+	}
+
+	ph, err := packHash(idx.PackNames[pack])
+	if err != nil {
+		return plumbing.ZeroHash, 0, err
+	}
+
+	return ph, int64(idx.Offsets[i]), nil
+}
+
+// HashesWithPrefix returns the hashes of the objects of the index starting
+// with the given prefix.
+func (idx *MultiPackIndex) HashesWithPrefix(prefix []byte) []plumbing.Hash {
+	lo, hi := 0, len(idx.Hashes)
+	if len(prefix) > 0 {
+		lo, hi = idx.bounds(prefix[0])
+	}
+
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(idx.Hashes[lo+i][:], prefix) >= 0
+	})
+
+	var hashes []plumbing.Hash
+	for ; i < hi && bytes.HasPrefix(idx.Hashes[i][:], prefix); i++ {
+		hashes = append(hashes, idx.Hashes[i])
+	}
+
+	return hashes
+}
+
+func (idx *MultiPackIndex) find(h plumbing.Hash) (int, bool) {
+	lo, hi := idx.bounds(h[0])
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(idx.Hashes[lo+i][:], h[:]) >= 0
+	})
+
+	return i, i < hi && idx.Hashes[i] == h
+}
+
+// bounds returns the range of the objects whose hash starts with b.
+func (idx *MultiPackIndex) bounds(b byte) (int, int) {
+	var lo int
+	if b > 0 {
+		lo = int(idx.Fanout[b-1])
+	}
+
+	hi := int(idx.Fanout[b])
+	if hi > len(idx.Hashes) {
+		hi = len(idx.Hashes)
+	}
+
+	if lo > hi {
+		lo = hi
+	}
+
+	return lo, hi
+}
+
+func packHash(name string) (plumbing.Hash, error) {
+	if !strings.HasPrefix(name, packPrefix) || !strings.HasSuffix(name, idxExt) {
+		return plumbing.ZeroHash, fmt.Errorf("%w: invalid pack name %q", ErrMalformedMultiPackIndex, name)
+	}
+
+	hex := name[len(packPrefix) : len(name)-len(idxExt)]
+	if !plumbing.IsHash(hex) {
+		return plumbing.ZeroHash, fmt.Errorf("%w: invalid pack name %q", ErrMalformedMultiPackIndex, name)
+	}
+
+	return plumbing.NewHash(hex), nil
+}
@@ -0,0 +1,173 @@
+package midx_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v5/plumbing/format/midx"
+	"github.com/stretchr/testify/suite"
+
+	fixtures "github.com/go-git/go-git-fixtures/v4"
+)
+
+type MidxSuite struct {
+	suite.Suite
+}
+
+func TestMidxSuite(t *testing.T) {
+	suite.Run(t, new(MidxSuite))
+}
+
+func (s *MidxSuite) TestNewEncodeDecode() {
+	fs := fixtures.ByTag(".git").ByTag("multi-packfile").One().DotGit()
+	entries, err := fs.ReadDir(fs.Join("objects", "pack"))
+	s.NoError(err)
+
+	var packs []midx.PackIndex
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, "pack-") || !strings.HasSuffix(name, ".idx") {
+			continue
+		}
+
+		f, err := fs.Open(fs.Join("objects", "pack", name))
+		s.NoError(err)
+		idx := idxfile.NewMemoryIndex()
+		s.NoError(idxfile.NewDecoder(f).Decode(idx))
+		s.NoError(f.Close())
+
+		packs = append(packs, midx.PackIndex{
+			Hash:    plumbing.NewHash(name[5:45]),
+			Index:   idx,
+			ModTime: e.ModTime(),
+		})
+	}
+	s.True(len(packs) > 1)
+
+	m, err := midx.New(packs)
+	s.NoError(err)
+
+	buf := bytes.NewBuffer(nil)
+	s.NoError(midx.NewEncoder(buf).Encode(m))
+
+	decoded := &midx.MultiPackIndex{}
+	s.NoError(midx.NewDecoder(buf).Decode(decoded))
+	s.Equal(m, decoded)
+
+	hashes, err := decoded.Packs()
+	s.NoError(err)
+	s.Len(hashes, len(packs))
+
+	count := 0
+	for _, p := range packs {
+		iter, err := p.Index.Entries()
+		s.NoError(err)
+		for {
+			e, err := iter.Next()
+			if err != nil {
+				break
+			}
+
+			count++
+			pack, offset, err := decoded.FindOffset(e.Hash)
+			s.NoError(err)
+			s.True(decoded.Contains(e.Hash))
+			idx := packs[0].Index
+			for _, p := range packs {
+				if p.Hash == pack {
+					idx = p.Index
+				}
+			}
+			expected, err := idx.FindOffset(e.Hash)
+			s.NoError(err)
+			s.Equal(expected, offset)
+		}
+		s.NoError(iter.Close())
+	}
+	s.True(decoded.Count() > 0)
+	s.True(decoded.Count() <= count)
+
+	_, _, err = decoded.FindOffset(plumbing.ZeroHash)
+	s.ErrorIs(err, plumbing.ErrObjectNotFound)
+
+	h := decoded.Hashes[decoded.Count()/2]
+	s.Contains(decoded.HashesWithPrefix(h[:3]), h)
+	s.Equal([]plumbing.Hash{h}, decoded.HashesWithPrefix(h[:]))
+	s.Len(decoded.HashesWithPrefix(nil), decoded.Count())
+}
+
+func (s *MidxSuite) TestNewDuplicates() {
+	h := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	var indexes []*idxfile.MemoryIndex
+	for i := 0; i < 2; i++ {
+		w := new(idxfile.Writer)
+		w.Add(h, uint64(12+i), 0)
+		s.NoError(w.OnFooter(plumbing.ZeroHash))
+		idx, err := w.Index()
+		s.NoError(err)
+		indexes = append(indexes, idx)
+	}
+	older, newer := indexes[0], indexes[1]
+
+	now := time.Now()
+	m, err := midx.New([]midx.PackIndex{
+		{Hash: plumbing.NewHash("1111111111111111111111111111111111111111"), Index: newer, ModTime: now},
+		{Hash: plumbing.NewHash("0000000000000000000000000000000000000001"), Index: older, ModTime: now.Add(-time.Hour)},
+	})
+	s.NoError(err)
+	s.Equal(1, m.Count())
+
+	pack, offset, err := m.FindOffset(h)
+	s.NoError(err)
+	s.Equal(plumbing.NewHash("1111111111111111111111111111111111111111"), pack)
+	s.Equal(int64(13), offset)
+}
+
+func (s *MidxSuite) TestLargeOffsets() {
+	m := &midx.MultiPackIndex{
+		PackNames: []string{midx.PackName(plumbing.NewHash("1111111111111111111111111111111111111111"))},
+		Hashes: []plumbing.Hash{
+			plumbing.NewHash("0000000000000000000000000000000000000001"),
+			plumbing.NewHash("ff00000000000000000000000000000000000001"),
+		},
+		PackIDs: []uint32{0, 0},
+		Offsets: []uint64{1 << 33, 12},
+	}
+	for i := range m.Fanout {
+		m.Fanout[i] = 1
+	}
+	m.Fanout[0xff] = 2
+
+	buf := bytes.NewBuffer(nil)
+	s.NoError(midx.NewEncoder(buf).Encode(m))
+
+	decoded := &midx.MultiPackIndex{}
+	s.NoError(midx.NewDecoder(buf).Decode(decoded))
+	s.Equal(m, decoded)
+
+	_, offset, err := decoded.FindOffset(m.Hashes[0])
+	s.NoError(err)
+	s.Equal(int64(1<<33), offset)
+}
+
+func (s *MidxSuite) TestDecodeMalformed() {
+	m := &midx.MultiPackIndex{
+		PackNames: []string{midx.PackName(plumbing.NewHash("1111111111111111111111111111111111111111"))},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	s.NoError(midx.NewEncoder(buf).Encode(m))
+	data := buf.Bytes()
+
+	corrupted := append([]byte(nil), data...)
+	corrupted[20]++
+	err := midx.NewDecoder(bytes.NewReader(corrupted)).Decode(&midx.MultiPackIndex{})
+	s.ErrorIs(err, midx.ErrMalformedMultiPackIndex)
+
+	err = midx.NewDecoder(bytes.NewReader(data[:10])).Decode(&midx.MultiPackIndex{})
+	s.ErrorIs(err, midx.ErrMalformedMultiPackIndex)
+}
@@ -42,6 +42,34 @@ func UpdateObjectStorage(s storer.Storer, packfile io.Reader) error {
 	return err
 }
 
+// UpdateThinObjectStorage is the same as UpdateObjectStorage, but the
+// packfile may be thin, with deltas against objects of the storer missing in
+// it. Its objects are written one by one, as a thin packfile can't be indexed
+// on its own.
+func UpdateThinObjectStorage(s storer.Storer, packfile io.Reader) error {
+	p := NewParser(packfile, WithStorage(s))
+
+	_, err := p.Parse()
+	return err
+}
+
+// UpdatePromisorObjectStorage is the same as UpdateObjectStorage, but the
+// packfile is written as fetched from a promisor remote if the storer
+// implements PromisorPackfileWriter.
+func UpdatePromisorObjectStorage(s storer.Storer, packfile io.Reader) error {
+	pw, ok := s.(storer.PromisorPackfileWriter)
+	if !ok {
+		return UpdateObjectStorage(s, packfile)
+	}
+
+	w, err := pw.PromisorPackfileWriter()
+	if err != nil {
+		return err
+	}
+
+	return writePackfile(w, packfile)
+}
+
 // WritePackfileToObjectStorage writes all the packfile objects into the given
 // object storage.
 func WritePackfileToObjectStorage(
@@ -53,6 +81,10 @@ func WritePackfileToObjectStorage(
 		return err
 	}
 
+	return writePackfile(w, packfile)
+}
+
+func writePackfile(w io.WriteCloser, packfile io.Reader) (err error) {
 	defer ioutil.CheckClose(w, &err)
 	var n int64
 
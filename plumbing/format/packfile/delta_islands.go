@@ -0,0 +1,76 @@
+package packfile
+
+import (
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// DeltaIslands records the delta islands of the objects, the sets of objects
+// reachable from groups of references, as git does with pack.island. An
+// object is only stored as a delta of a base belonging to all its islands,
+// so serving the references of an island never requires objects of other
+// islands to resolve the deltas. Objects without islands can be stored as
+// deltas of any base.
+type DeltaIslands struct {
+	names   map[string]int
+	islands map[plumbing.Hash][]uint64
+}
+
+// NewDeltaIslands returns a new DeltaIslands without islands.
+func NewDeltaIslands() *DeltaIslands {
+	return &DeltaIslands{
+		names:   make(map[string]int),
+		islands: make(map[plumbing.Hash][]uint64),
+	}
+}
+
+// Add adds the given objects to the named island.
+func (d *DeltaIslands) Add(island string, hashes ...plumbing.Hash) {
+	i, ok := d.names[island]
+	if !ok {
+		i = len(d.names)
+		d.names[island] = i
+	}
+
+	word, bit := i/64, uint64(1)<<(i%64)
+	for _, h := range hashes {
+		marks := d.islands[h]
+		for len(marks) <= word {
+			marks = append(marks, 0)
+		}
+
+		marks[word] |= bit
+		d.islands[h] = marks
+	}
+}
+
+// Len returns the number of islands.
+func (d *DeltaIslands) Len() int {
+	if d == nil {
+		return 0
+	}
+
+	return len(d.names)
+}
+
+// CanDelta returns whether the target object can be stored as a delta of
+// base, that is, whether base belongs to all the islands of target. It's
+// always true for nil DeltaIslands.
+func (d *DeltaIslands) CanDelta(target, base plumbing.Hash) bool {
+	if d == nil {
+		return true
+	}
+
+	bases := d.islands[base]
+	for i, marks := range d.islands[target] {
+		var b uint64
+		if i < len(bases) {
+			b = bases[i]
+		}
+
+		if marks&^b != 0 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -1,6 +1,7 @@
 package packfile
 
 import (
+	"runtime"
 	"sort"
 	"sync"
 
@@ -37,21 +38,41 @@ func (dw *deltaSelector) ObjectsToPack(
 	hashes []plumbing.Hash,
 	packWindow uint,
 ) ([]*ObjectToPack, error) {
-	otp, err := dw.objectsToPack(hashes, packWindow)
+	return dw.objectsToPackWithOptions(hashes, &EncodeOptions{
+		Window:      packWindow,
+		ReuseDeltas: packWindow > 0,
+	})
+}
+
+// objectsToPackWithOptions creates a list of ObjectToPack from the hashes
+// provided, reusing and creating deltas as described by the options. The
+// delta search is split by type, and in parts of the objects of each type,
+// run by up to o.Threads goroutines.
+func (dw *deltaSelector) objectsToPackWithOptions(
+	hashes []plumbing.Hash,
+	o *EncodeOptions,
+) ([]*ObjectToPack, error) {
+	otp, err := dw.objectsToPack(hashes, o)
 	if err != nil {
 		return nil, err
 	}
 
-	if packWindow == 0 {
+	if o.Window == 0 {
 		return otp, nil
 	}
 
-	dw.sort(otp)
+	sorted := otp
+	if o.KeepOrder {
+		sorted = make([]*ObjectToPack, len(otp))
+		copy(sorted, otp)
+	}
+
+	dw.sort(sorted)
 
 	var objectGroups [][]*ObjectToPack
 	var prev *ObjectToPack
 	i := -1
-	for _, obj := range otp {
+	for _, obj := range sorted {
 		if prev == nil || prev.Type() != obj.Type() {
 			objectGroups = append(objectGroups, []*ObjectToPack{obj})
 			i++
@@ -61,19 +82,29 @@ func (dw *deltaSelector) ObjectsToPack(
 		}
 	}
 
+	threads := int(o.Threads)
+	if threads == 0 {
+		threads = runtime.NumCPU()
+	}
+
 	var wg sync.WaitGroup
 	var once sync.Once
-	for _, objs := range objectGroups {
-		objs := objs
-		wg.Add(1)
-		go func() {
-			if walkErr := dw.walk(objs, packWindow); walkErr != nil {
-				once.Do(func() {
-					err = walkErr
-				})
-			}
-			wg.Done()
-		}()
+	sem := make(chan struct{}, threads)
+	for _, group := range objectGroups {
+		for _, objs := range splitObjects(group, threads, 2*int(o.Window)) {
+			objs := objs
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				if walkErr := dw.walk(objs, o); walkErr != nil {
+					once.Do(func() {
+						err = walkErr
+					})
+				}
+				<-sem
+				wg.Done()
+			}()
+		}
 	}
 	wg.Wait()
 
@@ -81,18 +112,88 @@ func (dw *deltaSelector) ObjectsToPack(
 		return nil, err
 	}
 
+	if err := dw.breakDeepChains(otp, o.depth()); err != nil {
+		return nil, err
+	}
+
 	return otp, nil
 }
 
+// breakDeepChains undeltifies the objects whose delta chains are longer than
+// maxDepth. They can be, as the objects with reused deltas based on them may
+// have become deltas themselves.
+func (dw *deltaSelector) breakDeepChains(objectsToPack []*ObjectToPack, maxDepth int64) error {
+	depths := make(map[*ObjectToPack]int64, len(objectsToPack))
+	var depth func(*ObjectToPack) (int64, error)
+	depth = func(otp *ObjectToPack) (int64, error) {
+		if !otp.IsDelta() {
+			return 0, nil
+		}
+
+		if d, ok := depths[otp]; ok {
+			return d, nil
+		}
+
+		d, err := depth(otp.Base)
+		if err != nil {
+			return 0, err
+		}
+
+		d++
+		if d > maxDepth {
+			if err := dw.restoreOriginal(otp); err != nil {
+				return 0, err
+			}
+
+			otp.BackToOriginal()
+			d = 0
+		}
+
+		otp.Depth = int(d)
+		depths[otp] = d
+		return d, nil
+	}
+
+	for _, otp := range objectsToPack {
+		if _, err := depth(otp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// splitObjects splits objs in n parts, unless they'd be smaller than min
+// objects, as the objects at the start of each part miss the delta bases at
+// the end of the previous one.
+func splitObjects(objs []*ObjectToPack, n, min int) [][]*ObjectToPack {
+	size := (len(objs) + n - 1) / n
+	if size < min {
+		size = min
+	}
+
+	if size == 0 {
+		size = 1
+	}
+
+	var parts [][]*ObjectToPack
+	for len(objs) > size {
+		parts = append(parts, objs[:size])
+		objs = objs[size:]
+	}
+
+	return append(parts, objs)
+}
+
 func (dw *deltaSelector) objectsToPack(
 	hashes []plumbing.Hash,
-	packWindow uint,
+	opts *EncodeOptions,
 ) ([]*ObjectToPack, error) {
 	var objectsToPack []*ObjectToPack
 	for _, h := range hashes {
 		var o plumbing.EncodedObject
 		var err error
-		if packWindow == 0 {
+		if !opts.ReuseDeltas {
 			o, err = dw.encodedObject(h)
 		} else {
 			o, err = dw.encodedDeltaObject(h)
@@ -109,11 +210,11 @@ func (dw *deltaSelector) objectsToPack(
 		objectsToPack = append(objectsToPack, otp)
 	}
 
-	if packWindow == 0 {
+	if !opts.ReuseDeltas {
 		return objectsToPack, nil
 	}
 
-	if err := dw.fixAndBreakChains(objectsToPack); err != nil {
+	if err := dw.fixAndBreakChains(objectsToPack, opts); err != nil {
 		return nil, err
 	}
 
@@ -133,14 +234,14 @@ func (dw *deltaSelector) encodedObject(h plumbing.Hash) (plumbing.EncodedObject,
 	return dw.storer.EncodedObject(plumbing.AnyObject, h)
 }
 
-func (dw *deltaSelector) fixAndBreakChains(objectsToPack []*ObjectToPack) error {
+func (dw *deltaSelector) fixAndBreakChains(objectsToPack []*ObjectToPack, o *EncodeOptions) error {
 	m := make(map[plumbing.Hash]*ObjectToPack, len(objectsToPack))
 	for _, otp := range objectsToPack {
 		m[otp.Hash()] = otp
 	}
 
 	for _, otp := range objectsToPack {
-		if err := dw.fixAndBreakChainsOne(m, otp); err != nil {
+		if err := dw.fixAndBreakChainsOne(m, otp, o); err != nil {
 			return err
 		}
 	}
@@ -148,7 +249,7 @@ func (dw *deltaSelector) fixAndBreakChains(objectsToPack []*ObjectToPack) error
 	return nil
 }
 
-func (dw *deltaSelector) fixAndBreakChainsOne(objectsToPack map[plumbing.Hash]*ObjectToPack, otp *ObjectToPack) error {
+func (dw *deltaSelector) fixAndBreakChainsOne(objectsToPack map[plumbing.Hash]*ObjectToPack, otp *ObjectToPack, o *EncodeOptions) error {
 	if !otp.Object.Type().IsDelta() {
 		return nil
 	}
@@ -174,10 +275,16 @@ func (dw *deltaSelector) fixAndBreakChainsOne(objectsToPack map[plumbing.Hash]*O
 		return dw.undeltify(otp)
 	}
 
-	if err := dw.fixAndBreakChainsOne(objectsToPack, base); err != nil {
+	if err := dw.fixAndBreakChainsOne(objectsToPack, base, o); err != nil {
 		return err
 	}
 
+	// The delta is too deep, or its base isn't in all the islands of the
+	// object, so we break the chain too.
+	if int64(base.Depth) >= o.depth() || !o.Islands.CanDelta(otp.Hash(), base.Hash()) {
+		return dw.undeltify(otp)
+	}
+
 	otp.SetDelta(base, otp.Object)
 	return nil
 }
@@ -219,14 +326,26 @@ func (dw *deltaSelector) sort(objectsToPack []*ObjectToPack) {
 
 func (dw *deltaSelector) walk(
 	objectsToPack []*ObjectToPack,
-	packWindow uint,
+	o *EncodeOptions,
 ) error {
 	indexMap := make(map[plumbing.Hash]*deltaIndex)
+	// The candidate bases of each object are the ones from start, at most
+	// the window size minus one, keeping their size below the window
+	// memory, if any, unless there is only one.
+	var start int
+	var memory uint64
 	for i := 0; i < len(objectsToPack); i++ {
+		if i > 0 {
+			memory += uint64(objectsToPack[i-1].Size())
+		}
+
 		// Clean up the index map and reconstructed delta objects for anything
 		// outside our pack window, to save memory.
-		if i > int(packWindow) {
-			obj := objectsToPack[i-int(packWindow)]
+		for start < i && (i-start >= int(o.Window) ||
+			(o.WindowMemory > 0 && memory > o.WindowMemory && i-start > 1)) {
+			obj := objectsToPack[start]
+			memory -= uint64(obj.Size())
+			start++
 
 			delete(indexMap, obj.Hash())
 
@@ -250,7 +369,7 @@ func (dw *deltaSelector) walk(
 			continue
 		}
 
-		for j := i - 1; j >= 0 && i-j < int(packWindow); j-- {
+		for j := i - 1; j >= start; j-- {
 			base := objectsToPack[j]
 			// Objects must use only the same type as their delta base.
 			// Since objectsToPack is sorted by type and size, once we find
@@ -259,7 +378,11 @@ func (dw *deltaSelector) walk(
 				break
 			}
 
-			if err := dw.tryToDeltify(indexMap, base, target); err != nil {
+			if !o.Islands.CanDelta(target.Hash(), base.Hash()) {
+				continue
+			}
+
+			if err := dw.tryToDeltify(indexMap, base, target, o.depth()); err != nil {
 				return err
 			}
 		}
@@ -268,7 +391,7 @@ func (dw *deltaSelector) walk(
 	return nil
 }
 
-func (dw *deltaSelector) tryToDeltify(indexMap map[plumbing.Hash]*deltaIndex, base, target *ObjectToPack) error {
+func (dw *deltaSelector) tryToDeltify(indexMap map[plumbing.Hash]*deltaIndex, base, target *ObjectToPack, maxDepth int64) error {
 	// Original object might not be present if we're reusing a delta, so we
 	// ensure it is restored.
 	if err := dw.restoreOriginal(target); err != nil {
@@ -289,6 +412,7 @@ func (dw *deltaSelector) tryToDeltify(indexMap map[plumbing.Hash]*deltaIndex, ba
 		base.Depth,
 		target.Depth,
 		target.IsDelta(),
+		maxDepth,
 	)
 
 	// Nearly impossible to fit useful delta.
@@ -320,7 +444,7 @@ func (dw *deltaSelector) tryToDeltify(indexMap map[plumbing.Hash]*deltaIndex, ba
 }
 
 func (dw *deltaSelector) deltaSizeLimit(targetSize int64, baseDepth int,
-	targetDepth int, targetDelta bool) int64 {
+	targetDepth int, targetDelta bool, maxDepth int64) int64 {
 	if !targetDelta {
 		// Any delta should be no more than 50% of the original size
 		// (for text files deflate of whole form should shrink 50%).
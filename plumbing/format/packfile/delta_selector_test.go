@@ -1,6 +1,7 @@
 package packfile
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/go-git/go-git/v5/plumbing"
@@ -213,9 +214,10 @@ func (s *DeltaSelectorSuite) TestObjectsToPack() {
 
 	// Don't sort so we can easily check the sliding window without
 	// creating a bunch of new objects.
-	otp, err = s.ds.objectsToPack(hashes, deltaWindowSize)
+	o := &EncodeOptions{Window: deltaWindowSize, ReuseDeltas: true}
+	otp, err = s.ds.objectsToPack(hashes, o)
 	s.NoError(err)
-	err = s.ds.walk(otp, deltaWindowSize)
+	err = s.ds.walk(otp, o)
 	s.NoError(err)
 	s.Len(otp, int(deltaWindowSize)+2)
 	targetIdx := len(otp) - 1
@@ -234,7 +236,81 @@ func (s *DeltaSelectorSuite) TestObjectsToPack() {
 	s.Equal(0, otp[1].Depth)
 }
 
+func (s *DeltaSelectorSuite) TestObjectsToPackWithOptions() {
+	hashes := []plumbing.Hash{
+		s.hashes["o3"],
+		s.hashes["o1"],
+		s.hashes["o2"],
+	}
+
+	// The delta chains are limited by the depth
+	otp, err := s.ds.objectsToPackWithOptions(hashes, &EncodeOptions{Window: 10, Depth: 1})
+	s.NoError(err)
+	s.Len(otp, 3)
+	for _, o := range otp {
+		s.True(o.Depth <= 1)
+	}
+
+	// The objects are kept in order
+	otp, err = s.ds.objectsToPackWithOptions(hashes, &EncodeOptions{Window: 10, Threads: 2, KeepOrder: true})
+	s.NoError(err)
+	s.Len(otp, 3)
+	for i, o := range otp {
+		s.Equal(hashes[i], o.Hash())
+	}
+	s.True(otp[0].IsDelta())
+	s.Equal(2, otp[0].Depth)
+
+	// The window is shrunk to a single object to stay below the memory limit
+	hashes = []plumbing.Hash{s.hashes["base"], s.hashes["smallTarget"], s.hashes["target"]}
+	o := &EncodeOptions{Window: 10, ReuseDeltas: true}
+	otp, err = s.ds.objectsToPack(hashes, o)
+	s.NoError(err)
+	s.NoError(s.ds.walk(otp, o))
+	s.True(otp[2].IsDelta())
+
+	o.WindowMemory = 1
+	otp, err = s.ds.objectsToPack(hashes, o)
+	s.NoError(err)
+	s.NoError(s.ds.walk(otp, o))
+	s.False(otp[2].IsDelta())
+
+	// The bases must belong to all the islands of their objects
+	hashes = []plumbing.Hash{
+		s.hashes["o3"],
+		s.hashes["o1"],
+		s.hashes["o2"],
+	}
+	islands := NewDeltaIslands()
+	islands.Add("a", s.hashes["o1"], s.hashes["o2"])
+	islands.Add("b", s.hashes["o3"])
+	otp, err = s.ds.objectsToPackWithOptions(hashes, &EncodeOptions{Window: 10, Islands: islands, KeepOrder: true})
+	s.NoError(err)
+	s.False(otp[0].IsDelta())
+	s.True(otp[2].IsDelta())
+	s.Equal(otp[1], otp[2].Base)
+}
+
+func (s *DeltaSelectorSuite) TestDeltaIslands() {
+	islands := NewDeltaIslands()
+	for i := 0; i < 70; i++ {
+		islands.Add(fmt.Sprint(i), s.hashes["base"])
+	}
+	islands.Add("69", s.hashes["target"])
+	islands.Add("0", s.hashes["smallBase"])
+	s.Equal(70, islands.Len())
+
+	s.True(islands.CanDelta(s.hashes["target"], s.hashes["base"]))
+	s.False(islands.CanDelta(s.hashes["base"], s.hashes["target"]))
+	s.False(islands.CanDelta(s.hashes["target"], s.hashes["smallBase"]))
+	s.True(islands.CanDelta(s.hashes["o2"], s.hashes["smallBase"]))
+	s.False(islands.CanDelta(s.hashes["smallBase"], s.hashes["o2"]))
+
+	var none *DeltaIslands
+	s.True(none.CanDelta(s.hashes["smallBase"], s.hashes["o2"]))
+}
+
 func (s *DeltaSelectorSuite) TestMaxDepth() {
-	dsl := s.ds.deltaSizeLimit(0, 0, int(maxDepth), true)
+	dsl := s.ds.deltaSizeLimit(0, 0, int(maxDepth), true, maxDepth)
 	s.Equal(int64(0), dsl)
 }
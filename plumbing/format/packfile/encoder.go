@@ -42,6 +42,42 @@ func NewEncoder(w io.Writer, s storer.EncodedObjectStorer, useRefDeltas bool) *E
 	}
 }
 
+// EncodeOptions describes how the objects of a packfile are delta
+// compressed and written.
+type EncodeOptions struct {
+	// Window is the size of the sliding window used to compare objects
+	// for delta compression; 0 turns off the search of new deltas.
+	Window uint
+	// Depth is the maximum length of the delta chains, 50 if zero.
+	Depth uint
+	// WindowMemory limits the size in bytes of the objects of the sliding
+	// window, which is shrunk to stay below it, keeping at least one
+	// object. No limit if zero.
+	WindowMemory uint64
+	// Threads is the number of goroutines searching for deltas, each one
+	// on a part of the objects of a type. As many as CPUs if zero.
+	Threads uint
+	// ReuseDeltas reuses the deltas of the objects stored as deltas by the
+	// storage, when their bases are packed too, instead of searching new
+	// deltas for them.
+	ReuseDeltas bool
+	// Islands, if not nil, restricts the deltas to the bases belonging to
+	// all the delta islands of their objects.
+	Islands *DeltaIslands
+	// KeepOrder writes the objects in the order of the given hashes,
+	// instead of by type and size, letting the caller order them by
+	// recency from the references, as git does, for a better locality.
+	KeepOrder bool
+}
+
+func (o *EncodeOptions) depth() int64 {
+	if o.Depth == 0 {
+		return maxDepth
+	}
+
+	return int64(o.Depth)
+}
+
 // Encode creates a packfile containing all the objects referenced in
 // hashes and writes it to the writer in the Encoder.  `packWindow`
 // specifies the size of the sliding window used to compare objects
@@ -58,6 +94,21 @@ func (e *Encoder) Encode(
 	return e.encode(objects)
 }
 
+// EncodeWithOptions creates a packfile containing all the objects referenced
+// in hashes, delta compressed as described by the given options, and writes
+// it to the writer in the Encoder.
+func (e *Encoder) EncodeWithOptions(
+	hashes []plumbing.Hash,
+	o *EncodeOptions,
+) (plumbing.Hash, error) {
+	objects, err := e.selector.objectsToPackWithOptions(hashes, o)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return e.encode(objects)
+}
+
 func (e *Encoder) encode(objects []*ObjectToPack) (plumbing.Hash, error) {
 	if err := e.head(len(objects)); err != nil {
 		return plumbing.ZeroHash, err
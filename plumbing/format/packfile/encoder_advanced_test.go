@@ -42,7 +42,7 @@ func (s *EncoderAdvancedSuite) TestEncodeDecode() {
 
 	for _, f := range fixs {
 		storage := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
-		s.testEncodeDecode(storage, 10)
+		s.testEncodeDecode(storage, 10, nil)
 	}
 }
 
@@ -57,13 +57,35 @@ func (s *EncoderAdvancedSuite) TestEncodeDecodeNoDeltaCompression() {
 
 	for _, f := range fixs {
 		storage := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
-		s.testEncodeDecode(storage, 0)
+		s.testEncodeDecode(storage, 0, nil)
+	}
+}
+
+func (s *EncoderAdvancedSuite) TestEncodeDecodeWithOptions() {
+	if testing.Short() {
+		s.T().Skip("skipping test in short mode.")
+	}
+
+	fixs := fixtures.Basic().ByTag("packfile").ByTag(".git")
+	fixs = append(fixs, fixtures.ByURL("https://github.com/src-d/go-git.git").
+		ByTag("packfile").ByTag(".git").One())
+
+	for _, f := range fixs {
+		for _, o := range []*EncodeOptions{
+			{Window: 10, Depth: 2, Threads: 4, ReuseDeltas: true},
+			{Window: 10, WindowMemory: 1024, Threads: 1, KeepOrder: true},
+			{ReuseDeltas: true, KeepOrder: true},
+		} {
+			storage := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+			s.testEncodeDecode(storage, 0, o)
+		}
 	}
 }
 
 func (s *EncoderAdvancedSuite) testEncodeDecode(
 	storage storer.Storer,
 	packWindow uint,
+	o *EncodeOptions,
 ) {
 	objIter, err := storage.IterEncodedObjects(plumbing.AnyObject)
 	s.NoError(err)
@@ -88,7 +110,12 @@ func (s *EncoderAdvancedSuite) testEncodeDecode(
 
 	buf := bytes.NewBuffer(nil)
 	enc := NewEncoder(buf, storage, false)
-	encodeHash, err := enc.Encode(hashes, packWindow)
+	var encodeHash plumbing.Hash
+	if o == nil {
+		encodeHash, err = enc.Encode(hashes, packWindow)
+	} else {
+		encodeHash, err = enc.EncodeWithOptions(hashes, o)
+	}
 	s.NoError(err)
 
 	fs := memfs.New()
@@ -0,0 +1,112 @@
+package reflog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// ErrMalformedEntry is returned by Decode when a line of the reflog cannot be
+// parsed.
+var ErrMalformedEntry = errors.New("malformed reflog entry")
+
+// A Decoder reads and decodes reflog entries from an input stream.
+type Decoder struct {
+	r *bufio.Reader
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Decode reads all the entries from the input stream, in the order they are
+// stored, this is from the oldest to the newest.
+func (d *Decoder) Decode() ([]*Entry, error) {
+	var entries []*Entry
+	for {
+		line, err := d.r.ReadBytes('\n')
+		if len(line) > 0 {
+			e, perr := decodeEntry(bytes.TrimSuffix(line, []byte("\n")))
+			if perr != nil {
+				return nil, perr
+			}
+
+			entries = append(entries, e)
+		}
+
+		if err == io.EOF {
+			return entries, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func decodeEntry(line []byte) (*Entry, error) {
+	header, msg, _ := bytes.Cut(line, []byte("\t"))
+
+	fields := bytes.SplitN(header, []byte(" "), 3)
+	if len(fields) != 3 {
+		return nil, ErrMalformedEntry
+	}
+
+	if !plumbing.IsHash(string(fields[0])) || !plumbing.IsHash(string(fields[1])) {
+		return nil, ErrMalformedEntry
+	}
+
+	e := &Entry{
+		Old:     plumbing.NewHash(string(fields[0])),
+		New:     plumbing.NewHash(string(fields[1])),
+		Message: string(msg),
+	}
+
+	if err := decodeSignature(&e.Committer, fields[2]); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func decodeSignature(s *Signature, b []byte) error {
+	open := bytes.LastIndexByte(b, '<')
+	close := bytes.LastIndexByte(b, '>')
+	if open == -1 || close == -1 || close < open {
+		return ErrMalformedEntry
+	}
+
+	s.Name = string(bytes.TrimSpace(b[:open]))
+	s.Email = string(b[open+1 : close])
+
+	ts, tz, _ := bytes.Cut(bytes.TrimSpace(b[close+1:]), []byte(" "))
+	sec, err := strconv.ParseInt(string(ts), 10, 64)
+	if err != nil {
+		return ErrMalformedEntry
+	}
+
+	s.When = time.Unix(sec, 0).In(time.UTC)
+	if len(tz) != 5 {
+		return nil
+	}
+
+	hours, err1 := strconv.ParseInt(string(tz[1:3]), 10, 64)
+	mins, err2 := strconv.ParseInt(string(tz[3:]), 10, 64)
+	if err1 != nil || err2 != nil {
+		return nil
+	}
+
+	offset := int(hours*60*60 + mins*60)
+	if tz[0] == '-' {
+		offset = -offset
+	}
+
+	s.When = s.When.In(time.FixedZone("", offset))
+	return nil
+}
@@ -0,0 +1,59 @@
+package reflog
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// An Encoder writes reflog entries to an output stream.
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes the given entries to the stream, one per line. Line breaks
+// and repeated spaces in the messages are collapsed into a single space, as
+// git does, so each entry fits in a line.
+func (e *Encoder) Encode(entries ...*Entry) error {
+	for _, entry := range entries {
+		if err := e.encodeEntry(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *Encoder) encodeEntry(entry *Entry) error {
+	c := entry.Committer
+	u := c.When.Unix()
+	if u < 0 {
+		u = 0
+	}
+
+	if _, err := fmt.Fprintf(e.w, "%s %s %s <%s> %d %s",
+		entry.Old, entry.New, c.Name, c.Email, u, c.When.Format("-0700"),
+	); err != nil {
+		return err
+	}
+
+	if msg := normalizeMessage(entry.Message); msg != "" {
+		if _, err := fmt.Fprintf(e.w, "\t%s", msg); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(e.w, "\n")
+	return err
+}
+
+// normalizeMessage replaces any sequence of whitespace characters by a single
+// space, removing the leading and trailing ones.
+func normalizeMessage(msg string) string {
+	return strings.Join(strings.Fields(msg), " ")
+}
@@ -0,0 +1,48 @@
+// Package reflog implements encoding and decoding of the reference logs
+// stored by git under the logs directory, one file per reference.
+//
+// Each line of a reflog file records an update of the reference:
+//
+//	<old hash> SP <new hash> SP <name> SP <email> SP <timestamp> SP <tz> [TAB <message>] LF
+//
+// The entries are stored in chronological order, so the last line is the
+// most recent update.
+package reflog
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Entry is a single update of a reference.
+type Entry struct {
+	// Old is the hash the reference pointed to before the update, it is the
+	// zero hash when the reference was created.
+	Old plumbing.Hash
+	// New is the hash the reference points to after the update.
+	New plumbing.Hash
+	// Committer is the identity of who updated the reference, and when.
+	Committer Signature
+	// Message describes the reason of the update, e.g. "commit: foo".
+	Message string
+}
+
+func (e *Entry) String() string {
+	return fmt.Sprintf("%s %s %s\t%s", e.Old, e.New, e.Committer, e.Message)
+}
+
+// Signature identifies who updated a reference and when.
+type Signature struct {
+	// Name represents a person name.
+	Name string
+	// Email is an email, but it cannot be assumed to be well-formed.
+	Email string
+	// When is the timestamp of the update.
+	When time.Time
+}
+
+func (s Signature) String() string {
+	return fmt.Sprintf("%s <%s>", s.Name, s.Email)
+}
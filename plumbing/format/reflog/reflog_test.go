@@ -0,0 +1,79 @@
+package reflog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/suite"
+)
+
+type ReflogSuite struct {
+	suite.Suite
+}
+
+func TestReflogSuite(t *testing.T) {
+	suite.Run(t, new(ReflogSuite))
+}
+
+const reflogFixture = "" +
+	"0000000000000000000000000000000000000000 6ecf0ef2c2dffb796033e5a02219af86ec6584e5 John Doe <john@doe.com> 1257894000 +0100\tclone: from https://github.com/git-fixtures/basic.git\n" +
+	"6ecf0ef2c2dffb796033e5a02219af86ec6584e5 918c48b83bd081e863dbe1b80f8998f058cd8294 John Doe <john@doe.com> 1257897600 -0230\tcheckout: moving from master to v1.0\n" +
+	"918c48b83bd081e863dbe1b80f8998f058cd8294 6ecf0ef2c2dffb796033e5a02219af86ec6584e5 foo <> 1257901200 +0000\n"
+
+func (s *ReflogSuite) TestDecode() {
+	entries, err := NewDecoder(strings.NewReader(reflogFixture)).Decode()
+	s.NoError(err)
+	s.Len(entries, 3)
+
+	e := entries[0]
+	s.True(e.Old.IsZero())
+	s.Equal(plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"), e.New)
+	s.Equal("John Doe", e.Committer.Name)
+	s.Equal("john@doe.com", e.Committer.Email)
+	s.Equal(int64(1257894000), e.Committer.When.Unix())
+	_, offset := e.Committer.When.Zone()
+	s.Equal(3600, offset)
+	s.Equal("clone: from https://github.com/git-fixtures/basic.git", e.Message)
+
+	_, offset = entries[1].Committer.When.Zone()
+	s.Equal(-(2*3600 + 30*60), offset)
+
+	s.Equal("foo", entries[2].Committer.Name)
+	s.Equal("", entries[2].Committer.Email)
+	s.Equal("", entries[2].Message)
+}
+
+func (s *ReflogSuite) TestDecodeMalformed() {
+	for _, line := range []string{
+		"foo",
+		"0000000000000000000000000000000000000000 foo John Doe <john@doe.com> 1257894000 +0100\n",
+		"0000000000000000000000000000000000000000 6ecf0ef2c2dffb796033e5a02219af86ec6584e5 John Doe 1257894000 +0100\n",
+		"0000000000000000000000000000000000000000 6ecf0ef2c2dffb796033e5a02219af86ec6584e5 John Doe <john@doe.com> foo +0100\n",
+	} {
+		_, err := NewDecoder(strings.NewReader(line)).Decode()
+		s.ErrorIs(err, ErrMalformedEntry, line)
+	}
+}
+
+func (s *ReflogSuite) TestEncodeDecode() {
+	entries, err := NewDecoder(strings.NewReader(reflogFixture)).Decode()
+	s.NoError(err)
+
+	buf := bytes.NewBuffer(nil)
+	s.NoError(NewEncoder(buf).Encode(entries...))
+	s.Equal(reflogFixture, buf.String())
+}
+
+func (s *ReflogSuite) TestEncodeNormalizesMessage() {
+	buf := bytes.NewBuffer(nil)
+	err := NewEncoder(buf).Encode(&Entry{
+		New:       plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+		Committer: Signature{Name: "foo", Email: "foo@foo.foo", When: time.Unix(0, 0).UTC()},
+		Message:   "commit: foo\n\nbar  baz\n",
+	})
+	s.NoError(err)
+	s.Equal("0000000000000000000000000000000000000000 6ecf0ef2c2dffb796033e5a02219af86ec6584e5 foo <foo@foo.foo> 0 +0000\tcommit: foo bar baz\n", buf.String())
+}
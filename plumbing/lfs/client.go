@@ -0,0 +1,259 @@
+package lfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// MediaType is the media type of the requests and responses of the
+	// batch API.
+	MediaType = "application/vnd.git-lfs+json"
+
+	// TransferBasic is the name of the basic transfer adapter, the only
+	// one supported.
+	TransferBasic = "basic"
+
+	// OperationDownload and OperationUpload are the operations of the batch
+	// API.
+	OperationDownload = "download"
+	OperationUpload   = "upload"
+
+	actionVerify = "verify"
+)
+
+// ErrBatchFailed is returned when a request to the Git LFS server fails.
+var ErrBatchFailed = errors.New("lfs batch request failed")
+
+// BatchRequest is the body of a request to the batch API.
+type BatchRequest struct {
+	Operation string         `json:"operation"`
+	Transfers []string       `json:"transfers,omitempty"`
+	Objects   []*BatchObject `json:"objects"`
+	HashAlgo  string         `json:"hash_algo,omitempty"`
+}
+
+// BatchResponse is the body of a response of the batch API.
+type BatchResponse struct {
+	Transfer string         `json:"transfer,omitempty"`
+	Objects  []*BatchObject `json:"objects"`
+	HashAlgo string         `json:"hash_algo,omitempty"`
+}
+
+// BatchObject is an object of a request, or of a response, of the batch API.
+type BatchObject struct {
+	Oid     string                  `json:"oid"`
+	Size    int64                   `json:"size"`
+	Actions map[string]*BatchAction `json:"actions,omitempty"`
+	Error   *BatchError             `json:"error,omitempty"`
+}
+
+// BatchAction is the request to make to transfer an object.
+type BatchAction struct {
+	Href      string            `json:"href"`
+	Header    map[string]string `json:"header,omitempty"`
+	ExpiresIn int               `json:"expires_in,omitempty"`
+}
+
+// BatchError is the error of the batch API for an object, or for the whole
+// request.
+type BatchError struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+// Client is a Store getting and putting the objects in a Git LFS server,
+// using the batch API and the basic transfer adapter.
+//
+// See https://github.com/git-lfs/git-lfs/blob/main/docs/api/batch.md
+type Client struct {
+	endpoint string
+	user     *url.Userinfo
+	client   *http.Client
+}
+
+// NewClient returns a Client of the Git LFS server at endpoint, such as
+// https://example.com/foo.git/info/lfs. The credentials in the endpoint, if
+// any, are sent with basic authentication. If client is nil,
+// http.DefaultClient is used.
+func NewClient(endpoint string, client *http.Client) (*Client, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported lfs endpoint: %s", endpoint)
+	}
+
+	user := u.User
+	u.User = nil
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &Client{
+		endpoint: strings.TrimSuffix(u.String(), "/"),
+		user:     user,
+		client:   client,
+	}, nil
+}
+
+// Get downloads the object p. The content is verified while it's read.
+func (c *Client) Get(p *Pointer) (io.ReadCloser, error) {
+	obj, err := c.batch(OperationDownload, p)
+	if err != nil {
+		return nil, err
+	}
+
+	action, ok := obj.Actions[OperationDownload]
+	if !ok {
+		return nil, fmt.Errorf("%w: no download action for %s", ErrBatchFailed, p.Oid)
+	}
+
+	res, err := c.do(http.MethodGet, action, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{NewVerifyReader(p, res.Body), res.Body}, nil
+}
+
+// Put uploads the object p, unless the server already has it.
+func (c *Client) Put(p *Pointer, r io.Reader) error {
+	obj, err := c.batch(OperationUpload, p)
+	if err != nil {
+		return err
+	}
+
+	action, ok := obj.Actions[OperationUpload]
+	if !ok {
+		return nil
+	}
+
+	res, err := c.do(http.MethodPut, action, NewVerifyReader(p, r))
+	if err != nil {
+		return err
+	}
+
+	res.Body.Close()
+
+	action, ok = obj.Actions[actionVerify]
+	if !ok {
+		return nil
+	}
+
+	body, err := json.Marshal(&BatchObject{Oid: p.Oid, Size: p.Size})
+	if err != nil {
+		return err
+	}
+
+	res, err = c.do(http.MethodPost, action, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	return res.Body.Close()
+}
+
+// batch requests the operation on the object p, returning the object of the
+// response.
+func (c *Client) batch(operation string, p *Pointer) (*BatchObject, error) {
+	body, err := json.Marshal(&BatchRequest{
+		Operation: operation,
+		Transfers: []string{TransferBasic},
+		Objects:   []*BatchObject{{Oid: p.Oid, Size: p.Size}},
+		HashAlgo:  HashAlgo,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.do(http.MethodPost, &BatchAction{Href: c.endpoint + "/objects/batch"}, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	var batch BatchResponse
+	if err := json.NewDecoder(res.Body).Decode(&batch); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBatchFailed, err)
+	}
+
+	if batch.Transfer != "" && batch.Transfer != TransferBasic {
+		return nil, fmt.Errorf("%w: unsupported transfer %q", ErrBatchFailed, batch.Transfer)
+	}
+
+	for _, obj := range batch.Objects {
+		if obj.Oid != p.Oid {
+			continue
+		}
+
+		if obj.Error == nil {
+			return obj, nil
+		}
+
+		if obj.Error.Code == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, p.Oid)
+		}
+
+		return nil, fmt.Errorf("%w: %s: %s", ErrBatchFailed, p.Oid, obj.Error.Message)
+	}
+
+	return nil, fmt.Errorf("%w: %s missing from response", ErrBatchFailed, p.Oid)
+}
+
+// do makes the request of an action, failing if the response isn't
+// successful.
+func (c *Client) do(method string, action *BatchAction, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, action.Href, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(action.Href, c.endpoint+"/") {
+		req.Header.Set("Accept", MediaType)
+		if method == http.MethodPost {
+			req.Header.Set("Content-Type", MediaType)
+		}
+
+		if c.user != nil {
+			pass, _ := c.user.Password()
+			req.SetBasicAuth(c.user.Username(), pass)
+		}
+	}
+
+	for k, v := range action.Header {
+		req.Header.Set(k, v)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res, nil
+	}
+
+	defer res.Body.Close()
+
+	var e BatchError
+	_ = json.NewDecoder(io.LimitReader(res.Body, 64*1024)).Decode(&e)
+	if res.StatusCode == http.StatusNotFound && method == http.MethodGet {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, action.Href)
+	}
+
+	return nil, fmt.Errorf("%w: %s %s: %s %s", ErrBatchFailed, method, action.Href, res.Status, e.Message)
+}
@@ -0,0 +1,78 @@
+package lfs_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/lfs"
+	"github.com/go-git/go-git/v5/plumbing/lfs/lfstest"
+	"github.com/stretchr/testify/suite"
+)
+
+type ClientSuite struct {
+	suite.Suite
+	server *lfstest.Server
+	client *lfs.Client
+}
+
+func TestClientSuite(t *testing.T) {
+	suite.Run(t, new(ClientSuite))
+}
+
+func (s *ClientSuite) SetupTest() {
+	s.server = lfstest.NewServer()
+
+	var err error
+	s.client, err = lfs.NewClient(s.server.Endpoint(), nil)
+	s.Require().NoError(err)
+}
+
+func (s *ClientSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *ClientSuite) TestGet() {
+	p := s.server.Add([]byte("foo\n"))
+
+	rd, err := s.client.Get(p)
+	s.NoError(err)
+	content, err := io.ReadAll(rd)
+	s.NoError(err)
+	s.NoError(rd.Close())
+	s.Equal("foo\n", string(content))
+	s.Equal(1, s.server.Requests(lfs.OperationDownload))
+
+	_, err = s.client.Get(&lfs.Pointer{Oid: strings.Repeat("0", 64), Size: 1})
+	s.ErrorIs(err, lfs.ErrObjectNotFound)
+}
+
+func (s *ClientSuite) TestGetInvalidObject() {
+	p := s.server.Add([]byte("foo\n"))
+	p.Size = 3
+
+	rd, err := s.client.Get(p)
+	s.NoError(err)
+	_, err = io.ReadAll(rd)
+	s.ErrorIs(err, lfs.ErrInvalidObject)
+	s.NoError(rd.Close())
+}
+
+func (s *ClientSuite) TestPut() {
+	p, err := lfs.NewPointer(strings.NewReader("foo\n"))
+	s.NoError(err)
+
+	s.NoError(s.client.Put(p, strings.NewReader("foo\n")))
+	content, ok := s.server.Object(p.Oid)
+	s.True(ok)
+	s.Equal("foo\n", string(content))
+
+	// The objects already in the server aren't uploaded.
+	s.NoError(s.client.Put(p, strings.NewReader("")))
+	s.Equal(2, s.server.Requests(lfs.OperationUpload))
+}
+
+func (s *ClientSuite) TestNewClientInvalidEndpoint() {
+	_, err := lfs.NewClient("ssh://example.com/foo.git/info/lfs", nil)
+	s.Error(err)
+}
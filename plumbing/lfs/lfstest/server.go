@@ -0,0 +1,153 @@
+// Package lfstest implements a Git LFS server for tests.
+package lfstest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing/lfs"
+)
+
+// Server is a stand-in of a Git LFS server, serving the batch API with the
+// basic transfer adapter from the objects kept in memory. It must be closed
+// with Close.
+type Server struct {
+	*httptest.Server
+
+	m        sync.Mutex
+	objects  map[string][]byte
+	requests map[string]int
+}
+
+// NewServer starts and returns a new Server.
+func NewServer() *Server {
+	s := &Server{objects: make(map[string][]byte), requests: make(map[string]int)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /objects/batch", s.batch)
+	mux.HandleFunc("GET /objects/{oid}", s.download)
+	mux.HandleFunc("PUT /objects/{oid}", s.upload)
+	mux.HandleFunc("POST /verify", s.verify)
+
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Endpoint returns the endpoint of the server, to be used by lfs.NewClient
+// or set as the lfs.url option.
+func (s *Server) Endpoint() string {
+	return s.URL
+}
+
+// Add adds an object with the given content to the server, returning its
+// pointer.
+func (s *Server) Add(content []byte) *lfs.Pointer {
+	p, _ := lfs.NewPointer(bytes.NewReader(content))
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.objects[p.Oid] = content
+	return p
+}
+
+// Object returns the content of the object with the given oid, and whether
+// the server has it.
+func (s *Server) Object(oid string) ([]byte, bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	content, ok := s.objects[oid]
+	return content, ok
+}
+
+// Requests returns the number of batch requests received for the given
+// operation.
+func (s *Server) Requests(operation string) int {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.requests[operation]
+}
+
+func (s *Server) batch(w http.ResponseWriter, r *http.Request) {
+	var req lfs.BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, &lfs.BatchError{Message: err.Error()})
+		return
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.requests[req.Operation]++
+	res := &lfs.BatchResponse{Transfer: lfs.TransferBasic, HashAlgo: lfs.HashAlgo}
+	for _, o := range req.Objects {
+		obj := &lfs.BatchObject{Oid: o.Oid, Size: o.Size}
+		res.Objects = append(res.Objects, obj)
+
+		_, found := s.objects[o.Oid]
+		href := &lfs.BatchAction{Href: s.URL + "/objects/" + o.Oid}
+		switch {
+		case req.Operation == lfs.OperationDownload && found:
+			obj.Actions = map[string]*lfs.BatchAction{lfs.OperationDownload: href}
+		case req.Operation == lfs.OperationDownload:
+			obj.Error = &lfs.BatchError{Code: http.StatusNotFound, Message: "object not found"}
+		case req.Operation == lfs.OperationUpload && !found:
+			obj.Actions = map[string]*lfs.BatchAction{
+				lfs.OperationUpload: href,
+				"verify":            {Href: s.URL + "/verify"},
+			}
+		}
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) download(w http.ResponseWriter, r *http.Request) {
+	content, ok := s.Object(r.PathValue("oid"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, &lfs.BatchError{Message: "object not found"})
+		return
+	}
+
+	_, _ = w.Write(content)
+}
+
+func (s *Server) upload(w http.ResponseWriter, r *http.Request) {
+	content, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, &lfs.BatchError{Message: err.Error()})
+		return
+	}
+
+	p, _ := lfs.NewPointer(bytes.NewReader(content))
+	if p.Oid != r.PathValue("oid") {
+		writeJSON(w, http.StatusUnprocessableEntity, &lfs.BatchError{Message: "oid mismatch"})
+		return
+	}
+
+	s.Add(content)
+}
+
+func (s *Server) verify(w http.ResponseWriter, r *http.Request) {
+	var obj lfs.BatchObject
+	if err := json.NewDecoder(r.Body).Decode(&obj); err != nil {
+		writeJSON(w, http.StatusBadRequest, &lfs.BatchError{Message: err.Error()})
+		return
+	}
+
+	if content, ok := s.Object(obj.Oid); !ok || int64(len(content)) != obj.Size {
+		writeJSON(w, http.StatusNotFound, &lfs.BatchError{Message: "object not found"})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", lfs.MediaType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,149 @@
+// Package lfs implements the pointer files of Git LFS, and the storage of the
+// objects they point to, in a local cache and in a server reached through
+// the batch API.
+//
+// See https://github.com/git-lfs/git-lfs/blob/main/docs/spec.md
+package lfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Version is the version of the pointer files written.
+	Version = "https://git-lfs.github.com/spec/v1"
+	// legacyVersion is the version of the pointer files written by the
+	// early versions of Git LFS, still accepted.
+	legacyVersion = "https://hawser.github.com/spec/v1"
+
+	// MaxPointerSize is the maximum size of a pointer file, larger files
+	// aren't considered pointers.
+	MaxPointerSize = 1024
+
+	// HashAlgo is the algorithm used to name the objects.
+	HashAlgo = "sha256"
+
+	versionKey = "version"
+	oidKey     = "oid"
+	sizeKey    = "size"
+)
+
+// ErrInvalidPointer is returned when decoding content that isn't a valid
+// pointer file.
+var ErrInvalidPointer = errors.New("invalid lfs pointer")
+
+// Pointer is the content of a pointer file, committed to the repository in
+// place of the content of a file tracked by Git LFS.
+type Pointer struct {
+	// Oid is the SHA-256 hash of the content of the object, hex encoded.
+	Oid string
+	// Size is the size of the content of the object, in bytes.
+	Size int64
+}
+
+// NewPointer returns the Pointer to the object with the content read from r.
+func NewPointer(r io.Reader) (*Pointer, error) {
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pointer{Oid: hex.EncodeToString(h.Sum(nil)), Size: n}, nil
+}
+
+// DecodePointer decodes the content of a pointer file. It returns
+// ErrInvalidPointer if the content isn't a valid pointer.
+func DecodePointer(content []byte) (*Pointer, error) {
+	if len(content) == 0 || len(content) > MaxPointerSize || content[len(content)-1] != '\n' {
+		return nil, ErrInvalidPointer
+	}
+
+	p := &Pointer{Size: -1}
+	lines := strings.Split(string(content[:len(content)-1]), "\n")
+	for i, l := range lines {
+		key, value, ok := strings.Cut(l, " ")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%w: malformed line %q", ErrInvalidPointer, l)
+		}
+
+		// The version comes first, the other keys are sorted.
+		if i == 0 {
+			if key != versionKey || (value != Version && value != legacyVersion) {
+				return nil, fmt.Errorf("%w: unknown version %q", ErrInvalidPointer, value)
+			}
+
+			continue
+		}
+
+		if i > 1 && key <= strings.SplitN(lines[i-1], " ", 2)[0] {
+			return nil, fmt.Errorf("%w: unsorted key %q", ErrInvalidPointer, key)
+		}
+
+		switch key {
+		case oidKey:
+			algo, oid, _ := strings.Cut(value, ":")
+			if algo != HashAlgo || !isValidOid(oid) {
+				return nil, fmt.Errorf("%w: invalid oid %q", ErrInvalidPointer, value)
+			}
+
+			p.Oid = oid
+		case sizeKey:
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size < 0 {
+				return nil, fmt.Errorf("%w: invalid size %q", ErrInvalidPointer, value)
+			}
+
+			p.Size = size
+		}
+	}
+
+	if p.Oid == "" || p.Size < 0 {
+		return nil, fmt.Errorf("%w: missing oid or size", ErrInvalidPointer)
+	}
+
+	return p, nil
+}
+
+// IsPointer returns whether the content is a valid pointer file.
+func IsPointer(content []byte) bool {
+	_, err := DecodePointer(content)
+	return err == nil
+}
+
+// Encode writes the pointer file of p to w.
+func (p *Pointer) Encode(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "%s %s\n%s %s:%s\n%s %d\n",
+		versionKey, Version, oidKey, HashAlgo, p.Oid, sizeKey, p.Size,
+	)
+
+	return err
+}
+
+// Bytes returns the content of the pointer file of p.
+func (p *Pointer) Bytes() []byte {
+	var b bytes.Buffer
+	_ = p.Encode(&b)
+	return b.Bytes()
+}
+
+func isValidOid(oid string) bool {
+	if len(oid) != sha256.Size*2 {
+		return false
+	}
+
+	for _, c := range oid {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
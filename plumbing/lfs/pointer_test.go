@@ -0,0 +1,64 @@
+package lfs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	fooOid     = "b5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c"
+	fooPointer = "version https://git-lfs.github.com/spec/v1\n" +
+		"oid sha256:" + fooOid + "\n" +
+		"size 4\n"
+)
+
+type PointerSuite struct {
+	suite.Suite
+}
+
+func TestPointerSuite(t *testing.T) {
+	suite.Run(t, new(PointerSuite))
+}
+
+func (s *PointerSuite) TestNewPointer() {
+	p, err := NewPointer(strings.NewReader("foo\n"))
+	s.NoError(err)
+	s.Equal(&Pointer{Oid: fooOid, Size: 4}, p)
+	s.Equal(fooPointer, string(p.Bytes()))
+}
+
+func (s *PointerSuite) TestDecodePointer() {
+	p, err := DecodePointer([]byte(fooPointer))
+	s.NoError(err)
+	s.Equal(&Pointer{Oid: fooOid, Size: 4}, p)
+
+	// The extensions are ignored, the version of early releases is valid.
+	p, err = DecodePointer([]byte("version https://hawser.github.com/spec/v1\n" +
+		"ext-0-foo sha256:" + fooOid + "\n" +
+		"oid sha256:" + fooOid + "\n" +
+		"size 4\n",
+	))
+	s.NoError(err)
+	s.Equal(&Pointer{Oid: fooOid, Size: 4}, p)
+}
+
+func (s *PointerSuite) TestDecodePointerInvalid() {
+	for _, content := range []string{
+		"",
+		"foo\n",
+		strings.TrimSuffix(fooPointer, "\n"),
+		strings.Replace(fooPointer, "spec/v1", "spec/v2", 1),
+		strings.Replace(fooPointer, "sha256", "sha1", 1),
+		strings.Replace(fooPointer, "b5bb", "B5BB", 1),
+		strings.Replace(fooPointer, "size 4", "size -4", 1),
+		strings.Replace(fooPointer, "size 4\n", "", 1),
+		"version https://git-lfs.github.com/spec/v1\nsize 4\noid sha256:" + fooOid + "\n",
+		fooPointer + strings.Repeat("x", MaxPointerSize) + "\n",
+	} {
+		_, err := DecodePointer([]byte(content))
+		s.ErrorIs(err, ErrInvalidPointer, content)
+		s.False(IsPointer([]byte(content)))
+	}
+}
@@ -0,0 +1,260 @@
+package lfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+)
+
+var (
+	// ErrObjectNotFound is returned when an object isn't in a Store.
+	ErrObjectNotFound = errors.New("lfs object not found")
+	// ErrInvalidObject is returned when the content of an object doesn't
+	// match its pointer.
+	ErrInvalidObject = errors.New("lfs object doesn't match its pointer")
+)
+
+// Store stores the content of the objects pointed by the pointer files.
+type Store interface {
+	// Get returns a reader of the content of the object p, it returns
+	// ErrObjectNotFound if the object isn't in the store.
+	Get(p *Pointer) (io.ReadCloser, error)
+	// Put stores the object p with the content read from r, it returns
+	// ErrInvalidObject if the content doesn't match the pointer.
+	Put(p *Pointer, r io.Reader) error
+}
+
+// ContentStore is implemented by the stores which can put an object without
+// knowing its pointer beforehand, computing it as the content is stored.
+type ContentStore interface {
+	// PutContent stores the content read from r, returning the pointer to
+	// the object.
+	PutContent(r io.Reader) (*Pointer, error)
+}
+
+// PutContent stores the content read from r in s, returning the pointer to
+// the object. The content is streamed if s is a ContentStore, otherwise it's
+// read into memory to compute the pointer before putting it.
+func PutContent(s Store, r io.Reader) (*Pointer, error) {
+	if cs, ok := s.(ContentStore); ok {
+		return cs.PutContent(r)
+	}
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := NewPointer(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	return p, s.Put(p, bytes.NewReader(content))
+}
+
+// LocalStore is a Store keeping the objects in a filesystem, with the same
+// layout as the .git/lfs/objects directory used by Git LFS.
+type LocalStore struct {
+	fs billy.Filesystem
+}
+
+// NewLocalStore returns a LocalStore keeping the objects in fs, usually the
+// .git/lfs/objects directory.
+func NewLocalStore(fs billy.Filesystem) *LocalStore {
+	return &LocalStore{fs: fs}
+}
+
+// Get returns a reader of the content of the object p.
+func (s *LocalStore) Get(p *Pointer) (io.ReadCloser, error) {
+	if !isValidOid(p.Oid) {
+		return nil, fmt.Errorf("%w: invalid oid %q", ErrInvalidPointer, p.Oid)
+	}
+
+	f, err := s.fs.Open(objectPath(p.Oid))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, p.Oid)
+	}
+
+	return f, err
+}
+
+// Put stores the object p, it does nothing if the object is already stored.
+func (s *LocalStore) Put(p *Pointer, r io.Reader) (err error) {
+	if !isValidOid(p.Oid) {
+		return fmt.Errorf("%w: invalid oid %q", ErrInvalidPointer, p.Oid)
+	}
+
+	name := objectPath(p.Oid)
+	if fi, err := s.fs.Stat(name); err == nil && fi.Size() == p.Size {
+		return nil
+	}
+
+	// The content is written to a temporary file first, so an object is
+	// never read while being written, nor left incomplete.
+	if err := s.fs.MkdirAll(path.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := util.TempFile(s.fs, path.Dir(name), "tmp_"+p.Oid)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = s.fs.Remove(tmp.Name())
+		}
+	}()
+
+	_, err = io.Copy(tmp, NewVerifyReader(p, r))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return s.fs.Rename(tmp.Name(), name)
+}
+
+// PutContent stores the content read from r, hashing it as it's written to a
+// temporary file, so it's never held in memory.
+func (s *LocalStore) PutContent(r io.Reader) (p *Pointer, err error) {
+	tmp, err := util.TempFile(s.fs, ".", "tmp_")
+	if err != nil {
+		return nil, err
+	}
+
+	stored := false
+	defer func() {
+		if !stored {
+			_ = s.fs.Remove(tmp.Name())
+		}
+	}()
+
+	h := sha256.New()
+	n, err := io.Copy(tmp, io.TeeReader(r, h))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	p = &Pointer{Oid: hex.EncodeToString(h.Sum(nil)), Size: n}
+	name := objectPath(p.Oid)
+	if fi, err := s.fs.Stat(name); err == nil && fi.Size() == p.Size {
+		return p, nil
+	}
+
+	if err := s.fs.MkdirAll(path.Dir(name), 0o755); err != nil {
+		return nil, err
+	}
+
+	if err := s.fs.Rename(tmp.Name(), name); err != nil {
+		return nil, err
+	}
+
+	stored = true
+	return p, nil
+}
+
+func objectPath(oid string) string {
+	return path.Join(oid[0:2], oid[2:4], oid)
+}
+
+// CachedStore is a Store getting the objects from a remote store, caching
+// them in a local one. The objects are only put in the local store.
+type CachedStore struct {
+	local  Store
+	remote Store
+}
+
+// NewCachedStore returns a CachedStore caching in local the objects of
+// remote, remote can be nil if there isn't one.
+func NewCachedStore(local, remote Store) *CachedStore {
+	return &CachedStore{local: local, remote: remote}
+}
+
+// Get returns a reader of the content of the object p, from the local store
+// or, if not found there, from the remote one after caching it.
+func (s *CachedStore) Get(p *Pointer) (io.ReadCloser, error) {
+	rd, err := s.local.Get(p)
+	if !errors.Is(err, ErrObjectNotFound) || s.remote == nil {
+		return rd, err
+	}
+
+	rd, err = s.remote.Get(p)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.local.Put(p, rd)
+	if cerr := rd.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.local.Get(p)
+}
+
+// Put stores the object p in the local store.
+func (s *CachedStore) Put(p *Pointer, r io.Reader) error {
+	return s.local.Put(p, r)
+}
+
+// PutContent stores the content read from r in the local store, returning the
+// pointer to the object.
+func (s *CachedStore) PutContent(r io.Reader) (*Pointer, error) {
+	return PutContent(s.local, r)
+}
+
+type verifyReader struct {
+	r io.Reader
+	p *Pointer
+	h hash.Hash
+	n int64
+}
+
+// NewVerifyReader returns a reader of r which fails with ErrInvalidObject,
+// instead of io.EOF, if the content read doesn't match the pointer p.
+func NewVerifyReader(p *Pointer, r io.Reader) io.Reader {
+	return &verifyReader{r: r, p: p, h: sha256.New()}
+}
+
+func (r *verifyReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.h.Write(b[:n])
+	r.n += int64(n)
+
+	if r.n > r.p.Size {
+		return n, fmt.Errorf("%w: %s: size exceeds %d", ErrInvalidObject, r.p.Oid, r.p.Size)
+	}
+
+	if err == io.EOF {
+		if r.n != r.p.Size {
+			return n, fmt.Errorf("%w: %s: size %d, expected %d", ErrInvalidObject, r.p.Oid, r.n, r.p.Size)
+		}
+
+		if oid := hex.EncodeToString(r.h.Sum(nil)); oid != r.p.Oid {
+			return n, fmt.Errorf("%w: %s: content hashes to %s", ErrInvalidObject, r.p.Oid, oid)
+		}
+	}
+
+	return n, err
+}
@@ -0,0 +1,98 @@
+package lfs
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/stretchr/testify/suite"
+)
+
+type StoreSuite struct {
+	suite.Suite
+}
+
+func TestStoreSuite(t *testing.T) {
+	suite.Run(t, new(StoreSuite))
+}
+
+func (s *StoreSuite) TestLocalStore() {
+	fs := memfs.New()
+	st := NewLocalStore(fs)
+	p := &Pointer{Oid: fooOid, Size: 4}
+
+	_, err := st.Get(p)
+	s.ErrorIs(err, ErrObjectNotFound)
+
+	s.NoError(st.Put(p, strings.NewReader("foo\n")))
+	content, err := util.ReadFile(fs, "b5/bb/"+fooOid)
+	s.NoError(err)
+	s.Equal("foo\n", string(content))
+
+	rd, err := st.Get(p)
+	s.NoError(err)
+	content, err = io.ReadAll(rd)
+	s.NoError(err)
+	s.NoError(rd.Close())
+	s.Equal("foo\n", string(content))
+}
+
+func (s *StoreSuite) TestLocalStorePutContent() {
+	fs := memfs.New()
+	st := NewLocalStore(fs)
+
+	for i := 0; i < 2; i++ {
+		p, err := st.PutContent(strings.NewReader("foo\n"))
+		s.NoError(err)
+		s.Equal(&Pointer{Oid: fooOid, Size: 4}, p)
+	}
+
+	content, err := util.ReadFile(fs, "b5/bb/"+fooOid)
+	s.NoError(err)
+	s.Equal("foo\n", string(content))
+
+	files, err := util.Glob(fs, "tmp_*")
+	s.NoError(err)
+	s.Empty(files)
+}
+
+func (s *StoreSuite) TestLocalStoreInvalidObject() {
+	fs := memfs.New()
+	st := NewLocalStore(fs)
+
+	err := st.Put(&Pointer{Oid: fooOid, Size: 4}, strings.NewReader("bar\n"))
+	s.ErrorIs(err, ErrInvalidObject)
+
+	err = st.Put(&Pointer{Oid: fooOid, Size: 3}, strings.NewReader("foo\n"))
+	s.ErrorIs(err, ErrInvalidObject)
+
+	err = st.Put(&Pointer{Oid: "../foo", Size: 3}, strings.NewReader("foo\n"))
+	s.ErrorIs(err, ErrInvalidPointer)
+
+	files, err := util.Glob(fs, "b5/bb/*")
+	s.NoError(err)
+	s.Empty(files)
+}
+
+func (s *StoreSuite) TestCachedStore() {
+	local, remote := NewLocalStore(memfs.New()), NewLocalStore(memfs.New())
+	st := NewCachedStore(local, remote)
+	p := &Pointer{Oid: fooOid, Size: 4}
+
+	_, err := st.Get(p)
+	s.ErrorIs(err, ErrObjectNotFound)
+
+	s.NoError(remote.Put(p, strings.NewReader("foo\n")))
+	rd, err := st.Get(p)
+	s.NoError(err)
+	s.NoError(rd.Close())
+
+	rd, err = local.Get(p)
+	s.NoError(err)
+	s.NoError(rd.Close())
+
+	_, err = NewCachedStore(local, nil).Get(&Pointer{Oid: strings.Repeat("0", 64)})
+	s.ErrorIs(err, ErrObjectNotFound)
+}
@@ -0,0 +1,299 @@
+package object
+
+import (
+	"container/heap"
+	"math"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	commitgraph "github.com/go-git/go-git/v5/plumbing/format/commitgraph/v2"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// graphNode is a commit as needed to compute its reachability: its parents,
+// its generation number and its commit time.
+type graphNode struct {
+	hash       plumbing.Hash
+	parents    []plumbing.Hash
+	generation uint64
+	when       time.Time
+}
+
+// graphNodes loads the commits of a storer as graphNodes, from its
+// commit-graph when it has them or decoding them otherwise.
+type graphNodes struct {
+	s     storer.EncodedObjectStorer
+	index commitgraph.Index
+	nodes map[plumbing.Hash]*graphNode
+}
+
+// newGraphNodes returns the graphNodes of the given storer, or nil if it has
+// no commit-graph.
+func newGraphNodes(s storer.EncodedObjectStorer) *graphNodes {
+	cgs, ok := s.(storer.CommitGraphStorer)
+	if !ok {
+		return nil
+	}
+
+	index, err := cgs.CommitGraph()
+	if err != nil || index == nil {
+		return nil
+	}
+
+	return &graphNodes{
+		s:     s,
+		index: index,
+		nodes: make(map[plumbing.Hash]*graphNode),
+	}
+}
+
+// get returns the node of the given commit. The commits out of the
+// commit-graph have the highest generation, as they can't be reached from
+// the ones in it.
+func (g *graphNodes) get(h plumbing.Hash) (*graphNode, error) {
+	if n, ok := g.nodes[h]; ok {
+		return n, nil
+	}
+
+	n := &graphNode{hash: h}
+	if i, err := g.index.GetIndexByHash(h); err == nil {
+		data, err := g.index.GetCommitDataByIndex(i)
+		if err != nil {
+			return nil, err
+		}
+
+		n.parents, n.when = data.ParentHashes, data.When
+		n.generation = data.Generation
+		if g.index.HasGenerationV2() {
+			n.generation = data.GenerationV2
+		}
+	} else {
+		c, err := GetCommit(g.s, h)
+		if err != nil {
+			return nil, err
+		}
+
+		n.parents, n.when = c.ParentHashes, c.Committer.When
+		n.generation = math.MaxUint64
+	}
+
+	g.nodes[h] = n
+	return n, nil
+}
+
+// commits returns the given commits, sorted by committer.When desc.
+func (g *graphNodes) commits(hashes []plumbing.Hash) ([]*Commit, error) {
+	commits := make([]*Commit, len(hashes))
+	for i, h := range hashes {
+		c, err := GetCommit(g.s, h)
+		if err != nil {
+			return nil, err
+		}
+
+		commits[i] = c
+	}
+
+	return sortByCommitDateDesc(commits...), nil
+}
+
+const (
+	graphParent1 = 1 << iota
+	graphParent2
+	graphStale
+	graphResult
+)
+
+// mergeBases returns the common ancestors of the given commits not reachable
+// from other common ancestors, as paint_down_to_common does in git, walking
+// the history by generation number.
+func (g *graphNodes) mergeBases(one, two plumbing.Hash) ([]plumbing.Hash, error) {
+	if one == two {
+		return []plumbing.Hash{one}, nil
+	}
+
+	flags := make(map[plumbing.Hash]uint8)
+	queue := &graphNodeQueue{}
+	for h, flag := range map[plumbing.Hash]uint8{one: graphParent1, two: graphParent2} {
+		n, err := g.get(h)
+		if err != nil {
+			return nil, err
+		}
+
+		flags[h] = flag
+		heap.Push(queue, n)
+	}
+
+	var results []plumbing.Hash
+	for queue.hasNonStale(flags) {
+		n := heap.Pop(queue).(*graphNode)
+		f := flags[n.hash] & (graphParent1 | graphParent2 | graphStale)
+		if f == graphParent1|graphParent2 {
+			if flags[n.hash]&graphResult == 0 {
+				flags[n.hash] |= graphResult
+				results = append(results, n.hash)
+			}
+
+			f |= graphStale
+		}
+
+		for _, p := range n.parents {
+			if flags[p]&f == f {
+				continue
+			}
+
+			pn, err := g.get(p)
+			if err != nil {
+				return nil, err
+			}
+
+			flags[p] |= f
+			heap.Push(queue, pn)
+		}
+	}
+
+	var bases []plumbing.Hash
+	for _, h := range results {
+		if flags[h]&graphStale == 0 {
+			bases = append(bases, h)
+		}
+	}
+
+	return g.independents(bases)
+}
+
+// independents returns the given commits not reachable from the others.
+func (g *graphNodes) independents(hashes []plumbing.Hash) ([]plumbing.Hash, error) {
+	var res []plumbing.Hash
+	for i, h := range hashes {
+		var others []plumbing.Hash
+		for j, other := range hashes {
+			if i != j && other != h {
+				others = append(others, other)
+			}
+		}
+
+		reachable, err := g.reachable(others, h)
+		if err != nil {
+			return nil, err
+		}
+
+		if !reachable {
+			res = append(res, h)
+		}
+	}
+
+	return res, nil
+}
+
+// reachable returns whether the target commit is reachable from the given
+// ones, not walking the commits with a lower generation than the target.
+func (g *graphNodes) reachable(from []plumbing.Hash, target plumbing.Hash) (bool, error) {
+	t, err := g.get(target)
+	if err != nil {
+		return false, err
+	}
+
+	seen := make(map[plumbing.Hash]bool)
+	stack := append([]plumbing.Hash(nil), from...)
+	for len(stack) > 0 {
+		h := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if h == target {
+			return true, nil
+		}
+
+		if seen[h] {
+			continue
+		}
+
+		seen[h] = true
+		n, err := g.get(h)
+		if err != nil {
+			return false, err
+		}
+
+		if n.generation < t.generation {
+			continue
+		}
+
+		stack = append(stack, n.parents...)
+	}
+
+	return false, nil
+}
+
+// graphNodeQueue is a priority queue of graphNodes, by generation and then
+// by commit time.
+type graphNodeQueue []*graphNode
+
+func (q graphNodeQueue) Len() int { return len(q) }
+
+func (q graphNodeQueue) Less(i, j int) bool {
+	if q[i].generation != q[j].generation {
+		return q[i].generation > q[j].generation
+	}
+
+	return q[i].when.After(q[j].when)
+}
+
+func (q graphNodeQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *graphNodeQueue) Push(x interface{}) { *q = append(*q, x.(*graphNode)) }
+
+func (q *graphNodeQueue) Pop() interface{} {
+	old := *q
+	n := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return n
+}
+
+// hasNonStale returns whether the queue has commits not reachable from a
+// common ancestor yet.
+func (q graphNodeQueue) hasNonStale(flags map[plumbing.Hash]uint8) bool {
+	for _, n := range q {
+		if flags[n.hash]&graphStale == 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bloomFilters looks up the changed-path Bloom filters of the commits in the
+// commit-graph of a storer.
+type bloomFilters struct {
+	index commitgraph.BloomFilterIndex
+}
+
+// newBloomFilters returns the bloomFilters of the given storer, without
+// filters if it has no commit-graph.
+func newBloomFilters(s storer.EncodedObjectStorer) *bloomFilters {
+	b := &bloomFilters{}
+	if cgs, ok := s.(storer.CommitGraphStorer); ok {
+		if index, err := cgs.CommitGraph(); err == nil && index != nil {
+			b.index, _ = index.(commitgraph.BloomFilterIndex)
+		}
+	}
+
+	return b
+}
+
+// get returns the changed-path Bloom filter of the given commit, or nil if it
+// has none.
+func (b *bloomFilters) get(h plumbing.Hash) *commitgraph.BloomFilter {
+	if b.index == nil {
+		return nil
+	}
+
+	i, err := b.index.GetIndexByHash(h)
+	if err != nil {
+		return nil
+	}
+
+	filter, err := b.index.GetBloomFilterByIndex(i)
+	if err != nil {
+		return nil
+	}
+
+	return filter
+}
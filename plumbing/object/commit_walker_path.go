@@ -12,6 +12,10 @@ type commitPathIter struct {
 	sourceIter    CommitIter
 	currentCommit *Commit
 	checkParent   bool
+	// paths are the paths matched by pathFilter, if known, to look them up
+	// in the changed-path Bloom filters of the commit-graph.
+	paths        []string
+	bloomFilters *bloomFilters
 }
 
 // NewCommitPathIterFromIter returns a commit iterator which performs diffTree between
@@ -28,15 +32,20 @@ func NewCommitPathIterFromIter(pathFilter func(string) bool, commitIter CommitIt
 	return iterator
 }
 
-// NewCommitFileIterFromIter is kept for compatibility, can be replaced with NewCommitPathIterFromIter
+// NewCommitFileIterFromIter returns a commit iterator as NewCommitPathIterFromIter
+// does, for the commits changing the given file. The changed-path Bloom filters
+// of the commit-graph, if any, are used to skip the commits not changing it
+// without diffing their trees.
 func NewCommitFileIterFromIter(fileName string, commitIter CommitIter, checkParent bool) CommitIter {
-	return NewCommitPathIterFromIter(
+	iterator := NewCommitPathIterFromIter(
 		func(path string) bool {
 			return path == fileName
 		},
 		commitIter,
 		checkParent,
-	)
+	).(*commitPathIter)
+	iterator.paths = []string{fileName}
+	return iterator
 }
 
 func (c *commitPathIter) Next() (*Commit, error) {
@@ -70,6 +79,17 @@ func (c *commitPathIter) getNextFileCommit() (*Commit, error) {
 			parentCommit = nil
 		}
 
+		// The trees aren't diffed if the path wasn't changed for sure
+		if !c.mayChangePaths(parentCommit) {
+			parentTree = nil
+			c.currentCommit = parentCommit
+			if parentCommit == nil {
+				return nil, io.EOF
+			}
+
+			continue
+		}
+
 		if parentTree == nil {
 			var currTreeErr error
 			currentTree, currTreeErr = c.currentCommit.Tree()
@@ -134,6 +154,37 @@ func (c *commitPathIter) hasFileChange(changes Changes, parent *Commit) bool {
 	return false
 }
 
+// mayChangePaths returns false if the current commit doesn't change the paths
+// from the given one for sure, according to its changed-path Bloom filter.
+func (c *commitPathIter) mayChangePaths(parent *Commit) bool {
+	if len(c.paths) == 0 {
+		return true
+	}
+
+	// The filter has the paths changed from the first parent
+	if parent == nil && c.currentCommit.NumParents() != 0 ||
+		parent != nil && (c.currentCommit.NumParents() == 0 || c.currentCommit.ParentHashes[0] != parent.Hash) {
+		return true
+	}
+
+	if c.bloomFilters == nil {
+		c.bloomFilters = newBloomFilters(c.currentCommit.s)
+	}
+
+	filter := c.bloomFilters.get(c.currentCommit.Hash)
+	if filter == nil {
+		return true
+	}
+
+	for _, path := range c.paths {
+		if filter.Contains(path) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func isParentHash(hash plumbing.Hash, commit *Commit) bool {
 	for _, h := range commit.ParentHashes {
 		if h == hash {
@@ -0,0 +1,61 @@
+package commitgraph
+
+import (
+	"io"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+type commitNodeCommitIter struct {
+	iter   CommitNodeIter
+	filter func(CommitNode) bool
+}
+
+// NewCommitIter returns a CommitIter with the commits of the nodes of the
+// given CommitNodeIter for which filter returns true, or all of them if
+// filter is nil. Only the commits returned are decoded, the nodes filtered
+// out are just walked.
+func NewCommitIter(iter CommitNodeIter, filter func(CommitNode) bool) object.CommitIter {
+	return &commitNodeCommitIter{iter: iter, filter: filter}
+}
+
+func (i *commitNodeCommitIter) Next() (*object.Commit, error) {
+	for {
+		node, err := i.iter.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		if i.filter != nil && !i.filter(node) {
+			continue
+		}
+
+		return node.Commit()
+	}
+}
+
+func (i *commitNodeCommitIter) ForEach(cb func(*object.Commit) error) error {
+	defer i.Close()
+	for {
+		c, err := i.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := cb(c); err != nil {
+			if err == storer.ErrStop {
+				return nil
+			}
+
+			return err
+		}
+	}
+}
+
+func (i *commitNodeCommitIter) Close() {
+	i.iter.Close()
+}
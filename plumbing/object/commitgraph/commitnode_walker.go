@@ -0,0 +1,238 @@
+package commitgraph
+
+import (
+	"io"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// commitNodeParents are the parents of a commit node left to walk.
+type commitNodeParents struct {
+	node    CommitNode
+	parents []int
+}
+
+type commitNodePreIterator struct {
+	seenExternal map[plumbing.Hash]bool
+	seen         map[plumbing.Hash]bool
+	stack        []*commitNodeParents
+	start        CommitNode
+}
+
+// NewCommitNodeIterPreorder returns a CommitNodeIter that walks the commit
+// history, starting at the given commit and visiting its parents in
+// pre-order, as object.NewCommitPreorderIter does.
+// The given callback will be called for each visited commit. Each commit will
+// be visited only once. If the callback returns an error, walking will stop
+// and will return the error. Other errors might be returned if the history
+// cannot be traversed (e.g. missing objects). Ignore allows to skip some
+// commits from being iterated.
+func NewCommitNodeIterPreorder(
+	c CommitNode,
+	seenExternal map[plumbing.Hash]bool,
+	ignore []plumbing.Hash,
+) CommitNodeIter {
+	seen := make(map[plumbing.Hash]bool)
+	for _, h := range ignore {
+		seen[h] = true
+	}
+
+	return &commitNodePreIterator{
+		seenExternal: seenExternal,
+		seen:         seen,
+		start:        c,
+	}
+}
+
+func (w *commitNodePreIterator) Next() (CommitNode, error) {
+	var c CommitNode
+	for {
+		if w.start != nil {
+			c = w.start
+			w.start = nil
+		} else {
+			current := len(w.stack) - 1
+			if current < 0 {
+				return nil, io.EOF
+			}
+
+			top := w.stack[current]
+			if len(top.parents) == 0 {
+				w.stack = w.stack[:current]
+				continue
+			}
+
+			var err error
+			c, err = top.node.ParentNode(top.parents[0])
+			if err != nil {
+				return nil, err
+			}
+
+			top.parents = top.parents[1:]
+		}
+
+		if w.seen[c.ID()] || w.seenExternal[c.ID()] {
+			continue
+		}
+
+		w.seen[c.ID()] = true
+
+		parents := &commitNodeParents{node: c}
+		for i, h := range c.ParentHashes() {
+			if !w.seen[h] {
+				parents.parents = append(parents.parents, i)
+			}
+		}
+
+		if len(parents.parents) > 0 {
+			w.stack = append(w.stack, parents)
+		}
+
+		return c, nil
+	}
+}
+
+func (w *commitNodePreIterator) ForEach(cb func(CommitNode) error) error {
+	return forEachCommitNode(w, cb)
+}
+
+func (w *commitNodePreIterator) Close() {}
+
+type commitNodePostIterator struct {
+	stack []CommitNode
+	seen  map[plumbing.Hash]bool
+}
+
+// NewCommitNodeIterPostorder returns a CommitNodeIter that walks the commit
+// history in post-order, as object.NewCommitPostorderIter does. Ignore allows
+// to skip some commits from being iterated.
+func NewCommitNodeIterPostorder(c CommitNode, ignore []plumbing.Hash) CommitNodeIter {
+	seen := make(map[plumbing.Hash]bool)
+	for _, h := range ignore {
+		seen[h] = true
+	}
+
+	return &commitNodePostIterator{
+		stack: []CommitNode{c},
+		seen:  seen,
+	}
+}
+
+func (w *commitNodePostIterator) Next() (CommitNode, error) {
+	for {
+		if len(w.stack) == 0 {
+			return nil, io.EOF
+		}
+
+		c := w.stack[len(w.stack)-1]
+		w.stack = w.stack[:len(w.stack)-1]
+
+		if w.seen[c.ID()] {
+			continue
+		}
+
+		w.seen[c.ID()] = true
+
+		return c, c.ParentNodes().ForEach(func(p CommitNode) error {
+			w.stack = append(w.stack, p)
+			return nil
+		})
+	}
+}
+
+func (w *commitNodePostIterator) ForEach(cb func(CommitNode) error) error {
+	return forEachCommitNode(w, cb)
+}
+
+func (w *commitNodePostIterator) Close() {}
+
+type commitNodeBFSIterator struct {
+	seenExternal map[plumbing.Hash]bool
+	seen         map[plumbing.Hash]bool
+	queue        []CommitNode
+}
+
+// NewCommitNodeIterBSF returns a CommitNodeIter that walks the commit history
+// breadth-first, as object.NewCommitIterBSF does.
+// The given callback will be called for each visited commit. Each commit will
+// be visited only once. If the callback returns an error, walking will stop
+// and will return the error. Other errors might be returned if the history
+// cannot be traversed (e.g. missing objects). Ignore allows to skip some
+// commits from being iterated.
+func NewCommitNodeIterBSF(
+	c CommitNode,
+	seenExternal map[plumbing.Hash]bool,
+	ignore []plumbing.Hash,
+) CommitNodeIter {
+	seen := make(map[plumbing.Hash]bool)
+	for _, h := range ignore {
+		seen[h] = true
+	}
+
+	return &commitNodeBFSIterator{
+		seenExternal: seenExternal,
+		seen:         seen,
+		queue:        []CommitNode{c},
+	}
+}
+
+func (w *commitNodeBFSIterator) Next() (CommitNode, error) {
+	var c CommitNode
+	for {
+		if len(w.queue) == 0 {
+			return nil, io.EOF
+		}
+		c = w.queue[0]
+		w.queue = w.queue[1:]
+
+		if w.seen[c.ID()] || w.seenExternal[c.ID()] {
+			continue
+		}
+
+		w.seen[c.ID()] = true
+
+		for i, h := range c.ParentHashes() {
+			if w.seen[h] || w.seenExternal[h] {
+				continue
+			}
+
+			p, err := c.ParentNode(i)
+			if err != nil {
+				return nil, err
+			}
+
+			w.queue = append(w.queue, p)
+		}
+
+		return c, nil
+	}
+}
+
+func (w *commitNodeBFSIterator) ForEach(cb func(CommitNode) error) error {
+	return forEachCommitNode(w, cb)
+}
+
+func (w *commitNodeBFSIterator) Close() {}
+
+func forEachCommitNode(iter CommitNodeIter, cb func(CommitNode) error) error {
+	for {
+		c, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		err = cb(c)
+		if err == storer.ErrStop {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,670 @@
+package object
+
+import (
+	"context"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/utils/ioutil"
+	"github.com/go-git/go-git/v5/utils/merge"
+)
+
+// MergeConflictType is the kind of conflict found while merging trees.
+type MergeConflictType int8
+
+const (
+	// ContentConflict happens when both sides changed the content of a file,
+	// or added a file with different content, and the changes overlap.
+	ContentConflict MergeConflictType = iota
+	// ModeConflict happens when both sides changed the mode of a file to
+	// different values.
+	ModeConflict
+	// ModifyDeleteConflict happens when a file was deleted on one side, and
+	// modified on the other.
+	ModifyDeleteConflict
+	// BinaryConflict happens when both sides changed a file whose content
+	// cannot be merged, such as binary files, symbolic links or submodules.
+	BinaryConflict
+	// RenameConflict happens when a file was renamed to different paths on
+	// each side.
+	RenameConflict
+	// DirectoryFileConflict happens when one side added a file at a path
+	// where the other side has a directory.
+	DirectoryFileConflict
+)
+
+func (t MergeConflictType) String() string {
+	switch t {
+	case ContentConflict:
+		return "content"
+	case ModeConflict:
+		return "mode"
+	case ModifyDeleteConflict:
+		return "modify/delete"
+	case BinaryConflict:
+		return "binary"
+	case RenameConflict:
+		return "rename/rename"
+	case DirectoryFileConflict:
+		return "directory/file"
+	}
+
+	return "unknown"
+}
+
+// MergeConflict describes a path that could not be merged automatically.
+type MergeConflict struct {
+	// Type is the kind of conflict.
+	Type MergeConflictType
+	// Path is the path of the conflicting file.
+	Path string
+	// RenamedTo is the path where the file was moved to in the resulting
+	// tree, to make room for a directory with the same name. It is only set
+	// for DirectoryFileConflict.
+	RenamedTo string
+	// Base, Ours and Theirs are the entries of the file on each of the
+	// merged trees, with their Name set to the full path. They are nil when
+	// the file doesn't exist on the given tree.
+	Base, Ours, Theirs *TreeEntry
+}
+
+// MergeResult is the outcome of merging trees.
+type MergeResult struct {
+	// Tree is the hash of the resulting tree. Conflicting files are included
+	// with their best effort content, e.g. including conflict markers, so it
+	// can be inspected in the same way than the files left in the worktree
+	// by git merge.
+	Tree plumbing.Hash
+	// Conflicts are the paths that could not be merged, sorted by path.
+	Conflicts []MergeConflict
+}
+
+// IsClean returns true if the merge did not result in any conflict.
+func (r *MergeResult) IsClean() bool {
+	return len(r.Conflicts) == 0
+}
+
+// MergeTreesOptions are the options used to merge trees.
+type MergeTreesOptions struct {
+	// OursLabel is the label used for ours on the conflict markers.
+	OursLabel string
+	// BaseLabel is the label used for the base on the conflict markers.
+	BaseLabel string
+	// TheirsLabel is the label used for theirs on the conflict markers.
+	TheirsLabel string
+	// ConflictStyle defines how the content conflicts are represented.
+	ConflictStyle merge.ConflictStyle
+	// Favor defines how overlapping changes on the content of files are
+	// resolved, by default they are left as conflicts.
+	Favor merge.Favor
+	// RenameOptions are the options used to detect the renames done on each
+	// side. If nil, DefaultDiffTreeOptions are used. Renames are not
+	// detected if RenameOptions.DetectRenames is false.
+	RenameOptions *DiffTreeOptions
+}
+
+// MergeTrees performs a three-way merge of the changes done from base to
+// ours and from base to theirs, in a similar way to the "ort" strategy of
+// git. A nil tree is handled as an empty tree.
+//
+// Only s is used to store the objects created by the merge (the blobs with
+// the merged content and the resulting trees), so no worktree is needed and
+// it can be used in bare repositories. If opts is nil the default options
+// are used.
+func MergeTrees(s storer.EncodedObjectStorer, base, ours, theirs *Tree, opts *MergeTreesOptions) (*MergeResult, error) {
+	if opts == nil {
+		opts = &MergeTreesOptions{}
+	}
+
+	m := &treeMerger{s: s, opts: opts}
+	return m.merge(base, ours, theirs)
+}
+
+// MergeCommits merges the trees of ours and theirs, using the tree of their
+// merge base as common ancestor. When there are multiple merge bases, they
+// are recursively merged into a virtual one, as the "recursive" and "ort"
+// strategies of git do. See MergeTrees for more details.
+func MergeCommits(s storer.EncodedObjectStorer, ours, theirs *Commit, opts *MergeTreesOptions) (*MergeResult, error) {
+	if opts == nil {
+		opts = &MergeTreesOptions{}
+	}
+
+	m := &treeMerger{s: s, opts: opts}
+
+	bases, err := ours.MergeBase(theirs)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := m.mergeBases(bases)
+	if err != nil {
+		return nil, err
+	}
+
+	oursTree, err := ours.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	theirsTree, err := theirs.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	return m.merge(base, oursTree, theirsTree)
+}
+
+type treeMerger struct {
+	s    storer.EncodedObjectStorer
+	opts *MergeTreesOptions
+}
+
+// mergeBases returns the tree to be used as base of the merge of commits
+// with the given merge bases.
+func (m *treeMerger) mergeBases(bases []*Commit) (*Tree, error) {
+	if len(bases) == 0 {
+		return nil, nil
+	}
+
+	tree, err := bases[0].Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, b := range bases[1:] {
+		common, err := bases[0].MergeBase(b)
+		if err != nil {
+			return nil, err
+		}
+
+		base, err := m.mergeBases(common)
+		if err != nil {
+			return nil, err
+		}
+
+		other, err := b.Tree()
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := m.merge(base, tree, other)
+		if err != nil {
+			return nil, err
+		}
+
+		tree, err = GetTree(m.s, res.Tree)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tree, nil
+}
+
+func (m *treeMerger) merge(base, ours, theirs *Tree) (*MergeResult, error) {
+	b, err := flattenTree(base)
+	if err != nil {
+		return nil, err
+	}
+
+	o, err := flattenTree(ours)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := flattenTree(theirs)
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts := make(map[string]*MergeConflict)
+	if base != nil {
+		if err := m.applyRenames(base, ours, theirs, b, o, t, conflicts); err != nil {
+			return nil, err
+		}
+	}
+
+	paths := make(map[string]struct{}, len(o)+len(t))
+	for _, entries := range []map[string]*TreeEntry{b, o, t} {
+		for p := range entries {
+			paths[p] = struct{}{}
+		}
+	}
+
+	entries := make(map[string]TreeEntry, len(paths))
+	for p := range paths {
+		e, conflict, err := m.mergeEntry(b[p], o[p], t[p])
+		if err != nil {
+			return nil, err
+		}
+
+		if e != nil {
+			entries[p] = *e
+		}
+
+		if _, ok := conflicts[p]; ok || conflict == nil {
+			continue
+		}
+
+		conflict.Path = p
+		conflicts[p] = conflict
+	}
+
+	m.resolveDirectoryFileConflicts(entries, conflicts, b, o, t)
+
+	res := &MergeResult{}
+	for _, c := range conflicts {
+		res.Conflicts = append(res.Conflicts, *c)
+	}
+
+	sort.Slice(res.Conflicts, func(i, j int) bool {
+		return res.Conflicts[i].Path < res.Conflicts[j].Path
+	})
+
+	res.Tree, err = writeTree(m.s, entries)
+	return res, err
+}
+
+// applyRenames detects the files renamed by ours or by theirs, and moves the
+// entries of the other trees to the new path, so the changes done on both
+// sides are merged together. The files renamed to different paths by ours
+// and theirs are added to conflicts.
+func (m *treeMerger) applyRenames(
+	base, ours, theirs *Tree,
+	b, o, t map[string]*TreeEntry,
+	conflicts map[string]*MergeConflict,
+) error {
+	opts := m.opts.RenameOptions
+	if opts == nil {
+		opts = DefaultDiffTreeOptions
+	}
+
+	if !opts.DetectRenames {
+		return nil
+	}
+
+	ro, err := detectMergeRenames(base, ours, opts)
+	if err != nil {
+		return err
+	}
+
+	rt, err := detectMergeRenames(base, theirs, opts)
+	if err != nil {
+		return err
+	}
+
+	for from, to := range ro {
+		other, ok := rt[from]
+		if !ok {
+			moveRenamed(from, to, b, t)
+			continue
+		}
+
+		be := b[from]
+		delete(b, from)
+
+		if other == to {
+			b[to] = be
+			continue
+		}
+
+		// Renamed to different paths on both sides, both are kept.
+		conflicts[to] = &MergeConflict{Type: RenameConflict, Path: to, Base: be, Ours: o[to]}
+		conflicts[other] = &MergeConflict{Type: RenameConflict, Path: other, Base: be, Theirs: t[other]}
+	}
+
+	for from, to := range rt {
+		if _, ok := ro[from]; !ok {
+			moveRenamed(from, to, b, o)
+		}
+	}
+
+	return nil
+}
+
+// moveRenamed moves the entries of the base and the side that didn't rename
+// the file, so they can be merged with the renamed entry.
+func moveRenamed(from, to string, base, other map[string]*TreeEntry) {
+	if _, ok := base[to]; ok {
+		return
+	}
+
+	if _, ok := other[to]; ok {
+		return
+	}
+
+	base[to] = base[from]
+	delete(base, from)
+
+	if e, ok := other[from]; ok {
+		other[to] = e
+		delete(other, from)
+	}
+}
+
+// detectMergeRenames returns the files renamed from a to b, indexed by their
+// original path.
+func detectMergeRenames(a, b *Tree, opts *DiffTreeOptions) (map[string]string, error) {
+	changes, err := DiffTreeWithOptions(context.Background(), a, b, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	renames := make(map[string]string)
+	for _, ch := range changes {
+		if ch.From.Name != "" && ch.To.Name != "" && ch.From.Name != ch.To.Name {
+			renames[ch.From.Name] = ch.To.Name
+		}
+	}
+
+	return renames, nil
+}
+
+// mergeEntry merges a single path, returning the resulting entry, which is
+// nil if the path was deleted, and the conflict found, if any.
+func (m *treeMerger) mergeEntry(base, ours, theirs *TreeEntry) (*TreeEntry, *MergeConflict, error) {
+	switch {
+	case equalEntries(ours, theirs):
+		return ours, nil, nil
+	case equalEntries(base, ours):
+		return theirs, nil, nil
+	case equalEntries(base, theirs):
+		return ours, nil, nil
+	}
+
+	c := &MergeConflict{Base: base, Ours: ours, Theirs: theirs}
+	switch {
+	case ours == nil:
+		c.Type = ModifyDeleteConflict
+		return theirs, c, nil
+	case theirs == nil:
+		c.Type = ModifyDeleteConflict
+		return ours, c, nil
+	}
+
+	if !isMergeableMode(ours.Mode) || !isMergeableMode(theirs.Mode) ||
+		(base != nil && !isMergeableMode(base.Mode)) {
+		c.Type = BinaryConflict
+		return ours, c, nil
+	}
+
+	mode, modeConflict := mergeModes(base, ours, theirs)
+	if modeConflict {
+		c.Type = ModeConflict
+	} else {
+		c = nil
+	}
+
+	if ours.Hash == theirs.Hash {
+		return &TreeEntry{Name: ours.Name, Mode: mode, Hash: ours.Hash}, c, nil
+	}
+
+	hash, conflictType, err := m.mergeBlobs(base, ours, theirs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if conflictType != nil {
+		c = &MergeConflict{Type: *conflictType, Base: base, Ours: ours, Theirs: theirs}
+	}
+
+	return &TreeEntry{Name: ours.Name, Mode: mode, Hash: hash}, c, nil
+}
+
+// mergeBlobs merges the content of the given entries, storing the result in
+// a new blob. It returns the hash of the blob, and the type of the conflict
+// found, if any.
+func (m *treeMerger) mergeBlobs(base, ours, theirs *TreeEntry) (plumbing.Hash, *MergeConflictType, error) {
+	var baseContent []byte
+	if base != nil {
+		var err error
+		baseContent, err = m.readBlob(base.Hash)
+		if err != nil {
+			return plumbing.ZeroHash, nil, err
+		}
+	}
+
+	oursContent, err := m.readBlob(ours.Hash)
+	if err != nil {
+		return plumbing.ZeroHash, nil, err
+	}
+
+	theirsContent, err := m.readBlob(theirs.Hash)
+	if err != nil {
+		return plumbing.ZeroHash, nil, err
+	}
+
+	if merge.IsBinary(baseContent, oursContent, theirsContent) {
+		t := BinaryConflict
+		return ours.Hash, &t, nil
+	}
+
+	res := merge.Merge(baseContent, oursContent, theirsContent, &merge.Options{
+		OursLabel:   m.opts.OursLabel,
+		BaseLabel:   m.opts.BaseLabel,
+		TheirsLabel: m.opts.TheirsLabel,
+		Style:       m.opts.ConflictStyle,
+		Favor:       m.opts.Favor,
+	})
+
+	hash, err := m.writeBlob(res.Content)
+	if err != nil || res.IsClean() {
+		return hash, nil, err
+	}
+
+	t := ContentConflict
+	return hash, &t, nil
+}
+
+func (m *treeMerger) readBlob(h plumbing.Hash) (content []byte, err error) {
+	b, err := GetBlob(m.s, h)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := b.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(r, &err)
+	return io.ReadAll(r)
+}
+
+func (m *treeMerger) writeBlob(content []byte) (h plumbing.Hash, err error) {
+	obj := m.s.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	obj.SetSize(int64(len(content)))
+
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if _, err := w.Write(content); err != nil {
+		_ = w.Close()
+		return plumbing.ZeroHash, err
+	}
+
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return m.s.SetEncodedObject(obj)
+}
+
+// resolveDirectoryFileConflicts looks for files in the result that conflict
+// with a directory of the same name, moving them to "<path>~<label>".
+func (m *treeMerger) resolveDirectoryFileConflicts(
+	entries map[string]TreeEntry,
+	conflicts map[string]*MergeConflict,
+	b, o, t map[string]*TreeEntry,
+) {
+	dirs := make(map[string]struct{})
+	for p := range entries {
+		for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+			if _, ok := entries[dir]; ok {
+				dirs[dir] = struct{}{}
+			}
+		}
+	}
+
+	for dir := range dirs {
+		e := entries[dir]
+
+		label := m.opts.TheirsLabel
+		if equalEntries(o[dir], &e) {
+			label = m.opts.OursLabel
+		}
+
+		if label == "" {
+			label = "merged"
+		}
+
+		c, ok := conflicts[dir]
+		if !ok {
+			c = &MergeConflict{Path: dir, Base: b[dir], Ours: o[dir], Theirs: t[dir]}
+			conflicts[dir] = c
+		}
+
+		c.Type = DirectoryFileConflict
+		c.RenamedTo = dir + "~" + strings.ReplaceAll(label, "/", "_")
+		entries[c.RenamedTo] = e
+		delete(entries, dir)
+	}
+}
+
+// flattenTree returns all the non-directory entries of the given tree,
+// indexed by their full path, which is also set as their Name.
+func flattenTree(t *Tree) (map[string]*TreeEntry, error) {
+	entries := make(map[string]*TreeEntry)
+	if t == nil {
+		return entries, nil
+	}
+
+	w := NewTreeWalker(t, true, nil)
+	defer w.Close()
+
+	for {
+		name, e, err := w.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if e.Mode == filemode.Dir {
+			continue
+		}
+
+		e.Name = name
+		entries[name] = &e
+	}
+}
+
+// writeTree stores the trees containing the given entries, indexed by their
+// full path, returning the hash of the root tree.
+func writeTree(s storer.EncodedObjectStorer, entries map[string]TreeEntry) (plumbing.Hash, error) {
+	const root = ""
+	trees := map[string]*Tree{root: {}}
+
+	var addDir func(dir string)
+	addDir = func(dir string) {
+		if _, ok := trees[dir]; ok {
+			return
+		}
+
+		parent := path.Dir(dir)
+		if parent == "." {
+			parent = root
+		}
+
+		addDir(parent)
+		trees[dir] = &Tree{}
+		trees[parent].Entries = append(trees[parent].Entries, TreeEntry{
+			Name: path.Base(dir),
+			Mode: filemode.Dir,
+		})
+	}
+
+	for p, e := range entries {
+		dir := path.Dir(p)
+		if dir == "." {
+			dir = root
+		}
+
+		addDir(dir)
+		trees[dir].Entries = append(trees[dir].Entries, TreeEntry{
+			Name: path.Base(p),
+			Mode: e.Mode,
+			Hash: e.Hash,
+		})
+	}
+
+	return writeTreeRecursive(s, trees, root)
+}
+
+func writeTreeRecursive(s storer.EncodedObjectStorer, trees map[string]*Tree, dir string) (plumbing.Hash, error) {
+	t := trees[dir]
+	for i, e := range t.Entries {
+		if e.Mode != filemode.Dir {
+			continue
+		}
+
+		h, err := writeTreeRecursive(s, trees, path.Join(dir, e.Name))
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		t.Entries[i].Hash = h
+	}
+
+	sort.Sort(TreeEntrySorter(t.Entries))
+
+	o := s.NewEncodedObject()
+	if err := t.Encode(o); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if s.HasEncodedObject(o.Hash()) == nil {
+		return o.Hash(), nil
+	}
+
+	return s.SetEncodedObject(o)
+}
+
+func equalEntries(a, b *TreeEntry) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Hash == b.Hash && a.Mode == b.Mode
+}
+
+// isMergeableMode returns true if the content of an entry with the given
+// mode can be merged.
+func isMergeableMode(m filemode.FileMode) bool {
+	return m == filemode.Regular || m == filemode.Executable || m == filemode.Deprecated
+}
+
+// mergeModes returns the mode of the merged entry, and whether both sides
+// changed the mode to different values.
+func mergeModes(base, ours, theirs *TreeEntry) (filemode.FileMode, bool) {
+	switch {
+	case ours.Mode == theirs.Mode:
+		return ours.Mode, false
+	case base != nil && base.Mode == ours.Mode:
+		return theirs.Mode, false
+	case base != nil && base.Mode == theirs.Mode:
+		return ours.Mode, false
+	}
+
+	return ours.Mode, true
+}
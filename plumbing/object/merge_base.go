@@ -15,6 +15,15 @@ var errIsReachable = fmt.Errorf("first is reachable from second")
 // best common ancestor between the actual and the passed one.
 // The best common ancestors can not be reached from other common ancestors.
 func (c *Commit) MergeBase(other *Commit) ([]*Commit, error) {
+	if g := newGraphNodes(c.s); g != nil {
+		bases, err := g.mergeBases(c.Hash, other.Hash)
+		if err != nil {
+			return nil, err
+		}
+
+		return g.commits(bases)
+	}
+
 	// use sortedByCommitDateDesc strategy
 	sorted := sortByCommitDateDesc(c, other)
 	newer := sorted[0]
@@ -44,6 +53,10 @@ func (c *Commit) MergeBase(other *Commit) ([]*Commit, error) {
 // It returns an error if the history is not transversable
 // It mimics the behavior of `git merge --is-ancestor actual other`
 func (c *Commit) IsAncestor(other *Commit) (bool, error) {
+	if g := newGraphNodes(c.s); g != nil {
+		return g.reachable([]plumbing.Hash{other.Hash}, c.Hash)
+	}
+
 	found := false
 	iter := NewCommitPreorderIter(other, nil, nil)
 	err := iter.ForEach(func(comm *Commit) error {
@@ -101,6 +114,20 @@ func Independents(commits []*Commit) ([]*Commit, error) {
 		return candidates, nil
 	}
 
+	if g := newGraphNodes(candidates[0].s); g != nil {
+		hashes := make([]plumbing.Hash, len(candidates))
+		for i, c := range candidates {
+			hashes[i] = c.Hash
+		}
+
+		independents, err := g.independents(hashes)
+		if err != nil {
+			return nil, err
+		}
+
+		return g.commits(independents)
+	}
+
 	pos := 0
 	for {
 		from := candidates[pos]
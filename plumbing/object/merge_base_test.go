@@ -7,6 +7,7 @@ import (
 
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/cache"
+	commitgraph "github.com/go-git/go-git/v5/plumbing/format/commitgraph/v2"
 	"github.com/go-git/go-git/v5/storage/filesystem"
 	"github.com/stretchr/testify/suite"
 
@@ -324,3 +325,74 @@ func (s *mergeBaseSuite) TestAncestorUnrelated() {
 	revs = []string{"N", "M"}
 	s.AssertAncestor(revs, false)
 }
+
+func TestMergeBaseCommitGraphSuite(t *testing.T) {
+	suite.Run(t, new(mergeBaseCommitGraphSuite))
+}
+
+// mergeBaseCommitGraphSuite runs the merge-base tests walking the history
+// with a commit-graph.
+type mergeBaseCommitGraphSuite struct {
+	mergeBaseSuite
+}
+
+func (s *mergeBaseCommitGraphSuite) SetupSuite() {
+	s.mergeBaseSuite.SetupSuite()
+
+	sto := s.Storer.(*filesystem.Storage)
+	s.NoError(sto.SetCommitGraph(s.commitGraph()))
+
+	index, err := sto.CommitGraph()
+	s.NoError(err)
+	s.NotNil(index)
+}
+
+// commitGraph returns a commit-graph with all the commits of the storer.
+func (s *mergeBaseCommitGraphSuite) commitGraph() commitgraph.Index {
+	commits := make(map[plumbing.Hash]*Commit)
+	iter, err := s.Storer.IterEncodedObjects(plumbing.CommitObject)
+	s.NoError(err)
+	s.NoError(iter.ForEach(func(o plumbing.EncodedObject) error {
+		c, err := DecodeCommit(s.Storer, o)
+		commits[c.Hash] = c
+		return err
+	}))
+
+	index := commitgraph.NewMemoryIndex()
+	var add func(c *Commit) *commitgraph.CommitData
+	add = func(c *Commit) *commitgraph.CommitData {
+		if i, err := index.GetIndexByHash(c.Hash); err == nil {
+			data, err := index.GetCommitDataByIndex(i)
+			s.NoError(err)
+			return data
+		}
+
+		data := &commitgraph.CommitData{
+			TreeHash:     c.TreeHash,
+			ParentHashes: c.ParentHashes,
+			Generation:   1,
+			GenerationV2: uint64(c.Committer.When.Unix()),
+			When:         c.Committer.When,
+		}
+
+		for _, p := range c.ParentHashes {
+			parent := add(commits[p])
+			if parent.Generation >= data.Generation {
+				data.Generation = parent.Generation + 1
+			}
+
+			if parent.GenerationV2 >= data.GenerationV2 {
+				data.GenerationV2 = parent.GenerationV2 + 1
+			}
+		}
+
+		index.Add(c.Hash, data)
+		return data
+	}
+
+	for _, c := range commits {
+		add(c)
+	}
+
+	return index
+}
@@ -0,0 +1,206 @@
+package object
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/go-git/go-git/v5/utils/merge"
+	"github.com/stretchr/testify/suite"
+)
+
+type MergeTreesSuite struct {
+	suite.Suite
+	Storer *memory.Storage
+}
+
+func TestMergeTreesSuite(t *testing.T) {
+	suite.Run(t, new(MergeTreesSuite))
+}
+
+func (s *MergeTreesSuite) SetupTest() {
+	s.Storer = memory.NewStorage()
+}
+
+// tree stores a tree with the given files, indexed by path.
+func (s *MergeTreesSuite) tree(files map[string]string) *Tree {
+	entries := make(map[string]TreeEntry, len(files))
+	for p, content := range files {
+		obj := s.Storer.NewEncodedObject()
+		obj.SetType(plumbing.BlobObject)
+		w, err := obj.Writer()
+		s.NoError(err)
+		_, err = w.Write([]byte(content))
+		s.NoError(err)
+		s.NoError(w.Close())
+
+		h, err := s.Storer.SetEncodedObject(obj)
+		s.NoError(err)
+		entries[p] = TreeEntry{Mode: filemode.Regular, Hash: h}
+	}
+
+	h, err := writeTree(s.Storer, entries)
+	s.NoError(err)
+
+	t, err := GetTree(s.Storer, h)
+	s.NoError(err)
+	return t
+}
+
+// files returns the content of the files of the tree with the given hash.
+func (s *MergeTreesSuite) files(h plumbing.Hash) map[string]string {
+	t, err := GetTree(s.Storer, h)
+	s.NoError(err)
+
+	files := make(map[string]string)
+	s.NoError(t.Files().ForEach(func(f *File) error {
+		content, err := f.Contents()
+		files[f.Name] = content
+		return err
+	}))
+
+	return files
+}
+
+func (s *MergeTreesSuite) commit(t *Tree, parents ...*Commit) *Commit {
+	sig := Signature{Name: "foo", Email: "foo@foo.foo", When: time.Unix(0, 0)}
+	c := &Commit{Author: sig, Committer: sig, Message: "foo\n", TreeHash: t.Hash}
+	for _, p := range parents {
+		c.ParentHashes = append(c.ParentHashes, p.Hash)
+	}
+
+	obj := s.Storer.NewEncodedObject()
+	s.NoError(c.Encode(obj))
+	_, err := s.Storer.SetEncodedObject(obj)
+	s.NoError(err)
+
+	c, err = GetCommit(s.Storer, obj.Hash())
+	s.NoError(err)
+	return c
+}
+
+func (s *MergeTreesSuite) TestMergeTrees() {
+	base := s.tree(map[string]string{"a": "a\nb\nc\nd\ne\n", "dir/b": "b\n", "c": "c\n"})
+	ours := s.tree(map[string]string{"a": "A\nb\nc\nd\ne\n", "dir/b": "b\n", "c": "c\n", "d": "d\n"})
+	theirs := s.tree(map[string]string{"a": "a\nb\nc\nd\nE\n", "dir/b": "B\n"})
+
+	res, err := MergeTrees(s.Storer, base, ours, theirs, nil)
+	s.NoError(err)
+	s.True(res.IsClean())
+	s.Equal(map[string]string{
+		"a":     "A\nb\nc\nd\nE\n",
+		"dir/b": "B\n",
+		"d":     "d\n",
+	}, s.files(res.Tree))
+}
+
+func (s *MergeTreesSuite) TestMergeTreesContentConflict() {
+	base := s.tree(map[string]string{"a": "a\n"})
+	ours := s.tree(map[string]string{"a": "b\n"})
+	theirs := s.tree(map[string]string{"a": "c\n"})
+
+	res, err := MergeTrees(s.Storer, base, ours, theirs, &MergeTreesOptions{
+		OursLabel:   "ours",
+		TheirsLabel: "theirs",
+	})
+	s.NoError(err)
+	s.False(res.IsClean())
+	s.Len(res.Conflicts, 1)
+
+	c := res.Conflicts[0]
+	s.Equal(ContentConflict, c.Type)
+	s.Equal("a", c.Path)
+	s.Equal(base.Entries[0].Hash, c.Base.Hash)
+	s.Equal(ours.Entries[0].Hash, c.Ours.Hash)
+	s.Equal(theirs.Entries[0].Hash, c.Theirs.Hash)
+	s.Equal(map[string]string{
+		"a": "<<<<<<< ours\nb\n=======\nc\n>>>>>>> theirs\n",
+	}, s.files(res.Tree))
+}
+
+func (s *MergeTreesSuite) TestMergeTreesFavor() {
+	base := s.tree(map[string]string{"a": "a\n"})
+	ours := s.tree(map[string]string{"a": "b\n"})
+	theirs := s.tree(map[string]string{"a": "c\n"})
+
+	res, err := MergeTrees(s.Storer, base, ours, theirs, &MergeTreesOptions{Favor: merge.FavorTheirs})
+	s.NoError(err)
+	s.True(res.IsClean())
+	s.Equal(map[string]string{"a": "c\n"}, s.files(res.Tree))
+}
+
+func (s *MergeTreesSuite) TestMergeTreesModifyDelete() {
+	base := s.tree(map[string]string{"a": "a\n", "b": "b\n"})
+	ours := s.tree(map[string]string{"b": "b\n"})
+	theirs := s.tree(map[string]string{"a": "A\n", "b": "b\n"})
+
+	res, err := MergeTrees(s.Storer, base, ours, theirs, nil)
+	s.NoError(err)
+	s.Len(res.Conflicts, 1)
+	s.Equal(ModifyDeleteConflict, res.Conflicts[0].Type)
+	s.Nil(res.Conflicts[0].Ours)
+	s.Equal(map[string]string{"a": "A\n", "b": "b\n"}, s.files(res.Tree))
+}
+
+func (s *MergeTreesSuite) TestMergeTreesRename() {
+	content := "a\nb\nc\nd\ne\nf\ng\nh\n"
+	base := s.tree(map[string]string{"a": content})
+	ours := s.tree(map[string]string{"dir/renamed": content})
+	theirs := s.tree(map[string]string{"a": "a\nb\nc\nd\ne\nf\ng\nH\n"})
+
+	res, err := MergeTrees(s.Storer, base, ours, theirs, nil)
+	s.NoError(err)
+	s.True(res.IsClean())
+	s.Equal(map[string]string{"dir/renamed": "a\nb\nc\nd\ne\nf\ng\nH\n"}, s.files(res.Tree))
+
+	res, err = MergeTrees(s.Storer, base, ours, theirs, &MergeTreesOptions{
+		RenameOptions: &DiffTreeOptions{},
+	})
+	s.NoError(err)
+	s.Len(res.Conflicts, 1)
+	s.Equal(ModifyDeleteConflict, res.Conflicts[0].Type)
+}
+
+func (s *MergeTreesSuite) TestMergeTreesDirectoryFile() {
+	base := s.tree(map[string]string{"b": "b\n"})
+	ours := s.tree(map[string]string{"b": "b\n", "a": "a\n"})
+	theirs := s.tree(map[string]string{"b": "b\n", "a/file": "file\n"})
+
+	res, err := MergeTrees(s.Storer, base, ours, theirs, &MergeTreesOptions{OursLabel: "HEAD"})
+	s.NoError(err)
+	s.Len(res.Conflicts, 1)
+	s.Equal(DirectoryFileConflict, res.Conflicts[0].Type)
+	s.Equal("a", res.Conflicts[0].Path)
+	s.Equal("a~HEAD", res.Conflicts[0].RenamedTo)
+	s.Equal(map[string]string{
+		"a~HEAD": "a\n",
+		"a/file": "file\n",
+		"b":      "b\n",
+	}, s.files(res.Tree))
+}
+
+func (s *MergeTreesSuite) TestMergeTreesNilBase() {
+	ours := s.tree(map[string]string{"a": "a\n"})
+	theirs := s.tree(map[string]string{"b": "b\n"})
+
+	res, err := MergeTrees(s.Storer, nil, ours, theirs, nil)
+	s.NoError(err)
+	s.True(res.IsClean())
+	s.Equal(map[string]string{"a": "a\n", "b": "b\n"}, s.files(res.Tree))
+}
+
+func (s *MergeTreesSuite) TestMergeCommitsCrissCross() {
+	root := s.commit(s.tree(map[string]string{"a": "a\nb\nc\nd\ne\n"}))
+	x := s.commit(s.tree(map[string]string{"a": "A\nb\nc\nd\ne\n"}), root)
+	y := s.commit(s.tree(map[string]string{"a": "a\nb\nc\nd\nE\n"}), root)
+	merged := s.tree(map[string]string{"a": "A\nb\nc\nd\nE\n"})
+	ours := s.commit(merged, x, y)
+	theirs := s.commit(s.tree(map[string]string{"a": "A\nb\nc\nd\nE\n", "b": "b\n"}), y, x)
+
+	res, err := MergeCommits(s.Storer, ours, theirs, nil)
+	s.NoError(err)
+	s.True(res.IsClean())
+	s.Equal(map[string]string{"a": "A\nb\nc\nd\nE\n", "b": "b\n"}, s.files(res.Tree))
+}
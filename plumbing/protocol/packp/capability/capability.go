@@ -89,6 +89,9 @@ const (
 	// understood thin packs. Adding 'no-thin' later allowed receive-pack
 	// to disable the feature in a backwards-compatible manner.
 	ThinPack Capability = "thin-pack"
+	// NoThin is advertised by a receive-pack server unable to handle thin
+	// packs, see ThinPack.
+	NoThin Capability = "no-thin"
 	// Sideband means that server can send, and client understand multiplexed
 	// progress reports and error info interleaved with the packfile itself.
 	//
@@ -241,6 +244,28 @@ const (
 	// Filter if present, fetch-pack may send "filter" commands to request a
 	// partial clone or partial fetch and request that the server omit various objects from the packfile
 	Filter Capability = "filter"
+	// LsRefs is the command of the version 2 of the protocol listing the
+	// references, its value lists the features supported, such as unborn.
+	LsRefs Capability = "ls-refs"
+	// Fetch is the command of the version 2 of the protocol requesting a
+	// packfile, its value lists the features supported, such as shallow,
+	// filter, ref-in-want or packfile-uris.
+	Fetch Capability = "fetch"
+	// ObjectInfo is the command of the version 2 of the protocol requesting
+	// information about objects, such as their size.
+	ObjectInfo Capability = "object-info"
+	// ServerOption if present, the client may send server options to the
+	// commands of the version 2 of the protocol.
+	ServerOption Capability = "server-option"
+	// Unborn is the feature of the ls-refs command listing the target of
+	// HEAD even if it doesn't exist yet.
+	Unborn Capability = "unborn"
+	// RefInWant is the feature of the fetch command accepting the wanted
+	// references by name, with want-ref, instead of by object id.
+	RefInWant Capability = "ref-in-want"
+	// PackfileURIs is the feature of the fetch command sending some objects
+	// as URIs of packfiles to be downloaded separately.
+	PackfileURIs Capability = "packfile-uris"
 )
 
 const userAgent = "go-git/5.x"
@@ -254,7 +279,7 @@ func DefaultAgent() string {
 }
 
 var known = map[Capability]bool{
-	MultiACK: true, MultiACKDetailed: true, NoDone: true, ThinPack: true,
+	MultiACK: true, MultiACKDetailed: true, NoDone: true, ThinPack: true, NoThin: true,
 	Sideband: true, Sideband64k: true, OFSDelta: true, Agent: true,
 	Shallow: true, DeepenSince: true, DeepenNot: true, DeepenRelative: true,
 	NoProgress: true, IncludeTag: true, ReportStatus: true, DeleteRefs: true,
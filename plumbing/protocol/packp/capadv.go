@@ -0,0 +1,198 @@
+package packp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+)
+
+// ErrUnsupportedVersion is returned by Decode if the capability
+// advertisement is not of the version 2 of the protocol.
+var ErrUnsupportedVersion = errors.New("unsupported protocol version")
+
+var version2 = []byte("version 2")
+
+// CapabilityAdvertisement values represent the capability advertisement
+// sent by the server on the version 2 of the protocol, in place of the
+// advertised-refs message. It lists the commands supported by the server and
+// their features, such as ls-refs=unborn or fetch=shallow filter, and the
+// capabilities of the server, such as agent or server-option.
+type CapabilityAdvertisement struct {
+	// Capabilities are the capabilities, the features of each command are
+	// stored as a single value separated by spaces.
+	Capabilities *capability.List
+}
+
+// NewCapabilityAdvertisement returns a pointer to a new
+// CapabilityAdvertisement value, ready to be used.
+func NewCapabilityAdvertisement() *CapabilityAdvertisement {
+	return &CapabilityAdvertisement{
+		Capabilities: capability.NewList(),
+	}
+}
+
+// Supports returns true if the command or capability is advertised.
+func (a *CapabilityAdvertisement) Supports(c capability.Capability) bool {
+	return a.Capabilities.Supports(c)
+}
+
+// SupportsFeature returns true if the command is advertised with the given
+// feature, such as the shallow feature of the fetch command.
+func (a *CapabilityAdvertisement) SupportsFeature(cmd, feature capability.Capability) bool {
+	for _, v := range a.Capabilities.Get(cmd) {
+		for _, f := range strings.Fields(v) {
+			if f == feature.String() {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// UploadPackCapabilities returns the capabilities of the version 0 of the
+// protocol equivalent to the advertised ones, to be used to build an
+// UploadPackRequest. The capabilities of the packfile, such as thin-pack or
+// ofs-delta, are always supported on the fetch command, as well as the wants
+// of any object, and the sideband is always used.
+func (a *CapabilityAdvertisement) UploadPackCapabilities() *capability.List {
+	l := capability.NewList()
+	for _, c := range []capability.Capability{capability.Agent, capability.ObjectFormat} {
+		if v := a.Capabilities.Get(c); len(v) != 0 {
+			_ = l.Set(c, v[0])
+		}
+	}
+
+	if a.Supports(capability.ServerOption) {
+		_ = l.Set(capability.ServerOption)
+	}
+
+	if !a.Supports(capability.Fetch) {
+		return l
+	}
+
+	for _, c := range []capability.Capability{
+		capability.OFSDelta, capability.ThinPack, capability.NoProgress,
+		capability.IncludeTag, capability.Sideband64k,
+		capability.AllowReachableSHA1InWant,
+	} {
+		_ = l.Set(c)
+	}
+
+	if a.SupportsFeature(capability.Fetch, capability.Shallow) {
+		for _, c := range []capability.Capability{
+			capability.Shallow, capability.DeepenSince,
+			capability.DeepenNot, capability.DeepenRelative,
+		} {
+			_ = l.Set(c)
+		}
+	}
+
+	for _, c := range []capability.Capability{
+		capability.Filter, capability.RefInWant, capability.PackfileURIs,
+	} {
+		if a.SupportsFeature(capability.Fetch, c) {
+			_ = l.Set(c)
+		}
+	}
+
+	return l
+}
+
+// Encode writes the capability advertisement to the stream, starting with
+// the version line and ending with a flush-pkt.
+func (a *CapabilityAdvertisement) Encode(w io.Writer) error {
+	if _, err := pktline.Writef(w, "%s\n", version2); err != nil {
+		return err
+	}
+
+	if err := encodeCapabilityLines(w, a.Capabilities); err != nil {
+		return err
+	}
+
+	return pktline.WriteFlush(w)
+}
+
+// encodeCapabilityLines writes each capability of the list on its own
+// pkt-line, as key=value if it has a value.
+func encodeCapabilityLines(w io.Writer, caps *capability.List) error {
+	for _, c := range caps.All() {
+		values := caps.Get(c)
+		if len(values) == 0 {
+			if _, err := pktline.Writef(w, "%s\n", c); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		for _, v := range values {
+			if _, err := pktline.Writef(w, "%s=%s\n", c, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Decode reads the capability advertisement from the stream, up to its
+// flush-pkt. The version line is optional, since it's usually consumed
+// while discovering the version of the protocol spoken by the server.
+func (a *CapabilityAdvertisement) Decode(r io.Reader) error {
+	for n := 0; ; n++ {
+		l, p, err := pktline.ReadLine(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				if n == 0 {
+					return ErrEmptyInput
+				}
+
+				return io.ErrUnexpectedEOF
+			}
+
+			return err
+		}
+
+		if l == pktline.Flush {
+			return nil
+		}
+
+		line := bytes.TrimSuffix(p, eol)
+		if n == 0 && bytes.HasPrefix(line, []byte("version ")) {
+			if !bytes.Equal(line, version2) {
+				return fmt.Errorf("%w: %s", ErrUnsupportedVersion, line)
+			}
+
+			continue
+		}
+
+		if err := a.decodeLine(line); err != nil {
+			return err
+		}
+	}
+}
+
+func (a *CapabilityAdvertisement) decodeLine(line []byte) error {
+	if len(line) == 0 {
+		return NewErrUnexpectedData("empty capability", line)
+	}
+
+	var err error
+	if k, v, ok := bytes.Cut(line, []byte("=")); ok {
+		err = a.Capabilities.Set(capability.Capability(k), string(v))
+	} else {
+		err = a.Capabilities.Set(capability.Capability(line))
+	}
+
+	if err != nil {
+		return NewErrUnexpectedData(fmt.Sprintf("invalid capability: %s", err), line)
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package packp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+	"github.com/stretchr/testify/suite"
+)
+
+type CapabilityAdvertisementSuite struct {
+	suite.Suite
+}
+
+func TestCapabilityAdvertisementSuite(t *testing.T) {
+	suite.Run(t, new(CapabilityAdvertisementSuite))
+}
+
+func (s *CapabilityAdvertisementSuite) TestDecode() {
+	raw := pktlines(s.T(),
+		"version 2\n",
+		"agent=git/2.45.0\n",
+		"ls-refs=unborn\n",
+		"fetch=shallow wait-for-done filter\n",
+		"server-option\n",
+		"object-format=sha1\n",
+		"",
+	)
+
+	a := NewCapabilityAdvertisement()
+	s.NoError(a.Decode(bytes.NewReader(raw)))
+	s.Equal([]string{"git/2.45.0"}, a.Capabilities.Get(capability.Agent))
+	s.True(a.Supports(capability.LsRefs))
+	s.True(a.Supports(capability.ServerOption))
+	s.False(a.Supports(capability.ObjectInfo))
+	s.True(a.SupportsFeature(capability.LsRefs, capability.Unborn))
+	s.True(a.SupportsFeature(capability.Fetch, capability.Filter))
+	s.False(a.SupportsFeature(capability.Fetch, capability.PackfileURIs))
+
+	var buf bytes.Buffer
+	s.NoError(a.Encode(&buf))
+	s.Equal(raw, buf.Bytes())
+}
+
+func (s *CapabilityAdvertisementSuite) TestDecodeInvalid() {
+	a := NewCapabilityAdvertisement()
+	err := a.Decode(bytes.NewReader(pktlines(s.T(), "version 3\n", "")))
+	s.ErrorIs(err, ErrUnsupportedVersion)
+
+	err = a.Decode(bytes.NewReader(nil))
+	s.ErrorIs(err, ErrEmptyInput)
+
+	err = a.Decode(bytes.NewReader(pktlines(s.T(), "version 2\n", "ls-refs\n")))
+	s.Error(err)
+}
+
+func (s *CapabilityAdvertisementSuite) TestUploadPackCapabilities() {
+	a := NewCapabilityAdvertisement()
+	s.NoError(a.Capabilities.Set(capability.Agent, "git/2.45.0"))
+	s.NoError(a.Capabilities.Set(capability.LsRefs))
+	s.NoError(a.Capabilities.Set(capability.Fetch, "shallow ref-in-want"))
+
+	caps := a.UploadPackCapabilities()
+	s.Equal("agent=git/2.45.0 ofs-delta thin-pack no-progress include-tag side-band-64k "+
+		"allow-reachable-sha1-in-want shallow deepen-since deepen-not deepen-relative "+
+		"ref-in-want", caps.String())
+}
@@ -0,0 +1,142 @@
+package packp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+)
+
+var command = []byte("command=")
+
+// CommandRequest values represent a command request of the version 2 of the
+// protocol, such as ls-refs or fetch, before its arguments are interpreted.
+type CommandRequest struct {
+	// Command is the command requested.
+	Command capability.Capability
+	// Capabilities are the capabilities of the request, such as agent or
+	// object-format.
+	Capabilities *capability.List
+	// ServerOptions are the server options sent with the command.
+	ServerOptions []string
+	// Args are the arguments of the command, one per line.
+	Args []string
+}
+
+// NewCommandRequest returns a pointer to a new CommandRequest value, ready to
+// be used.
+func NewCommandRequest() *CommandRequest {
+	return &CommandRequest{
+		Capabilities: capability.NewList(),
+	}
+}
+
+// Encode writes the command request to the stream: the command, the
+// capabilities and the server options, a delim-pkt, the arguments and a
+// flush-pkt.
+func (c *CommandRequest) Encode(w io.Writer) error {
+	if _, err := pktline.Writef(w, "%s%s\n", command, c.Command); err != nil {
+		return err
+	}
+
+	if c.Capabilities != nil {
+		if err := encodeCapabilityLines(w, c.Capabilities); err != nil {
+			return err
+		}
+	}
+
+	for _, o := range c.ServerOptions {
+		if _, err := pktline.Writef(w, "%s=%s\n", capability.ServerOption, o); err != nil {
+			return err
+		}
+	}
+
+	if err := pktline.WriteDelim(w); err != nil {
+		return err
+	}
+
+	for _, arg := range c.Args {
+		if _, err := pktline.Writef(w, "%s\n", arg); err != nil {
+			return err
+		}
+	}
+
+	return pktline.WriteFlush(w)
+}
+
+// Decode reads a command request from the stream. It returns io.EOF if the
+// stream ends, or if a flush-pkt is read in place of a command, since the
+// client uses it to end the session.
+func (c *CommandRequest) Decode(r io.Reader) error {
+	l, p, err := pktline.ReadLine(r)
+	if err != nil {
+		return err
+	}
+
+	if l == pktline.Flush {
+		return io.EOF
+	}
+
+	line := bytes.TrimSuffix(p, eol)
+	if !bytes.HasPrefix(line, command) || len(line) == len(command) {
+		return NewErrUnexpectedData("missing command", line)
+	}
+
+	c.Command = capability.Capability(line[len(command):])
+
+	inArgs := false
+	for {
+		l, p, err := pktline.ReadLine(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return io.ErrUnexpectedEOF
+			}
+
+			return err
+		}
+
+		switch {
+		case l == pktline.Flush:
+			return nil
+		case l == pktline.Delim && !inArgs:
+			inArgs = true
+			continue
+		case l < pktline.LenSize:
+			return NewErrUnexpectedData("unexpected special packet", nil)
+		}
+
+		line := bytes.TrimSuffix(p, eol)
+		if inArgs {
+			c.Args = append(c.Args, string(line))
+			continue
+		}
+
+		if err := c.decodeCapability(line); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *CommandRequest) decodeCapability(line []byte) error {
+	k, v, ok := bytes.Cut(line, []byte("="))
+	if ok && capability.Capability(k) == capability.ServerOption {
+		c.ServerOptions = append(c.ServerOptions, string(v))
+		return nil
+	}
+
+	var err error
+	if ok {
+		err = c.Capabilities.Set(capability.Capability(k), string(v))
+	} else {
+		err = c.Capabilities.Set(capability.Capability(k))
+	}
+
+	if err != nil {
+		return NewErrUnexpectedData(fmt.Sprintf("invalid capability: %s", err), line)
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package packp
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+	"github.com/stretchr/testify/suite"
+)
+
+type CommandRequestSuite struct {
+	suite.Suite
+}
+
+func TestCommandRequestSuite(t *testing.T) {
+	suite.Run(t, new(CommandRequestSuite))
+}
+
+func (s *CommandRequestSuite) TestDecode() {
+	req := NewLsRefsRequest()
+	req.Capabilities.Set(capability.Agent, "go-git/5.x")
+	req.ServerOptions = []string{"foo", "bar"}
+	req.Prefixes = []string{"refs/heads/"}
+
+	var buf bytes.Buffer
+	s.NoError(req.Encode(&buf))
+
+	cmd := NewCommandRequest()
+	s.NoError(cmd.Decode(&buf))
+	s.Equal(capability.LsRefs, cmd.Command)
+	s.Equal([]string{"go-git/5.x"}, cmd.Capabilities.Get(capability.Agent))
+	s.Equal([]string{"foo", "bar"}, cmd.ServerOptions)
+	s.Equal([]string{"symrefs", "peel", "ref-prefix refs/heads/"}, cmd.Args)
+
+	decoded := NewLsRefsRequest()
+	s.NoError(decoded.DecodeCommand(cmd))
+	s.Equal(req, decoded)
+}
+
+func (s *CommandRequestSuite) TestDecodeEnd() {
+	s.ErrorIs(NewCommandRequest().Decode(bytes.NewBufferString("")), io.EOF)
+	s.ErrorIs(NewCommandRequest().Decode(bytes.NewBufferString("0000")), io.EOF)
+}
+
+func (s *CommandRequestSuite) TestDecodeNoArgs() {
+	cmd := NewCommandRequest()
+	s.NoError(cmd.Decode(bytes.NewBufferString("0014command=ls-refs\n0000")))
+	s.Equal(capability.LsRefs, cmd.Command)
+	s.Empty(cmd.Args)
+}
+
+func (s *CommandRequestSuite) TestDecodeMalformed() {
+	for _, raw := range []string{
+		"000afetch\n0000",
+		"000dcommand=\n0000",
+		"0012command=fetch\n",
+		"0012command=fetch\n00010001",
+	} {
+		s.Error(NewCommandRequest().Decode(bytes.NewBufferString(raw)), raw)
+	}
+
+	cmd := NewCommandRequest()
+	cmd.Command = capability.Fetch
+	s.Error(NewLsRefsRequest().DecodeCommand(cmd))
+
+	cmd.Command = capability.LsRefs
+	cmd.Args = []string{"foo"}
+	s.Error(NewLsRefsRequest().DecodeCommand(cmd))
+}
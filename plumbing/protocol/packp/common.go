@@ -32,6 +32,7 @@ var (
 	deepenCommits   = []byte("deepen ")
 	deepenSince     = []byte("deepen-since ")
 	deepenReference = []byte("deepen-not ")
+	filter          = []byte("filter ")
 	have            = []byte("have ")
 	done            = []byte("done")
 
@@ -0,0 +1,294 @@
+package packp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+)
+
+const (
+	symrefTarget = "symref-target:"
+	peeledPrefix = "peeled:"
+	unborn       = "unborn"
+	refPrefix    = "ref-prefix "
+)
+
+// LsRefsRequest values represent the ls-refs command of the version 2 of the
+// protocol, listing the references of the server.
+type LsRefsRequest struct {
+	// Capabilities are the capabilities of the request, such as agent or
+	// object-format.
+	Capabilities *capability.List
+	// ServerOptions are the server options sent with the command.
+	ServerOptions []string
+	// Symrefs requests the target of the symbolic references.
+	Symrefs bool
+	// Peel requests the peeled value of the annotated tags.
+	Peel bool
+	// Unborn requests the target of HEAD even if it doesn't exist yet, the
+	// server has to support the unborn feature of ls-refs.
+	Unborn bool
+	// Prefixes restricts the references listed to the ones starting with any
+	// of them, all the references are listed if it's empty.
+	Prefixes []string
+}
+
+// NewLsRefsRequest returns a pointer to a new LsRefsRequest value, ready to
+// be used. It requests the symbolic references and the peeled tags.
+func NewLsRefsRequest() *LsRefsRequest {
+	return &LsRefsRequest{
+		Capabilities: capability.NewList(),
+		Symrefs:      true,
+		Peel:         true,
+	}
+}
+
+// Encode writes the ls-refs command to the stream.
+func (req *LsRefsRequest) Encode(w io.Writer) error {
+	var args []string
+	if req.Symrefs {
+		args = append(args, "symrefs")
+	}
+
+	if req.Peel {
+		args = append(args, "peel")
+	}
+
+	if req.Unborn {
+		args = append(args, unborn)
+	}
+
+	for _, p := range req.Prefixes {
+		args = append(args, refPrefix+p)
+	}
+
+	cmd := &CommandRequest{
+		Command:       capability.LsRefs,
+		Capabilities:  req.Capabilities,
+		ServerOptions: req.ServerOptions,
+		Args:          args,
+	}
+
+	return cmd.Encode(w)
+}
+
+// DecodeCommand reads the capabilities, server options and arguments of the
+// ls-refs command request into the request.
+func (req *LsRefsRequest) DecodeCommand(c *CommandRequest) error {
+	if c.Command != capability.LsRefs {
+		return NewErrUnexpectedData("unexpected command", []byte(c.Command))
+	}
+
+	req.Capabilities = c.Capabilities
+	req.ServerOptions = c.ServerOptions
+	req.Symrefs, req.Peel, req.Unborn = false, false, false
+	req.Prefixes = nil
+
+	for _, arg := range c.Args {
+		switch {
+		case arg == "symrefs":
+			req.Symrefs = true
+		case arg == "peel":
+			req.Peel = true
+		case arg == unborn:
+			req.Unborn = true
+		case strings.HasPrefix(arg, refPrefix):
+			req.Prefixes = append(req.Prefixes, strings.TrimPrefix(arg, refPrefix))
+		default:
+			return NewErrUnexpectedData("unexpected ls-refs argument", []byte(arg))
+		}
+	}
+
+	return nil
+}
+
+// Match returns true if the reference name starts with any of the prefixes
+// of the request, or if it has no prefixes.
+func (req *LsRefsRequest) Match(name plumbing.ReferenceName) bool {
+	if len(req.Prefixes) == 0 {
+		return true
+	}
+
+	for _, p := range req.Prefixes {
+		if strings.HasPrefix(name.String(), p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Filter returns a copy of the AdvRefs with only the references matching the
+// prefixes of the request, to filter on the client the references advertised
+// by the servers not supporting the ls-refs command.
+func (req *LsRefsRequest) Filter(ar *AdvRefs) *AdvRefs {
+	f := NewAdvRefs()
+	f.Prefix = ar.Prefix
+	f.Capabilities = ar.Capabilities
+	f.Shallows = ar.Shallows
+	if req.Match(plumbing.HEAD) {
+		f.Head = ar.Head
+	}
+
+	for name, h := range ar.References {
+		if req.Match(plumbing.ReferenceName(name)) {
+			f.References[name] = h
+		}
+	}
+
+	for name, h := range ar.Peeled {
+		if req.Match(plumbing.ReferenceName(name)) {
+			f.Peeled[name] = h
+		}
+	}
+
+	return f
+}
+
+// DecodeLsRefs reads the response of the ls-refs command from the stream and
+// stores the references listed in the AdvRefs, as the advertised-refs message
+// would: HEAD is stored in Head, the peeled tags in Peeled and the target of
+// the symbolic references as symref capabilities. The targets are stored as
+// references as well, since they may not match the prefixes requested.
+func (a *AdvRefs) DecodeLsRefs(r io.Reader) error {
+	for {
+		l, p, err := pktline.ReadLine(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return io.ErrUnexpectedEOF
+			}
+
+			return err
+		}
+
+		if l == pktline.Flush {
+			return nil
+		}
+
+		if err := a.decodeLsRefsLine(bytes.TrimSuffix(p, eol)); err != nil {
+			return err
+		}
+	}
+}
+
+// EncodeLsRefs writes the references of the AdvRefs to the stream as the
+// response of the ls-refs command, HEAD first and the rest sorted by name.
+// The symref capabilities are sent as the targets of the references, HEAD is
+// sent as unborn if it's a symbolic reference without hash.
+func (a *AdvRefs) EncodeLsRefs(w io.Writer) error {
+	targets := make(map[string]string)
+	for _, v := range a.Capabilities.Get(capability.SymRef) {
+		if name, target, ok := strings.Cut(v, ":"); ok {
+			targets[name] = target
+		}
+	}
+
+	if a.Head != nil {
+		if err := encodeLsRefsLine(w, a.Head.String(), head, targets[head], nil); err != nil {
+			return err
+		}
+	} else if target, ok := targets[head]; ok {
+		if err := encodeLsRefsLine(w, unborn, head, target, nil); err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, 0, len(a.References))
+	for name := range a.References {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		var peeled *plumbing.Hash
+		if h, ok := a.Peeled[name]; ok {
+			peeled = &h
+		}
+
+		h := a.References[name]
+		if err := encodeLsRefsLine(w, h.String(), name, targets[name], peeled); err != nil {
+			return err
+		}
+	}
+
+	return pktline.WriteFlush(w)
+}
+
+func encodeLsRefsLine(w io.Writer, h, name, target string, peeled *plumbing.Hash) error {
+	line := fmt.Sprintf("%s %s", h, name)
+	if target != "" {
+		line += " " + symrefTarget + target
+	}
+
+	if peeled != nil {
+		line += " " + peeledPrefix + peeled.String()
+	}
+
+	_, err := pktline.Writef(w, "%s\n", line)
+	return err
+}
+
+func (a *AdvRefs) decodeLsRefsLine(line []byte) error {
+	fields := strings.Split(string(line), " ")
+	if len(fields) < 2 {
+		return NewErrUnexpectedData("malformed ls-refs line", line)
+	}
+
+	name := fields[1]
+	var target string
+	for _, attr := range fields[2:] {
+		switch {
+		case strings.HasPrefix(attr, symrefTarget):
+			target = strings.TrimPrefix(attr, symrefTarget)
+			v := fmt.Sprintf("%s:%s", name, target)
+			if err := a.Capabilities.Add(capability.SymRef, v); err != nil {
+				return err
+			}
+		case strings.HasPrefix(attr, peeledPrefix):
+			h, err := decodeHash(strings.TrimPrefix(attr, peeledPrefix), line)
+			if err != nil {
+				return err
+			}
+
+			a.Peeled[name] = h
+		}
+	}
+
+	if fields[0] == unborn {
+		return nil
+	}
+
+	h, err := decodeHash(fields[0], line)
+	if err != nil {
+		return err
+	}
+
+	// The target may not match the prefixes, its hash is the one of the
+	// symbolic reference.
+	if _, ok := a.References[target]; target != "" && !ok {
+		a.References[target] = h
+	}
+
+	if name == head {
+		a.Head = &h
+		return nil
+	}
+
+	a.References[name] = h
+	return nil
+}
+
+func decodeHash(s string, line []byte) (plumbing.Hash, error) {
+	if !plumbing.IsHash(s) {
+		return plumbing.ZeroHash, NewErrUnexpectedData("invalid hash", line)
+	}
+
+	return plumbing.NewHash(s), nil
+}
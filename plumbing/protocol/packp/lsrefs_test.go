@@ -0,0 +1,145 @@
+package packp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+	"github.com/stretchr/testify/suite"
+)
+
+type LsRefsSuite struct {
+	suite.Suite
+}
+
+func TestLsRefsSuite(t *testing.T) {
+	suite.Run(t, new(LsRefsSuite))
+}
+
+func (s *LsRefsSuite) TestEncode() {
+	req := NewLsRefsRequest()
+	req.Capabilities.Set(capability.Agent, "go-git/5.x")
+	req.ServerOptions = []string{"foo"}
+	req.Unborn = true
+	req.Prefixes = []string{"HEAD", "refs/heads/"}
+
+	var buf bytes.Buffer
+	s.NoError(req.Encode(&buf))
+	s.Equal(""+
+		"0014command=ls-refs\n"+
+		"0015agent=go-git/5.x\n"+
+		"0016server-option=foo\n"+
+		"0001"+
+		"000csymrefs\n"+
+		"0009peel\n"+
+		"000bunborn\n"+
+		"0014ref-prefix HEAD\n"+
+		"001bref-prefix refs/heads/\n"+
+		"0000",
+		buf.String(),
+	)
+}
+
+func (s *LsRefsSuite) TestDecodeLsRefs() {
+	raw := pktlines(s.T(),
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5 HEAD symref-target:refs/heads/master\n",
+		"e8d3ffab552895c19b9fcf7aa264d277cde33881 refs/heads/branch\n",
+		"8ab686eafeb1f44702738c8b0f24f2567c36da6d refs/tags/v1.0.0 peeled:6ecf0ef2c2dffb796033e5a02219af86ec6584e5\n",
+		"",
+	)
+
+	ar := NewAdvRefs()
+	s.NoError(ar.DecodeLsRefs(bytes.NewReader(raw)))
+
+	head := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	s.Equal(&head, ar.Head)
+	s.Equal(map[string]plumbing.Hash{
+		"refs/heads/master": head,
+		"refs/heads/branch": plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881"),
+		"refs/tags/v1.0.0":  plumbing.NewHash("8ab686eafeb1f44702738c8b0f24f2567c36da6d"),
+	}, ar.References)
+	s.Equal(map[string]plumbing.Hash{"refs/tags/v1.0.0": head}, ar.Peeled)
+	s.Equal([]string{"HEAD:refs/heads/master"}, ar.Capabilities.Get(capability.SymRef))
+
+	refs, err := ar.AllReferences()
+	s.NoError(err)
+	ref, err := refs.Reference(plumbing.HEAD)
+	s.NoError(err)
+	s.Equal(plumbing.Master, ref.Target())
+}
+
+func (s *LsRefsSuite) TestDecodeLsRefsUnborn() {
+	raw := pktlines(s.T(), "unborn HEAD symref-target:refs/heads/main\n", "")
+
+	ar := NewAdvRefs()
+	s.NoError(ar.DecodeLsRefs(bytes.NewReader(raw)))
+	s.True(ar.IsEmpty())
+	s.Equal([]string{"HEAD:refs/heads/main"}, ar.Capabilities.Get(capability.SymRef))
+}
+
+func (s *LsRefsSuite) TestDecodeLsRefsMalformed() {
+	for _, line := range []string{"foo\n", "foo HEAD\n", "unborn HEAD peeled:foo\n"} {
+		ar := NewAdvRefs()
+		err := ar.DecodeLsRefs(bytes.NewReader(pktlines(s.T(), line, "")))
+		s.Error(err, line)
+	}
+}
+
+func (s *LsRefsSuite) TestEncodeLsRefs() {
+	head := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	ar := NewAdvRefs()
+	ar.Head = &head
+	ar.Capabilities.Set(capability.SymRef, "HEAD:refs/heads/master")
+	ar.References["refs/heads/master"] = head
+	ar.References["refs/heads/branch"] = plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")
+	ar.References["refs/tags/v1.0.0"] = plumbing.NewHash("8ab686eafeb1f44702738c8b0f24f2567c36da6d")
+	ar.Peeled["refs/tags/v1.0.0"] = head
+
+	var buf bytes.Buffer
+	s.NoError(ar.EncodeLsRefs(&buf))
+	s.Equal(string(pktlines(s.T(),
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5 HEAD symref-target:refs/heads/master\n",
+		"e8d3ffab552895c19b9fcf7aa264d277cde33881 refs/heads/branch\n",
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/heads/master\n",
+		"8ab686eafeb1f44702738c8b0f24f2567c36da6d refs/tags/v1.0.0 peeled:6ecf0ef2c2dffb796033e5a02219af86ec6584e5\n",
+		"",
+	)), buf.String())
+
+	decoded := NewAdvRefs()
+	s.NoError(decoded.DecodeLsRefs(&buf))
+	s.Equal(ar.Head, decoded.Head)
+	s.Equal(ar.References, decoded.References)
+	s.Equal(ar.Peeled, decoded.Peeled)
+}
+
+func (s *LsRefsSuite) TestEncodeLsRefsUnborn() {
+	ar := NewAdvRefs()
+	ar.Capabilities.Set(capability.SymRef, "HEAD:refs/heads/main")
+
+	var buf bytes.Buffer
+	s.NoError(ar.EncodeLsRefs(&buf))
+	s.Equal(string(pktlines(s.T(), "unborn HEAD symref-target:refs/heads/main\n", "")), buf.String())
+}
+
+func (s *LsRefsSuite) TestFilter() {
+	ar := NewAdvRefs()
+	head := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	ar.Head = &head
+	ar.References["refs/heads/master"] = head
+	ar.References["refs/tags/v1.0.0"] = head
+	ar.Peeled["refs/tags/v1.0.0"] = head
+
+	req := NewLsRefsRequest()
+	req.Prefixes = []string{"refs/heads/"}
+
+	f := req.Filter(ar)
+	s.Nil(f.Head)
+	s.Equal(map[string]plumbing.Hash{"refs/heads/master": head}, f.References)
+	s.Empty(f.Peeled)
+
+	req.Prefixes = nil
+	f = req.Filter(ar)
+	s.Equal(ar.Head, f.Head)
+	s.Len(f.References, 2)
+}
@@ -0,0 +1,195 @@
+package packp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+)
+
+const (
+	sizeAttr = "size"
+	oidArg   = "oid "
+)
+
+// ObjectInfoRequest values represent the object-info command of the version
+// 2 of the protocol, requesting information about objects of the server
+// without downloading them.
+type ObjectInfoRequest struct {
+	// Capabilities are the capabilities of the request, such as agent or
+	// object-format.
+	Capabilities *capability.List
+	// ServerOptions are the server options sent with the command.
+	ServerOptions []string
+	// Size requests the size of the objects.
+	Size bool
+	// Oids are the objects requested.
+	Oids []plumbing.Hash
+}
+
+// NewObjectInfoRequest returns a pointer to a new ObjectInfoRequest value,
+// ready to be used. It requests the size of the objects.
+func NewObjectInfoRequest() *ObjectInfoRequest {
+	return &ObjectInfoRequest{
+		Capabilities: capability.NewList(),
+		Size:         true,
+	}
+}
+
+// Encode writes the object-info command to the stream.
+func (req *ObjectInfoRequest) Encode(w io.Writer) error {
+	var args []string
+	if req.Size {
+		args = append(args, sizeAttr)
+	}
+
+	for _, h := range req.Oids {
+		args = append(args, oidArg+h.String())
+	}
+
+	cmd := &CommandRequest{
+		Command:       capability.ObjectInfo,
+		Capabilities:  req.Capabilities,
+		ServerOptions: req.ServerOptions,
+		Args:          args,
+	}
+
+	return cmd.Encode(w)
+}
+
+// DecodeCommand reads the capabilities, server options and arguments of the
+// object-info command request into the request.
+func (req *ObjectInfoRequest) DecodeCommand(c *CommandRequest) error {
+	if c.Command != capability.ObjectInfo {
+		return NewErrUnexpectedData("unexpected command", []byte(c.Command))
+	}
+
+	req.Capabilities = c.Capabilities
+	req.ServerOptions = c.ServerOptions
+	req.Size = false
+	req.Oids = nil
+
+	for _, arg := range c.Args {
+		switch {
+		case arg == sizeAttr:
+			req.Size = true
+		case strings.HasPrefix(arg, oidArg):
+			h, err := decodeHash(strings.TrimPrefix(arg, oidArg), []byte(arg))
+			if err != nil {
+				return err
+			}
+
+			req.Oids = append(req.Oids, h)
+		default:
+			return NewErrUnexpectedData("unexpected object-info argument", []byte(arg))
+		}
+	}
+
+	return nil
+}
+
+// ObjectInfo is the information about an object sent on the response of the
+// object-info command.
+type ObjectInfo struct {
+	// Hash is the hash of the object.
+	Hash plumbing.Hash
+	// Size is the size of the object, -1 if it wasn't requested or if the
+	// object doesn't exist.
+	Size int64
+}
+
+// ObjectInfoResponse values represent the response of the object-info
+// command.
+type ObjectInfoResponse struct {
+	// Size is true if the response has the size of the objects.
+	Size bool
+	// Objects are the information about each object requested, in the order
+	// of the request.
+	Objects []ObjectInfo
+}
+
+// NewObjectInfoResponse returns a pointer to a new ObjectInfoResponse value,
+// ready to be used.
+func NewObjectInfoResponse() *ObjectInfoResponse {
+	return &ObjectInfoResponse{}
+}
+
+// Encode writes the response to the stream: the attributes requested and a
+// line for each object, only with its hash if it doesn't exist.
+func (r *ObjectInfoResponse) Encode(w io.Writer) error {
+	if r.Size {
+		if _, err := pktline.Writef(w, "%s\n", sizeAttr); err != nil {
+			return err
+		}
+	}
+
+	for _, o := range r.Objects {
+		line := o.Hash.String()
+		if r.Size && o.Size >= 0 {
+			line += " " + strconv.FormatInt(o.Size, 10)
+		}
+
+		if _, err := pktline.Writef(w, "%s\n", line); err != nil {
+			return err
+		}
+	}
+
+	return pktline.WriteFlush(w)
+}
+
+// Decode reads the response from the stream, up to its flush-pkt.
+func (r *ObjectInfoResponse) Decode(rd io.Reader) error {
+	for n := 0; ; n++ {
+		l, p, err := pktline.ReadLine(rd)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return io.ErrUnexpectedEOF
+			}
+
+			return err
+		}
+
+		if l == pktline.Flush {
+			return nil
+		}
+
+		line := bytes.TrimSuffix(p, eol)
+		if n == 0 && string(line) == sizeAttr {
+			r.Size = true
+			continue
+		}
+
+		if err := r.decodeLine(line); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *ObjectInfoResponse) decodeLine(line []byte) error {
+	oid, size, ok := strings.Cut(string(line), " ")
+	h, err := decodeHash(oid, line)
+	if err != nil {
+		return err
+	}
+
+	o := ObjectInfo{Hash: h, Size: -1}
+	if ok {
+		if !r.Size {
+			return NewErrUnexpectedData("unexpected object attribute", line)
+		}
+
+		o.Size, err = strconv.ParseInt(size, 10, 64)
+		if err != nil {
+			return NewErrUnexpectedData(fmt.Sprintf("invalid size: %s", err), line)
+		}
+	}
+
+	r.Objects = append(r.Objects, o)
+	return nil
+}
@@ -0,0 +1,75 @@
+package packp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/suite"
+)
+
+type ObjectInfoSuite struct {
+	suite.Suite
+}
+
+func TestObjectInfoSuite(t *testing.T) {
+	suite.Run(t, new(ObjectInfoSuite))
+}
+
+func (s *ObjectInfoSuite) TestRequest() {
+	req := NewObjectInfoRequest()
+	req.Oids = []plumbing.Hash{plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")}
+
+	var buf bytes.Buffer
+	s.NoError(req.Encode(&buf))
+	s.Equal(""+
+		"0018command=object-info\n"+
+		"0001"+
+		"0009size\n"+
+		"0031oid 6ecf0ef2c2dffb796033e5a02219af86ec6584e5\n"+
+		"0000",
+		buf.String(),
+	)
+
+	cmd := NewCommandRequest()
+	s.NoError(cmd.Decode(&buf))
+
+	decoded := NewObjectInfoRequest()
+	s.NoError(decoded.DecodeCommand(cmd))
+	s.Equal(req, decoded)
+
+	cmd.Args = []string{"oid foo"}
+	s.Error(decoded.DecodeCommand(cmd))
+}
+
+func (s *ObjectInfoSuite) TestResponse() {
+	res := NewObjectInfoResponse()
+	res.Size = true
+	res.Objects = []ObjectInfo{
+		{Hash: plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"), Size: 42},
+		{Hash: plumbing.NewHash("1111111111111111111111111111111111111111"), Size: -1},
+	}
+
+	var buf bytes.Buffer
+	s.NoError(res.Encode(&buf))
+	s.Equal(string(pktlines(s.T(),
+		"size\n",
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5 42\n",
+		"1111111111111111111111111111111111111111\n",
+		"",
+	)), buf.String())
+
+	decoded := NewObjectInfoResponse()
+	s.NoError(decoded.Decode(&buf))
+	s.Equal(res, decoded)
+}
+
+func (s *ObjectInfoSuite) TestResponseMalformed() {
+	for _, line := range []string{"foo\n", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5 42\n"} {
+		err := NewObjectInfoResponse().Decode(bytes.NewReader(pktlines(s.T(), line, "")))
+		s.Error(err, line)
+	}
+
+	err := NewObjectInfoResponse().Decode(bytes.NewReader(pktlines(s.T(), "size\n", "foo 42\n", "")))
+	s.Error(err)
+}
@@ -82,6 +82,14 @@ func (r *ShallowUpdate) decodeLine(line, prefix []byte, expLen int) (plumbing.Ha
 }
 
 func (r *ShallowUpdate) Encode(w io.Writer) error {
+	if err := r.encodeLines(w); err != nil {
+		return err
+	}
+
+	return pktline.WriteFlush(w)
+}
+
+func (r *ShallowUpdate) encodeLines(w io.Writer) error {
 	for _, h := range r.Shallows {
 		if _, err := pktline.Writef(w, "%s%s\n", shallow, h.String()); err != nil {
 			return err
@@ -94,5 +102,5 @@ func (r *ShallowUpdate) Encode(w io.Writer) error {
 		}
 	}
 
-	return pktline.WriteFlush(w)
+	return nil
 }
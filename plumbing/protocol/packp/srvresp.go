@@ -124,6 +124,49 @@ func (r *ServerResponse) decodeACKLine(line []byte) error {
 	return nil
 }
 
+// decodeAcknowledgment decodes a line of the acknowledgments section of the
+// version 2 of the protocol.
+func (r *ServerResponse) decodeAcknowledgment(line []byte) error {
+	switch {
+	case bytes.Equal(line, nak), bytes.Equal(line, []byte("ready")):
+		return nil
+	case bytes.HasPrefix(line, ack) && len(line) >= ackLineLen:
+		r.ACKs = append(r.ACKs, plumbing.NewHash(string(line[4:ackLineLen])))
+		return nil
+	}
+
+	return NewErrUnexpectedData("unexpected acknowledgment", line)
+}
+
+// encodeAcknowledgments writes the acknowledgments section of the version 2 of
+// the protocol: an ACK for each common object, or NAK if there are none, and
+// ready if the server is going to send the packfile.
+func (r *ServerResponse) encodeAcknowledgments(w io.Writer, ready bool) error {
+	if _, err := pktline.WriteString(w, "acknowledgments\n"); err != nil {
+		return err
+	}
+
+	if len(r.ACKs) == 0 {
+		if _, err := pktline.Writef(w, "%s\n", nak); err != nil {
+			return err
+		}
+	}
+
+	for _, h := range r.ACKs {
+		if _, err := pktline.Writef(w, "%s %s\n", ack, h); err != nil {
+			return err
+		}
+	}
+
+	if ready {
+		if _, err := pktline.WriteString(w, "ready\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Encode encodes the ServerResponse into a writer.
 func (r *ServerResponse) Encode(w io.Writer) error {
 	multiAck := r.req.Capabilities.Supports(capability.MultiACK)
@@ -19,6 +19,20 @@ type UploadRequest struct {
 	Depth        Depth
 	Filter       Filter
 	HavesUR      chan UploadRequestHave
+
+	// WantRefs are the references wanted by name, resolved by the server
+	// when the request is received. Only sent on the version 2 of the
+	// protocol, capability.RefInWant MUST be present.
+	WantRefs []plumbing.ReferenceName
+	// ServerOptions are the server options sent with the request. Only sent
+	// on the version 2 of the protocol, capability.ServerOption MUST be
+	// present.
+	ServerOptions []string
+	// PackfileURIProtocols are the protocols of the URIs accepted by the
+	// client to download some of the objects as separate packfiles, such as
+	// https. Only sent on the version 2 of the protocol,
+	// capability.PackfileURIs MUST be present.
+	PackfileURIProtocols []string
 }
 
 type UploadRequestHave struct {
@@ -110,15 +124,18 @@ func NewUploadRequestFromCapabilities(adv *capability.List) *UploadRequest {
 }
 
 // Validate validates the content of UploadRequest, following the next rules:
-//   - Wants MUST have at least one reference
+//   - Wants or WantRefs MUST have at least one reference
 //   - capability.Shallow MUST be present if Shallows is not empty
 //   - is a non-zero DepthCommits is given capability.Shallow MUST be present
 //   - is a DepthSince is given capability.Shallow MUST be present
 //   - is a DepthReference is given capability.DeepenNot MUST be present
 //   - MUST contain only maximum of one of capability.Sideband and capability.Sideband64k
 //   - MUST contain only maximum of one of capability.MultiACK and capability.MultiACKDetailed
+//   - capability.RefInWant MUST be present if WantRefs is not empty
+//   - capability.ServerOption MUST be present if ServerOptions is not empty
+//   - capability.PackfileURIs MUST be present if PackfileURIProtocols is not empty
 func (req *UploadRequest) Validate() error {
-	if len(req.Wants) == 0 {
+	if len(req.Wants) == 0 && len(req.WantRefs) == 0 {
 		return fmt.Errorf("want can't be empty")
 	}
 
@@ -140,6 +157,18 @@ func (req *UploadRequest) validateRequiredCapabilities() error {
 		return fmt.Errorf(msg, capability.Shallow)
 	}
 
+	if len(req.WantRefs) != 0 && !req.Capabilities.Supports(capability.RefInWant) {
+		return fmt.Errorf(msg, capability.RefInWant)
+	}
+
+	if len(req.ServerOptions) != 0 && !req.Capabilities.Supports(capability.ServerOption) {
+		return fmt.Errorf(msg, capability.ServerOption)
+	}
+
+	if len(req.PackfileURIProtocols) != 0 && !req.Capabilities.Supports(capability.PackfileURIs) {
+		return fmt.Errorf(msg, capability.PackfileURIs)
+	}
+
 	switch req.Depth.(type) {
 	case DepthCommits:
 		if req.Depth != DepthCommits(0) {
@@ -10,6 +10,7 @@ import (
 
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
 )
 
 // Decode reads the next upload-request form its input and
@@ -149,6 +150,10 @@ func (d *ulReqDecoder) decodeOtherWants() stateFn {
 		return d.decodeDeepen
 	}
 
+	if bytes.HasPrefix(d.line, filter) {
+		return d.decodeFilter
+	}
+
 	if len(d.line) == 0 {
 		return d.decodeHaves
 	}
@@ -189,6 +194,11 @@ func (d *ulReqDecoder) decodeShallow() stateFn {
 		return nil
 	}
 	d.data.Shallows = append(d.data.Shallows, hash)
+	// The clients don't send the shallow capability, it's implied by the
+	// shallow lines.
+	if d.err = d.data.Capabilities.Set(capability.Shallow); d.err != nil {
+		return nil
+	}
 
 	if ok := d.nextLine(true); !ok {
 		return nil
@@ -227,6 +237,11 @@ func (d *ulReqDecoder) decodeDeepenCommits() stateFn {
 		return nil
 	}
 	d.data.Depth = DepthCommits(n)
+	if n != 0 {
+		if d.err = d.data.Capabilities.Set(capability.Shallow); d.err != nil {
+			return nil
+		}
+	}
 
 	return d.decodeOtherWants
 }
@@ -253,6 +268,13 @@ func (d *ulReqDecoder) decodeDeepenReference() stateFn {
 	return d.decodeOtherWants
 }
 
+// Expected format: filter <filter-spec>
+func (d *ulReqDecoder) decodeFilter() stateFn {
+	d.data.Filter = Filter(bytes.TrimPrefix(d.line, filter))
+
+	return d.decodeOtherWants
+}
+
 func (d *ulReqDecoder) decodeHaves() stateFn {
 	go func() {
 		inBetweenHave := []plumbing.Hash{}
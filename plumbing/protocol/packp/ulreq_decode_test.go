@@ -498,6 +498,19 @@ func (s *UlReqDecodeSuite) TestDeepenReference() {
 	s.Equal(expected, string(reference))
 }
 
+func (s *UlReqDecodeSuite) TestFilter() {
+	payloads := []string{
+		"want 3333333333333333333333333333333333333333 ofs-delta filter",
+		"deepen 1",
+		"filter combine:blob%3Anone+tree%3A2",
+		"",
+	}
+	ur, _ := s.testDecodeOK(payloads, 0)
+
+	s.Equal(DepthCommits(1), ur.Depth)
+	s.Equal(FilterCombine(FilterBlobNone(), FilterTreeDepth(2)), ur.Filter)
+}
+
 func (s *UlReqDecodeSuite) TestAll() {
 	payloads := []string{
 		"want 3333333333333333333333333333333333333333 ofs-delta multi_ack",
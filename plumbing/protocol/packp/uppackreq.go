@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/format/pktline"
@@ -53,9 +56,10 @@ func NewUploadPackRequestFromCapabilities(adv *capability.List) *UploadPackReque
 }
 
 // IsEmpty returns whether a request is empty - it is empty if Haves are contained
-// in the Wants, or if Wants length is zero, and we don't have any shallows
+// in the Wants, or if Wants length is zero, and we don't have any shallows or
+// wanted references
 func (r *UploadPackRequest) IsEmpty() bool {
-	return isSubset(r.Wants, r.Haves) && len(r.Shallows) == 0
+	return isSubset(r.Wants, r.Haves) && len(r.Shallows) == 0 && len(r.WantRefs) == 0
 }
 
 func isSubset(needle []plumbing.Hash, haystack []plumbing.Hash) bool {
@@ -80,6 +84,9 @@ func isSubset(needle []plumbing.Hash, haystack []plumbing.Hash) bool {
 // upload-pack. Do not use this directly. Use UploadPackRequest request instead.
 type UploadHaves struct {
 	Haves []plumbing.Hash
+	// Done is set if the client ended the negotiation, only decoded on the
+	// version 2 of the protocol.
+	Done bool
 }
 
 // Encode encodes the UploadHaves into the Writer. If flush is true, a flush
@@ -108,3 +115,175 @@ func (u *UploadHaves) Encode(w io.Writer, flush bool) error {
 
 	return nil
 }
+
+// EncodeV2 writes the request as the fetch command of the version 2 of the
+// protocol. The agent and object-format capabilities are sent as capabilities
+// of the command, the ones of the packfile, such as thin-pack or ofs-delta, as
+// arguments. The negotiation is done in a single round, the haves are
+// followed by done.
+func (r *UploadPackRequest) EncodeV2(w io.Writer) error {
+	if len(r.Wants) == 0 && len(r.WantRefs) == 0 {
+		return fmt.Errorf("empty wants provided")
+	}
+
+	caps := capability.NewList()
+	for _, c := range []capability.Capability{capability.Agent, capability.ObjectFormat} {
+		if v := r.Capabilities.Get(c); len(v) != 0 {
+			if err := caps.Set(c, v[0]); err != nil {
+				return err
+			}
+		}
+	}
+
+	var args []string
+	for _, c := range []capability.Capability{
+		capability.ThinPack, capability.NoProgress,
+		capability.IncludeTag, capability.OFSDelta,
+	} {
+		if r.Capabilities.Supports(c) {
+			args = append(args, c.String())
+		}
+	}
+
+	args = appendHashes(args, want, r.Wants)
+	for _, ref := range r.WantRefs {
+		args = append(args, fmt.Sprintf("want-ref %s", ref))
+	}
+
+	args = appendHashes(args, shallow, r.Shallows)
+	switch depth := r.Depth.(type) {
+	case DepthCommits:
+		if depth != 0 {
+			args = append(args, fmt.Sprintf("deepen %d", depth))
+		}
+	case DepthSince:
+		args = append(args, fmt.Sprintf("deepen-since %d", time.Time(depth).UTC().Unix()))
+	case DepthReference:
+		args = append(args, fmt.Sprintf("deepen-not %s", depth))
+	}
+
+	if !r.Depth.IsZero() && r.Capabilities.Supports(capability.DeepenRelative) {
+		args = append(args, capability.DeepenRelative.String())
+	}
+
+	if r.Filter != "" {
+		args = append(args, fmt.Sprintf("filter %s", r.Filter))
+	}
+
+	if len(r.PackfileURIProtocols) != 0 {
+		args = append(args, fmt.Sprintf("%s %s", capability.PackfileURIs,
+			strings.Join(r.PackfileURIProtocols, ",")))
+	}
+
+	args = appendHashes(args, have, r.Haves)
+	args = append(args, string(done))
+
+	cmd := &CommandRequest{
+		Command:       capability.Fetch,
+		Capabilities:  caps,
+		ServerOptions: r.ServerOptions,
+		Args:          args,
+	}
+
+	return cmd.Encode(w)
+}
+
+// DecodeCommand reads the capabilities, server options and arguments of the
+// fetch command request of the version 2 of the protocol into the request.
+// The capabilities implied by the arguments, such as shallow or ref-in-want,
+// are set in the capabilities of the request.
+func (r *UploadPackRequest) DecodeCommand(c *CommandRequest) error {
+	if c.Command != capability.Fetch {
+		return NewErrUnexpectedData("unexpected command", []byte(c.Command))
+	}
+
+	r.Capabilities = c.Capabilities
+	r.ServerOptions = c.ServerOptions
+	if len(r.ServerOptions) != 0 {
+		_ = r.Capabilities.Set(capability.ServerOption)
+	}
+
+	for _, arg := range c.Args {
+		if err := r.decodeArg(arg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *UploadPackRequest) decodeArg(arg string) error {
+	name, value, _ := strings.Cut(arg, " ")
+	switch c := capability.Capability(name); c {
+	case capability.ThinPack, capability.NoProgress, capability.IncludeTag,
+		capability.OFSDelta, capability.DeepenRelative:
+		return r.Capabilities.Set(c)
+	case "want", "have", "shallow":
+		if !plumbing.IsHash(value) {
+			return NewErrUnexpectedData("invalid hash", []byte(arg))
+		}
+
+		h := plumbing.NewHash(value)
+		switch name {
+		case "want":
+			r.Wants = append(r.Wants, h)
+		case "have":
+			r.Haves = append(r.Haves, h)
+		default:
+			r.Shallows = append(r.Shallows, h)
+			return r.Capabilities.Set(capability.Shallow)
+		}
+	case "want-ref":
+		r.WantRefs = append(r.WantRefs, plumbing.ReferenceName(value))
+		return r.Capabilities.Set(capability.RefInWant)
+	case "done":
+		r.Done = true
+	case "deepen":
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return NewErrUnexpectedData("invalid depth", []byte(arg))
+		}
+
+		r.Depth = DepthCommits(n)
+		return r.Capabilities.Set(capability.Shallow)
+	case capability.DeepenSince:
+		secs, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return NewErrUnexpectedData("invalid deepen-since", []byte(arg))
+		}
+
+		r.Depth = DepthSince(time.Unix(secs, 0).UTC())
+		return r.Capabilities.Set(c)
+	case capability.DeepenNot:
+		r.Depth = DepthReference(value)
+		return r.Capabilities.Set(c)
+	case capability.Filter:
+		r.Filter = Filter(value)
+		return r.Capabilities.Set(c)
+	case capability.PackfileURIs:
+		r.PackfileURIProtocols = strings.Split(value, ",")
+		return r.Capabilities.Set(c)
+	default:
+		return NewErrUnexpectedData("unexpected fetch argument", []byte(arg))
+	}
+
+	return nil
+}
+
+// appendHashes appends a line for each hash with the given prefix to args,
+// sorted and without duplicates.
+func appendHashes(args []string, prefix []byte, hashes []plumbing.Hash) []string {
+	plumbing.HashesSort(hashes)
+
+	var last plumbing.Hash
+	for i, h := range hashes {
+		if i > 0 && h == last {
+			continue
+		}
+
+		args = append(args, fmt.Sprintf("%s%s", prefix, h))
+		last = h
+	}
+
+	return args
+}
@@ -54,6 +54,106 @@ func (s *UploadPackRequestSuite) TestIsEmpty() {
 	s.False(r.IsEmpty())
 }
 
+func (s *UploadPackRequestSuite) TestEncodeV2() {
+	r := NewUploadPackRequest()
+	r.Capabilities.Set(capability.Agent, "go-git/5.x")
+	r.Capabilities.Set(capability.OFSDelta)
+	r.Capabilities.Set(capability.Sideband64k)
+	r.Capabilities.Set(capability.Shallow)
+	r.Wants = append(r.Wants,
+		plumbing.NewHash("2222222222222222222222222222222222222222"),
+		plumbing.NewHash("1111111111111111111111111111111111111111"),
+	)
+	r.WantRefs = append(r.WantRefs, plumbing.Master)
+	r.Haves = append(r.Haves, plumbing.NewHash("3333333333333333333333333333333333333333"))
+	r.Depth = DepthCommits(1)
+	r.ServerOptions = []string{"foo"}
+	r.PackfileURIProtocols = []string{"https", "http"}
+
+	buf := bytes.NewBuffer(nil)
+	s.NoError(r.EncodeV2(buf))
+	s.Equal(""+
+		"0012command=fetch\n"+
+		"0015agent=go-git/5.x\n"+
+		"0016server-option=foo\n"+
+		"0001"+
+		"000eofs-delta\n"+
+		"0032want 1111111111111111111111111111111111111111\n"+
+		"0032want 2222222222222222222222222222222222222222\n"+
+		"001fwant-ref refs/heads/master\n"+
+		"000ddeepen 1\n"+
+		"001dpackfile-uris https,http\n"+
+		"0032have 3333333333333333333333333333333333333333\n"+
+		"0009done\n"+
+		"0000",
+		buf.String(),
+	)
+
+	s.Error(NewUploadPackRequest().EncodeV2(buf))
+}
+
+func (s *UploadPackRequestSuite) TestDecodeCommand() {
+	r := NewUploadPackRequest()
+	r.Capabilities.Set(capability.Agent, "go-git/5.x")
+	r.Capabilities.Set(capability.OFSDelta)
+	r.Capabilities.Set(capability.RefInWant)
+	r.Capabilities.Set(capability.DeepenNot)
+	r.Wants = append(r.Wants, plumbing.NewHash("1111111111111111111111111111111111111111"))
+	r.WantRefs = append(r.WantRefs, plumbing.Master)
+	r.Haves = append(r.Haves, plumbing.NewHash("3333333333333333333333333333333333333333"))
+	r.Depth = DepthReference("refs/heads/foo")
+	r.Filter = FilterBlobNone()
+	r.ServerOptions = []string{"foo"}
+
+	var buf bytes.Buffer
+	s.NoError(r.EncodeV2(&buf))
+
+	cmd := NewCommandRequest()
+	s.NoError(cmd.Decode(&buf))
+
+	decoded := NewUploadPackRequest()
+	s.NoError(decoded.DecodeCommand(cmd))
+	s.NoError(decoded.Validate())
+	s.Equal(r.Wants, decoded.Wants)
+	s.Equal(r.WantRefs, decoded.WantRefs)
+	s.Equal(r.Haves, decoded.Haves)
+	s.Equal(r.Depth, decoded.Depth)
+	s.Equal(r.Filter, decoded.Filter)
+	s.Equal(r.ServerOptions, decoded.ServerOptions)
+	s.True(decoded.Done)
+	for _, c := range []capability.Capability{
+		capability.Agent, capability.OFSDelta, capability.RefInWant,
+		capability.DeepenNot, capability.Filter, capability.ServerOption,
+	} {
+		s.True(decoded.Capabilities.Supports(c), c)
+	}
+
+	cmd.Args = []string{"deepen 0"}
+	s.Error(NewUploadPackRequest().DecodeCommand(cmd))
+
+	cmd.Args = []string{"want foo"}
+	s.Error(NewUploadPackRequest().DecodeCommand(cmd))
+
+	cmd.Args = []string{"sideband-all"}
+	s.Error(NewUploadPackRequest().DecodeCommand(cmd))
+}
+
+func (s *UploadPackRequestSuite) TestValidateV2() {
+	r := NewUploadPackRequest()
+	r.WantRefs = append(r.WantRefs, plumbing.Master)
+	s.ErrorContains(r.Validate(), "missing capability ref-in-want")
+
+	r.Capabilities.Set(capability.RefInWant)
+	s.NoError(r.Validate())
+
+	r.ServerOptions = []string{"foo"}
+	s.ErrorContains(r.Validate(), "missing capability server-option")
+
+	r.Capabilities.Set(capability.ServerOption)
+	s.NoError(r.Validate())
+	s.False(r.IsEmpty())
+}
+
 type UploadHavesSuite struct {
 	suite.Suite
 }
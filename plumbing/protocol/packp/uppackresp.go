@@ -2,10 +2,16 @@ package packp
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
+	"fmt"
 	"io"
+	"strings"
 
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
 	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/sideband"
 	"github.com/go-git/go-git/v5/utils/ioutil"
 )
 
@@ -21,6 +27,15 @@ type UploadPackResponse struct {
 	ShallowUpdate
 	ServerResponse
 
+	// WantedRefs are the references requested by name, with the hash they
+	// were resolved to by the server. Only sent on the version 2 of the
+	// protocol.
+	WantedRefs []*plumbing.Reference
+	// PackfileURIs are the packfiles to be downloaded by the client, in
+	// addition to the packfile of the response. Only sent on the version 2
+	// of the protocol.
+	PackfileURIs []PackfileURI
+
 	r          io.ReadCloser
 	isShallow  bool
 	isMultiACK bool
@@ -29,7 +44,7 @@ type UploadPackResponse struct {
 // NewUploadPackResponse create a new UploadPackResponse instance, the request
 // being responded by the response is required.
 func NewUploadPackResponse(req *UploadPackRequest) *UploadPackResponse {
-	isShallow := !req.Depth.IsZero()
+	isShallow := !req.Depth.IsZero() || len(req.Shallows) != 0
 	isMultiACK := req.Capabilities.Supports(capability.MultiACK) ||
 		req.Capabilities.Supports(capability.MultiACKDetailed)
 
@@ -71,6 +86,122 @@ func (r *UploadPackResponse) Decode(reader io.ReadCloser) error {
 	return nil
 }
 
+// DecodeV2 decodes the response of the fetch command of the version 2 of the
+// protocol into the struct, section by section, and prepares it to read the
+// packfile using the Read method. The packfile is demultiplexed unless the
+// request was done with any Sideband capability. If the server isn't ready to
+// send the packfile, only the acknowledgments are decoded.
+func (r *UploadPackResponse) DecodeV2(reader io.ReadCloser) error {
+	buf := bufio.NewReader(reader)
+
+	for {
+		l, p, err := pktline.ReadLine(buf)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return io.ErrUnexpectedEOF
+			}
+
+			return err
+		}
+
+		if l < pktline.LenSize {
+			return NewErrUnexpectedData("missing packfile section", nil)
+		}
+
+		var flush bool
+		section := string(bytes.TrimSuffix(p, eol))
+		switch section {
+		case "acknowledgments":
+			flush, err = decodeSection(buf, r.ServerResponse.decodeAcknowledgment)
+			if err == nil && flush {
+				return nil
+			}
+		case "shallow-info":
+			err = r.ShallowUpdate.Decode(buf)
+		case "wanted-refs":
+			_, err = decodeSection(buf, r.decodeWantedRef)
+		case "packfile-uris":
+			_, err = decodeSection(buf, r.decodePackfileURI)
+		case "packfile":
+			r.r = ioutil.NewReadCloser(r.packfileReader(buf), reader)
+			return nil
+		default:
+			return NewErrUnexpectedData("unexpected section", p)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (r *UploadPackResponse) packfileReader(buf io.Reader) io.Reader {
+	if req := r.ServerResponse.req; req != nil &&
+		(req.Capabilities.Supports(capability.Sideband) ||
+			req.Capabilities.Supports(capability.Sideband64k)) {
+		return buf
+	}
+
+	return sideband.NewDemuxer(sideband.Sideband64k, buf)
+}
+
+func (r *UploadPackResponse) decodeWantedRef(line []byte) error {
+	h, name, ok := strings.Cut(string(line), " ")
+	if !ok || !plumbing.IsHash(h) {
+		return NewErrUnexpectedData("malformed wanted-ref", line)
+	}
+
+	ref := plumbing.NewHashReference(plumbing.ReferenceName(name), plumbing.NewHash(h))
+	r.WantedRefs = append(r.WantedRefs, ref)
+	return nil
+}
+
+func (r *UploadPackResponse) decodePackfileURI(line []byte) error {
+	h, uri, ok := strings.Cut(string(line), " ")
+	if !ok || !plumbing.IsHash(h) || uri == "" {
+		return NewErrUnexpectedData("malformed packfile-uri", line)
+	}
+
+	r.PackfileURIs = append(r.PackfileURIs, PackfileURI{Hash: plumbing.NewHash(h), URI: uri})
+	return nil
+}
+
+// decodeSection reads the lines of a section of the response of the version 2
+// of the protocol, up to the delim-pkt or flush-pkt ending it. It returns
+// true if the section is ended by a flush-pkt, ending the response.
+func decodeSection(r io.Reader, fn func(line []byte) error) (bool, error) {
+	for {
+		l, p, err := pktline.ReadLine(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return false, io.ErrUnexpectedEOF
+			}
+
+			return false, err
+		}
+
+		if l < pktline.LenSize {
+			return l == pktline.Flush, nil
+		}
+
+		if err := fn(bytes.TrimSuffix(p, eol)); err != nil {
+			return false, err
+		}
+	}
+}
+
+// PackfileURI is a packfile to be downloaded by the client from the URI, the
+// hash is the checksum of the packfile.
+type PackfileURI struct {
+	Hash plumbing.Hash
+	URI  string
+}
+
+// String returns the packfile-uri line of the packfile.
+func (u PackfileURI) String() string {
+	return fmt.Sprintf("%s %s", u.Hash, u.URI)
+}
+
 // Encode encodes an UploadPackResponse.
 func (r *UploadPackResponse) Encode(w io.Writer) (err error) {
 	if r.isShallow {
@@ -88,6 +219,96 @@ func (r *UploadPackResponse) Encode(w io.Writer) (err error) {
 	return err
 }
 
+// EncodeV2 encodes the response to the fetch command of the version 2 of the
+// protocol. The acknowledgments section is sent unless the request ended the
+// negotiation, the rest of the sections only if the response has a packfile,
+// the server being ready to send it. The packfile is always multiplexed.
+func (r *UploadPackResponse) EncodeV2(w io.Writer) (err error) {
+	if r.r != nil {
+		defer ioutil.CheckClose(r.r, &err)
+	}
+
+	if !r.req.Done {
+		if err := r.ServerResponse.encodeAcknowledgments(w, r.r != nil); err != nil {
+			return err
+		}
+
+		if r.r == nil {
+			return pktline.WriteFlush(w)
+		}
+
+		if err := pktline.WriteDelim(w); err != nil {
+			return err
+		}
+	}
+
+	if r.r == nil {
+		return fmt.Errorf("missing packfile")
+	}
+
+	if r.isShallow || len(r.Shallows) != 0 || len(r.Unshallows) != 0 {
+		if err := encodeSection(w, "shallow-info", r.ShallowUpdate.encodeLines); err != nil {
+			return err
+		}
+	}
+
+	if len(r.WantedRefs) != 0 {
+		if err := encodeSection(w, "wanted-refs", r.encodeWantedRefs); err != nil {
+			return err
+		}
+	}
+
+	if len(r.PackfileURIs) != 0 {
+		if err := encodeSection(w, "packfile-uris", r.encodePackfileURIs); err != nil {
+			return err
+		}
+	}
+
+	if _, err := pktline.WriteString(w, "packfile\n"); err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(sideband.NewMuxer(sideband.Sideband64k, w), r.r); err != nil {
+		return err
+	}
+
+	return pktline.WriteFlush(w)
+}
+
+func (r *UploadPackResponse) encodeWantedRefs(w io.Writer) error {
+	for _, ref := range r.WantedRefs {
+		if _, err := pktline.Writef(w, "%s %s\n", ref.Hash(), ref.Name()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *UploadPackResponse) encodePackfileURIs(w io.Writer) error {
+	for _, uri := range r.PackfileURIs {
+		if _, err := pktline.Writef(w, "%s\n", uri); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encodeSection writes a section of the response of the version 2 of the
+// protocol, its header, the lines written by fn and a delim-pkt.
+func encodeSection(w io.Writer, header string, fn func(w io.Writer) error) error {
+	if _, err := pktline.Writef(w, "%s\n", header); err != nil {
+		return err
+	}
+
+	if err := fn(w); err != nil {
+		return err
+	}
+
+	return pktline.WriteDelim(w)
+}
+
 // Read reads the packfile data, if the request was done with any Sideband
 // capability the content read should be demultiplexed. If the methods wasn't
 // called before the ErrUploadPackResponseNotDecoded will be return
@@ -170,3 +170,140 @@ func FuzzDecoder(f *testing.F) {
 		res.Decode(io.NopCloser(bytes.NewReader(input)))
 	})
 }
+
+func (s *UploadPackResponseSuite) TestDecodeV2() {
+	raw := "" +
+		"0014acknowledgments\n" +
+		"0008NAK\n" +
+		"0001" +
+		"0011shallow-info\n" +
+		"0035shallow 1111111111111111111111111111111111111111\n" +
+		"0001" +
+		"0010wanted-refs\n" +
+		"003f2222222222222222222222222222222222222222 refs/heads/master\n" +
+		"0001" +
+		"0012packfile-uris\n" +
+		"00463333333333333333333333333333333333333333 https://example.com/pack\n" +
+		"0001" +
+		"000dpackfile\n" +
+		"0009\x01PACK" +
+		"0000"
+
+	req := NewUploadPackRequest()
+	res := NewUploadPackResponse(req)
+	defer res.Close()
+
+	s.NoError(res.DecodeV2(io.NopCloser(bytes.NewBufferString(raw))))
+	s.Equal([]plumbing.Hash{plumbing.NewHash("1111111111111111111111111111111111111111")}, res.Shallows)
+	s.Equal([]*plumbing.Reference{plumbing.NewHashReference(plumbing.Master,
+		plumbing.NewHash("2222222222222222222222222222222222222222"))}, res.WantedRefs)
+	s.Equal([]PackfileURI{{
+		Hash: plumbing.NewHash("3333333333333333333333333333333333333333"),
+		URI:  "https://example.com/pack",
+	}}, res.PackfileURIs)
+
+	// The packfile is demultiplexed, since the request has no sideband.
+	pack, err := io.ReadAll(res)
+	s.NoError(err)
+	s.Equal([]byte("PACK"), pack)
+}
+
+func (s *UploadPackResponseSuite) TestDecodeV2Sideband() {
+	raw := "000dpackfile\n0009\x01PACK0000"
+
+	req := NewUploadPackRequest()
+	req.Capabilities.Set(capability.Sideband64k)
+	res := NewUploadPackResponse(req)
+	defer res.Close()
+
+	s.NoError(res.DecodeV2(io.NopCloser(bytes.NewBufferString(raw))))
+	pack, err := io.ReadAll(res)
+	s.NoError(err)
+	s.Equal([]byte("0009\x01PACK0000"), pack)
+}
+
+func (s *UploadPackResponseSuite) TestDecodeV2Malformed() {
+	for _, raw := range []string{
+		"",
+		"0000",
+		"000cunknown\n",
+		"0010wanted-refs\n0008foo\n0001",
+		"0012packfile-uris\n",
+	} {
+		res := NewUploadPackResponse(NewUploadPackRequest())
+		s.Error(res.DecodeV2(io.NopCloser(bytes.NewBufferString(raw))), raw)
+	}
+}
+
+func (s *UploadPackResponseSuite) TestEncodeV2() {
+	req := NewUploadPackRequest()
+	req.Done = true
+
+	res := NewUploadPackResponseWithPackfile(req, io.NopCloser(bytes.NewBufferString("PACK")))
+	res.Shallows = []plumbing.Hash{plumbing.NewHash("1111111111111111111111111111111111111111")}
+	res.WantedRefs = []*plumbing.Reference{plumbing.NewHashReference(plumbing.Master,
+		plumbing.NewHash("2222222222222222222222222222222222222222"))}
+
+	var buf bytes.Buffer
+	s.NoError(res.EncodeV2(&buf))
+	s.Equal(""+
+		"0011shallow-info\n"+
+		"0035shallow 1111111111111111111111111111111111111111\n"+
+		"0001"+
+		"0010wanted-refs\n"+
+		"003f2222222222222222222222222222222222222222 refs/heads/master\n"+
+		"0001"+
+		"000dpackfile\n"+
+		"0009\x01PACK"+
+		"0000",
+		buf.String(),
+	)
+
+	decoded := NewUploadPackResponse(NewUploadPackRequest())
+	s.NoError(decoded.DecodeV2(io.NopCloser(&buf)))
+	s.Equal(res.Shallows, decoded.Shallows)
+	s.Equal(res.WantedRefs, decoded.WantedRefs)
+}
+
+func (s *UploadPackResponseSuite) TestEncodeV2Acknowledgments() {
+	common := plumbing.NewHash("1111111111111111111111111111111111111111")
+	res := NewUploadPackResponse(NewUploadPackRequest())
+	res.ACKs = []plumbing.Hash{common}
+
+	var buf bytes.Buffer
+	s.NoError(res.EncodeV2(&buf))
+	s.Equal(""+
+		"0014acknowledgments\n"+
+		"0031ACK 1111111111111111111111111111111111111111\n"+
+		"0000",
+		buf.String(),
+	)
+
+	// The server isn't ready, the response has no packfile.
+	decoded := NewUploadPackResponse(NewUploadPackRequest())
+	s.NoError(decoded.DecodeV2(io.NopCloser(bytes.NewReader(buf.Bytes()))))
+	s.Equal([]plumbing.Hash{common}, decoded.ACKs)
+	_, err := decoded.Read(make([]byte, 1))
+	s.ErrorIs(err, ErrUploadPackResponseNotDecoded)
+
+	res = NewUploadPackResponseWithPackfile(NewUploadPackRequest(),
+		io.NopCloser(bytes.NewBufferString("PACK")))
+	buf.Reset()
+	s.NoError(res.EncodeV2(&buf))
+	s.Equal(""+
+		"0014acknowledgments\n"+
+		"0008NAK\n"+
+		"000aready\n"+
+		"0001"+
+		"000dpackfile\n"+
+		"0009\x01PACK"+
+		"0000",
+		buf.String(),
+	)
+
+	decoded = NewUploadPackResponse(NewUploadPackRequest())
+	s.NoError(decoded.DecodeV2(io.NopCloser(&buf)))
+	pack, err := io.ReadAll(decoded)
+	s.NoError(err)
+	s.Equal("PACK", string(pack))
+}
@@ -217,6 +217,22 @@ const (
 	HEAD   ReferenceName = "HEAD"
 	Master ReferenceName = "refs/heads/master"
 	Main   ReferenceName = "refs/heads/main"
+
+	// MergeHead records the commit being merged into HEAD while a merge with
+	// conflicts is in progress.
+	MergeHead ReferenceName = "MERGE_HEAD"
+	// CherryPickHead records the commit being cherry-picked while a
+	// cherry-pick with conflicts is in progress.
+	CherryPickHead ReferenceName = "CHERRY_PICK_HEAD"
+	// RevertHead records the commit being reverted while a revert with
+	// conflicts is in progress.
+	RevertHead ReferenceName = "REVERT_HEAD"
+	// RebaseHead records the commit being applied while a rebase stopped
+	// due to conflicts.
+	RebaseHead ReferenceName = "REBASE_HEAD"
+	// Stash points to the latest stash, the older ones are recorded in its
+	// reflog.
+	Stash ReferenceName = "refs/stash"
 )
 
 // Reference is a representation of git reference
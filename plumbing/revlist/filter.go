@@ -0,0 +1,382 @@
+package revlist
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// ErrUnsupportedFilter is returned by ParseFilter if the filter isn't valid or
+// isn't supported.
+var ErrUnsupportedFilter = errors.New("unsupported filter")
+
+// Filter omits objects from the objects listed by ObjectsWithFilter, as the
+// --filter option of git-rev-list does to serve partial clones.
+type Filter interface {
+	// Omit returns true if the object isn't part of the result.
+	Omit(o *FilterObject) (bool, error)
+	// Prune returns true if the entries of the tree at the given depth
+	// aren't walked, since none of them can be part of the result.
+	Prune(depth int) bool
+}
+
+// FilterObject is an object found while listing the objects, to be checked
+// by a Filter.
+type FilterObject struct {
+	Hash plumbing.Hash
+	Type plumbing.ObjectType
+	// Depth is the distance to the root tree of the commit, 0 for the root
+	// trees and for the objects not found in a tree, such as the commits.
+	Depth int
+
+	s storer.EncodedObjectStorer
+}
+
+// Size returns the size of the object.
+func (o *FilterObject) Size() (int64, error) {
+	return o.s.EncodedObjectSize(o.Hash)
+}
+
+// ParseFilter returns the Filter of the filter-spec, as sent by the clients
+// requesting a partial clone: blob:none, blob:limit=<n>[kmg], tree:<depth>,
+// object:type=<type> or combine:<filter>+<filter>...
+func ParseFilter(spec string) (Filter, error) {
+	kind, value, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "blob":
+		if value == "none" {
+			return blobLimit(0), nil
+		}
+
+		if limit, ok := strings.CutPrefix(value, "limit="); ok {
+			n, err := parseSize(limit)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrUnsupportedFilter, spec)
+			}
+
+			return blobLimit(n), nil
+		}
+	case "tree":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedFilter, spec)
+		}
+
+		return treeDepth(n), nil
+	case "object":
+		if name, ok := strings.CutPrefix(value, "type="); ok {
+			t, err := plumbing.ParseObjectType(name)
+			if err != nil || t > plumbing.TagObject {
+				return nil, fmt.Errorf("%w: %s", ErrUnsupportedFilter, spec)
+			}
+
+			return objectType(t), nil
+		}
+	case "combine":
+		var filters combine
+		for _, s := range strings.Split(value, "+") {
+			s, err := url.PathUnescape(s)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrUnsupportedFilter, spec)
+			}
+
+			f, err := ParseFilter(s)
+			if err != nil {
+				return nil, err
+			}
+
+			filters = append(filters, f)
+		}
+
+		return filters, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedFilter, spec)
+}
+
+func parseSize(s string) (int64, error) {
+	unit := int64(1)
+	switch {
+	case strings.HasSuffix(s, "k"):
+		unit = 1 << 10
+	case strings.HasSuffix(s, "m"):
+		unit = 1 << 20
+	case strings.HasSuffix(s, "g"):
+		unit = 1 << 30
+	}
+
+	if unit != 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	return n * unit, nil
+}
+
+// blobLimit omits the blobs of the given size or larger, every blob if it's 0.
+type blobLimit int64
+
+func (f blobLimit) Omit(o *FilterObject) (bool, error) {
+	if o.Type != plumbing.BlobObject {
+		return false, nil
+	}
+
+	if f == 0 {
+		return true, nil
+	}
+
+	size, err := o.Size()
+	if err != nil {
+		return false, err
+	}
+
+	return size >= int64(f), nil
+}
+
+func (blobLimit) Prune(int) bool {
+	return false
+}
+
+// treeDepth omits the trees and blobs at the given depth or deeper, every
+// tree and blob if it's 0.
+type treeDepth int
+
+func (f treeDepth) Omit(o *FilterObject) (bool, error) {
+	if o.Type != plumbing.TreeObject && o.Type != plumbing.BlobObject {
+		return false, nil
+	}
+
+	return o.Depth >= int(f), nil
+}
+
+func (f treeDepth) Prune(depth int) bool {
+	return depth+1 >= int(f)
+}
+
+// objectType omits the objects of any other type.
+type objectType plumbing.ObjectType
+
+func (f objectType) Omit(o *FilterObject) (bool, error) {
+	return o.Type != plumbing.ObjectType(f), nil
+}
+
+func (f objectType) Prune(int) bool {
+	return plumbing.ObjectType(f) != plumbing.TreeObject &&
+		plumbing.ObjectType(f) != plumbing.BlobObject
+}
+
+// combine omits the objects omitted by any of the filters.
+type combine []Filter
+
+func (f combine) Omit(o *FilterObject) (bool, error) {
+	for _, filter := range f {
+		omit, err := filter.Omit(o)
+		if omit || err != nil {
+			return omit, err
+		}
+	}
+
+	return false, nil
+}
+
+func (f combine) Prune(depth int) bool {
+	for _, filter := range f {
+		if filter.Prune(depth) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ObjectsWithFilter is the same as Objects, but the objects omitted by the
+// filter aren't part of the result. The objects given are always part of it,
+// as git-rev-list does without --filter-provided-objects.
+func ObjectsWithFilter(
+	s storer.EncodedObjectStorer,
+	objs,
+	ignore []plumbing.Hash,
+	filter Filter,
+) ([]plumbing.Hash, error) {
+	if filter == nil {
+		return Objects(s, objs, ignore)
+	}
+
+	ignore, err := objects(s, ignore, nil, true)
+	if err != nil {
+		return nil, err
+	}
+
+	w := NewFilterWalker(s, filter, ignore)
+	for _, h := range objs {
+		w.Add(h)
+		if err := w.Walk(h); err != nil {
+			return nil, err
+		}
+	}
+
+	return w.Objects(), nil
+}
+
+// FilterWalker lists the objects reachable from the ones walked, omitting the
+// ones filtered out. The trees are walked again if they are found at a lower
+// depth, since the objects omitted at a depth may not be at a lower one.
+type FilterWalker struct {
+	s      storer.EncodedObjectStorer
+	filter Filter
+	ignore []plumbing.Hash
+	// ignored are the objects not walked nor part of the result.
+	ignored map[plumbing.Hash]bool
+	// seen are the commits and tags walked.
+	seen map[plumbing.Hash]bool
+	// depths are the lowest depths the trees and blobs were found at.
+	depths map[plumbing.Hash]int
+	result map[plumbing.Hash]bool
+}
+
+// NewFilterWalker returns a new FilterWalker, the objects ignored aren't
+// walked nor part of the result. A nil filter omits no object.
+func NewFilterWalker(s storer.EncodedObjectStorer, filter Filter, ignore []plumbing.Hash) *FilterWalker {
+	return &FilterWalker{
+		s:       s,
+		filter:  filter,
+		ignore:  ignore,
+		ignored: hashListToSet(ignore),
+		seen:    make(map[plumbing.Hash]bool),
+		depths:  make(map[plumbing.Hash]int),
+		result:  make(map[plumbing.Hash]bool),
+	}
+}
+
+// Add adds the object to the result, even if the filter omits it, unless
+// it's ignored.
+func (w *FilterWalker) Add(h plumbing.Hash) {
+	if !w.ignored[h] {
+		w.result[h] = true
+	}
+}
+
+// Objects returns the objects listed.
+func (w *FilterWalker) Objects() []plumbing.Hash {
+	return hashSetToList(w.result)
+}
+
+// Walk lists the objects reachable from the object, the ancestors of the
+// commits included.
+func (w *FilterWalker) Walk(h plumbing.Hash) error {
+	if w.ignored[h] || w.seen[h] {
+		return nil
+	}
+
+	o, err := w.s.EncodedObject(plumbing.AnyObject, h)
+	if err != nil {
+		return err
+	}
+
+	switch o.Type() {
+	case plumbing.CommitObject:
+		c, err := object.DecodeCommit(w.s, o)
+		if err != nil {
+			return err
+		}
+
+		iter := object.NewCommitPreorderIter(c, w.seen, w.ignore)
+		return iter.ForEach(w.WalkCommit)
+	case plumbing.TagObject:
+		w.seen[h] = true
+		if err := w.add(h, plumbing.TagObject, 0); err != nil {
+			return err
+		}
+
+		t, err := object.DecodeTag(w.s, o)
+		if err != nil {
+			return err
+		}
+
+		return w.Walk(t.Target)
+	case plumbing.TreeObject, plumbing.BlobObject:
+		return w.walkEntry(h, o.Type(), 0)
+	default:
+		return fmt.Errorf("object type not valid: %s. "+
+			"Object reference: %s", o.Type(), o.Hash())
+	}
+}
+
+// WalkCommit lists the commit and the objects of its tree, without walking its
+// parents.
+func (w *FilterWalker) WalkCommit(c *object.Commit) error {
+	if w.ignored[c.Hash] || w.seen[c.Hash] {
+		return nil
+	}
+
+	w.seen[c.Hash] = true
+	if err := w.add(c.Hash, plumbing.CommitObject, 0); err != nil {
+		return err
+	}
+
+	return w.walkEntry(c.TreeHash, plumbing.TreeObject, 0)
+}
+
+func (w *FilterWalker) add(h plumbing.Hash, t plumbing.ObjectType, depth int) error {
+	if w.filter != nil {
+		omit, err := w.filter.Omit(&FilterObject{Hash: h, Type: t, Depth: depth, s: w.s})
+		if omit || err != nil {
+			return err
+		}
+	}
+
+	w.result[h] = true
+	return nil
+}
+
+func (w *FilterWalker) walkEntry(h plumbing.Hash, t plumbing.ObjectType, depth int) error {
+	if w.ignored[h] {
+		return nil
+	}
+
+	if d, ok := w.depths[h]; ok && d <= depth {
+		return nil
+	}
+
+	w.depths[h] = depth
+	if err := w.add(h, t, depth); err != nil {
+		return err
+	}
+
+	if t != plumbing.TreeObject || w.filter != nil && w.filter.Prune(depth) {
+		return nil
+	}
+
+	tree, err := object.GetTree(w.s, h)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range tree.Entries {
+		switch e.Mode {
+		case filemode.Submodule:
+			continue
+		case filemode.Dir:
+			err = w.walkEntry(e.Hash, plumbing.TreeObject, depth+1)
+		default:
+			err = w.walkEntry(e.Hash, plumbing.BlobObject, depth+1)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package revlist
+
+import (
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func (s *RevListSuite) TestParseFilter() {
+	for spec, expected := range map[string]Filter{
+		"blob:none":                  blobLimit(0),
+		"blob:limit=0":               blobLimit(0),
+		"blob:limit=10":              blobLimit(10),
+		"blob:limit=2k":              blobLimit(2 << 10),
+		"blob:limit=1m":              blobLimit(1 << 20),
+		"tree:3":                     treeDepth(3),
+		"object:type=commit":         objectType(plumbing.CommitObject),
+		"combine:blob:none+tree:1":   combine{blobLimit(0), treeDepth(1)},
+		"combine:blob%3Anone+tree:1": combine{blobLimit(0), treeDepth(1)},
+	} {
+		f, err := ParseFilter(spec)
+		s.NoError(err, spec)
+		s.Equal(expected, f, spec)
+	}
+
+	for _, spec := range []string{
+		"", "blob", "blob:limit=", "blob:limit=-1", "blob:limit=1t", "tree:",
+		"tree:-1", "object:type=ofs-delta", "sparse:oid=HEAD", "combine:tree:1+foo",
+	} {
+		_, err := ParseFilter(spec)
+		s.ErrorIs(err, ErrUnsupportedFilter, spec)
+	}
+}
+
+func (s *RevListSuite) TestObjectsWithFilter() {
+	for spec, expected := range map[string][2]int{
+		"blob:none":                {19, 3},
+		"blob:limit=1k":            {23, 4},
+		"tree:0":                   {8, 1},
+		"tree:1":                   {15, 2},
+		"object:type=tree":         {12, 3},
+		"combine:blob:none+tree:1": {15, 2},
+	} {
+		f, err := ParseFilter(spec)
+		s.NoError(err)
+
+		objs, err := ObjectsWithFilter(s.Storer,
+			[]plumbing.Hash{plumbing.NewHash(someCommitOtherBranch)}, nil, f)
+		s.NoError(err)
+		s.Len(objs, expected[0], spec)
+
+		objs, err = ObjectsWithFilter(s.Storer,
+			[]plumbing.Hash{plumbing.NewHash(someCommitOtherBranch)},
+			[]plumbing.Hash{plumbing.NewHash(someCommit)}, f)
+		s.NoError(err)
+		s.Len(objs, expected[1], spec)
+	}
+}
+
+func (s *RevListSuite) TestObjectsWithFilterNil() {
+	expected, err := Objects(s.Storer, []plumbing.Hash{plumbing.NewHash(someCommitOtherBranch)}, nil)
+	s.NoError(err)
+
+	objs, err := ObjectsWithFilter(s.Storer, []plumbing.Hash{plumbing.NewHash(someCommitOtherBranch)}, nil, nil)
+	s.NoError(err)
+	s.ElementsMatch(expected, objs)
+}
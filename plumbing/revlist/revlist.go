@@ -9,6 +9,7 @@ import (
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/object/commitgraph"
 	"github.com/go-git/go-git/v5/plumbing/storer"
 )
 
@@ -97,7 +98,7 @@ func processObject(
 
 	switch do := do.(type) {
 	case *object.Commit:
-		return reachableObjects(do, seen, visited, ignore, walkerFunc)
+		return reachableObjects(s, do, seen, visited, ignore, walkerFunc)
 	case *object.Tree:
 		return iterateCommitTrees(seen, do, walkerFunc)
 	case *object.Tag:
@@ -116,14 +117,23 @@ func processObject(
 // reachableObjects returns, using the callback function, all the reachable
 // objects from the specified commit. To avoid to iterate over seen commits,
 // if a commit hash is into the 'seen' set, we will not iterate all his trees
-// and blobs objects.
+// and blobs objects. The commit-graph of the storer, if any, is used to walk
+// the commits without decoding them.
 func reachableObjects(
+	s storer.EncodedObjectStorer,
 	commit *object.Commit,
 	seen map[plumbing.Hash]bool,
 	visited map[plumbing.Hash]bool,
 	ignore []plumbing.Hash,
 	cb func(h plumbing.Hash),
 ) error {
+	if cgs, ok := s.(storer.CommitGraphStorer); ok {
+		if index, err := cgs.CommitGraph(); err == nil && index != nil {
+			nodeIndex := commitgraph.NewGraphCommitNodeIndex(index, s)
+			return reachableNodes(nodeIndex, commit.Hash, seen, ignore, cb)
+		}
+	}
+
 	i := object.NewCommitPreorderIter(commit, seen, ignore)
 	pending := make(map[plumbing.Hash]bool)
 	addPendingParents(pending, visited, commit)
@@ -166,6 +176,51 @@ func reachableObjects(
 	return nil
 }
 
+// reachableNodes returns, using the callback function, all the reachable
+// objects from the specified commit, walking the commits in pre-order from
+// the given commit node index, as reachableObjects does.
+func reachableNodes(
+	nodeIndex commitgraph.CommitNodeIndex,
+	start plumbing.Hash,
+	seen map[plumbing.Hash]bool,
+	ignore []plumbing.Hash,
+	cb func(h plumbing.Hash),
+) error {
+	walked := hashListToSet(ignore)
+	stack := []plumbing.Hash{start}
+	for len(stack) > 0 {
+		h := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[h] || walked[h] {
+			continue
+		}
+
+		walked[h] = true
+		node, err := nodeIndex.Get(h)
+		if err != nil {
+			return err
+		}
+
+		cb(h)
+
+		tree, err := node.Tree()
+		if err != nil {
+			return err
+		}
+
+		if err := iterateCommitTrees(seen, tree, cb); err != nil {
+			return err
+		}
+
+		parents := node.ParentHashes()
+		for i := len(parents) - 1; i >= 0; i-- {
+			stack = append(stack, parents[i])
+		}
+	}
+
+	return nil
+}
+
 func addPendingParents(pending, visited map[plumbing.Hash]bool, commit *object.Commit) {
 	for _, p := range commit.ParentHashes {
 		if !visited[p] {
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// ReceivePackHooks are the callbacks run by the receive-pack sessions, as the
+// pre-receive, update and post-receive hooks are run by git-receive-pack. The
+// message of the errors returned is reported to the client as the status of
+// the commands rejected.
+type ReceivePackHooks struct {
+	// PreReceive is called once the packfile is received, before updating
+	// any reference. An error rejects every command.
+	PreReceive func(ctx context.Context, s storer.Storer, cmds []*packp.Command) error
+	// Update is called for each command before updating its reference. An
+	// error rejects the command, or every command of an atomic push.
+	Update func(ctx context.Context, s storer.Storer, cmd *packp.Command) error
+	// PostReceive is called once the references are updated, with the
+	// commands applied.
+	PostReceive func(ctx context.Context, s storer.Storer, cmds []*packp.Command)
+}
+
+// refTransaction updates the references of the commands, restoring their
+// previous values on rollback.
+type refTransaction struct {
+	storer  storer.ReferenceStorer
+	applied []*packp.Command
+}
+
+// apply updates the reference of the command, if it still has the old value
+// of the command.
+func (t *refTransaction) apply(cmd *packp.Command) error {
+	var err error
+	switch cmd.Action() {
+	case packp.Create:
+		err = t.storer.CheckAndSetReference(plumbing.NewHashReference(cmd.Name, cmd.New), nil)
+	case packp.Update:
+		err = t.storer.CheckAndSetReference(
+			plumbing.NewHashReference(cmd.Name, cmd.New),
+			plumbing.NewHashReference(cmd.Name, cmd.Old),
+		)
+	case packp.Delete:
+		err = t.storer.RemoveReference(cmd.Name)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	t.applied = append(t.applied, cmd)
+	return nil
+}
+
+// rollback restores the references updated, in reverse order.
+func (t *refTransaction) rollback() error {
+	for i := len(t.applied) - 1; i >= 0; i-- {
+		cmd := t.applied[i]
+
+		var err error
+		if cmd.Action() == packp.Create {
+			err = t.storer.RemoveReference(cmd.Name)
+		} else {
+			err = t.storer.SetReference(plumbing.NewHashReference(cmd.Name, cmd.Old))
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	t.applied = nil
+	return nil
+}
@@ -2,15 +2,25 @@ package server_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"testing"
 
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v5/plumbing/server"
+	"github.com/go-git/go-git/v5/plumbing/storer"
 	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/stretchr/testify/suite"
 
 	fixtures "github.com/go-git/go-git-fixtures/v4"
 )
 
+func TestReceivePackSuite(t *testing.T) {
+	suite.Run(t, new(ReceivePackSuite))
+}
+
 type ReceivePackSuite struct {
 	BaseSuite
 }
@@ -60,3 +70,131 @@ func (s *ReceivePackSuite) TestReceivePackWithNilPackfile() {
 	s.Nil(report, comment)
 	s.NotNil(err, comment)
 }
+
+var (
+	masterHash = plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	branchHash = plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")
+)
+
+// receivePackWithHooks runs the commands on a server with the hooks given,
+// returning the status of each command.
+func (s *ReceivePackSuite) receivePackWithHooks(hooks server.ReceivePackHooks, atomic bool,
+	cmds ...*packp.Command,
+) map[plumbing.ReferenceName]string {
+	r, err := server.NewServerWithHooks(s.loader, hooks).NewReceivePackSession(s.Endpoint, s.EmptyAuth)
+	s.NoError(err)
+	defer func() { s.NoError(r.Close()) }()
+
+	ar, err := r.AdvertisedReferences()
+	s.NoError(err)
+	s.True(ar.Capabilities.Supports(capability.Atomic))
+
+	req := packp.NewReferenceUpdateRequest()
+	req.Commands = cmds
+	s.NoError(req.Capabilities.Set(capability.ReportStatus))
+	if atomic {
+		s.NoError(req.Capabilities.Set(capability.Atomic))
+	}
+
+	report, _ := r.ReceivePack(context.Background(), req)
+	s.Equal("ok", report.UnpackStatus)
+
+	statuses := make(map[plumbing.ReferenceName]string)
+	for i, cs := range report.CommandStatuses {
+		s.Equal(cmds[i].Name, cs.ReferenceName)
+		statuses[cs.ReferenceName] = cs.Status
+	}
+
+	return statuses
+}
+
+func (s *ReceivePackSuite) checkReference(name plumbing.ReferenceName, h plumbing.Hash) {
+	ref, err := s.loader[s.Endpoint.String()].Reference(name)
+	if h.IsZero() {
+		s.ErrorIs(err, plumbing.ErrReferenceNotFound)
+		return
+	}
+
+	s.NoError(err)
+	s.Equal(h, ref.Hash())
+}
+
+func protectMaster(_ context.Context, _ storer.Storer, cmd *packp.Command) error {
+	if cmd.Name == plumbing.Master {
+		return errors.New("protected branch")
+	}
+
+	return nil
+}
+
+func (s *ReceivePackSuite) TestReceivePackUpdateHook() {
+	var received []*packp.Command
+	statuses := s.receivePackWithHooks(server.ReceivePackHooks{
+		Update: protectMaster,
+		PostReceive: func(_ context.Context, _ storer.Storer, cmds []*packp.Command) {
+			received = cmds
+		},
+	}, false,
+		&packp.Command{Name: "refs/heads/foo", New: masterHash},
+		&packp.Command{Name: plumbing.Master, Old: masterHash, New: branchHash},
+	)
+
+	s.Equal(map[plumbing.ReferenceName]string{
+		"refs/heads/foo": "ok",
+		plumbing.Master:  "protected branch",
+	}, statuses)
+	s.Len(received, 1)
+	s.Equal(plumbing.ReferenceName("refs/heads/foo"), received[0].Name)
+	s.checkReference("refs/heads/foo", masterHash)
+	s.checkReference(plumbing.Master, masterHash)
+}
+
+func (s *ReceivePackSuite) TestReceivePackAtomic() {
+	statuses := s.receivePackWithHooks(server.ReceivePackHooks{
+		Update: protectMaster,
+	}, true,
+		&packp.Command{Name: "refs/heads/foo", New: masterHash},
+		&packp.Command{Name: plumbing.Master, Old: masterHash, New: branchHash},
+	)
+
+	s.Equal(map[plumbing.ReferenceName]string{
+		"refs/heads/foo": server.ErrAtomicTransaction.Error(),
+		plumbing.Master:  "protected branch",
+	}, statuses)
+	s.checkReference("refs/heads/foo", plumbing.ZeroHash)
+	s.checkReference(plumbing.Master, masterHash)
+}
+
+func (s *ReceivePackSuite) TestReceivePackAtomicStale() {
+	statuses := s.receivePackWithHooks(server.ReceivePackHooks{}, true,
+		&packp.Command{Name: "refs/heads/branch", Old: branchHash, New: masterHash},
+		&packp.Command{Name: plumbing.Master, Old: branchHash, New: masterHash},
+	)
+
+	s.Equal(map[plumbing.ReferenceName]string{
+		"refs/heads/branch": server.ErrAtomicTransaction.Error(),
+		plumbing.Master:     server.ErrUpdateReference.Error(),
+	}, statuses)
+	s.checkReference("refs/heads/branch", branchHash)
+}
+
+func (s *ReceivePackSuite) TestReceivePackPreReceiveHook() {
+	statuses := s.receivePackWithHooks(server.ReceivePackHooks{
+		PreReceive: func(_ context.Context, _ storer.Storer, cmds []*packp.Command) error {
+			return errors.New("read-only repository")
+		},
+		PostReceive: func(context.Context, storer.Storer, []*packp.Command) {
+			s.Fail("post-receive called")
+		},
+	}, false,
+		&packp.Command{Name: "refs/heads/foo", New: masterHash},
+		&packp.Command{Name: "refs/heads/branch", Old: branchHash},
+	)
+
+	s.Equal(map[plumbing.ReferenceName]string{
+		"refs/heads/foo":    "read-only repository",
+		"refs/heads/branch": "read-only repository",
+	}, statuses)
+	s.checkReference("refs/heads/foo", plumbing.ZeroHash)
+	s.checkReference("refs/heads/branch", branchHash)
+}
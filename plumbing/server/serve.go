@@ -2,10 +2,15 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+	"github.com/go-git/go-git/v5/plumbing/protocol"
 	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/utils/ioutil"
 )
@@ -17,9 +22,17 @@ type ServerCommand struct {
 	Stdin  io.Reader
 }
 
+// ServeUploadPack serves a git-upload-pack session. If the session was
+// created for an endpoint requesting the version 2 of the protocol, the
+// capabilities are advertised and the commands served until the client ends
+// the session.
 func ServeUploadPack(cmd ServerCommand, s transport.UploadPackSession) (err error) {
 	ioutil.CheckClose(cmd.Stdout, &err)
 
+	if up, ok := s.(*upSession); ok && up.version == protocol.V2 {
+		return serveUploadPackV2(cmd, up)
+	}
+
 	ar, err := s.AdvertisedReferences()
 	if err != nil {
 		return err
@@ -43,8 +56,230 @@ func ServeUploadPack(cmd ServerCommand, s transport.UploadPackSession) (err erro
 	return resp.Encode(cmd.Stdout)
 }
 
+func serveUploadPackV2(cmd ServerCommand, s *upSession) error {
+	adv, err := s.CapabilityAdvertisement()
+	if err != nil {
+		return err
+	}
+
+	if err := adv.Encode(cmd.Stdout); err != nil {
+		return err
+	}
+
+	for {
+		req := packp.NewCommandRequest()
+		if err := req.Decode(cmd.Stdin); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			return err
+		}
+
+		if err := serveCommand(context.TODO(), cmd.Stdout, s, req); err != nil {
+			return err
+		}
+	}
+}
+
+func serveCommand(ctx context.Context, w io.Writer, s *upSession, cmd *packp.CommandRequest) error {
+	switch cmd.Command {
+	case capability.LsRefs:
+		req := packp.NewLsRefsRequest()
+		if err := req.DecodeCommand(cmd); err != nil {
+			return err
+		}
+
+		ar, err := s.LsRefs(ctx, req)
+		if err != nil {
+			return err
+		}
+
+		return ar.EncodeLsRefs(w)
+	case capability.Fetch:
+		req := packp.NewUploadPackRequest()
+		if err := req.DecodeCommand(cmd); err != nil {
+			return err
+		}
+
+		res, err := s.Fetch(ctx, req)
+		if err != nil {
+			return err
+		}
+
+		return res.EncodeV2(w)
+	case capability.ObjectInfo:
+		req := packp.NewObjectInfoRequest()
+		if err := req.DecodeCommand(cmd); err != nil {
+			return err
+		}
+
+		res, err := s.ObjectInfo(ctx, req)
+		if err != nil {
+			return err
+		}
+
+		return res.Encode(w)
+	}
+
+	return fmt.Errorf("unknown command %s", cmd.Command)
+}
+
+// AdvertiseReferences writes the advertisement of a session served over a
+// stateless transport, such as the smart HTTP one: the references, or the
+// capabilities of a git-upload-pack session of the version 2 of the protocol.
+func AdvertiseReferences(ctx context.Context, w io.Writer, s transport.Session) error {
+	if up, ok := s.(*upSession); ok && up.version == protocol.V2 {
+		adv, err := up.CapabilityAdvertisement()
+		if err != nil {
+			return err
+		}
+
+		return adv.Encode(w)
+	}
+
+	ar, err := s.AdvertisedReferencesContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	return ar.Encode(w)
+}
+
+// ServeUploadPackRequest serves a single request of a git-upload-pack session
+// over a stateless transport, such as the smart HTTP one, where the references
+// were advertised by a previous request. On the version 2 of the protocol the
+// request holds a command. On the version 0 it holds a round of the
+// negotiation, the packfile is only sent once the client is done.
+func ServeUploadPackRequest(ctx context.Context, w io.Writer, r io.Reader, s transport.UploadPackSession) error {
+	up, ok := s.(*upSession)
+	if ok && up.version == protocol.V2 {
+		for {
+			req := packp.NewCommandRequest()
+			if err := req.Decode(r); err != nil {
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+
+				return err
+			}
+
+			if err := serveCommand(ctx, w, up, req); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The errors reading the haves aren't returned by the decoder.
+	er := &errorReader{r: r}
+	req := packp.NewUploadPackRequest()
+	if err := req.Decode(er); err != nil {
+		return err
+	}
+
+	// The haves are read to know whether the client ended the negotiation,
+	// the request is decoded as it's read.
+	var rounds []packp.UploadRequestHave
+	for haves := range req.HavesUR {
+		rounds = append(rounds, haves)
+	}
+
+	if er.err != nil {
+		return er.err
+	}
+
+	if ok && (len(rounds) == 0 || !rounds[len(rounds)-1].Done) {
+		return up.acknowledge(w, req, rounds)
+	}
+
+	haves := make(chan packp.UploadRequestHave, len(rounds))
+	for _, h := range rounds {
+		haves <- h
+	}
+
+	close(haves)
+	req.HavesUR = haves
+
+	resp, err := s.UploadPack(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	return resp.Encode(w)
+}
+
+// errorReader records the first error reading from r, other than io.EOF.
+type errorReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *errorReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF && r.err == nil {
+		r.err = err
+	}
+
+	return n, err
+}
+
+// acknowledge answers a round of the negotiation of a stateless session, not
+// ended by the client, with the first have known by the server or a NAK. As
+// on every round, the shallow update precedes them if the client is shallow
+// or requests a depth.
+func (s *upSession) acknowledge(w io.Writer, req *packp.UploadPackRequest, rounds []packp.UploadRequestHave) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	if err := s.checkWants(req.Wants); err != nil {
+		return err
+	}
+
+	sw, err := s.shallow(req)
+	if err != nil {
+		return err
+	}
+
+	if sw != nil {
+		if err := sw.update().Encode(w); err != nil {
+			return err
+		}
+	}
+
+	common := plumbing.ZeroHash
+	for _, haves := range rounds {
+		for _, h := range haves.Haves {
+			if common.IsZero() && s.storer.HasEncodedObject(h) == nil {
+				common = h
+			}
+		}
+	}
+
+	// A request without haves only deepens the history of the client, it's
+	// only answered with the shallow update.
+	if len(rounds) == 0 {
+		return nil
+	}
+
+	if common.IsZero() {
+		_, err := pktline.WriteString(w, "NAK\n")
+		return err
+	}
+
+	_, err = pktline.Writef(w, "ACK %s\n", common)
+	return err
+}
+
 func ServeReceivePack(cmd ServerCommand, s transport.ReceivePackSession) error {
-	ar, err := s.AdvertisedReferences()
+	return ServeReceivePackContext(context.TODO(), cmd, s)
+}
+
+// ServeReceivePackContext serves a git-receive-pack session, as
+// ServeReceivePack does, running the hooks of the session with the given
+// context.
+func ServeReceivePackContext(ctx context.Context, cmd ServerCommand, s transport.ReceivePackSession) error {
+	ar, err := s.AdvertisedReferencesContext(ctx)
 	if err != nil {
 		return fmt.Errorf("internal error in advertised references: %s", err)
 	}
@@ -58,7 +293,7 @@ func ServeReceivePack(cmd ServerCommand, s transport.ReceivePackSession) error {
 		return fmt.Errorf("error decoding: %s", err)
 	}
 
-	rs, err := s.ReceivePack(context.TODO(), req)
+	rs, err := s.ReceivePack(ctx, req)
 	if rs != nil {
 		if err := rs.Encode(cmd.Stdout); err != nil {
 			return fmt.Errorf("error in encoding report status %s", err)
@@ -71,3 +306,26 @@ func ServeReceivePack(cmd ServerCommand, s transport.ReceivePackSession) error {
 
 	return nil
 }
+
+// ServeReceivePackRequest serves the request of a git-receive-pack session
+// over a stateless transport, such as the smart HTTP one, where the
+// references were advertised by a previous request.
+func ServeReceivePackRequest(ctx context.Context, w io.Writer, r io.Reader, s transport.ReceivePackSession) error {
+	req := packp.NewReferenceUpdateRequest()
+	if err := req.Decode(r); err != nil {
+		return fmt.Errorf("error decoding: %s", err)
+	}
+
+	rs, err := s.ReceivePack(ctx, req)
+	if rs != nil {
+		if err := rs.Encode(w); err != nil {
+			return fmt.Errorf("error in encoding report status %s", err)
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("error in receive pack: %s", err)
+	}
+
+	return nil
+}
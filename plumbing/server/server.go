@@ -7,10 +7,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 	"time"
 
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/protocol"
 	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
 	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
 	"github.com/go-git/go-git/v5/plumbing/revlist"
@@ -22,6 +25,10 @@ import (
 
 var DefaultServer = NewServer(DefaultLoader)
 
+// ErrWantNotReachable is returned by UploadPack when an object wanted isn't
+// reachable from the references.
+var ErrWantNotReachable = errors.New("not our ref")
+
 type server struct {
 	loader  Loader
 	handler *handler
@@ -36,6 +43,15 @@ func NewServer(loader Loader) transport.Transport {
 	}
 }
 
+// NewServerWithHooks returns a transport.Transport implementing a git server,
+// as NewServer does, running the given hooks on each push.
+func NewServerWithHooks(loader Loader, hooks ReceivePackHooks) transport.Transport {
+	return &server{
+		loader,
+		&handler{asClient: false, hooks: hooks},
+	}
+}
+
 // NewClient returns a transport.Transport implementing a client with an
 // embedded server.
 func NewClient(loader Loader) transport.Transport {
@@ -51,7 +67,7 @@ func (s *server) NewUploadPackSession(ep *transport.Endpoint, auth transport.Aut
 		return nil, err
 	}
 
-	return s.handler.NewUploadPackSession(sto)
+	return s.handler.newUploadPackSession(sto, ep.ProtocolVersion), nil
 }
 
 func (s *server) NewReceivePackSession(ep *transport.Endpoint, auth transport.AuthMethod) (transport.ReceivePackSession, error) {
@@ -65,17 +81,24 @@ func (s *server) NewReceivePackSession(ep *transport.Endpoint, auth transport.Au
 
 type handler struct {
 	asClient bool
+	hooks    ReceivePackHooks
 }
 
 func (h *handler) NewUploadPackSession(s storer.Storer) (transport.UploadPackSession, error) {
+	return h.newUploadPackSession(s, protocol.V0), nil
+}
+
+func (h *handler) newUploadPackSession(s storer.Storer, v protocol.Version) *upSession {
 	return &upSession{
 		session: session{storer: s, asClient: h.asClient},
-	}, nil
+		version: v,
+	}
 }
 
 func (h *handler) NewReceivePackSession(s storer.Storer) (transport.ReceivePackSession, error) {
 	return &rpSession{
 		session:   session{storer: s, asClient: h.asClient},
+		hooks:     h.hooks,
 		cmdStatus: map[plumbing.ReferenceName]error{},
 	}, nil
 }
@@ -107,6 +130,7 @@ func (s *session) checkSupportedCapabilities(cl *capability.List) error {
 
 type upSession struct {
 	session
+	version protocol.Version
 }
 
 func (s *upSession) AdvertisedReferences() (*packp.AdvRefs, error) {
@@ -164,8 +188,18 @@ func (s *upSession) UploadPack(ctx context.Context, req *packp.UploadPackRequest
 
 	s.caps = req.Capabilities
 
-	if len(req.Shallows) > 0 {
-		return nil, fmt.Errorf("shallow not supported")
+	if err := s.checkWants(req.Wants); err != nil {
+		return nil, err
+	}
+
+	sw, err := s.shallow(req)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := s.filter(req)
+	if err != nil {
+		return nil, err
 	}
 
 	havesWithRef, err := revlist.ObjectsWithRef(s.storer, req.Wants, nil)
@@ -174,7 +208,6 @@ func (s *upSession) UploadPack(ctx context.Context, req *packp.UploadPackRequest
 	}
 
 	pr, pw := io.Pipe()
-	e := packfile.NewEncoder(pw, s.storer, false)
 	go func() {
 		allHaves := []plumbing.Hash{}
 		foundWants := map[plumbing.Hash]bool{}
@@ -194,22 +227,377 @@ func (s *upSession) UploadPack(ctx context.Context, req *packp.UploadPackRequest
 			req.UploadPackCommands <- packp.UploadPackCommand{Acks: acks, Done: haves.Done}
 		}
 		close(req.UploadPackCommands)
-		objs, err := s.objectsToUpload(req.Wants, allHaves)
+		pw.CloseWithError(s.encodePackfile(pw, req.Wants, allHaves, sw, filter))
+	}()
+
+	res := packp.NewUploadPackResponseWithPackfile(req,
+		ioutil.NewContextReadCloser(ctx, pr),
+	)
+
+	if sw != nil {
+		res.ShallowUpdate = *sw.update()
+	}
+
+	return res, nil
+}
+
+// checkWants returns ErrWantNotReachable if any want isn't reachable from
+// the references. The history is only walked if any want isn't the tip of a
+// reference, as the objects omitted by the filter of a partial clone.
+func (s *upSession) checkWants(wants []plumbing.Hash) error {
+	iter, err := s.storer.IterReferences()
+	if err != nil {
+		return err
+	}
+
+	var tips []plumbing.Hash
+	isTip := make(map[plumbing.Hash]bool)
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			tips = append(tips, ref.Hash())
+			isTip[ref.Hash()] = true
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var pending []plumbing.Hash
+	for _, h := range wants {
+		if !isTip[h] {
+			pending = append(pending, h)
+		}
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	objs, err := revlist.Objects(s.storer, tips, nil)
+	if err != nil {
+		return err
+	}
+
+	reachable := make(map[plumbing.Hash]bool, len(objs))
+	for _, h := range objs {
+		reachable[h] = true
+	}
+
+	for _, h := range pending {
+		if !reachable[h] {
+			return fmt.Errorf("%w: %s", ErrWantNotReachable, h)
+		}
+	}
+
+	return nil
+}
+
+// shallow returns the history to send to a shallow client, nil if the
+// client isn't shallow and doesn't request any depth.
+func (s *upSession) shallow(req *packp.UploadPackRequest) (*shallowWalk, error) {
+	if len(req.Shallows) == 0 && req.Depth.IsZero() {
+		return nil, nil
+	}
+
+	return newShallowWalk(s.storer, req)
+}
+
+// filter returns the filter of the objects requested by a partial clone, nil
+// if the request has no filter.
+func (s *upSession) filter(req *packp.UploadPackRequest) (revlist.Filter, error) {
+	if req.Filter == "" {
+		return nil, nil
+	}
+
+	return revlist.ParseFilter(string(req.Filter))
+}
+
+func (s *upSession) objectsToUpload(wants, haves []plumbing.Hash, filter revlist.Filter) ([]plumbing.Hash, error) {
+	return revlist.ObjectsWithFilter(s.storer, wants, haves, filter)
+}
+
+// encodePackfile writes the packfile with the objects reachable from the
+// wants and not from the haves, limited to the history of the shallow walk if
+// it isn't nil and omitting the ones filtered out.
+func (s *upSession) encodePackfile(w io.Writer, wants, haves []plumbing.Hash, sw *shallowWalk, filter revlist.Filter) error {
+	var objs []plumbing.Hash
+	var err error
+	if sw != nil {
+		objs, err = sw.objects(haves, filter)
+	} else {
+		objs, err = s.objectsToUpload(wants, haves, filter)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = packfile.NewEncoder(w, s.storer, false).Encode(objs, 10)
+	return err
+}
+
+// CapabilityAdvertisement returns the commands and capabilities supported on
+// the version 2 of the protocol.
+func (s *upSession) CapabilityAdvertisement() (*packp.CapabilityAdvertisement, error) {
+	adv := packp.NewCapabilityAdvertisement()
+	for _, c := range []struct {
+		c     capability.Capability
+		value string
+	}{
+		{capability.Agent, capability.DefaultAgent()},
+		{capability.LsRefs, capability.Unborn.String()},
+		{capability.Fetch, strings.Join([]string{
+			capability.Shallow.String(), capability.Filter.String(), capability.RefInWant.String(),
+		}, " ")},
+		{capability.ServerOption, ""},
+		{capability.ObjectInfo, ""},
+	} {
+		var values []string
+		if c.value != "" {
+			values = append(values, c.value)
+		}
+
+		if err := adv.Capabilities.Set(c.c, values...); err != nil {
+			return nil, err
+		}
+	}
+
+	return adv, nil
+}
+
+// LsRefs returns the references matching the prefixes of the request, as the
+// ls-refs command of the version 2 of the protocol. The capabilities of the
+// AdvRefs are the ones of the version 0 of the protocol, to be used on the
+// following requests of the session.
+func (s *upSession) LsRefs(ctx context.Context, req *packp.LsRefsRequest) (*packp.AdvRefs, error) {
+	ar := packp.NewAdvRefs()
+	if err := s.setSupportedCapabilities(ar.Capabilities); err != nil {
+		return nil, err
+	}
+
+	s.caps = ar.Capabilities
+
+	iter, err := s.storer.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Name() == plumbing.HEAD || !req.Match(ref.Name()) {
+			return nil
+		}
+
+		return s.addLsRefsReference(ar, req, ref)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Match(plumbing.HEAD) {
+		if err := s.addLsRefsHEAD(ar, req); err != nil {
+			return nil, err
+		}
+	}
+
+	return ar, nil
+}
+
+func (s *upSession) addLsRefsHEAD(ar *packp.AdvRefs, req *packp.LsRefsRequest) error {
+	ref, err := s.storer.Reference(plumbing.HEAD)
+	if err == plumbing.ErrReferenceNotFound {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	resolved, err := storer.ResolveReference(s.storer, plumbing.HEAD)
+	if err == plumbing.ErrReferenceNotFound {
+		if req.Unborn && req.Symrefs && ref.Type() == plumbing.SymbolicReference {
+			return ar.AddReference(ref)
+		}
+
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if req.Symrefs && ref.Type() == plumbing.SymbolicReference {
+		if err := ar.AddReference(ref); err != nil {
+			return err
+		}
+	}
+
+	h := resolved.Hash()
+	ar.Head = &h
+	return nil
+}
+
+func (s *upSession) addLsRefsReference(ar *packp.AdvRefs, req *packp.LsRefsRequest, ref *plumbing.Reference) error {
+	name := ref.Name().String()
+	if ref.Type() == plumbing.SymbolicReference {
+		resolved, err := storer.ResolveReference(s.storer, ref.Name())
+		if err == plumbing.ErrReferenceNotFound {
+			return nil
+		}
+
 		if err != nil {
-			pw.CloseWithError(err)
-			return
+			return err
 		}
-		_, err = e.Encode(objs, 10)
-		pw.CloseWithError(err)
+
+		if req.Symrefs {
+			if err := ar.AddReference(ref); err != nil {
+				return err
+			}
+		}
+
+		ar.References[name] = resolved.Hash()
+		return nil
+	}
+
+	ar.References[name] = ref.Hash()
+	if !req.Peel {
+		return nil
+	}
+
+	tag, err := object.GetTag(s.storer, ref.Hash())
+	if err == plumbing.ErrObjectNotFound {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for tag.TargetType == plumbing.TagObject {
+		if tag, err = object.GetTag(s.storer, tag.Target); err != nil {
+			return err
+		}
+	}
+
+	ar.Peeled[name] = tag.Target
+	return nil
+}
+
+// Fetch answers the fetch command of the version 2 of the protocol. The
+// negotiation is stateless, the response has a packfile only if the request
+// ended the negotiation or if the haves are enough to be ready to send it.
+func (s *upSession) Fetch(ctx context.Context, req *packp.UploadPackRequest) (*packp.UploadPackResponse, error) {
+	start := time.Now()
+	defer func() {
+		trace.Performance.Printf("performance: %.9f s: fetch", time.Since(start).Seconds())
+	}()
+
+	res := packp.NewUploadPackResponse(req)
+	for _, name := range req.WantRefs {
+		ref, err := storer.ResolveReference(s.storer, name)
+		if err != nil {
+			return nil, fmt.Errorf("unknown ref %s: %w", name, err)
+		}
+
+		res.WantedRefs = append(res.WantedRefs, plumbing.NewHashReference(name, ref.Hash()))
+		req.Wants = append(req.Wants, ref.Hash())
+	}
+
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	sw, err := s.shallow(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if sw != nil {
+		res.ShallowUpdate = *sw.update()
+	}
+
+	filter, err := s.filter(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if !req.Done {
+		ready, err := s.negotiate(res, req.Wants, req.Haves)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ready {
+			return res, nil
+		}
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(s.encodePackfile(pw, req.Wants, req.Haves, sw, filter))
 	}()
 
-	return packp.NewUploadPackResponseWithPackfile(req,
+	pres := packp.NewUploadPackResponseWithPackfile(req,
 		ioutil.NewContextReadCloser(ctx, pr),
-	), nil
+	)
+
+	pres.ACKs = res.ACKs
+	pres.ShallowUpdate = res.ShallowUpdate
+	pres.WantedRefs = res.WantedRefs
+	return pres, nil
 }
 
-func (s *upSession) objectsToUpload(wants, haves []plumbing.Hash) ([]plumbing.Hash, error) {
-	return revlist.Objects(s.storer, wants, haves)
+// negotiate acknowledges the haves known by the server, it's ready to send
+// the packfile if every want is reachable from any of them.
+func (s *upSession) negotiate(res *packp.UploadPackResponse, wants, haves []plumbing.Hash) (bool, error) {
+	havesWithRef, err := revlist.ObjectsWithRef(s.storer, wants, nil)
+	if err != nil {
+		return false, err
+	}
+
+	found := make(map[plumbing.Hash]bool, len(wants))
+	for _, h := range haves {
+		if err := s.storer.HasEncodedObject(h); err != nil {
+			continue
+		}
+
+		res.ACKs = append(res.ACKs, h)
+		for _, want := range havesWithRef[h] {
+			found[want] = true
+		}
+	}
+
+	for _, h := range wants {
+		if !found[h] {
+			return false, nil
+		}
+	}
+
+	return len(wants) != 0, nil
+}
+
+// ObjectInfo answers the object-info command of the version 2 of the protocol.
+func (s *upSession) ObjectInfo(ctx context.Context, req *packp.ObjectInfoRequest) (*packp.ObjectInfoResponse, error) {
+	res := packp.NewObjectInfoResponse()
+	res.Size = req.Size
+	for _, h := range req.Oids {
+		info := packp.ObjectInfo{Hash: h, Size: -1}
+		if req.Size {
+			obj, err := s.storer.EncodedObject(plumbing.AnyObject, h)
+			if err != nil && err != plumbing.ErrObjectNotFound {
+				return nil, err
+			}
+
+			if err == nil {
+				info.Size = obj.Size()
+			}
+		}
+
+		res.Objects = append(res.Objects, info)
+	}
+
+	return res, nil
 }
 
 func (*upSession) setSupportedCapabilities(c *capability.List) error {
@@ -217,8 +605,16 @@ func (*upSession) setSupportedCapabilities(c *capability.List) error {
 		return err
 	}
 
-	if err := c.Set(capability.OFSDelta); err != nil {
-		return err
+	// The objects omitted by a filter are fetched later by their hash, so
+	// the wants reachable from the references are allowed with it.
+	for _, name := range []capability.Capability{
+		capability.OFSDelta, capability.Shallow, capability.DeepenSince,
+		capability.DeepenNot, capability.DeepenRelative, capability.Filter,
+		capability.AllowReachableSHA1InWant,
+	} {
+		if err := c.Set(name); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -226,6 +622,8 @@ func (*upSession) setSupportedCapabilities(c *capability.List) error {
 
 type rpSession struct {
 	session
+	hooks     ReceivePackHooks
+	cmds      []*packp.Command
 	cmdStatus map[plumbing.ReferenceName]error
 	firstErr  error
 	unpackErr error
@@ -257,6 +655,9 @@ func (s *rpSession) AdvertisedReferencesContext(ctx context.Context) (*packp.Adv
 
 var (
 	ErrUpdateReference = errors.New("failed to update ref")
+	// ErrAtomicTransaction is the status of the commands of an atomic push
+	// not applied, since any other command of the push failed.
+	ErrAtomicTransaction = errors.New("atomic transaction failed")
 )
 
 func (s *rpSession) ReceivePack(ctx context.Context, req *packp.ReferenceUpdateRequest) (*packp.ReportStatus, error) {
@@ -277,10 +678,9 @@ func (s *rpSession) ReceivePack(ctx context.Context, req *packp.ReferenceUpdateR
 	}
 
 	s.caps = req.Capabilities
+	s.cmds = req.Commands
 
-	//TODO: Implement 'atomic' update of references.
-
-	if req.Packfile != nil {
+	if req.Packfile != nil && !isDeleteOnly(req.Commands) {
 		r := ioutil.NewContextReadCloser(ctx, req.Packfile)
 		if err := s.writePackfile(r); err != nil {
 			s.unpackErr = err
@@ -289,45 +689,93 @@ func (s *rpSession) ReceivePack(ctx context.Context, req *packp.ReferenceUpdateR
 		}
 	}
 
-	s.updateReferences(req)
+	s.updateReferences(ctx, req)
 	return s.reportStatus(), s.firstErr
 }
 
-func (s *rpSession) updateReferences(req *packp.ReferenceUpdateRequest) {
+// updateReferences applies the commands accepted by the hooks. On an atomic
+// push, every command is rejected if any of them fails, restoring the
+// references already updated.
+func (s *rpSession) updateReferences(ctx context.Context, req *packp.ReferenceUpdateRequest) {
+	if s.hooks.PreReceive != nil {
+		if err := s.hooks.PreReceive(ctx, s.storer, req.Commands); err != nil {
+			for _, cmd := range req.Commands {
+				s.setStatus(cmd.Name, err)
+			}
+
+			return
+		}
+	}
+
+	atomic := req.Capabilities.Supports(capability.Atomic)
+	var accepted []*packp.Command
 	for _, cmd := range req.Commands {
-		exists, err := referenceExists(s.storer, cmd.Name)
-		if err != nil {
+		if err := s.checkCommand(ctx, cmd); err != nil {
 			s.setStatus(cmd.Name, err)
+			if atomic {
+				s.failAtomic()
+				return
+			}
+
 			continue
 		}
 
-		switch cmd.Action() {
-		case packp.Create:
-			if exists {
-				s.setStatus(cmd.Name, ErrUpdateReference)
-				continue
-			}
+		accepted = append(accepted, cmd)
+	}
 
-			ref := plumbing.NewHashReference(cmd.Name, cmd.New)
-			err := s.storer.SetReference(ref)
-			s.setStatus(cmd.Name, err)
-		case packp.Delete:
-			if !exists {
-				s.setStatus(cmd.Name, ErrUpdateReference)
-				continue
+	tx := &refTransaction{storer: s.storer}
+	for _, cmd := range accepted {
+		err := tx.apply(cmd)
+		s.setStatus(cmd.Name, err)
+		if err != nil && atomic {
+			if err := tx.rollback(); err != nil {
+				s.setStatus(cmd.Name, err)
 			}
 
-			err := s.storer.RemoveReference(cmd.Name)
-			s.setStatus(cmd.Name, err)
-		case packp.Update:
-			if !exists {
-				s.setStatus(cmd.Name, ErrUpdateReference)
-				continue
-			}
+			s.failAtomic()
+			return
+		}
+	}
 
-			ref := plumbing.NewHashReference(cmd.Name, cmd.New)
-			err := s.storer.SetReference(ref)
-			s.setStatus(cmd.Name, err)
+	if s.hooks.PostReceive != nil && len(tx.applied) != 0 {
+		s.hooks.PostReceive(ctx, s.storer, tx.applied)
+	}
+}
+
+// checkCommand returns an error if the reference of the command doesn't have
+// the old value of the command, or if the update hook rejects it.
+func (s *rpSession) checkCommand(ctx context.Context, cmd *packp.Command) error {
+	ref, err := s.storer.Reference(cmd.Name)
+	if err != nil && err != plumbing.ErrReferenceNotFound {
+		return err
+	}
+
+	switch cmd.Action() {
+	case packp.Create:
+		if ref != nil {
+			return ErrUpdateReference
+		}
+	case packp.Update, packp.Delete:
+		if ref == nil || ref.Hash() != cmd.Old {
+			return ErrUpdateReference
+		}
+	default:
+		return packp.ErrMalformedCommand
+	}
+
+	if s.hooks.Update != nil {
+		return s.hooks.Update(ctx, s.storer, cmd)
+	}
+
+	return nil
+}
+
+// failAtomic sets the status of the commands not failed to
+// ErrAtomicTransaction.
+func (s *rpSession) failAtomic() {
+	for _, cmd := range s.cmds {
+		if s.cmdStatus[cmd.Name] == nil {
+			s.setStatus(cmd.Name, ErrAtomicTransaction)
 		}
 	}
 }
@@ -337,7 +785,9 @@ func (s *rpSession) writePackfile(r io.ReadCloser) error {
 		return nil
 	}
 
-	if err := packfile.UpdateObjectStorage(s.storer, r); err != nil {
+	pr := packfileReader(r)
+	if err := packfile.UpdateObjectStorage(s.storer, pr); err != nil {
+		_ = pr.CloseWithError(err)
 		_ = r.Close()
 		return err
 	}
@@ -345,6 +795,34 @@ func (s *rpSession) writePackfile(r io.ReadCloser) error {
 	return r.Close()
 }
 
+// packfileReader returns a reader of the packfile up to its checksum, since
+// the client doesn't close the connection until it receives the report
+// status.
+func packfileReader(r io.Reader) *io.PipeReader {
+	pr, pw := io.Pipe()
+	go func() {
+		sc := packfile.NewScanner(io.TeeReader(r, pw))
+		for sc.Scan() {
+		}
+
+		pw.CloseWithError(sc.Error())
+	}()
+
+	return pr
+}
+
+// isDeleteOnly returns whether every command is a delete, the packfile isn't
+// sent by the client then.
+func isDeleteOnly(cmds []*packp.Command) bool {
+	for _, cmd := range cmds {
+		if cmd.Action() != packp.Delete {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (s *rpSession) setStatus(ref plumbing.ReferenceName, err error) {
 	s.cmdStatus[ref] = err
 	if s.firstErr == nil && err != nil {
@@ -368,13 +846,18 @@ func (s *rpSession) reportStatus() *packp.ReportStatus {
 		return rs
 	}
 
-	for ref, err := range s.cmdStatus {
+	for _, cmd := range s.cmds {
+		err, ok := s.cmdStatus[cmd.Name]
+		if !ok {
+			continue
+		}
+
 		msg := "ok"
 		if err != nil {
 			msg = err.Error()
 		}
 		status := &packp.CommandStatus{
-			ReferenceName: ref,
+			ReferenceName: cmd.Name,
 			Status:        msg,
 		}
 		rs.CommandStatuses = append(rs.CommandStatuses, status)
@@ -396,6 +879,15 @@ func (*rpSession) setSupportedCapabilities(c *capability.List) error {
 		return err
 	}
 
+	if err := c.Set(capability.Atomic); err != nil {
+		return err
+	}
+
+	// The deltas of thin packs can't be resolved when writing the packfile.
+	if err := c.Set(capability.NoThin); err != nil {
+		return err
+	}
+
 	return c.Set(capability.ReportStatus)
 }
 
@@ -450,12 +942,3 @@ func setReferences(s storer.Storer, ar *packp.AdvRefs) error {
 		return nil
 	})
 }
-
-func referenceExists(s storer.ReferenceStorer, n plumbing.ReferenceName) (bool, error) {
-	_, err := s.Reference(n)
-	if err == plumbing.ErrReferenceNotFound {
-		return false, nil
-	}
-
-	return err == nil, err
-}
@@ -0,0 +1,341 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v5/plumbing/revlist"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// ErrNoShallowCommits is returned when the depth requested by a shallow
+// client excludes every commit wanted.
+var ErrNoShallowCommits = errors.New("no commits selected for shallow requests")
+
+// shallowWalk computes the history sent to a shallow client: the commits
+// reachable from the wants up to the depth requested and the new shallow
+// boundary, the commits sent without their parents.
+type shallowWalk struct {
+	storer storer.Storer
+	// client are the shallow commits of the client.
+	client map[plumbing.Hash]bool
+	// commits are the commits sent to the client.
+	commits map[plumbing.Hash]bool
+	// boundary are the commits sent without their parents.
+	boundary map[plumbing.Hash]bool
+	// provided are the objects wanted and the tags peeled from them, sent
+	// even if the filter omits them.
+	provided []plumbing.Hash
+	// others are the trees and blobs wanted.
+	others []plumbing.Hash
+}
+
+// keepFunc returns true if the parent, at the given distance from the wants,
+// is sent to the client.
+type keepFunc func(parent *object.Commit, depth int) bool
+
+// unbounded is the depth of the commits not limited by the depth, the ones
+// above the shallow boundary of the client on a relative deepen.
+const unbounded = -1
+
+func newShallowWalk(s storer.Storer, req *packp.UploadPackRequest) (*shallowWalk, error) {
+	w := &shallowWalk{
+		storer:   s,
+		client:   make(map[plumbing.Hash]bool, len(req.Shallows)),
+		commits:  make(map[plumbing.Hash]bool),
+		boundary: make(map[plumbing.Hash]bool),
+	}
+
+	for _, h := range req.Shallows {
+		w.client[h] = true
+	}
+
+	keep, err := w.keepFunc(req.Depth)
+	if err != nil {
+		return nil, err
+	}
+
+	_, isCommits := req.Depth.(packp.DepthCommits)
+	relative := isCommits && keep != nil && req.Capabilities.Supports(capability.DeepenRelative)
+	if err := w.walk(req.Wants, keep, relative); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *shallowWalk) keepFunc(depth packp.Depth) (keepFunc, error) {
+	switch d := depth.(type) {
+	case packp.DepthCommits:
+		if d == 0 {
+			return nil, nil
+		}
+
+		return func(_ *object.Commit, depth int) bool {
+			return depth == unbounded || depth < int(d)
+		}, nil
+	case packp.DepthSince:
+		since := time.Time(d)
+		return func(c *object.Commit, _ int) bool {
+			return !c.Committer.When.Before(since)
+		}, nil
+	case packp.DepthReference:
+		excluded, err := w.reachable(string(d))
+		if err != nil {
+			return nil, err
+		}
+
+		return func(c *object.Commit, _ int) bool {
+			return !excluded[c.Hash]
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// reachable returns the commits reachable from the reference, the name being
+// expanded as git does.
+func (w *shallowWalk) reachable(name string) (map[plumbing.Hash]bool, error) {
+	var ref *plumbing.Reference
+	for _, rule := range plumbing.RefRevParseRules {
+		r, err := storer.ResolveReference(w.storer, plumbing.ReferenceName(fmt.Sprintf(rule, name)))
+		if err == nil {
+			ref = r
+			break
+		}
+	}
+
+	if ref == nil {
+		return nil, fmt.Errorf("deepen-not: unknown ref %s", name)
+	}
+
+	o, _, err := peel(w.storer, ref.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	excluded := make(map[plumbing.Hash]bool)
+	c, ok := o.(*object.Commit)
+	if !ok {
+		return excluded, nil
+	}
+
+	iter := object.NewCommitPreorderIter(c, nil, nil)
+	err = iter.ForEach(func(c *object.Commit) error {
+		excluded[c.Hash] = true
+		return nil
+	})
+
+	return excluded, err
+}
+
+// walk visits the commits reachable from the wants, breadth first to know the
+// shortest distance to each of them. Without keep function the history isn't
+// limited, but the shallow commits of the client are still sent without
+// their parents.
+func (w *shallowWalk) walk(wants []plumbing.Hash, keep keepFunc, relative bool) error {
+	type item struct {
+		commit *object.Commit
+		depth  int
+	}
+
+	depth := 0
+	if relative {
+		depth = unbounded
+	}
+
+	var queue []item
+	var excluded bool
+	for _, h := range wants {
+		o, tags, err := peel(w.storer, h)
+		if err != nil {
+			return err
+		}
+
+		c, ok := o.(*object.Commit)
+		if !ok {
+			w.provided = append(append(w.provided, tags...), o.ID())
+			w.others = append(w.others, o.ID())
+			continue
+		}
+
+		if keep != nil && !keep(c, depth) {
+			excluded = true
+			continue
+		}
+
+		w.provided = append(append(w.provided, tags...), c.Hash)
+		queue = append(queue, item{c, depth})
+	}
+
+	if excluded && len(queue) == 0 {
+		return ErrNoShallowCommits
+	}
+
+	for len(queue) > 0 {
+		it := queue[0]
+		queue = queue[1:]
+
+		c := it.commit
+		if w.commits[c.Hash] {
+			continue
+		}
+
+		w.commits[c.Hash] = true
+		if w.client[c.Hash] && keep == nil {
+			w.boundary[c.Hash] = true
+			continue
+		}
+
+		// On a relative deepen, the parents of the shallow commits of the
+		// client are the first ones deepened.
+		depth := it.depth
+		if relative && w.client[c.Hash] {
+			depth = 0
+		} else if depth != unbounded {
+			depth++
+		}
+
+		for _, p := range c.ParentHashes {
+			parent, err := object.GetCommit(w.storer, p)
+			if err == plumbing.ErrObjectNotFound {
+				w.boundary[c.Hash] = true
+				continue
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if keep != nil && !keep(parent, depth) {
+				w.boundary[c.Hash] = true
+				continue
+			}
+
+			queue = append(queue, item{parent, depth})
+		}
+	}
+
+	return nil
+}
+
+// peel returns the object the tags point to and the tags peeled.
+func peel(s storer.EncodedObjectStorer, h plumbing.Hash) (object.Object, []plumbing.Hash, error) {
+	var tags []plumbing.Hash
+	for {
+		o, err := object.GetObject(s, h)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		t, ok := o.(*object.Tag)
+		if !ok {
+			return o, tags, nil
+		}
+
+		tags = append(tags, t.Hash)
+		h = t.Target
+	}
+}
+
+// update returns the shallow commits new to the client and the ones of the
+// client not shallow anymore, since their parents are sent.
+func (w *shallowWalk) update() *packp.ShallowUpdate {
+	u := &packp.ShallowUpdate{}
+	for h := range w.boundary {
+		if !w.client[h] {
+			u.Shallows = append(u.Shallows, h)
+		}
+	}
+
+	for h := range w.client {
+		if w.commits[h] && !w.boundary[h] {
+			u.Unshallows = append(u.Unshallows, h)
+		}
+	}
+
+	plumbing.HashesSort(u.Shallows)
+	plumbing.HashesSort(u.Unshallows)
+	return u
+}
+
+// objects returns the objects to send: the commits walked, their trees and
+// the objects wanted which aren't commits, omitting the ones filtered out.
+// The objects reachable from the haves are skipped, without going beyond the
+// shallow commits of the client, since it doesn't have their parents.
+func (w *shallowWalk) objects(haves []plumbing.Hash, filter revlist.Filter) ([]plumbing.Hash, error) {
+	common, err := w.commonCommits(haves)
+	if err != nil {
+		return nil, err
+	}
+
+	var ignore, trees []plumbing.Hash
+	for h, c := range common {
+		ignore = append(ignore, h)
+		trees = append(trees, c.TreeHash)
+	}
+
+	objs, err := revlist.Objects(w.storer, trees, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	fw := revlist.NewFilterWalker(w.storer, filter, append(ignore, objs...))
+	for _, h := range w.provided {
+		fw.Add(h)
+	}
+
+	for _, h := range w.others {
+		if err := fw.Walk(h); err != nil {
+			return nil, err
+		}
+	}
+
+	for h := range w.commits {
+		c, err := object.GetCommit(w.storer, h)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := fw.WalkCommit(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return fw.Objects(), nil
+}
+
+// commonCommits returns the commits reachable from the haves, the ones the
+// client has.
+func (w *shallowWalk) commonCommits(haves []plumbing.Hash) (map[plumbing.Hash]*object.Commit, error) {
+	common := make(map[plumbing.Hash]*object.Commit)
+	pending := append([]plumbing.Hash(nil), haves...)
+	for len(pending) > 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if common[h] != nil {
+			continue
+		}
+
+		c, err := object.GetCommit(w.storer, h)
+		if err == plumbing.ErrObjectNotFound {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		common[h] = c
+		if !w.client[h] {
+			pending = append(pending, c.ParentHashes...)
+		}
+	}
+
+	return common, nil
+}
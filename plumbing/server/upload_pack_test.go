@@ -1,9 +1,23 @@
 package server_test
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
 	"testing"
+	"time"
 
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+	"github.com/go-git/go-git/v5/plumbing/protocol"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v5/plumbing/server"
 	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/go-git/go-git/v5/utils/ioutil"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -53,3 +67,293 @@ func (s *ClientLikeUploadPackSuite) SetupSuite() {
 func (s *ClientLikeUploadPackSuite) TestAdvertisedReferencesEmpty() {
 	s.UploadPackSuite.TestAdvertisedReferencesEmpty()
 }
+
+func (s *UploadPackSuite) TestServeUploadPackV2() {
+	ep := *s.Endpoint
+	ep.ProtocolVersion = protocol.V2
+	sess, err := s.Client.NewUploadPackSession(&ep, s.EmptyAuth)
+	s.NoError(err)
+
+	var in bytes.Buffer
+	lsRefs := packp.NewLsRefsRequest()
+	lsRefs.Prefixes = []string{"HEAD", "refs/tags/"}
+	s.NoError(lsRefs.Encode(&in))
+
+	info := packp.NewObjectInfoRequest()
+	info.Oids = []plumbing.Hash{
+		plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+		plumbing.NewHash("0000000000000000000000000000000000000001"),
+	}
+	s.NoError(info.Encode(&in))
+
+	fetch := packp.NewUploadPackRequest()
+	fetch.Wants = append(fetch.Wants, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	s.NoError(fetch.EncodeV2(&in))
+	s.NoError(pktline.WriteFlush(&in))
+
+	var out bytes.Buffer
+	s.NoError(server.ServeUploadPack(server.ServerCommand{
+		Stdin:  &in,
+		Stdout: ioutil.WriteNopCloser(&out),
+	}, sess))
+
+	adv := packp.NewCapabilityAdvertisement()
+	s.NoError(adv.Decode(&out))
+	s.True(adv.SupportsFeature(capability.LsRefs, capability.Unborn))
+	s.True(adv.Supports(capability.ObjectInfo))
+
+	ar := packp.NewAdvRefs()
+	s.NoError(ar.DecodeLsRefs(&out))
+	s.Equal(plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"), *ar.Head)
+	s.Equal([]string{"HEAD:refs/heads/master"}, ar.Capabilities.Get(capability.SymRef))
+	s.Equal(map[string]plumbing.Hash{
+		"refs/heads/master": plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+		"refs/tags/v1.0.0":  plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	}, ar.References)
+
+	res := packp.NewObjectInfoResponse()
+	s.NoError(res.Decode(&out))
+	s.Equal([]packp.ObjectInfo{
+		{Hash: info.Oids[0], Size: 245},
+		{Hash: info.Oids[1], Size: -1},
+	}, res.Objects)
+
+	upres := packp.NewUploadPackResponse(fetch)
+	s.NoError(upres.DecodeV2(io.NopCloser(&out)))
+	st := memory.NewStorage()
+	s.NoError(packfile.UpdateObjectStorage(st, upres))
+	s.Len(st.Objects, 28)
+}
+
+func (s *UploadPackSuite) TestFetchNegotiation() {
+	fetch := packp.NewUploadPackRequest()
+	fetch.Wants = append(fetch.Wants, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+
+	// The unknown have isn't enough to send the packfile.
+	fetch.Haves = []plumbing.Hash{plumbing.NewHash("0000000000000000000000000000000000000001")}
+	res := s.serveFetch(fetch)
+	s.Empty(res.ACKs)
+	_, err := res.Read(make([]byte, 1))
+	s.ErrorIs(err, packp.ErrUploadPackResponseNotDecoded)
+
+	// The common have is acknowledged and the server is ready.
+	fetch.Haves = append(fetch.Haves, plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"))
+	res = s.serveFetch(fetch)
+	s.Equal(fetch.Haves[1:], res.ACKs)
+	st := memory.NewStorage()
+	s.NoError(packfile.UpdateObjectStorage(st, res))
+	s.Len(st.Objects, 4)
+}
+
+// serveFetch serves the fetch command, as sent by the clients negotiating the
+// common objects.
+func (s *UploadPackSuite) serveFetch(req *packp.UploadPackRequest) *packp.UploadPackResponse {
+	ep := *s.Endpoint
+	ep.ProtocolVersion = protocol.V2
+	sess, err := s.Client.NewUploadPackSession(&ep, s.EmptyAuth)
+	s.NoError(err)
+
+	cmd := packp.NewCommandRequest()
+	cmd.Command = capability.Fetch
+	for _, h := range req.Wants {
+		cmd.Args = append(cmd.Args, "want "+h.String())
+	}
+
+	for _, h := range req.Haves {
+		cmd.Args = append(cmd.Args, "have "+h.String())
+	}
+
+	for _, h := range req.Shallows {
+		cmd.Args = append(cmd.Args, "shallow "+h.String())
+	}
+
+	switch d := req.Depth.(type) {
+	case packp.DepthCommits:
+		if d != 0 {
+			cmd.Args = append(cmd.Args, fmt.Sprintf("deepen %d", d))
+		}
+	case packp.DepthSince:
+		cmd.Args = append(cmd.Args, fmt.Sprintf("deepen-since %d", time.Time(d).Unix()))
+	case packp.DepthReference:
+		cmd.Args = append(cmd.Args, "deepen-not "+string(d))
+	}
+
+	if req.Filter != "" {
+		cmd.Args = append(cmd.Args, "filter "+string(req.Filter))
+	}
+
+	if req.Done {
+		cmd.Args = append(cmd.Args, "done")
+	}
+
+	var in, out bytes.Buffer
+	s.NoError(cmd.Encode(&in))
+	s.NoError(server.ServeUploadPack(server.ServerCommand{
+		Stdin:  &in,
+		Stdout: ioutil.WriteNopCloser(&out),
+	}, sess))
+
+	s.NoError(packp.NewCapabilityAdvertisement().Decode(&out))
+	res := packp.NewUploadPackResponse(req)
+	s.NoError(res.DecodeV2(io.NopCloser(&out)))
+	return res
+}
+
+func (s *UploadPackSuite) TestUploadPackShallow() {
+	req := packp.NewUploadPackRequest()
+	req.Wants = append(req.Wants, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	req.Depth = packp.DepthCommits(1)
+	s.NoError(req.Capabilities.Set(capability.Shallow))
+
+	res := s.serveUploadPack(req)
+	s.Equal(req.Wants, res.Shallows)
+	s.Empty(res.Unshallows)
+
+	st := memory.NewStorage()
+	s.NoError(packfile.UpdateObjectStorage(st, res))
+	s.Len(st.Objects, 15)
+	s.Len(st.Commits, 1)
+}
+
+func (s *UploadPackSuite) TestUploadPackDeepen() {
+	req := packp.NewUploadPackRequest()
+	req.Wants = append(req.Wants, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	req.Shallows = req.Wants
+	req.Depth = packp.DepthCommits(2)
+	s.NoError(req.Capabilities.Set(capability.Shallow))
+
+	res := s.serveUploadPack(req)
+	s.Equal([]plumbing.Hash{plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")}, res.Shallows)
+	s.Equal(req.Wants, res.Unshallows)
+
+	st := memory.NewStorage()
+	s.NoError(packfile.UpdateObjectStorage(st, res))
+	s.Len(st.Commits, 2)
+}
+
+func (s *UploadPackSuite) TestFetchShallow() {
+	since := time.Date(2015, 3, 31, 13, 50, 0, 0, time.FixedZone("", 2*60*60))
+	for _, tc := range []struct {
+		depth    packp.Depth
+		shallows []string
+		objects  int
+	}{
+		{packp.DepthCommits(1), []string{"6ecf0ef2c2dffb796033e5a02219af86ec6584e5"}, 15},
+		{packp.DepthSince(since), []string{"af2d6a6954d532f8ffb47615169c8fdf9d383a1a"}, 19},
+		{packp.DepthReference("branch"), []string{"6ecf0ef2c2dffb796033e5a02219af86ec6584e5"}, 15},
+	} {
+		req := packp.NewUploadPackRequest()
+		req.Wants = append(req.Wants, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+		req.Depth = tc.depth
+		req.Done = true
+
+		res := s.serveFetch(req)
+		var shallows []plumbing.Hash
+		for _, h := range tc.shallows {
+			shallows = append(shallows, plumbing.NewHash(h))
+		}
+
+		s.Equal(shallows, res.Shallows)
+		st := memory.NewStorage()
+		s.NoError(packfile.UpdateObjectStorage(st, res))
+		s.Len(st.Objects, tc.objects)
+	}
+}
+
+func (s *UploadPackSuite) TestUploadPackShallowNoCommits() {
+	sess, err := s.Client.NewUploadPackSession(s.Endpoint, s.EmptyAuth)
+	s.NoError(err)
+
+	req := packp.NewUploadPackRequest()
+	req.Wants = append(req.Wants, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	req.Depth = packp.DepthReference("master")
+	s.NoError(req.Capabilities.Set(capability.DeepenNot))
+
+	_, err = sess.UploadPack(context.Background(), req)
+	s.ErrorIs(err, server.ErrNoShallowCommits)
+}
+
+func (s *UploadPackSuite) TestUploadPackFilter() {
+	sess, err := s.Client.NewUploadPackSession(s.Endpoint, s.EmptyAuth)
+	s.NoError(err)
+
+	ar, err := sess.AdvertisedReferences()
+	s.NoError(err)
+	s.True(ar.Capabilities.Supports(capability.Filter))
+	s.True(ar.Capabilities.Supports(capability.AllowReachableSHA1InWant))
+
+	req := packp.NewUploadPackRequest()
+	req.Wants = append(req.Wants, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	req.Filter = packp.FilterBlobNone()
+	s.NoError(req.Capabilities.Set(capability.Filter))
+
+	res := s.serveUploadPack(req)
+	st := memory.NewStorage()
+	s.NoError(packfile.UpdateObjectStorage(st, res))
+	s.Len(st.Objects, 19)
+	s.Empty(st.Blobs)
+}
+
+func (s *UploadPackSuite) TestFetchFilter() {
+	for _, tc := range []struct {
+		filter  packp.Filter
+		depth   packp.Depth
+		objects int
+	}{
+		{packp.FilterTreeDepth(1), packp.DepthCommits(0), 15},
+		{packp.FilterTreeDepth(0), packp.DepthCommits(1), 1},
+		{packp.FilterCombine(packp.FilterBlobNone(), packp.FilterBlobLimit(1, packp.BlobLimitPrefixKibi)), packp.DepthCommits(1), 6},
+	} {
+		req := packp.NewUploadPackRequest()
+		req.Wants = append(req.Wants, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+		req.Filter = tc.filter
+		req.Depth = tc.depth
+		req.Done = true
+
+		res := s.serveFetch(req)
+		st := memory.NewStorage()
+		s.NoError(packfile.UpdateObjectStorage(st, res))
+		s.Len(st.Objects, tc.objects, tc.filter)
+	}
+}
+
+func (s *UploadPackSuite) TestUploadPackWantReachable() {
+	// The blob of the .gitignore file, as fetched by a partial clone.
+	req := packp.NewUploadPackRequest()
+	req.Wants = append(req.Wants, plumbing.NewHash("32858aad3c383ed1ff0a0f9bdf231d54a00c9e88"))
+
+	res := s.serveUploadPack(req)
+	st := memory.NewStorage()
+	s.NoError(packfile.UpdateObjectStorage(st, res))
+	s.Len(st.Blobs, 1)
+
+	sess, err := s.Client.NewUploadPackSession(s.Endpoint, s.EmptyAuth)
+	s.NoError(err)
+
+	req = packp.NewUploadPackRequest()
+	req.Wants = append(req.Wants, plumbing.NewHash("0000000000000000000000000000000000000001"))
+	_, err = sess.UploadPack(context.Background(), req)
+	s.ErrorIs(err, server.ErrWantNotReachable)
+}
+
+// serveUploadPack serves the request on the version 0 of the protocol, as
+// sent by the clients, ending the negotiation without haves.
+func (s *UploadPackSuite) serveUploadPack(req *packp.UploadPackRequest) *packp.UploadPackResponse {
+	sess, err := s.Client.NewUploadPackSession(s.Endpoint, s.EmptyAuth)
+	s.NoError(err)
+
+	var in, out bytes.Buffer
+	s.NoError(req.UploadRequest.Encode(&in))
+	_, err = pktline.WriteString(&in, "done\n")
+	s.NoError(err)
+
+	s.NoError(server.ServeUploadPack(server.ServerCommand{
+		Stdin:  &in,
+		Stdout: ioutil.WriteNopCloser(&out),
+	}, sess))
+
+	s.NoError(packp.NewAdvRefs().Decode(&out))
+	res := packp.NewUploadPackResponse(req)
+	s.NoError(res.Decode(io.NopCloser(&out)))
+	return res
+}
@@ -0,0 +1,23 @@
+package storer
+
+import (
+	commitgraph "github.com/go-git/go-git/v5/plumbing/format/commitgraph/v2"
+)
+
+// CommitGraphStorer is a storage of the commit-graph, the index of the
+// commits speeding up the walks of the history. It is an optional interface,
+// implemented by the storages supporting commit-graphs.
+type CommitGraphStorer interface {
+	// CommitGraph returns the commit-graph of the storage. If the storage has
+	// none, or it can't be used, nil and no error are returned. The index is
+	// owned by the storage and must not be closed.
+	CommitGraph() (commitgraph.Index, error)
+	// SetCommitGraph replaces the commit-graph of the storage by the given
+	// index, written as a single file.
+	SetCommitGraph(commitgraph.Index) error
+	// AddCommitGraphLayer writes the given index, on top of the commit-graph
+	// of the storage as its parent, as a new layer of a split commit-graph.
+	// The layers below it are merged into it as long as they have less than
+	// sizeMultiple times its commits.
+	AddCommitGraphLayer(idx commitgraph.Index, sizeMultiple int) error
+}
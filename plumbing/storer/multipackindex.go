@@ -0,0 +1,21 @@
+package storer
+
+import (
+	"github.com/go-git/go-git/v5/plumbing/format/midx"
+)
+
+// MultiPackIndexStorer is a storage of the multi-pack-index, the index of the
+// objects of several packs, looked up instead of the index of each pack. It
+// is an optional interface, implemented by the storages supporting
+// multi-pack-indexes.
+type MultiPackIndexStorer interface {
+	// MultiPackIndex returns the multi-pack-index of the storage. If the
+	// storage has none, or it can't be used, nil and no error are returned.
+	MultiPackIndex() (*midx.MultiPackIndex, error)
+	// WriteMultiPackIndex writes the multi-pack-index of all the packs of
+	// the storage, replacing the current one.
+	WriteMultiPackIndex() error
+	// RemoveMultiPackIndex removes the multi-pack-index of the storage, if
+	// any.
+	RemoveMultiPackIndex() error
+}
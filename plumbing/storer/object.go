@@ -101,6 +101,28 @@ type PackfileWriter interface {
 	PackfileWriter() (io.WriteCloser, error)
 }
 
+// PromisorPackfileWriter is an optional method for ObjectStorer, it enables
+// writing a packfile fetched from a promisor remote, which may refer to
+// objects missing in the storage.
+type PromisorPackfileWriter interface {
+	// PromisorPackfileWriter returns a writer for writing a packfile to the
+	// storage, marked as fetched from a promisor remote.
+	PromisorPackfileWriter() (io.WriteCloser, error)
+}
+
+// FetchObjectsFunc fetches the given objects from a promisor remote into the
+// storage.
+type FetchObjectsFunc func(hashes ...plumbing.Hash) error
+
+// PromisorObjectStorer is an optional interface for ObjectStorer, it enables
+// fetching on demand the objects missing in the storage of a partial clone.
+type PromisorObjectStorer interface {
+	// SetPromisor sets the function called by EncodedObject to fetch the
+	// objects not found in the storage, nil disables the lazy fetching.
+	// HasEncodedObject never fetches the missing objects.
+	SetPromisor(fetch FetchObjectsFunc)
+}
+
 // EncodedObjectIter is a generic closable interface for iterating over objects.
 type EncodedObjectIter interface {
 	Next() (plumbing.EncodedObject, error)
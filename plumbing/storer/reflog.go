@@ -0,0 +1,24 @@
+package storer
+
+import (
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/reflog"
+)
+
+// ReflogStorer is a storage of the reference logs, which record the updates
+// done to the references. It is an optional interface, implemented by the
+// storages supporting reflogs.
+type ReflogStorer interface {
+	// Reflog returns the entries of the reflog of the given reference, from
+	// the oldest to the newest. If the reference has no reflog, no entries
+	// and no error are returned.
+	Reflog(plumbing.ReferenceName) ([]*reflog.Entry, error)
+	// AppendReflog adds the given entry at the end of the reflog of the
+	// given reference, creating the reflog if needed.
+	AppendReflog(plumbing.ReferenceName, *reflog.Entry) error
+	// SetReflog replaces the reflog of the given reference by the given
+	// entries, sorted from the oldest to the newest.
+	SetReflog(plumbing.ReferenceName, []*reflog.Entry) error
+	// RemoveReflog removes the reflog of the given reference, if any.
+	RemoveReflog(plumbing.ReferenceName) error
+}
@@ -0,0 +1,230 @@
+// Package bundle implements a read-only transport fetching from git bundle
+// files.
+package bundle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/bundle"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/utils/ioutil"
+)
+
+func init() {
+	transport.Register("bundle", DefaultClient)
+}
+
+var (
+	// ErrPushNotSupported is returned starting a git-receive-pack session,
+	// bundles can't be pushed to.
+	ErrPushNotSupported = errors.New("bundle transport does not support push")
+	// ErrShallowNotSupported is returned requesting a shallow fetch, the
+	// packfile of a bundle is sent as is.
+	ErrShallowNotSupported = errors.New("bundle transport does not support shallow fetches")
+	// ErrMissingPrerequisites is returned verifying the prerequisites of a
+	// bundle in a repository lacking some of them.
+	ErrMissingPrerequisites = errors.New("repository lacks these prerequisite commits")
+)
+
+// DefaultClient is the default bundle client.
+var DefaultClient = NewClient()
+
+type client struct{}
+
+// NewClient returns a new client fetching from the bundle files at the path
+// of the endpoints. The objects reachable from the prerequisites of the
+// bundles must be in the repository fetching from them, the sessions verify
+// it with VerifyPrerequisites.
+func NewClient() transport.Transport {
+	return &client{}
+}
+
+// IsBundle returns whether the file at the given path is a bundle.
+func IsBundle(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+
+	defer f.Close()
+	sig := make([]byte, len(bundle.V2Signature))
+	if _, err := io.ReadFull(f, sig); err != nil {
+		return false
+	}
+
+	return string(sig) == bundle.V2Signature || string(sig) == bundle.V3Signature
+}
+
+func (c *client) NewUploadPackSession(ep *transport.Endpoint, _ transport.AuthMethod) (transport.UploadPackSession, error) {
+	return &upSession{path: ep.Path}, nil
+}
+
+func (c *client) NewReceivePackSession(*transport.Endpoint, transport.AuthMethod) (transport.ReceivePackSession, error) {
+	return nil, ErrPushNotSupported
+}
+
+type upSession struct {
+	path string
+}
+
+// open opens the bundle, decoding its header.
+func (s *upSession) open() (*bundle.Bundle, io.Closer, error) {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil, transport.ErrRepositoryNotFound
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b := &bundle.Bundle{}
+	if err := bundle.NewDecoder(f).Decode(b); err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+
+	return b, f, nil
+}
+
+func (s *upSession) AdvertisedReferences() (*packp.AdvRefs, error) {
+	return s.AdvertisedReferencesContext(context.TODO())
+}
+
+// AdvertisedReferencesContext returns the references of the bundle. HEAD is
+// advertised as a symbolic reference to the branch it points to, if any.
+func (s *upSession) AdvertisedReferencesContext(context.Context) (*packp.AdvRefs, error) {
+	b, closer, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+
+	defer closer.Close()
+	ar := packp.NewAdvRefs()
+	var head *plumbing.Hash
+	for _, ref := range b.References {
+		if ref.Name() == plumbing.HEAD {
+			h := ref.Hash()
+			head = &h
+			continue
+		}
+
+		ar.References[ref.Name().String()] = ref.Hash()
+	}
+
+	if ar.IsEmpty() && head == nil {
+		return nil, transport.ErrEmptyRemoteRepository
+	}
+
+	if head != nil {
+		ar.Head = head
+		if target := headTarget(ar.References, *head); target != "" {
+			ref := plumbing.NewSymbolicReference(plumbing.HEAD, target)
+			if err := ar.AddReference(ref); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return ar, nil
+}
+
+// headTarget returns the branch HEAD points to, guessed by its hash as git
+// does: the default branches are preferred, then the first one in order.
+func headTarget(refs map[string]plumbing.Hash, head plumbing.Hash) plumbing.ReferenceName {
+	var names []string
+	for name, h := range refs {
+		if h == head && strings.HasPrefix(name, "refs/heads/") {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		if name == plumbing.Master.String() || name == plumbing.Main.String() {
+			return plumbing.ReferenceName(name)
+		}
+	}
+
+	if len(names) == 0 {
+		return ""
+	}
+
+	return plumbing.ReferenceName(names[0])
+}
+
+// UploadPack responds with the packfile of the bundle, whatever the objects
+// wanted are.
+func (s *upSession) UploadPack(_ context.Context, req *packp.UploadPackRequest) (*packp.UploadPackResponse, error) {
+	if req.IsEmpty() {
+		return nil, transport.ErrEmptyUploadPackRequest
+	}
+
+	if !req.Depth.IsZero() || len(req.Shallows) != 0 {
+		return nil, ErrShallowNotSupported
+	}
+
+	b, closer, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+
+	rc := ioutil.NewReadCloser(b.Packfile, closer)
+	return packp.NewUploadPackResponseWithPackfile(req, rc), nil
+}
+
+// HasPrerequisites returns whether the bundle has prerequisites, its packfile
+// may be thin then, with deltas against objects missing in it.
+func (s *upSession) HasPrerequisites() (bool, error) {
+	b, closer, err := s.open()
+	if err != nil {
+		return false, err
+	}
+
+	defer closer.Close()
+	return len(b.Prerequisites) != 0, nil
+}
+
+// VerifyPrerequisites returns ErrMissingPrerequisites if the given storage
+// lacks some of the prerequisite commits of the bundle, as git does before
+// fetching from it.
+func (s *upSession) VerifyPrerequisites(st storer.EncodedObjectStorer) error {
+	b, closer, err := s.open()
+	if err != nil {
+		return err
+	}
+
+	defer closer.Close()
+	var missing []string
+	for _, p := range b.Prerequisites {
+		err := st.HasEncodedObject(p.Hash)
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			missing = append(missing, strings.TrimSpace(p.Hash.String()+" "+p.Comment))
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(missing) != 0 {
+		return fmt.Errorf("%w: %s", ErrMissingPrerequisites, strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// Close does nothing.
+func (s *upSession) Close() error {
+	return nil
+}
@@ -7,6 +7,7 @@ package transport
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -16,6 +17,7 @@ import (
 	"time"
 
 	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+	"github.com/go-git/go-git/v5/plumbing/protocol"
 	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
 	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
 	"github.com/go-git/go-git/v5/plumbing/protocol/packp/sideband"
@@ -110,6 +112,13 @@ type session struct {
 	packRun       bool
 	finished      bool
 	firstErrLine  chan string
+
+	// version is the version of the protocol requested to the server, and
+	// caps the capabilities advertised by the server once it's discovered
+	// that it speaks the version 2.
+	version    protocol.Version
+	discovered bool
+	caps       *packp.CapabilityAdvertisement
 }
 
 func (c *client) newSession(s string, ep *Endpoint, auth AuthMethod) (*session, error) {
@@ -137,13 +146,19 @@ func (c *client) newSession(s string, ep *Endpoint, auth AuthMethod) (*session,
 		return nil, err
 	}
 
-	return &session{
+	sess := &session{
 		Stdin:         stdin,
 		Stdout:        stdout,
 		Command:       cmd,
 		firstErrLine:  c.listenFirstError(stderr),
 		isReceivePack: s == ReceivePackServiceName,
-	}, nil
+	}
+
+	if ep != nil {
+		sess.version = ep.ProtocolVersion
+	}
+
+	return sess, nil
 }
 
 func (c *client) listenFirstError(r io.Reader) chan string {
@@ -183,6 +198,24 @@ func (s *session) AdvertisedReferencesContext(ctx context.Context) (*packp.AdvRe
 		return s.advRefs, nil
 	}
 
+	if err := s.discoverVersion(ctx); err != nil {
+		return nil, err
+	}
+
+	if s.caps != nil {
+		ar, err := s.lsRefs(ctx, packp.NewLsRefsRequest())
+		if err != nil {
+			return nil, err
+		}
+
+		if ar.IsEmpty() {
+			return nil, ErrEmptyRemoteRepository
+		}
+
+		s.advRefs = ar
+		return ar, nil
+	}
+
 	ar := packp.NewAdvRefs()
 	if err := ar.Decode(s.StdoutContext(ctx)); err != nil {
 		if err := s.handleAdvRefDecodeError(err); err != nil {
@@ -202,6 +235,112 @@ func (s *session) AdvertisedReferencesContext(ctx context.Context) (*packp.AdvRe
 	return ar, nil
 }
 
+// discoverVersion reads the first pkt-line sent by the server, if a version
+// other than the 0 was requested, to find the version spoken by the server.
+// The capabilities are read if it's the version 2, otherwise the
+// advertised-refs message follows.
+func (s *session) discoverVersion(ctx context.Context) error {
+	if s.discovered || s.isReceivePack || s.version == protocol.V0 {
+		return nil
+	}
+
+	s.discovered = true
+
+	r := bufio.NewReader(s.StdoutContext(ctx))
+	v, err := DiscoverVersion(r)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = packp.ErrEmptyInput
+		}
+
+		return s.handleAdvRefDecodeError(err)
+	}
+
+	if v == protocol.V2 {
+		caps := packp.NewCapabilityAdvertisement()
+		if err := caps.Decode(r); err != nil {
+			return s.handleAdvRefDecodeError(err)
+		}
+
+		s.caps = caps
+	}
+
+	// The data already buffered is given back to the following reads.
+	buffered, _ := r.Peek(r.Buffered())
+	s.Stdout = io.MultiReader(bytes.NewReader(bytes.Clone(buffered)), s.Stdout)
+	return nil
+}
+
+// LsRefs lists the references of the server matching the request. The
+// references are filtered by the server if it speaks the version 2 of the
+// protocol, otherwise the advertised references are filtered.
+func (s *session) LsRefs(ctx context.Context, req *packp.LsRefsRequest) (*packp.AdvRefs, error) {
+	if err := s.discoverVersion(ctx); err != nil {
+		return nil, err
+	}
+
+	if s.caps != nil {
+		return s.lsRefs(ctx, req)
+	}
+
+	if len(req.ServerOptions) != 0 {
+		return nil, ErrServerOptionsNotSupported
+	}
+
+	ar, err := s.AdvertisedReferencesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return req.Filter(ar), nil
+}
+
+func (s *session) lsRefs(ctx context.Context, req *packp.LsRefsRequest) (*packp.AdvRefs, error) {
+	if err := ValidateLsRefsRequest(s.caps, req); err != nil {
+		return nil, err
+	}
+
+	if err := req.Encode(s.StdinContext(ctx)); err != nil {
+		return nil, fmt.Errorf("sending ls-refs command: %s", err)
+	}
+
+	ar := packp.NewAdvRefs()
+	ar.Capabilities = s.caps.UploadPackCapabilities()
+	if err := ar.DecodeLsRefs(s.StdoutContext(ctx)); err != nil {
+		return nil, s.handleAdvRefDecodeError(err)
+	}
+
+	FilterUnsupportedCapabilities(ar.Capabilities)
+	return ar, nil
+}
+
+// ValidateLsRefsRequest checks the request is supported by the server, given
+// the capabilities it advertised on the version 2 of the protocol, and sets
+// the agent capability of the request.
+func ValidateLsRefsRequest(caps *packp.CapabilityAdvertisement, req *packp.LsRefsRequest) error {
+	if !caps.Supports(capability.LsRefs) {
+		return fmt.Errorf("%s not supported", capability.LsRefs)
+	}
+
+	if len(req.ServerOptions) != 0 && !caps.Supports(capability.ServerOption) {
+		return ErrServerOptionsNotSupported
+	}
+
+	if req.Unborn && !caps.SupportsFeature(capability.LsRefs, capability.Unborn) {
+		req.Unborn = false
+	}
+
+	if req.Capabilities == nil {
+		req.Capabilities = capability.NewList()
+	}
+
+	if caps.Supports(capability.Agent) && !req.Capabilities.Supports(capability.Agent) {
+		return req.Capabilities.Set(capability.Agent, capability.DefaultAgent())
+	}
+
+	return nil
+}
+
 func (s *session) handleAdvRefDecodeError(err error) error {
 	var errLine *pktline.ErrorLine
 	if errors.As(err, &errLine) {
@@ -276,6 +415,14 @@ func (s *session) UploadPack(ctx context.Context, req *packp.UploadPackRequest)
 		return nil, err
 	}
 
+	if err := s.discoverVersion(ctx); err != nil {
+		return nil, err
+	}
+
+	if s.caps != nil {
+		return s.uploadPackV2(ctx, req)
+	}
+
 	if _, err := s.AdvertisedReferencesContext(ctx); err != nil {
 		return nil, err
 	}
@@ -306,6 +453,24 @@ func (s *session) UploadPack(ctx context.Context, req *packp.UploadPackRequest)
 	return DecodeUploadPackResponse(rc, req)
 }
 
+// uploadPackV2 sends the request as a fetch command of the version 2 of the
+// protocol, the server closes the connection after the response.
+func (s *session) uploadPackV2(ctx context.Context, req *packp.UploadPackRequest) (*packp.UploadPackResponse, error) {
+	s.packRun = true
+
+	in := s.StdinContext(ctx)
+	if err := req.EncodeV2(in); err != nil {
+		return nil, fmt.Errorf("sending fetch command: %s", err)
+	}
+
+	if err := in.Close(); err != nil {
+		return nil, fmt.Errorf("closing input: %s", err)
+	}
+
+	rc := ioutil.NewReadCloser(s.StdoutContext(ctx), s)
+	return DecodeUploadPackResponseV2(rc, req)
+}
+
 func (s *session) StdinContext(ctx context.Context) io.WriteCloser {
 	return ioutil.NewWriteCloserOnError(
 		ioutil.NewContextWriteCloser(ctx, s.Stdin),
@@ -495,3 +660,16 @@ func DecodeUploadPackResponse(r io.ReadCloser, req *packp.UploadPackRequest) (
 
 	return res, nil
 }
+
+// DecodeUploadPackResponseV2 decodes r, the response of a fetch command of the
+// version 2 of the protocol, into a new packp.UploadPackResponse
+func DecodeUploadPackResponseV2(r io.ReadCloser, req *packp.UploadPackRequest) (
+	*packp.UploadPackResponse, error,
+) {
+	res := packp.NewUploadPackResponse(req)
+	if err := res.DecodeV2(r); err != nil {
+		return nil, fmt.Errorf("error decoding upload-pack response: %w", err)
+	}
+
+	return res, nil
+}
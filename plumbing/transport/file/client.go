@@ -4,6 +4,7 @@ package file
 import (
 	"bufio"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -11,6 +12,7 @@ import (
 	"strings"
 
 	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/bundle"
 	"golang.org/x/sys/execabs"
 )
 
@@ -30,12 +32,33 @@ type runner struct {
 }
 
 // NewClient returns a new local client using the given git-upload-pack and
-// git-receive-pack binaries.
+// git-receive-pack binaries. The bundle files are fetched from with the
+// bundle transport instead.
 func NewClient(uploadPackBin, receivePackBin string) transport.Transport {
-	return transport.NewClient(&runner{
+	return &client{transport.NewClient(&runner{
 		UploadPackBin:  uploadPackBin,
 		ReceivePackBin: receivePackBin,
-	})
+	})}
+}
+
+type client struct {
+	transport.Transport
+}
+
+func (c *client) NewUploadPackSession(ep *transport.Endpoint, auth transport.AuthMethod) (transport.UploadPackSession, error) {
+	if bundle.IsBundle(adjustPathForWindows(ep.Path)) {
+		return bundle.DefaultClient.NewUploadPackSession(ep, auth)
+	}
+
+	return c.Transport.NewUploadPackSession(ep, auth)
+}
+
+func (c *client) NewReceivePackSession(ep *transport.Endpoint, auth transport.AuthMethod) (transport.ReceivePackSession, error) {
+	if bundle.IsBundle(adjustPathForWindows(ep.Path)) {
+		return bundle.DefaultClient.NewReceivePackSession(ep, auth)
+	}
+
+	return c.Transport.NewReceivePackSession(ep, auth)
 }
 
 func prefixExecPath(cmd string) (string, error) {
@@ -79,6 +102,7 @@ func prefixExecPath(cmd string) (string, error) {
 
 func (r *runner) Command(cmd string, ep *transport.Endpoint, auth transport.AuthMethod,
 ) (transport.Command, error) {
+	version := transport.VersionParameter(cmd, ep)
 
 	switch cmd {
 	case transport.UploadPackServiceName:
@@ -99,7 +123,12 @@ func (r *runner) Command(cmd string, ep *transport.Endpoint, auth transport.Auth
 		}
 	}
 
-	return &command{cmd: execabs.Command(cmd, adjustPathForWindows(ep.Path))}, nil
+	c := execabs.Command(cmd, adjustPathForWindows(ep.Path))
+	if version != "" {
+		c.Env = append(os.Environ(), fmt.Sprintf("GIT_PROTOCOL=%s", version))
+	}
+
+	return &command{cmd: c}, nil
 }
 
 func isDriveLetter(c byte) bool {
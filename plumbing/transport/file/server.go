@@ -11,13 +11,16 @@ import (
 
 // ServeUploadPack serves a git-upload-pack request using standard output, input
 // and error. This is meant to be used when implementing a git-upload-pack
-// command.
+// command. The version of the protocol is the one requested by the client in
+// the GIT_PROTOCOL environment variable.
 func ServeUploadPack(path string) error {
 	ep, err := transport.NewEndpoint(path)
 	if err != nil {
 		return err
 	}
 
+	ep.ProtocolVersion = transport.ProtocolVersion(os.Getenv("GIT_PROTOCOL"))
+
 	// TODO: define and implement a server-side AuthMethod
 	s, err := server.DefaultServer.NewUploadPackSession(ep, nil)
 	if err != nil {
@@ -1,11 +1,21 @@
 package file
 
 import (
+	"bytes"
+	"context"
+	"io"
 	"os"
 	"testing"
 
 	"github.com/go-git/go-git/v5/internal/transport/test"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/protocol"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/sideband"
 	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
 	"github.com/stretchr/testify/suite"
 
 	fixtures "github.com/go-git/go-git-fixtures/v4"
@@ -86,3 +96,37 @@ func (s *UploadPackSuite) TestUploadPackWithContextOnRead() {
 	// canceled context when the packfile is being read.
 	s.T().Skip("UploadPack has a race condition when we Close the session")
 }
+
+func (s *UploadPackSuite) TestProtocolV2() {
+	ep := *s.ups.Endpoint
+	ep.ProtocolVersion = protocol.V2
+
+	r, err := DefaultClient.NewUploadPackSession(&ep, s.ups.EmptyAuth)
+	s.NoError(err)
+	defer func() { s.Nil(r.Close()) }()
+
+	lister, ok := r.(transport.RefLister)
+	s.True(ok)
+
+	req := packp.NewLsRefsRequest()
+	req.Prefixes = []string{"refs/heads/"}
+	ar, err := lister.LsRefs(context.Background(), req)
+	s.NoError(err)
+	s.Nil(ar.Head)
+	s.Len(ar.References, 2)
+	s.Equal(plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"), ar.References["refs/heads/master"])
+	s.True(ar.Capabilities.Supports(capability.OFSDelta))
+
+	upreq := packp.NewUploadPackRequestFromCapabilities(ar.Capabilities)
+	upreq.Wants = append(upreq.Wants, ar.References["refs/heads/master"])
+	res, err := r.UploadPack(context.Background(), upreq)
+	s.NoError(err)
+
+	// The packfile is multiplexed, since the request has the side-band-64k
+	// capability.
+	b, err := io.ReadAll(sideband.NewDemuxer(sideband.Sideband64k, res))
+	s.NoError(err)
+	storage := memory.NewStorage()
+	s.NoError(packfile.UpdateObjectStorage(storage, bytes.NewBuffer(b)))
+	s.Len(storage.Objects, 28)
+}
@@ -54,6 +54,9 @@ func (c *command) Start() error {
 	}
 
 	req.Host = host
+	if version := transport.VersionParameter(c.command, c.endpoint); version != "" {
+		req.ExtraParams = append(req.ExtraParams, version)
+	}
 
 	return req.Encode(c.conn)
 }
@@ -0,0 +1,268 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/internal/transport/tracker"
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/server"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/utils/ioutil"
+)
+
+// ExportOkFile is the file marking a repository as exported by the daemon,
+// unless every repository is exported.
+const ExportOkFile = "git-daemon-export-ok"
+
+var (
+	// ErrServerClosed is returned by Serve and ListenAndServe after a call
+	// to Close.
+	ErrServerClosed = errors.New("git: server closed")
+	// ErrServiceNotEnabled is returned serving a request of a service not
+	// enabled.
+	ErrServiceNotEnabled = errors.New("service not enabled")
+	// ErrNotExported is returned serving a request of a repository not
+	// found, or not exported.
+	ErrNotExported = errors.New("access denied or repository not exported")
+)
+
+// Server serves repositories over the git protocol, as git daemon does.
+type Server struct {
+	// Addr is the TCP address to listen on, ":9418" if empty.
+	Addr string
+	// Loader loads the repositories requested, server.DefaultLoader if nil.
+	Loader server.Loader
+	// BasePath is the path the paths requested are relative to. If empty,
+	// the paths requested are absolute.
+	BasePath string
+	// ExportAll exports every repository, instead of the ones with the
+	// ExportOkFile.
+	ExportAll bool
+	// ReceivePack enables the git-receive-pack service, allowing anonymous
+	// pushes to the repositories exported.
+	ReceivePack bool
+	// ReceivePackHooks are run on each push, to check or reject the updates
+	// of the references.
+	ReceivePackHooks server.ReceivePackHooks
+	// Timeout closes the connections idle for longer, waiting for the
+	// client or serving its requests, as the --timeout option of git daemon
+	// does. The connections aren't closed if zero.
+	Timeout time.Duration
+	// ErrorLog logs the errors serving the connections, they aren't logged
+	// if nil.
+	ErrorLog *log.Logger
+
+	tracker tracker.Tracker
+}
+
+// ListenAndServe listens on the TCP address of the server and serves the
+// connections accepted. It always returns a non-nil error, ErrServerClosed
+// after a call to Close.
+func (s *Server) ListenAndServe() error {
+	addr := s.Addr
+	if addr == "" {
+		addr = ":" + strconv.Itoa(DefaultPort)
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+// Serve serves the connections accepted on the listener, each one in its own
+// goroutine. It always returns a non-nil error, ErrServerClosed after a
+// call to Close.
+func (s *Server) Serve(l net.Listener) error {
+	err := s.tracker.Serve(l, func(conn net.Conn) {
+		if s.Timeout > 0 {
+			conn = &timeoutConn{Conn: conn, timeout: s.Timeout}
+		}
+
+		if err := s.serveConn(conn); err != nil && s.ErrorLog != nil {
+			s.ErrorLog.Printf("git: serving %s: %s", conn.RemoteAddr(), err)
+		}
+	})
+
+	if errors.Is(err, tracker.ErrClosed) {
+		return ErrServerClosed
+	}
+
+	return err
+}
+
+// Close closes the listeners and the connections of the server, waiting for
+// the connections being served.
+func (s *Server) Close() error {
+	return s.tracker.Close()
+}
+
+func (s *Server) serveConn(conn net.Conn) error {
+	req := &packp.GitProtoRequest{}
+	if err := req.Decode(conn); err != nil {
+		return err
+	}
+
+	ep, err := s.endpoint(req)
+	if err != nil {
+		return s.reject(conn, err)
+	}
+
+	srv := server.NewServerWithHooks(&daemonLoader{s}, s.ReceivePackHooks)
+	cmd := server.ServerCommand{
+		// The connection isn't closed by the session, the report status is
+		// written once the packfile is read.
+		Stdin:  struct{ io.Reader }{conn},
+		Stdout: ioutil.WriteNopCloser(conn),
+	}
+
+	switch req.RequestCommand {
+	case transport.UploadPackServiceName:
+		sess, err := srv.NewUploadPackSession(ep, nil)
+		if err != nil {
+			return s.reject(conn, sessionError(err, req.Pathname))
+		}
+
+		err = server.ServeUploadPack(cmd, sess)
+		if errors.Is(err, transport.ErrEmptyUploadPackRequest) {
+			// The client only listed the references.
+			return nil
+		}
+
+		return err
+	case transport.ReceivePackServiceName:
+		if !s.ReceivePack {
+			return s.reject(conn, fmt.Errorf("%w: '%s'", ErrServiceNotEnabled, req.RequestCommand))
+		}
+
+		sess, err := srv.NewReceivePackSession(ep, nil)
+		if err != nil {
+			return s.reject(conn, sessionError(err, req.Pathname))
+		}
+
+		return server.ServeReceivePack(cmd, sess)
+	}
+
+	return s.reject(conn, fmt.Errorf("%w: '%s'", ErrServiceNotEnabled, req.RequestCommand))
+}
+
+// endpoint returns the endpoint of the repository requested, relative to
+// the base path.
+func (s *Server) endpoint(req *packp.GitProtoRequest) (*transport.Endpoint, error) {
+	p := req.Pathname
+	if s.BasePath == "" && !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("%w: %s", ErrNotExported, req.Pathname)
+	}
+
+	ep := &transport.Endpoint{
+		Protocol:        "git",
+		Path:            path.Join("/", s.BasePath, path.Clean("/"+p)),
+		ProtocolVersion: transport.ProtocolVersion(strings.Join(req.ExtraParams, ":")),
+	}
+
+	if req.Host != "" {
+		host, port, err := net.SplitHostPort(req.Host)
+		if err != nil {
+			host = req.Host
+		}
+
+		ep.Host = host
+		ep.Port, _ = strconv.Atoi(port)
+	}
+
+	return ep, nil
+}
+
+// reject sends the error to the client, and returns it.
+func (s *Server) reject(conn net.Conn, err error) error {
+	if _, werr := pktline.WriteError(conn, err); werr != nil {
+		return werr
+	}
+
+	return err
+}
+
+func sessionError(err error, pathname string) error {
+	if errors.Is(err, transport.ErrRepositoryNotFound) {
+		return fmt.Errorf("%w: %s", ErrNotExported, pathname)
+	}
+
+	return err
+}
+
+// timeoutConn extends the deadline of the connection on each read and write.
+type timeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *timeoutConn) Read(p []byte) (int, error) {
+	if err := c.Conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+
+	return c.Conn.Read(p)
+}
+
+func (c *timeoutConn) Write(p []byte) (int, error) {
+	if err := c.Conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+
+	return c.Conn.Write(p)
+}
+
+// daemonLoader loads the repositories exported by the server, trying the
+// path requested with the .git suffix too.
+type daemonLoader struct {
+	s *Server
+}
+
+func (l *daemonLoader) Load(ep *transport.Endpoint) (storer.Storer, error) {
+	loader := l.s.Loader
+	if loader == nil {
+		loader = server.DefaultLoader
+	}
+
+	st, err := loader.Load(ep)
+	if errors.Is(err, transport.ErrRepositoryNotFound) && !strings.HasSuffix(ep.Path, ".git") {
+		alt := *ep
+		alt.Path += ".git"
+		st, err = loader.Load(&alt)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !l.s.ExportAll && !isExported(st) {
+		return nil, transport.ErrRepositoryNotFound
+	}
+
+	return st, nil
+}
+
+// isExported returns whether the repository has the ExportOkFile, only
+// filesystem storages can be exported this way.
+func isExported(st storer.Storer) bool {
+	fs, ok := st.(*filesystem.Storage)
+	if !ok {
+		return false
+	}
+
+	_, err := fs.Filesystem().Stat(ExportOkFile)
+	return err == nil
+}
@@ -0,0 +1,208 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/protocol"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v5/plumbing/server"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/stretchr/testify/suite"
+
+	fixtures "github.com/go-git/go-git-fixtures/v4"
+)
+
+func TestServerSuite(t *testing.T) {
+	suite.Run(t, new(ServerSuite))
+}
+
+type ServerSuite struct {
+	suite.Suite
+
+	base   string
+	server *Server
+	served chan error
+	addr   string
+}
+
+func (s *ServerSuite) SetupTest() {
+	s.base = s.T().TempDir()
+	fs := fixtures.Basic().One().DotGit()
+	s.NoError(fixtures.EnsureIsBare(fs))
+	s.NoError(os.Rename(fs.Root(), filepath.Join(s.base, "basic.git")))
+}
+
+func (s *ServerSuite) TearDownTest() {
+	if s.server == nil {
+		return
+	}
+
+	s.NoError(s.server.Close())
+	s.ErrorIs(<-s.served, ErrServerClosed)
+	s.server = nil
+}
+
+// serve starts the server, with the repositories of the base path.
+func (s *ServerSuite) serve(srv *Server) {
+	if s.server != nil {
+		s.TearDownTest()
+	}
+
+	l, err := net.Listen("tcp", "localhost:0")
+	s.NoError(err)
+
+	srv.BasePath = filepath.ToSlash(s.base)
+	s.addr = l.Addr().String()
+	s.server = srv
+	s.served = make(chan error, 1)
+	go func() { s.served <- srv.Serve(l) }()
+}
+
+func (s *ServerSuite) endpoint(name string) *transport.Endpoint {
+	ep, err := transport.NewEndpoint(fmt.Sprintf("git://%s/%s", s.addr, name))
+	s.NoError(err)
+
+	return ep
+}
+
+func (s *ServerSuite) testUploadPack(ep *transport.Endpoint) {
+	r, err := DefaultClient.NewUploadPackSession(ep, nil)
+	s.NoError(err)
+	defer func() { s.NoError(r.Close()) }()
+
+	ar, err := r.AdvertisedReferences()
+	s.NoError(err)
+
+	head := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	s.Equal(head, ar.References["refs/heads/master"])
+
+	req := packp.NewUploadPackRequest()
+	req.Wants = append(req.Wants, head)
+
+	resp, err := r.UploadPack(context.Background(), req)
+	s.NoError(err)
+	defer func() { s.NoError(resp.Close()) }()
+
+	st := memory.NewStorage()
+	s.NoError(packfile.UpdateObjectStorage(st, resp))
+	s.Len(st.Objects, 28)
+}
+
+func (s *ServerSuite) TestUploadPack() {
+	s.serve(&Server{ExportAll: true})
+	s.testUploadPack(s.endpoint("basic.git"))
+}
+
+func (s *ServerSuite) TestUploadPackV2() {
+	s.serve(&Server{ExportAll: true})
+
+	ep := s.endpoint("basic")
+	ep.ProtocolVersion = protocol.V2
+	s.testUploadPack(ep)
+}
+
+func (s *ServerSuite) TestUploadPackExportOk() {
+	s.serve(&Server{})
+
+	r, err := DefaultClient.NewUploadPackSession(s.endpoint("basic.git"), nil)
+	s.NoError(err)
+	_, err = r.AdvertisedReferences()
+	s.ErrorIs(err, transport.ErrRepositoryNotFound)
+	s.NoError(r.Close())
+
+	f, err := os.Create(filepath.Join(s.base, "basic.git", ExportOkFile))
+	s.NoError(err)
+	s.NoError(f.Close())
+
+	s.testUploadPack(s.endpoint("basic.git"))
+}
+
+func (s *ServerSuite) TestUploadPackNotExists() {
+	s.serve(&Server{ExportAll: true})
+
+	r, err := DefaultClient.NewUploadPackSession(s.endpoint("../basic.git/../non-existent.git"), nil)
+	s.NoError(err)
+	defer func() { s.NoError(r.Close()) }()
+
+	_, err = r.AdvertisedReferences()
+	s.ErrorIs(err, transport.ErrRepositoryNotFound)
+}
+
+func (s *ServerSuite) TestReceivePack() {
+	s.serve(&Server{ExportAll: true})
+
+	r, err := DefaultClient.NewReceivePackSession(s.endpoint("basic.git"), nil)
+	s.NoError(err)
+	_, err = r.AdvertisedReferences()
+	s.ErrorContains(err, ErrServiceNotEnabled.Error())
+	s.NoError(r.Close())
+
+	s.serve(&Server{ExportAll: true, ReceivePack: true})
+	r, err = DefaultClient.NewReceivePackSession(s.endpoint("basic.git"), nil)
+	s.NoError(err)
+	defer func() { s.NoError(r.Close()) }()
+
+	ar, err := r.AdvertisedReferences()
+	s.NoError(err)
+
+	req := packp.NewReferenceUpdateRequest()
+	req.Capabilities.Set(capability.ReportStatus)
+	req.Commands = []*packp.Command{
+		{Name: "refs/heads/branch", Old: ar.References["refs/heads/branch"]},
+	}
+
+	rs, err := r.ReceivePack(context.Background(), req)
+	s.NoError(err)
+	s.NoError(rs.Error())
+}
+
+func (s *ServerSuite) TestReceivePackHooks() {
+	rejected := errors.New("rejected")
+	s.serve(&Server{ExportAll: true, ReceivePack: true, ReceivePackHooks: server.ReceivePackHooks{
+		Update: func(_ context.Context, _ storer.Storer, cmd *packp.Command) error {
+			return rejected
+		},
+	}})
+
+	r, err := DefaultClient.NewReceivePackSession(s.endpoint("basic.git"), nil)
+	s.NoError(err)
+	defer func() { s.NoError(r.Close()) }()
+
+	ar, err := r.AdvertisedReferences()
+	s.NoError(err)
+
+	req := packp.NewReferenceUpdateRequest()
+	req.Capabilities.Set(capability.ReportStatus)
+	req.Commands = []*packp.Command{
+		{Name: "refs/heads/branch", Old: ar.References["refs/heads/branch"]},
+	}
+
+	_, err = r.ReceivePack(context.Background(), req)
+	s.ErrorContains(err, rejected.Error())
+}
+
+func (s *ServerSuite) TestTimeout() {
+	s.serve(&Server{ExportAll: true, Timeout: 50 * time.Millisecond})
+
+	conn, err := net.Dial("tcp", s.addr)
+	s.NoError(err)
+	defer conn.Close()
+
+	// The connection of a silent client is closed.
+	s.NoError(conn.SetReadDeadline(time.Now().Add(5 * time.Second)))
+	_, err = conn.Read(make([]byte, 1))
+	s.ErrorIs(err, io.EOF)
+}
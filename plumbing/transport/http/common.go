@@ -2,6 +2,7 @@
 package http
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"crypto/tls"
@@ -16,6 +17,8 @@ import (
 	"sync"
 
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+	"github.com/go-git/go-git/v5/plumbing/protocol"
 	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/utils/ioutil"
@@ -42,9 +45,47 @@ func applyHeadersToRequest(req *http.Request, content *bytes.Buffer, host string
 	req.Header.Add("Content-Length", strconv.Itoa(content.Len()))
 }
 
-const infoRefsPath = "/info/refs"
+const (
+	infoRefsPath = "/info/refs"
+	// gitProtocolHeader is the header requesting a version of the protocol,
+	// as the GIT_PROTOCOL environment variable does.
+	gitProtocolHeader = "Git-Protocol"
+)
 
 func advertisedReferences(ctx context.Context, s *session, serviceName string) (ref *packp.AdvRefs, err error) {
+	ar, err := discoverVersion(ctx, s, serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.caps != nil {
+		ar, err = lsRefs(ctx, s, packp.NewLsRefsRequest())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Git 2.41+ returns a zero-id plus capabilities when an empty
+	// repository is being cloned. This skips the existing logic within
+	// advrefs_decode.decodeFirstHash, which expects a flush-pkt instead.
+	//
+	// This logic aligns with plumbing/transport/internal/common/common.go.
+	if ar.IsEmpty() &&
+		// Empty repositories are valid for git-receive-pack.
+		transport.ReceivePackServiceName != serviceName {
+		return nil, transport.ErrEmptyRemoteRepository
+	}
+
+	transport.FilterUnsupportedCapabilities(ar.Capabilities)
+	s.advRefs = ar
+
+	return ar, nil
+}
+
+// discoverVersion requests the advertised references of the service, finding
+// the version of the protocol spoken by the server. If it's the version 2,
+// its capabilities are stored in the session and no references are returned.
+func discoverVersion(ctx context.Context, s *session, serviceName string) (ref *packp.AdvRefs, err error) {
 	url := fmt.Sprintf(
 		"%s%s?service=%s",
 		s.endpoint.String(), infoRefsPath, serviceName,
@@ -55,8 +96,13 @@ func advertisedReferences(ctx context.Context, s *session, serviceName string) (
 		return nil, err
 	}
 
+	version := transport.VersionParameter(serviceName, s.endpoint)
 	s.ApplyAuthToRequest(req)
 	applyHeadersToRequest(req, nil, s.endpoint.Host, serviceName)
+	if version != "" {
+		req.Header.Set(gitProtocolHeader, version)
+	}
+
 	res, err := s.client.Do(req.WithContext(ctx))
 	if err != nil {
 		return nil, err
@@ -69,8 +115,30 @@ func advertisedReferences(ctx context.Context, s *session, serviceName string) (
 		return nil, err
 	}
 
+	if isDumbAdvertisement(res, serviceName) {
+		if serviceName == transport.ReceivePackServiceName {
+			return nil, ErrDumbPushNotSupported
+		}
+
+		s.dumb = true
+		return decodeDumbAdvRefs(ctx, s, res.Body)
+	}
+
+	body := bufio.NewReader(res.Body)
+	if version != "" {
+		caps, err := decodeCapabilityAdvertisement(body)
+		if err != nil {
+			return nil, err
+		}
+
+		if caps != nil {
+			s.caps = caps
+			return packp.NewAdvRefs(), nil
+		}
+	}
+
 	ar := packp.NewAdvRefs()
-	if err = ar.Decode(res.Body); err != nil {
+	if err = ar.Decode(body); err != nil {
 		if err == packp.ErrEmptyAdvRefs {
 			err = transport.ErrEmptyRemoteRepository
 		}
@@ -78,21 +146,41 @@ func advertisedReferences(ctx context.Context, s *session, serviceName string) (
 		return nil, err
 	}
 
-	// Git 2.41+ returns a zero-id plus capabilities when an empty
-	// repository is being cloned. This skips the existing logic within
-	// advrefs_decode.decodeFirstHash, which expects a flush-pkt instead.
-	//
-	// This logic aligns with plumbing/transport/internal/common/common.go.
-	if ar.IsEmpty() &&
-		// Empty repositories are valid for git-receive-pack.
-		transport.ReceivePackServiceName != serviceName {
-		return nil, transport.ErrEmptyRemoteRepository
+	return ar, nil
+}
+
+// decodeCapabilityAdvertisement decodes the capabilities sent by the server if
+// it speaks the version 2 of the protocol, skipping the smart HTTP prefix sent
+// by some servers. It returns nil otherwise, leaving the reader untouched.
+func decodeCapabilityAdvertisement(r *bufio.Reader) (*packp.CapabilityAdvertisement, error) {
+	_, p, err := pktline.PeekLine(r)
+	if err != nil {
+		return nil, nil
 	}
 
-	transport.FilterUnsupportedCapabilities(ar.Capabilities)
-	s.advRefs = ar
+	if bytes.HasPrefix(p, []byte("# service=")) {
+		// The prefix is followed by a flush-pkt, peeked along the first
+		// pkt-line of the advertisement.
+		n := pktline.LenSize + len(p) + pktline.LenSize
+		b, err := r.Peek(n + pktline.LenSize)
+		if err != nil || !bytes.HasPrefix(b[n:], []byte("000e")) {
+			return nil, nil
+		}
 
-	return ar, nil
+		_, _ = r.Discard(n)
+	}
+
+	v, err := transport.DiscoverVersion(r)
+	if err != nil || v != protocol.V2 {
+		return nil, nil
+	}
+
+	caps := packp.NewCapabilityAdvertisement()
+	if err := caps.Decode(r); err != nil {
+		return nil, err
+	}
+
+	return caps, nil
 }
 
 type client struct {
@@ -180,6 +268,11 @@ type session struct {
 	client   *http.Client
 	endpoint *transport.Endpoint
 	advRefs  *packp.AdvRefs
+	// caps are the capabilities advertised by the server if it speaks the
+	// version 2 of the protocol.
+	caps *packp.CapabilityAdvertisement
+	// dumb is set if the server speaks the dumb HTTP protocol.
+	dumb bool
 }
 
 func transportWithInsecureTLS(transport *http.Transport) {
@@ -0,0 +1,458 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v5/plumbing/format/objfile"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/go-git/go-git/v5/utils/ioutil"
+)
+
+var (
+	// ErrDumbShallowNotSupported is returned requesting a shallow fetch to a
+	// server speaking the dumb HTTP protocol.
+	ErrDumbShallowNotSupported = errors.New("dumb http transport does not support shallow capabilities")
+	// ErrDumbPushNotSupported is returned pushing to a server speaking the
+	// dumb HTTP protocol.
+	ErrDumbPushNotSupported = errors.New("dumb http transport does not support push")
+)
+
+const (
+	headPath      = "/HEAD"
+	infoPacksPath = "/objects/info/packs"
+)
+
+// isDumbAdvertisement returns whether the response to the advertisement of
+// the references of the service comes from a dumb server, which serves the
+// info/refs file as is instead of the advertisement of the service.
+func isDumbAdvertisement(res *http.Response, serviceName string) bool {
+	return res.Header.Get("Content-Type") != fmt.Sprintf("application/x-%s-advertisement", serviceName)
+}
+
+// decodeDumbAdvRefs decodes the info/refs file served by a dumb server,
+// resolving the HEAD of the repository with its HEAD file.
+func decodeDumbAdvRefs(ctx context.Context, s *session, r io.Reader) (*packp.AdvRefs, error) {
+	ar := packp.NewAdvRefs()
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+
+		hash, name, ok := strings.Cut(line, "\t")
+		if !ok || !plumbing.IsHash(hash) {
+			return nil, fmt.Errorf("invalid info/refs line: %q", line)
+		}
+
+		if peeled, ok := strings.CutSuffix(name, "^{}"); ok {
+			ar.Peeled[peeled] = plumbing.NewHash(hash)
+			continue
+		}
+
+		ar.References[name] = plumbing.NewHash(hash)
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	head, err := dumbHead(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case head == nil:
+	case head.Type() == plumbing.SymbolicReference:
+		if h, ok := ar.References[head.Target().String()]; ok {
+			ar.Head = &h
+			if err := ar.AddReference(head); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		h := head.Hash()
+		ar.Head = &h
+	}
+
+	return ar, nil
+}
+
+// dumbHead returns the HEAD of the repository served by a dumb server, nil if
+// the server doesn't serve it.
+func dumbHead(ctx context.Context, s *session) (*plumbing.Reference, error) {
+	res, err := s.get(ctx, headPath)
+	if errors.Is(err, transport.ErrRepositoryNotFound) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	target := strings.TrimSpace(string(b))
+	if ref, ok := strings.CutPrefix(target, "ref: "); ok {
+		return plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.ReferenceName(ref)), nil
+	}
+
+	if !plumbing.IsHash(target) {
+		return nil, fmt.Errorf("invalid HEAD: %q", target)
+	}
+
+	return plumbing.NewHashReference(plumbing.HEAD, plumbing.NewHash(target)), nil
+}
+
+// get requests a file of the repository served by a dumb server.
+func (s *session) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, s.endpoint.String()+path, nil)
+	if err != nil {
+		return nil, plumbing.NewPermanentError(err)
+	}
+
+	s.ApplyAuthToRequest(req)
+	applyHeadersToRequest(req, nil, s.endpoint.Host, transport.UploadPackServiceName)
+
+	res, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, plumbing.NewUnexpectedError(err)
+	}
+
+	if err := NewErr(res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// dumbPack is a packfile of the repository served by a dumb server.
+type dumbPack struct {
+	name    string
+	idx     *idxfile.MemoryIndex
+	fetched bool
+}
+
+// dumbFetcher fetches into a storage the objects of a repository served by a
+// dumb server, walking the objects reachable from the wanted ones, but not
+// from the ones the storage has. The objects are requested as loose objects,
+// the packfiles containing the objects not found are fetched whole.
+type dumbFetcher struct {
+	s      *session
+	storer storer.Storer
+	packs  []*dumbPack
+	listed bool
+	// fetched are the objects written to the storage by the fetcher, and
+	// walked the ones reachable from the wanted objects missing in it.
+	fetched map[plumbing.Hash]bool
+	walked  []plumbing.Hash
+}
+
+func newDumbFetcher(s *session, st storer.Storer) *dumbFetcher {
+	return &dumbFetcher{s: s, storer: st, fetched: make(map[plumbing.Hash]bool)}
+}
+
+// FetchObjects fetches into the given storage the objects reachable from the
+// wanted objects of the request, if the server speaks the dumb HTTP protocol.
+// The loose objects and the packfiles are written to the storage as fetched,
+// the objects it has aren't fetched. It returns false without fetching if the
+// server speaks the smart HTTP protocol, its objects are sent by UploadPack.
+func (s *upSession) FetchObjects(ctx context.Context, req *packp.UploadPackRequest, st storer.Storer) (bool, error) {
+	if !s.dumb {
+		return false, nil
+	}
+
+	if !req.Depth.IsZero() || len(req.Shallows) != 0 {
+		return true, ErrDumbShallowNotSupported
+	}
+
+	return true, newDumbFetcher(s.session, st).walk(ctx, req.Wants, req.Haves)
+}
+
+// uploadPackDumb responds the request with a packfile of the objects
+// reachable from the wanted objects, and not from the commits the client
+// has. The objects are fetched in memory to encode the packfile, FetchObjects
+// fetches them into the storage of the client instead.
+func (s *upSession) uploadPackDumb(ctx context.Context, req *packp.UploadPackRequest) (*packp.UploadPackResponse, error) {
+	if !req.Depth.IsZero() || len(req.Shallows) != 0 {
+		return nil, ErrDumbShallowNotSupported
+	}
+
+	st := memory.NewStorage()
+	f := newDumbFetcher(s.session, st)
+	if err := f.walk(ctx, req.Wants, req.Haves); err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := packfile.NewEncoder(pw, st, false).Encode(f.walked, 0)
+		pw.CloseWithError(err)
+	}()
+
+	return packp.NewUploadPackResponseWithPackfile(req, pr), nil
+}
+
+// walk fetches the objects reachable from wants, stopping at the commits in
+// haves and at the objects the storage has.
+func (f *dumbFetcher) walk(ctx context.Context, wants, haves []plumbing.Hash) error {
+	seen := make(map[plumbing.Hash]bool, len(haves))
+	for _, h := range haves {
+		seen[h] = true
+	}
+
+	pending := append([]plumbing.Hash(nil), wants...)
+	for len(pending) != 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if seen[h] {
+			continue
+		}
+
+		seen[h] = true
+		if !f.fetched[h] {
+			err := f.storer.HasEncodedObject(h)
+			if err == nil {
+				continue
+			}
+
+			if !errors.Is(err, plumbing.ErrObjectNotFound) {
+				return err
+			}
+
+			if err := f.fetch(ctx, h); err != nil {
+				return err
+			}
+		}
+
+		o, err := f.object(h)
+		if err != nil {
+			return err
+		}
+
+		f.walked = append(f.walked, h)
+		switch o := o.(type) {
+		case *object.Commit:
+			pending = append(pending, o.TreeHash)
+			pending = append(pending, o.ParentHashes...)
+		case *object.Tree:
+			for _, e := range o.Entries {
+				// The commits of the submodules belong to other
+				// repositories.
+				if e.Mode != filemode.Submodule {
+					pending = append(pending, e.Hash)
+				}
+			}
+		case *object.Tag:
+			pending = append(pending, o.Target)
+		}
+	}
+
+	return nil
+}
+
+// fetch fetches the object with the given hash, as a loose object or else
+// with the packfile containing it.
+func (f *dumbFetcher) fetch(ctx context.Context, h plumbing.Hash) error {
+	err := f.fetchLoose(ctx, h)
+	if errors.Is(err, transport.ErrRepositoryNotFound) {
+		err = f.fetchPacked(ctx, h)
+	}
+
+	return err
+}
+
+// object returns the object with the given hash from the storage.
+func (f *dumbFetcher) object(h plumbing.Hash) (object.Object, error) {
+	o, err := f.storer.EncodedObject(plumbing.AnyObject, h)
+	if err != nil {
+		return nil, err
+	}
+
+	return object.DecodeObject(f.storer, o)
+}
+
+// fetchLoose fetches the loose object with the given hash, returning
+// transport.ErrRepositoryNotFound if it isn't found.
+func (f *dumbFetcher) fetchLoose(ctx context.Context, h plumbing.Hash) (err error) {
+	hex := h.String()
+	res, err := f.s.get(ctx, fmt.Sprintf("/objects/%s/%s", hex[:2], hex[2:]))
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(res.Body, &err)
+	r, err := objfile.NewReader(res.Body)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(r, &err)
+	t, size, err := r.Header()
+	if err != nil {
+		return err
+	}
+
+	o := f.storer.NewEncodedObject()
+	o.SetType(t)
+	o.SetSize(size)
+
+	w, err := o.Writer()
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	if r.Hash() != h {
+		return fmt.Errorf("object %s: hash mismatch, got %s", h, r.Hash())
+	}
+
+	if _, err = f.storer.SetEncodedObject(o); err != nil {
+		return err
+	}
+
+	f.fetched[h] = true
+	return nil
+}
+
+// fetchPacked fetches the packfile containing the object with the given
+// hash.
+func (f *dumbFetcher) fetchPacked(ctx context.Context, h plumbing.Hash) error {
+	if err := f.listPacks(ctx); err != nil {
+		return err
+	}
+
+	for _, p := range f.packs {
+		if p.fetched {
+			continue
+		}
+
+		if p.idx == nil {
+			if err := f.fetchIndex(ctx, p); err != nil {
+				return err
+			}
+		}
+
+		ok, err := p.idx.Contains(h)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			return f.fetchPack(ctx, p)
+		}
+	}
+
+	return fmt.Errorf("%w: %s", plumbing.ErrObjectNotFound, h)
+}
+
+// listPacks lists the packfiles of the objects/info/packs file, once.
+func (f *dumbFetcher) listPacks(ctx context.Context) (err error) {
+	if f.listed {
+		return nil
+	}
+
+	res, err := f.s.get(ctx, infoPacksPath)
+	if errors.Is(err, transport.ErrRepositoryNotFound) {
+		f.listed = true
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(res.Body, &err)
+	sc := bufio.NewScanner(res.Body)
+	for sc.Scan() {
+		name, ok := strings.CutPrefix(sc.Text(), "P ")
+		if !ok || !strings.HasSuffix(name, ".pack") {
+			continue
+		}
+
+		f.packs = append(f.packs, &dumbPack{name: strings.TrimSuffix(name, ".pack")})
+	}
+
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	f.listed = true
+	return nil
+}
+
+func (f *dumbFetcher) fetchIndex(ctx context.Context, p *dumbPack) (err error) {
+	res, err := f.s.get(ctx, fmt.Sprintf("/objects/pack/%s.idx", p.name))
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(res.Body, &err)
+	idx := idxfile.NewMemoryIndex()
+	if err := idxfile.NewDecoder(res.Body).Decode(idx); err != nil {
+		return err
+	}
+
+	p.idx = idx
+	return nil
+}
+
+func (f *dumbFetcher) fetchPack(ctx context.Context, p *dumbPack) (err error) {
+	res, err := f.s.get(ctx, fmt.Sprintf("/objects/pack/%s.pack", p.name))
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(res.Body, &err)
+	if err := packfile.UpdateObjectStorage(f.storer, res.Body); err != nil {
+		return err
+	}
+
+	entries, err := p.idx.Entries()
+	if err != nil {
+		return err
+	}
+
+	defer entries.Close()
+	for {
+		e, err := entries.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		f.fetched[e.Hash] = true
+	}
+
+	p.fetched = true
+	return nil
+}
@@ -0,0 +1,270 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/protocol"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/go-git/go-git/v5/utils/ioutil"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	fixtures "github.com/go-git/go-git-fixtures/v4"
+)
+
+func TestDumbSuite(t *testing.T) {
+	suite.Run(t, new(DumbSuite))
+}
+
+type DumbSuite struct {
+	suite.Suite
+	server  *httptest.Server
+	initial plumbing.Hash
+	head    plumbing.Hash
+
+	mu       sync.Mutex
+	requests []string
+}
+
+// SetupTest serves the basic fixture as a static file host, with a loose
+// commit on top of its packfile.
+func (s *DumbSuite) SetupTest() {
+	s.initial = plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+
+	fs := fixtures.Basic().One().DotGit()
+	st := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+
+	parent, err := object.GetCommit(st, s.initial)
+	s.NoError(err)
+
+	sig := object.Signature{Name: "foo", Email: "foo@foo.foo", When: time.Unix(1700000000, 0).UTC()}
+	commit := &object.Commit{
+		Author:       sig,
+		Committer:    sig,
+		Message:      "loose\n",
+		TreeHash:     parent.TreeHash,
+		ParentHashes: []plumbing.Hash{s.initial},
+	}
+
+	o := st.NewEncodedObject()
+	s.NoError(commit.Encode(o))
+	s.head, err = st.SetEncodedObject(o)
+	s.NoError(err)
+	s.NoError(st.SetReference(plumbing.NewHashReference(plumbing.Master, s.head)))
+	s.NoError(updateServerInfo(st, fs))
+
+	files := http.FileServer(http.Dir(fs.Root()))
+	s.requests = nil
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.URL.Path)
+		s.mu.Unlock()
+
+		files.ServeHTTP(w, r)
+	}))
+}
+
+func (s *DumbSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *DumbSuite) endpoint(v protocol.Version) *transport.Endpoint {
+	ep, err := transport.NewEndpoint(s.server.URL)
+	s.NoError(err)
+	ep.ProtocolVersion = v
+
+	return ep
+}
+
+func (s *DumbSuite) testAdvertisedReferences(v protocol.Version) {
+	r, err := DefaultClient.NewUploadPackSession(s.endpoint(v), nil)
+	s.NoError(err)
+	defer func() { s.NoError(r.Close()) }()
+
+	ar, err := r.AdvertisedReferences()
+	s.NoError(err)
+	s.Equal(s.head, ar.References["refs/heads/master"])
+	s.Equal(plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881"), ar.References["refs/remotes/origin/branch"])
+	s.Equal(&s.head, ar.Head)
+	s.Equal([]string{"HEAD:refs/heads/master"}, ar.Capabilities.Get(capability.SymRef))
+}
+
+func (s *DumbSuite) TestAdvertisedReferences() {
+	s.testAdvertisedReferences(protocol.V0)
+}
+
+func (s *DumbSuite) TestAdvertisedReferencesV2() {
+	s.testAdvertisedReferences(protocol.V2)
+}
+
+func (s *DumbSuite) uploadPack(req *packp.UploadPackRequest) *memory.Storage {
+	r, err := DefaultClient.NewUploadPackSession(s.endpoint(protocol.V0), nil)
+	s.NoError(err)
+	defer func() { s.NoError(r.Close()) }()
+
+	_, err = r.AdvertisedReferences()
+	s.NoError(err)
+
+	resp, err := r.UploadPack(context.Background(), req)
+	s.NoError(err)
+	defer func() { s.NoError(resp.Close()) }()
+
+	st := memory.NewStorage()
+	s.NoError(packfile.UpdateObjectStorage(st, resp))
+	return st
+}
+
+func (s *DumbSuite) TestUploadPack() {
+	req := packp.NewUploadPackRequest()
+	req.Wants = append(req.Wants, s.head)
+
+	st := s.uploadPack(req)
+	s.Len(st.Objects, 29)
+	s.Contains(st.Objects, s.head)
+	s.Contains(st.Objects, s.initial)
+}
+
+func (s *DumbSuite) TestUploadPackHaves() {
+	req := packp.NewUploadPackRequest()
+	req.Wants = append(req.Wants, s.head)
+	req.Haves = append(req.Haves, s.initial)
+
+	st := s.uploadPack(req)
+	s.Contains(st.Objects, s.head)
+	s.NotContains(st.Objects, s.initial)
+	s.Less(len(st.Objects), 29)
+}
+
+func (s *DumbSuite) fetchObjects(st storer.Storer, wants ...plumbing.Hash) {
+	r, err := DefaultClient.NewUploadPackSession(s.endpoint(protocol.V0), nil)
+	s.NoError(err)
+	defer func() { s.NoError(r.Close()) }()
+
+	_, err = r.AdvertisedReferences()
+	s.NoError(err)
+
+	req := packp.NewUploadPackRequest()
+	req.Wants = append(req.Wants, wants...)
+
+	fetched, err := r.(*upSession).FetchObjects(context.Background(), req, st)
+	s.NoError(err)
+	s.True(fetched)
+}
+
+func (s *DumbSuite) TestFetchObjects() {
+	st := filesystem.NewStorage(memfs.New(), cache.NewObjectLRUDefault())
+	s.fetchObjects(st, s.head)
+
+	packs, err := st.ObjectPacks()
+	s.NoError(err)
+	s.Len(packs, 1)
+
+	s.NoError(st.HasEncodedObject(s.head))
+	s.NoError(st.HasEncodedObject(s.initial))
+}
+
+func (s *DumbSuite) TestFetchObjectsIncremental() {
+	st := filesystem.NewStorage(memfs.New(), cache.NewObjectLRUDefault())
+	s.fetchObjects(st, s.initial)
+	s.NoError(st.HasEncodedObject(s.initial))
+	s.ErrorIs(st.HasEncodedObject(s.head), plumbing.ErrObjectNotFound)
+
+	s.mu.Lock()
+	s.requests = nil
+	s.mu.Unlock()
+
+	s.fetchObjects(st, s.head)
+	s.NoError(st.HasEncodedObject(s.head))
+
+	// Only the loose commit is fetched, its tree and parent are in the
+	// storage.
+	hex := s.head.String()
+	s.Equal([]string{"/info/refs", "/HEAD", "/objects/" + hex[:2] + "/" + hex[2:]}, s.requests)
+}
+
+func (s *DumbSuite) TestUploadPackShallow() {
+	r, err := DefaultClient.NewUploadPackSession(s.endpoint(protocol.V0), nil)
+	s.NoError(err)
+	defer func() { s.NoError(r.Close()) }()
+
+	_, err = r.AdvertisedReferences()
+	s.NoError(err)
+
+	req := packp.NewUploadPackRequest()
+	req.Wants = append(req.Wants, s.head)
+	req.Depth = packp.DepthCommits(1)
+
+	_, err = r.UploadPack(context.Background(), req)
+	s.ErrorIs(err, ErrDumbShallowNotSupported)
+}
+
+func (s *DumbSuite) TestReceivePack() {
+	r, err := DefaultClient.NewReceivePackSession(s.endpoint(protocol.V0), nil)
+	s.NoError(err)
+	defer func() { s.NoError(r.Close()) }()
+
+	_, err = r.AdvertisedReferences()
+	s.ErrorIs(err, ErrDumbPushNotSupported)
+}
+
+// updateServerInfo writes the info/refs and objects/info/packs files of the
+// repository, as git update-server-info does.
+func updateServerInfo(st *filesystem.Storage, fs billy.Filesystem) (err error) {
+	refs, err := fs.Create("info/refs")
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(refs, &err)
+	iter, err := st.IterReferences()
+	if err != nil {
+		return err
+	}
+
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+
+		_, err := fmt.Fprintf(refs, "%s\t%s\n", ref.Hash(), ref.Name())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	packs, err := st.ObjectPacks()
+	if err != nil {
+		return err
+	}
+
+	info, err := fs.Create("objects/info/packs")
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(info, &err)
+	for _, h := range packs {
+		if _, err := fmt.Fprintf(info, "P pack-%s.pack\n", h); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
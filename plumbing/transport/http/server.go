@@ -0,0 +1,295 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+	"github.com/go-git/go-git/v5/plumbing/protocol"
+	"github.com/go-git/go-git/v5/plumbing/server"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// DefaultMaxRequestBuffer is the size limit of the git-upload-pack requests,
+// 10 MiB as git http-backend does.
+const DefaultMaxRequestBuffer = 10 << 20
+
+type handler struct {
+	srv              transport.Transport
+	receivePack      bool
+	maxRequestBuffer int64
+	maxInputSize     int64
+}
+
+// HandlerOptions are the options of the handlers returned by
+// NewHandlerWithOptions.
+type HandlerOptions struct {
+	// ReceivePack enables the git-receive-pack service, as the
+	// http.receivepack option of git http-backend does. Otherwise the
+	// pushes are refused with a 403 Forbidden.
+	ReceivePack bool
+	// ReceivePackHooks are run on the git-receive-pack requests. The
+	// context of the request, with the values set by the middlewares
+	// wrapping the handler, is passed to them.
+	ReceivePackHooks server.ReceivePackHooks
+	// MaxRequestBuffer limits the size of the git-upload-pack requests,
+	// once decompressed, as the GIT_HTTP_MAX_REQUEST_BUFFER variable of
+	// git http-backend does. DefaultMaxRequestBuffer if zero.
+	MaxRequestBuffer int64
+	// MaxInputSize limits the size of the git-receive-pack requests, with
+	// the packfile pushed, once decompressed, as the receive.maxInputSize
+	// option of git does. The size isn't limited if zero.
+	MaxInputSize int64
+}
+
+// NewHandler returns an http.Handler serving the repositories of the loader
+// over the smart HTTP protocol: the references advertised on GET
+// <repository>/info/refs?service=<service>, and the git-upload-pack and
+// git-receive-pack requests on POST <repository>/<service>. The version 2 of
+// the protocol is served to the clients requesting it in the Git-Protocol
+// header. The git-receive-pack service isn't enabled, see
+// NewHandlerWithOptions.
+//
+// The repositories are loaded from an endpoint with the scheme and host of
+// the request, and the path of the repository. Authentication and
+// authorization are left to the middlewares wrapping the handler.
+func NewHandler(loader server.Loader) http.Handler {
+	return NewHandlerWithOptions(loader, HandlerOptions{})
+}
+
+// NewHandlerWithOptions returns an http.Handler as NewHandler does, with the
+// given options. As with NewHandler, the requests aren't authenticated: the
+// middlewares wrapping the handler must authenticate them, and may authorize
+// the pushes with the ReceivePackHooks.
+func NewHandlerWithOptions(loader server.Loader, opts HandlerOptions) http.Handler {
+	maxRequestBuffer := opts.MaxRequestBuffer
+	if maxRequestBuffer == 0 {
+		maxRequestBuffer = DefaultMaxRequestBuffer
+	}
+
+	return &handler{
+		srv:              server.NewServerWithHooks(loader, opts.ReceivePackHooks),
+		receivePack:      opts.ReceivePack,
+		maxRequestBuffer: maxRequestBuffer,
+		maxInputSize:     opts.MaxInputSize,
+	}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch p := r.URL.Path; {
+	case strings.HasSuffix(p, infoRefsPath):
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			h.error(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		h.serveInfoRefs(w, r, strings.TrimSuffix(p, infoRefsPath))
+	case strings.HasSuffix(p, "/"+transport.UploadPackServiceName),
+		strings.HasSuffix(p, "/"+transport.ReceivePackServiceName):
+		if r.Method != http.MethodPost {
+			h.error(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		service := path.Base(p)
+		h.serveService(w, r, strings.TrimSuffix(p, "/"+service), service)
+	default:
+		h.error(w, http.StatusNotFound)
+	}
+}
+
+func (h *handler) serveInfoRefs(w http.ResponseWriter, r *http.Request, repo string) {
+	service := r.URL.Query().Get("service")
+	if !h.isEnabled(service) {
+		// The dumb protocol isn't served.
+		h.error(w, http.StatusForbidden)
+		return
+	}
+
+	ep, err := h.endpoint(r, repo, service)
+	if err != nil {
+		h.error(w, http.StatusBadRequest)
+		return
+	}
+
+	sess, err := h.newSession(ep, service)
+	if err != nil {
+		h.sessionError(w, err)
+		return
+	}
+	defer sess.Close()
+
+	var buf bytes.Buffer
+	if ep.ProtocolVersion != protocol.V2 {
+		if err := encodeServiceAdvertisement(&buf, service); err != nil {
+			h.error(w, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := server.AdvertiseReferences(r.Context(), &buf, sess); err != nil {
+		h.sessionError(w, err)
+		return
+	}
+
+	noCache(w)
+	w.Header().Set("Content-Type", fmt.Sprintf("application/x-%s-advertisement", service))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
+
+func (h *handler) serveService(w http.ResponseWriter, r *http.Request, repo, service string) {
+	if !h.isEnabled(service) {
+		h.error(w, http.StatusForbidden)
+		return
+	}
+
+	if ct := r.Header.Get("Content-Type"); ct != fmt.Sprintf("application/x-%s-request", service) {
+		h.error(w, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	ep, err := h.endpoint(r, repo, service)
+	if err != nil {
+		h.error(w, http.StatusBadRequest)
+		return
+	}
+
+	body := r.Body
+	switch r.Header.Get("Content-Encoding") {
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			h.error(w, http.StatusBadRequest)
+			return
+		}
+
+		defer zr.Close()
+		body = zr
+	case "", "identity":
+	default:
+		h.error(w, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	limit := h.maxRequestBuffer
+	if service == transport.ReceivePackServiceName {
+		limit = h.maxInputSize
+	}
+
+	if limit > 0 {
+		body = http.MaxBytesReader(w, body, limit)
+	}
+
+	sess, err := h.newSession(ep, service)
+	if err != nil {
+		h.sessionError(w, err)
+		return
+	}
+	defer sess.Close()
+
+	noCache(w)
+	w.Header().Set("Content-Type", fmt.Sprintf("application/x-%s-result", service))
+
+	rw := &responseWriter{ResponseWriter: w}
+	if s, ok := sess.(transport.UploadPackSession); ok {
+		err = server.ServeUploadPackRequest(r.Context(), rw, body, s)
+	} else {
+		err = server.ServeReceivePackRequest(r.Context(), rw, body, sess.(transport.ReceivePackSession))
+	}
+
+	// Once the response is started, the client detects the errors reading
+	// it.
+	if err != nil && !rw.written {
+		w.Header().Del("Content-Type")
+
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			h.error(w, http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		h.error(w, http.StatusInternalServerError)
+	}
+}
+
+// endpoint returns the endpoint of the repository requested, with the
+// version of the protocol of the Git-Protocol header.
+func (h *handler) endpoint(r *http.Request, repo, service string) (*transport.Endpoint, error) {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	ep, err := transport.NewEndpoint(fmt.Sprintf("%s://%s%s", scheme, r.Host, path.Clean("/"+repo)))
+	if err != nil {
+		return nil, err
+	}
+
+	if service == transport.UploadPackServiceName {
+		ep.ProtocolVersion = transport.ProtocolVersion(r.Header.Get(gitProtocolHeader))
+	}
+
+	return ep, nil
+}
+
+func (h *handler) newSession(ep *transport.Endpoint, service string) (transport.Session, error) {
+	if service == transport.UploadPackServiceName {
+		return h.srv.NewUploadPackSession(ep, nil)
+	}
+
+	return h.srv.NewReceivePackSession(ep, nil)
+}
+
+func (h *handler) sessionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, transport.ErrRepositoryNotFound) {
+		h.error(w, http.StatusNotFound)
+		return
+	}
+
+	h.error(w, http.StatusInternalServerError)
+}
+
+func (h *handler) error(w http.ResponseWriter, code int) {
+	noCache(w)
+	http.Error(w, http.StatusText(code), code)
+}
+
+// isEnabled returns whether the service is served.
+func (h *handler) isEnabled(service string) bool {
+	return service == transport.UploadPackServiceName ||
+		(h.receivePack && service == transport.ReceivePackServiceName)
+}
+
+// encodeServiceAdvertisement writes the service line preceding the
+// references advertised on the version 0 of the protocol.
+func encodeServiceAdvertisement(w io.Writer, service string) error {
+	if _, err := pktline.Writef(w, "# service=%s\n", service); err != nil {
+		return err
+	}
+
+	return pktline.WriteFlush(w)
+}
+
+func noCache(w http.ResponseWriter) {
+	w.Header().Set("Expires", "Fri, 01 Jan 1980 00:00:00 GMT")
+	w.Header().Set("Pragma", "no-cache")
+	w.Header().Set("Cache-Control", "no-cache, max-age=0, must-revalidate")
+}
+
+// responseWriter records whether the response was started.
+type responseWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(p)
+}
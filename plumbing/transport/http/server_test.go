@@ -0,0 +1,298 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/protocol"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v5/plumbing/server"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/stretchr/testify/suite"
+
+	fixtures "github.com/go-git/go-git-fixtures/v4"
+)
+
+func TestServerSuite(t *testing.T) {
+	suite.Run(t, new(ServerSuite))
+}
+
+type ServerSuite struct {
+	suite.Suite
+	server  *httptest.Server
+	storer  storer.Storer
+	url     string
+	initial plumbing.Hash
+}
+
+func (s *ServerSuite) SetupTest() {
+	s.initial = plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	s.storer = filesystem.NewStorage(fixtures.Basic().One().DotGit(), cache.NewObjectLRUDefault())
+
+	loader := server.MapLoader{}
+	s.server = httptest.NewServer(NewHandlerWithOptions(loader, HandlerOptions{ReceivePack: true}))
+	s.url = s.server.URL + "/basic.git"
+
+	ep, err := transport.NewEndpoint(s.url)
+	s.NoError(err)
+	loader[ep.String()] = s.storer
+}
+
+func (s *ServerSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *ServerSuite) endpoint(v protocol.Version) *transport.Endpoint {
+	ep, err := transport.NewEndpoint(s.url)
+	s.NoError(err)
+	ep.ProtocolVersion = v
+
+	return ep
+}
+
+func (s *ServerSuite) testUploadPack(v protocol.Version) {
+	r, err := DefaultClient.NewUploadPackSession(s.endpoint(v), nil)
+	s.NoError(err)
+	defer func() { s.NoError(r.Close()) }()
+
+	ar, err := r.AdvertisedReferences()
+	s.NoError(err)
+	s.Equal(s.initial, ar.References["refs/heads/master"])
+
+	req := packp.NewUploadPackRequest()
+	req.Wants = append(req.Wants, s.initial)
+
+	resp, err := r.UploadPack(context.Background(), req)
+	s.NoError(err)
+	defer func() { s.NoError(resp.Close()) }()
+
+	st := memory.NewStorage()
+	s.NoError(packfile.UpdateObjectStorage(st, resp))
+	s.Len(st.Objects, 28)
+}
+
+func (s *ServerSuite) TestUploadPack() {
+	s.testUploadPack(protocol.V0)
+}
+
+func (s *ServerSuite) TestUploadPackV2() {
+	s.testUploadPack(protocol.V2)
+}
+
+func (s *ServerSuite) TestReceivePack() {
+	r, err := DefaultClient.NewReceivePackSession(s.endpoint(protocol.V0), nil)
+	s.NoError(err)
+	defer func() { s.NoError(r.Close()) }()
+
+	ar, err := r.AdvertisedReferences()
+	s.NoError(err)
+	s.True(ar.Capabilities.Supports(capability.ReportStatus))
+
+	req := packp.NewReferenceUpdateRequest()
+	req.Capabilities.Set(capability.ReportStatus)
+	req.Commands = []*packp.Command{
+		{Name: "refs/heads/branch", Old: ar.References["refs/heads/branch"]},
+	}
+
+	rs, err := r.ReceivePack(context.Background(), req)
+	s.NoError(err)
+	s.NoError(rs.Error())
+
+	_, err = s.storer.Reference("refs/heads/branch")
+	s.ErrorIs(err, plumbing.ErrReferenceNotFound)
+}
+
+func (s *ServerSuite) TestReceivePackNotEnabled() {
+	loader := server.MapLoader{}
+	srv := httptest.NewServer(NewHandler(loader))
+	defer srv.Close()
+
+	ep, err := transport.NewEndpoint(srv.URL + "/basic.git")
+	s.NoError(err)
+	loader[ep.String()] = s.storer
+
+	res, err := srv.Client().Get(srv.URL + "/basic.git/info/refs?service=git-receive-pack")
+	s.NoError(err)
+	res.Body.Close()
+	s.Equal(http.StatusForbidden, res.StatusCode)
+
+	res, err = srv.Client().Post(
+		srv.URL+"/basic.git/git-receive-pack",
+		"application/x-git-receive-pack-request",
+		bytes.NewReader([]byte("0000")),
+	)
+	s.NoError(err)
+	res.Body.Close()
+	s.Equal(http.StatusForbidden, res.StatusCode)
+
+	res, err = srv.Client().Get(srv.URL + "/basic.git/info/refs?service=git-upload-pack")
+	s.NoError(err)
+	res.Body.Close()
+	s.Equal(http.StatusOK, res.StatusCode)
+}
+
+func (s *ServerSuite) get(path string, header http.Header) *http.Response {
+	req, err := http.NewRequest(http.MethodGet, s.url+path, nil)
+	s.NoError(err)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	res, err := s.server.Client().Do(req)
+	s.NoError(err)
+	return res
+}
+
+func (s *ServerSuite) post(service string, body []byte, header http.Header) (*http.Response, []byte) {
+	req, err := http.NewRequest(http.MethodPost, s.url+"/"+service, bytes.NewReader(body))
+	s.NoError(err)
+	req.Header.Set("Content-Type", "application/x-"+service+"-request")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	res, err := s.server.Client().Do(req)
+	s.NoError(err)
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	s.NoError(err)
+	return res, b
+}
+
+func (s *ServerSuite) TestInfoRefs() {
+	res := s.get("/info/refs?service=git-upload-pack", nil)
+	defer res.Body.Close()
+
+	s.Equal(http.StatusOK, res.StatusCode)
+	s.Equal("application/x-git-upload-pack-advertisement", res.Header.Get("Content-Type"))
+
+	b, err := io.ReadAll(res.Body)
+	s.NoError(err)
+	s.True(bytes.HasPrefix(b, []byte("001e# service=git-upload-pack\n0000")))
+}
+
+func (s *ServerSuite) TestInfoRefsV2() {
+	res := s.get("/info/refs?service=git-upload-pack", http.Header{gitProtocolHeader: {"version=2"}})
+	defer res.Body.Close()
+
+	s.Equal(http.StatusOK, res.StatusCode)
+
+	b, err := io.ReadAll(res.Body)
+	s.NoError(err)
+	s.True(bytes.HasPrefix(b, []byte("000eversion 2\n")))
+}
+
+func (s *ServerSuite) TestInfoRefsErrors() {
+	res := s.get("/info/refs", nil)
+	res.Body.Close()
+	s.Equal(http.StatusForbidden, res.StatusCode)
+
+	res, err := s.server.Client().Get(s.server.URL + "/non-existent.git/info/refs?service=git-upload-pack")
+	s.NoError(err)
+	res.Body.Close()
+	s.Equal(http.StatusNotFound, res.StatusCode)
+}
+
+func (s *ServerSuite) TestUploadPackGzip() {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := io.WriteString(zw, "0032want 6ecf0ef2c2dffb796033e5a02219af86ec6584e5\n00000009done\n")
+	s.NoError(err)
+	s.NoError(zw.Close())
+
+	res, b := s.post(transport.UploadPackServiceName, buf.Bytes(), http.Header{"Content-Encoding": {"gzip"}})
+	s.Equal(http.StatusOK, res.StatusCode)
+	s.Equal("application/x-git-upload-pack-result", res.Header.Get("Content-Type"))
+	s.True(bytes.HasPrefix(b, []byte("0008NAK\nPACK")))
+}
+
+func (s *ServerSuite) TestUploadPackNegotiation() {
+	// A round of the negotiation without done is answered without the
+	// packfile.
+	res, b := s.post(transport.UploadPackServiceName, []byte(
+		"0032want 6ecf0ef2c2dffb796033e5a02219af86ec6584e5\n0000"+
+			"0032have 0000000000000000000000000000000000000001\n"+
+			"0032have 918c48b83bd081e863dbe1b80f8998f058cd8294\n0000",
+	), nil)
+	s.Equal(http.StatusOK, res.StatusCode)
+	s.Equal("0031ACK 918c48b83bd081e863dbe1b80f8998f058cd8294\n", string(b))
+
+	res, b = s.post(transport.UploadPackServiceName, []byte(
+		"0032want 6ecf0ef2c2dffb796033e5a02219af86ec6584e5\n0000"+
+			"0032have 0000000000000000000000000000000000000001\n0000",
+	), nil)
+	s.Equal(http.StatusOK, res.StatusCode)
+	s.Equal("0008NAK\n", string(b))
+}
+
+func (s *ServerSuite) TestUploadPackRequestTooLarge() {
+	loader := server.MapLoader{}
+	srv := httptest.NewServer(NewHandlerWithOptions(loader, HandlerOptions{MaxRequestBuffer: 128}))
+	defer srv.Close()
+
+	ep, err := transport.NewEndpoint(srv.URL + "/basic.git")
+	s.NoError(err)
+	loader[ep.String()] = s.storer
+
+	body := "0032want 6ecf0ef2c2dffb796033e5a02219af86ec6584e5\n0000" +
+		strings.Repeat("0032have 918c48b83bd081e863dbe1b80f8998f058cd8294\n", 4) + "0000"
+
+	res, err := srv.Client().Post(
+		srv.URL+"/basic.git/git-upload-pack",
+		"application/x-git-upload-pack-request",
+		strings.NewReader(body),
+	)
+	s.NoError(err)
+	res.Body.Close()
+	s.Equal(http.StatusRequestEntityTooLarge, res.StatusCode)
+}
+
+// git runs git in the directory, returning its output. The test is skipped if
+// git isn't installed.
+func (s *ServerSuite) git(dir string, args ...string) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		s.T().Skip("git not found")
+	}
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	s.Require().NoError(err, string(out))
+	return string(out)
+}
+
+func (s *ServerSuite) TestCloneShallowV0() {
+	dir := s.T().TempDir()
+	s.git(dir, "-c", "protocol.version=0", "clone", "-q", "--depth=2", s.url, "basic")
+	s.Equal("2\n", s.git(filepath.Join(dir, "basic"), "rev-list", "--count", "HEAD"))
+
+	s.git(filepath.Join(dir, "basic"), "-c", "protocol.version=0", "fetch", "-q", "--deepen=2")
+	s.Equal("4\n", s.git(filepath.Join(dir, "basic"), "rev-list", "--count", "HEAD"))
+}
+
+func (s *ServerSuite) TestClonePartialV0() {
+	dir := s.T().TempDir()
+	s.git(dir, "-c", "protocol.version=0", "clone", "-q", "--filter=blob:none", s.url, "basic")
+
+	// The blobs of the files checked out are fetched lazily.
+	content, err := os.ReadFile(filepath.Join(dir, "basic", "CHANGELOG"))
+	s.NoError(err)
+	s.Equal("Initial changelog\n", string(content))
+}
@@ -45,15 +45,29 @@ func (s *upSession) UploadPack(
 		return nil, transport.ErrEmptyUploadPackRequest
 	}
 
+	// The capabilities of the request aren't validated, dumb servers don't
+	// advertise any.
+	if s.dumb {
+		return s.uploadPackDumb(ctx, req)
+	}
+
 	if err := req.Validate(); err != nil {
 		return nil, err
 	}
 
+	if err := s.discoverVersion(ctx); err != nil {
+		return nil, err
+	}
+
 	url := fmt.Sprintf(
 		"%s/%s",
 		s.endpoint.String(), transport.UploadPackServiceName,
 	)
 
+	if s.caps != nil {
+		return s.uploadPackV2(ctx, url, req)
+	}
+
 	content, err := uploadPackRequestToReader(req)
 	if err != nil {
 		return nil, err
@@ -77,6 +91,106 @@ func (s *upSession) UploadPack(
 	return transport.DecodeUploadPackResponse(rc, req)
 }
 
+// LsRefs lists the references of the server matching the request. The
+// references are filtered by the server if it speaks the version 2 of the
+// protocol, otherwise the advertised references are filtered.
+func (s *upSession) LsRefs(ctx context.Context, req *packp.LsRefsRequest) (*packp.AdvRefs, error) {
+	if err := s.discoverVersion(ctx); err != nil {
+		return nil, err
+	}
+
+	if s.caps != nil {
+		return lsRefs(ctx, s.session, req)
+	}
+
+	if len(req.ServerOptions) != 0 {
+		return nil, transport.ErrServerOptionsNotSupported
+	}
+
+	ar := s.advRefs
+	if ar == nil {
+		var err error
+		ar, err = s.AdvertisedReferencesContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return req.Filter(ar), nil
+}
+
+// discoverVersion finds the version of the protocol spoken by the server, if
+// the version 2 was requested and it's not known yet.
+func (s *upSession) discoverVersion(ctx context.Context) error {
+	if s.caps != nil || s.advRefs != nil ||
+		transport.VersionParameter(transport.UploadPackServiceName, s.endpoint) == "" {
+		return nil
+	}
+
+	ar, err := discoverVersion(ctx, s.session, transport.UploadPackServiceName)
+	if err != nil {
+		return err
+	}
+
+	if s.caps == nil {
+		transport.FilterUnsupportedCapabilities(ar.Capabilities)
+		s.advRefs = ar
+	}
+
+	return nil
+}
+
+func (s *upSession) uploadPackV2(
+	ctx context.Context, url string, req *packp.UploadPackRequest,
+) (*packp.UploadPackResponse, error) {
+	content := bytes.NewBuffer(nil)
+	if err := req.EncodeV2(content); err != nil {
+		return nil, fmt.Errorf("sending fetch command: %s", err)
+	}
+
+	res, err := s.doRequest(ctx, http.MethodPost, url, content)
+	if err != nil {
+		return nil, err
+	}
+
+	return transport.DecodeUploadPackResponseV2(res.Body, req)
+}
+
+// lsRefs sends the ls-refs command to a server speaking the version 2 of the
+// protocol.
+func lsRefs(ctx context.Context, s *session, req *packp.LsRefsRequest) (ar *packp.AdvRefs, err error) {
+	if err := transport.ValidateLsRefsRequest(s.caps, req); err != nil {
+		return nil, err
+	}
+
+	content := bytes.NewBuffer(nil)
+	if err := req.Encode(content); err != nil {
+		return nil, fmt.Errorf("sending ls-refs command: %s", err)
+	}
+
+	url := fmt.Sprintf(
+		"%s/%s",
+		s.endpoint.String(), transport.UploadPackServiceName,
+	)
+
+	up := &upSession{s}
+	res, err := up.doRequest(ctx, http.MethodPost, url, content)
+	if err != nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(res.Body, &err)
+
+	ar = packp.NewAdvRefs()
+	ar.Capabilities = s.caps.UploadPackCapabilities()
+	if err = ar.DecodeLsRefs(res.Body); err != nil {
+		return nil, err
+	}
+
+	transport.FilterUnsupportedCapabilities(ar.Capabilities)
+	return ar, nil
+}
+
 // Close does nothing.
 func (s *upSession) Close() error {
 	return nil
@@ -96,6 +210,10 @@ func (s *upSession) doRequest(
 	}
 
 	applyHeadersToRequest(req, content, s.endpoint.Host, transport.UploadPackServiceName)
+	if s.caps != nil {
+		req.Header.Set(gitProtocolHeader, transport.VersionParameter(transport.UploadPackServiceName, s.endpoint))
+	}
+
 	s.ApplyAuthToRequest(req)
 
 	res, err := s.client.Do(req.WithContext(ctx))
@@ -85,6 +85,11 @@ func (c *command) setAuth(auth transport.AuthMethod) error {
 }
 
 func (c *command) Start() error {
+	if version := transport.VersionParameter(c.command, c.endpoint); version != "" {
+		// The servers not accepting the variable speak the version 0.
+		_ = c.Session.Setenv("GIT_PROTOCOL", version)
+	}
+
 	return c.Session.Start(endpointToCommand(c.command, c.endpoint))
 }
 
@@ -0,0 +1,335 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5/internal/transport/tracker"
+	"github.com/go-git/go-git/v5/plumbing/server"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/utils/ioutil"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	// ErrServerClosed is returned by Serve and ListenAndServe after a call
+	// to Close.
+	ErrServerClosed = errors.New("ssh: server closed")
+	// ErrNoHostKeys is returned by Serve and ListenAndServe if the server
+	// has no host keys.
+	ErrNoHostKeys = errors.New("ssh: server has no host keys")
+	// ErrNoLoader is returned by Serve and ListenAndServe if the server has
+	// no loader.
+	ErrNoLoader = errors.New("ssh: server has no loader")
+	// ErrNoClientAuth is returned by Serve and ListenAndServe if the server
+	// has no PublicKeyCallback, and NoClientAuth isn't set.
+	ErrNoClientAuth = errors.New("ssh: server has no client authentication")
+	// ErrServiceNotEnabled is returned executing a command of a service not
+	// enabled.
+	ErrServiceNotEnabled = errors.New("service not enabled")
+	// ErrInvalidCommand is returned executing a command other than
+	// git-upload-pack or git-receive-pack with a path.
+	ErrInvalidCommand = errors.New("invalid command")
+)
+
+// Server serves repositories over SSH, executing the git-upload-pack and
+// git-receive-pack commands requested by the clients.
+type Server struct {
+	// Addr is the TCP address to listen on, ":22" if empty.
+	Addr string
+	// Loader loads the repositories requested, it's required. The paths
+	// requested are relative to the root of the loader.
+	Loader server.Loader
+	// HostKeys are the keys identifying the server, at least one is
+	// required.
+	HostKeys []ssh.Signer
+	// PublicKeyCallback authenticates the clients by their public key,
+	// returning an error to reject them. It's required, unless NoClientAuth
+	// is set.
+	PublicKeyCallback func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error)
+	// NoClientAuth allows anonymous clients, if PublicKeyCallback is nil.
+	NoClientAuth bool
+	// ReceivePack enables the git-receive-pack service, allowing pushes to
+	// the repositories loaded.
+	ReceivePack bool
+	// ReceivePackHooks are run on each push. The connection of the client,
+	// with its user and the permissions returned by PublicKeyCallback, is
+	// available to them with ConnFromContext, to authorise the pushes.
+	ReceivePackHooks server.ReceivePackHooks
+	// ErrorLog logs the errors serving the connections, they aren't logged
+	// if nil.
+	ErrorLog *log.Logger
+
+	tracker tracker.Tracker
+}
+
+// ListenAndServe listens on the TCP address of the server and serves the
+// connections accepted. It always returns a non-nil error, ErrServerClosed
+// after a call to Close.
+func (s *Server) ListenAndServe() error {
+	addr := s.Addr
+	if addr == "" {
+		addr = ":" + strconv.Itoa(DefaultPort)
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+// Serve serves the connections accepted on the listener, each one in its own
+// goroutine. It always returns a non-nil error, ErrServerClosed after a
+// call to Close.
+func (s *Server) Serve(l net.Listener) error {
+	if len(s.HostKeys) == 0 {
+		return ErrNoHostKeys
+	}
+
+	if s.Loader == nil {
+		return ErrNoLoader
+	}
+
+	if s.PublicKeyCallback == nil && !s.NoClientAuth {
+		return ErrNoClientAuth
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: s.PublicKeyCallback,
+		NoClientAuth:      s.PublicKeyCallback == nil,
+	}
+
+	for _, k := range s.HostKeys {
+		config.AddHostKey(k)
+	}
+
+	err := s.tracker.Serve(l, func(conn net.Conn) {
+		if err := s.serveConn(conn, config); err != nil {
+			s.logf("ssh: serving %s: %s", conn.RemoteAddr(), err)
+		}
+	})
+
+	if errors.Is(err, tracker.ErrClosed) {
+		return ErrServerClosed
+	}
+
+	return err
+}
+
+// Close closes the listeners and the connections of the server, waiting for
+// the connections being served.
+func (s *Server) Close() error {
+	return s.tracker.Close()
+}
+
+func (s *Server) serveConn(conn net.Conn, config *ssh.ServerConfig) error {
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return err
+	}
+
+	defer sconn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			_ = nc.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		ch, reqs, err := nc.Accept()
+		if err != nil {
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveSession(sconn, ch, reqs)
+		}()
+	}
+
+	return nil
+}
+
+// serveSession executes the command of the exec request, with the
+// GIT_PROTOCOL variable of the env requests.
+func (s *Server) serveSession(conn *ssh.ServerConn, ch ssh.Channel, reqs <-chan *ssh.Request) {
+	var protocol string
+	var executed bool
+	for req := range reqs {
+		switch {
+		case req.Type == "env" && !executed:
+			var env struct{ Name, Value string }
+			if err := ssh.Unmarshal(req.Payload, &env); err != nil || env.Name != "GIT_PROTOCOL" {
+				_ = req.Reply(false, nil)
+				continue
+			}
+
+			protocol = env.Value
+			_ = req.Reply(true, nil)
+		case req.Type == "exec" && !executed:
+			var exec struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &exec); err != nil {
+				_ = req.Reply(false, nil)
+				continue
+			}
+
+			executed = true
+			_ = req.Reply(true, nil)
+			go func() {
+				status := s.exec(conn, ch, exec.Command, protocol)
+				_, _ = ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+				_ = ch.Close()
+			}()
+		default:
+			_ = req.Reply(false, nil)
+		}
+	}
+}
+
+// exec runs the command on the channel, returning its exit status.
+func (s *Server) exec(conn *ssh.ServerConn, ch ssh.Channel, command, protocol string) uint32 {
+	service, p, err := parseCommand(command)
+	if err != nil {
+		return s.fail(ch, err)
+	}
+
+	if service == transport.ReceivePackServiceName && !s.ReceivePack {
+		return s.fail(ch, fmt.Errorf("%w: %s", ErrServiceNotEnabled, service))
+	}
+
+	ep := &transport.Endpoint{
+		Protocol: "ssh",
+		User:     conn.User(),
+		Path:     path.Clean("/" + p),
+	}
+
+	if service == transport.UploadPackServiceName {
+		ep.ProtocolVersion = transport.ProtocolVersion(protocol)
+	}
+
+	cmd := server.ServerCommand{
+		// The channel isn't closed by the session, the report status is
+		// written once the packfile is read.
+		Stdin:  struct{ io.Reader }{ch},
+		Stdout: ioutil.WriteNopCloser(ch),
+		Stderr: ch.Stderr(),
+	}
+
+	srv := server.NewServerWithHooks(s.Loader, s.ReceivePackHooks)
+	if service == transport.UploadPackServiceName {
+		sess, err := srv.NewUploadPackSession(ep, nil)
+		if err != nil {
+			return s.fail(ch, sessionError(err, p))
+		}
+
+		err = server.ServeUploadPack(cmd, sess)
+		if err != nil && !errors.Is(err, transport.ErrEmptyUploadPackRequest) {
+			return s.fail(ch, err)
+		}
+
+		return 0
+	}
+
+	sess, err := srv.NewReceivePackSession(ep, nil)
+	if err != nil {
+		return s.fail(ch, sessionError(err, p))
+	}
+
+	ctx := context.WithValue(context.Background(), connContextKey{}, conn)
+	if err := server.ServeReceivePackContext(ctx, cmd, sess); err != nil {
+		return s.fail(ch, err)
+	}
+
+	return 0
+}
+
+type connContextKey struct{}
+
+// ConnFromContext returns the connection of the client a receive-pack hook
+// is run for, if any.
+func ConnFromContext(ctx context.Context) (*ssh.ServerConn, bool) {
+	conn, ok := ctx.Value(connContextKey{}).(*ssh.ServerConn)
+	return conn, ok
+}
+
+// fail reports the error to the client on the standard error, as git does.
+func (s *Server) fail(ch ssh.Channel, err error) uint32 {
+	s.logf("ssh: %s", err)
+	fmt.Fprintf(ch.Stderr(), "fatal: %s\n", err)
+	return 128
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+	}
+}
+
+func sessionError(err error, p string) error {
+	if errors.Is(err, transport.ErrRepositoryNotFound) {
+		return fmt.Errorf("'%s' does not appear to be a git repository", p)
+	}
+
+	return err
+}
+
+// parseCommand returns the service and the path of a command, quoted as git
+// does.
+func parseCommand(command string) (service, p string, err error) {
+	service, arg, ok := strings.Cut(command, " ")
+	if !ok || (service != transport.UploadPackServiceName && service != transport.ReceivePackServiceName) {
+		return "", "", fmt.Errorf("%w: %s", ErrInvalidCommand, command)
+	}
+
+	p, err = unquote(strings.TrimSpace(arg))
+	if err != nil || p == "" {
+		return "", "", fmt.Errorf("%w: %s", ErrInvalidCommand, command)
+	}
+
+	return service, p, nil
+}
+
+// unquote removes the single quotes of an argument, unescaping the quotes
+// and the exclamation marks between them as the shell does.
+func unquote(s string) (string, error) {
+	if !strings.HasPrefix(s, "'") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for {
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", errors.New("unterminated quote")
+		}
+
+		b.WriteString(s[1 : end+1])
+		s = s[end+2:]
+		if s == "" {
+			return b.String(), nil
+		}
+
+		if len(s) < 3 || s[0] != '\\' || s[2] != '\'' {
+			return "", errors.New("invalid quoting")
+		}
+
+		b.WriteByte(s[1])
+		s = s[2:]
+	}
+}
@@ -0,0 +1,303 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/protocol"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v5/plumbing/server"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	fixtures "github.com/go-git/go-git-fixtures/v4"
+	stdssh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestServerSuite(t *testing.T) {
+	suite.Run(t, new(ServerSuite))
+}
+
+type ServerSuite struct {
+	suite.Suite
+
+	base   string
+	key    stdssh.Signer
+	server *Server
+	served chan error
+	addr   string
+	client transport.Transport
+}
+
+func (s *ServerSuite) SetupTest() {
+	s.base = s.T().TempDir()
+	fs := fixtures.Basic().One().DotGit()
+	s.NoError(fixtures.EnsureIsBare(fs))
+	s.NoError(os.Rename(fs.Root(), filepath.Join(s.base, "basic.git")))
+
+	s.key = s.newSigner()
+	s.client = NewClient(nil)
+
+	s.start(&Server{
+		Loader:   server.NewFilesystemLoader(osfs.New(s.base)),
+		HostKeys: []stdssh.Signer{s.newSigner()},
+		PublicKeyCallback: func(_ stdssh.ConnMetadata, key stdssh.PublicKey) (*stdssh.Permissions, error) {
+			if !bytes.Equal(key.Marshal(), s.key.PublicKey().Marshal()) {
+				return nil, errors.New("unknown public key")
+			}
+
+			return &stdssh.Permissions{Extensions: map[string]string{"user": "alice"}}, nil
+		},
+		ReceivePack: true,
+	})
+}
+
+func (s *ServerSuite) start(srv *Server) {
+	l, err := net.Listen("tcp", "localhost:0")
+	s.NoError(err)
+
+	s.server = srv
+	s.addr = l.Addr().String()
+	knownHosts := filepath.Join(s.T().TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(s.addr)}, srv.HostKeys[0].PublicKey())
+	s.NoError(os.WriteFile(knownHosts, []byte(line+"\n"), 0o600))
+	s.T().Setenv("SSH_KNOWN_HOSTS", knownHosts)
+
+	s.served = make(chan error, 1)
+	go func() { s.served <- s.server.Serve(l) }()
+}
+
+// restart serves again with a copy of the configuration of the server,
+// changed by the given function.
+func (s *ServerSuite) restart(f func(*Server)) {
+	s.NoError(s.server.Close())
+	s.ErrorIs(<-s.served, ErrServerClosed)
+
+	srv := &Server{
+		Loader:            s.server.Loader,
+		HostKeys:          s.server.HostKeys,
+		PublicKeyCallback: s.server.PublicKeyCallback,
+		ReceivePack:       s.server.ReceivePack,
+	}
+
+	f(srv)
+	s.start(srv)
+}
+
+func (s *ServerSuite) TearDownTest() {
+	s.NoError(s.server.Close())
+	s.ErrorIs(<-s.served, ErrServerClosed)
+}
+
+func (s *ServerSuite) newSigner() stdssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	s.NoError(err)
+
+	signer, err := stdssh.NewSignerFromKey(key)
+	s.NoError(err)
+
+	return signer
+}
+
+func (s *ServerSuite) endpoint(name string) *transport.Endpoint {
+	ep, err := transport.NewEndpoint(fmt.Sprintf("ssh://git@%s/%s", s.addr, name))
+	s.NoError(err)
+
+	return ep
+}
+
+func (s *ServerSuite) auth() AuthMethod {
+	return s.publicKeys(s.key)
+}
+
+func (s *ServerSuite) publicKeys(key stdssh.Signer) AuthMethod {
+	return &PublicKeys{User: "git", Signer: key}
+}
+
+func (s *ServerSuite) testUploadPack(ep *transport.Endpoint) {
+	r, err := s.client.NewUploadPackSession(ep, s.auth())
+	s.NoError(err)
+	defer func() { s.NoError(r.Close()) }()
+
+	ar, err := r.AdvertisedReferences()
+	s.NoError(err)
+
+	head := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	s.Equal(head, ar.References["refs/heads/master"])
+
+	req := packp.NewUploadPackRequest()
+	req.Wants = append(req.Wants, head)
+
+	resp, err := r.UploadPack(context.Background(), req)
+	s.NoError(err)
+	defer func() { s.NoError(resp.Close()) }()
+
+	st := memory.NewStorage()
+	s.NoError(packfile.UpdateObjectStorage(st, resp))
+	s.Len(st.Objects, 28)
+}
+
+func (s *ServerSuite) TestUploadPack() {
+	s.testUploadPack(s.endpoint("basic.git"))
+}
+
+func (s *ServerSuite) TestUploadPackV2() {
+	ep := s.endpoint("basic.git")
+	ep.ProtocolVersion = protocol.V2
+	s.testUploadPack(ep)
+}
+
+func (s *ServerSuite) TestUploadPackNotExists() {
+	r, err := s.client.NewUploadPackSession(s.endpoint("non-existent.git"), s.auth())
+	s.NoError(err)
+	defer func() { s.NoError(r.Close()) }()
+
+	_, err = r.AdvertisedReferences()
+	s.ErrorIs(err, transport.ErrRepositoryNotFound)
+}
+
+func (s *ServerSuite) TestUnknownPublicKey() {
+	r, err := s.client.NewUploadPackSession(s.endpoint("basic.git"), s.publicKeys(s.newSigner()))
+	if err == nil {
+		_, err = r.AdvertisedReferences()
+		s.NoError(r.Close())
+	}
+
+	s.ErrorContains(err, "unable to authenticate")
+}
+
+func (s *ServerSuite) TestReceivePack() {
+	r, err := s.client.NewReceivePackSession(s.endpoint("basic.git"), s.auth())
+	s.NoError(err)
+	defer func() { s.NoError(r.Close()) }()
+
+	ar, err := r.AdvertisedReferences()
+	s.NoError(err)
+
+	req := packp.NewReferenceUpdateRequest()
+	req.Capabilities.Set(capability.ReportStatus)
+	req.Commands = []*packp.Command{
+		{Name: "refs/heads/branch", Old: ar.References["refs/heads/branch"]},
+	}
+
+	rs, err := r.ReceivePack(context.Background(), req)
+	s.NoError(err)
+	s.NoError(rs.Error())
+
+	_, err = os.Stat(filepath.Join(s.base, "basic.git", "refs", "heads", "branch"))
+	s.True(os.IsNotExist(err))
+}
+
+func (s *ServerSuite) deleteBranch() error {
+	r, err := s.client.NewReceivePackSession(s.endpoint("basic.git"), s.auth())
+	s.NoError(err)
+	defer func() { s.NoError(r.Close()) }()
+
+	ar, err := r.AdvertisedReferences()
+	if err != nil {
+		return err
+	}
+
+	req := packp.NewReferenceUpdateRequest()
+	req.Capabilities.Set(capability.ReportStatus)
+	req.Commands = []*packp.Command{
+		{Name: "refs/heads/branch", Old: ar.References["refs/heads/branch"]},
+	}
+
+	rs, err := r.ReceivePack(context.Background(), req)
+	if err != nil {
+		return err
+	}
+
+	return rs.Error()
+}
+
+func (s *ServerSuite) TestReceivePackNotEnabled() {
+	s.restart(func(srv *Server) { srv.ReceivePack = false })
+
+	s.ErrorContains(s.deleteBranch(), ErrServiceNotEnabled.Error())
+
+	_, err := os.Stat(filepath.Join(s.base, "basic.git", "refs", "heads", "branch"))
+	s.NoError(err)
+}
+
+func (s *ServerSuite) TestReceivePackHooks() {
+	var users []string
+	s.restart(func(srv *Server) {
+		srv.ReceivePackHooks.Update = func(ctx context.Context, _ storer.Storer, cmd *packp.Command) error {
+			conn, ok := ConnFromContext(ctx)
+			s.True(ok)
+			s.Equal("git", conn.User())
+
+			user := conn.Permissions.Extensions["user"]
+			users = append(users, user)
+			if user != "admin" {
+				return fmt.Errorf("%s can't update %s", user, cmd.Name)
+			}
+
+			return nil
+		}
+	})
+
+	s.ErrorContains(s.deleteBranch(), "alice can't update refs/heads/branch")
+	s.Equal([]string{"alice"}, users)
+
+	_, err := os.Stat(filepath.Join(s.base, "basic.git", "refs", "heads", "branch"))
+	s.NoError(err)
+}
+
+func (s *ServerSuite) TestServeRequiresLoaderAndClientAuth() {
+	l, err := net.Listen("tcp", "localhost:0")
+	s.NoError(err)
+	defer l.Close()
+
+	srv := &Server{HostKeys: s.server.HostKeys, NoClientAuth: true}
+	s.ErrorIs(srv.Serve(l), ErrNoLoader)
+
+	srv = &Server{HostKeys: s.server.HostKeys, Loader: s.server.Loader}
+	s.ErrorIs(srv.Serve(l), ErrNoClientAuth)
+}
+
+func (s *ServerSuite) TestNoClientAuth() {
+	s.restart(func(srv *Server) {
+		srv.PublicKeyCallback = nil
+		srv.NoClientAuth = true
+	})
+
+	s.testUploadPack(s.endpoint("basic.git"))
+}
+
+func (s *ServerSuite) TestParseCommand() {
+	for _, tc := range []struct {
+		command, service, path string
+	}{
+		{"git-upload-pack '/basic.git'", transport.UploadPackServiceName, "/basic.git"},
+		{"git-receive-pack 'it'\\''s.git'", transport.ReceivePackServiceName, "it's.git"},
+		{"git-upload-pack basic.git", transport.UploadPackServiceName, "basic.git"},
+	} {
+		service, p, err := parseCommand(tc.command)
+		s.NoError(err)
+		s.Equal(tc.service, service)
+		s.Equal(tc.path, p)
+	}
+
+	for _, command := range []string{"ls /", "git-upload-pack", "git-upload-pack '/basic.git", "git-upload-pack ''"} {
+		_, _, err := parseCommand(command)
+		s.ErrorIs(err, ErrInvalidCommand)
+	}
+}
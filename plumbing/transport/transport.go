@@ -25,6 +25,7 @@ import (
 
 	giturl "github.com/go-git/go-git/v5/internal/url"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/protocol"
 	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
 	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
 )
@@ -37,6 +38,10 @@ var (
 	ErrEmptyUploadPackRequest = errors.New("empty git-upload-pack given")
 	ErrInvalidAuthMethod      = errors.New("invalid auth method")
 	ErrAlreadyConnected       = errors.New("session already established")
+	// ErrServerOptionsNotSupported is returned when server options are given
+	// to a server not supporting them, such as the ones not speaking the
+	// version 2 of the protocol.
+	ErrServerOptionsNotSupported = errors.New("server options not supported")
 )
 
 const (
@@ -84,6 +89,17 @@ type UploadPackSession interface {
 	UploadPack(context.Context, *packp.UploadPackRequest) (*packp.UploadPackResponse, error)
 }
 
+// RefLister is implemented by the UploadPackSessions able to list the
+// references of the server matching a set of prefixes. The servers speaking
+// the version 2 of the protocol filter the references themselves, with the
+// ls-refs command, saving the transfer of the whole list on repositories with
+// many references; the references of other servers are filtered on the
+// client.
+type RefLister interface {
+	// LsRefs lists the references of the server matching the request.
+	LsRefs(context.Context, *packp.LsRefsRequest) (*packp.AdvRefs, error)
+}
+
 // ReceivePackSession represents a git-receive-pack session.
 // A git-receive-pack session has two steps: reference discovery
 // (AdvertisedReferences) and receiving pack (ReceivePack).
@@ -119,6 +135,10 @@ type Endpoint struct {
 	CaBundle []byte
 	// Proxy provides info required for connecting to a proxy.
 	Proxy ProxyOptions
+	// ProtocolVersion is the version of the protocol requested to the
+	// server, falling back to the version 0 if the server doesn't support
+	// it. The version 2 is only requested on git-upload-pack sessions.
+	ProtocolVersion protocol.Version
 }
 
 type ProxyOptions struct {
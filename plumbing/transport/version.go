@@ -1,6 +1,7 @@
 package transport
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/go-git/go-git/v5/plumbing/format/pktline"
@@ -45,3 +46,16 @@ func ProtocolVersion(p string) protocol.Version {
 	}
 	return ver
 }
+
+// VersionParameter returns the parameter requesting the protocol version of
+// the endpoint to the server, sent in the GIT_PROTOCOL environment variable or
+// the extra parameters of the git protocol. It returns an empty string if the
+// version 0 is requested, or if the command isn't git-upload-pack, the only
+// one supporting the version 2.
+func VersionParameter(cmd string, ep *Endpoint) string {
+	if cmd != UploadPackServiceName || ep == nil || ep.ProtocolVersion <= protocol.V0 {
+		return ""
+	}
+
+	return fmt.Sprintf("version=%s", ep.ProtocolVersion)
+}
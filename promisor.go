@@ -0,0 +1,182 @@
+package git
+
+import (
+	"context"
+	"io"
+	"sort"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+)
+
+// setupPromisor configures the storage to fetch the objects missing in a
+// partial clone from its promisor remote, the one of the extensions.partialclone
+// option or else the first one with the remote.<name>.promisor option.
+func (r *Repository) setupPromisor() error {
+	ps, ok := r.Storer.(storer.PromisorObjectStorer)
+	if !ok {
+		return nil
+	}
+
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+
+	c, ok := cfg.Remotes[cfg.Extensions.PartialClone]
+	if !ok {
+		names := make([]string, 0, len(cfg.Remotes))
+		for name, rc := range cfg.Remotes {
+			if rc.Promisor {
+				names = append(names, name)
+			}
+		}
+
+		if len(names) == 0 {
+			return nil
+		}
+
+		sort.Strings(names)
+		c = cfg.Remotes[names[0]]
+	}
+
+	r.promisor = NewRemote(newNoLazyFetchStorer(r.Storer), c)
+	ps.SetPromisor(r.fetchPromised)
+	return nil
+}
+
+// noLazyFetchStorer is a storage whose EncodedObject never fetches the objects
+// missing in a partial clone. The promisor remote writes to it, so the lookups
+// of a lazy fetch don't fetch again.
+type noLazyFetchStorer struct {
+	storage.Storer
+}
+
+// newNoLazyFetchStorer returns a noLazyFetchStorer of the given storage,
+// keeping the packfile writers it implements.
+func newNoLazyFetchStorer(s storage.Storer) storage.Storer {
+	pw, ok := s.(storer.PackfileWriter)
+	if !ok {
+		return noLazyFetchStorer{s}
+	}
+
+	ppw, _ := s.(storer.PromisorPackfileWriter)
+	return &noLazyFetchPackStorer{noLazyFetchStorer{s}, pw, ppw}
+}
+
+// noLazyFetchPackStorer is a noLazyFetchStorer of a storage implementing
+// storer.PackfileWriter.
+type noLazyFetchPackStorer struct {
+	noLazyFetchStorer
+	pw  storer.PackfileWriter
+	ppw storer.PromisorPackfileWriter
+}
+
+// PackfileWriter returns a writer for writing a packfile to the storage.
+func (s *noLazyFetchPackStorer) PackfileWriter() (io.WriteCloser, error) {
+	return s.pw.PackfileWriter()
+}
+
+// PromisorPackfileWriter returns a writer for writing a packfile to the
+// storage, marked as fetched from a promisor remote if the storage supports
+// it.
+func (s *noLazyFetchPackStorer) PromisorPackfileWriter() (io.WriteCloser, error) {
+	if s.ppw == nil {
+		return s.pw.PackfileWriter()
+	}
+
+	return s.ppw.PromisorPackfileWriter()
+}
+
+// EncodedObject returns the object with the given hash, or
+// plumbing.ErrObjectNotFound if it's missing in the storage.
+func (s noLazyFetchStorer) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	if err := s.Storer.HasEncodedObject(h); err != nil {
+		return nil, err
+	}
+
+	return s.Storer.EncodedObject(t, h)
+}
+
+// fetchPromised fetches the given objects from the promisor remote, in a
+// single request.
+func (r *Repository) fetchPromised(hashes ...plumbing.Hash) error {
+	if r.LazyFetch.Disabled {
+		return plumbing.ErrObjectNotFound
+	}
+
+	return r.promisor.fetchObjects(context.Background(), &FetchOptions{
+		RemoteName:      r.promisor.c.Name,
+		Auth:            r.LazyFetch.Auth,
+		InsecureSkipTLS: r.LazyFetch.InsecureSkipTLS,
+		CABundle:        r.LazyFetch.CABundle,
+		ProxyOptions:    r.LazyFetch.ProxyOptions,
+		Tags:            plumbing.NoTags,
+	}, hashes)
+}
+
+// prefetchObjects fetches the given objects missing in a partial clone in a
+// single request, instead of one request per object when they are read.
+func (r *Repository) prefetchObjects(hashes []plumbing.Hash) error {
+	if r.promisor == nil || r.LazyFetch.Disabled {
+		return nil
+	}
+
+	var missing []plumbing.Hash
+	seen := make(map[plumbing.Hash]bool, len(hashes))
+	for _, h := range hashes {
+		if seen[h] {
+			continue
+		}
+
+		seen[h] = true
+		err := r.Storer.HasEncodedObject(h)
+		if err == plumbing.ErrObjectNotFound {
+			missing = append(missing, h)
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	return r.fetchPromised(missing...)
+}
+
+// prefetchChanges fetches the blobs missing in a partial clone of the files
+// written by the changes.
+func (w *Worktree) prefetchChanges(changes []merkletrie.Change, t *object.Tree) error {
+	if w.r.promisor == nil {
+		return nil
+	}
+
+	var hashes []plumbing.Hash
+	for _, ch := range changes {
+		a, err := ch.Action()
+		if err != nil {
+			return err
+		}
+
+		if a == merkletrie.Delete {
+			continue
+		}
+
+		e, err := t.FindEntry(ch.To.String())
+		if err != nil || e.Mode == filemode.Submodule {
+			continue
+		}
+
+		hashes = append(hashes, e.Hash)
+	}
+
+	return w.r.prefetchObjects(hashes)
+}
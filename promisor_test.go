@@ -0,0 +1,150 @@
+package git
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/storage/memory"
+
+	fixtures "github.com/go-git/go-git-fixtures/v4"
+)
+
+// promisorURL returns the URL of a copy of the basic fixture serving partial
+// clones.
+func (s *RepositorySuite) promisorURL() string {
+	url := fixtures.Basic().One().DotGit().Root()
+	r, err := PlainOpen(url)
+	s.NoError(err)
+
+	cfg, err := r.Config()
+	s.NoError(err)
+	cfg.Raw.Section("uploadpack").SetOption("allowFilter", "true")
+	cfg.Raw.Section("uploadpack").SetOption("allowAnySHA1InWant", "true")
+	s.NoError(r.SetConfig(cfg))
+
+	return url
+}
+
+func (s *RepositorySuite) TestClonePartial() {
+	dir := s.T().TempDir()
+	r, err := PlainClone(dir, false, &CloneOptions{
+		URL:    s.promisorURL(),
+		Filter: packp.FilterBlobNone(),
+	})
+	s.NoError(err)
+
+	cfg, err := r.Config()
+	s.NoError(err)
+	s.True(cfg.Remotes[DefaultRemoteName].Promisor)
+	s.Equal("blob:none", cfg.Remotes[DefaultRemoteName].PartialCloneFilter)
+	s.Equal(DefaultRemoteName, cfg.Extensions.PartialClone)
+	s.Equal("1", string(cfg.Core.RepositoryFormatVersion))
+
+	promisors, err := filepath.Glob(filepath.Join(dir, GitDirName, "objects", "pack", "*.promisor"))
+	s.NoError(err)
+	// The packfile of the clone and the one of the blobs of the checkout.
+	s.Len(promisors, 2)
+
+	status, err := mustWorktree(s, r).Status()
+	s.NoError(err)
+	s.True(status.IsClean())
+
+	// The blob of the README file is only in the other branch, it wasn't
+	// fetched by the checkout.
+	readme := plumbing.NewHash("7e59600739c96546163833214c36459e324bad0a")
+	s.ErrorIs(r.Storer.HasEncodedObject(readme), plumbing.ErrObjectNotFound)
+
+	offline, err := PlainOpen(dir)
+	s.NoError(err)
+	offline.LazyFetch.Disabled = true
+	_, err = offline.BlobObject(readme)
+	s.ErrorIs(err, plumbing.ErrObjectNotFound)
+
+	head, err := r.CommitObject(plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	s.NoError(err)
+	branch, err := r.CommitObject(plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881"))
+	s.NoError(err)
+
+	patch, err := head.Patch(branch)
+	s.NoError(err)
+	s.Len(patch.FilePatches(), 2)
+	s.NoError(r.Storer.HasEncodedObject(readme))
+}
+
+func (s *RepositorySuite) TestFetchPartial() {
+	r, err := Init(memory.NewStorage(), nil)
+	s.NoError(err)
+
+	_, err = r.CreateRemote(&config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{s.promisorURL()},
+	})
+	s.NoError(err)
+
+	s.NoError(r.Fetch(&FetchOptions{Filter: packp.FilterBlobNone()}))
+
+	cfg, err := r.Config()
+	s.NoError(err)
+	s.True(cfg.Remotes[DefaultRemoteName].Promisor)
+
+	blob, err := r.BlobObject(plumbing.NewHash("9a48f23120e880dfbe41f7c9b7b708e9ee62a492"))
+	s.NoError(err)
+	s.Equal(int64(11488), blob.Size)
+
+	var files []string
+	commit, err := r.CommitObject(plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881"))
+	s.NoError(err)
+	tree, err := commit.Tree()
+	s.NoError(err)
+	s.NoError(tree.Files().ForEach(func(f *object.File) error {
+		_, err := f.Contents()
+		files = append(files, f.Name)
+		return err
+	}))
+	s.Len(files, 9)
+}
+
+func (s *RepositorySuite) TestGCPartial() {
+	dir := s.T().TempDir()
+	_, err := PlainClone(dir, false, &CloneOptions{
+		URL:    s.promisorURL(),
+		Filter: packp.FilterBlobNone(),
+	})
+	s.NoError(err)
+
+	// The objects missing aren't fetched, but skipped.
+	r, err := PlainOpen(dir)
+	s.NoError(err)
+	r.LazyFetch.Disabled = true
+	s.NoError(r.GC(nil))
+
+	packs, err := filepath.Glob(filepath.Join(dir, GitDirName, "objects", "pack", "*.pack"))
+	s.NoError(err)
+	s.Len(packs, 1)
+
+	promisors, err := filepath.Glob(filepath.Join(dir, GitDirName, "objects", "pack", "*.promisor"))
+	s.NoError(err)
+	s.Equal([]string{strings.TrimSuffix(packs[0], ".pack") + ".promisor"}, promisors)
+
+	readme := plumbing.NewHash("7e59600739c96546163833214c36459e324bad0a")
+	s.ErrorIs(r.Storer.HasEncodedObject(readme), plumbing.ErrObjectNotFound)
+
+	status, err := mustWorktree(s, r).Status()
+	s.NoError(err)
+	s.True(status.IsClean())
+
+	r, err = PlainOpen(dir)
+	s.NoError(err)
+	_, err = r.BlobObject(readme)
+	s.NoError(err)
+}
+
+func mustWorktree(s *RepositorySuite, r *Repository) *Worktree {
+	w, err := r.Worktree()
+	s.NoError(err)
+	return w
+}
@@ -36,7 +36,7 @@ func (r *Repository) Prune(opt PruneOptions) error {
 		return ErrLooseObjectsNotSupported
 	}
 
-	pw := newObjectWalker(r.Storer)
+	pw := r.objectWalker()
 	err := pw.walkAllRefs()
 	if err != nil {
 		return err
@@ -0,0 +1,647 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/emirpasic/gods/trees/binaryheap"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var (
+	// ErrRebaseNotSupported is returned when the storer of the repository
+	// can't store the state of a rebase, only storers based on a filesystem
+	// are supported.
+	ErrRebaseNotSupported = errors.New("rebase not supported by the storer")
+	// ErrRebaseInProgress is returned when starting a rebase while another
+	// one is in progress.
+	ErrRebaseInProgress = errors.New("a rebase is already in progress")
+	// ErrNoRebaseInProgress is returned when continuing, skipping or aborting
+	// a rebase while none is in progress.
+	ErrNoRebaseInProgress = errors.New("no rebase in progress")
+	// ErrInvalidRebaseTodo is returned when a command of the todo list of a
+	// rebase is not valid.
+	ErrInvalidRebaseTodo = errors.New("invalid rebase todo list")
+)
+
+// RebaseAction is the action of a command of the todo list of a rebase.
+type RebaseAction string
+
+const (
+	// RebasePick applies the commit.
+	RebasePick RebaseAction = "pick"
+	// RebaseReword applies the commit, replacing its message.
+	RebaseReword RebaseAction = "reword"
+	// RebaseSquash melds the commit into the previous one, combining their
+	// messages.
+	RebaseSquash RebaseAction = "squash"
+	// RebaseFixup melds the commit into the previous one, keeping the
+	// message of the previous one.
+	RebaseFixup RebaseAction = "fixup"
+	// RebaseDrop removes the commit.
+	RebaseDrop RebaseAction = "drop"
+)
+
+// parseRebaseAction parses an action of a todo list, in its long or short
+// form.
+func parseRebaseAction(s string) (RebaseAction, bool) {
+	for _, a := range []RebaseAction{RebasePick, RebaseReword, RebaseSquash, RebaseFixup, RebaseDrop} {
+		if s == string(a) || s == string(a[0]) {
+			return a, true
+		}
+	}
+
+	return "", false
+}
+
+// RebaseCommand is a command of the todo list of a rebase.
+type RebaseCommand struct {
+	Action RebaseAction
+	Commit plumbing.Hash
+	// Message replaces the message of the commit on reword, and the combined
+	// message on squash and fixup. If empty, reword keeps the message of the
+	// commit, and squash appends it to the message of the previous commit.
+	Message string
+}
+
+// RebaseTodo returns the default todo list of a rebase with the given
+// options: a pick of each commit of the branch not reachable from the
+// upstream commit, oldest first. Merge commits are not included.
+func (r *Repository) RebaseTodo(opts *RebaseOptions) ([]RebaseCommand, error) {
+	if opts.Upstream.IsZero() {
+		return nil, ErrMissingUpstream
+	}
+
+	name := opts.Branch
+	if name == "" {
+		name = plumbing.HEAD
+	}
+
+	tip, err := r.Reference(name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	upstream, err := r.CommitObject(opts.Upstream)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := r.CommitObject(tip.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	branch, err := rebaseRange(c, upstream)
+	if err != nil {
+		return nil, err
+	}
+
+	// The commits are visited depth first, so the parents are picked before
+	// their children.
+	var todo []RebaseCommand
+	var visit func(c *object.Commit) error
+	visit = func(c *object.Commit) error {
+		if !branch[c.Hash] {
+			return nil
+		}
+
+		delete(branch, c.Hash)
+		if err := c.Parents().ForEach(visit); err != nil {
+			return err
+		}
+
+		if c.NumParents() <= 1 {
+			todo = append(todo, RebaseCommand{Action: RebasePick, Commit: c.Hash})
+		}
+
+		return nil
+	}
+
+	return todo, visit(c)
+}
+
+// rebaseRange returns the commits reachable from the tip but not from the
+// upstream commit, as git rev-list upstream..tip does. The commits are walked
+// newest first, painting the ones reachable from upstream as uninteresting,
+// until only uninteresting commits older than the ones of the branch are
+// left to walk, so the history below the merge base isn't walked.
+func rebaseRange(tip, upstream *object.Commit) (map[plumbing.Hash]bool, error) {
+	uninteresting := map[plumbing.Hash]bool{upstream.Hash: true}
+	walked := make(map[plumbing.Hash]bool)
+	queued := make(map[plumbing.Hash]bool)
+
+	queue := binaryheap.NewWith(func(a, b interface{}) int {
+		if a.(*object.Commit).Committer.When.Before(b.(*object.Commit).Committer.When) {
+			return 1
+		}
+		return -1
+	})
+
+	push := func(c *object.Commit) {
+		if !queued[c.Hash] {
+			queued[c.Hash] = true
+			queue.Push(c)
+		}
+	}
+
+	push(upstream)
+	push(tip)
+
+	var oldest time.Time
+	for !rebaseRangeDone(queue, uninteresting, oldest) {
+		v, _ := queue.Pop()
+		c := v.(*object.Commit)
+		delete(queued, c.Hash)
+
+		if walked[c.Hash] && !uninteresting[c.Hash] {
+			continue
+		}
+
+		walked[c.Hash] = true
+		if !uninteresting[c.Hash] && (oldest.IsZero() || c.Committer.When.Before(oldest)) {
+			oldest = c.Committer.When
+		}
+
+		err := c.Parents().ForEach(func(p *object.Commit) error {
+			if uninteresting[c.Hash] && !uninteresting[p.Hash] {
+				// A parent already walked is walked again, to paint its
+				// own parents.
+				uninteresting[p.Hash] = true
+				push(p)
+			} else if !walked[p.Hash] {
+				push(p)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for h := range walked {
+		if uninteresting[h] {
+			delete(walked, h)
+		}
+	}
+
+	return walked, nil
+}
+
+// rebaseRangeDone returns whether the commits left to walk are all
+// uninteresting, and older than the oldest commit of the branch walked, so
+// they can't reach it.
+func rebaseRangeDone(queue *binaryheap.Heap, uninteresting map[plumbing.Hash]bool, oldest time.Time) bool {
+	for _, v := range queue.Values() {
+		if !uninteresting[v.(*object.Commit).Hash] {
+			return false
+		}
+	}
+
+	v, ok := queue.Peek()
+	return !ok || oldest.IsZero() || v.(*object.Commit).Committer.When.Before(oldest)
+}
+
+// Rebase replays the commits of a branch on top of a new base commit, as git
+// rebase does, following the commands of the todo list. HEAD is detached
+// during the rebase, and the branch is updated once all the commands are
+// done. The commits which become empty are dropped.
+//
+// The state of the rebase is stored in the rebase-merge directory, using the
+// same format git uses. If applying a commit conflicts, the conflicting
+// files are left with conflict markers, recorded as unmerged in the index,
+// and ErrMergeConflict is returned. The rebase can then be resumed with
+// RebaseContinue, once the conflicts are resolved, or with RebaseSkip, or
+// cancelled with RebaseAbort.
+func (w *Worktree) Rebase(opts *RebaseOptions) error {
+	if err := opts.Validate(w.r); err != nil {
+		return err
+	}
+
+	fs, err := w.r.rebaseFilesystem()
+	if err != nil {
+		return err
+	}
+
+	inProgress, err := rebaseInProgress(fs)
+	if err != nil {
+		return err
+	}
+
+	if inProgress {
+		return ErrRebaseInProgress
+	}
+
+	if opts.Branch != "" {
+		if err := w.Checkout(&CheckoutOptions{Branch: opts.Branch}); err != nil {
+			return err
+		}
+	}
+
+	todo := opts.Commands
+	if todo == nil {
+		if todo, err = w.r.RebaseTodo(opts); err != nil {
+			return err
+		}
+	}
+
+	if err := validateRebaseTodo(todo); err != nil {
+		return err
+	}
+
+	head, err := w.r.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return err
+	}
+
+	current, err := w.r.Head()
+	if err != nil {
+		return err
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return err
+	}
+
+	if hasTrackedChanges(status) {
+		return ErrWorktreeNotClean
+	}
+
+	s := &rebaseState{
+		r:        w.r,
+		fs:       fs,
+		onto:     opts.Onto,
+		origHead: current.Hash(),
+		todo:     todo,
+	}
+
+	if head.Type() == plumbing.SymbolicReference {
+		s.headName = head.Target()
+	}
+
+	if err := w.moveHEAD(status, current.Hash(), opts.Onto,
+		fmt.Sprintf("rebase (start): checkout %s", opts.Onto)); err != nil {
+		return err
+	}
+
+	if err := s.save(); err != nil {
+		return err
+	}
+
+	return w.runRebase(s, opts.Committer)
+}
+
+// validateRebaseTodo checks that the squash and fixup commands follow a
+// command creating a commit.
+func validateRebaseTodo(todo []RebaseCommand) error {
+	picked := false
+	for _, cmd := range todo {
+		switch cmd.Action {
+		case RebasePick, RebaseReword:
+			picked = true
+		case RebaseSquash, RebaseFixup:
+			if !picked {
+				return fmt.Errorf("%w: cannot %s without a previous commit", ErrInvalidRebaseTodo, cmd.Action)
+			}
+		case RebaseDrop:
+		default:
+			return fmt.Errorf("%w: unknown action %q", ErrInvalidRebaseTodo, cmd.Action)
+		}
+	}
+
+	return nil
+}
+
+// RebaseContinue resumes the rebase in progress, once the conflicts are
+// resolved and the resolution added to the index. The commit which stopped
+// the rebase is committed, unless the resolution leaves no changes or it was
+// already committed. The committer is taken from the configuration.
+func (w *Worktree) RebaseContinue() error {
+	s, committer, err := w.loadRebase()
+	if err != nil {
+		return err
+	}
+
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range idx.Entries {
+		if e.Stage != index.Merged {
+			return ErrUnmergedPaths
+		}
+	}
+
+	stop, err := s.readStop()
+	if err != nil {
+		return err
+	}
+
+	if stop != nil {
+		if err := w.commitRebaseStop(idx, stop, committer); err != nil {
+			return err
+		}
+
+		if err := s.clearStop(); err != nil {
+			return err
+		}
+	}
+
+	return w.runRebase(s, committer)
+}
+
+// RebaseSkip resumes the rebase in progress, discarding the changes of the
+// commit which stopped it.
+func (w *Worktree) RebaseSkip() error {
+	s, committer, err := w.loadRebase()
+	if err != nil {
+		return err
+	}
+
+	if err := w.Reset(&ResetOptions{Mode: HardReset}); err != nil {
+		return err
+	}
+
+	if err := s.clearStop(); err != nil {
+		return err
+	}
+
+	return w.runRebase(s, committer)
+}
+
+// RebaseAbort cancels the rebase in progress, restoring the worktree and
+// HEAD to their state before the rebase started.
+func (w *Worktree) RebaseAbort() error {
+	fs, err := w.r.rebaseFilesystem()
+	if err != nil {
+		return err
+	}
+
+	s, err := loadRebaseState(w.r, fs)
+	if err != nil {
+		return err
+	}
+
+	if err := w.Reset(&ResetOptions{Mode: HardReset, Commit: s.origHead}); err != nil {
+		return err
+	}
+
+	if s.headName != "" {
+		head := plumbing.NewSymbolicReference(plumbing.HEAD, s.headName)
+		msg := fmt.Sprintf("rebase (abort): returning to %s", s.headName)
+		if err := setReference(w.r.Storer, head, nil, msg); err != nil {
+			return err
+		}
+	}
+
+	if err := s.clearStop(); err != nil {
+		return err
+	}
+
+	return s.remove()
+}
+
+// loadRebase returns the state of the rebase in progress and the committer
+// of the new commits.
+func (w *Worktree) loadRebase() (*rebaseState, *object.Signature, error) {
+	fs, err := w.r.rebaseFilesystem()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s, err := loadRebaseState(w.r, fs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	committer, err := loadConfigCommitter(w.r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return s, committer, nil
+}
+
+// runRebase executes the remaining commands of the todo list, finishing the
+// rebase once all are done.
+func (w *Worktree) runRebase(s *rebaseState, committer *object.Signature) error {
+	for len(s.todo) > 0 {
+		cmd := s.todo[0]
+		s.todo, s.done = s.todo[1:], append(s.done, cmd)
+		if err := s.save(); err != nil {
+			return err
+		}
+
+		p, err := w.rebaseCommitPick(cmd, committer)
+		if err != nil {
+			return err
+		}
+
+		if p == nil {
+			continue
+		}
+
+		_, err = w.applyCommitPick(p)
+		switch {
+		case errors.Is(err, ErrEmptyCommit):
+			continue
+		case errors.Is(err, ErrMergeConflict):
+			if err := s.writeStop(p); err != nil {
+				return err
+			}
+
+			return fmt.Errorf("%w: could not apply %s", err, commitLabel(p.commit))
+		case err != nil:
+			return err
+		}
+	}
+
+	return w.finishRebase(s)
+}
+
+// rebaseCommitPick returns how the given command is applied to HEAD. It
+// returns nil if the command doesn't need to create a commit, either because
+// it drops the commit or because HEAD is fast-forwarded to it.
+func (w *Worktree) rebaseCommitPick(cmd RebaseCommand, committer *object.Signature) (*commitPick, error) {
+	if cmd.Action == RebaseDrop {
+		return nil, nil
+	}
+
+	c, err := w.r.CommitObject(cmd.Commit)
+	if err != nil {
+		return nil, err
+	}
+
+	parent, err := mainlineParent(c, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := w.r.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	if cmd.Action == RebasePick && parent != nil && parent.Hash == head.Hash() {
+		return nil, w.fastForwardRebase(head.Hash(), c)
+	}
+
+	base, err := treeOrNil(parent)
+	if err != nil {
+		return nil, err
+	}
+
+	theirs, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	label := commitLabel(c)
+	author := c.Author
+	p := &commitPick{
+		commit:      c,
+		base:        base,
+		theirs:      theirs,
+		baseLabel:   "parent of " + label,
+		theirsLabel: label,
+		head:        plumbing.RebaseHead,
+		action:      fmt.Sprintf("rebase (%s)", cmd.Action),
+		message:     c.Message,
+		author:      &author,
+		committer:   committer,
+	}
+
+	switch cmd.Action {
+	case RebaseReword:
+		if cmd.Message != "" {
+			p.message = cmd.Message
+		}
+	case RebaseSquash, RebaseFixup:
+		prev, err := w.r.CommitObject(head.Hash())
+		if err != nil {
+			return nil, err
+		}
+
+		p.amend = true
+		p.author = &prev.Author
+		p.message = prev.Message
+
+		switch {
+		case cmd.Message != "":
+			p.message = cmd.Message
+		case cmd.Action == RebaseSquash:
+			p.message = strings.TrimRight(prev.Message, "\n") + "\n\n" + c.Message
+		}
+	}
+
+	return p, nil
+}
+
+// fastForwardRebase moves HEAD to c, whose parent is HEAD, reusing the
+// commit as git does.
+func (w *Worktree) fastForwardRebase(head plumbing.Hash, c *object.Commit) error {
+	status, err := w.Status()
+	if err != nil {
+		return err
+	}
+
+	subject, _, _ := strings.Cut(strings.TrimSpace(c.Message), "\n")
+	return w.moveHEAD(status, head, c.Hash, "rebase (pick): "+subject)
+}
+
+// moveHEAD checks out the commit to, detaching HEAD at it.
+func (w *Worktree) moveHEAD(s Status, from, to plumbing.Hash, msg string) error {
+	fromTree, err := w.r.getTreeFromCommitHash(from)
+	if err != nil {
+		return err
+	}
+
+	toTree, err := w.r.getTreeFromCommitHash(to)
+	if err != nil {
+		return err
+	}
+
+	if err := w.checkoutTree(s, fromTree, toTree); err != nil {
+		return err
+	}
+
+	return setReference(w.r.Storer, plumbing.NewHashReference(plumbing.HEAD, to), nil, msg)
+}
+
+// commitRebaseStop commits the index, resolving the conflicts of the commit
+// which stopped the rebase.
+func (w *Worktree) commitRebaseStop(idx *index.Index, stop *rebaseStop, committer *object.Signature) error {
+	head, err := w.r.Head()
+	if err != nil {
+		return err
+	}
+
+	c, err := w.r.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+
+	h := &buildTreeHelper{fs: w.Filesystem, s: w.r.Storer}
+	tree, err := h.BuildTree(idx, nil)
+	if err != nil {
+		return err
+	}
+
+	if tree == c.TreeHash && !stop.amend {
+		return nil
+	}
+
+	parents := []plumbing.Hash{c.Hash}
+	if stop.amend {
+		parents = c.ParentHashes
+	}
+
+	commit, err := w.buildCommitObject(stop.message, &CommitOptions{
+		Author:    &stop.author,
+		Committer: committer,
+		Parents:   parents,
+	}, tree)
+	if err != nil {
+		return err
+	}
+
+	subject, _, _ := strings.Cut(strings.TrimSpace(stop.message), "\n")
+	return w.updateHEAD(commit, committer, "rebase (continue): "+subject)
+}
+
+// finishRebase updates the rebased branch to HEAD and checks it out again,
+// removing the state of the rebase.
+func (w *Worktree) finishRebase(s *rebaseState) error {
+	if s.headName != "" {
+		head, err := w.r.Head()
+		if err != nil {
+			return err
+		}
+
+		ref := plumbing.NewHashReference(s.headName, head.Hash())
+		msg := fmt.Sprintf("rebase (finish): %s onto %s", s.headName, s.onto)
+		if err := setReference(w.r.Storer, ref, nil, msg); err != nil {
+			return err
+		}
+
+		ref = plumbing.NewSymbolicReference(plumbing.HEAD, s.headName)
+		msg = fmt.Sprintf("rebase (finish): returning to %s", s.headName)
+		if err := setReference(w.r.Storer, ref, nil, msg); err != nil {
+			return err
+		}
+	}
+
+	if err := s.clearStop(); err != nil {
+		return err
+	}
+
+	return s.remove()
+}
@@ -0,0 +1,388 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const (
+	rebaseMergeDir     = "rebase-merge"
+	rebaseDetachedHead = "detached HEAD"
+
+	rebaseHeadNameFile     = "head-name"
+	rebaseOntoFile         = "onto"
+	rebaseOrigHeadFile     = "orig-head"
+	rebaseTodoFile         = "git-rebase-todo"
+	rebaseDoneFile         = "done"
+	rebaseMsgNumFile       = "msgnum"
+	rebaseEndFile          = "end"
+	rebaseMessagesDir      = "messages"
+	rebaseMessageFile      = "message"
+	rebaseAuthorScriptFile = "author-script"
+	rebaseStoppedSHAFile   = "stopped-sha"
+	rebaseAmendFile        = "amend"
+	rebaseMergeMsgFile     = "MERGE_MSG"
+)
+
+// rebaseState is the state of a rebase in progress. It's stored in the
+// rebase-merge directory using the same files git does, so a rebase started
+// by go-git can be continued by git and the other way around. The messages
+// given to the reword and squash commands, which can't be represented in the
+// todo list, are stored in the messages directory.
+type rebaseState struct {
+	r  *Repository
+	fs billy.Filesystem
+
+	headName plumbing.ReferenceName
+	onto     plumbing.Hash
+	origHead plumbing.Hash
+	todo     []RebaseCommand
+	done     []RebaseCommand
+}
+
+// rebaseStop records the commit being applied when a rebase stopped due to
+// conflicts.
+type rebaseStop struct {
+	commit  plumbing.Hash
+	message string
+	author  object.Signature
+	amend   bool
+}
+
+// rebaseFilesystem returns the filesystem where the state of a rebase is
+// stored, only storers based on a filesystem are supported.
+func (r *Repository) rebaseFilesystem() (billy.Filesystem, error) {
+	type fsBased interface {
+		Filesystem() billy.Filesystem
+	}
+
+	fs, ok := r.Storer.(fsBased)
+	if !ok {
+		return nil, ErrRebaseNotSupported
+	}
+
+	return fs.Filesystem(), nil
+}
+
+// rebaseInProgress returns true if the rebase-merge directory exists.
+func rebaseInProgress(fs billy.Filesystem) (bool, error) {
+	_, err := fs.Stat(rebaseMergeDir)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// loadRebaseState reads the state of the rebase in progress, returning
+// ErrNoRebaseInProgress if there is none.
+func loadRebaseState(r *Repository, fs billy.Filesystem) (*rebaseState, error) {
+	ok, err := rebaseInProgress(fs)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, ErrNoRebaseInProgress
+	}
+
+	s := &rebaseState{r: r, fs: fs}
+	headName, err := s.readFile(rebaseHeadNameFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if headName != rebaseDetachedHead {
+		s.headName = plumbing.ReferenceName(headName)
+	}
+
+	for file, h := range map[string]*plumbing.Hash{
+		rebaseOntoFile:     &s.onto,
+		rebaseOrigHeadFile: &s.origHead,
+	} {
+		content, err := s.readFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		*h = plumbing.NewHash(content)
+	}
+
+	if s.todo, err = s.readCommands(rebaseTodoFile); err != nil {
+		return nil, err
+	}
+
+	if s.done, err = s.readCommands(rebaseDoneFile); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// save writes the state to the rebase-merge directory.
+func (s *rebaseState) save() error {
+	headName := rebaseDetachedHead
+	if s.headName != "" {
+		headName = s.headName.String()
+	}
+
+	for file, content := range map[string]string{
+		rebaseHeadNameFile: headName,
+		rebaseOntoFile:     s.onto.String(),
+		rebaseOrigHeadFile: s.origHead.String(),
+		rebaseMsgNumFile:   strconv.Itoa(len(s.done)),
+		rebaseEndFile:      strconv.Itoa(len(s.done) + len(s.todo)),
+	} {
+		if err := s.writeFile(file, content+"\n"); err != nil {
+			return err
+		}
+	}
+
+	if err := s.writeCommands(rebaseTodoFile, s.todo); err != nil {
+		return err
+	}
+
+	return s.writeCommands(rebaseDoneFile, s.done)
+}
+
+// remove removes the rebase-merge directory, ending the rebase.
+func (s *rebaseState) remove() error {
+	return util.RemoveAll(s.fs, rebaseMergeDir)
+}
+
+func (s *rebaseState) writeCommands(file string, cmds []RebaseCommand) error {
+	var b bytes.Buffer
+	for _, cmd := range cmds {
+		c, err := s.r.CommitObject(cmd.Commit)
+		if err != nil {
+			return err
+		}
+
+		subject, _, _ := strings.Cut(strings.TrimSpace(c.Message), "\n")
+		fmt.Fprintf(&b, "%s %s %s\n", cmd.Action, cmd.Commit, subject)
+
+		if cmd.Message != "" {
+			name := path.Join(rebaseMessagesDir, cmd.Commit.String())
+			if err := s.writeFile(name, cmd.Message); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.writeFile(file, b.String())
+}
+
+func (s *rebaseState) readCommands(file string) ([]RebaseCommand, error) {
+	content, err := s.readFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var cmds []RebaseCommand
+	sc := bufio.NewScanner(strings.NewReader(content))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		cmd, err := s.parseCommand(line)
+		if err != nil {
+			return nil, err
+		}
+
+		cmds = append(cmds, cmd)
+	}
+
+	return cmds, sc.Err()
+}
+
+// parseCommand parses a line of a todo list. The abbreviated forms of the
+// actions and hashes written by git are supported.
+func (s *rebaseState) parseCommand(line string) (RebaseCommand, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return RebaseCommand{}, fmt.Errorf("%w: %s", ErrInvalidRebaseTodo, line)
+	}
+
+	action, ok := parseRebaseAction(fields[0])
+	if !ok {
+		return RebaseCommand{}, fmt.Errorf("%w: %s", ErrInvalidRebaseTodo, line)
+	}
+
+	cmd := RebaseCommand{Action: action}
+	if plumbing.IsHash(fields[1]) {
+		cmd.Commit = plumbing.NewHash(fields[1])
+	} else {
+		hashes := s.r.resolveHashPrefix(fields[1])
+		if len(hashes) == 0 {
+			return RebaseCommand{}, fmt.Errorf("%w: %s", ErrInvalidRebaseTodo, line)
+		}
+
+		cmd.Commit = hashes[0]
+	}
+
+	msg, err := s.readFile(path.Join(rebaseMessagesDir, cmd.Commit.String()))
+	if err != nil && !os.IsNotExist(err) {
+		return RebaseCommand{}, err
+	}
+
+	cmd.Message = msg
+	return cmd, nil
+}
+
+// writeStop records the commit being applied by p, so it can be committed
+// once the conflicts are resolved.
+func (s *rebaseState) writeStop(p *commitPick) error {
+	files := map[string]string{
+		rebaseStoppedSHAFile:   p.commit.Hash.String() + "\n",
+		rebaseMessageFile:      p.message,
+		rebaseAuthorScriptFile: encodeAuthorScript(p.author),
+	}
+
+	if p.amend {
+		head, err := s.r.Head()
+		if err != nil {
+			return err
+		}
+
+		files[rebaseAmendFile] = head.Hash().String() + "\n"
+	}
+
+	for file, content := range files {
+		if err := s.writeFile(file, content); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readStop returns the commit being applied when the rebase stopped, or nil
+// if the rebase didn't stop due to conflicts.
+func (s *rebaseState) readStop() (*rebaseStop, error) {
+	sha, err := s.readFile(rebaseStoppedSHAFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	stop := &rebaseStop{commit: plumbing.NewHash(sha)}
+	if stop.message, err = s.readFile(rebaseMessageFile); err != nil {
+		return nil, err
+	}
+
+	script, err := s.readFile(rebaseAuthorScriptFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if stop.author, err = decodeAuthorScript(script); err != nil {
+		return nil, err
+	}
+
+	_, err = s.fs.Stat(s.path(rebaseAmendFile))
+	stop.amend = err == nil
+	return stop, nil
+}
+
+// clearStop removes the files written by writeStop, and REBASE_HEAD.
+func (s *rebaseState) clearStop() error {
+	for _, file := range []string{
+		rebaseStoppedSHAFile,
+		rebaseMessageFile,
+		rebaseAuthorScriptFile,
+		rebaseAmendFile,
+	} {
+		if err := s.fs.Remove(s.path(file)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	// git writes the message of the commit in MERGE_MSG too, when it stops.
+	if err := s.fs.Remove(rebaseMergeMsgFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	err := s.r.Storer.RemoveReference(plumbing.RebaseHead)
+	if err == plumbing.ErrReferenceNotFound {
+		return nil
+	}
+
+	return err
+}
+
+func (s *rebaseState) path(file string) string {
+	return path.Join(rebaseMergeDir, file)
+}
+
+func (s *rebaseState) readFile(file string) (string, error) {
+	content, err := util.ReadFile(s.fs, s.path(file))
+	if err != nil {
+		return "", err
+	}
+
+	if file == rebaseMessageFile || strings.HasPrefix(file, rebaseMessagesDir) {
+		return string(content), nil
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
+
+func (s *rebaseState) writeFile(file, content string) error {
+	return util.WriteFile(s.fs, s.path(file), []byte(content), 0o644)
+}
+
+// encodeAuthorScript returns the author-script file used by git to record
+// the author of the commit being applied, as shell variable assignments.
+func encodeAuthorScript(sig *object.Signature) string {
+	quote := func(s string) string {
+		return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+	}
+
+	date := fmt.Sprintf("@%d %s", sig.When.Unix(), sig.When.Format("-0700"))
+	return fmt.Sprintf("GIT_AUTHOR_NAME=%s\nGIT_AUTHOR_EMAIL=%s\nGIT_AUTHOR_DATE=%s\n",
+		quote(sig.Name), quote(sig.Email), quote(date))
+}
+
+// decodeAuthorScript parses the author-script file written by git or
+// encodeAuthorScript.
+func decodeAuthorScript(script string) (object.Signature, error) {
+	vars := make(map[string]string)
+	for _, line := range strings.Split(script, "\n") {
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+
+		value = strings.ReplaceAll(value, `'\''`, "'")
+		vars[name] = strings.TrimSuffix(strings.TrimPrefix(value, "'"), "'")
+	}
+
+	var sig object.Signature
+	sig.Decode([]byte(fmt.Sprintf("%s <%s> %s",
+		vars["GIT_AUTHOR_NAME"],
+		vars["GIT_AUTHOR_EMAIL"],
+		strings.TrimPrefix(vars["GIT_AUTHOR_DATE"], "@"),
+	)))
+
+	if sig.Name == "" && sig.Email == "" {
+		return sig, errors.New("invalid author script")
+	}
+
+	return sig, nil
+}
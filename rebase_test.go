@@ -0,0 +1,291 @@
+package git
+
+import (
+	"time"
+
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+func (s *RepositorySuite) commitMessages(r *Repository, n int) []string {
+	head, err := r.Head()
+	s.Require().NoError(err)
+
+	c, err := r.CommitObject(head.Hash())
+	s.Require().NoError(err)
+
+	var msgs []string
+	for i := 0; i < n; i++ {
+		msgs = append(msgs, c.Message)
+		if c.NumParents() == 0 {
+			break
+		}
+
+		c, err = c.Parent(0)
+		s.Require().NoError(err)
+	}
+
+	return msgs
+}
+
+func (s *RepositorySuite) TestRebase() {
+	r, w := setupMerge(s, map[string][]byte{"foo": []byte("a\nb\nc\nd\ne\n")})
+	upstream := commitFiles(s, w, map[string][]byte{"foo": []byte("A\nb\nc\nd\ne\n")})
+
+	s.checkoutBranch(w, "feature")
+	first := commitFiles(s, w, map[string][]byte{"foo": []byte("a\nb\nc\nd\nE\n")})
+	commitFiles(s, w, map[string][]byte{"bar": []byte("bar\n")})
+
+	todo, err := r.RebaseTodo(&RebaseOptions{Upstream: upstream})
+	s.NoError(err)
+	s.Len(todo, 2)
+	s.Equal(RebaseCommand{Action: RebasePick, Commit: first}, todo[0])
+
+	s.NoError(w.Rebase(&RebaseOptions{Upstream: upstream}))
+
+	head, err := r.Head()
+	s.NoError(err)
+	s.Equal(plumbing.NewBranchReferenceName("feature"), head.Name())
+
+	c, err := r.CommitObject(head.Hash())
+	s.NoError(err)
+	s.Equal(mergeSignature.Name, c.Author.Name)
+	s.Equal("committer", c.Committer.Name)
+
+	parent, err := c.Parent(0)
+	s.NoError(err)
+	parent, err = parent.Parent(0)
+	s.NoError(err)
+	s.Equal(upstream, parent.Hash)
+
+	content, err := util.ReadFile(w.Filesystem, "foo")
+	s.NoError(err)
+	s.Equal("A\nb\nc\nd\nE\n", string(content))
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.True(status.IsClean())
+
+	entries, err := r.Reflog(plumbing.HEAD)
+	s.NoError(err)
+	s.Equal("rebase (finish): returning to refs/heads/feature", entries[0].Message)
+
+	_, err = w.Filesystem.Lstat(".git/" + rebaseMergeDir)
+	s.Error(err)
+}
+
+func (s *RepositorySuite) TestRebaseTodoStopsAtMergeBase() {
+	r, w := setupMerge(s, map[string][]byte{"foo": []byte("foo\n")})
+	head, err := r.Head()
+	s.Require().NoError(err)
+	root := head.Hash()
+
+	commit := func(name string, d time.Duration) plumbing.Hash {
+		s.Require().NoError(util.WriteFile(w.Filesystem, name, []byte(name+"\n"), 0o644))
+		_, err := w.Add(name)
+		s.Require().NoError(err)
+
+		h, err := w.Commit(name+"\n", &CommitOptions{Author: &object.Signature{
+			Name: name, Email: name + "@fake.local", When: mergeSignature.When.Add(d),
+		}})
+		s.Require().NoError(err)
+		return h
+	}
+
+	base := commit("base", time.Hour)
+	s.Require().NoError(r.Storer.SetReference(
+		plumbing.NewHashReference(plumbing.NewBranchReferenceName("feature"), base),
+	))
+
+	upstream := commit("upstream", 3*time.Hour)
+	s.checkoutBranch(w, "feature")
+	feature := commit("feature", 2*time.Hour)
+
+	// The history below the merge base isn't needed.
+	fs := r.Storer.(*filesystem.Storage).Filesystem()
+	s.Require().NoError(fs.Remove(fs.Join("objects", root.String()[:2], root.String()[2:])))
+
+	todo, err := r.RebaseTodo(&RebaseOptions{Upstream: upstream})
+	s.NoError(err)
+	s.Equal([]RebaseCommand{{Action: RebasePick, Commit: feature}}, todo)
+
+	todo, err = r.RebaseTodo(&RebaseOptions{
+		Upstream: upstream,
+		Branch:   plumbing.NewBranchReferenceName("master"),
+	})
+	s.NoError(err)
+	s.Empty(todo)
+}
+
+func (s *RepositorySuite) TestRebaseTodoCommands() {
+	r, w := setupMerge(s, map[string][]byte{"foo": []byte("foo\n")})
+	upstream := commitFiles(s, w, map[string][]byte{"bar": []byte("bar\n")})
+
+	s.checkoutBranch(w, "feature")
+	var hashes []plumbing.Hash
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		s.NoError(util.WriteFile(w.Filesystem, name, []byte(name+"\n"), 0o644))
+		_, err := w.Add(name)
+		s.NoError(err)
+
+		h, err := w.Commit(name+"\n", &CommitOptions{Author: &object.Signature{
+			Name: name, Email: name + "@fake.local", When: mergeSignature.When,
+		}})
+		s.NoError(err)
+		hashes = append(hashes, h)
+	}
+
+	s.NoError(w.Rebase(&RebaseOptions{
+		Upstream: upstream,
+		Commands: []RebaseCommand{
+			{Action: RebasePick, Commit: hashes[0]},
+			{Action: RebaseFixup, Commit: hashes[3]},
+			{Action: RebaseSquash, Commit: hashes[1]},
+			{Action: RebaseDrop, Commit: hashes[2]},
+			{Action: RebaseReword, Commit: hashes[4], Message: "reworded\n"},
+		},
+	}))
+
+	s.Equal([]string{"reworded\n", "a\n\nb\n", "commit"}, s.commitMessages(r, 3))
+
+	head, err := r.Head()
+	s.NoError(err)
+	c, err := r.CommitObject(head.Hash())
+	s.NoError(err)
+	s.Equal("e", c.Author.Name)
+
+	c, err = c.Parent(0)
+	s.NoError(err)
+	s.Equal("a", c.Author.Name)
+	s.Equal(upstream, c.ParentHashes[0])
+
+	_, err = c.File("d")
+	s.NoError(err)
+	_, err = c.File("c")
+	s.ErrorIs(err, object.ErrFileNotFound)
+}
+
+func (s *RepositorySuite) TestRebaseConflict() {
+	r, w := setupMerge(s, map[string][]byte{"foo": []byte("foo\n")})
+	upstream := commitFiles(s, w, map[string][]byte{"foo": []byte("bar\n")})
+
+	s.checkoutBranch(w, "feature")
+	conflicting := commitFiles(s, w, map[string][]byte{"foo": []byte("baz\n")})
+	commitFiles(s, w, map[string][]byte{"qux": []byte("qux\n")})
+
+	err := w.Rebase(&RebaseOptions{Upstream: upstream})
+	s.ErrorIs(err, ErrMergeConflict)
+	s.ErrorIs(w.Rebase(&RebaseOptions{Upstream: upstream}), ErrRebaseInProgress)
+
+	ref, err := r.Reference(plumbing.RebaseHead, false)
+	s.NoError(err)
+	s.Equal(conflicting, ref.Hash())
+
+	s.ErrorIs(w.RebaseContinue(), ErrUnmergedPaths)
+
+	s.NoError(util.WriteFile(w.Filesystem, "foo", []byte("bar\nbaz\n"), 0o644))
+	_, err = w.Add("foo")
+	s.NoError(err)
+	s.NoError(w.RebaseContinue())
+
+	head, err := r.Head()
+	s.NoError(err)
+	s.Equal(plumbing.NewBranchReferenceName("feature"), head.Name())
+
+	c, err := r.CommitObject(head.Hash())
+	s.NoError(err)
+	_, err = c.File("qux")
+	s.NoError(err)
+
+	c, err = c.Parent(0)
+	s.NoError(err)
+	s.Equal(mergeSignature.Name, c.Author.Name)
+	s.Equal(mergeSignature.When.Unix(), c.Author.When.Unix())
+	s.Equal(upstream, c.ParentHashes[0])
+
+	f, err := c.File("foo")
+	s.NoError(err)
+	content, err := f.Contents()
+	s.NoError(err)
+	s.Equal("bar\nbaz\n", content)
+
+	_, err = r.Reference(plumbing.RebaseHead, false)
+	s.ErrorIs(err, plumbing.ErrReferenceNotFound)
+	s.ErrorIs(w.RebaseContinue(), ErrNoRebaseInProgress)
+}
+
+func (s *RepositorySuite) TestRebaseSkip() {
+	r, w := setupMerge(s, map[string][]byte{"foo": []byte("foo\n")})
+	upstream := commitFiles(s, w, map[string][]byte{"foo": []byte("bar\n")})
+
+	s.checkoutBranch(w, "feature")
+	commitFiles(s, w, map[string][]byte{"foo": []byte("baz\n")})
+	commitFiles(s, w, map[string][]byte{"qux": []byte("qux\n")})
+
+	s.ErrorIs(w.Rebase(&RebaseOptions{Upstream: upstream}), ErrMergeConflict)
+	s.NoError(w.RebaseSkip())
+
+	head, err := r.Head()
+	s.NoError(err)
+	c, err := r.CommitObject(head.Hash())
+	s.NoError(err)
+	s.Equal([]plumbing.Hash{upstream}, c.ParentHashes)
+
+	content, err := util.ReadFile(w.Filesystem, "foo")
+	s.NoError(err)
+	s.Equal("bar\n", string(content))
+}
+
+func (s *RepositorySuite) TestRebaseAbort() {
+	r, w := setupMerge(s, map[string][]byte{"foo": []byte("foo\n")})
+	upstream := commitFiles(s, w, map[string][]byte{"foo": []byte("bar\n")})
+
+	s.checkoutBranch(w, "feature")
+	tip := commitFiles(s, w, map[string][]byte{"foo": []byte("baz\n")})
+
+	s.ErrorIs(w.Rebase(&RebaseOptions{Upstream: upstream}), ErrMergeConflict)
+	s.NoError(w.RebaseAbort())
+
+	head, err := r.Head()
+	s.NoError(err)
+	s.Equal(plumbing.NewBranchReferenceName("feature"), head.Name())
+	s.Equal(tip, head.Hash())
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.True(status.IsClean())
+
+	content, err := util.ReadFile(w.Filesystem, "foo")
+	s.NoError(err)
+	s.Equal("baz\n", string(content))
+
+	s.ErrorIs(w.RebaseAbort(), ErrNoRebaseInProgress)
+}
+
+func (s *RepositorySuite) TestRebaseInvalidTodo() {
+	_, w := setupMerge(s, map[string][]byte{"foo": []byte("foo\n")})
+	upstream := commitFiles(s, w, map[string][]byte{"foo": []byte("bar\n")})
+
+	err := w.Rebase(&RebaseOptions{
+		Upstream: upstream,
+		Commands: []RebaseCommand{{Action: RebaseSquash, Commit: upstream}},
+	})
+	s.ErrorIs(err, ErrInvalidRebaseTodo)
+
+	s.ErrorIs(w.Rebase(&RebaseOptions{}), ErrMissingUpstream)
+}
+
+func (s *RepositorySuite) TestRebaseNotSupported() {
+	r, err := Init(memory.NewStorage(), nil)
+	s.NoError(err)
+
+	w := &Worktree{r: r}
+	err = w.Rebase(&RebaseOptions{
+		Upstream:  plumbing.NewHash("b8e471f58bcbca63b07bda20e428190409c2db47"),
+		Committer: mergeSignature,
+	})
+	s.ErrorIs(err, ErrRebaseNotSupported)
+}
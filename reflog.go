@@ -0,0 +1,441 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/internal/revision"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/reflog"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage"
+)
+
+var (
+	// ErrReflogNotSupported is returned when the storer of the repository
+	// doesn't implement storer.ReflogStorer.
+	ErrReflogNotSupported = errors.New("reflog not supported by the storer")
+	// ErrReflogEntryNotFound is returned when resolving a revision such as
+	// <ref>@{<n>} or <ref>@{<date>} that is not covered by the reflog.
+	ErrReflogEntryNotFound = errors.New("reflog entry not found")
+)
+
+// Reflog returns the entries of the reflog of the reference with the given
+// name, sorted from the newest to the oldest update, so the entry at index n
+// is the one resolved by the revision <name>@{n}. An empty list is returned
+// if the reference has no reflog.
+func (r *Repository) Reflog(name plumbing.ReferenceName) ([]*reflog.Entry, error) {
+	s, ok := r.Storer.(storer.ReflogStorer)
+	if !ok {
+		return nil, ErrReflogNotSupported
+	}
+
+	entries, err := s.Reflog(name)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+
+	return entries, nil
+}
+
+// ExpireReflog removes the old entries of the reflogs, in the same way than
+// git reflog expire does.
+func (r *Repository) ExpireReflog(o *ExpireReflogOptions) error {
+	s, ok := r.Storer.(storer.ReflogStorer)
+	if !ok {
+		return ErrReflogNotSupported
+	}
+
+	if o == nil {
+		o = &ExpireReflogOptions{}
+	}
+
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
+	names := o.ReferenceNames
+	if len(names) == 0 {
+		var err error
+		names, err = r.reflogNames()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, name := range names {
+		if err := r.expireReflog(s, name, o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reflogNames returns the names of all the references which may have a
+// reflog, including HEAD.
+func (r *Repository) reflogNames() ([]plumbing.ReferenceName, error) {
+	names := []plumbing.ReferenceName{plumbing.HEAD}
+
+	refs, err := r.Storer.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Name() != plumbing.HEAD {
+			names = append(names, ref.Name())
+		}
+
+		return nil
+	})
+
+	return names, err
+}
+
+func (r *Repository) expireReflog(s storer.ReflogStorer, name plumbing.ReferenceName, o *ExpireReflogOptions) error {
+	entries, err := s.Reflog(name)
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+
+	var reachable map[plumbing.Hash]bool
+	isReachable := func(h plumbing.Hash) (bool, error) {
+		if reachable == nil {
+			reachable, err = r.reachableFrom(name)
+			if err != nil {
+				return false, err
+			}
+		}
+
+		return reachable[h], nil
+	}
+
+	kept := entries[:0]
+	for _, e := range entries {
+		when := e.Committer.When
+		if when.Before(o.Expire) {
+			continue
+		}
+
+		if when.Before(o.ExpireUnreachable) {
+			ok, err := isReachable(e.New)
+			if err != nil {
+				return err
+			}
+
+			if !ok {
+				continue
+			}
+		}
+
+		kept = append(kept, e)
+	}
+
+	return s.SetReflog(name, kept)
+}
+
+// reachableFrom returns the commits reachable from the commit pointed by the
+// reference with the given name.
+func (r *Repository) reachableFrom(name plumbing.ReferenceName) (map[plumbing.Hash]bool, error) {
+	reachable := make(map[plumbing.Hash]bool)
+
+	ref, err := r.Reference(name, true)
+	if err == plumbing.ErrReferenceNotFound {
+		return reachable, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := r.CommitObject(ref.Hash())
+	if err == plumbing.ErrObjectNotFound {
+		return reachable, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	iter := object.NewCommitPreorderIter(c, nil, nil)
+	err = iter.ForEach(func(c *object.Commit) error {
+		reachable[c.Hash] = true
+		return nil
+	})
+
+	return reachable, err
+}
+
+// setReference stores ref in s, recording the update in the reflog with the
+// given message. The reflog entry uses the name and email of committer, or
+// the identity from the configuration if it is nil.
+func setReference(s storage.Storer, ref *plumbing.Reference, committer *object.Signature, msg string) error {
+	return checkAndSetReference(s, ref, nil, committer, msg)
+}
+
+// checkAndSetReference is like setReference, but if old is not nil it first
+// checks that the stored value of the reference matches it, as
+// storer.ReferenceStorer.CheckAndSetReference does.
+func checkAndSetReference(s storage.Storer, ref, old *plumbing.Reference, committer *object.Signature, msg string) error {
+	from, err := referenceHash(s, ref.Name())
+	if err != nil {
+		return err
+	}
+
+	if err := s.CheckAndSetReference(ref, old); err != nil {
+		return err
+	}
+
+	to, err := referenceHash(s, ref.Name())
+	if err != nil {
+		return err
+	}
+
+	return logReferenceUpdate(s, ref.Name(), from, to, committer, msg)
+}
+
+// referenceHash returns the hash the reference with the given name resolves
+// to, or the zero hash if it doesn't exist.
+func referenceHash(s storer.ReferenceStorer, name plumbing.ReferenceName) (plumbing.Hash, error) {
+	ref, err := storer.ResolveReference(s, name)
+	if err == plumbing.ErrReferenceNotFound {
+		return plumbing.ZeroHash, nil
+	}
+
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return ref.Hash(), nil
+}
+
+// removeReference removes the reference with the given name from s, together
+// with its reflog.
+func removeReference(s storage.Storer, name plumbing.ReferenceName) error {
+	if err := s.RemoveReference(name); err != nil {
+		return err
+	}
+
+	if rs, ok := s.(storer.ReflogStorer); ok {
+		return rs.RemoveReflog(name)
+	}
+
+	return nil
+}
+
+// logReferenceUpdate records the update of the reference with the given name
+// from old to new in its reflog. The update is also recorded in the reflog of
+// HEAD when it points to the reference, as git does.
+func logReferenceUpdate(s storage.Storer, name plumbing.ReferenceName, old, new plumbing.Hash, committer *object.Signature, msg string) error {
+	rs, ok := s.(storer.ReflogStorer)
+	if !ok {
+		return nil
+	}
+
+	cfg, err := scopedConfig(s, config.SystemScope)
+	if err != nil {
+		return err
+	}
+
+	e := &reflog.Entry{Old: old, New: new, Message: msg}
+	switch {
+	case committer != nil:
+		e.Committer.Name, e.Committer.Email = committer.Name, committer.Email
+	case cfg.Committer.Name != "" || cfg.Committer.Email != "":
+		e.Committer.Name, e.Committer.Email = cfg.Committer.Name, cfg.Committer.Email
+	default:
+		e.Committer.Name, e.Committer.Email = cfg.User.Name, cfg.User.Email
+	}
+
+	// The time of the update is always used, even if the committer has a
+	// different one, so the entries are sorted in time.
+	e.Committer.When = time.Now()
+
+	if shouldLogReference(cfg, name) {
+		if err := rs.AppendReflog(name, e); err != nil {
+			return err
+		}
+	}
+
+	if name == plumbing.HEAD || !shouldLogReference(cfg, plumbing.HEAD) {
+		return nil
+	}
+
+	head, err := s.Reference(plumbing.HEAD)
+	if err != nil && err != plumbing.ErrReferenceNotFound {
+		return err
+	}
+
+	if head == nil || head.Type() != plumbing.SymbolicReference || head.Target() != name {
+		return nil
+	}
+
+	return rs.AppendReflog(plumbing.HEAD, e)
+}
+
+// shouldLogReference returns true if the updates of the reference with the
+// given name must be recorded in the reflog, according to the value of
+// core.logAllRefUpdates. The stash list is stored in the reflog of refs/stash,
+// so its updates are always recorded.
+func shouldLogReference(cfg *config.Config, name plumbing.ReferenceName) bool {
+	if name == plumbing.Stash {
+		return true
+	}
+
+	switch strings.ToLower(cfg.Core.LogAllRefUpdates) {
+	case "always":
+		return true
+	case "false":
+		return false
+	case "":
+		if cfg.Core.IsBare {
+			return false
+		}
+	}
+
+	return name == plumbing.HEAD ||
+		name.IsBranch() ||
+		name.IsRemote() ||
+		name.IsNote()
+}
+
+// resolveReflog returns the hash the reference with the given name pointed to
+// n updates ago.
+func (r *Repository) resolveReflog(name plumbing.ReferenceName, n int) (plumbing.Hash, error) {
+	entries, err := r.Reflog(name)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if n == 0 && len(entries) == 0 {
+		ref, err := r.Reference(name, true)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		return ref.Hash(), nil
+	}
+
+	if n < len(entries) {
+		return entries[n].New, nil
+	}
+
+	// The oldest entry records the value of the reference before it, as git
+	// does when the reflog was truncated.
+	if n == len(entries) && !entries[n-1].Old.IsZero() {
+		return entries[n-1].Old, nil
+	}
+
+	return plumbing.ZeroHash, ErrReflogEntryNotFound
+}
+
+// resolveReflogDate returns the hash the reference with the given name
+// pointed to at the given time.
+func (r *Repository) resolveReflogDate(name plumbing.ReferenceName, t time.Time) (plumbing.Hash, error) {
+	entries, err := r.Reflog(name)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if len(entries) == 0 {
+		return plumbing.ZeroHash, ErrReflogEntryNotFound
+	}
+
+	for _, e := range entries {
+		if !e.Committer.When.After(t) {
+			return e.New, nil
+		}
+	}
+
+	// The date is older than the whole reflog, as git does the oldest known
+	// value is used.
+	oldest := entries[len(entries)-1]
+	if !oldest.Old.IsZero() {
+		return oldest.Old, nil
+	}
+
+	return oldest.New, nil
+}
+
+// reflogRevisionIndex returns the index of the <ref>@{<n>} or <ref>@{<date>}
+// statement of the parsed revision, -1 if there is none.
+func reflogRevisionIndex(items []revision.Revisioner) int {
+	for i, item := range items {
+		switch item.(type) {
+		case revision.AtReflog, revision.AtDate:
+			return i
+		}
+	}
+
+	return -1
+}
+
+// resolveReflogRevision resolves the parsed revisions <ref>@{<n>} and
+// <ref>@{<date>}, the last one of the given items. When the reference is
+// omitted, the current branch is used.
+func (r *Repository) resolveReflogRevision(items []revision.Revisioner) (*plumbing.Hash, error) {
+	name, err := r.reflogReferenceName(items)
+	if err != nil {
+		return &plumbing.ZeroHash, err
+	}
+
+	var h plumbing.Hash
+	switch item := items[len(items)-1].(type) {
+	case revision.AtReflog:
+		h, err = r.resolveReflog(name, item.Depth)
+	case revision.AtDate:
+		h, err = r.resolveReflogDate(name, item.Date)
+	}
+
+	if err != nil {
+		return &plumbing.ZeroHash, err
+	}
+
+	h, err = r.resolveToCommitHash(h)
+	if err != nil {
+		return &plumbing.ZeroHash, err
+	}
+
+	return &h, nil
+}
+
+// reflogReferenceName returns the full name of the reference of the given
+// reflog revision.
+func (r *Repository) reflogReferenceName(items []revision.Revisioner) (plumbing.ReferenceName, error) {
+	ref, ok := items[0].(revision.Ref)
+	if !ok {
+		head, err := r.Storer.Reference(plumbing.HEAD)
+		if err != nil {
+			return "", err
+		}
+
+		if head.Type() == plumbing.SymbolicReference {
+			return head.Target(), nil
+		}
+
+		return plumbing.HEAD, nil
+	}
+
+	for _, rule := range plumbing.RefRevParseRules {
+		name := plumbing.ReferenceName(fmt.Sprintf(rule, ref))
+		_, err := r.Storer.Reference(name)
+		if err == nil {
+			return name, nil
+		}
+
+		if err != plumbing.ErrReferenceNotFound {
+			return "", err
+		}
+	}
+
+	return "", plumbing.ErrReferenceNotFound
+}
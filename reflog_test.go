@@ -0,0 +1,227 @@
+package git
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/reflog"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+func reflogMessages(entries []*reflog.Entry) []string {
+	var msgs []string
+	for _, e := range entries {
+		msgs = append(msgs, e.Message)
+	}
+
+	return msgs
+}
+
+func (s *RepositorySuite) TestReflog() {
+	r, w := setupMerge(s, map[string][]byte{"foo": []byte("foo\n")})
+	first, err := r.Head()
+	s.NoError(err)
+
+	second := commitFiles(s, w, map[string][]byte{"foo": []byte("bar\n")})
+	s.NoError(w.Checkout(&CheckoutOptions{
+		Branch: plumbing.NewBranchReferenceName("topic"),
+		Create: true,
+	}))
+	s.NoError(w.Reset(&ResetOptions{Commit: first.Hash(), Mode: HardReset}))
+	s.checkoutBranch(w, "master")
+
+	head, err := r.Reflog(plumbing.HEAD)
+	s.NoError(err)
+	s.Equal([]string{
+		"checkout: moving from topic to master",
+		"reset: moving to " + first.Hash().String(),
+		"checkout: moving from master to topic",
+		"commit: commit",
+		"commit (initial): commit",
+	}, reflogMessages(head))
+
+	s.Equal(second, head[0].New)
+	s.Equal(first.Hash(), head[0].Old)
+	s.Equal(mergeSignature.Name, head[3].Committer.Name)
+	s.Equal(mergeSignature.Email, head[3].Committer.Email)
+	s.True(head[4].Old.IsZero())
+
+	master, err := r.Reflog(plumbing.Master)
+	s.NoError(err)
+	s.Equal([]string{"commit: commit", "commit (initial): commit"}, reflogMessages(master))
+
+	topic, err := r.Reflog(plumbing.NewBranchReferenceName("topic"))
+	s.NoError(err)
+	s.Equal([]string{
+		"reset: moving to " + first.Hash().String(),
+		"branch: Created from HEAD",
+	}, reflogMessages(topic))
+
+	tags, err := r.Reflog(plumbing.NewTagReferenceName("v1.0.0"))
+	s.NoError(err)
+	s.Len(tags, 0)
+}
+
+func (s *RepositorySuite) TestReflogBare() {
+	r, err := Init(memory.NewStorage(), nil)
+	s.NoError(err)
+
+	h := plumbing.NewHash("b8e471f58bcbca63b07bda20e428190409c2db47")
+	s.NoError(setReference(r.Storer, plumbing.NewHashReference(plumbing.Master, h), nil, "foo"))
+
+	entries, err := r.Reflog(plumbing.Master)
+	s.NoError(err)
+	s.Len(entries, 0)
+
+	cfg, err := r.Config()
+	s.NoError(err)
+	cfg.Core.LogAllRefUpdates = "always"
+	s.NoError(r.SetConfig(cfg))
+
+	s.NoError(setReference(r.Storer, plumbing.NewHashReference(plumbing.Master, h), nil, "foo"))
+	entries, err = r.Reflog(plumbing.Master)
+	s.NoError(err)
+	s.Len(entries, 1)
+}
+
+func (s *RepositorySuite) TestReflogFilesystem() {
+	r, err := PlainInit(s.T().TempDir(), false)
+	s.NoError(err)
+
+	w, err := r.Worktree()
+	s.NoError(err)
+
+	s.NoError(util.WriteFile(w.Filesystem, "foo", []byte("foo\n"), 0o644))
+	_, err = w.Add("foo")
+	s.NoError(err)
+	h, err := w.Commit("foo\n\nbar\n", &CommitOptions{Author: mergeSignature})
+	s.NoError(err)
+
+	content, err := util.ReadFile(w.Filesystem, ".git/logs/HEAD")
+	s.NoError(err)
+
+	entries, err := reflog.NewDecoder(bytes.NewReader(content)).Decode()
+	s.NoError(err)
+	s.Len(entries, 1)
+	s.Equal(h, entries[0].New)
+	s.Equal("commit (initial): foo", entries[0].Message)
+}
+
+func (s *RepositorySuite) TestReflogResolveRevision() {
+	r, w := setupMerge(s, map[string][]byte{"foo": []byte("foo\n")})
+	first, err := r.Head()
+	s.NoError(err)
+
+	second := commitFiles(s, w, map[string][]byte{"foo": []byte("bar\n")})
+	third := commitFiles(s, w, map[string][]byte{"foo": []byte("baz\n")})
+	s.NoError(w.Checkout(&CheckoutOptions{Hash: second}))
+
+	for rev, expected := range map[string]plumbing.Hash{
+		"HEAD@{0}":              second,
+		"HEAD@{1}":              third,
+		"HEAD@{3}":              first.Hash(),
+		"master@{0}":            third,
+		"master@{1}":            second,
+		"refs/heads/master@{2}": first.Hash(),
+		"feature@{0}":           first.Hash(),
+		"@{1}":                  third,
+		"HEAD@{now}":            second,
+		"HEAD@{1}~1":            second,
+		"HEAD@{1}~2":            first.Hash(),
+		"master@{1}^":           first.Hash(),
+		"@{1}^":                 second,
+		"HEAD@{now}~1":          first.Hash(),
+	} {
+		h, err := r.ResolveRevision(plumbing.Revision(rev))
+		s.NoError(err, rev)
+		s.Equal(expected, *h, rev)
+	}
+
+	_, err = r.ResolveRevision("master@{3}")
+	s.ErrorIs(err, ErrReflogEntryNotFound)
+
+	_, err = r.ResolveRevision("foo@{1}")
+	s.ErrorIs(err, plumbing.ErrReferenceNotFound)
+}
+
+func (s *RepositorySuite) TestReflogResolveRevisionDate() {
+	r, w := setupMerge(s, map[string][]byte{"foo": []byte("foo\n")})
+	first, err := r.Head()
+	s.NoError(err)
+
+	second := commitFiles(s, w, map[string][]byte{"foo": []byte("bar\n")})
+
+	now := time.Now()
+	rs := r.Storer.(storer.ReflogStorer)
+	s.NoError(rs.SetReflog(plumbing.Master, []*reflog.Entry{
+		{New: first.Hash(), Committer: reflog.Signature{When: now.AddDate(0, 0, -10)}},
+		{Old: first.Hash(), New: second, Committer: reflog.Signature{When: now.Add(-time.Hour)}},
+	}))
+
+	for rev, expected := range map[string]plumbing.Hash{
+		"master@{now}":            second,
+		"master@{30.minutes.ago}": second,
+		"master@{2.hours.ago}":    first.Hash(),
+		"master@{yesterday}":      first.Hash(),
+		"@{1.year.ago}":           first.Hash(),
+	} {
+		h, err := r.ResolveRevision(plumbing.Revision(rev))
+		s.NoError(err, rev)
+		s.Equal(expected, *h, rev)
+	}
+
+	_, err = r.ResolveRevision("feature@{yesterday}")
+	s.ErrorIs(err, ErrReflogEntryNotFound)
+}
+
+func (s *RepositorySuite) TestExpireReflog() {
+	r, err := Init(memory.NewStorage(), memfs.New())
+	s.NoError(err)
+	rs := r.Storer.(storer.ReflogStorer)
+
+	w, err := r.Worktree()
+	s.NoError(err)
+
+	reachable := commitFiles(s, w, map[string][]byte{"foo": []byte("foo\n")})
+	unreachable := plumbing.NewHash("a8d315b2b1c615d43042c3a62402b8a54288cf5c")
+	now := time.Now()
+
+	entries := []*reflog.Entry{
+		{New: reachable, Committer: reflog.Signature{When: now.AddDate(0, 0, -100)}, Message: "old"},
+		{New: unreachable, Committer: reflog.Signature{When: now.AddDate(0, 0, -40)}, Message: "old unreachable"},
+		{New: reachable, Committer: reflog.Signature{When: now.AddDate(0, 0, -40)}, Message: "old reachable"},
+		{New: unreachable, Committer: reflog.Signature{When: now.AddDate(0, 0, -1)}, Message: "recent unreachable"},
+	}
+	s.NoError(rs.SetReflog(plumbing.Master, entries))
+	s.NoError(rs.SetReflog(plumbing.HEAD, entries))
+
+	s.NoError(r.ExpireReflog(&ExpireReflogOptions{
+		ReferenceNames: []plumbing.ReferenceName{plumbing.Master},
+	}))
+
+	master, err := r.Reflog(plumbing.Master)
+	s.NoError(err)
+	s.Equal([]string{"recent unreachable", "old reachable"}, reflogMessages(master))
+
+	head, err := r.Reflog(plumbing.HEAD)
+	s.NoError(err)
+	s.Len(head, 4)
+
+	s.NoError(r.ExpireReflog(&ExpireReflogOptions{Expire: now}))
+	head, err = r.Reflog(plumbing.HEAD)
+	s.NoError(err)
+	s.Len(head, 0)
+}
+
+func (s *RepositorySuite) TestReflogNotSupported() {
+	r, err := Init(struct{ storage.Storer }{memory.NewStorage()}, nil)
+	s.NoError(err)
+
+	_, err = r.Reflog(plumbing.HEAD)
+	s.ErrorIs(err, ErrReflogNotSupported)
+}
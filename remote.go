@@ -1,10 +1,14 @@
 package git
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
@@ -14,8 +18,10 @@ import (
 	"github.com/go-git/go-git/v5/internal/url"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/cache"
+	formatcfg "github.com/go-git/go-git/v5/plumbing/format/config"
 	"github.com/go-git/go-git/v5/plumbing/format/packfile"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/protocol"
 	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
 	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
 	"github.com/go-git/go-git/v5/plumbing/protocol/packp/sideband"
@@ -35,6 +41,7 @@ var (
 	ErrExactSHA1NotSupported = errors.New("server does not support exact SHA1 refspec")
 	ErrEmptyUrls             = errors.New("URLs cannot be empty")
 	ErrFilterNotSupported    = errors.New("server does not support filters")
+	ErrPackfileURIChecksum   = errors.New("packfile checksum mismatch")
 )
 
 type NoMatchingRefSpecError struct {
@@ -360,11 +367,11 @@ func (r *Remote) updateRemoteReferenceStorage(
 			ref := plumbing.NewHashReference(local, c.New)
 			switch c.Action() {
 			case packp.Create, packp.Update:
-				if err := r.s.SetReference(ref); err != nil {
+				if err := setReference(r.s, ref, nil, "update by push"); err != nil {
 					return err
 				}
 			case packp.Delete:
-				if err := r.s.RemoveReference(local); err != nil {
+				if err := removeReference(r.s, local); err != nil {
 					return err
 				}
 			}
@@ -397,6 +404,21 @@ func (r *Remote) Fetch(o *FetchOptions) error {
 	return r.FetchContext(context.Background(), o)
 }
 
+// prerequisitesVerifier is implemented by the sessions sending packfiles that
+// refer to objects the repository must have, as the ones of bundles. Their
+// packfiles may be thin if they have prerequisites.
+type prerequisitesVerifier interface {
+	HasPrerequisites() (bool, error)
+	VerifyPrerequisites(storer.EncodedObjectStorer) error
+}
+
+// objectsFetcher is implemented by the sessions that may fetch the objects
+// into the storage themselves instead of sending a packfile, as the ones of
+// dumb HTTP servers.
+type objectsFetcher interface {
+	FetchObjects(context.Context, *packp.UploadPackRequest, storer.Storer) (bool, error)
+}
+
 func (r *Remote) fetch(ctx context.Context, o *FetchOptions) (sto storer.ReferenceStorer, err error) {
 	if o.RemoteName == "" {
 		o.RemoteName = r.c.Name
@@ -414,14 +436,19 @@ func (r *Remote) fetch(ctx context.Context, o *FetchOptions) (sto storer.Referen
 		o.RemoteURL = r.c.URLs[0]
 	}
 
-	s, err := newUploadPackSession(o.RemoteURL, o.Auth, o.InsecureSkipTLS, o.CABundle, o.ProxyOptions)
+	if o.Filter == "" && r.c.Promisor {
+		o.Filter = packp.Filter(r.c.PartialCloneFilter)
+	}
+
+	version := r.protocolVersion()
+	s, err := newUploadPackSession(o.RemoteURL, o.Auth, o.InsecureSkipTLS, o.CABundle, o.ProxyOptions, version)
 	if err != nil {
 		return nil, err
 	}
 
 	defer ioutil.CheckClose(s, &err)
 
-	ar, err := s.AdvertisedReferencesContext(ctx)
+	ar, err := lsRefs(ctx, s, version, refPrefixes(o.RefSpecs, o.Tags), o.ServerOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -458,13 +485,37 @@ func (r *Remote) fetch(ctx context.Context, o *FetchOptions) (sto storer.Referen
 	}
 
 	req.Wants, err = getWants(r.s, refs, o.Depth)
-	if len(req.Wants) > 0 {
+	if req.Capabilities.Supports(capability.RefInWant) {
+		req.WantRefs, req.Wants = wantRefs(o.RefSpecs, specToRefs, refs, req.Wants)
+	}
+
+	if len(req.Wants) > 0 || len(req.WantRefs) > 0 {
 		req.Haves, err = getHaves(localRefs, remoteRefs, r.s, o.Depth)
 		if err != nil {
 			return nil, err
 		}
 
-		if err = r.fetchPack(ctx, o, s, req); err != nil {
+		if v, ok := s.(prerequisitesVerifier); ok {
+			if err = v.VerifyPrerequisites(r.s); err != nil {
+				return nil, err
+			}
+		}
+
+		if err = r.fetchPack(ctx, o, s, req, remoteRefs); err != nil {
+			return nil, err
+		}
+
+		if o.Filter != "" && !r.c.Promisor {
+			if err = r.registerPromisor(o.Filter); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(req.WantRefs) > 0 {
+		// The wanted references may have been updated since listed.
+		refs, specToRefs, err = calculateRefs(o.RefSpecs, remoteRefs, o.Tags)
+		if err != nil {
 			return nil, err
 		}
 	}
@@ -530,15 +581,144 @@ func depthChanged(before []plumbing.Hash, s storage.Storer) (bool, error) {
 	return false, nil
 }
 
-func newUploadPackSession(url string, auth transport.AuthMethod, insecure bool, cabundle []byte, proxyOpts transport.ProxyOptions) (transport.UploadPackSession, error) {
+func newUploadPackSession(url string, auth transport.AuthMethod, insecure bool, cabundle []byte, proxyOpts transport.ProxyOptions, version protocol.Version) (transport.UploadPackSession, error) {
 	c, ep, err := newClient(url, insecure, cabundle, proxyOpts)
 	if err != nil {
 		return nil, err
 	}
 
+	ep.ProtocolVersion = version
 	return c.NewUploadPackSession(ep, auth)
 }
 
+// protocolVersion returns the version of the protocol requested on the
+// upload-pack sessions, set by the protocol.version option of any scope.
+func (r *Remote) protocolVersion() protocol.Version {
+	if r.s == nil {
+		return config.DefaultProtocolVersion
+	}
+
+	cfg, err := scopedConfig(r.s, config.SystemScope)
+	if err != nil {
+		return config.DefaultProtocolVersion
+	}
+
+	return cfg.Protocol.Version
+}
+
+// lsRefs returns the references of the remote. If the version 2 of the
+// protocol is requested, only the ones matching the prefixes are listed,
+// filtered by the server if it supports the ls-refs command.
+func lsRefs(ctx context.Context, s transport.UploadPackSession, version protocol.Version,
+	prefixes, serverOptions []string,
+) (*packp.AdvRefs, error) {
+	l, ok := s.(transport.RefLister)
+	if !ok || version != protocol.V2 {
+		if len(serverOptions) != 0 {
+			return nil, transport.ErrServerOptionsNotSupported
+		}
+
+		return s.AdvertisedReferencesContext(ctx)
+	}
+
+	req := packp.NewLsRefsRequest()
+	req.Prefixes = prefixes
+	req.ServerOptions = serverOptions
+
+	ar, err := l.LsRefs(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if ar.IsEmpty() {
+		return nil, transport.ErrEmptyRemoteRepository
+	}
+
+	return ar, nil
+}
+
+// refPrefixes returns the prefixes of the references matched by the refspecs,
+// as well as HEAD and the tags unless tags aren't fetched. It returns nil if
+// all the references are matched.
+func refPrefixes(specs []config.RefSpec, tags plumbing.TagMode) []string {
+	prefixes := []string{plumbing.HEAD.String()}
+	if tags != plumbing.NoTags {
+		prefixes = append(prefixes, "refs/tags/")
+	}
+
+	for _, spec := range specs {
+		if spec.IsExactSHA1() {
+			continue
+		}
+
+		src := spec.Src()
+		if spec.IsWildcard() {
+			prefix := src[:strings.Index(src, "*")]
+			if prefix == "" {
+				return nil
+			}
+
+			prefixes = append(prefixes, prefix)
+			continue
+		}
+
+		for _, rule := range plumbing.RefRevParseRules {
+			prefixes = append(prefixes, fmt.Sprintf(rule, src))
+		}
+	}
+
+	return prefixes
+}
+
+// wantRefs moves the wants of the references matched by name by the refspecs
+// to the wanted references, resolved by the server once the request is
+// received. The wants of any other reference are kept.
+func wantRefs(specs []config.RefSpec, specToRefs [][]*plumbing.Reference,
+	refs memory.ReferenceStorage, wants []plumbing.Hash,
+) ([]plumbing.ReferenceName, []plumbing.Hash) {
+	wanted := make(map[plumbing.Hash]bool, len(wants))
+	for _, h := range wants {
+		wanted[h] = true
+	}
+
+	byName := make(map[plumbing.ReferenceName]bool)
+	for i, spec := range specs {
+		if spec.IsWildcard() || spec.IsExactSHA1() || i >= len(specToRefs) {
+			continue
+		}
+
+		for _, ref := range specToRefs[i] {
+			if ref.Name().IsBranch() || ref.Name().IsTag() || ref.Name().IsRemote() {
+				byName[ref.Name()] = true
+			}
+		}
+	}
+
+	keep := make(map[plumbing.Hash]bool)
+	for name, ref := range refs {
+		if !byName[name] {
+			keep[ref.Hash()] = true
+		}
+	}
+
+	var names []plumbing.ReferenceName
+	for name := range byName {
+		if wanted[refs[name].Hash()] {
+			names = append(names, name)
+		}
+	}
+
+	var rest []plumbing.Hash
+	for _, h := range wants {
+		if keep[h] {
+			rest = append(rest, h)
+		}
+	}
+
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names, rest
+}
+
 func newSendPackSession(url string, auth transport.AuthMethod, insecure bool, cabundle []byte, proxyOpts transport.ProxyOptions) (transport.ReceivePackSession, error) {
 	c, ep, err := newClient(url, insecure, cabundle, proxyOpts)
 	if err != nil {
@@ -566,8 +746,14 @@ func newClient(url string, insecure bool, cabundle []byte, proxyOpts transport.P
 }
 
 func (r *Remote) fetchPack(ctx context.Context, o *FetchOptions, s transport.UploadPackSession,
-	req *packp.UploadPackRequest,
+	req *packp.UploadPackRequest, remoteRefs memory.ReferenceStorage,
 ) (err error) {
+	if f, ok := s.(objectsFetcher); ok {
+		if fetched, err := f.FetchObjects(ctx, req, r.s); fetched || err != nil {
+			return err
+		}
+	}
+
 	reader, err := s.UploadPack(ctx, req)
 	if err != nil {
 		if errors.Is(err, transport.ErrEmptyUploadPackRequest) {
@@ -583,15 +769,161 @@ func (r *Remote) fetchPack(ctx context.Context, o *FetchOptions, s transport.Upl
 		return err
 	}
 
-	if err = packfile.UpdateObjectStorage(r.s,
-		buildSidebandIfSupported(req.Capabilities, reader, o.Progress),
-	); err != nil {
+	for _, ref := range reader.WantedRefs {
+		if err = remoteRefs.SetReference(ref); err != nil {
+			return err
+		}
+	}
+
+	var thin bool
+	if v, ok := s.(prerequisitesVerifier); ok {
+		if thin, err = v.HasPrerequisites(); err != nil {
+			return err
+		}
+	}
+
+	pack := buildSidebandIfSupported(req.Capabilities, reader, o.Progress)
+	if thin {
+		err = packfile.UpdateThinObjectStorage(r.s, pack)
+	} else {
+		err = r.updateObjectStorage(o, pack)
+	}
+
+	if err != nil {
 		return err
 	}
 
+	for _, uri := range reader.PackfileURIs {
+		if err = r.fetchPackfileURI(ctx, o, uri); err != nil {
+			return err
+		}
+	}
+
 	return err
 }
 
+// fetchPackfileURI downloads a packfile sent as URI by the server, with one
+// of the protocols accepted by the fetch options, verifying its checksum.
+func (r *Remote) fetchPackfileURI(ctx context.Context, o *FetchOptions, uri packp.PackfileURI) error {
+	ep, err := transport.NewEndpoint(uri.URI)
+	if err != nil {
+		return err
+	}
+
+	if !slices.Contains(o.PackfileURIProtocols, ep.Protocol) ||
+		(ep.Protocol != "http" && ep.Protocol != "https") {
+		return fmt.Errorf("unsupported packfile URI protocol %q", ep.Protocol)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri.URI, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(res.Body, &err)
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("downloading packfile %s: %s", uri.URI, res.Status)
+	}
+
+	pack, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if len(pack) < len(uri.Hash) || !bytes.Equal(pack[len(pack)-len(uri.Hash):], uri.Hash[:]) {
+		return fmt.Errorf("%w: %s", ErrPackfileURIChecksum, uri.URI)
+	}
+
+	return r.updateObjectStorage(o, bytes.NewReader(pack))
+}
+
+// updateObjectStorage writes the packfile fetched to the storage, as fetched
+// from a promisor remote if it's filtered or the remote is already one.
+func (r *Remote) updateObjectStorage(o *FetchOptions, pack io.Reader) error {
+	if o.Filter != "" || r.c.Promisor {
+		return packfile.UpdatePromisorObjectStorage(r.s, pack)
+	}
+
+	return packfile.UpdateObjectStorage(r.s, pack)
+}
+
+// registerPromisor configures the remote as a promisor remote, the one the
+// objects omitted by the filter are fetched from, as git does the first time
+// it fetches with a filter.
+func (r *Remote) registerPromisor(filter packp.Filter) error {
+	cfg, err := r.s.Config()
+	if err != nil {
+		return err
+	}
+
+	c, ok := cfg.Remotes[r.c.Name]
+	if !ok {
+		// Anonymous remotes can't be promisor remotes.
+		return nil
+	}
+
+	c.Promisor = true
+	c.PartialCloneFilter = string(filter)
+	r.c.Promisor = true
+	r.c.PartialCloneFilter = c.PartialCloneFilter
+
+	cfg.Core.RepositoryFormatVersion = formatcfg.Version_1
+	if cfg.Extensions.PartialClone == "" {
+		cfg.Extensions.PartialClone = r.c.Name
+	}
+
+	return r.s.SetConfig(cfg)
+}
+
+// fetchObjects fetches the given objects from the promisor remote, without
+// negotiation nor updating any reference, as git does to fetch the objects
+// missing in a partial clone.
+func (r *Remote) fetchObjects(ctx context.Context, o *FetchOptions, hashes []plumbing.Hash) (err error) {
+	if err = o.Validate(); err != nil {
+		return err
+	}
+
+	if o.RemoteURL == "" {
+		o.RemoteURL = r.c.URLs[0]
+	}
+
+	if o.Filter == "" {
+		o.Filter = packp.Filter(r.c.PartialCloneFilter)
+	}
+
+	version := r.protocolVersion()
+	s, err := newUploadPackSession(o.RemoteURL, o.Auth, o.InsecureSkipTLS, o.CABundle, o.ProxyOptions, version)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(s, &err)
+
+	ar, err := lsRefs(ctx, s, version, nil, o.ServerOptions)
+	if err != nil {
+		return err
+	}
+
+	req, err := r.newUploadPackRequest(o, ar)
+	if err != nil {
+		return err
+	}
+
+	remoteRefs, err := ar.AllReferences()
+	if err != nil {
+		return err
+	}
+
+	req.Wants = hashes
+	return r.fetchPack(ctx, o, s, req, remoteRefs)
+}
+
 func (r *Remote) pruneRemotes(specs []config.RefSpec, localRefs []*plumbing.Reference, remoteRefs memory.ReferenceStorage) (bool, error) {
 	var updatedPrune bool
 	for _, spec := range specs {
@@ -603,7 +935,7 @@ func (r *Remote) pruneRemotes(specs []config.RefSpec, localRefs []*plumbing.Refe
 			_, err := remoteRefs.Reference(rev.Dst(ref.Name()))
 			if errors.Is(err, plumbing.ErrReferenceNotFound) {
 				updatedPrune = true
-				err := r.s.RemoveReference(ref.Name())
+				err := removeReference(r.s, ref.Name())
 				if err != nil {
 					return false, err
 				}
@@ -1084,7 +1416,7 @@ func getWants(localStorer storage.Storer, refs memory.ReferenceStorage, depth in
 }
 
 func objectExists(s storer.EncodedObjectStorer, h plumbing.Hash) (bool, error) {
-	_, err := s.EncodedObject(plumbing.AnyObject, h)
+	err := s.HasEncodedObject(h)
 	if err == plumbing.ErrObjectNotFound {
 		return false, nil
 	}
@@ -1169,6 +1501,30 @@ func (r *Remote) newUploadPackRequest(o *FetchOptions,
 		}
 	}
 
+	if len(o.ServerOptions) != 0 {
+		if !ar.Capabilities.Supports(capability.ServerOption) {
+			return nil, transport.ErrServerOptionsNotSupported
+		}
+
+		req.ServerOptions = o.ServerOptions
+		if err := req.Capabilities.Set(capability.ServerOption); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(o.PackfileURIProtocols) != 0 && ar.Capabilities.Supports(capability.PackfileURIs) {
+		req.PackfileURIProtocols = o.PackfileURIProtocols
+		if err := req.Capabilities.Set(capability.PackfileURIs); err != nil {
+			return nil, err
+		}
+	}
+
+	if ar.Capabilities.Supports(capability.RefInWant) {
+		if err := req.Capabilities.Set(capability.RefInWant); err != nil {
+			return nil, err
+		}
+	}
+
 	if o.Filter != "" {
 		if ar.Capabilities.Supports(capability.Filter) {
 			req.Filter = o.Filter
@@ -1262,21 +1618,28 @@ func (r *Remote) updateLocalReferenceStorage(
 			old, _ := storer.ResolveReference(r.s, localName)
 			new := plumbing.NewHashReference(localName, ref.Hash())
 
-			// If the ref exists locally as a non-tag and force is not
-			// specified, only update if the new ref is an ancestor of the old
-			if old != nil && !old.Name().IsTag() && !force && !spec.IsForceUpdate() {
+			msg := "fetch: storing head"
+			if old != nil && !old.Name().IsTag() && old.Hash() != new.Hash() {
+				forced := force || spec.IsForceUpdate()
 				ff, err := isFastForward(r.s, old.Hash(), new.Hash(), nil)
-				if err != nil {
+				if err != nil && !forced {
 					return updated, err
 				}
 
-				if !ff {
+				// If the ref exists locally as a non-tag and force is not
+				// specified, only update if the new ref is an ancestor of the old
+				if !ff && !forced {
 					forceNeeded = true
 					continue
 				}
+
+				msg = "fetch: fast-forward"
+				if !ff {
+					msg = "fetch: forced-update"
+				}
 			}
 
-			refUpdated, err := checkAndUpdateReferenceStorerIfNeeded(r.s, new, old)
+			refUpdated, err := checkAndUpdateReferenceStorerIfNeeded(r.s, new, old, msg)
 			if err != nil {
 				return updated, err
 			}
@@ -1317,7 +1680,7 @@ func (r *Remote) buildFetchedTags(refs memory.ReferenceStorage) (updated bool, e
 			continue
 		}
 
-		_, err := r.s.EncodedObject(plumbing.AnyObject, ref.Hash())
+		err := r.s.HasEncodedObject(ref.Hash())
 		if err == plumbing.ErrObjectNotFound {
 			continue
 		}
@@ -1326,7 +1689,7 @@ func (r *Remote) buildFetchedTags(refs memory.ReferenceStorage) (updated bool, e
 			return false, err
 		}
 
-		refUpdated, err := updateReferenceStorerIfNeeded(r.s, ref)
+		refUpdated, err := updateReferenceStorerIfNeeded(r.s, ref, "fetch: storing head")
 		if err != nil {
 			return updated, err
 		}
@@ -1366,14 +1729,15 @@ func (r *Remote) list(ctx context.Context, o *ListOptions) (rfs []*plumbing.Refe
 		return nil, ErrEmptyUrls
 	}
 
-	s, err := newUploadPackSession(r.c.URLs[0], o.Auth, o.InsecureSkipTLS, o.CABundle, o.ProxyOptions)
+	version := r.protocolVersion()
+	s, err := newUploadPackSession(r.c.URLs[0], o.Auth, o.InsecureSkipTLS, o.CABundle, o.ProxyOptions, version)
 	if err != nil {
 		return nil, err
 	}
 
 	defer ioutil.CheckClose(s, &err)
 
-	ar, err := s.AdvertisedReferencesContext(ctx)
+	ar, err := lsRefs(ctx, s, version, nil, o.ServerOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -1492,7 +1856,7 @@ func pushHashes(
 }
 
 func (r *Remote) updateShallow(o *FetchOptions, resp *packp.UploadPackResponse) error {
-	if o.Depth == 0 || len(resp.Shallows) == 0 {
+	if o.Depth == 0 || len(resp.Shallows) == 0 && len(resp.Unshallows) == 0 {
 		return nil
 	}
 
@@ -1501,17 +1865,29 @@ func (r *Remote) updateShallow(o *FetchOptions, resp *packp.UploadPackResponse)
 		return err
 	}
 
+	unshallows := make(map[plumbing.Hash]bool, len(resp.Unshallows))
+	for _, h := range resp.Unshallows {
+		unshallows[h] = true
+	}
+
+	var updated []plumbing.Hash
+	for _, s := range shallows {
+		if !unshallows[s] {
+			updated = append(updated, s)
+		}
+	}
+
 outer:
 	for _, s := range resp.Shallows {
-		for _, oldS := range shallows {
+		for _, oldS := range updated {
 			if s == oldS {
 				continue outer
 			}
 		}
-		shallows = append(shallows, s)
+		updated = append(updated, s)
 	}
 
-	return r.s.SetShallow(shallows)
+	return r.s.SetShallow(updated)
 }
 
 func (r *Remote) checkRequireRemoteRefs(requires []config.RefSpec, remoteRefs storer.ReferenceStorer) error {
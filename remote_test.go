@@ -22,9 +22,11 @@ import (
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/cache"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/protocol"
 	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
 	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
 	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/storage"
 	"github.com/go-git/go-git/v5/storage/filesystem"
 	"github.com/go-git/go-git/v5/storage/memory"
@@ -332,6 +334,52 @@ func (s *RemoteSuite) TestFetchWithDepthChange() {
 	s.Len(r.s.(*memory.Storage).Commits, 3)
 }
 
+func (s *RemoteSuite) TestFetchProtocolV2() {
+	st := memory.NewStorage()
+	cfg, err := st.Config()
+	s.NoError(err)
+	cfg.Protocol.Version = protocol.V2
+	s.NoError(st.SetConfig(cfg))
+
+	r := NewRemote(st, &config.RemoteConfig{
+		URLs: []string{s.GetBasicLocalRepositoryURL()},
+	})
+
+	s.testFetch(r, &FetchOptions{
+		Depth: 1,
+		RefSpecs: []config.RefSpec{
+			config.RefSpec("+refs/heads/*:refs/remotes/origin/*"),
+		},
+	}, []*plumbing.Reference{
+		plumbing.NewReferenceFromStrings("refs/remotes/origin/master", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+		plumbing.NewReferenceFromStrings("refs/remotes/origin/branch", "e8d3ffab552895c19b9fcf7aa264d277cde33881"),
+		plumbing.NewReferenceFromStrings("refs/tags/v1.0.0", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	})
+
+	s.Len(r.s.(*memory.Storage).Objects, 18)
+}
+
+func (s *RemoteSuite) TestFetchServerOptionsProtocolV0() {
+	r := NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		URLs: []string{s.GetBasicLocalRepositoryURL()},
+	})
+
+	err := r.Fetch(&FetchOptions{ServerOptions: []string{"foo"}})
+	s.ErrorIs(err, transport.ErrServerOptionsNotSupported)
+}
+
+func (s *RemoteSuite) TestRefPrefixes() {
+	s.Equal([]string{"HEAD", "refs/tags/", "refs/heads/"}, refPrefixes([]config.RefSpec{
+		"+refs/heads/*:refs/remotes/origin/*",
+	}, plumbing.AllTags))
+
+	s.Equal([]string{"HEAD", "refs/heads/"}, refPrefixes([]config.RefSpec{
+		"+refs/heads/*:refs/remotes/origin/*",
+	}, plumbing.NoTags))
+
+	s.Nil(refPrefixes([]config.RefSpec{"+*:*"}, plumbing.AllTags))
+}
+
 func (s *RemoteSuite) testFetch(r *Remote, o *FetchOptions, expected []*plumbing.Reference) {
 	err := r.Fetch(o)
 	s.NoError(err)
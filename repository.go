@@ -11,6 +11,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
@@ -25,10 +26,12 @@ import (
 	"github.com/go-git/go-git/v5/internal/url"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/cache"
+	commitgraphfmt "github.com/go-git/go-git/v5/plumbing/format/commitgraph/v2"
 	formatcfg "github.com/go-git/go-git/v5/plumbing/format/config"
 	"github.com/go-git/go-git/v5/plumbing/format/packfile"
 	"github.com/go-git/go-git/v5/plumbing/hash"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/object/commitgraph"
 	"github.com/go-git/go-git/v5/plumbing/storer"
 	"github.com/go-git/go-git/v5/storage"
 	"github.com/go-git/go-git/v5/storage/filesystem"
@@ -67,14 +70,32 @@ var (
 	ErrAlternatePathNotSupported   = errors.New("alternate path must use the file scheme")
 	ErrUnsupportedMergeStrategy    = errors.New("unsupported merge strategy")
 	ErrFastForwardMergeNotPossible = errors.New("not possible to fast-forward merge changes")
+	ErrUnrelatedHistories          = errors.New("refusing to merge unrelated histories")
+	ErrUntrackedFilesOverwritten   = errors.New("untracked working tree files would be overwritten")
+	// ErrMergeConflict is returned when the changes being merged conflict
+	// with each other. The conflicting files are left with conflict markers
+	// in the worktree and recorded as unmerged in the index.
+	ErrMergeConflict = errors.New("merge conflict")
 )
 
 // Repository represents a git repository
 type Repository struct {
 	Storer storage.Storer
+	// LFS is the store of the objects of the files tracked by Git LFS. If
+	// nil, the repositories based on a filesystem keep them in the
+	// lfs/objects directory, fetching the missing ones from the Git LFS
+	// server of the origin remote, or the one set by the lfs.url option.
+	LFS LFSStore
+	// LazyFetch configures the fetching of the objects missing in a partial
+	// clone from its promisor remote, which is done on demand when they are
+	// read, and in a single request for the files of a checkout.
+	LazyFetch LazyFetchOptions
 
 	r  map[string]*Remote
 	wt billy.Filesystem
+	// promisor is the remote the missing objects are fetched from, nil if
+	// the repository isn't a partial clone.
+	promisor *Remote
 }
 
 type InitOptions struct {
@@ -212,7 +233,12 @@ func Open(s storage.Storer, worktree billy.Filesystem) (*Repository, error) {
 		return nil, err
 	}
 
-	return newRepository(s, worktree), nil
+	r := newRepository(s, worktree)
+	if err := r.setupPromisor(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
 }
 
 // Clone a repository into the given Storer and worktree Filesystem with the
@@ -584,7 +610,12 @@ func (r *Repository) SetConfig(cfg *config.Config) error {
 // are returned merged in one config value.
 func (r *Repository) ConfigScoped(scope config.Scope) (*config.Config, error) {
 	// TODO(mcuadros): v6, add this as ConfigOptions.Scoped
+	return scopedConfig(r.Storer, scope)
+}
 
+// scopedConfig returns the config stored in s, merged with requested scope
+// and lower.
+func scopedConfig(s config.ConfigStorer, scope config.Scope) (*config.Config, error) {
 	var err error
 	system := config.NewConfig()
 	if scope >= config.SystemScope {
@@ -602,7 +633,7 @@ func (r *Repository) ConfigScoped(scope config.Scope) (*config.Config, error) {
 		}
 	}
 
-	local, err := r.Storer.Config()
+	local, err := s.Config()
 	if err != nil {
 		return nil, err
 	}
@@ -878,7 +909,7 @@ func (r *Repository) DeleteTag(name string) error {
 		return err
 	}
 
-	return r.Storer.RemoveReference(plumbing.ReferenceName(path.Join("refs", "tags", name)))
+	return removeReference(r.Storer, plumbing.ReferenceName(path.Join("refs", "tags", name)))
 }
 
 func (r *Repository) resolveToCommitHash(h plumbing.Hash) (plumbing.Hash, error) {
@@ -952,11 +983,24 @@ func (r *Repository) clone(ctx context.Context, o *CloneOptions) error {
 		CABundle:        o.CABundle,
 		ProxyOptions:    o.ProxyOptions,
 		Filter:          o.Filter,
+
+		ServerOptions:        o.ServerOptions,
+		PackfileURIProtocols: o.PackfileURIProtocols,
 	}, o.ReferenceName)
 	if err != nil {
 		return err
 	}
 
+	if o.Filter != "" {
+		r.LazyFetch.Auth = o.Auth
+		r.LazyFetch.InsecureSkipTLS = o.InsecureSkipTLS
+		r.LazyFetch.CABundle = o.CABundle
+		r.LazyFetch.ProxyOptions = o.ProxyOptions
+		if err := r.setupPromisor(); err != nil {
+			return err
+		}
+	}
+
 	if r.wt != nil && !o.NoCheckout {
 		w, err := r.Worktree()
 		if err != nil {
@@ -1101,7 +1145,8 @@ func (r *Repository) fetchAndUpdateReferences(
 		return nil, err
 	}
 
-	refsUpdated, err := r.updateReferences(remote.c.Fetch, resolvedRef)
+	msg := fmt.Sprintf("clone: from %s", remote.c.URLs[0])
+	refsUpdated, err := r.updateReferences(remote.c.Fetch, resolvedRef, msg)
 	if err != nil {
 		return nil, err
 	}
@@ -1114,7 +1159,7 @@ func (r *Repository) fetchAndUpdateReferences(
 }
 
 func (r *Repository) updateReferences(spec []config.RefSpec,
-	resolvedRef *plumbing.Reference) (updated bool, err error) {
+	resolvedRef *plumbing.Reference, msg string) (updated bool, err error) {
 
 	if !resolvedRef.Name().IsBranch() {
 		// Detached HEAD mode
@@ -1123,7 +1168,7 @@ func (r *Repository) updateReferences(spec []config.RefSpec,
 			return false, err
 		}
 		head := plumbing.NewHashReference(plumbing.HEAD, h)
-		return updateReferenceStorerIfNeeded(r.Storer, head)
+		return updateReferenceStorerIfNeeded(r.Storer, head, msg)
 	}
 
 	refs := []*plumbing.Reference{
@@ -1136,7 +1181,7 @@ func (r *Repository) updateReferences(spec []config.RefSpec,
 	refs = append(refs, r.calculateRemoteHeadReference(spec, resolvedRef)...)
 
 	for _, ref := range refs {
-		u, err := updateReferenceStorerIfNeeded(r.Storer, ref)
+		u, err := updateReferenceStorerIfNeeded(r.Storer, ref, msg)
 		if err != nil {
 			return updated, err
 		}
@@ -1173,7 +1218,7 @@ func (r *Repository) calculateRemoteHeadReference(spec []config.RefSpec,
 }
 
 func checkAndUpdateReferenceStorerIfNeeded(
-	s storer.ReferenceStorer, r, old *plumbing.Reference) (
+	s storage.Storer, r, old *plumbing.Reference, msg string) (
 	updated bool, err error) {
 	p, err := s.Reference(r.Name())
 	if err != nil && err != plumbing.ErrReferenceNotFound {
@@ -1182,7 +1227,7 @@ func checkAndUpdateReferenceStorerIfNeeded(
 
 	// we use the string method to compare references, is the easiest way
 	if err == plumbing.ErrReferenceNotFound || r.String() != p.String() {
-		if err := s.CheckAndSetReference(r, old); err != nil {
+		if err := checkAndSetReference(s, r, old, nil, msg); err != nil {
 			return false, err
 		}
 
@@ -1193,8 +1238,8 @@ func checkAndUpdateReferenceStorerIfNeeded(
 }
 
 func updateReferenceStorerIfNeeded(
-	s storer.ReferenceStorer, r *plumbing.Reference) (updated bool, err error) {
-	return checkAndUpdateReferenceStorerIfNeeded(s, r, nil)
+	s storage.Storer, r *plumbing.Reference, msg string) (updated bool, err error) {
+	return checkAndUpdateReferenceStorerIfNeeded(s, r, nil, msg)
 }
 
 // Fetch fetches references along with the objects necessary to complete
@@ -1225,7 +1270,15 @@ func (r *Repository) FetchContext(ctx context.Context, o *FetchOptions) error {
 		return err
 	}
 
-	return remote.FetchContext(ctx, o)
+	if err := remote.FetchContext(ctx, o); err != nil {
+		return err
+	}
+
+	if r.promisor == nil && o.Filter != "" {
+		return r.setupPromisor()
+	}
+
+	return nil
 }
 
 // Push performs a push to the remote. Returns NoErrAlreadyUpToDate if
@@ -1268,6 +1321,8 @@ func (r *Repository) Log(o *LogOptions) (object.CommitIter, error) {
 	)
 	if o.All {
 		it, err = r.logAll(fn)
+	} else if index := r.commitGraph(); index != nil {
+		it, err = r.logWithCommitGraph(index, o)
 	} else {
 		it, err = r.log(o.From, fn)
 	}
@@ -1293,14 +1348,9 @@ func (r *Repository) Log(o *LogOptions) (object.CommitIter, error) {
 }
 
 func (r *Repository) log(from plumbing.Hash, commitIterFunc func(*object.Commit) object.CommitIter) (object.CommitIter, error) {
-	h := from
-	if from == plumbing.ZeroHash {
-		head, err := r.Head()
-		if err != nil {
-			return nil, err
-		}
-
-		h = head.Hash()
+	h, err := r.logFrom(from)
+	if err != nil {
+		return nil, err
 	}
 
 	commit, err := r.CommitObject(h)
@@ -1310,18 +1360,65 @@ func (r *Repository) log(from plumbing.Hash, commitIterFunc func(*object.Commit)
 	return commitIterFunc(commit), nil
 }
 
+// logWithCommitGraph walks the history with the given commit-graph, decoding
+// only the commits returned. The commits out of the Since and Until range are
+// filtered out before being decoded, unless they are needed to filter them by
+// path.
+func (r *Repository) logWithCommitGraph(index commitgraphfmt.Index, o *LogOptions) (object.CommitIter, error) {
+	h, err := r.logFrom(o.From)
+	if err != nil {
+		return nil, err
+	}
+
+	node, err := commitgraph.NewGraphCommitNodeIndex(index, r.Storer).Get(h)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes commitgraph.CommitNodeIter
+	switch o.Order {
+	case LogOrderDefault, LogOrderDFS:
+		nodes = commitgraph.NewCommitNodeIterPreorder(node, nil, nil)
+	case LogOrderDFSPost:
+		nodes = commitgraph.NewCommitNodeIterPostorder(node, nil)
+	case LogOrderBSF:
+		nodes = commitgraph.NewCommitNodeIterBSF(node, nil, nil)
+	case LogOrderCommitterTime:
+		nodes = commitgraph.NewCommitNodeIterCTime(node, nil, nil)
+	}
+
+	var filter func(commitgraph.CommitNode) bool
+	if o.FileName == nil && o.PathFilter == nil && (o.Since != nil || o.Until != nil) {
+		filter = func(n commitgraph.CommitNode) bool {
+			when := n.CommitTime()
+			return (o.Since == nil || !when.Before(*o.Since)) &&
+				(o.Until == nil || !when.After(*o.Until))
+		}
+	}
+
+	return commitgraph.NewCommitIter(nodes, filter), nil
+}
+
+// logFrom returns the commit the log starts from, HEAD if none is given.
+func (r *Repository) logFrom(from plumbing.Hash) (plumbing.Hash, error) {
+	if from != plumbing.ZeroHash {
+		return from, nil
+	}
+
+	head, err := r.Head()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return head.Hash(), nil
+}
+
 func (r *Repository) logAll(commitIterFunc func(*object.Commit) object.CommitIter) (object.CommitIter, error) {
 	return object.NewCommitAllIter(r.Storer, commitIterFunc)
 }
 
 func (*Repository) logWithFile(fileName string, commitIter object.CommitIter, checkParent bool) object.CommitIter {
-	return object.NewCommitPathIterFromIter(
-		func(path string) bool {
-			return path == fileName
-		},
-		commitIter,
-		checkParent,
-	)
+	return object.NewCommitFileIterFromIter(fileName, commitIter, checkParent)
 }
 
 func (*Repository) logWithPathFilter(pathFilter func(string) bool, commitIter object.CommitIter, checkParent bool) object.CommitIter {
@@ -1565,7 +1662,8 @@ func expand_ref(s storer.ReferenceStorer, ref plumbing.ReferenceName) (*plumbing
 // resolve to a commit hash, not a tree or annotated tag.
 //
 // Implemented resolvers : HEAD, branch, tag, heads/branch, refs/heads/branch,
-// refs/tags/tag, refs/remotes/origin/branch, refs/remotes/origin/HEAD, tilde and caret (HEAD~1, master~^, tag~2, ref/heads/master~1, ...), selection by text (HEAD^{/fix nasty bug}), hash (prefix and full)
+// refs/tags/tag, refs/remotes/origin/branch, refs/remotes/origin/HEAD, tilde and caret (HEAD~1, master~^, tag~2, ref/heads/master~1, ...), selection by text (HEAD^{/fix nasty bug}), hash (prefix and full),
+// reflog entries (HEAD@{1}, master@{2}, @{1}, HEAD@{1}~1) and reflog dates (master@{yesterday}, HEAD@{2.weeks.ago}, @{2016-12-16T21:42:47Z})
 func (r *Repository) ResolveRevision(in plumbing.Revision) (*plumbing.Hash, error) {
 	rev := in.String()
 	if rev == "" {
@@ -1581,6 +1679,22 @@ func (r *Repository) ResolveRevision(in plumbing.Revision) (*plumbing.Hash, erro
 
 	var commit *object.Commit
 
+	// The reflog entry is resolved first, the statements following it apply
+	// to its commit.
+	if i := reflogRevisionIndex(items); i >= 0 {
+		h, err := r.resolveReflogRevision(items[:i+1])
+		if err != nil {
+			return h, err
+		}
+
+		commit, err = r.CommitObject(*h)
+		if err != nil {
+			return &plumbing.ZeroHash, err
+		}
+
+		items = items[i+1:]
+	}
+
 	for _, item := range items {
 		switch item := item.(type) {
 		case revision.Ref:
@@ -1756,6 +1870,23 @@ type RepackConfig struct {
 	// OnlyDeletePacksOlderThan if set to non-zero value
 	// selects only objects older than the time provided.
 	OnlyDeletePacksOlderThan time.Time
+	// Window, Depth, WindowMemory and Threads override, if non-zero, the
+	// pack.window, pack.depth, pack.windowMemory and pack.threads options
+	// of the repository config, see packfile.EncodeOptions.
+	Window       uint
+	Depth        uint
+	WindowMemory uint64
+	Threads      uint
+	// NoReuseDeltas searches new deltas for all the objects, instead of
+	// reusing the deltas of the objects already stored as deltas.
+	NoReuseDeltas bool
+	// DeltaIslands restricts the deltas to bases in the same delta islands,
+	// defined by the pack.island options of the repository config. Each one
+	// is a regular expression matched against the reference names, and the
+	// matching references are grouped in islands named by the capture groups
+	// of the expression joined by "-", the last expression matching a
+	// reference winning, as git does.
+	DeltaIslands bool
 }
 
 func (r *Repository) RepackObjects(cfg *RepackConfig) (err error) {
@@ -1770,8 +1901,14 @@ func (r *Repository) RepackObjects(cfg *RepackConfig) (err error) {
 		return err
 	}
 
+	ow := r.objectWalker()
+	err = ow.walkAllRefs()
+	if err != nil {
+		return err
+	}
+
 	// Create a new pack.
-	nh, err := r.createNewObjectPack(cfg)
+	nh, err := r.createNewObjectPack(cfg, ow)
 	if err != nil {
 		return err
 	}
@@ -1797,8 +1934,16 @@ func (r *Repository) RepackObjects(cfg *RepackConfig) (err error) {
 // the HEAD for the current branch. Possible errors include:
 //   - The merge strategy is not supported.
 //   - The specific strategy cannot be used (e.g. using FastForwardMerge when one is not possible).
+//
+// When using ThreeWayMerge, conflicting changes result in ErrMergeConflict,
+// leaving the conflicts in the index and the worktree to be resolved and
+// committed by the caller.
 func (r *Repository) Merge(ref plumbing.Reference, opts MergeOptions) error {
-	if opts.Strategy != FastForwardMerge {
+	switch opts.Strategy {
+	case FastForwardMerge:
+	case ThreeWayMerge:
+		return r.threeWayMerge(ref, opts)
+	default:
 		return ErrUnsupportedMergeStrategy
 	}
 
@@ -1823,37 +1968,29 @@ func (r *Repository) Merge(ref plumbing.Reference, opts MergeOptions) error {
 		return ErrFastForwardMergeNotPossible
 	}
 
-	return r.Storer.SetReference(plumbing.NewHashReference(head.Name(), ref.Hash()))
+	msg := fmt.Sprintf("merge %s: Fast-forward", mergeLabel(ref))
+	return setReference(r.Storer, plumbing.NewHashReference(head.Name(), ref.Hash()), nil, msg)
 }
 
 // createNewObjectPack is a helper for RepackObjects taking care
-// of creating a new pack. It is used so the PackfileWriter
-// deferred close has the right scope.
-func (r *Repository) createNewObjectPack(cfg *RepackConfig) (h plumbing.Hash, err error) {
-	ow := newObjectWalker(r.Storer)
-	err = ow.walkAllRefs()
+// of creating a new pack with the objects seen by the walker. It is
+// used so the PackfileWriter deferred close has the right scope.
+func (r *Repository) createNewObjectPack(cfg *RepackConfig, ow *objectWalker) (h plumbing.Hash, err error) {
+	wc, err := r.newObjectPackWriter()
 	if err != nil {
 		return h, err
 	}
-	objs := make([]plumbing.Hash, 0, len(ow.seen))
-	for h := range ow.seen {
-		objs = append(objs, h)
-	}
-	pfw, ok := r.Storer.(storer.PackfileWriter)
-	if !ok {
-		return h, fmt.Errorf("Repository storer is not a storer.PackfileWriter")
-	}
-	wc, err := pfw.PackfileWriter()
+	defer ioutil.CheckClose(wc, &err)
+	scfg, err := r.Config()
 	if err != nil {
 		return h, err
 	}
-	defer ioutil.CheckClose(wc, &err)
-	scfg, err := r.Config()
+	o, err := r.encodeOptions(cfg, scfg)
 	if err != nil {
 		return h, err
 	}
 	enc := packfile.NewEncoder(wc, r.Storer, cfg.UseRefDeltas)
-	h, err = enc.Encode(objs, scfg.Pack.Window)
+	h, err = enc.EncodeWithOptions(ow.order(), o)
 	if err != nil {
 		return h, err
 	}
@@ -1877,6 +2014,112 @@ func (r *Repository) createNewObjectPack(cfg *RepackConfig) (h plumbing.Hash, er
 	return h, err
 }
 
+// newObjectPackWriter returns a writer of a new pack of the repository. In a
+// partial clone, the pack is written as fetched from the promisor remote, as
+// the packs it replaces, so the objects it refers to are still promised.
+func (r *Repository) newObjectPackWriter() (io.WriteCloser, error) {
+	if pw, ok := r.Storer.(storer.PromisorPackfileWriter); ok && r.promisor != nil {
+		return pw.PromisorPackfileWriter()
+	}
+
+	pfw, ok := r.Storer.(storer.PackfileWriter)
+	if !ok {
+		return nil, fmt.Errorf("Repository storer is not a storer.PackfileWriter")
+	}
+
+	return pfw.PackfileWriter()
+}
+
+// encodeOptions returns the options to encode a new pack of the repository,
+// from the given RepackConfig and the pack options of the repository config.
+func (r *Repository) encodeOptions(cfg *RepackConfig, scfg *config.Config) (*packfile.EncodeOptions, error) {
+	o := &packfile.EncodeOptions{
+		Window:       scfg.Pack.Window,
+		Depth:        scfg.Pack.Depth,
+		WindowMemory: scfg.Pack.WindowMemory,
+		Threads:      scfg.Pack.Threads,
+		ReuseDeltas:  !cfg.NoReuseDeltas,
+		KeepOrder:    true,
+	}
+
+	if cfg.Window != 0 {
+		o.Window = cfg.Window
+	}
+	if cfg.Depth != 0 {
+		o.Depth = cfg.Depth
+	}
+	if cfg.WindowMemory != 0 {
+		o.WindowMemory = cfg.WindowMemory
+	}
+	if cfg.Threads != 0 {
+		o.Threads = cfg.Threads
+	}
+
+	if !cfg.DeltaIslands {
+		return o, nil
+	}
+
+	var err error
+	o.Islands, err = r.deltaIslands(scfg.Pack.Islands)
+	return o, err
+}
+
+// deltaIslands returns the delta islands defined by the given pack.island
+// regular expressions, with the objects reachable from their references.
+func (r *Repository) deltaIslands(patterns []string) (*packfile.DeltaIslands, error) {
+	regexps := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pack.island %q: %w", p, err)
+		}
+
+		regexps = append(regexps, re)
+	}
+
+	refs, err := r.Storer.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	islands := make(map[string][]plumbing.Hash)
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+
+		for i := len(regexps) - 1; i >= 0; i-- {
+			m := regexps[i].FindStringSubmatch(ref.Name().String())
+			if m == nil {
+				continue
+			}
+
+			name := strings.Join(m[1:], "-")
+			islands[name] = append(islands[name], ref.Hash())
+			return nil
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	di := packfile.NewDeltaIslands()
+	for name, hashes := range islands {
+		ow := r.objectWalker()
+		for _, h := range hashes {
+			if err := ow.walkObjectTree(h); err != nil {
+				return nil, err
+			}
+		}
+
+		di.Add(name, ow.order()...)
+	}
+
+	return di, nil
+}
+
 func expandPartialHash(st storer.EncodedObjectStorer, prefix []byte) (hashes []plumbing.Hash) {
 	// The fast version is implemented by storage/filesystem.ObjectStorage.
 	type fastIter interface {
@@ -27,6 +27,7 @@ import (
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
 	"github.com/go-git/go-git/v5/plumbing/storer"
@@ -1324,6 +1325,7 @@ func (s *RepositorySuite) TestFetchWithFiltersReal() {
 		Filter: packp.FilterBlobNone(),
 	})
 	s.NoError(err)
+	r.LazyFetch.Disabled = true
 	blob, err := r.BlobObject(plumbing.NewHash("9a48f23120e880dfbe41f7c9b7b708e9ee62a492"))
 	s.NotNil(err)
 	s.Nil(blob)
@@ -1676,8 +1678,8 @@ func (s *RepositorySuite) TestCloneWithFilter() {
 	})
 	s.NoError(err)
 	blob, err := r.BlobObject(plumbing.NewHash("9a48f23120e880dfbe41f7c9b7b708e9ee62a492"))
-	s.NotNil(err)
-	s.Nil(blob)
+	s.NoError(err)
+	s.NotNil(blob)
 }
 func (s *RepositorySuite) TestPush() {
 	url, err := os.MkdirTemp("", "")
@@ -3346,6 +3348,78 @@ func (s *RepositorySuite) TestRepackObjectsWithNoDelete() {
 	s.testRepackObjects(time.Unix(0, 1), 3)
 }
 
+func (s *RepositorySuite) TestRepackObjectsWithDeltaOptions() {
+	fs := fixtures.Basic().One().DotGit()
+	r, err := Open(filesystem.NewStorage(fs, cache.NewObjectLRUDefault()), nil)
+	s.NoError(err)
+
+	cfg, err := r.Config()
+	s.NoError(err)
+	cfg.Pack.Islands = []string{"refs/heads/(.*)"}
+	s.NoError(r.SetConfig(cfg))
+
+	expected := s.logAll(r)
+
+	err = r.RepackObjects(&RepackConfig{
+		Window:        20,
+		Depth:         1,
+		Threads:       2,
+		NoReuseDeltas: true,
+		DeltaIslands:  true,
+	})
+	s.NoError(err)
+
+	packs, err := r.Storer.(storer.PackedObjectStorer).ObjectPacks()
+	s.NoError(err)
+	s.Len(packs, 1)
+
+	f, err := fs.Open(fs.Join("objects", "pack", fmt.Sprintf("pack-%s.pack", packs[0])))
+	s.NoError(err)
+	defer f.Close()
+
+	// The delta chains are limited by the depth and the commits are
+	// written first.
+	depths := make(map[int64]int)
+	var types []plumbing.ObjectType
+	scanner := packfile.NewScanner(f)
+	for scanner.Scan() {
+		oh, ok := scanner.Data().Value().(packfile.ObjectHeader)
+		if !ok {
+			continue
+		}
+
+		types = append(types, oh.Type)
+		if oh.Type == plumbing.OFSDeltaObject {
+			depths[oh.Offset] = depths[oh.OffsetReference] + 1
+			s.LessOrEqual(depths[oh.Offset], 1)
+		}
+	}
+	s.NoError(scanner.Error())
+	s.NotEmpty(depths)
+	s.Equal(plumbing.CommitObject, types[0])
+
+	r, err = Open(filesystem.NewStorage(fs, cache.NewObjectLRUDefault()), nil)
+	s.NoError(err)
+	s.Equal(expected, s.logAll(r))
+
+	cfg.Pack.Islands = []string{"refs/heads/(.*"}
+	s.NoError(r.SetConfig(cfg))
+	s.Error(r.RepackObjects(&RepackConfig{DeltaIslands: true}))
+}
+
+func (s *RepositorySuite) logAll(r *Repository) []plumbing.Hash {
+	iter, err := r.Log(&LogOptions{All: true})
+	s.NoError(err)
+
+	var commits []plumbing.Hash
+	s.NoError(iter.ForEach(func(c *object.Commit) error {
+		commits = append(commits, c.Hash)
+		return nil
+	}))
+
+	return commits
+}
+
 func ExecuteOnPath(t *testing.T, path string, cmds ...string) error {
 	for _, cmd := range cmds {
 		err := executeOnPath(path, cmd)
@@ -3408,9 +3482,11 @@ func (s *RepositorySuite) TestBrokenMultipleShallowFetch() {
 		RefSpecs: []config.RefSpec{config.RefSpec("refs/heads/*:refs/heads/*")},
 	}))
 
+	// The previous shallow commit is unshallowed by the deeper fetch.
 	shallows, err = r.Storer.Shallow()
 	s.NoError(err)
-	s.Len(shallows, 3)
+	s.Len(shallows, 2)
+	s.NotContains(shallows, plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"))
 
 	ref, err = r.Reference("refs/heads/master", true)
 	s.NoError(err)
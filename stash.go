@@ -0,0 +1,472 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+)
+
+var (
+	// ErrNoStashChanges is returned by Worktree.Stash when there are no local
+	// changes to save.
+	ErrNoStashChanges = errors.New("no local changes to save")
+	// ErrStashNotFound is returned when the requested stash is not in the
+	// stash list.
+	ErrStashNotFound = errors.New("stash not found")
+)
+
+// Stash is an entry of the stash list.
+type Stash struct {
+	// Index is the position of the stash in the list, the stash can be
+	// referred with the revision stash@{<Index>}.
+	Index int
+	// Hash of the commit recording the stash.
+	Hash plumbing.Hash
+	// Message of the stash, as shown by git stash list.
+	Message string
+}
+
+// Stashes returns the stash list, from the newest to the oldest stash. As
+// git does, the list is read from the reflog of refs/stash.
+func (r *Repository) Stashes() ([]*Stash, error) {
+	entries, err := r.Reflog(plumbing.Stash)
+	if err != nil {
+		return nil, err
+	}
+
+	stashes := make([]*Stash, len(entries))
+	for i, e := range entries {
+		stashes[i] = &Stash{Index: i, Hash: e.New, Message: e.Message}
+	}
+
+	return stashes, nil
+}
+
+// StashDrop removes the stash with the given index from the stash list.
+func (r *Repository) StashDrop(n int) error {
+	s, ok := r.Storer.(storer.ReflogStorer)
+	if !ok {
+		return ErrReflogNotSupported
+	}
+
+	// The reflog is sorted from the oldest to the newest entry.
+	entries, err := s.Reflog(plumbing.Stash)
+	if err != nil {
+		return err
+	}
+
+	i := len(entries) - 1 - n
+	if n < 0 || i < 0 {
+		return ErrStashNotFound
+	}
+
+	entries = append(entries[:i], entries[i+1:]...)
+	if len(entries) == 0 {
+		return removeReference(r.Storer, plumbing.Stash)
+	}
+
+	// The entry following the dropped one now records the previous stash as
+	// the old value, as git reflog delete --rewrite does.
+	if i < len(entries) {
+		entries[i].Old = plumbing.ZeroHash
+		if i > 0 {
+			entries[i].Old = entries[i-1].New
+		}
+	}
+
+	if err := s.SetReflog(plumbing.Stash, entries); err != nil {
+		return err
+	}
+
+	last := entries[len(entries)-1].New
+	return r.Storer.SetReference(plumbing.NewHashReference(plumbing.Stash, last))
+}
+
+// stashCommit returns the commit of the stash with the given index.
+func (r *Repository) stashCommit(n int) (*object.Commit, error) {
+	stashes, err := r.Stashes()
+	if err != nil {
+		return nil, err
+	}
+
+	if n < 0 || n >= len(stashes) {
+		return nil, ErrStashNotFound
+	}
+
+	c, err := r.CommitObject(stashes[n].Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.NumParents() < 2 {
+		return nil, fmt.Errorf("%s is not a stash commit", c.Hash)
+	}
+
+	return c, nil
+}
+
+// Stash saves the local changes in a new stash and reverts the worktree and
+// the index to the HEAD commit, returning the hash of the stash commit.
+//
+// The stash is recorded in the same way git does: a commit with the state of
+// the worktree whose parents are the HEAD commit, a commit with the state of
+// the index and, if the untracked files are included, a commit with them.
+// Hence the stashes are interchangeable with the ones created by git.
+func (w *Worktree) Stash(opts *StashOptions) (plumbing.Hash, error) {
+	if opts == nil {
+		opts = &StashOptions{}
+	}
+
+	if err := opts.Validate(w.r); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	head, err := w.r.Head()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	commit, err := w.r.CommitObject(head.Hash())
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	for _, e := range idx.Entries {
+		if e.Stage != index.Merged {
+			return plumbing.ZeroHash, ErrUnmergedPaths
+		}
+	}
+
+	h := &buildTreeHelper{fs: w.Filesystem, s: w.r.Storer}
+	indexTree, err := h.BuildTree(idx, nil)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	worktreeTree, err := w.buildStashWorktreeTree(idx, status)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	var untracked []string
+	if opts.IncludeUntracked {
+		for name, fs := range status {
+			if fs.Worktree == Untracked {
+				untracked = append(untracked, name)
+			}
+		}
+
+		sort.Strings(untracked)
+	}
+
+	if indexTree == commit.TreeHash && worktreeTree == commit.TreeHash && len(untracked) == 0 {
+		return plumbing.ZeroHash, ErrNoStashChanges
+	}
+
+	branch := "(no branch)"
+	if head.Name().IsBranch() {
+		branch = head.Name().Short()
+	}
+
+	subject, _, _ := strings.Cut(strings.TrimSpace(commit.Message), "\n")
+	desc := fmt.Sprintf("%s: %s %s", branch, commit.Hash.String()[:7], subject)
+
+	co := &CommitOptions{Author: opts.Author, Committer: opts.Committer}
+	co.Parents = []plumbing.Hash{commit.Hash}
+	indexCommit, err := w.buildCommitObject("index on "+desc, co, indexTree)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	parents := []plumbing.Hash{commit.Hash, indexCommit}
+	if len(untracked) > 0 {
+		untrackedCommit, err := w.buildStashUntrackedCommit(untracked, desc, opts)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		parents = append(parents, untrackedCommit)
+	}
+
+	msg := "WIP on " + desc
+	if opts.Message != "" {
+		msg = fmt.Sprintf("On %s: %s", branch, opts.Message)
+	}
+
+	co.Parents = parents
+	stash, err := w.buildCommitObject(msg, co, worktreeTree)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	ref := plumbing.NewHashReference(plumbing.Stash, stash)
+	if err := setReference(w.r.Storer, ref, opts.Committer, msg); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	target := commit.TreeHash
+	if opts.KeepIndex {
+		target = indexTree
+	}
+
+	if err := w.resetStashedChanges(status, worktreeTree, target); err != nil {
+		return stash, err
+	}
+
+	for _, name := range untracked {
+		if err := rmFileAndDirsIfEmpty(w.Filesystem, name); err != nil {
+			return stash, err
+		}
+	}
+
+	return stash, nil
+}
+
+// buildStashWorktreeTree builds the tree with the state of the tracked files
+// in the worktree, that is the index updated with the changes not yet
+// staged. The index of the worktree isn't modified.
+func (w *Worktree) buildStashWorktreeTree(idx *index.Index, s Status) (plumbing.Hash, error) {
+	wi := &index.Index{Version: idx.Version}
+	for _, e := range idx.Entries {
+		c := *e
+		wi.Entries = append(wi.Entries, &c)
+	}
+
+	conv, err := w.newWorktreeConverter(idx)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	defer conv.close()
+
+	for name, fs := range s {
+		if fs.Worktree == Unmodified || fs.Worktree == Untracked {
+			continue
+		}
+
+		if _, _, err := w.doAddFile(wi, conv, nil, name, nil); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	h := &buildTreeHelper{fs: w.Filesystem, s: w.r.Storer}
+	return h.BuildTree(wi, nil)
+}
+
+// buildStashUntrackedCommit creates the commit recording the given untracked
+// files. The commit has no parents, as git does.
+func (w *Worktree) buildStashUntrackedCommit(files []string, desc string, opts *StashOptions) (plumbing.Hash, error) {
+	conv, err := w.newWorktreeConverter(nil)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	defer conv.close()
+
+	ui := &index.Index{Version: 2}
+	for _, name := range files {
+		if _, _, err := w.doAddFile(ui, conv, nil, name, nil); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	h := &buildTreeHelper{fs: w.Filesystem, s: w.r.Storer}
+	tree, err := h.BuildTree(ui, nil)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	co := &CommitOptions{Author: opts.Author, Committer: opts.Committer}
+	return w.buildCommitObject("untracked files on "+desc, co, tree)
+}
+
+// resetStashedChanges reverts the worktree, whose state is recorded by the
+// from tree, and the index to the to tree.
+func (w *Worktree) resetStashedChanges(s Status, from, to plumbing.Hash) error {
+	fromTree, err := object.GetTree(w.r.Storer, from)
+	if err != nil {
+		return err
+	}
+
+	toTree, err := object.GetTree(w.r.Storer, to)
+	if err != nil {
+		return err
+	}
+
+	if err := w.checkoutTree(s, fromTree, toTree); err != nil {
+		return err
+	}
+
+	return w.resetIndex(toTree, nil, nil)
+}
+
+// StashApply applies the changes of the stash with the given index to the
+// worktree, merging them with the changes committed since the stash was
+// created. As git stash apply does, the changes are left unstaged, except the
+// files added by the stash, which are added to the index. The untracked files
+// of the stash are restored too.
+//
+// The worktree must not contain changes to tracked files. If the changes
+// conflict, the conflicting files are left with conflict markers, recorded as
+// unmerged in the index, and ErrMergeConflict is returned.
+func (w *Worktree) StashApply(n int) error {
+	stash, err := w.r.stashCommit(n)
+	if err != nil {
+		return err
+	}
+
+	base, err := w.r.CommitObject(stash.ParentHashes[0])
+	if err != nil {
+		return err
+	}
+
+	baseTree, err := base.Tree()
+	if err != nil {
+		return err
+	}
+
+	stashTree, err := stash.Tree()
+	if err != nil {
+		return err
+	}
+
+	head, err := w.r.Head()
+	if err != nil {
+		return err
+	}
+
+	headTree, err := w.r.getTreeFromCommitHash(head.Hash())
+	if err != nil {
+		return err
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return err
+	}
+
+	if hasTrackedChanges(status) {
+		return ErrWorktreeNotClean
+	}
+
+	var untracked *object.Tree
+	if stash.NumParents() > 2 {
+		untracked, err = w.r.getTreeFromCommitHash(stash.ParentHashes[2])
+		if err != nil {
+			return err
+		}
+
+		if err := w.checkStashUntrackedFiles(untracked); err != nil {
+			return err
+		}
+	}
+
+	res, err := object.MergeTrees(w.r.Storer, baseTree, headTree, stashTree, &object.MergeTreesOptions{
+		BaseLabel:   "Stash base",
+		OursLabel:   "Updated upstream",
+		TheirsLabel: "Stashed changes",
+	})
+	if err != nil {
+		return err
+	}
+
+	tree, err := object.GetTree(w.r.Storer, res.Tree)
+	if err != nil {
+		return err
+	}
+
+	if err := w.checkoutTree(status, headTree, tree); err != nil {
+		return err
+	}
+
+	if untracked != nil {
+		conv, err := w.newWorktreeConverter(nil)
+		if err != nil {
+			return err
+		}
+		defer conv.close()
+
+		err = untracked.Files().ForEach(func(f *object.File) error {
+			return w.checkoutFile(f, conv)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if !res.IsClean() {
+		if err := w.addConflictsToIndex(res.Conflicts); err != nil {
+			return err
+		}
+
+		return ErrMergeConflict
+	}
+
+	return w.unstageChanges(headTree, tree)
+}
+
+// StashPop applies the stash with the given index, as StashApply does, and
+// removes it from the stash list. The stash is kept if it can't be applied
+// cleanly.
+func (w *Worktree) StashPop(n int) error {
+	if err := w.StashApply(n); err != nil {
+		return err
+	}
+
+	return w.r.StashDrop(n)
+}
+
+// checkStashUntrackedFiles returns ErrUntrackedFilesOverwritten if any of
+// the files of the given tree already exists in the worktree.
+func (w *Worktree) checkStashUntrackedFiles(t *object.Tree) error {
+	return t.Files().ForEach(func(f *object.File) error {
+		_, err := w.Filesystem.Lstat(f.Name)
+		if err == nil {
+			return fmt.Errorf("%w: %s", ErrUntrackedFilesOverwritten, f.Name)
+		}
+
+		return nil
+	})
+}
+
+// unstageChanges restores the index entries of the files changed between the
+// from and to trees to their state in the from tree. The new files are kept
+// in the index.
+func (w *Worktree) unstageChanges(from, to *object.Tree) error {
+	changes, err := merkletrie.DiffTree(
+		object.NewTreeRootNode(from),
+		object.NewTreeRootNode(to),
+		diffTreeIsEquals,
+	)
+	if err != nil {
+		return err
+	}
+
+	var files []string
+	for _, ch := range changes {
+		if len(ch.From) != 0 {
+			files = append(files, ch.From.String())
+		}
+	}
+
+	if len(files) == 0 {
+		return nil
+	}
+
+	return w.resetIndex(from, nil, files)
+}
@@ -0,0 +1,210 @@
+package git
+
+import (
+	"os"
+
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+)
+
+func (s *RepositorySuite) TestStash() {
+	r, w := setupMerge(s, map[string][]byte{
+		"foo": []byte("foo\n"),
+		"bar": []byte("bar\n"),
+		"baz": []byte("baz\n"),
+	})
+	head, err := r.Head()
+	s.NoError(err)
+
+	s.NoError(util.WriteFile(w.Filesystem, "foo", []byte("FOO\n"), 0o644))
+	s.NoError(util.WriteFile(w.Filesystem, "bar", []byte("BAR\n"), 0o644))
+	_, err = w.Add("bar")
+	s.NoError(err)
+	s.NoError(w.Filesystem.Remove("baz"))
+	s.NoError(util.WriteFile(w.Filesystem, "new", []byte("new\n"), 0o644))
+	_, err = w.Add("new")
+	s.NoError(err)
+	s.NoError(util.WriteFile(w.Filesystem, "untracked", []byte("untracked\n"), 0o644))
+
+	h, err := w.Stash(&StashOptions{Author: mergeSignature})
+	s.NoError(err)
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.Equal(Status{"untracked": &FileStatus{Staging: Untracked, Worktree: Untracked}}, status)
+
+	stash, err := r.CommitObject(h)
+	s.NoError(err)
+	s.Equal("WIP on master: "+head.Hash().String()[:7]+" commit", stash.Message)
+	s.Len(stash.ParentHashes, 2)
+	s.Equal(head.Hash(), stash.ParentHashes[0])
+
+	indexCommit, err := r.CommitObject(stash.ParentHashes[1])
+	s.NoError(err)
+	s.Equal("index on master: "+head.Hash().String()[:7]+" commit", indexCommit.Message)
+	s.Equal([]plumbing.Hash{head.Hash()}, indexCommit.ParentHashes)
+
+	stashes, err := r.Stashes()
+	s.NoError(err)
+	s.Len(stashes, 1)
+	s.Equal(&Stash{Index: 0, Hash: h, Message: stash.Message}, stashes[0])
+
+	rev, err := r.ResolveRevision("stash@{0}")
+	s.NoError(err)
+	s.Equal(h, *rev)
+
+	s.NoError(w.StashPop(0))
+
+	status, err = w.Status()
+	s.NoError(err)
+	s.Equal(Modified, status.File("foo").Worktree)
+	s.Equal(Unmodified, status.File("foo").Staging)
+	s.Equal(Modified, status.File("bar").Worktree)
+	s.Equal(Deleted, status.File("baz").Worktree)
+	s.Equal(Added, status.File("new").Staging)
+	s.Equal(Untracked, status.File("untracked").Worktree)
+
+	content, err := util.ReadFile(w.Filesystem, "bar")
+	s.NoError(err)
+	s.Equal("BAR\n", string(content))
+
+	stashes, err = r.Stashes()
+	s.NoError(err)
+	s.Len(stashes, 0)
+
+	_, err = r.Reference(plumbing.Stash, false)
+	s.ErrorIs(err, plumbing.ErrReferenceNotFound)
+}
+
+func (s *RepositorySuite) TestStashIncludeUntracked() {
+	r, w := setupMerge(s, map[string][]byte{"foo": []byte("foo\n")})
+
+	s.NoError(util.WriteFile(w.Filesystem, "dir/untracked", []byte("untracked\n"), 0o644))
+	h, err := w.Stash(&StashOptions{
+		Message:          "foo",
+		IncludeUntracked: true,
+		Author:           mergeSignature,
+	})
+	s.NoError(err)
+
+	_, err = w.Filesystem.Lstat("dir/untracked")
+	s.ErrorIs(err, os.ErrNotExist)
+
+	stash, err := r.CommitObject(h)
+	s.NoError(err)
+	s.Equal("On master: foo", stash.Message)
+	s.Len(stash.ParentHashes, 3)
+
+	untracked, err := r.CommitObject(stash.ParentHashes[2])
+	s.NoError(err)
+	s.Len(untracked.ParentHashes, 0)
+
+	f, err := untracked.File("dir/untracked")
+	s.NoError(err)
+	content, err := f.Contents()
+	s.NoError(err)
+	s.Equal("untracked\n", content)
+
+	s.NoError(util.WriteFile(w.Filesystem, "dir/untracked", []byte("other\n"), 0o644))
+	s.ErrorIs(w.StashApply(0), ErrUntrackedFilesOverwritten)
+	s.NoError(w.Filesystem.Remove("dir/untracked"))
+
+	s.NoError(w.StashApply(0))
+	data, err := util.ReadFile(w.Filesystem, "dir/untracked")
+	s.NoError(err)
+	s.Equal("untracked\n", string(data))
+
+	stashes, err := r.Stashes()
+	s.NoError(err)
+	s.Len(stashes, 1)
+}
+
+func (s *RepositorySuite) TestStashKeepIndex() {
+	_, w := setupMerge(s, map[string][]byte{"foo": []byte("foo\n"), "bar": []byte("bar\n")})
+
+	s.NoError(util.WriteFile(w.Filesystem, "foo", []byte("FOO\n"), 0o644))
+	_, err := w.Add("foo")
+	s.NoError(err)
+	s.NoError(util.WriteFile(w.Filesystem, "bar", []byte("BAR\n"), 0o644))
+
+	_, err = w.Stash(&StashOptions{KeepIndex: true, Author: mergeSignature})
+	s.NoError(err)
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.Equal(Status{"foo": &FileStatus{Staging: Modified, Worktree: Unmodified}}, status)
+}
+
+func (s *RepositorySuite) TestStashNoChanges() {
+	_, w := setupMerge(s, map[string][]byte{"foo": []byte("foo\n")})
+
+	s.NoError(util.WriteFile(w.Filesystem, "untracked", []byte("untracked\n"), 0o644))
+	_, err := w.Stash(&StashOptions{Author: mergeSignature})
+	s.ErrorIs(err, ErrNoStashChanges)
+}
+
+func (s *RepositorySuite) TestStashApplyMerge() {
+	r, w := setupMerge(s, map[string][]byte{"foo": []byte("a\nb\nc\nd\ne\n")})
+
+	s.NoError(util.WriteFile(w.Filesystem, "foo", []byte("a\nb\nc\nd\nE\n"), 0o644))
+	_, err := w.Stash(&StashOptions{Author: mergeSignature})
+	s.NoError(err)
+
+	commitFiles(s, w, map[string][]byte{"foo": []byte("A\nb\nc\nd\ne\n")})
+	s.NoError(w.StashApply(0))
+
+	content, err := util.ReadFile(w.Filesystem, "foo")
+	s.NoError(err)
+	s.Equal("A\nb\nc\nd\nE\n", string(content))
+
+	s.ErrorIs(w.StashApply(0), ErrWorktreeNotClean)
+	s.NoError(w.Reset(&ResetOptions{Mode: HardReset}))
+
+	commitFiles(s, w, map[string][]byte{"foo": []byte("A\nb\nc\nd\nX\n")})
+	s.ErrorIs(w.StashPop(0), ErrMergeConflict)
+
+	content, err = util.ReadFile(w.Filesystem, "foo")
+	s.NoError(err)
+	s.Equal("A\nb\nc\nd\n<<<<<<< Updated upstream\nX\n=======\nE\n>>>>>>> Stashed changes\n", string(content))
+
+	idx, err := r.Storer.Index()
+	s.NoError(err)
+	s.Len(idx.Entries, 3)
+	s.Equal(index.AncestorMode, idx.Entries[0].Stage)
+
+	stashes, err := r.Stashes()
+	s.NoError(err)
+	s.Len(stashes, 1)
+}
+
+func (s *RepositorySuite) TestStashDrop() {
+	r, w := setupMerge(s, map[string][]byte{"foo": []byte("foo\n")})
+
+	var hashes []plumbing.Hash
+	for _, content := range []string{"1\n", "2\n", "3\n"} {
+		s.NoError(util.WriteFile(w.Filesystem, "foo", []byte(content), 0o644))
+		h, err := w.Stash(&StashOptions{Message: content, Author: mergeSignature})
+		s.NoError(err)
+		hashes = append(hashes, h)
+	}
+
+	s.NoError(r.StashDrop(1))
+	stashes, err := r.Stashes()
+	s.NoError(err)
+	s.Len(stashes, 2)
+	s.Equal(hashes[2], stashes[0].Hash)
+	s.Equal(hashes[0], stashes[1].Hash)
+
+	entries, err := r.Reflog(plumbing.Stash)
+	s.NoError(err)
+	s.Equal(hashes[0], entries[0].Old)
+
+	s.NoError(r.StashDrop(0))
+	ref, err := r.Reference(plumbing.Stash, false)
+	s.NoError(err)
+	s.Equal(hashes[0], ref.Hash())
+
+	s.ErrorIs(r.StashDrop(1), ErrStashNotFound)
+	s.ErrorIs(w.StashApply(1), ErrStashNotFound)
+}
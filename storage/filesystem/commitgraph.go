@@ -0,0 +1,286 @@
+package filesystem
+
+import (
+	"io"
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	commitgraph "github.com/go-git/go-git/v5/plumbing/format/commitgraph/v2"
+	"github.com/go-git/go-git/v5/storage/filesystem/dotgit"
+)
+
+// CommitGraphStorage stores the commit-graph in the objects/info directory of
+// the .git folder, as a single file or as a split commit-graph, in the same
+// format used by git.
+type CommitGraphStorage struct {
+	dir *dotgit.DotGit
+
+	mu      sync.Mutex
+	loaded  bool
+	version string
+	index   commitgraph.Index
+	// replaced are the indexes replaced since they were returned, closed
+	// with the storage as they may still be in use.
+	replaced []commitgraph.Index
+}
+
+// CommitGraph returns the commit-graph of the repository, loaded again when
+// its files change. The commit-graph isn't used in shallow repositories, as
+// git does, since it has the parents missing from them.
+func (s *CommitGraphStorage) CommitGraph() (commitgraph.Index, error) {
+	shallow, err := (&ShallowStorage{dir: s.dir}).Shallow()
+	if err != nil || len(shallow) != 0 {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	version, err := s.dir.CommitGraphVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.loaded && version == s.version {
+		return s.index, nil
+	}
+
+	s.discard()
+	index, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+
+	s.loaded, s.version, s.index = true, version, index
+	return index, nil
+}
+
+// open opens the commit-graph file or, if there is none, the split
+// commit-graph.
+func (s *CommitGraphStorage) open() (commitgraph.Index, error) {
+	f, err := s.dir.CommitGraph()
+	if err != nil {
+		return nil, err
+	}
+
+	if f != nil {
+		index, err := commitgraph.OpenFileIndex(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+
+		return index, nil
+	}
+
+	chain, err := s.dir.CommitGraphChain()
+	if err != nil {
+		return nil, err
+	}
+
+	layers, err := s.openLayers(chain)
+	if err != nil || len(layers) == 0 {
+		return nil, err
+	}
+
+	return layers[len(layers)-1], nil
+}
+
+// openLayers opens the files of the given chain of a split commit-graph,
+// each layer having the previous one as parent. Closing the last one closes
+// all of them.
+func (s *CommitGraphStorage) openLayers(chain []plumbing.Hash) ([]commitgraph.Index, error) {
+	var layers []commitgraph.Index
+	var parent commitgraph.Index
+	for _, h := range chain {
+		f, err := s.dir.CommitGraphLayer(h)
+		if err == nil {
+			parent, err = commitgraph.OpenFileIndexWithParent(f, parent)
+			if err != nil {
+				_ = f.Close()
+			}
+		}
+
+		if err != nil {
+			if len(layers) != 0 {
+				_ = layers[len(layers)-1].Close()
+			}
+
+			return nil, err
+		}
+
+		layers = append(layers, parent)
+	}
+
+	return layers, nil
+}
+
+// SetCommitGraph writes the given index as the commit-graph file, removing
+// the split commit-graph if any.
+func (s *CommitGraphStorage) SetCommitGraph(idx commitgraph.Index) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	defer s.discard()
+	return s.dir.SetCommitGraph(func(w io.Writer) error {
+		return commitgraph.NewEncoder(w).Encode(idx)
+	})
+}
+
+// AddCommitGraphLayer writes the given index as a new layer of the split
+// commit-graph, merging it with the layers below having up to sizeMultiple
+// times its commits, as git commit-graph write --split does. A commit-graph
+// file is always merged into the new layer, replacing it.
+func (s *CommitGraphStorage) AddCommitGraphLayer(idx commitgraph.Index, sizeMultiple int) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	defer s.discard()
+	var chain []plumbing.Hash
+	var layers []commitgraph.Index
+	f, err := s.dir.CommitGraph()
+	if err != nil {
+		return err
+	}
+
+	if f != nil {
+		index, err := commitgraph.OpenFileIndex(f)
+		if err != nil {
+			_ = f.Close()
+			return err
+		}
+
+		layers = []commitgraph.Index{index}
+	} else {
+		if chain, err = s.dir.CommitGraphChain(); err != nil {
+			return err
+		}
+
+		if layers, err = s.openLayers(chain); err != nil {
+			return err
+		}
+	}
+
+	if len(layers) != 0 {
+		defer func() {
+			if closeErr := layers[len(layers)-1].Close(); err == nil {
+				err = closeErr
+			}
+		}()
+	}
+
+	// keep is the number of layers left as they are
+	keep := len(chain)
+	commits := uint64(len(idx.Hashes()))
+	for keep > 0 {
+		below := layerCommits(layers, keep-1)
+		if below > uint64(sizeMultiple)*commits {
+			break
+		}
+
+		commits += below
+		keep--
+	}
+
+	layer := commitgraph.NewMemoryIndex()
+	if keep > 0 {
+		layer = commitgraph.NewMemoryIndexWithParent(layers[keep-1])
+	}
+
+	if len(layers) != 0 {
+		top := layers[len(layers)-1]
+		for i := layer.MaximumNumberOfHashes(); i < top.MaximumNumberOfHashes(); i++ {
+			if err := addCommitData(layer, top, i); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, h := range idx.Hashes() {
+		if _, err := layer.GetIndexByHash(h); err == nil {
+			continue
+		}
+
+		i, err := idx.GetIndexByHash(h)
+		if err != nil {
+			return err
+		}
+
+		if err := addCommitData(layer, idx, i); err != nil {
+			return err
+		}
+	}
+
+	h, err := s.dir.AddCommitGraphLayer(func(w io.Writer) error {
+		return commitgraph.NewEncoder(w).EncodeWithBase(layer, chain[:keep])
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.dir.SetCommitGraphChain(append(chain[:keep:keep], h))
+}
+
+// layerCommits returns the number of commits of the i-th layer.
+func layerCommits(layers []commitgraph.Index, i int) uint64 {
+	n := uint64(layers[i].MaximumNumberOfHashes())
+	if i > 0 {
+		n -= uint64(layers[i-1].MaximumNumberOfHashes())
+	}
+
+	return n
+}
+
+// addCommitData adds the commit at the given position of an index to a
+// memory index, with its changed-path Bloom filter if any.
+func addCommitData(mi *commitgraph.MemoryIndex, idx commitgraph.Index, i uint32) error {
+	h, err := idx.GetHashByIndex(i)
+	if err != nil {
+		return err
+	}
+
+	data, err := idx.GetCommitDataByIndex(i)
+	if err != nil {
+		return err
+	}
+
+	mi.Add(h, data)
+	bfi, ok := idx.(commitgraph.BloomFilterIndex)
+	if !ok {
+		return nil
+	}
+
+	filter, err := bfi.GetBloomFilterByIndex(i)
+	if err != nil || filter == nil {
+		return err
+	}
+
+	return mi.SetBloomFilter(h, filter)
+}
+
+// discard drops the loaded commit-graph, kept open until the storage is
+// closed as it may still be in use.
+func (s *CommitGraphStorage) discard() {
+	if s.index != nil {
+		s.replaced = append(s.replaced, s.index)
+	}
+
+	s.loaded, s.version, s.index = false, "", nil
+}
+
+// Close closes the commit-graphs loaded.
+func (s *CommitGraphStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.discard()
+	var firstError error
+	for _, index := range s.replaced {
+		if err := index.Close(); err != nil && firstError == nil {
+			firstError = err
+		}
+	}
+
+	s.replaced = nil
+	return firstError
+}
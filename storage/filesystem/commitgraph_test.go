@@ -0,0 +1,131 @@
+package filesystem
+
+import (
+	"github.com/go-git/go-git/v5/plumbing"
+	commitgraph "github.com/go-git/go-git/v5/plumbing/format/commitgraph/v2"
+	"github.com/go-git/go-git/v5/storage/filesystem/dotgit"
+
+	fixtures "github.com/go-git/go-git-fixtures/v4"
+)
+
+func (s *FsSuite) TestCommitGraph() {
+	for _, tag := range []string{"commit-graph", "commit-graph-chain"} {
+		for _, f := range fixtures.ByTag(tag) {
+			cgs := &CommitGraphStorage{dir: dotgit.New(f.DotGit())}
+			index, err := cgs.CommitGraph()
+			s.NoError(err)
+			s.NotNil(index)
+			s.Len(index.Hashes(), 11)
+
+			cached, err := cgs.CommitGraph()
+			s.NoError(err)
+			s.Same(index, cached)
+			s.NoError(cgs.Close())
+		}
+	}
+}
+
+func (s *FsSuite) TestCommitGraphNone() {
+	cgs := &CommitGraphStorage{dir: dotgit.New(fixtures.Basic().One().DotGit())}
+	index, err := cgs.CommitGraph()
+	s.NoError(err)
+	s.Nil(index)
+}
+
+func (s *FsSuite) TestAddCommitGraphLayer() {
+	fs := fixtures.ByTag("commit-graph").One().DotGit()
+	dir := dotgit.New(fs)
+	cgs := &CommitGraphStorage{dir: dir}
+	defer func() { s.NoError(cgs.Close()) }()
+
+	expected, err := cgs.CommitGraph()
+	s.NoError(err)
+	s.NotNil(expected)
+
+	// the commits, parents first, to add them in layers
+	var hashes []plumbing.Hash
+	for generation := uint64(1); len(hashes) < len(expected.Hashes()); generation++ {
+		for i, h := range expected.Hashes() {
+			data, err := expected.GetCommitDataByIndex(uint32(i))
+			s.NoError(err)
+			if data.Generation == generation {
+				hashes = append(hashes, h)
+			}
+		}
+	}
+
+	addLayer := func(hashes []plumbing.Hash, sizeMultiple int) {
+		current, err := cgs.CommitGraph()
+		s.NoError(err)
+
+		layer := commitgraph.NewMemoryIndex()
+		if current != nil {
+			layer = commitgraph.NewMemoryIndexWithParent(current)
+		}
+
+		for _, h := range hashes {
+			i, err := expected.GetIndexByHash(h)
+			s.NoError(err)
+			data, err := expected.GetCommitDataByIndex(i)
+			s.NoError(err)
+			layer.Add(h, data)
+		}
+
+		s.NoError(cgs.AddCommitGraphLayer(layer, sizeMultiple))
+	}
+
+	base := commitgraph.NewMemoryIndex()
+	for _, h := range hashes[:5] {
+		i, err := expected.GetIndexByHash(h)
+		s.NoError(err)
+		data, err := expected.GetCommitDataByIndex(i)
+		s.NoError(err)
+		base.Add(h, data)
+	}
+
+	s.NoError(cgs.SetCommitGraph(base))
+	index, err := cgs.CommitGraph()
+	s.NoError(err)
+	s.Len(index.Hashes(), 5)
+
+	// the commit-graph file is merged into the first layer
+	addLayer(hashes[5:6], 2)
+	f, err := dir.CommitGraph()
+	s.NoError(err)
+	s.Nil(f)
+	chain, err := dir.CommitGraphChain()
+	s.NoError(err)
+	s.Len(chain, 1)
+
+	addLayer(hashes[6:7], 2)
+	chain, err = dir.CommitGraphChain()
+	s.NoError(err)
+	s.Len(chain, 2)
+
+	// the layers below with up to sizeMultiple times its commits are merged
+	addLayer(hashes[7:], 1)
+	chain, err = dir.CommitGraphChain()
+	s.NoError(err)
+	s.Len(chain, 2)
+
+	layers, err := fs.ReadDir(fs.Join("objects", "info", "commit-graphs"))
+	s.NoError(err)
+	s.Len(layers, 3)
+
+	index, err = cgs.CommitGraph()
+	s.NoError(err)
+	s.Equal(len(expected.Hashes()), int(index.MaximumNumberOfHashes()))
+	for _, h := range hashes {
+		i, err := expected.GetIndexByHash(h)
+		s.NoError(err)
+		data, err := expected.GetCommitDataByIndex(i)
+		s.NoError(err)
+
+		i, err = index.GetIndexByHash(h)
+		s.NoError(err)
+		got, err := index.GetCommitDataByIndex(i)
+		s.NoError(err)
+		s.Equal(data.ParentHashes, got.ParentHashes)
+		s.Equal(data.Generation, got.Generation)
+	}
+}
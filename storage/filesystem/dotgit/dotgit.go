@@ -213,6 +213,47 @@ func (d *DotGit) Shallow() (billy.File, error) {
 	return f, nil
 }
 
+// Reflog returns a file pointer for read to the reflog file of the given
+// reference, if the reference has no reflog nil is returned.
+func (d *DotGit) Reflog(name plumbing.ReferenceName) (billy.File, error) {
+	f, err := d.fs.Open(d.reflogPath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// ReflogAppender returns a file pointer for append to the reflog file of the
+// given reference, the file is created if it doesn't exist.
+func (d *DotGit) ReflogAppender(name plumbing.ReferenceName) (billy.File, error) {
+	return d.fs.OpenFile(d.reflogPath(name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+}
+
+// ReflogWriter returns a file pointer for write to the reflog file of the
+// given reference, truncating it if it exists.
+func (d *DotGit) ReflogWriter(name plumbing.ReferenceName) (billy.File, error) {
+	return d.fs.Create(d.reflogPath(name))
+}
+
+// RemoveReflog removes the reflog file of the given reference, if any.
+func (d *DotGit) RemoveReflog(name plumbing.ReferenceName) error {
+	err := d.fs.Remove(d.reflogPath(name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (d *DotGit) reflogPath(name plumbing.ReferenceName) string {
+	return d.fs.Join(logsPath, name.String())
+}
+
 // NewObjectPack return a writer for a new packfile, it saves the packfile to
 // disk and also generates and save the index for the given packfile.
 func (d *DotGit) NewObjectPack() (*PackWriter, error) {
@@ -321,6 +362,16 @@ func (d *DotGit) ObjectPackIdx(hash plumbing.Hash) (billy.File, error) {
 	return d.objectPackOpen(hash, `idx`)
 }
 
+// ObjectPackStat returns a os.FileInfo of the packfile with the given hash
+func (d *DotGit) ObjectPackStat(hash plumbing.Hash) (os.FileInfo, error) {
+	err := d.hasPack(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.fs.Stat(d.objectPackPath(hash, `pack`))
+}
+
 func (d *DotGit) DeleteOldObjectPackAndIndex(hash plumbing.Hash, t time.Time) error {
 	d.cleanPackList()
 
@@ -339,6 +390,16 @@ func (d *DotGit) DeleteOldObjectPackAndIndex(hash plumbing.Hash, t time.Time) er
 	if err != nil {
 		return err
 	}
+
+	// The files only meaningful along with the pack, as the bitmap and the
+	// reverse index written by git, are removed too.
+	for _, ext := range []string{`promisor`, `bitmap`, `rev`} {
+		err = d.fs.Remove(d.objectPackPath(hash, ext))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
 	return d.fs.Remove(d.objectPackPath(hash, `idx`))
 }
 
@@ -906,7 +967,7 @@ func (d *DotGit) rewritePackedRefsWithoutRef(name plumbing.ReferenceName) (err e
 
 	// Creating the temp file in the same directory as the target file
 	// improves our chances for rename operation to be atomic.
-	tmp, err := d.fs.TempFile("", tmpPackedRefsPrefix)
+	tmp, err := d.fs.TempFile(".", tmpPackedRefsPrefix)
 	if err != nil {
 		return err
 	}
@@ -1082,6 +1143,14 @@ func (d *DotGit) PackRefs() (err error) {
 	if err = d.addRefsFromRefDir(&refs, seen); err != nil {
 		return err
 	}
+	// Symbolic refs can't be packed, they are kept as loose refs.
+	hashRefs := refs[:0]
+	for _, ref := range refs {
+		if ref.Type() == plumbing.HashReference {
+			hashRefs = append(hashRefs, ref)
+		}
+	}
+	refs = hashRefs
 	if len(refs) == 0 {
 		// Nothing to do!
 		return nil
@@ -1091,8 +1160,9 @@ func (d *DotGit) PackRefs() (err error) {
 		return err
 	}
 
-	// Write them all to a new temp packed-refs file.
-	tmp, err := d.fs.TempFile("", tmpPackedRefsPrefix)
+	// Write them all to a new temp packed-refs file, in the same directory
+	// so it can be renamed.
+	tmp, err := d.fs.TempFile(".", tmpPackedRefsPrefix)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,267 @@
+package dotgit
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	commitgraph "github.com/go-git/go-git/v5/plumbing/format/commitgraph/v2"
+	"github.com/go-git/go-git/v5/plumbing/hash"
+	"github.com/go-git/go-git/v5/utils/ioutil"
+)
+
+const (
+	commitGraphPath      = "commit-graph"
+	commitGraphsPath     = "commit-graphs"
+	commitGraphChainPath = "commit-graph-chain"
+
+	commitGraphPrefix = "graph-"
+	commitGraphExt    = ".graph"
+	tmpCommitGraph    = "tmp_graph_"
+)
+
+// CommitGraph returns a file pointer for read to the commit-graph file, if
+// there is none nil is returned.
+func (d *DotGit) CommitGraph() (billy.File, error) {
+	f, err := d.fs.Open(d.fs.Join(objectsPath, infoPath, commitGraphPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// CommitGraphChain returns the hashes of the files of the split commit-graph,
+// from the oldest to the newest, if there is none nil is returned.
+func (d *DotGit) CommitGraphChain() (chain []plumbing.Hash, err error) {
+	f, err := d.fs.Open(d.commitGraphsPath(commitGraphChainPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+	hashes, err := commitgraph.OpenChainFile(f)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, h := range hashes {
+		chain = append(chain, plumbing.NewHash(h))
+	}
+
+	return chain, nil
+}
+
+// CommitGraphLayer returns a file pointer for read to the file of the split
+// commit-graph with the given hash.
+func (d *DotGit) CommitGraphLayer(h plumbing.Hash) (billy.File, error) {
+	return d.fs.Open(d.commitGraphLayerPath(h))
+}
+
+// CommitGraphVersion returns a string identifying the state of the
+// commit-graph files, changing when they are written.
+func (d *DotGit) CommitGraphVersion() (string, error) {
+	var version strings.Builder
+	for _, p := range []string{
+		d.fs.Join(objectsPath, infoPath, commitGraphPath),
+		d.commitGraphsPath(commitGraphChainPath),
+	} {
+		fi, err := d.fs.Stat(p)
+		if os.IsNotExist(err) {
+			version.WriteString("-;")
+			continue
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(&version, "%d:%d;", fi.Size(), fi.ModTime().UnixNano())
+	}
+
+	return version.String(), nil
+}
+
+// SetCommitGraph writes the commit-graph file with the given function,
+// replacing the current one. The split commit-graph, if any, is removed.
+func (d *DotGit) SetCommitGraph(encode func(io.Writer) error) error {
+	dir := d.fs.Join(objectsPath, infoPath)
+	tmpName, err := d.writeCommitGraphFile(dir, encode)
+	if err != nil {
+		return err
+	}
+
+	if err := d.fs.Rename(tmpName, d.fs.Join(dir, commitGraphPath)); err != nil {
+		_ = d.fs.Remove(tmpName)
+		return err
+	}
+
+	return d.SetCommitGraphChain(nil)
+}
+
+// AddCommitGraphLayer writes a new file of the split commit-graph with the
+// given function, returning its hash. The file isn't part of the split
+// commit-graph until it is added to its chain.
+func (d *DotGit) AddCommitGraphLayer(encode func(io.Writer) error) (plumbing.Hash, error) {
+	tmpName, err := d.writeCommitGraphFile(d.commitGraphsPath(""), encode)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	h, err := d.commitGraphChecksum(tmpName)
+	if err == nil {
+		err = d.fs.Rename(tmpName, d.commitGraphLayerPath(h))
+	}
+
+	if err != nil {
+		_ = d.fs.Remove(tmpName)
+		return plumbing.ZeroHash, err
+	}
+
+	return h, nil
+}
+
+// SetCommitGraphChain replaces the chain of the split commit-graph by the
+// given hashes of its files, from the oldest to the newest, removing the
+// files no longer in it. With a chain, the commit-graph file is removed;
+// without one, the split commit-graph is removed.
+func (d *DotGit) SetCommitGraphChain(chain []plumbing.Hash) error {
+	if len(chain) == 0 {
+		err := d.fs.Remove(d.commitGraphsPath(commitGraphChainPath))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		if err := d.writeCommitGraphChain(chain); err != nil {
+			return err
+		}
+
+		err := d.fs.Remove(d.fs.Join(objectsPath, infoPath, commitGraphPath))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return d.removeCommitGraphLayers(chain)
+}
+
+func (d *DotGit) writeCommitGraphChain(chain []plumbing.Hash) (err error) {
+	tmp, err := d.fs.TempFile(d.commitGraphsPath(""), tmpCommitGraph)
+	if err != nil {
+		return err
+	}
+
+	tmpName := tmp.Name()
+	defer func() {
+		if err != nil {
+			_ = d.fs.Remove(tmpName)
+		}
+	}()
+
+	for _, h := range chain {
+		if _, err = fmt.Fprintln(tmp, h.String()); err != nil {
+			_ = tmp.Close()
+			return err
+		}
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return d.fs.Rename(tmpName, d.commitGraphsPath(commitGraphChainPath))
+}
+
+// removeCommitGraphLayers removes the files of the split commit-graph not in
+// the given chain.
+func (d *DotGit) removeCommitGraphLayers(chain []plumbing.Hash) error {
+	files, err := d.fs.ReadDir(d.commitGraphsPath(""))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	keep := make(map[string]bool, len(chain))
+	for _, h := range chain {
+		keep[commitGraphPrefix+h.String()+commitGraphExt] = true
+	}
+
+	for _, f := range files {
+		name := f.Name()
+		if keep[name] || !strings.HasPrefix(name, commitGraphPrefix) || !strings.HasSuffix(name, commitGraphExt) {
+			continue
+		}
+
+		err := d.fs.Remove(d.commitGraphsPath(name))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeCommitGraphFile writes a commit-graph file with the given function in
+// a temporary file of the given directory, returning its name.
+func (d *DotGit) writeCommitGraphFile(dir string, encode func(io.Writer) error) (string, error) {
+	if err := d.fs.MkdirAll(dir, 0o777); err != nil {
+		return "", err
+	}
+
+	tmp, err := d.fs.TempFile(dir, tmpCommitGraph)
+	if err != nil {
+		return "", err
+	}
+
+	tmpName := tmp.Name()
+	err = encode(tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = d.fs.Remove(tmpName)
+		return "", err
+	}
+
+	return tmpName, nil
+}
+
+// commitGraphChecksum returns the checksum closing the given commit-graph
+// file, naming it in a split commit-graph.
+func (d *DotGit) commitGraphChecksum(name string) (h plumbing.Hash, err error) {
+	f, err := d.fs.Open(name)
+	if err != nil {
+		return h, err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+	if _, err := f.Seek(-hash.Size, io.SeekEnd); err != nil {
+		return h, err
+	}
+
+	_, err = io.ReadFull(f, h[:])
+	return h, err
+}
+
+func (d *DotGit) commitGraphsPath(name string) string {
+	return d.fs.Join(objectsPath, infoPath, commitGraphsPath, name)
+}
+
+func (d *DotGit) commitGraphLayerPath(h plumbing.Hash) string {
+	return d.commitGraphsPath(commitGraphPrefix + h.String() + commitGraphExt)
+}
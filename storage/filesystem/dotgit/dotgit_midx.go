@@ -0,0 +1,106 @@
+package dotgit
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+)
+
+const (
+	multiPackIndexPath = "multi-pack-index"
+
+	// multiPackIndexFilesPrefix is the prefix of the files written by git
+	// along with the multi-pack-index, as its bitmap and reverse index,
+	// named by its checksum.
+	multiPackIndexFilesPrefix = "multi-pack-index-"
+	tmpMultiPackIndex         = "tmp_midx_"
+)
+
+// MultiPackIndex returns a file pointer for read to the multi-pack-index
+// file, if there is none nil is returned.
+func (d *DotGit) MultiPackIndex() (billy.File, error) {
+	f, err := d.fs.Open(d.fs.Join(objectsPath, packPath, multiPackIndexPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// SetMultiPackIndex writes the multi-pack-index file with the given
+// function, replacing the current one.
+func (d *DotGit) SetMultiPackIndex(encode func(io.Writer) error) error {
+	dir := d.fs.Join(objectsPath, packPath)
+	if err := d.fs.MkdirAll(dir, 0o777); err != nil {
+		return err
+	}
+
+	tmp, err := d.fs.TempFile(dir, tmpMultiPackIndex)
+	if err != nil {
+		return err
+	}
+
+	tmpName := tmp.Name()
+	err = encode(tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = d.removeMultiPackIndexFiles()
+	}
+
+	if err == nil {
+		err = d.fs.Rename(tmpName, d.fs.Join(dir, multiPackIndexPath))
+	}
+
+	if err != nil {
+		_ = d.fs.Remove(tmpName)
+	}
+
+	return err
+}
+
+// RemoveMultiPackIndex removes the multi-pack-index file, if any, and the
+// files written by git along with it.
+func (d *DotGit) RemoveMultiPackIndex() error {
+	err := d.fs.Remove(d.fs.Join(objectsPath, packPath, multiPackIndexPath))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return d.removeMultiPackIndexFiles()
+}
+
+// removeMultiPackIndexFiles removes the files written by git along with the
+// multi-pack-index, which are only valid for the one they were written with.
+func (d *DotGit) removeMultiPackIndexFiles() error {
+	dir := d.fs.Join(objectsPath, packPath)
+	files, err := d.fs.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if !strings.HasPrefix(f.Name(), multiPackIndexFilesPrefix) {
+			continue
+		}
+
+		err := d.fs.Remove(d.fs.Join(dir, f.Name()))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
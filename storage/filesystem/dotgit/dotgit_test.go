@@ -816,6 +816,54 @@ func (s *SuiteDotGit) TestPackRefs() {
 	s.Equal("b8d3ffab552895c19b9fcf7aa264d277cde33881", ref.Hash().String())
 }
 
+func (s *SuiteDotGit) TestPackRefsSymbolic() {
+	fs := s.TemporalFilesystem()
+
+	dir := New(fs)
+
+	err := dir.SetRef(plumbing.NewReferenceFromStrings(
+		"refs/remotes/origin/master",
+		"e8d3ffab552895c19b9fcf7aa264d277cde33881",
+	), nil)
+	s.NoError(err)
+	err = dir.SetRef(plumbing.NewSymbolicReference(
+		"refs/remotes/origin/HEAD",
+		"refs/remotes/origin/master",
+	), nil)
+	s.NoError(err)
+
+	err = dir.PackRefs()
+	s.NoError(err)
+
+	// The symbolic ref is kept loose.
+	looseCount, err := dir.CountLooseRefs()
+	s.NoError(err)
+	s.Equal(1, looseCount)
+
+	ref, err := dir.Ref("refs/remotes/origin/HEAD")
+	s.NoError(err)
+	s.Equal(plumbing.SymbolicReference, ref.Type())
+	ref, err = dir.Ref("refs/remotes/origin/master")
+	s.NoError(err)
+	s.Equal("e8d3ffab552895c19b9fcf7aa264d277cde33881", ref.Hash().String())
+}
+
+func (s *SuiteDotGit) TestPackRefsWithBoundOS() {
+	dir := New(osfs.New(s.T().TempDir(), osfs.WithBoundOS()))
+
+	ref := plumbing.NewReferenceFromStrings("refs/heads/foo", "e8d3ffab552895c19b9fcf7aa264d277cde33881")
+	s.NoError(dir.SetRef(ref, nil))
+	s.NoError(dir.PackRefs())
+
+	looseCount, err := dir.CountLooseRefs()
+	s.NoError(err)
+	s.Equal(0, looseCount)
+
+	s.NoError(dir.RemoveRef(ref.Name()))
+	_, err = dir.Ref(ref.Name())
+	s.ErrorIs(err, plumbing.ErrReferenceNotFound)
+}
+
 func TestAlternatesDefault(t *testing.T) {
 	// Create a new dotgit object.
 	dotFS := osfs.New(t.TempDir())
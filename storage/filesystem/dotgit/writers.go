@@ -22,6 +22,9 @@ import (
 // location, if the PackWriter is not used, nothing is written.
 type PackWriter struct {
 	Notify func(plumbing.Hash, *idxfile.Writer)
+	// Promisor marks the packfile as fetched from a promisor remote, with an
+	// empty .promisor file next to it.
+	Promisor bool
 
 	fs       billy.Filesystem
 	fr, fw   billy.File
@@ -140,6 +143,17 @@ func (w *PackWriter) save() error {
 		return err
 	}
 
+	if w.Promisor {
+		f, err := w.fs.Create(fmt.Sprintf("%s.promisor", base))
+		if err != nil {
+			return err
+		}
+
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+
 	return w.fs.Rename(w.fw.Name(), fmt.Sprintf("%s.pack", base))
 }
 
@@ -0,0 +1,123 @@
+package filesystem
+
+import (
+	"io"
+
+	"github.com/go-git/go-git/v5/plumbing/format/midx"
+	"github.com/go-git/go-git/v5/utils/ioutil"
+)
+
+// MultiPackIndex returns the multi-pack-index of the packs, loaded once until
+// the packs are indexed again. As git does, it isn't used if any of its packs
+// is missing, and a corrupted or unsupported one is ignored.
+func (s *ObjectStorage) MultiPackIndex() (*midx.MultiPackIndex, error) {
+	s.muI.Lock()
+	defer s.muI.Unlock()
+
+	return s.multiPackIndex()
+}
+
+// multiPackIndex loads the multi-pack-index, s.muI must be held.
+func (s *ObjectStorage) multiPackIndex() (m *midx.MultiPackIndex, err error) {
+	if s.midxLoaded {
+		return s.midx, nil
+	}
+
+	f, err := s.dir.MultiPackIndex()
+	if err != nil || f == nil {
+		s.midxLoaded = err == nil
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+
+	m = &midx.MultiPackIndex{}
+	if err := midx.NewDecoder(f).Decode(m); err != nil {
+		s.midxLoaded = true
+		return nil, nil
+	}
+
+	packs, err := m.Packs()
+	if err != nil {
+		s.midxLoaded = true
+		return nil, nil
+	}
+
+	existing, err := s.dir.ObjectPacks()
+	if err != nil {
+		return nil, err
+	}
+
+	s.midxLoaded = true
+	available := hashListAsMap(existing)
+	for _, h := range packs {
+		if _, ok := available[h]; !ok {
+			return nil, nil
+		}
+	}
+
+	s.midx, s.midxPacks = m, hashListAsMap(packs)
+	return m, nil
+}
+
+// WriteMultiPackIndex writes the multi-pack-index of all the packs, as git
+// multi-pack-index write does, replacing the current one. Without packs, the
+// current one is removed.
+func (s *ObjectStorage) WriteMultiPackIndex() error {
+	if err := s.requireIndex(); err != nil {
+		return err
+	}
+
+	packs, err := s.dir.ObjectPacks()
+	if err != nil {
+		return err
+	}
+
+	if len(packs) == 0 {
+		return s.RemoveMultiPackIndex()
+	}
+
+	indexes := make([]midx.PackIndex, 0, len(packs))
+	for _, h := range packs {
+		idx, err := s.packIndex(h)
+		if err != nil {
+			return err
+		}
+
+		fi, err := s.dir.ObjectPackStat(h)
+		if err != nil {
+			return err
+		}
+
+		indexes = append(indexes, midx.PackIndex{Hash: h, Index: idx, ModTime: fi.ModTime()})
+	}
+
+	m, err := midx.New(indexes)
+	if err != nil {
+		return err
+	}
+
+	err = s.dir.SetMultiPackIndex(func(w io.Writer) error {
+		return midx.NewEncoder(w).Encode(m)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.muI.Lock()
+	s.midx, s.midxPacks, s.midxLoaded = m, hashListAsMap(packs), true
+	s.muI.Unlock()
+
+	return nil
+}
+
+// RemoveMultiPackIndex removes the multi-pack-index, if any, and the files
+// written by git along with it.
+func (s *ObjectStorage) RemoveMultiPackIndex() error {
+	if err := s.dir.RemoveMultiPackIndex(); err != nil {
+		return err
+	}
+
+	s.Reindex()
+	return nil
+}
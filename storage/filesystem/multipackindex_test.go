@@ -0,0 +1,140 @@
+package filesystem
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage/filesystem/dotgit"
+
+	fixtures "github.com/go-git/go-git-fixtures/v4"
+)
+
+var _ storer.MultiPackIndexStorer = (*ObjectStorage)(nil)
+
+func (s *FsSuite) TestMultiPackIndexNone() {
+	fs := fixtures.ByTag(".git").ByTag("multi-packfile").One().DotGit()
+	o := NewObjectStorage(dotgit.New(fs), cache.NewObjectLRUDefault())
+
+	m, err := o.MultiPackIndex()
+	s.NoError(err)
+	s.Nil(m)
+}
+
+func (s *FsSuite) TestWriteMultiPackIndex() {
+	fs := fixtures.ByTag(".git").ByTag("multi-packfile").One().DotGit()
+	s.NoError(NewObjectStorage(dotgit.New(fs), cache.NewObjectLRUDefault()).WriteMultiPackIndex())
+
+	o := NewObjectStorage(dotgit.New(fs), cache.NewObjectLRUDefault())
+	m, err := o.MultiPackIndex()
+	s.NoError(err)
+	s.NotNil(m)
+
+	packs, err := o.dir.ObjectPacks()
+	s.NoError(err)
+	s.Len(m.PackNames, len(packs))
+
+	hashes := []plumbing.Hash{
+		plumbing.NewHash("8d45a34641d73851e01d3754320b33bb5be3c4d3"),
+		plumbing.NewHash("e9cfa4c9ca160546efd7e8582ec77952a27b17db"),
+	}
+
+	for _, h := range hashes {
+		s.NoError(o.HasEncodedObject(h))
+
+		found, err := o.HashesWithPrefix(h[:4])
+		s.NoError(err)
+		s.Equal([]plumbing.Hash{h}, found)
+	}
+
+	s.ErrorIs(o.HasEncodedObject(plumbing.ZeroHash), plumbing.ErrObjectNotFound)
+
+	// the indexes of the packs covered by the multi-pack-index are only
+	// loaded to read their objects
+	s.Len(o.index, 0)
+
+	for _, h := range hashes {
+		obj, err := o.EncodedObject(plumbing.AnyObject, h)
+		s.NoError(err)
+		s.Equal(h, obj.Hash())
+	}
+
+	ordered, err := o.ObjectPacks()
+	s.NoError(err)
+	s.Len(ordered, len(packs))
+	expected, err := m.Packs()
+	s.NoError(err)
+	s.Equal(expected, ordered)
+}
+
+func (s *FsSuite) TestMultiPackIndexMissingPack() {
+	fs := fixtures.ByTag(".git").ByTag("multi-packfile").One().DotGit()
+	dir := dotgit.New(fs)
+	s.NoError(NewObjectStorage(dir, cache.NewObjectLRUDefault()).WriteMultiPackIndex())
+
+	packs, err := dir.ObjectPacks()
+	s.NoError(err)
+	s.NoError(fs.Remove(fs.Join("objects", "pack", "pack-"+packs[0].String()+".pack")))
+	s.NoError(fs.Remove(fs.Join("objects", "pack", "pack-"+packs[0].String()+".idx")))
+
+	o := NewObjectStorage(dotgit.New(fs), cache.NewObjectLRUDefault())
+	m, err := o.MultiPackIndex()
+	s.NoError(err)
+	s.Nil(m)
+
+	iter, err := o.IterEncodedObjects(plumbing.AnyObject)
+	s.NoError(err)
+	err = iter.ForEach(func(obj plumbing.EncodedObject) error {
+		return o.HasEncodedObject(obj.Hash())
+	})
+	s.NoError(err)
+}
+
+func (s *FsSuite) TestDeleteOldObjectPackAndIndexRemovesMultiPackIndex() {
+	fs := fixtures.ByTag(".git").ByTag("multi-packfile").One().DotGit()
+	o := NewObjectStorage(dotgit.New(fs), cache.NewObjectLRUDefault())
+	s.NoError(o.WriteMultiPackIndex())
+
+	packs, err := o.ObjectPacks()
+	s.NoError(err)
+	s.NoError(o.DeleteOldObjectPackAndIndex(packs[0], time.Time{}))
+
+	_, err = fs.Stat(fs.Join("objects", "pack", "multi-pack-index"))
+	s.ErrorIs(err, os.ErrNotExist)
+
+	m, err := o.MultiPackIndex()
+	s.NoError(err)
+	s.Nil(m)
+}
+
+func (s *FsSuite) TestMultiPackIndexConcurrentReindex() {
+	fs := fixtures.ByTag(".git").ByTag("multi-packfile").One().DotGit()
+	o := NewObjectStorage(dotgit.New(fs), cache.NewObjectLRUDefault())
+	s.NoError(o.WriteMultiPackIndex())
+
+	h := plumbing.NewHash("8d45a34641d73851e01d3754320b33bb5be3c4d3")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				s.NoError(o.HasEncodedObject(h))
+
+				found, err := o.HashesWithPrefix(h[:4])
+				s.NoError(err)
+				s.Equal([]plumbing.Hash{h}, found)
+			}
+		}()
+	}
+
+	for j := 0; j < 20; j++ {
+		o.Reindex()
+	}
+
+	wg.Wait()
+}
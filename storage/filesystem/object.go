@@ -11,6 +11,7 @@ import (
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/cache"
 	"github.com/go-git/go-git/v5/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v5/plumbing/format/midx"
 	"github.com/go-git/go-git/v5/plumbing/format/objfile"
 	"github.com/go-git/go-git/v5/plumbing/format/packfile"
 	"github.com/go-git/go-git/v5/plumbing/storer"
@@ -28,11 +29,23 @@ type ObjectStorage struct {
 	dir   *dotgit.DotGit
 	index map[plumbing.Hash]idxfile.Index
 
+	// midx is the multi-pack-index, if loaded, and midxPacks its packs,
+	// whose indexes are only loaded to read their objects. They are guarded
+	// by muI, as index.
+	midx       *midx.MultiPackIndex
+	midxPacks  map[plumbing.Hash]struct{}
+	midxLoaded bool
+
 	packList    []plumbing.Hash
 	packListIdx int
 	packfiles   map[plumbing.Hash]*packfile.Packfile
 	muI         sync.RWMutex
 	muP         sync.RWMutex
+
+	// promisor fetches the objects missing in a partial clone, the fetches
+	// are serialized by muF.
+	promisor storer.FetchObjectsFunc
+	muF      sync.Mutex
 }
 
 // NewObjectStorage creates a new ObjectStorage with the given .git directory and cache.
@@ -50,10 +63,17 @@ func NewObjectStorageWithOptions(dir *dotgit.DotGit, objectCache cache.Object, o
 }
 
 func (s *ObjectStorage) requireIndex() error {
+	s.muI.Lock()
+	defer s.muI.Unlock()
+
 	if s.index != nil {
 		return nil
 	}
 
+	if _, err := s.multiPackIndex(); err != nil {
+		return err
+	}
+
 	s.index = make(map[plumbing.Hash]idxfile.Index)
 	packs, err := s.dir.ObjectPacks()
 	if err != nil {
@@ -61,6 +81,10 @@ func (s *ObjectStorage) requireIndex() error {
 	}
 
 	for _, h := range packs {
+		if _, ok := s.midxPacks[h]; ok {
+			continue
+		}
+
 		if err := s.loadIdxFile(h); err != nil {
 			return err
 		}
@@ -71,7 +95,35 @@ func (s *ObjectStorage) requireIndex() error {
 
 // Reindex indexes again all packfiles. Useful if git changed packfiles externally
 func (s *ObjectStorage) Reindex() {
+	s.muI.Lock()
+	defer s.muI.Unlock()
+
 	s.index = nil
+	s.midx, s.midxPacks, s.midxLoaded = nil, nil, false
+}
+
+// packIndex returns the index of the given pack, loading it if the pack is
+// covered by the multi-pack-index.
+func (s *ObjectStorage) packIndex(pack plumbing.Hash) (idxfile.Index, error) {
+	s.muI.RLock()
+	idx, ok := s.index[pack]
+	s.muI.RUnlock()
+	if ok {
+		return idx, nil
+	}
+
+	s.muI.Lock()
+	defer s.muI.Unlock()
+
+	if idx, ok := s.index[pack]; ok {
+		return idx, nil
+	}
+
+	if err := s.loadIdxFile(pack); err != nil {
+		return nil, err
+	}
+
+	return s.index[pack], nil
 }
 
 func (s *ObjectStorage) loadIdxFile(h plumbing.Hash) (err error) {
@@ -111,6 +163,16 @@ func (s *ObjectStorage) NewEncodedObject() plumbing.EncodedObject {
 }
 
 func (s *ObjectStorage) PackfileWriter() (io.WriteCloser, error) {
+	return s.packfileWriter(false)
+}
+
+// PromisorPackfileWriter returns a writer for a packfile fetched from a
+// promisor remote, saved with a .promisor file as git does.
+func (s *ObjectStorage) PromisorPackfileWriter() (io.WriteCloser, error) {
+	return s.packfileWriter(true)
+}
+
+func (s *ObjectStorage) packfileWriter(promisor bool) (io.WriteCloser, error) {
 	if err := s.requireIndex(); err != nil {
 		return nil, err
 	}
@@ -120,10 +182,13 @@ func (s *ObjectStorage) PackfileWriter() (io.WriteCloser, error) {
 		return nil, err
 	}
 
+	w.Promisor = promisor
 	w.Notify = func(h plumbing.Hash, writer *idxfile.Writer) {
 		index, err := writer.Index()
 		if err == nil {
+			s.muI.Lock()
 			s.index[h] = index
+			s.muI.Unlock()
 		}
 	}
 
@@ -194,10 +259,21 @@ func (s *ObjectStorage) HasEncodedObject(h plumbing.Hash) (err error) {
 		return err
 	}
 	_, _, offset := s.findObjectInPackfile(h)
-	if offset == -1 {
-		return plumbing.ErrObjectNotFound
+	if offset != -1 {
+		return nil
 	}
-	return nil
+
+	// Check the objects of the shared object repositories.
+	dotgits, err := s.dir.Alternates()
+	if err == nil {
+		for _, dg := range dotgits {
+			if NewObjectStorage(dg, s.objectCache).HasEncodedObject(h) == nil {
+				return nil
+			}
+		}
+	}
+
+	return plumbing.ErrObjectNotFound
 }
 
 func (s *ObjectStorage) encodedObjectSizeFromUnpacked(h plumbing.Hash) (
@@ -303,7 +379,11 @@ func (s *ObjectStorage) encodedObjectSizeFromPackfile(h plumbing.Hash) (
 		return 0, plumbing.ErrObjectNotFound
 	}
 
-	idx := s.index[pack]
+	idx, err := s.packIndex(pack)
+	if err != nil {
+		return 0, err
+	}
+
 	hash, err := idx.FindHash(offset)
 	if err == nil {
 		obj, ok := s.objectCache.Get(hash)
@@ -343,10 +423,59 @@ func (s *ObjectStorage) EncodedObjectSize(h plumbing.Hash) (
 // EncodedObject returns the object with the given hash, by searching for it in
 // the packfile and the git object directories.
 func (s *ObjectStorage) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	obj, err := s.encodedObject(t, h)
+
+	// If the object is still not found, it may be promised by the promisor
+	// remote of a partial clone.
+	if err == plumbing.ErrObjectNotFound && s.promisor != nil {
+		obj, err = s.fetchPromised(t, h)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if obj == nil || (plumbing.AnyObject != t && obj.Type() != t) {
+		return nil, plumbing.ErrObjectNotFound
+	}
+
+	return obj, nil
+}
+
+// SetPromisor sets the function fetching the objects missing in a partial
+// clone, called by EncodedObject if the object isn't found. A nil function
+// disables the lazy fetching. The fetches are serialized, so the function
+// must not read from the storage the objects missing in it.
+func (s *ObjectStorage) SetPromisor(fetch storer.FetchObjectsFunc) {
+	s.promisor = fetch
+}
+
+func (s *ObjectStorage) fetchPromised(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	s.muF.Lock()
+	defer s.muF.Unlock()
+
+	// The object may have been fetched while waiting for another fetch.
+	obj, err := s.encodedObject(t, h)
+	if err != plumbing.ErrObjectNotFound {
+		return obj, err
+	}
+
+	if err := s.promisor(h); err != nil {
+		return nil, err
+	}
+
+	return s.encodedObject(t, h)
+}
+
+func (s *ObjectStorage) encodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
 	var obj plumbing.EncodedObject
 	var err error
 
-	if s.index != nil {
+	s.muI.RLock()
+	indexed := s.index != nil
+	s.muI.RUnlock()
+
+	if indexed {
 		obj, err = s.getFromPackfile(h, false)
 		if err == plumbing.ErrObjectNotFound {
 			obj, err = s.getFromUnpacked(h)
@@ -376,15 +505,7 @@ func (s *ObjectStorage) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (p
 		}
 	}
 
-	if err != nil {
-		return nil, err
-	}
-
-	if obj == nil || (plumbing.AnyObject != t && obj.Type() != t) {
-		return nil, plumbing.ErrObjectNotFound
-	}
-
-	return obj, nil
+	return obj, err
 }
 
 // DeltaObject returns the object with the given hash, by searching for
@@ -481,9 +602,10 @@ func (s *ObjectStorage) getFromPackfile(h plumbing.Hash, canBeDelta bool) (
 		return nil, plumbing.ErrObjectNotFound
 	}
 
-	s.muI.RLock()
-	idx := s.index[pack]
-	s.muI.RUnlock()
+	idx, err := s.packIndex(pack)
+	if err != nil {
+		return nil, err
+	}
 
 	p, err := s.packfile(idx, pack)
 	if err != nil {
@@ -556,7 +678,18 @@ func (s *ObjectStorage) findObjectInPackfile(h plumbing.Hash) (plumbing.Hash, pl
 	defer s.muI.Unlock()
 	s.muI.Lock()
 
+	if s.midx != nil {
+		pack, offset, err := s.midx.FindOffset(h)
+		if err == nil {
+			return pack, h, offset
+		}
+	}
+
 	for packfile, index := range s.index {
+		if _, ok := s.midxPacks[packfile]; ok {
+			continue
+		}
+
 		offset, err := index.FindOffset(h)
 		if err == nil {
 			return packfile, h, offset
@@ -581,7 +714,22 @@ func (s *ObjectStorage) HashesWithPrefix(prefix []byte) ([]plumbing.Hash, error)
 	if err := s.requireIndex(); err != nil {
 		return nil, err
 	}
-	for _, index := range s.index {
+
+	s.muI.Lock()
+	defer s.muI.Unlock()
+
+	if s.midx != nil {
+		for _, h := range s.midx.HashesWithPrefix(prefix) {
+			if _, ok := seen[h]; ok {
+				continue
+			}
+			hashes = append(hashes, h)
+		}
+	}
+	for pack, index := range s.index {
+		if _, ok := s.midxPacks[pack]; ok {
+			continue
+		}
 		ei, err := index.Entries()
 		if err != nil {
 			return nil, err
@@ -645,12 +793,16 @@ func (s *ObjectStorage) buildPackfileIters(
 	return &lazyPackfilesIter{
 		hashes: packs,
 		open: func(h plumbing.Hash) (storer.EncodedObjectIter, error) {
+			idx, err := s.packIndex(h)
+			if err != nil {
+				return nil, err
+			}
 			pack, err := s.dir.ObjectPack(h)
 			if err != nil {
 				return nil, err
 			}
 			return newPackfileIter(
-				s.dir.Fs(), pack, t, seen, s.index[h],
+				s.dir.Fs(), pack, t, seen, idx,
 				s.objectCache, s.options.KeepDescriptors,
 			)
 		},
@@ -707,10 +859,65 @@ func (s *ObjectStorage) DeleteLooseObject(hash plumbing.Hash) error {
 	return s.dir.ObjectDelete(hash)
 }
 
+// ObjectPacks returns the hashes of the packs, the ones covered by the
+// multi-pack-index first, in its order, as the objects are looked up in them
+// first.
 func (s *ObjectStorage) ObjectPacks() ([]plumbing.Hash, error) {
-	return s.dir.ObjectPacks()
+	packs, err := s.dir.ObjectPacks()
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := s.MultiPackIndex()
+	if err != nil || m == nil {
+		return packs, err
+	}
+
+	ordered, err := m.Packs()
+	if err != nil {
+		return nil, err
+	}
+
+	covered := hashListAsMap(ordered)
+	for _, h := range packs {
+		if _, ok := covered[h]; !ok {
+			ordered = append(ordered, h)
+		}
+	}
+
+	return ordered, nil
 }
 
 func (s *ObjectStorage) DeleteOldObjectPackAndIndex(h plumbing.Hash, t time.Time) error {
-	return s.dir.DeleteOldObjectPackAndIndex(h, t)
+	// The multi-pack-index is removed, as git does, if it covers the pack,
+	// which may be deleted.
+	m, err := s.MultiPackIndex()
+	if err != nil {
+		return err
+	}
+
+	if m != nil && m.HasPack(h) {
+		if err := s.dir.RemoveMultiPackIndex(); err != nil {
+			return err
+		}
+	}
+
+	if err := s.dir.DeleteOldObjectPackAndIndex(h, t); err != nil {
+		return err
+	}
+
+	// The packs are indexed again and the cached objects, which may be
+	// read lazily from the deleted pack, are dropped.
+	s.Reindex()
+	s.objectCache.Clear()
+
+	s.muP.Lock()
+	defer s.muP.Unlock()
+
+	if p, ok := s.packfiles[h]; ok {
+		delete(s.packfiles, h)
+		return p.Close()
+	}
+
+	return nil
 }
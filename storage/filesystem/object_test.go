@@ -6,7 +6,10 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-billy/v5/osfs"
@@ -621,3 +624,52 @@ func (s *FsSuite) TestGetFromUnpackedDoesNotCacheLargeObjects() {
 	_, ok = objectCache.Get(hash)
 	s.False(ok)
 }
+
+func (s *FsSuite) TestEncodedObjectFetchPromisedConcurrently() {
+	o := NewObjectStorage(dotgit.New(osfs.New(s.T().TempDir())), cache.NewObjectLRUDefault())
+
+	promised := make(map[plumbing.Hash]plumbing.EncodedObject)
+	for i := 0; i < 8; i++ {
+		obj := &plumbing.MemoryObject{}
+		obj.SetType(plumbing.BlobObject)
+		_, err := obj.Write([]byte(fmt.Sprintf("promised %d", i)))
+		s.NoError(err)
+		promised[obj.Hash()] = obj
+	}
+
+	var fetches atomic.Int32
+	o.SetPromisor(func(hashes ...plumbing.Hash) error {
+		fetches.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		for _, h := range hashes {
+			if _, err := o.SetEncodedObject(promised[h]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(promised))
+	for h := range promised {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			obj, err := o.EncodedObject(plumbing.BlobObject, h)
+			if err == nil && obj.Hash() != h {
+				err = fmt.Errorf("unexpected object %s", obj.Hash())
+			}
+
+			errs <- err
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		s.NoError(err)
+	}
+
+	s.Equal(int32(len(promised)), fetches.Load())
+}
@@ -0,0 +1,54 @@
+package filesystem
+
+import (
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/reflog"
+	"github.com/go-git/go-git/v5/storage/filesystem/dotgit"
+	"github.com/go-git/go-git/v5/utils/ioutil"
+)
+
+// ReflogStorage stores the reference logs in the logs directory of the .git
+// folder, in the same format used by git.
+type ReflogStorage struct {
+	dir *dotgit.DotGit
+}
+
+// Reflog returns the entries of the reflog of the given reference, from the
+// oldest to the newest.
+func (s *ReflogStorage) Reflog(name plumbing.ReferenceName) (entries []*reflog.Entry, err error) {
+	f, err := s.dir.Reflog(name)
+	if f == nil || err != nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+	return reflog.NewDecoder(f).Decode()
+}
+
+// AppendReflog adds the given entry at the end of the reflog of the given
+// reference.
+func (s *ReflogStorage) AppendReflog(name plumbing.ReferenceName, e *reflog.Entry) (err error) {
+	f, err := s.dir.ReflogAppender(name)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+	return reflog.NewEncoder(f).Encode(e)
+}
+
+// SetReflog replaces the reflog of the given reference by the given entries.
+func (s *ReflogStorage) SetReflog(name plumbing.ReferenceName, entries []*reflog.Entry) (err error) {
+	f, err := s.dir.ReflogWriter(name)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+	return reflog.NewEncoder(f).Encode(entries...)
+}
+
+// RemoveReflog removes the reflog of the given reference.
+func (s *ReflogStorage) RemoveReflog(name plumbing.ReferenceName) error {
+	return s.dir.RemoveReflog(name)
+}
@@ -19,8 +19,10 @@ type Storage struct {
 	ReferenceStorage
 	IndexStorage
 	ShallowStorage
+	ReflogStorage
 	ConfigStorage
 	ModuleStorage
+	CommitGraphStorage
 }
 
 // Options holds configuration for the storage.
@@ -69,8 +71,11 @@ func NewStorageWithOptions(fs billy.Filesystem, c cache.Object, ops Options) *St
 		ReferenceStorage: ReferenceStorage{dir: dir},
 		IndexStorage:     IndexStorage{dir: dir},
 		ShallowStorage:   ShallowStorage{dir: dir},
+		ReflogStorage:    ReflogStorage{dir: dir},
 		ConfigStorage:    ConfigStorage{dir: dir},
 		ModuleStorage:    ModuleStorage{dir: dir},
+
+		CommitGraphStorage: CommitGraphStorage{dir: dir},
 	}
 }
 
@@ -79,6 +84,16 @@ func (s *Storage) Filesystem() billy.Filesystem {
 	return s.fs
 }
 
+// Close closes the object storage and the commit-graph loaded.
+func (s *Storage) Close() error {
+	err := s.ObjectStorage.Close()
+	if cgErr := s.CommitGraphStorage.Close(); err == nil {
+		err = cgErr
+	}
+
+	return err
+}
+
 // Init initializes .git directory
 func (s *Storage) Init() error {
 	return s.dir.Initialize()
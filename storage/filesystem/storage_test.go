@@ -23,6 +23,7 @@ var (
 	_ storer.ShallowStorer       = sto
 	_ storer.DeltaObjectStorer   = sto
 	_ storer.PackfileWriter      = sto
+	_ storer.CommitGraphStorer   = sto
 )
 
 func TestFilesystem(t *testing.T) {
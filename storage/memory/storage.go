@@ -4,11 +4,13 @@ package memory
 import (
 	"fmt"
 	"io"
+	"sync"
 	"time"
 
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/format/reflog"
 	"github.com/go-git/go-git/v5/plumbing/storer"
 	"github.com/go-git/go-git/v5/storage"
 	"github.com/go-git/go-git/v5/utils/ioutil"
@@ -26,6 +28,7 @@ type Storage struct {
 	ShallowStorage
 	IndexStorage
 	ReferenceStorage
+	ReflogStorage
 	ModuleStorage
 }
 
@@ -33,6 +36,7 @@ type Storage struct {
 func NewStorage() *Storage {
 	return &Storage{
 		ReferenceStorage: make(ReferenceStorage),
+		ReflogStorage:    make(ReflogStorage),
 		ConfigStorage:    ConfigStorage{},
 		ShallowStorage:   ShallowStorage{},
 		ObjectStorage: ObjectStorage{
@@ -90,6 +94,9 @@ type ObjectStorage struct {
 	Trees   map[plumbing.Hash]plumbing.EncodedObject
 	Blobs   map[plumbing.Hash]plumbing.EncodedObject
 	Tags    map[plumbing.Hash]plumbing.EncodedObject
+
+	promisor storer.FetchObjectsFunc
+	muF      sync.Mutex
 }
 
 type lazyCloser struct {
@@ -149,6 +156,31 @@ func (o *ObjectStorage) SetEncodedObject(obj plumbing.EncodedObject) (plumbing.H
 	return h, nil
 }
 
+// SetPromisor sets the function fetching the objects missing in a partial
+// clone, called by EncodedObject if the object isn't found. A nil function
+// disables the lazy fetching. The fetches are serialized, so the function
+// must not read from the storage the objects missing in it.
+func (o *ObjectStorage) SetPromisor(fetch storer.FetchObjectsFunc) {
+	o.promisor = fetch
+}
+
+func (o *ObjectStorage) fetchPromised(h plumbing.Hash) (plumbing.EncodedObject, bool, error) {
+	o.muF.Lock()
+	defer o.muF.Unlock()
+
+	// The object may have been fetched while waiting for another fetch.
+	if obj, ok := o.Objects[h]; ok {
+		return obj, true, nil
+	}
+
+	if err := o.promisor(h); err != nil {
+		return nil, false, err
+	}
+
+	obj, ok := o.Objects[h]
+	return obj, ok, nil
+}
+
 func (o *ObjectStorage) HasEncodedObject(h plumbing.Hash) (err error) {
 	if _, ok := o.Objects[h]; !ok {
 		return plumbing.ErrObjectNotFound
@@ -168,6 +200,13 @@ func (o *ObjectStorage) EncodedObjectSize(h plumbing.Hash) (
 
 func (o *ObjectStorage) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
 	obj, ok := o.Objects[h]
+	if !ok && o.promisor != nil {
+		var err error
+		if obj, ok, err = o.fetchPromised(h); err != nil {
+			return nil, err
+		}
+	}
+
 	if !ok || (plumbing.AnyObject != t && obj.Type() != t) {
 		return nil, plumbing.ErrObjectNotFound
 	}
@@ -334,6 +373,27 @@ func (r ReferenceStorage) RemoveReference(n plumbing.ReferenceName) error {
 	return nil
 }
 
+type ReflogStorage map[plumbing.ReferenceName][]*reflog.Entry
+
+func (s ReflogStorage) Reflog(n plumbing.ReferenceName) ([]*reflog.Entry, error) {
+	return append([]*reflog.Entry(nil), s[n]...), nil
+}
+
+func (s ReflogStorage) AppendReflog(n plumbing.ReferenceName, e *reflog.Entry) error {
+	s[n] = append(s[n], e)
+	return nil
+}
+
+func (s ReflogStorage) SetReflog(n plumbing.ReferenceName, entries []*reflog.Entry) error {
+	s[n] = append([]*reflog.Entry(nil), entries...)
+	return nil
+}
+
+func (s ReflogStorage) RemoveReflog(n plumbing.ReferenceName) error {
+	delete(s, n)
+	return nil
+}
+
 type ShallowStorage []plumbing.Hash
 
 func (s *ShallowStorage) SetShallow(commits []plumbing.Hash) error {
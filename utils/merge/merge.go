@@ -0,0 +1,361 @@
+// Package merge implements a line oriented three-way merge of text content,
+// similar to the one performed by the git merge-file command.
+//
+// The changes between a common ancestor (base) and each of the two versions
+// being merged (ours and theirs) are computed using the line oriented diff
+// from the utils/diff package. Changes that do not overlap are combined
+// automatically, while overlapping changes that are not identical are
+// reported as conflicts and delimited by conflict markers in the result.
+package merge
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/go-git/go-git/v5/utils/binary"
+	"github.com/go-git/go-git/v5/utils/diff"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// DefaultMarkerSize is the default amount of characters used by the
+// conflict markers.
+const DefaultMarkerSize = 7
+
+// ConflictStyle defines how conflicting hunks are represented.
+type ConflictStyle int8
+
+const (
+	// MergeStyle represents the conflicts with the lines from ours and
+	// theirs, separated by a "=======" marker. This is the default style.
+	MergeStyle ConflictStyle = iota
+	// Diff3Style represents the conflicts as MergeStyle does, but it also
+	// includes the original lines from the base, after a "|||||||" marker.
+	Diff3Style
+)
+
+// Favor defines how overlapping changes should be resolved.
+type Favor int8
+
+const (
+	// NoFavor leaves the overlapping changes as conflicts. This is the
+	// default behavior.
+	NoFavor Favor = iota
+	// FavorOurs resolves overlapping changes using the lines from ours.
+	FavorOurs
+	// FavorTheirs resolves overlapping changes using the lines from theirs.
+	FavorTheirs
+	// FavorUnion resolves overlapping changes using the lines from ours
+	// followed by the lines from theirs.
+	FavorUnion
+)
+
+// Options are the options used to perform a three-way merge.
+type Options struct {
+	// OursLabel is the label used next to the "<<<<<<<" marker.
+	OursLabel string
+	// BaseLabel is the label used next to the "|||||||" marker.
+	BaseLabel string
+	// TheirsLabel is the label used next to the ">>>>>>>" marker.
+	TheirsLabel string
+	// Style is the conflict style used on the merged content.
+	Style ConflictStyle
+	// Favor defines how overlapping changes are resolved.
+	Favor Favor
+	// MarkerSize is the amount of characters used by the conflict markers,
+	// if zero DefaultMarkerSize is used.
+	MarkerSize int
+}
+
+// Result is the outcome of a three-way merge.
+type Result struct {
+	// Content is the merged content, including the conflict markers of any
+	// unresolved conflict.
+	Content []byte
+	// Conflicts is the number of conflicting hunks found.
+	Conflicts int
+}
+
+// IsClean returns true if the merge did not result in any conflict.
+func (r *Result) IsClean() bool {
+	return r.Conflicts == 0
+}
+
+// Merge performs a line oriented three-way merge between ours and theirs,
+// using base as their common ancestor. If opts is nil the default options
+// are used.
+func Merge(base, ours, theirs []byte, opts *Options) *Result {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	m := &merger{
+		opts:   opts,
+		base:   splitLines(string(base)),
+		marker: opts.MarkerSize,
+	}
+
+	if m.marker <= 0 {
+		m.marker = DefaultMarkerSize
+	}
+
+	m.do(
+		hunks(string(base), string(ours)),
+		hunks(string(base), string(theirs)),
+	)
+
+	return &Result{
+		Content:   m.out.Bytes(),
+		Conflicts: m.conflicts,
+	}
+}
+
+// IsBinary returns true if any of the given contents is considered binary,
+// in which case a line oriented merge cannot be performed.
+func IsBinary(contents ...[]byte) bool {
+	for _, c := range contents {
+		bin, err := binary.IsBinary(bytes.NewReader(c))
+		if err != nil || bin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hunk represents the replacement of the base lines in the range
+// [start, end) by the given lines.
+type hunk struct {
+	start, end int
+	lines      []string
+}
+
+// hunks computes the list of hunks needed to turn src into dst, sorted by
+// their position in src.
+func hunks(src, dst string) []hunk {
+	var (
+		result []hunk
+		cur    *hunk
+		line   int
+	)
+
+	for _, d := range diff.Do(src, dst) {
+		lines := splitLines(d.Text)
+		if d.Type == diffmatchpatch.DiffEqual {
+			if cur != nil {
+				result = append(result, *cur)
+				cur = nil
+			}
+
+			line += len(lines)
+			continue
+		}
+
+		if cur == nil {
+			cur = &hunk{start: line, end: line}
+		}
+
+		switch d.Type {
+		case diffmatchpatch.DiffDelete:
+			line += len(lines)
+			cur.end = line
+		case diffmatchpatch.DiffInsert:
+			cur.lines = append(cur.lines, lines...)
+		}
+	}
+
+	if cur != nil {
+		result = append(result, *cur)
+	}
+
+	return result
+}
+
+type merger struct {
+	opts      *Options
+	base      []string
+	marker    int
+	out       bytes.Buffer
+	conflicts int
+}
+
+func (m *merger) do(ours, theirs []hunk) {
+	var pos, i, j int
+	for i < len(ours) || j < len(theirs) {
+		start := nextStart(ours, i, theirs, j)
+		m.write(m.base[pos:start])
+
+		end := start
+		oi, tj := i, j
+		for {
+			advanced := false
+			if i < len(ours) && ours[i].start <= end {
+				end = max(end, ours[i].end)
+				advanced = true
+				i++
+			}
+
+			if j < len(theirs) && theirs[j].start <= end {
+				end = max(end, theirs[j].end)
+				advanced = true
+				j++
+			}
+
+			if !advanced {
+				break
+			}
+		}
+
+		m.region(start, end, ours[oi:i], theirs[tj:j])
+		pos = end
+	}
+
+	m.write(m.base[pos:])
+}
+
+func nextStart(ours []hunk, i int, theirs []hunk, j int) int {
+	switch {
+	case i >= len(ours):
+		return theirs[j].start
+	case j >= len(theirs):
+		return ours[i].start
+	default:
+		return min(ours[i].start, theirs[j].start)
+	}
+}
+
+// region merges the base lines in the range [start, end) which are modified
+// by the given hunks of ours and theirs.
+func (m *merger) region(start, end int, ours, theirs []hunk) {
+	if len(theirs) == 0 {
+		m.write(m.apply(start, end, ours))
+		return
+	}
+
+	if len(ours) == 0 {
+		m.write(m.apply(start, end, theirs))
+		return
+	}
+
+	o := m.apply(start, end, ours)
+	t := m.apply(start, end, theirs)
+	if equalLines(o, t) {
+		m.write(o)
+		return
+	}
+
+	switch m.opts.Favor {
+	case FavorOurs:
+		m.write(o)
+		return
+	case FavorTheirs:
+		m.write(t)
+		return
+	case FavorUnion:
+		m.write(o)
+		m.write(t)
+		return
+	}
+
+	var suffix []string
+	base := m.base[start:end]
+	if m.opts.Style == MergeStyle {
+		// Lines shared at the beginning or the end of both sides are not part
+		// of the conflict, as in the git "zealous" merge level.
+		var n int
+		for n < len(o) && n < len(t) && o[n] == t[n] {
+			n++
+		}
+
+		m.write(o[:n])
+		o, t = o[n:], t[n:]
+
+		n = 0
+		for n < len(o) && n < len(t) && o[len(o)-1-n] == t[len(t)-1-n] {
+			n++
+		}
+
+		suffix = o[len(o)-n:]
+		o, t = o[:len(o)-n], t[:len(t)-n]
+	}
+
+	m.conflicts++
+	m.writeMarker('<', m.opts.OursLabel)
+	m.writeSide(o)
+	if m.opts.Style == Diff3Style {
+		m.writeMarker('|', m.opts.BaseLabel)
+		m.writeSide(base)
+	}
+
+	m.writeMarker('=', "")
+	m.writeSide(t)
+	m.writeMarker('>', m.opts.TheirsLabel)
+	m.write(suffix)
+}
+
+// apply returns the base lines in the range [start, end) after applying the
+// given hunks.
+func (m *merger) apply(start, end int, hs []hunk) []string {
+	var lines []string
+	pos := start
+	for _, h := range hs {
+		lines = append(lines, m.base[pos:h.start]...)
+		lines = append(lines, h.lines...)
+		pos = h.end
+	}
+
+	return append(lines, m.base[pos:end]...)
+}
+
+func (m *merger) write(lines []string) {
+	for _, l := range lines {
+		m.out.WriteString(l)
+	}
+}
+
+// writeSide writes the lines of one side of a conflict, making sure the
+// following marker starts on a new line.
+func (m *merger) writeSide(lines []string) {
+	m.write(lines)
+	if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		m.out.WriteByte('\n')
+	}
+}
+
+func (m *merger) writeMarker(c byte, label string) {
+	m.out.Write(bytes.Repeat([]byte{c}, m.marker))
+	if label != "" {
+		m.out.WriteByte(' ')
+		m.out.WriteString(label)
+	}
+
+	m.out.WriteByte('\n')
+}
+
+// splitLines splits s in lines, keeping the line terminators.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,112 @@
+package merge_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-git/go-git/v5/utils/merge"
+	"github.com/stretchr/testify/suite"
+)
+
+type MergeSuite struct {
+	suite.Suite
+}
+
+func TestMergeSuite(t *testing.T) {
+	suite.Run(t, new(MergeSuite))
+}
+
+var mergeTests = [...]struct {
+	base, ours, theirs string
+	expected           string
+	conflicts          int
+}{
+	// no changes
+	{"a\nb\nc\n", "a\nb\nc\n", "a\nb\nc\n", "a\nb\nc\n", 0},
+	// changes only on one side
+	{"a\nb\nc\n", "a\nB\nc\n", "a\nb\nc\n", "a\nB\nc\n", 0},
+	{"a\nb\nc\n", "a\nb\nc\n", "a\nb\nC\n", "a\nb\nC\n", 0},
+	// non overlapping changes
+	{"a\nb\nc\nd\ne\n", "A\nb\nc\nd\ne\n", "a\nb\nc\nd\nE\n", "A\nb\nc\nd\nE\n", 0},
+	// same change on both sides
+	{"a\nb\nc\n", "a\nX\nc\n", "a\nX\nc\n", "a\nX\nc\n", 0},
+	// deletions
+	{"a\nb\nc\nd\ne\n", "b\nc\nd\ne\n", "a\nb\nc\nd\n", "b\nc\nd\n", 0},
+	// empty base
+	{"", "a\n", "", "a\n", 0},
+	// conflicting changes
+	{
+		"a\nb\nc\n", "a\nX\nc\n", "a\nY\nc\n",
+		"a\n<<<<<<< ours\nX\n=======\nY\n>>>>>>> theirs\nc\n", 1,
+	},
+	// adjacent changes conflict
+	{
+		"a\nb\nc\n", "a\nX\nc\n", "a\nb\nY\n",
+		"a\n<<<<<<< ours\nX\nc\n=======\nb\nY\n>>>>>>> theirs\n", 1,
+	},
+	// common lines are kept out of the conflict
+	{
+		"a\n", "a\nx\ny\n", "a\nx\nz\n",
+		"a\nx\n<<<<<<< ours\ny\n=======\nz\n>>>>>>> theirs\n", 1,
+	},
+	// missing new line at the end of file
+	{
+		"a", "b", "c",
+		"<<<<<<< ours\nb\n=======\nc\n>>>>>>> theirs\n", 1,
+	},
+	// multiple conflicts
+	{
+		"a\nb\nc\nd\ne\n", "X\nb\nc\nd\nX\n", "Y\nb\nc\nd\nY\n",
+		"<<<<<<< ours\nX\n=======\nY\n>>>>>>> theirs\nb\nc\nd\n<<<<<<< ours\nX\n=======\nY\n>>>>>>> theirs\n", 2,
+	},
+}
+
+func (s *MergeSuite) TestMerge() {
+	for i, t := range mergeTests {
+		r := merge.Merge([]byte(t.base), []byte(t.ours), []byte(t.theirs), &merge.Options{
+			OursLabel:   "ours",
+			TheirsLabel: "theirs",
+		})
+
+		msg := fmt.Sprintf("subtest %d, base=%q, ours=%q, theirs=%q", i, t.base, t.ours, t.theirs)
+		s.Equal(t.expected, string(r.Content), msg)
+		s.Equal(t.conflicts, r.Conflicts, msg)
+		s.Equal(t.conflicts == 0, r.IsClean(), msg)
+	}
+}
+
+func (s *MergeSuite) TestMergeDiff3Style() {
+	r := merge.Merge([]byte("a\nb\nc\n"), []byte("a\nX\nc\n"), []byte("a\nY\nc\n"), &merge.Options{
+		OursLabel:   "ours",
+		BaseLabel:   "base",
+		TheirsLabel: "theirs",
+		Style:       merge.Diff3Style,
+	})
+
+	s.Equal(1, r.Conflicts)
+	s.Equal("a\n<<<<<<< ours\nX\n||||||| base\nb\n=======\nY\n>>>>>>> theirs\nc\n", string(r.Content))
+}
+
+func (s *MergeSuite) TestMergeFavor() {
+	base, ours, theirs := []byte("a\nb\nc\n"), []byte("a\nX\nc\n"), []byte("a\nY\nc\n")
+
+	for favor, expected := range map[merge.Favor]string{
+		merge.FavorOurs:   "a\nX\nc\n",
+		merge.FavorTheirs: "a\nY\nc\n",
+		merge.FavorUnion:  "a\nX\nY\nc\n",
+	} {
+		r := merge.Merge(base, ours, theirs, &merge.Options{Favor: favor})
+		s.True(r.IsClean())
+		s.Equal(expected, string(r.Content))
+	}
+}
+
+func (s *MergeSuite) TestMergeMarkerSize() {
+	r := merge.Merge([]byte("a\n"), []byte("b\n"), []byte("c\n"), &merge.Options{MarkerSize: 3})
+	s.Equal("<<<\nb\n===\nc\n>>>\n", string(r.Content))
+}
+
+func (s *MergeSuite) TestIsBinary() {
+	s.False(merge.IsBinary([]byte("foo\n"), []byte("bar\n")))
+	s.True(merge.IsBinary([]byte("foo\n"), []byte("b\x00ar\n")))
+}
@@ -24,6 +24,7 @@ var ignore = map[string]bool{
 type node struct {
 	fs         billy.Filesystem
 	submodules map[string]plumbing.Hash
+	clean      func(path string, content []byte) ([]byte, error)
 
 	path     string
 	hash     []byte
@@ -45,6 +46,25 @@ func NewRootNode(
 	return &node{fs: fs, submodules: submodules, isDir: true}
 }
 
+// Options contains the options used to build the nodes of a filesystem.
+type Options struct {
+	// Clean, if not nil, converts the content of the regular files into the
+	// content that would be stored in the repository before hashing it, as
+	// git does when comparing the worktree with the index, for example to
+	// normalize the line endings. The path is relative to the root.
+	Clean func(path string, content []byte) ([]byte, error)
+}
+
+// NewRootNodeWithOptions returns the root node based on a given
+// billy.Filesystem, as NewRootNode, using the given options.
+func NewRootNodeWithOptions(
+	fs billy.Filesystem,
+	submodules map[string]plumbing.Hash,
+	opts Options,
+) noder.Noder {
+	return &node{fs: fs, submodules: submodules, clean: opts.Clean, isDir: true}
+}
+
 // Hash the hash of a filesystem is the result of concatenating the computed
 // plumbing.Hash of the file as a Blob and its plumbing.FileMode; that way the
 // difftree algorithm will detect changes in the contents of files and also in
@@ -133,6 +153,7 @@ func (n *node) newChildNode(file os.FileInfo) (*node, error) {
 	node := &node{
 		fs:         n.fs,
 		submodules: n.submodules,
+		clean:      n.clean,
 
 		path:  path,
 		isDir: file.IsDir(),
@@ -178,6 +199,10 @@ func (n *node) doCalculateHashForRegular() plumbing.Hash {
 
 	defer f.Close()
 
+	if n.clean != nil {
+		return n.doCalculateHashForCleaned(f)
+	}
+
 	h := plumbing.NewHasher(plumbing.BlobObject, n.size)
 	if _, err := io.Copy(h, f); err != nil {
 		return plumbing.ZeroHash
@@ -186,6 +211,25 @@ func (n *node) doCalculateHashForRegular() plumbing.Hash {
 	return h.Sum()
 }
 
+func (n *node) doCalculateHashForCleaned(f io.Reader) plumbing.Hash {
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return plumbing.ZeroHash
+	}
+
+	content, err = n.clean(n.path, content)
+	if err != nil {
+		return plumbing.ZeroHash
+	}
+
+	h := plumbing.NewHasher(plumbing.BlobObject, int64(len(content)))
+	if _, err := h.Write(content); err != nil {
+		return plumbing.ZeroHash
+	}
+
+	return h.Sum()
+}
+
 func (n *node) doCalculateHashForSymlink() plumbing.Hash {
 	target, err := n.fs.Readlink(n.path)
 	if err != nil {
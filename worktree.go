@@ -130,7 +130,7 @@ func (w *Worktree) PullContext(ctx context.Context, o *PullOptions) error {
 		return err
 	}
 
-	if err := w.updateHEAD(ref.Hash()); err != nil {
+	if err := w.updateHEAD(ref.Hash(), nil, "pull: Fast-forward"); err != nil {
 		return err
 	}
 
@@ -215,6 +215,7 @@ func (w *Worktree) createBranch(opts *CheckoutOptions) error {
 		return err
 	}
 
+	from := opts.Hash.String()
 	if opts.Hash.IsZero() {
 		ref, err := w.r.Head()
 		if err != nil {
@@ -222,10 +223,12 @@ func (w *Worktree) createBranch(opts *CheckoutOptions) error {
 		}
 
 		opts.Hash = ref.Hash()
+		from = plumbing.HEAD.String()
 	}
 
-	return w.r.Storer.SetReference(
+	return setReference(w.r.Storer,
 		plumbing.NewHashReference(opts.Branch, opts.Hash),
+		nil, "branch: Created from "+from,
 	)
 }
 
@@ -261,7 +264,7 @@ func (w *Worktree) getCommitFromCheckoutOptions(opts *CheckoutOptions) (plumbing
 
 func (w *Worktree) setHEADToCommit(commit plumbing.Hash) error {
 	head := plumbing.NewHashReference(plumbing.HEAD, commit)
-	return w.r.Storer.SetReference(head)
+	return w.checkoutHEAD(head, commit.String())
 }
 
 func (w *Worktree) setHEADToBranch(branch plumbing.ReferenceName, commit plumbing.Hash) error {
@@ -277,7 +280,28 @@ func (w *Worktree) setHEADToBranch(branch plumbing.ReferenceName, commit plumbin
 		head = plumbing.NewHashReference(plumbing.HEAD, commit)
 	}
 
-	return w.r.Storer.SetReference(head)
+	return w.checkoutHEAD(head, branch.Short())
+}
+
+// checkoutHEAD stores the given HEAD reference, recording in the reflog the
+// move from the current HEAD to target.
+func (w *Worktree) checkoutHEAD(head *plumbing.Reference, target string) error {
+	old, err := w.r.Storer.Reference(plumbing.HEAD)
+	if err != nil && err != plumbing.ErrReferenceNotFound {
+		return err
+	}
+
+	var from string
+	switch {
+	case old == nil:
+	case old.Type() == plumbing.SymbolicReference:
+		from = old.Target().Short()
+	default:
+		from = old.Hash().String()
+	}
+
+	msg := fmt.Sprintf("checkout: moving from %s to %s", from, target)
+	return setReference(w.r.Storer, head, nil, msg)
 }
 
 func (w *Worktree) ResetSparsely(opts *ResetOptions, dirs []string) error {
@@ -304,6 +328,12 @@ func (w *Worktree) ResetSparsely(opts *ResetOptions, dirs []string) error {
 		return nil
 	}
 
+	if len(opts.Files) == 0 {
+		if err := w.r.removeMergeHeads(); err != nil {
+			return err
+		}
+	}
+
 	t, err := w.r.getTreeFromCommitHash(opts.Commit)
 	if err != nil {
 		return err
@@ -375,6 +405,13 @@ func (w *Worktree) resetIndex(t *object.Tree, dirs []string, files []string) err
 		return err
 	}
 
+	// Unmerged entries are dropped, so their paths are restored from t.
+	if removeUnmergedEntries(idx, files) {
+		if err := w.r.Storer.SetIndex(idx); err != nil {
+			return err
+		}
+	}
+
 	b := newIndexBuilder(idx)
 
 	changes, err := w.diffTreeWithStaging(t, true)
@@ -442,6 +479,24 @@ func inFiles(files []string, v string) bool {
 	return false
 }
 
+// removeUnmergedEntries removes the entries of the index on any merge stage,
+// limited to the given files if any. It returns true if any entry was
+// removed.
+func removeUnmergedEntries(idx *index.Index, files []string) bool {
+	entries := idx.Entries[:0]
+	for _, e := range idx.Entries {
+		if e.Stage != index.Merged && (len(files) == 0 || inFiles(files, e.Name)) {
+			continue
+		}
+
+		entries = append(entries, e)
+	}
+
+	removed := len(entries) != len(idx.Entries)
+	idx.Entries = entries
+	return removed
+}
+
 func (w *Worktree) resetWorktree(t *object.Tree, files []string) error {
 	changes, err := w.diffStagingWithWorktree(true, false)
 	if err != nil {
@@ -454,6 +509,13 @@ func (w *Worktree) resetWorktree(t *object.Tree, files []string) error {
 	}
 	b := newIndexBuilder(idx)
 
+	conv, err := w.newTreeConverter(t)
+	if err != nil {
+		return err
+	}
+	defer conv.close()
+
+	var selected []merkletrie.Change
 	for _, ch := range changes {
 		if err := w.validChange(ch); err != nil {
 			return err
@@ -477,7 +539,15 @@ func (w *Worktree) resetWorktree(t *object.Tree, files []string) error {
 			}
 		}
 
-		if err := w.checkoutChange(ch, t, b); err != nil {
+		selected = append(selected, ch)
+	}
+
+	if err := w.prefetchChanges(selected, t); err != nil {
+		return err
+	}
+
+	for _, ch := range selected {
+		if err := w.checkoutChange(ch, t, b, conv); err != nil {
 			return err
 		}
 	}
@@ -588,7 +658,7 @@ func (w *Worktree) validChange(ch merkletrie.Change) error {
 	return nil
 }
 
-func (w *Worktree) checkoutChange(ch merkletrie.Change, t *object.Tree, idx *indexBuilder) error {
+func (w *Worktree) checkoutChange(ch merkletrie.Change, t *object.Tree, idx *indexBuilder, conv *contentConverter) error {
 	a, err := ch.Action()
 	if err != nil {
 		return err
@@ -615,7 +685,7 @@ func (w *Worktree) checkoutChange(ch merkletrie.Change, t *object.Tree, idx *ind
 		return w.checkoutChangeSubmodule(name, a, e, idx)
 	}
 
-	return w.checkoutChangeRegularFile(name, a, t, e, idx)
+	return w.checkoutChangeRegularFile(name, a, t, e, idx, conv)
 }
 
 func (w *Worktree) containsUnstagedChanges() (bool, error) {
@@ -646,9 +716,14 @@ func (w *Worktree) setHEADCommit(commit plumbing.Hash) error {
 		return err
 	}
 
+	msg := fmt.Sprintf("reset: moving to %s", commit)
 	if head.Type() == plumbing.HashReference {
+		if head.Hash() == commit {
+			return nil
+		}
+
 		head = plumbing.NewHashReference(plumbing.HEAD, commit)
-		return w.r.Storer.SetReference(head)
+		return setReference(w.r.Storer, head, nil, msg)
 	}
 
 	branch, err := w.r.Reference(head.Target(), false)
@@ -660,8 +735,12 @@ func (w *Worktree) setHEADCommit(commit plumbing.Hash) error {
 		return fmt.Errorf("invalid HEAD target should be a branch, found %s", branch.Type())
 	}
 
+	if branch.Hash() == commit {
+		return nil
+	}
+
 	branch = plumbing.NewHashReference(branch.Name(), commit)
-	return w.r.Storer.SetReference(branch)
+	return setReference(w.r.Storer, branch, nil, msg)
 }
 
 func (w *Worktree) checkoutChangeSubmodule(name string,
@@ -702,6 +781,7 @@ func (w *Worktree) checkoutChangeRegularFile(name string,
 	t *object.Tree,
 	e *object.TreeEntry,
 	idx *indexBuilder,
+	conv *contentConverter,
 ) error {
 	switch a {
 	case merkletrie.Modify:
@@ -720,7 +800,7 @@ func (w *Worktree) checkoutChangeRegularFile(name string,
 			return err
 		}
 
-		if err := w.checkoutFile(f); err != nil {
+		if err := w.checkoutFile(f, conv); err != nil {
 			return err
 		}
 
@@ -730,7 +810,9 @@ func (w *Worktree) checkoutChangeRegularFile(name string,
 	return nil
 }
 
-func (w *Worktree) checkoutFile(f *object.File) (err error) {
+// checkoutFile writes the file f to the worktree, converting its content with
+// conv, if not nil.
+func (w *Worktree) checkoutFile(f *object.File, conv *contentConverter) (err error) {
 	mode, err := f.Mode.ToOSFileMode()
 	if err != nil {
 		return
@@ -753,6 +835,10 @@ func (w *Worktree) checkoutFile(f *object.File) (err error) {
 	}
 
 	defer ioutil.CheckClose(to, &err)
+	if conv != nil {
+		return conv.copyToWorktree(to, from, f.Name)
+	}
+
 	buf := sync.GetByteSlice()
 	_, err = io.CopyBuffer(to, from, *buf)
 	sync.PutByteSlice(buf)
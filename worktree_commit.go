@@ -13,7 +13,7 @@ import (
 	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/go-git/go-git/v5/plumbing/format/index"
 	"github.com/go-git/go-git/v5/plumbing/object"
-	"github.com/go-git/go-git/v5/storage"
+	"github.com/go-git/go-git/v5/plumbing/storer"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/ProtonMail/go-crypto/openpgp/packet"
@@ -25,6 +25,10 @@ var (
 	// working tree, with no changes to be committed.
 	ErrEmptyCommit = errors.New("cannot create empty commit: clean working tree")
 
+	// ErrUnmergedPaths occurs when a commit is attempted while the index
+	// contains unresolved merge conflicts.
+	ErrUnmergedPaths = errors.New("cannot commit: index contains unmerged paths")
+
 	// characters to be removed from user name and/or email before using them to build a commit object
 	// See https://git-scm.com/docs/git-commit#_commit_information
 	invalidCharactersRe = regexp.MustCompile(`[<>\n]`)
@@ -61,6 +65,12 @@ func (w *Worktree) Commit(msg string, opts *CommitOptions) (plumbing.Hash, error
 		return plumbing.ZeroHash, err
 	}
 
+	for _, e := range idx.Entries {
+		if e.Stage != index.Merged {
+			return plumbing.ZeroHash, ErrUnmergedPaths
+		}
+	}
+
 	// First handle the case of the first commit in the repository being empty.
 	if len(opts.Parents) == 0 && len(idx.Entries) == 0 && !opts.AllowEmptyCommits {
 		return plumbing.ZeroHash, ErrEmptyCommit
@@ -94,7 +104,11 @@ func (w *Worktree) Commit(msg string, opts *CommitOptions) (plumbing.Hash, error
 		return plumbing.ZeroHash, err
 	}
 
-	return commit, w.updateHEAD(commit)
+	if err := w.updateHEAD(commit, opts.Committer, commitReflogMessage(msg, opts)); err != nil {
+		return commit, err
+	}
+
+	return commit, w.r.removeMergeHeads()
 }
 
 func (w *Worktree) autoAddModifiedAndDeleted() error {
@@ -108,12 +122,18 @@ func (w *Worktree) autoAddModifiedAndDeleted() error {
 		return err
 	}
 
+	conv, err := w.newWorktreeConverter(idx)
+	if err != nil {
+		return err
+	}
+	defer conv.close()
+
 	for path, fs := range s {
 		if fs.Worktree != Modified && fs.Worktree != Deleted {
 			continue
 		}
 
-		if _, _, err := w.doAddFile(idx, s, path, nil); err != nil {
+		if _, _, err := w.doAddFile(idx, conv, s, path, nil); err != nil {
 			return err
 		}
 
@@ -122,7 +142,9 @@ func (w *Worktree) autoAddModifiedAndDeleted() error {
 	return w.r.Storer.SetIndex(idx)
 }
 
-func (w *Worktree) updateHEAD(commit plumbing.Hash) error {
+// updateHEAD moves HEAD, or the branch it points to, to the given commit,
+// recording the update in the reflog with the given message.
+func (w *Worktree) updateHEAD(commit plumbing.Hash, committer *object.Signature, msg string) error {
 	head, err := w.r.Storer.Reference(plumbing.HEAD)
 	if err != nil {
 		return err
@@ -134,7 +156,24 @@ func (w *Worktree) updateHEAD(commit plumbing.Hash) error {
 	}
 
 	ref := plumbing.NewHashReference(name, commit)
-	return w.r.Storer.SetReference(ref)
+	return setReference(w.r.Storer, ref, committer, msg)
+}
+
+// commitReflogMessage returns the reflog message of a commit with the given
+// message, in the same format used by git.
+func commitReflogMessage(msg string, opts *CommitOptions) string {
+	subject, _, _ := strings.Cut(strings.TrimSpace(msg), "\n")
+
+	switch {
+	case opts.Amend:
+		return "commit (amend): " + subject
+	case len(opts.Parents) == 0:
+		return "commit (initial): " + subject
+	case len(opts.Parents) > 1:
+		return "commit (merge): " + subject
+	}
+
+	return "commit: " + subject
 }
 
 func (w *Worktree) buildCommitObject(msg string, opts *CommitOptions, tree plumbing.Hash) (plumbing.Hash, error) {
@@ -192,7 +231,7 @@ func (s *gpgSigner) Sign(message io.Reader) ([]byte, error) {
 // index structure. The created objects are pushed to a given Storer.
 type buildTreeHelper struct {
 	fs billy.Filesystem
-	s  storage.Storer
+	s  storer.EncodedObjectStorer
 
 	trees   map[string]*object.Tree
 	entries map[string]*object.TreeEntry
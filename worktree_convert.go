@@ -0,0 +1,633 @@
+package git
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/filter"
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/ioutil"
+)
+
+const (
+	gitattributesFile = ".gitattributes"
+
+	textAttribute   = "text"
+	crlfAttribute   = "crlf"
+	eolAttribute    = "eol"
+	filterAttribute = "filter"
+
+	autoCRLFInput = "input"
+	eolLF         = "lf"
+	eolCRLF       = "crlf"
+)
+
+// builtinAttributes are the attributes git defines for every repository.
+const builtinAttributes = "[attr]binary -diff -merge -text"
+
+// crlfAction is the conversion of the line endings applied to a file, as
+// resolved by git from the text and eol attributes and the core.autocrlf and
+// core.eol options.
+type crlfAction int
+
+const (
+	// crlfBinary files are never converted.
+	crlfBinary crlfAction = iota
+	// crlfTextInput files are converted to LF on add.
+	crlfTextInput
+	// crlfTextCRLF files are converted to LF on add and to CRLF on checkout.
+	crlfTextCRLF
+	// crlfAutoInput files are converted as crlfTextInput, unless they are
+	// detected as binary or their blob in the index contains CRs.
+	crlfAutoInput
+	// crlfAutoCRLF files are converted as crlfTextCRLF, unless they are
+	// detected as binary or their blob in the index contains CRs.
+	crlfAutoCRLF
+)
+
+func (a crlfAction) isAuto() bool {
+	return a == crlfAutoInput || a == crlfAutoCRLF
+}
+
+func (a crlfAction) isCRLF() bool {
+	return a == crlfTextCRLF || a == crlfAutoCRLF
+}
+
+// contentConverter converts the content of the files between the repository
+// and the worktree, following the gitattributes and the config options, the
+// same way git does on checkout, add and status. It must be closed, to stop
+// the filter processes started by it.
+type contentConverter struct {
+	r   *Repository
+	idx *index.Index
+	// dir is the directory the filter commands are run in.
+	dir string
+	// configs are the local, global and system configs, in this order.
+	configs []*config.Config
+
+	// attributes matches the attributes of the files in the worktree, unless
+	// tree is set, which reads the ones of the tree being checked out.
+	attributes gitattributes.Matcher
+	tree       *treeAttributes
+	autoCRLF   string
+	eolCRLF    bool
+	processes  map[string]*filter.Process
+	lfs        *lfsFilter
+}
+
+// newWorktreeConverter returns the contentConverter used on add and status,
+// based on the .gitattributes files of the worktree. The index, if given,
+// is used to keep the CRs of the files already committed with them. It
+// returns nil if no conversion is needed.
+func (w *Worktree) newWorktreeConverter(idx *index.Index) (*contentConverter, error) {
+	c, err := w.newContentConverter(idx)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs, err := gitattributes.ReadPatterns(w.Filesystem, nil)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if c.autoCRLF == "" && len(attrs) == 0 {
+		return nil, nil
+	}
+
+	builtin, err := readBuiltinAttributes()
+	if err != nil {
+		return nil, err
+	}
+
+	c.attributes = gitattributes.NewMatcher(append(builtin, attrs...))
+	return c, nil
+}
+
+// newTreeConverter returns the contentConverter used on checkout of the tree
+// t, based on the .gitattributes files of the tree, since they might not be
+// in the worktree yet. Only the .gitattributes files in the directories of
+// the files checked out are read, so a checkout of a tree without them, and
+// without core.autocrlf, copies the files as they are.
+func (w *Worktree) newTreeConverter(t *object.Tree) (*contentConverter, error) {
+	c, err := w.newContentConverter(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	builtin, err := readBuiltinAttributes()
+	if err != nil {
+		return nil, err
+	}
+
+	c.tree = &treeAttributes{
+		r:       w.r,
+		tree:    t,
+		builtin: builtin,
+		stack:   make(map[string][]gitattributes.MatchAttribute),
+		dirs:    make(map[string]gitattributes.Matcher),
+	}
+
+	return c, nil
+}
+
+func (w *Worktree) newContentConverter(idx *index.Index) (*contentConverter, error) {
+	local, err := w.r.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	configs, err := loadSystemConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &contentConverter{r: w.r, idx: idx, configs: append([]*config.Config{local}, configs...)}
+
+	var autoCRLF, eol string
+	for _, cfg := range c.configs {
+		autoCRLF = cmp.Or(autoCRLF, cfg.Core.AutoCRLF)
+		eol = cmp.Or(eol, cfg.Core.EOL)
+	}
+
+	switch v := strings.ToLower(autoCRLF); v {
+	case autoCRLFInput:
+		c.autoCRLF = v
+	default:
+		if ok, _ := strconv.ParseBool(v); ok {
+			c.autoCRLF = "true"
+		}
+	}
+
+	switch {
+	case c.autoCRLF == "true":
+		c.eolCRLF = true
+	case c.autoCRLF == autoCRLFInput:
+		c.eolCRLF = false
+	case strings.EqualFold(eol, eolCRLF):
+		c.eolCRLF = true
+	case strings.EqualFold(eol, eolLF):
+		c.eolCRLF = false
+	default:
+		c.eolCRLF = runtime.GOOS == "windows"
+	}
+
+	if dir := w.Filesystem.Root(); dir != "" {
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			c.dir = dir
+		}
+	}
+
+	return c, nil
+}
+
+// systemConfigs caches the global and system configs, so they are only read
+// again from disk when their files change.
+var systemConfigs struct {
+	sync.Mutex
+	stamp   string
+	configs []*config.Config
+}
+
+// loadSystemConfigs returns the global and system configs, in this order.
+func loadSystemConfigs() ([]*config.Config, error) {
+	scopes := []config.Scope{config.GlobalScope, config.SystemScope}
+
+	var stamp strings.Builder
+	for _, scope := range scopes {
+		files, err := config.Paths(scope)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			fmt.Fprintf(&stamp, "%s:", file)
+			if fi, err := os.Stat(file); err == nil {
+				fmt.Fprintf(&stamp, "%d:%d", fi.Size(), fi.ModTime().UnixNano())
+			}
+
+			stamp.WriteByte('\n')
+		}
+	}
+
+	systemConfigs.Lock()
+	defer systemConfigs.Unlock()
+
+	if systemConfigs.configs != nil && systemConfigs.stamp == stamp.String() {
+		return systemConfigs.configs, nil
+	}
+
+	var configs []*config.Config
+	for _, scope := range scopes {
+		cfg, err := config.LoadConfig(scope)
+		if err != nil {
+			return nil, err
+		}
+
+		configs = append(configs, cfg)
+	}
+
+	systemConfigs.stamp, systemConfigs.configs = stamp.String(), configs
+	return configs, nil
+}
+
+func readBuiltinAttributes() ([]gitattributes.MatchAttribute, error) {
+	return gitattributes.ReadAttributes(strings.NewReader(builtinAttributes), nil, true)
+}
+
+// match returns the attributes of the file at path used by the conversion.
+func (c *contentConverter) match(p string) (map[string]gitattributes.Attribute, error) {
+	m := c.attributes
+	if c.tree != nil {
+		var err error
+		if m, err = c.tree.matcher(path.Dir(p)); err != nil {
+			return nil, err
+		}
+	}
+
+	attrs, _ := m.Match(strings.Split(p, "/"), []string{
+		textAttribute, crlfAttribute, eolAttribute, filterAttribute,
+	})
+
+	return attrs, nil
+}
+
+// crlfAction resolves the conversion of the line endings of a file with the
+// given attributes.
+func (c *contentConverter) crlfAction(attrs map[string]gitattributes.Attribute) crlfAction {
+	text, ok := attrs[textAttribute]
+	if !ok {
+		// crlf is the deprecated name of the text attribute.
+		text = attrs[crlfAttribute]
+	}
+
+	var action crlfAction
+	var defined bool
+	switch {
+	case text == nil || text.IsUnspecified():
+	case text.IsSet():
+		action, defined = crlfTextInput, true
+		if c.eolCRLF {
+			action = crlfTextCRLF
+		}
+	case text.IsUnset():
+		return crlfBinary
+	case text.Value() == "auto":
+		action, defined = crlfAutoInput, true
+		if c.eolCRLF {
+			action = crlfAutoCRLF
+		}
+	case text.Value() == autoCRLFInput:
+		action, defined = crlfTextInput, true
+	}
+
+	// The eol attribute sets the line endings used on checkout, and implies
+	// the text attribute.
+	if eol, ok := attrs[eolAttribute]; ok && eol.IsValueSet() {
+		switch eol.Value() {
+		case eolLF:
+			if action.isAuto() {
+				return crlfAutoInput
+			}
+
+			return crlfTextInput
+		case eolCRLF:
+			if action.isAuto() {
+				return crlfAutoCRLF
+			}
+
+			return crlfTextCRLF
+		}
+	}
+
+	if defined {
+		return action
+	}
+
+	switch c.autoCRLF {
+	case "true":
+		return crlfAutoCRLF
+	case autoCRLFInput:
+		return crlfAutoInput
+	}
+
+	return crlfBinary
+}
+
+// toRepository converts the content of the file at path in the worktree into
+// the content stored in the repository: the clean filter is applied first,
+// and then the line endings are converted.
+func (c *contentConverter) toRepository(p string, content []byte) ([]byte, error) {
+	attrs, err := c.match(p)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err = c.clean(p, attrs, content)
+	if err != nil {
+		return nil, err
+	}
+
+	action := c.crlfAction(attrs)
+	if action == crlfBinary || len(content) == 0 {
+		return content, nil
+	}
+
+	stats := gatherTextStats(content)
+	if stats.crlf == 0 {
+		return content, nil
+	}
+
+	if action.isAuto() {
+		if stats.isBinary() {
+			return content, nil
+		}
+
+		crlf, err := c.hasCRInIndex(p)
+		if err != nil || crlf {
+			return content, err
+		}
+	}
+
+	return bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n")), nil
+}
+
+// toWorktree converts the content of the blob of the file at path into the
+// content written to the worktree: the line endings are converted first, and
+// then the smudge filter is applied.
+func (c *contentConverter) toWorktree(p string, content []byte) ([]byte, error) {
+	attrs, err := c.match(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.smudge(p, attrs, crlfToWorktree(c.crlfAction(attrs), content))
+}
+
+func crlfToWorktree(action crlfAction, content []byte) []byte {
+	if !action.isCRLF() {
+		return content
+	}
+
+	stats := gatherTextStats(content)
+	if stats.lonelf == 0 {
+		return content
+	}
+
+	if action.isAuto() && (stats.lonecr > 0 || stats.crlf > 0 || stats.isBinary()) {
+		return content
+	}
+
+	var b bytes.Buffer
+	b.Grow(len(content) + stats.lonelf)
+	for i, ch := range content {
+		if ch == '\n' && (i == 0 || content[i-1] != '\r') {
+			b.WriteByte('\r')
+		}
+
+		b.WriteByte(ch)
+	}
+
+	return b.Bytes()
+}
+
+// copyToWorktree copies the blob read from src into dst, converted for the
+// file at path. The content is only read into memory if the line endings
+// are converted, or if it's needed in case the filter fails.
+func (c *contentConverter) copyToWorktree(dst io.Writer, src io.Reader, p string) error {
+	attrs, err := c.match(p)
+	if err != nil {
+		return err
+	}
+
+	if !c.crlfAction(attrs).isCRLF() {
+		if ok, err := c.streamFilter(p, attrs, dst, src, filter.Filter.Smudge); ok {
+			return err
+		}
+	}
+
+	content, err := io.ReadAll(src)
+	if err != nil {
+		return err
+	}
+
+	if content, err = c.toWorktree(p, content); err != nil {
+		return err
+	}
+
+	_, err = dst.Write(content)
+	return err
+}
+
+// copyToRepository copies the file at path read from src into dst, converted
+// for the repository. The content is only read into memory if the line
+// endings may be converted, or if it's needed in case the filter fails.
+func (c *contentConverter) copyToRepository(dst io.Writer, src io.Reader, p string) error {
+	attrs, err := c.match(p)
+	if err != nil {
+		return err
+	}
+
+	if c.crlfAction(attrs) == crlfBinary {
+		if ok, err := c.streamFilter(p, attrs, dst, src, filter.Filter.Clean); ok {
+			return err
+		}
+	}
+
+	content, err := io.ReadAll(src)
+	if err != nil {
+		return err
+	}
+
+	if content, err = c.toRepository(p, content); err != nil {
+		return err
+	}
+
+	_, err = dst.Write(content)
+	return err
+}
+
+// hasCRInIndex returns true if the blob of the file at path in the index
+// contains CRs, in which case git doesn't normalize the line endings of the
+// files with automatic conversion, so they don't show up as modified.
+func (c *contentConverter) hasCRInIndex(p string) (crlf bool, err error) {
+	if c.idx == nil {
+		return false, nil
+	}
+
+	e, err := c.idx.Entry(p)
+	if err != nil {
+		return false, nil
+	}
+
+	blob, err := c.r.BlobObject(e.Hash)
+	if err != nil {
+		return false, nil
+	}
+
+	r, err := blob.Reader()
+	if err != nil {
+		return false, err
+	}
+
+	defer ioutil.CheckClose(r, &err)
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.IndexByte(content, '\r') != -1, nil
+}
+
+// textStats are the statistics used by git to decide how to convert the line
+// endings of a file.
+type textStats struct {
+	nul, lonecr, lonelf, crlf int
+	printable, nonprintable   int
+}
+
+func gatherTextStats(content []byte) textStats {
+	var s textStats
+	for i := 0; i < len(content); i++ {
+		ch := content[i]
+		switch {
+		case ch == '\r':
+			if i+1 < len(content) && content[i+1] == '\n' {
+				s.crlf++
+				i++
+			} else {
+				s.lonecr++
+			}
+		case ch == '\n':
+			s.lonelf++
+		case ch == 127:
+			s.nonprintable++
+		case ch < 32:
+			switch ch {
+			// BS, HT, ESC and FF
+			case '\b', '\t', '\033', '\014':
+				s.printable++
+			case 0:
+				s.nul++
+				s.nonprintable++
+			default:
+				s.nonprintable++
+			}
+		default:
+			s.printable++
+		}
+	}
+
+	// If the file ends with EOF (Ctrl-Z), don't count it as non-printable.
+	if len(content) > 0 && content[len(content)-1] == '\032' {
+		s.nonprintable--
+	}
+
+	return s
+}
+
+// isBinary returns true if the content is considered binary by git.
+func (s textStats) isBinary() bool {
+	return s.lonecr > 0 || s.nul > 0 || (s.printable>>7) < s.nonprintable
+}
+
+// treeAttributes reads the .gitattributes files of a tree as they are needed,
+// only the ones in the directories of the files being converted, as git does
+// on checkout, instead of walking the whole tree.
+type treeAttributes struct {
+	r       *Repository
+	tree    *object.Tree
+	builtin []gitattributes.MatchAttribute
+	// stack are the attributes of the .gitattributes files from the root of
+	// the tree to each directory, in ascending order of priority.
+	stack map[string][]gitattributes.MatchAttribute
+	dirs  map[string]gitattributes.Matcher
+}
+
+// matcher returns the Matcher of the files in the directory dir.
+func (a *treeAttributes) matcher(dir string) (gitattributes.Matcher, error) {
+	if dir == "." {
+		dir = ""
+	}
+
+	if m, ok := a.dirs[dir]; ok {
+		return m, nil
+	}
+
+	stack, err := a.read(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	m := gitattributes.NewMatcher(stack)
+	a.dirs[dir] = m
+	return m, nil
+}
+
+// read returns the attributes of the .gitattributes files from the root of
+// the tree to the directory dir, with the builtin ones first.
+func (a *treeAttributes) read(dir string) ([]gitattributes.MatchAttribute, error) {
+	if stack, ok := a.stack[dir]; ok {
+		return stack, nil
+	}
+
+	stack, domain := a.builtin, []string(nil)
+	if dir != "" {
+		parent := path.Dir(dir)
+		if parent == "." {
+			parent = ""
+		}
+
+		var err error
+		if stack, err = a.read(parent); err != nil {
+			return nil, err
+		}
+
+		domain = strings.Split(dir, "/")
+	}
+
+	e, err := a.tree.FindEntry(path.Join(dir, gitattributesFile))
+	switch {
+	case err == object.ErrEntryNotFound || err == object.ErrDirectoryNotFound:
+	case err != nil:
+		return nil, err
+	case e.Mode.IsFile():
+		blob, err := a.r.BlobObject(e.Hash)
+		if err != nil {
+			return nil, err
+		}
+
+		attrs, err := readBlobAttributes(blob, domain)
+		if err != nil {
+			return nil, err
+		}
+
+		stack = append(slices.Clip(stack), attrs...)
+	}
+
+	a.stack[dir] = stack
+	return stack, nil
+}
+
+func readBlobAttributes(b *object.Blob, domain []string) (attrs []gitattributes.MatchAttribute, err error) {
+	r, err := b.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(r, &err)
+
+	return gitattributes.ReadAttributes(r, domain, len(domain) == 0)
+}
@@ -0,0 +1,239 @@
+package git
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// setupConvert returns a repository in memory with the given core.autocrlf
+// and core.eol options.
+func (s *WorktreeSuite) setupConvert(autoCRLF, eol string) (*Repository, *Worktree) {
+	r, err := Init(memory.NewStorage(), memfs.New())
+	s.Require().NoError(err)
+
+	cfg, err := r.Config()
+	s.Require().NoError(err)
+	cfg.Core.AutoCRLF = autoCRLF
+	cfg.Core.EOL = eol
+	s.Require().NoError(r.SetConfig(cfg))
+
+	w, err := r.Worktree()
+	s.Require().NoError(err)
+
+	return r, w
+}
+
+func (s *WorktreeSuite) blobContent(r *Repository, h plumbing.Hash) string {
+	b, err := r.BlobObject(h)
+	s.Require().NoError(err)
+
+	rd, err := b.Reader()
+	s.Require().NoError(err)
+	defer rd.Close()
+
+	content, err := io.ReadAll(rd)
+	s.Require().NoError(err)
+
+	return string(content)
+}
+
+func (s *WorktreeSuite) TestAutoCRLF() {
+	r, w := s.setupConvert("true", "")
+
+	s.NoError(util.WriteFile(w.Filesystem, "foo", []byte("foo\r\nbar\r\n"), 0o644))
+	s.NoError(util.WriteFile(w.Filesystem, "bin", []byte("foo\r\n\x00"), 0o644))
+
+	h, err := w.Add("foo")
+	s.NoError(err)
+	s.Equal("foo\nbar\n", s.blobContent(r, h))
+
+	h, err = w.Add("bin")
+	s.NoError(err)
+	s.Equal("foo\r\n\x00", s.blobContent(r, h))
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.Equal(Unmodified, status.File("foo").Worktree)
+	s.Equal(Unmodified, status.File("bin").Worktree)
+
+	_, err = w.Commit("foo\n", defaultTestCommitOptions())
+	s.NoError(err)
+
+	s.NoError(w.Filesystem.Remove("foo"))
+	s.NoError(w.Reset(&ResetOptions{Mode: HardReset}))
+
+	content, err := util.ReadFile(w.Filesystem, "foo")
+	s.NoError(err)
+	s.Equal("foo\r\nbar\r\n", string(content))
+
+	status, err = w.Status()
+	s.NoError(err)
+	s.True(status.IsClean())
+
+	s.NoError(util.WriteFile(w.Filesystem, "foo", []byte("foo\r\nqux\r\n"), 0o644))
+	status, err = w.Status()
+	s.NoError(err)
+	s.Equal(Modified, status.File("foo").Worktree)
+}
+
+func (s *WorktreeSuite) TestAutoCRLFInput() {
+	r, w := s.setupConvert("input", "crlf")
+
+	s.NoError(util.WriteFile(w.Filesystem, "foo", []byte("foo\r\nbar\r\n"), 0o644))
+	h, err := w.Add("foo")
+	s.NoError(err)
+	s.Equal("foo\nbar\n", s.blobContent(r, h))
+
+	_, err = w.Commit("foo\n", defaultTestCommitOptions())
+	s.NoError(err)
+
+	s.NoError(w.Filesystem.Remove("foo"))
+	s.NoError(w.Reset(&ResetOptions{Mode: HardReset}))
+
+	content, err := util.ReadFile(w.Filesystem, "foo")
+	s.NoError(err)
+	s.Equal("foo\nbar\n", string(content))
+}
+
+func (s *WorktreeSuite) TestTextAttributes() {
+	r, w := s.setupConvert("", "lf")
+
+	s.NoError(util.WriteFile(w.Filesystem, ".gitattributes", []byte(
+		"*.txt text\n*.bat eol=crlf\n*.png binary\nsub/* -text\n",
+	), 0o644))
+	s.NoError(util.WriteFile(w.Filesystem, "foo.txt", []byte("foo\r\n"), 0o644))
+	s.NoError(util.WriteFile(w.Filesystem, "foo.bat", []byte("foo\r\n"), 0o644))
+	s.NoError(util.WriteFile(w.Filesystem, "foo.png", []byte("foo\r\n"), 0o644))
+	s.NoError(util.WriteFile(w.Filesystem, "sub/foo.txt", []byte("foo\r\n"), 0o644))
+
+	s.NoError(w.AddWithOptions(&AddOptions{All: true}))
+	h, err := w.Commit("foo\n", defaultTestCommitOptions())
+	s.NoError(err)
+
+	c, err := r.CommitObject(h)
+	s.NoError(err)
+
+	for name, expected := range map[string]string{
+		"foo.txt":     "foo\n",
+		"foo.bat":     "foo\n",
+		"foo.png":     "foo\r\n",
+		"sub/foo.txt": "foo\r\n",
+	} {
+		f, err := c.File(name)
+		s.NoError(err)
+
+		content, err := f.Contents()
+		s.NoError(err)
+		s.Equal(expected, content, name)
+	}
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.True(status.IsClean())
+
+	// The attributes of the tree being checked out are used, since the
+	// .gitattributes file might not be in the worktree yet.
+	w.Filesystem = memfs.New()
+	s.NoError(w.Reset(&ResetOptions{Mode: HardReset}))
+
+	for name, expected := range map[string]string{
+		"foo.txt":     "foo\n",
+		"foo.bat":     "foo\r\n",
+		"foo.png":     "foo\r\n",
+		"sub/foo.txt": "foo\r\n",
+	} {
+		content, err := util.ReadFile(w.Filesystem, name)
+		s.NoError(err)
+		s.Equal(expected, string(content), name)
+	}
+}
+
+func (s *WorktreeSuite) TestTextAutoCRInIndex() {
+	r, w := s.setupConvert("", "")
+
+	s.NoError(util.WriteFile(w.Filesystem, "foo", []byte("foo\r\n"), 0o644))
+	_, err := w.Add("foo")
+	s.NoError(err)
+
+	s.NoError(util.WriteFile(w.Filesystem, ".gitattributes", []byte("* text=auto\n"), 0o644))
+	_, err = w.Add(".gitattributes")
+	s.NoError(err)
+
+	// Files committed with CRs are neither reported as modified nor
+	// normalized by text=auto, as git does.
+	status, err := w.Status()
+	s.NoError(err)
+	s.Equal(Unmodified, status.File("foo").Worktree)
+
+	s.NoError(util.WriteFile(w.Filesystem, "foo", []byte("foo\r\nbar\r\n"), 0o644))
+	h, err := w.Add("foo")
+	s.NoError(err)
+	s.Equal("foo\r\nbar\r\n", s.blobContent(r, h))
+
+	s.NoError(util.WriteFile(w.Filesystem, "bar", []byte("bar\r\n"), 0o644))
+	h, err = w.Add("bar")
+	s.NoError(err)
+	s.Equal("bar\n", s.blobContent(r, h))
+}
+
+func (s *WorktreeSuite) TestTextAttributesNested() {
+	_, w := s.setupConvert("", "lf")
+
+	s.NoError(util.WriteFile(w.Filesystem, ".gitattributes", []byte(
+		"[attr]dos text eol=crlf\n*.txt text\n",
+	), 0o644))
+	s.NoError(util.WriteFile(w.Filesystem, "a/b/.gitattributes", []byte("*.txt dos\n"), 0o644))
+	s.NoError(util.WriteFile(w.Filesystem, "foo.txt", []byte("foo\r\n"), 0o644))
+	s.NoError(util.WriteFile(w.Filesystem, "a/foo.txt", []byte("foo\r\n"), 0o644))
+	s.NoError(util.WriteFile(w.Filesystem, "a/b/foo.txt", []byte("foo\r\n"), 0o644))
+	s.NoError(util.WriteFile(w.Filesystem, "a/b/c/foo.txt", []byte("foo\r\n"), 0o644))
+
+	s.NoError(w.AddWithOptions(&AddOptions{All: true}))
+	_, err := w.Commit("foo\n", defaultTestCommitOptions())
+	s.NoError(err)
+
+	w.Filesystem = memfs.New()
+	s.NoError(w.Reset(&ResetOptions{Mode: HardReset}))
+
+	for name, expected := range map[string]string{
+		"foo.txt":       "foo\n",
+		"a/foo.txt":     "foo\n",
+		"a/b/foo.txt":   "foo\r\n",
+		"a/b/c/foo.txt": "foo\r\n",
+	} {
+		content, err := util.ReadFile(w.Filesystem, name)
+		s.NoError(err)
+		s.Equal(expected, string(content), name)
+	}
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.True(status.IsClean())
+}
+
+func (s *WorktreeSuite) TestLoadSystemConfigs() {
+	home := s.T().TempDir()
+	s.T().Setenv("HOME", home)
+	s.T().Setenv("XDG_CONFIG_HOME", "")
+
+	configs, err := loadSystemConfigs()
+	s.NoError(err)
+	s.Len(configs, 2)
+	s.Equal("", configs[0].Core.AutoCRLF)
+
+	cached, err := loadSystemConfigs()
+	s.NoError(err)
+	s.Same(configs[0], cached[0])
+
+	s.NoError(os.WriteFile(filepath.Join(home, ".gitconfig"), []byte("[core]\n\tautocrlf = input\n"), 0o644))
+
+	configs, err = loadSystemConfigs()
+	s.NoError(err)
+	s.Equal("input", configs[0].Core.AutoCRLF)
+}
@@ -0,0 +1,174 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/go-git/go-git/v5/plumbing/filter"
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
+)
+
+const (
+	filterSection  = "filter"
+	filterClean    = "clean"
+	filterSmudge   = "smudge"
+	filterProcess  = "process"
+	filterRequired = "required"
+)
+
+// ErrFilterFailed is returned when a required filter driver fails.
+var ErrFilterFailed = errors.New("filter failed")
+
+// filterDriver returns the filter of the driver set by the filter attribute,
+// and whether it's required to succeed, or nil if the driver isn't defined.
+// The filters registered in the filter package take precedence over the
+// native support of Git LFS for the lfs driver, which takes precedence over
+// the filters configured with the filter.<driver> options. The first two are
+// always required.
+func (c *contentConverter) filterDriver(attrs map[string]gitattributes.Attribute) (filter.Filter, bool) {
+	attr, ok := attrs[filterAttribute]
+	if !ok || !attr.IsValueSet() {
+		return nil, false
+	}
+
+	driver := attr.Value()
+	if f, ok := filter.Get(driver); ok {
+		return f, true
+	}
+
+	if driver == lfsDriver {
+		if f := c.lfsFilter(); f != nil {
+			return f, true
+		}
+	}
+
+	required, _ := strconv.ParseBool(c.filterOption(driver, filterRequired))
+	if p, ok := c.processes[driver]; ok {
+		return p, required
+	}
+
+	if cmd := c.filterOption(driver, filterProcess); cmd != "" {
+		if c.processes == nil {
+			c.processes = make(map[string]*filter.Process)
+		}
+
+		p := filter.NewProcess(cmd, c.dir)
+		c.processes[driver] = p
+		return p, required
+	}
+
+	clean, smudge := c.filterOption(driver, filterClean), c.filterOption(driver, filterSmudge)
+	if clean == "" && smudge == "" {
+		return nil, false
+	}
+
+	return filter.NewCommand(clean, smudge, c.dir), required
+}
+
+// filterOption returns the value of the given option of a filter driver,
+// from the config with the highest priority defining it.
+func (c *contentConverter) filterOption(driver, key string) string {
+	return c.configOption(filterSection, driver, key)
+}
+
+// configOption returns the value of the given option of a subsection, from
+// the config with the highest priority defining it.
+func (c *contentConverter) configOption(section, subsection, key string) string {
+	for _, cfg := range c.configs {
+		if cfg.Raw == nil || !cfg.Raw.HasSection(section) {
+			continue
+		}
+
+		s := cfg.Raw.Section(section)
+		if !s.HasSubsection(subsection) {
+			continue
+		}
+
+		if v := s.Subsection(subsection).Option(key); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// clean applies the clean filter of the file at path, if any.
+func (c *contentConverter) clean(p string, attrs map[string]gitattributes.Attribute, content []byte) ([]byte, error) {
+	return c.applyFilter(p, attrs, content, filter.Filter.Clean)
+}
+
+// smudge applies the smudge filter of the file at path, if any.
+func (c *contentConverter) smudge(p string, attrs map[string]gitattributes.Attribute, content []byte) ([]byte, error) {
+	return c.applyFilter(p, attrs, content, filter.Filter.Smudge)
+}
+
+func (c *contentConverter) applyFilter(
+	p string,
+	attrs map[string]gitattributes.Attribute,
+	content []byte,
+	fn func(filter.Filter, string, io.Reader, io.Writer) error,
+) ([]byte, error) {
+	f, required := c.filterDriver(attrs)
+	if f == nil {
+		return content, nil
+	}
+
+	var b bytes.Buffer
+	if err := fn(f, p, bytes.NewReader(content), &b); err != nil {
+		// As git does, the content is used unchanged if the filter fails,
+		// unless the filter is required.
+		if required {
+			return nil, fmt.Errorf("%w: %s: %w", ErrFilterFailed, p, err)
+		}
+
+		return content, nil
+	}
+
+	return b.Bytes(), nil
+}
+
+// streamFilter copies src into dst through the filter of the file at path,
+// if any, without reading the content into memory. It returns false, without
+// reading src, if the filter isn't required, since the content is then used
+// unchanged if the filter fails.
+func (c *contentConverter) streamFilter(
+	p string,
+	attrs map[string]gitattributes.Attribute,
+	dst io.Writer,
+	src io.Reader,
+	fn func(filter.Filter, string, io.Reader, io.Writer) error,
+) (bool, error) {
+	f, required := c.filterDriver(attrs)
+	if f == nil {
+		_, err := io.Copy(dst, src)
+		return true, err
+	}
+
+	if !required {
+		return false, nil
+	}
+
+	if err := fn(f, p, src, dst); err != nil {
+		return true, fmt.Errorf("%w: %s: %w", ErrFilterFailed, p, err)
+	}
+
+	return true, nil
+}
+
+// close stops the filter processes started by the converter, if any.
+func (c *contentConverter) close() error {
+	if c == nil {
+		return nil
+	}
+
+	var errs []error
+	for _, p := range c.processes {
+		errs = append(errs, p.Close())
+	}
+
+	c.processes = nil
+	return errors.Join(errs...)
+}
@@ -0,0 +1,119 @@
+package git
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5/plumbing/filter"
+)
+
+type upperFilter struct{}
+
+func (upperFilter) Clean(_ string, r io.Reader, w io.Writer) error {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(bytes.ToLower(content))
+	return err
+}
+
+func (upperFilter) Smudge(_ string, r io.Reader, w io.Writer) error {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(bytes.ToUpper(content))
+	return err
+}
+
+func (s *WorktreeSuite) TestFilterRegistered() {
+	filter.Register("upper", upperFilter{})
+	defer filter.Unregister("upper")
+
+	r, w := s.setupConvert("", "")
+	s.NoError(util.WriteFile(w.Filesystem, ".gitattributes", []byte("*.up filter=upper\n"), 0o644))
+	s.NoError(util.WriteFile(w.Filesystem, "foo.up", []byte("FOO\r\n"), 0o644))
+	s.NoError(util.WriteFile(w.Filesystem, "foo", []byte("FOO\n"), 0o644))
+
+	h, err := w.Add("foo.up")
+	s.NoError(err)
+	s.Equal("foo\r\n", s.blobContent(r, h))
+
+	s.NoError(w.AddWithOptions(&AddOptions{All: true}))
+	_, err = w.Commit("foo\n", defaultTestCommitOptions())
+	s.NoError(err)
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.True(status.IsClean())
+
+	w.Filesystem = memfs.New()
+	s.NoError(w.Reset(&ResetOptions{Mode: HardReset}))
+
+	content, err := util.ReadFile(w.Filesystem, "foo.up")
+	s.NoError(err)
+	s.Equal("FOO\r\n", string(content))
+
+	status, err = w.Status()
+	s.NoError(err)
+	s.True(status.IsClean())
+}
+
+func (s *WorktreeSuite) TestFilterCommand() {
+	if runtime.GOOS == "windows" {
+		s.T().Skip("filter commands are run by sh")
+	}
+
+	r, err := PlainInit(s.T().TempDir(), false)
+	s.NoError(err)
+
+	w, err := r.Worktree()
+	s.NoError(err)
+
+	cfg, err := r.Config()
+	s.NoError(err)
+	cfg.Raw.Section("filter").Subsection("secret").
+		SetOption("clean", "sed s/secret/XXX/").
+		SetOption("smudge", "echo %f; cat")
+	cfg.Raw.Section("filter").Subsection("broken").SetOption("clean", "exit 1")
+	s.NoError(r.SetConfig(cfg))
+
+	s.NoError(util.WriteFile(w.Filesystem, ".gitattributes", []byte(
+		"*.txt filter=secret\n*.bin filter=broken\n",
+	), 0o644))
+	s.NoError(util.WriteFile(w.Filesystem, "foo.txt", []byte("my secret\n"), 0o644))
+	s.NoError(util.WriteFile(w.Filesystem, "foo.bin", []byte("foo\n"), 0o644))
+
+	h, err := w.Add("foo.txt")
+	s.NoError(err)
+	s.Equal("my XXX\n", s.blobContent(r, h))
+
+	// The content is used unchanged if a filter not required fails.
+	h, err = w.Add("foo.bin")
+	s.NoError(err)
+	s.Equal("foo\n", s.blobContent(r, h))
+
+	cfg.Raw.Section("filter").Subsection("broken").SetOption("required", "true")
+	s.NoError(r.SetConfig(cfg))
+
+	_, err = w.Add("foo.bin")
+	s.ErrorIs(err, ErrFilterFailed)
+
+	_, err = w.Add(".gitattributes")
+	s.NoError(err)
+	_, err = w.Commit("foo\n", defaultTestCommitOptions())
+	s.NoError(err)
+
+	s.NoError(w.Filesystem.Remove("foo.txt"))
+	s.NoError(w.Reset(&ResetOptions{Mode: HardReset}))
+
+	content, err := util.ReadFile(w.Filesystem, "foo.txt")
+	s.NoError(err)
+	s.Equal("foo.txt\nmy XXX\n", string(content))
+}
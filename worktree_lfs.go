@@ -0,0 +1,205 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5/plumbing/lfs"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+const (
+	lfsDriver     = "lfs"
+	lfsSection    = "lfs"
+	lfsURLKey     = "url"
+	lfsRemoteKey  = "lfsurl"
+	lfsObjectsDir = "lfs/objects"
+)
+
+// LFSStore stores the objects of the files tracked by Git LFS. It's used to
+// smudge the pointer files of the files with the filter=lfs attribute on
+// checkout, and to clean their content back into pointer files on add. See
+// the lfs package for the stores available.
+type LFSStore = lfs.Store
+
+// lfsFilter is the filter of the lfs driver, converting between the pointer
+// files and the content of the objects of a LFSStore.
+type lfsFilter struct {
+	store LFSStore
+	err   error
+}
+
+// Clean stores the content as an object, writing its pointer file. Empty
+// files and pointer files are written unchanged. The content is streamed
+// into the store, only its start is read to know if it's a pointer file.
+func (f *lfsFilter) Clean(_ string, r io.Reader, w io.Writer) error {
+	if f.err != nil {
+		return f.err
+	}
+
+	br, head, err := peekPointer(r)
+	if err != nil {
+		return err
+	}
+
+	if len(head) == 0 || lfs.IsPointer(head) {
+		_, err := io.Copy(w, br)
+		return err
+	}
+
+	p, err := lfs.PutContent(f.store, br)
+	if err != nil {
+		return err
+	}
+
+	return p.Encode(w)
+}
+
+// Smudge writes the content of the object of a pointer file, the content of
+// any other file is written unchanged. The content is streamed from the
+// store.
+func (f *lfsFilter) Smudge(_ string, r io.Reader, w io.Writer) error {
+	if f.err != nil {
+		return f.err
+	}
+
+	br, head, err := peekPointer(r)
+	if err != nil {
+		return err
+	}
+
+	p, err := lfs.DecodePointer(head)
+	if err != nil {
+		_, err := io.Copy(w, br)
+		return err
+	}
+
+	rd, err := f.store.Get(p)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, rd)
+	if cerr := rd.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// peekPointer returns a reader of r and its first bytes, enough to hold a
+// pointer file, without consuming them.
+func peekPointer(r io.Reader) (*bufio.Reader, []byte, error) {
+	br := bufio.NewReaderSize(r, lfs.MaxPointerSize+1)
+	head, err := br.Peek(lfs.MaxPointerSize + 1)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+
+	return br, head, nil
+}
+
+// lfsFilter returns the filter of the lfs driver, or nil if the repository
+// has no LFSStore.
+func (c *contentConverter) lfsFilter() *lfsFilter {
+	if c.lfs != nil {
+		return c.lfs
+	}
+
+	if c.r.LFS != nil {
+		c.lfs = &lfsFilter{store: c.r.LFS}
+		return c.lfs
+	}
+
+	type fsBased interface {
+		Filesystem() billy.Filesystem
+	}
+
+	fs, ok := c.r.Storer.(fsBased)
+	if !ok {
+		return nil
+	}
+
+	dir, err := fs.Filesystem().Chroot(lfsObjectsDir)
+	if err != nil {
+		c.lfs = &lfsFilter{err: err}
+		return c.lfs
+	}
+
+	var remote lfs.Store
+	if endpoint := c.lfsEndpoint(); endpoint != "" {
+		client, err := lfs.NewClient(endpoint, nil)
+		if err != nil {
+			c.lfs = &lfsFilter{err: err}
+			return c.lfs
+		}
+
+		remote = client
+	}
+
+	c.lfs = &lfsFilter{store: lfs.NewCachedStore(lfs.NewLocalStore(dir), remote)}
+	return c.lfs
+}
+
+// lfsEndpoint returns the endpoint of the Git LFS server, set by the lfs.url
+// or remote.<name>.lfsurl options, or derived from the URL of the remote as
+// Git LFS does. The origin remote is used, or the only one if there is no
+// origin. It returns an empty string if there is none.
+func (c *contentConverter) lfsEndpoint() string {
+	for _, cfg := range c.configs {
+		if cfg.Raw != nil && cfg.Raw.HasSection(lfsSection) {
+			if v := cfg.Raw.Section(lfsSection).Option(lfsURLKey); v != "" {
+				return v
+			}
+		}
+	}
+
+	local := c.configs[0]
+	remote, ok := local.Remotes[DefaultRemoteName]
+	if !ok && len(local.Remotes) == 1 {
+		for _, r := range local.Remotes {
+			remote, ok = r, true
+		}
+	}
+
+	if !ok || len(remote.URLs) == 0 {
+		return ""
+	}
+
+	if v := c.configOption("remote", remote.Name, lfsRemoteKey); v != "" {
+		return v
+	}
+
+	return lfsEndpointFromURL(remote.URLs[0])
+}
+
+// lfsEndpointFromURL derives the endpoint of the Git LFS server from the URL
+// of a remote, as Git LFS does: the ssh URLs are mapped to https, and
+// /info/lfs is appended to the path of the repository ending in .git.
+func lfsEndpointFromURL(url string) string {
+	ep, err := transport.NewEndpoint(url)
+	if err != nil {
+		return ""
+	}
+
+	e := &transport.Endpoint{Host: ep.Host}
+	switch ep.Protocol {
+	case "http", "https":
+		e.Protocol, e.User, e.Password, e.Port = ep.Protocol, ep.User, ep.Password, ep.Port
+	case "ssh":
+		e.Protocol = "https"
+	default:
+		return ""
+	}
+
+	path := strings.TrimSuffix(ep.Path, "/")
+	if !strings.HasSuffix(path, ".git") {
+		path += ".git"
+	}
+
+	e.Path = fmt.Sprintf("%s/info/lfs", path)
+	return e.String()
+}
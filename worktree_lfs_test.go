@@ -0,0 +1,123 @@
+package git
+
+import (
+	"bytes"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/lfs"
+	"github.com/go-git/go-git/v5/plumbing/lfs/lfstest"
+)
+
+func (s *WorktreeSuite) TestLFS() {
+	server := lfstest.NewServer()
+	defer server.Close()
+
+	r, err := PlainInit(s.T().TempDir(), false)
+	s.NoError(err)
+
+	cfg, err := r.Config()
+	s.NoError(err)
+	cfg.Raw.Section("lfs").SetOption("url", server.Endpoint())
+	s.NoError(r.SetConfig(cfg))
+
+	w, err := r.Worktree()
+	s.NoError(err)
+
+	s.NoError(util.WriteFile(w.Filesystem, ".gitattributes", []byte("*.bin filter=lfs\n"), 0o644))
+	s.NoError(util.WriteFile(w.Filesystem, "foo.bin", []byte("foo\n"), 0o644))
+
+	h, err := w.Add("foo.bin")
+	s.NoError(err)
+
+	p, err := lfs.NewPointer(bytes.NewReader([]byte("foo\n")))
+	s.NoError(err)
+	s.Equal(string(p.Bytes()), s.blobContent(r, h))
+
+	dotgit := r.Storer.(interface{ Filesystem() billy.Filesystem }).Filesystem()
+	content, err := util.ReadFile(dotgit, "lfs/objects/b5/bb/"+p.Oid)
+	s.NoError(err)
+	s.Equal("foo\n", string(content))
+
+	s.NoError(w.AddWithOptions(&AddOptions{All: true}))
+	_, err = w.Commit("foo\n", defaultTestCommitOptions())
+	s.NoError(err)
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.True(status.IsClean())
+
+	// The objects missing from the local cache are fetched from the server.
+	s.NoError(util.RemoveAll(dotgit, "lfs"))
+	s.NoError(w.Filesystem.Remove("foo.bin"))
+	server.Add([]byte("foo\n"))
+	s.NoError(w.Reset(&ResetOptions{Mode: HardReset}))
+
+	content, err = util.ReadFile(w.Filesystem, "foo.bin")
+	s.NoError(err)
+	s.Equal("foo\n", string(content))
+	s.Equal(1, server.Requests(lfs.OperationDownload))
+
+	_, err = util.ReadFile(dotgit, "lfs/objects/b5/bb/"+p.Oid)
+	s.NoError(err)
+}
+
+func (s *WorktreeSuite) TestLFSStore() {
+	r, w := s.setupConvert("", "")
+	r.LFS = lfs.NewLocalStore(memfs.New())
+
+	s.NoError(util.WriteFile(w.Filesystem, ".gitattributes", []byte("*.bin filter=lfs\n"), 0o644))
+	s.NoError(util.WriteFile(w.Filesystem, "foo.bin", []byte("foo\n"), 0o644))
+	s.NoError(util.WriteFile(w.Filesystem, "bar.bin", []byte("bar\n"), 0o644))
+
+	s.NoError(w.AddWithOptions(&AddOptions{All: true}))
+	_, err := w.Commit("foo\n", defaultTestCommitOptions())
+	s.NoError(err)
+
+	// The objects missing from the store fail the checkout.
+	r.LFS = lfs.NewLocalStore(memfs.New())
+	p, err := lfs.NewPointer(bytes.NewReader([]byte("bar\n")))
+	s.NoError(err)
+	s.NoError(r.LFS.Put(p, bytes.NewReader([]byte("bar\n"))))
+
+	w.Filesystem = memfs.New()
+	err = w.Reset(&ResetOptions{Mode: HardReset})
+	s.ErrorIs(err, ErrFilterFailed)
+	s.ErrorIs(err, lfs.ErrObjectNotFound)
+
+	content, err := util.ReadFile(w.Filesystem, "bar.bin")
+	s.NoError(err)
+	s.Equal("bar\n", string(content))
+}
+
+func (s *WorktreeSuite) TestLFSEndpoint() {
+	for url, expected := range map[string]string{
+		"https://example.com/foo":               "https://example.com/foo.git/info/lfs",
+		"https://user@example.com:8443/foo.git": "https://user@example.com:8443/foo.git/info/lfs",
+		"git@example.com:foo/bar.git":           "https://example.com/foo/bar.git/info/lfs",
+		"ssh://git@example.com:2222/foo/":       "https://example.com/foo.git/info/lfs",
+		"/tmp/foo":                              "",
+		"git://example.com/foo":                 "",
+	} {
+		s.Equal(expected, lfsEndpointFromURL(url), url)
+	}
+
+	// The only remote is used if there is no origin.
+	r, _ := s.setupConvert("", "")
+	_, err := r.CreateRemote(&config.RemoteConfig{Name: "upstream", URLs: []string{"https://example.com/foo"}})
+	s.NoError(err)
+
+	cfg, err := r.Config()
+	s.NoError(err)
+
+	c := &contentConverter{r: r, configs: []*config.Config{cfg}}
+	s.Equal("https://example.com/foo.git/info/lfs", c.lfsEndpoint())
+
+	cfg.Raw.Section("remote").Subsection("upstream").SetOption("lfsurl", "https://example.com/lfs")
+	s.Equal("https://example.com/lfs", c.lfsEndpoint())
+
+	cfg.Raw.Section("lfs").SetOption("url", "https://example.com/bar")
+	s.Equal("https://example.com/bar", c.lfsEndpoint())
+}
@@ -117,6 +117,21 @@ func (w *Worktree) status(ss StatusStrategy, commit plumbing.Hash) (Status, erro
 		}
 	}
 
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range idx.Entries {
+		if e.Stage == index.Merged {
+			continue
+		}
+
+		fs := s.File(e.Name)
+		fs.Staging = UpdatedButUnmerged
+		fs.Worktree = UpdatedButUnmerged
+	}
+
 	return s, nil
 }
 
@@ -141,7 +156,18 @@ func (w *Worktree) diffStagingWithWorktree(reverse, excludeIgnoredChanges bool)
 		return nil, err
 	}
 
-	to := filesystem.NewRootNode(w.Filesystem, submodules)
+	conv, err := w.newWorktreeConverter(idx)
+	if err != nil {
+		return nil, err
+	}
+	defer conv.close()
+
+	var opts filesystem.Options
+	if conv != nil {
+		opts.Clean = conv.toRepository
+	}
+
+	to := filesystem.NewRootNodeWithOptions(w.Filesystem, submodules, opts)
 
 	var c merkletrie.Changes
 	if reverse {
@@ -290,7 +316,7 @@ func (w *Worktree) Add(path string) (plumbing.Hash, error) {
 	return w.doAdd(path, make([]gitignore.Pattern, 0), false)
 }
 
-func (w *Worktree) doAddDirectory(idx *index.Index, s Status, directory string, ignorePattern []gitignore.Pattern) (added bool, err error) {
+func (w *Worktree) doAddDirectory(idx *index.Index, conv *contentConverter, s Status, directory string, ignorePattern []gitignore.Pattern) (added bool, err error) {
 	if len(ignorePattern) > 0 {
 		m := gitignore.NewMatcher(ignorePattern)
 		matchPath := strings.Split(directory, string(os.PathSeparator))
@@ -308,7 +334,7 @@ func (w *Worktree) doAddDirectory(idx *index.Index, s Status, directory string,
 		}
 
 		var a bool
-		a, _, err = w.doAddFile(idx, s, name, ignorePattern)
+		a, _, err = w.doAddFile(idx, conv, s, name, ignorePattern)
 		if err != nil {
 			return
 		}
@@ -370,12 +396,18 @@ func (w *Worktree) doAdd(path string, ignorePattern []gitignore.Pattern, skipSta
 		}
 	}
 
+	conv, err2 := w.newWorktreeConverter(idx)
+	if err2 != nil {
+		return plumbing.ZeroHash, err2
+	}
+	defer conv.close()
+
 	path = filepath.Clean(path)
 
 	if err != nil || !fi.IsDir() {
-		added, h, err = w.doAddFile(idx, s, path, ignorePattern)
+		added, h, err = w.doAddFile(idx, conv, s, path, ignorePattern)
 	} else {
-		added, err = w.doAddDirectory(idx, s, path, ignorePattern)
+		added, err = w.doAddDirectory(idx, conv, s, path, ignorePattern)
 	}
 
 	if err != nil {
@@ -413,6 +445,12 @@ func (w *Worktree) AddGlob(pattern string) error {
 		return err
 	}
 
+	conv, err := w.newWorktreeConverter(idx)
+	if err != nil {
+		return err
+	}
+	defer conv.close()
+
 	var saveIndex bool
 	for _, file := range files {
 		fi, err := w.Filesystem.Lstat(file)
@@ -422,9 +460,9 @@ func (w *Worktree) AddGlob(pattern string) error {
 
 		var added bool
 		if fi.IsDir() {
-			added, err = w.doAddDirectory(idx, s, file, make([]gitignore.Pattern, 0))
+			added, err = w.doAddDirectory(idx, conv, s, file, make([]gitignore.Pattern, 0))
 		} else {
-			added, _, err = w.doAddFile(idx, s, file, make([]gitignore.Pattern, 0))
+			added, _, err = w.doAddFile(idx, conv, s, file, make([]gitignore.Pattern, 0))
 		}
 
 		if err != nil {
@@ -445,8 +483,9 @@ func (w *Worktree) AddGlob(pattern string) error {
 
 // doAddFile create a new blob from path and update the index, added is true if
 // the file added is different from the index.
-// if s status is nil will skip the status check and update the index anyway
-func (w *Worktree) doAddFile(idx *index.Index, s Status, path string, ignorePattern []gitignore.Pattern) (added bool, h plumbing.Hash, err error) {
+// if s status is nil will skip the status check and update the index anyway.
+// The content of the file is converted by conv, if not nil.
+func (w *Worktree) doAddFile(idx *index.Index, conv *contentConverter, s Status, path string, ignorePattern []gitignore.Pattern) (added bool, h plumbing.Hash, err error) {
 	if s != nil && s.File(path).Worktree == Unmodified {
 		return false, h, nil
 	}
@@ -459,7 +498,7 @@ func (w *Worktree) doAddFile(idx *index.Index, s Status, path string, ignorePatt
 		}
 	}
 
-	h, err = w.copyFileToStorage(path)
+	h, err = w.copyFileToStorage(path, conv)
 	if err != nil {
 		if os.IsNotExist(err) {
 			added = true
@@ -476,7 +515,7 @@ func (w *Worktree) doAddFile(idx *index.Index, s Status, path string, ignorePatt
 	return true, h, err
 }
 
-func (w *Worktree) copyFileToStorage(path string) (hash plumbing.Hash, err error) {
+func (w *Worktree) copyFileToStorage(path string, conv *contentConverter) (hash plumbing.Hash, err error) {
 	fi, err := w.Filesystem.Lstat(path)
 	if err != nil {
 		return plumbing.ZeroHash, err
@@ -496,7 +535,7 @@ func (w *Worktree) copyFileToStorage(path string) (hash plumbing.Hash, err error
 	if fi.Mode()&os.ModeSymlink != 0 {
 		err = w.fillEncodedObjectFromSymlink(writer, path, fi)
 	} else {
-		err = w.fillEncodedObjectFromFile(writer, path, fi)
+		err = w.fillEncodedObjectFromFile(writer, path, fi, conv)
 	}
 
 	if err != nil {
@@ -506,7 +545,7 @@ func (w *Worktree) copyFileToStorage(path string) (hash plumbing.Hash, err error
 	return w.r.Storer.SetEncodedObject(obj)
 }
 
-func (w *Worktree) fillEncodedObjectFromFile(dst io.Writer, path string, _ os.FileInfo) (err error) {
+func (w *Worktree) fillEncodedObjectFromFile(dst io.Writer, path string, _ os.FileInfo, conv *contentConverter) (err error) {
 	src, err := w.Filesystem.Open(path)
 	if err != nil {
 		return err
@@ -514,6 +553,10 @@ func (w *Worktree) fillEncodedObjectFromFile(dst io.Writer, path string, _ os.Fi
 
 	defer ioutil.CheckClose(src, &err)
 
+	if conv != nil {
+		return conv.copyToRepository(dst, src, path)
+	}
+
 	if _, err := io.Copy(dst, src); err != nil {
 		return err
 	}
@@ -537,6 +580,12 @@ func (w *Worktree) addOrUpdateFileToIndex(idx *index.Index, filename string, h p
 		return err
 	}
 
+	// Adding a file with merge conflicts marks it as resolved.
+	if e != nil && e.Stage != index.Merged {
+		removeIndexEntries(idx, e.Name)
+		err = index.ErrEntryNotFound
+	}
+
 	if err == index.ErrEntryNotFound {
 		return w.doAddFileToIndex(idx, filename, h)
 	}